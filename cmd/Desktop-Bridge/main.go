@@ -57,6 +57,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/pkg/args"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	"github.com/ProtonMail/proton-bridge/pkg/updates"
 	"github.com/allan-simon/go-singleinstance"
 	"github.com/getsentry/raven-go"
@@ -104,6 +105,11 @@ func main() {
 	args.FilterProcessSerialNumberFromArgs()
 	filterRestartNumberFromArgs()
 
+	// Sendmail is run by cron jobs and daemons, only the exit code matters.
+	if sendmailArgs, ok := getSendmailArgs(); ok {
+		os.Exit(runSendmail(sendmailArgs))
+	}
+
 	app := cli.NewApp()
 	app.Name = "Protonmail Bridge"
 	app.Version = buildVersion
@@ -123,6 +129,15 @@ func main() {
 		cli.StringFlag{
 			Name:  "version-json, g",
 			Usage: "Generate json version file"},
+		cli.StringFlag{
+			Name:  "bind-address",
+			Usage: "Save the address of IMAP and SMTP listeners, e.g. 0.0.0.0 makes them reachable from other machines"},
+		cli.IntFlag{
+			Name:  "imap-port",
+			Usage: "Save the port of IMAP listener"},
+		cli.IntFlag{
+			Name:  "smtp-port",
+			Usage: "Save the port of SMTP listener"},
 		cli.BoolFlag{
 			Name:  "mem-prof, m",
 			Usage: "Generate memory profile"},
@@ -247,6 +262,10 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	}
 	defer lock.Close() //nolint[errcheck]
 
+	// Listener flags are saved so that all frontends show the same settings
+	// as used by the servers. Only the running instance can change them.
+	setListenerPreferences(context, pref)
+
 	// In case user wants to do CPU or memory profiles...
 	if doCPUProfile := context.GlobalBool("cpu-prof"); doCPUProfile {
 		f, err := os.Create("cpu.pprof")
@@ -277,18 +296,31 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 
 	bridgeInstance := bridge.New(cfg, pref, panicHandler, eventListener, Version, pmapiClientFactory, credentialsStore)
 	imapBackend := imap.NewIMAPBackend(panicHandler, eventListener, cfg, bridgeInstance)
-	smtpBackend := smtp.NewSMTPBackend(panicHandler, eventListener, pref, bridgeInstance)
+	smtpBackend := smtp.NewSMTPBackend(panicHandler, eventListener, cfg, pref, bridgeInstance)
+	proxyProtocol := pref.GetBool(preferences.ProxyProtocolKey)
+	requireTLS := pref.GetBool(preferences.RequireTLSKey)
+	bindAddress := pref.Get(preferences.BindAddressKey)
+	if !ports.IsLocalHost(bindAddress) {
+		log.WithField("address", bindAddress).WithField("requireTLS", requireTLS).Warn("IMAP and SMTP are reachable from other machines, protect the access by firewall")
+	}
 
 	go func() {
 		defer panicHandler.HandlePanic()
-		apiServer := api.NewAPIServer(pref, tls, cfg.GetTLSCertPath(), cfg.GetTLSKeyPath(), eventListener)
+		apiServer := api.NewAPIServer(pref, tls, cfg.GetTLSCertPath(), cfg.GetTLSKeyPath(), cfg.GetIMAPTracePath, eventListener, bridgeInstance)
 		apiServer.ListenAndServe()
 	}()
 
 	go func() {
 		defer panicHandler.HandlePanic()
 		imapPort := pref.GetInt(preferences.IMAPPortKey)
-		imapServer := imap.NewIMAPServer(debugClient, debugServer, imapPort, tls, imapBackend, eventListener)
+		imapServer := imap.NewIMAPServer(debugClient, debugServer, bindAddress, imapPort, proxyProtocol, requireTLS, tls, imapBackend, eventListener)
+		if imapsPort := pref.GetInt(preferences.IMAPSPortKey); imapsPort != 0 {
+			imapsTLS := config.GetUserTLSConfig(cfg.GetIMAPSCertPath(), cfg.GetIMAPSKeyPath(), tls)
+			go func() {
+				defer panicHandler.HandlePanic()
+				imapServer.ListenAndServeIMAPS(imapsPort, imapsTLS)
+			}()
+		}
 		imapServer.ListenAndServe()
 	}()
 
@@ -296,10 +328,26 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 		defer panicHandler.HandlePanic()
 		smtpPort := pref.GetInt(preferences.SMTPPortKey)
 		useSSL := pref.GetBool(preferences.SMTPSSLKey)
-		smtpServer := smtp.NewSMTPServer(debugClient || debugServer, smtpPort, useSSL, tls, smtpBackend, eventListener)
+		smtpServer := smtp.NewSMTPServer(debugClient || debugServer, bindAddress, smtpPort, useSSL, proxyProtocol, requireTLS, tls, smtpBackend, eventListener)
 		smtpServer.ListenAndServe()
 	}()
 
+	if smtpsPort := pref.GetInt(preferences.SMTPSPortKey); smtpsPort != 0 {
+		go func() {
+			defer panicHandler.HandlePanic()
+			smtpsServer := smtp.NewSMTPServer(debugClient || debugServer, bindAddress, smtpsPort, true, proxyProtocol, requireTLS, tls, smtpBackend, eventListener)
+			smtpsServer.ListenAndServe()
+		}()
+	}
+
+	if lmtpPort := pref.GetInt(preferences.LMTPPortKey); lmtpPort != 0 {
+		go func() {
+			defer panicHandler.HandlePanic()
+			lmtpServer := smtp.NewLMTPServer(debugClient || debugServer, lmtpPort, smtpBackend, eventListener)
+			lmtpServer.ListenAndServe()
+		}()
+	}
+
 	// Decide about frontend mode before initializing rest of bridge.
 	var frontendMode string
 
@@ -321,7 +369,7 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	}
 
 	showWindowOnStart := !context.GlobalBool("no-window")
-	frontend := frontend.New(Version, buildVersion, frontendMode, showWindowOnStart, panicHandler, cfg, pref, eventListener, updates, bridgeInstance, smtpBackend)
+	frontend := frontend.New(Version, buildVersion, frontendMode, showWindowOnStart, panicHandler, cfg, pref, eventListener, updates, bridgeInstance, smtpBackend, smtpBackend, smtpBackend)
 
 	// Last part is to start everything.
 	log.Debug("Starting frontend...")
@@ -337,6 +385,19 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	return nil
 }
 
+// setListenerPreferences saves the address and ports of listeners given by flags.
+func setListenerPreferences(context *cli.Context, pref *config.Preferences) {
+	if context.GlobalIsSet("bind-address") {
+		pref.Set(preferences.BindAddressKey, context.GlobalString("bind-address"))
+	}
+	if context.GlobalIsSet("imap-port") {
+		pref.SetInt(preferences.IMAPPortKey, context.GlobalInt("imap-port"))
+	}
+	if context.GlobalIsSet("smtp-port") {
+		pref.SetInt(preferences.SMTPPortKey, context.GlobalInt("smtp-port"))
+	}
+}
+
 // migratePreferencesFromC10 will copy preferences from c10 folder to c11.
 // It will happen only when c10/prefs.json exists and c11/prefs.json not.
 // No configuration changed between c10 and c11 versions.
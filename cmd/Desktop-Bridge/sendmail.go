@@ -0,0 +1,149 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/bridge/credentials"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/sendmail"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/ports"
+)
+
+const sendmailCommand = "sendmail"
+
+// getSendmailArgs returns sendmail arguments and true when bridge is run
+// as sendmail, i.e. through a symlink named sendmail or with the first
+// argument sendmail.
+func getSendmailArgs() ([]string, bool) {
+	if strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == sendmailCommand {
+		return os.Args[1:], true
+	}
+	if len(os.Args) > 1 && os.Args[1] == sendmailCommand {
+		return os.Args[2:], true
+	}
+	return nil, false
+}
+
+// runSendmail submits the message from stdin through the running bridge
+// and returns sendmail exit code.
+func runSendmail(args []string) int {
+	opts, err := sendmail.ParseArgs(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sendmail:", err)
+		return sendmail.ExitUsage
+	}
+
+	msg, from, to, err := sendmail.ReadMessage(os.Stdin, opts)
+	if err == sendmail.ErrNoRecipients {
+		fmt.Fprintln(os.Stderr, "sendmail:", err)
+		return sendmail.ExitUsage
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "sendmail:", err)
+		return sendmail.ExitDataErr
+	}
+
+	cfg := config.New(AppShortName, Version, Revision, cacheVersion)
+	server, err := getSendmailServer(cfg, preferences.New(cfg), from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sendmail:", err)
+		return sendmail.ExitNoUser
+	}
+	if from == "" {
+		from = server.Username
+	}
+
+	if err := server.Send(from, to, msg); err != nil {
+		fmt.Fprintln(os.Stderr, "sendmail: cannot send message:", err)
+		return sendmail.GetExitCode(err)
+	}
+	return sendmail.ExitOK
+}
+
+// getSendmailServer returns the bridge SMTP server with credentials of the
+// connected user owning address `from`, or the first one if `from` is empty.
+func getSendmailServer(cfg *config.Config, pref *config.Preferences, from string) (*sendmail.Server, error) {
+	tlsConfig, err := getSendmailTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := credentials.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	userIDs, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range userIDs {
+		creds, err := store.Get(userID)
+		if err != nil || !creds.IsConnected() {
+			continue
+		}
+		for _, email := range creds.EmailList() {
+			if from == "" || strings.EqualFold(email, from) {
+				return &sendmail.Server{
+					Addr: net.JoinHostPort(
+						ports.ClientHost(pref.Get(preferences.BindAddressKey), bridge.Host),
+						strconv.Itoa(pref.GetInt(preferences.SMTPPortKey)),
+					),
+					UseSSL:    pref.GetBool(preferences.SMTPSSLKey),
+					TLSConfig: tlsConfig,
+					Username:  email,
+					Password:  creds.BridgePassword,
+				}, nil
+			}
+		}
+	}
+
+	if from == "" {
+		return nil, errors.New("no connected account")
+	}
+	return nil, errors.New("no connected account with address " + from)
+}
+
+// getSendmailTLSConfig trusts only the bridge certificate.
+func getSendmailTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	cert, err := ioutil.ReadFile(cfg.GetTLSCertPath())
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(cert) {
+		return nil, errors.New("cannot load bridge certificate")
+	}
+	return &tls.Config{
+		RootCAs:    pool,
+		ServerName: bridge.Host,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
@@ -19,6 +19,8 @@
 //
 // API endpoints:
 //  * /focus, see focusHandler
+//  * /trace-imap, see traceIMAPHandler
+//  * /metrics, see metricsHandler
 package api
 
 import (
@@ -45,17 +47,23 @@ type apiServer struct {
 	certPath      string
 	keyPath       string
 	eventListener listener.Listener
+	tracePath     func() string
+	bridge        *bridge.Bridge
 }
 
 // NewAPIServer returns prepared API server struct.
-func NewAPIServer(pref *config.Preferences, tls *tls.Config, certPath, keyPath string, eventListener listener.Listener) *apiServer { //nolint[golint]
+// The tracePath returns path to a new file for the trace of IMAP connection.
+// Users of the bridge are used to report metrics of their stores.
+func NewAPIServer(pref *config.Preferences, tls *tls.Config, certPath, keyPath string, tracePath func() string, eventListener listener.Listener, b *bridge.Bridge) *apiServer { //nolint[golint]
 	return &apiServer{
 		host:          bridge.Host,
 		pref:          pref,
 		tls:           tls,
 		certPath:      certPath,
 		keyPath:       keyPath,
+		tracePath:     tracePath,
 		eventListener: eventListener,
+		bridge:        b,
 	}
 }
 
@@ -63,6 +71,8 @@ func NewAPIServer(pref *config.Preferences, tls *tls.Config, certPath, keyPath s
 func (api *apiServer) ListenAndServe() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/focus", wrapper(api, focusHandler))
+	mux.HandleFunc("/trace-imap", wrapper(api, traceIMAPHandler))
+	mux.HandleFunc("/metrics", wrapper(api, metricsHandler))
 
 	addr := api.getAddress()
 	server := &http.Server{
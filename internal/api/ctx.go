@@ -20,6 +20,7 @@ package api
 import (
 	"net/http"
 
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 )
 
@@ -33,6 +34,8 @@ type handlerContext struct {
 	req           *http.Request
 	resp          http.ResponseWriter
 	eventListener listener.Listener
+	tracePath     func() string
+	bridge        *bridge.Bridge
 }
 
 func wrapper(api *apiServer, callback handler) httpHandler {
@@ -41,6 +44,8 @@ func wrapper(api *apiServer, callback handler) httpHandler {
 			req:           req,
 			resp:          w,
 			eventListener: api.eventListener,
+			tracePath:     api.tracePath,
+			bridge:        api.bridge,
 		}
 		err := callback(ctx)
 		if err != nil {
@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+)
+
+type userMetrics struct {
+	Username  string
+	Error     string                 `json:",omitempty"`
+	Mailboxes []store.MailboxMetrics `json:",omitempty"`
+
+	CacheEnabled   bool
+	CacheHits      uint64
+	CacheMisses    uint64
+	CacheHitRate   float64
+	CachedMessages int
+	CacheSize      int64
+
+	LastPollTime    *time.Time `json:",omitempty"`
+	EventLagSeconds float64
+	LastSyncTime    *time.Time `json:",omitempty"`
+	IsSyncing       bool
+}
+
+// metricsHandler responds with statistics of stores of all users in JSON
+// for troubleshooting, see store.Metrics.
+func metricsHandler(ctx handlerContext) error {
+	if ctx.req.Method != http.MethodGet {
+		http.Error(ctx.resp, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	users := []userMetrics{}
+	for _, user := range ctx.bridge.GetUsers() {
+		metrics, err := user.GetStoreMetrics()
+		if err != nil {
+			users = append(users, userMetrics{Username: user.Username(), Error: err.Error()})
+			continue
+		}
+		users = append(users, newUserMetrics(user.Username(), metrics))
+	}
+
+	ctx.resp.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(ctx.resp).Encode(users)
+}
+
+func newUserMetrics(username string, metrics store.Metrics) userMetrics {
+	um := userMetrics{
+		Username:        username,
+		Mailboxes:       metrics.Mailboxes,
+		CacheEnabled:    metrics.CacheEnabled,
+		CacheHits:       metrics.CacheHits,
+		CacheMisses:     metrics.CacheMisses,
+		CacheHitRate:    metrics.CacheHitRate(),
+		CachedMessages:  metrics.CachedMessages,
+		CacheSize:       metrics.CacheSize,
+		EventLagSeconds: metrics.EventLag.Seconds(),
+		IsSyncing:       metrics.IsSyncing,
+	}
+	if !metrics.LastPollTime.IsZero() {
+		um.LastPollTime = &metrics.LastPollTime
+	}
+	if !metrics.LastSyncTime.IsZero() {
+		um.LastSyncTime = &metrics.LastSyncTime
+	}
+	return um
+}
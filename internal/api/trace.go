@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+)
+
+// traceIMAPHandler requests the trace of the next IMAP connection with POST
+// and responds with the path of the trace file in the log folder. DELETE
+// cancels the request which has not started yet.
+func traceIMAPHandler(ctx handlerContext) error {
+	switch ctx.req.Method {
+	case http.MethodPost:
+		path := ctx.tracePath()
+		log.WithField("path", path).Info("Trace of IMAP connection requested")
+		ctx.eventListener.Emit(events.TraceIMAPConnectionEvent, path)
+		fmt.Fprintf(ctx.resp, "%s", path)
+	case http.MethodDelete:
+		log.Info("Trace of IMAP connection cancelled")
+		ctx.eventListener.Emit(events.TraceIMAPConnectionEvent, "")
+		fmt.Fprintf(ctx.resp, "OK")
+	default:
+		http.Error(ctx.resp, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ package bridge
 
 import (
 	"errors"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -52,6 +53,9 @@ type Bridge struct {
 	credStorer         CredentialsStorer
 	storeCache         *store.Cache
 
+	// imapKeywords maps IMAP keywords to names of labels.
+	imapKeywords map[string]string
+
 	// users is a list of accounts that have been added to bridge.
 	// They are stored sorted in the credentials store in the order
 	// that they were added to bridge chronologically.
@@ -100,14 +104,25 @@ func New(
 		AllowDoH()
 	}
 
+	store.SetSyncMaxWorkers(pref.GetInt(preferences.SyncWorkersKey))
+	store.SetCompactInterval(pref.GetInt(preferences.StoreCompactIntervalKey))
+	store.SetPollInterval(pref.GetInt(preferences.EventPollIntervalKey))
+	store.SetPrefetchCount(pref.GetInt(preferences.PrefetchMessagesKey))
+	SetBandwidthLimits(pref)
+
 	go func() {
 		defer panicHandler.HandlePanic()
 		b.watchBridgeOutdated()
 	}()
 
+	var err error
+	if b.imapKeywords, err = store.LoadKeywords(config.GetIMAPKeywordsPath()); err != nil {
+		log.WithError(err).Error("Could not load IMAP keywords, no keyword is mapped to labels")
+	}
+
 	if b.credStorer == nil {
 		log.Error("Bridge has no credentials store")
-	} else if err := b.loadUsersFromCredentialsStore(); err != nil {
+	} else if err = b.loadUsersFromCredentialsStore(); err != nil {
 		log.WithError(err).Error("Could not load all users from credentials store")
 	}
 
@@ -150,7 +165,7 @@ func (b *Bridge) loadUsersFromCredentialsStore() (err error) {
 
 		apiClient := b.pmapiClientFactory(userID)
 
-		user, newUserErr := newUser(b.panicHandler, userID, b.events, b.credStorer, apiClient, b.storeCache, b.config.GetDBDir())
+		user, newUserErr := newUser(b.panicHandler, userID, b.events, b.credStorer, apiClient, b.storeCache, b.getUserStoreDir(userID), b.config.GetUIDsDir())
 		if newUserErr != nil {
 			l.WithField("user", userID).WithError(newUserErr).Warn("Could not load user, skipping")
 			continue
@@ -160,12 +175,25 @@ func (b *Bridge) loadUsersFromCredentialsStore() (err error) {
 
 		if initUserErr := user.init(b.idleUpdates, apiClient); initUserErr != nil {
 			l.WithField("user", userID).WithError(initUserErr).Warn("Could not initialise user")
+			continue
 		}
+
+		b.setUpUserStore(user)
 	}
 
 	return err
 }
 
+// setUpUserStore applies bridge settings to the store of the user.
+func (b *Bridge) setUpUserStore(user *User) {
+	user.setIMAPKeywords(b.imapKeywords)
+	if b.pref.GetBool(preferences.FullTextIndexKey) {
+		user.enableFullTextIndex()
+	}
+	user.enableMessageCache(b.pref.GetInt(preferences.MessageCacheSizeKey))
+	user.enableAttachmentCache(b.pref.GetInt(preferences.AttachmentCacheSizeKey))
+}
+
 func (b *Bridge) watchBridgeOutdated() {
 	ch := make(chan string)
 	b.events.Add(events.UpgradeApplicationEvent, ch)
@@ -297,7 +325,7 @@ func (b *Bridge) FinishLogin(loginClient PMAPIProvider, auth *pmapi.Auth, mbPass
 
 	// If it's a new user, generate the user object.
 	if !hasUser {
-		user, err = newUser(b.panicHandler, apiUser.ID, b.events, b.credStorer, apiClient, b.storeCache, b.config.GetDBDir())
+		user, err = newUser(b.panicHandler, apiUser.ID, b.events, b.credStorer, apiClient, b.storeCache, b.getUserStoreDir(apiUser.ID), b.config.GetUIDsDir())
 		if err != nil {
 			log.WithField("user", apiUser.ID).WithError(err).Error("Could not create user")
 			return
@@ -310,6 +338,8 @@ func (b *Bridge) FinishLogin(loginClient PMAPIProvider, auth *pmapi.Auth, mbPass
 		return
 	}
 
+	b.setUpUserStore(user)
+
 	if !hasUser {
 		b.users = append(b.users, user)
 		b.SendMetric(m.New(m.Setup, m.NewUser, m.NoLabel))
@@ -383,20 +413,23 @@ func (b *Bridge) DeleteUser(userID string, clearStore bool) error {
 				// Token will still be valid, but will expire eventually.
 			}
 
-			if err := user.closeStore(); err != nil {
-				log.WithError(err).Error("Failed to close user store")
-			}
 			if clearStore {
 				// Clear cache after closing connections (done in logout).
+				// The store is removed without saving its UIDs.
 				if err := user.clearStore(); err != nil {
 					log.WithError(err).Error("Failed to clear user")
 				}
+			} else if err := user.closeStore(); err != nil {
+				log.WithError(err).Error("Failed to close user store")
 			}
 
 			if err := b.credStorer.Delete(userID); err != nil {
 				log.WithError(err).Error("Cannot remove user")
 				return err
 			}
+			if clearStore {
+				b.pref.Set(preferences.UserStoreDirKey(userID), "")
+			}
 			b.users = append(b.users[:idx], b.users[idx+1:]...)
 			return nil
 		}
@@ -405,6 +438,59 @@ func (b *Bridge) DeleteUser(userID string, clearStore bool) error {
 	return errors.New("user " + userID + " not found")
 }
 
+// MoveUserStore moves the store database and cached messages of the user to
+// the directory, or to the default one when it is empty. The store is closed
+// and stays closed until bridge is restarted. When the move fails, the store
+// stays at the previous directory and is opened again.
+func (b *Bridge) MoveUserStore(userID, dir string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	user, ok := b.hasUser(userID)
+	if !ok {
+		return errors.New("user " + userID + " not found")
+	}
+
+	if dir != "" && !filepath.IsAbs(dir) {
+		return errors.New("directory " + dir + " is not an absolute path")
+	}
+	storeDir := dir
+	if storeDir == "" {
+		storeDir = b.config.GetDBDir()
+	}
+
+	if err := user.moveStore(storeDir); err != nil {
+		// Store was opened again at the previous path.
+		b.setUpUserStore(user)
+		return err
+	}
+	b.pref.Set(preferences.UserStoreDirKey(userID), dir)
+	return nil
+}
+
+// ImportUserStore replaces the store of the user by the snapshot exported by
+// User.ExportStore. The store is closed and stays closed until bridge is
+// restarted.
+func (b *Bridge) ImportUserStore(userID, path string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	user, ok := b.hasUser(userID)
+	if !ok {
+		return errors.New("user " + userID + " not found")
+	}
+
+	return user.importStore(path)
+}
+
+// getUserStoreDir returns the directory of the store of the user.
+func (b *Bridge) getUserStoreDir(userID string) string {
+	if dir := b.pref.Get(preferences.UserStoreDirKey(userID)); dir != "" {
+		return dir
+	}
+	return b.config.GetDBDir()
+}
+
 // ReportBug reports a new bug from the user.
 func (b *Bridge) ReportBug(osType, osVersion, description, accountName, address, emailClient string) error {
 	apiClient := b.pmapiClientFactory("bug_reporter")
@@ -480,6 +566,18 @@ func AllowDoH() {
 	pmapi.GlobalAllowDoH()
 }
 
+// SetBandwidthLimits limits API traffic of all users to kilobytes per second
+// from preferences, separately for sync of all messages and for events.
+func SetBandwidthLimits(pref PreferenceProvider) {
+	kB := func(key string) int64 {
+		return int64(pref.GetInt(key)) * 1000
+	}
+	pmapi.InitialSyncBandwidth.Download.SetRate(kB(preferences.SyncDownloadLimitKey))
+	pmapi.InitialSyncBandwidth.Upload.SetRate(kB(preferences.SyncUploadLimitKey))
+	pmapi.EventsBandwidth.Download.SetRate(kB(preferences.EventsDownloadLimitKey))
+	pmapi.EventsBandwidth.Upload.SetRate(kB(preferences.EventsUploadLimitKey))
+}
+
 // DisallowDoH instructs bridge to not use DoH to access an API proxy if necessary.
 // It also needs to work before bridge is initialised (because we may need to use the proxy at startup).
 func DisallowDoH() {
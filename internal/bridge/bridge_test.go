@@ -133,6 +133,7 @@ type mocks struct {
 	eventListener    *MockListener
 
 	storeCache *store.Cache
+	uidsDir    string
 }
 
 func initMocks(t *testing.T) mocks {
@@ -157,6 +158,7 @@ func initMocks(t *testing.T) mocks {
 
 	// Ignore heartbeat calls because they always happen.
 	m.pmapiClient.EXPECT().SendSimpleMetric(string(metrics.Heartbeat), gomock.Any(), gomock.Any()).AnyTimes()
+	m.pmapiClient.EXPECT().SetInitialSync(gomock.Any()).AnyTimes()
 	m.prefProvider.EXPECT().Get(preferences.NextHeartbeatKey).AnyTimes()
 	m.prefProvider.EXPECT().Set(preferences.NextHeartbeatKey, gomock.Any()).AnyTimes()
 
@@ -206,8 +208,25 @@ func testNewBridge(t *testing.T, m mocks) *Bridge {
 
 	m.prefProvider.EXPECT().GetBool(preferences.FirstStartKey).Return(false).AnyTimes()
 	m.prefProvider.EXPECT().GetBool(preferences.AllowProxyKey).Return(false).AnyTimes()
+	m.prefProvider.EXPECT().GetBool(preferences.FullTextIndexKey).Return(false).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.MessageCacheSizeKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.AttachmentCacheSizeKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.SyncWorkersKey).Return(store.SyncDefaultWorkers).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.StoreCompactIntervalKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.EventPollIntervalKey).Return(30).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.PrefetchMessagesKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.SyncDownloadLimitKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.SyncUploadLimitKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.EventsDownloadLimitKey).Return(0).AnyTimes()
+	m.prefProvider.EXPECT().GetInt(preferences.EventsUploadLimitKey).Return(0).AnyTimes()
+	for _, userID := range []string{"user", "users"} {
+		m.prefProvider.EXPECT().Get(preferences.UserStoreDirKey(userID)).Return("").AnyTimes()
+		m.prefProvider.EXPECT().Set(preferences.UserStoreDirKey(userID), "").AnyTimes()
+	}
 	m.config.EXPECT().GetDBDir().Return("/tmp").AnyTimes()
+	m.config.EXPECT().GetUIDsDir().Return(m.uidsDir).AnyTimes()
 	m.config.EXPECT().GetIMAPCachePath().Return(cacheFile.Name()).AnyTimes()
+	m.config.EXPECT().GetIMAPKeywordsPath().Return("/tmp/nonexistent_imap_keywords.json").AnyTimes()
 	m.pmapiClient.EXPECT().SetAuths(gomock.Any()).AnyTimes()
 	m.eventListener.EXPECT().Add(events.UpgradeApplicationEvent, gomock.Any())
 	pmapiClientFactory := func(userID string) PMAPIProvider {
@@ -19,10 +19,13 @@ package bridge
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetNoUser(t *testing.T) {
@@ -62,6 +65,11 @@ func TestDeleteUser(t *testing.T) {
 	m := initMocks(t)
 	defer m.ctrl.Finish()
 
+	var err error
+	m.uidsDir, err = ioutil.TempDir("", "bridge-uids")
+	require.NoError(t, err)
+	defer os.RemoveAll(m.uidsDir) //nolint[errcheck]
+
 	bridge := testNewBridgeWithUsers(t, m)
 	defer cleanUpBridgeUserData(bridge)
 
@@ -73,9 +81,12 @@ func TestDeleteUser(t *testing.T) {
 
 	m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "user@pm.me")
 
-	err := bridge.DeleteUser("user", true)
+	err = bridge.DeleteUser("user", true)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(bridge.users))
+
+	// Deleted user leaves no saved UIDs behind.
+	assert.NoFileExists(t, getUserUIDsPath(m.uidsDir, "user"))
 }
 
 // Even when logout fails, delete is done.
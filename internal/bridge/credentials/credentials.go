@@ -28,6 +28,7 @@ import (
 	"strings"
 
 	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/crammd5"
 	"github.com/sirupsen/logrus"
 )
 
@@ -127,6 +128,18 @@ func (s *Credentials) CheckPassword(password string) error {
 	return nil
 }
 
+// CheckCRAMMD5 checks the CRAM-MD5 digest of `challenge` keyed by the bridge password.
+func (s *Credentials) CheckCRAMMD5(challenge, digest string) error {
+	if err := crammd5.Check(s.BridgePassword, challenge, digest); err != nil {
+		log.WithFields(logrus.Fields{
+			"userID": s.UserID,
+		}).Debug("Incorrect bridge password digest")
+
+		return fmt.Errorf("backend/credentials: incorrect password")
+	}
+	return nil
+}
+
 func (s *Credentials) Logout() {
 	s.APIToken = ""
 	s.MailboxPassword = ""
@@ -92,6 +92,34 @@ func (mr *MockConfigerMockRecorder) GetIMAPCachePath() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIMAPCachePath", reflect.TypeOf((*MockConfiger)(nil).GetIMAPCachePath))
 }
 
+// GetIMAPKeywordsPath mocks base method
+func (m *MockConfiger) GetIMAPKeywordsPath() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIMAPKeywordsPath")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetIMAPKeywordsPath indicates an expected call of GetIMAPKeywordsPath
+func (mr *MockConfigerMockRecorder) GetIMAPKeywordsPath() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIMAPKeywordsPath", reflect.TypeOf((*MockConfiger)(nil).GetIMAPKeywordsPath))
+}
+
+// GetUIDsDir mocks base method
+func (m *MockConfiger) GetUIDsDir() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUIDsDir")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetUIDsDir indicates an expected call of GetUIDsDir
+func (mr *MockConfigerMockRecorder) GetUIDsDir() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUIDsDir", reflect.TypeOf((*MockConfiger)(nil).GetUIDsDir))
+}
+
 // MockPreferenceProvider is a mock of PreferenceProvider interface
 type MockPreferenceProvider struct {
 	ctrl     *gomock.Controller
@@ -627,6 +655,20 @@ func (mr *MockPMAPIProviderMockRecorder) Logout() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockPMAPIProvider)(nil).Logout))
 }
 
+// MarkMessagesHam mocks base method
+func (m *MockPMAPIProvider) MarkMessagesHam(arg0 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkMessagesHam", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkMessagesHam indicates an expected call of MarkMessagesHam
+func (mr *MockPMAPIProviderMockRecorder) MarkMessagesHam(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkMessagesHam", reflect.TypeOf((*MockPMAPIProvider)(nil).MarkMessagesHam), arg0)
+}
+
 // MarkMessagesRead mocks base method
 func (m *MockPMAPIProvider) MarkMessagesRead(arg0 []string) error {
 	m.ctrl.T.Helper()
@@ -711,6 +753,18 @@ func (mr *MockPMAPIProviderMockRecorder) SetAuths(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAuths", reflect.TypeOf((*MockPMAPIProvider)(nil).SetAuths), arg0)
 }
 
+// SetInitialSync mocks base method
+func (m *MockPMAPIProvider) SetInitialSync(arg0 bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetInitialSync", arg0)
+}
+
+// SetInitialSync indicates an expected call of SetInitialSync
+func (mr *MockPMAPIProviderMockRecorder) SetInitialSync(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInitialSync", reflect.TypeOf((*MockPMAPIProvider)(nil).SetInitialSync), arg0)
+}
+
 // UnlabelMessages mocks base method
 func (m *MockPMAPIProvider) UnlabelMessages(arg0 []string, arg1 string) error {
 	m.ctrl.T.Helper()
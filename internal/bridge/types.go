@@ -28,7 +28,9 @@ import (
 type Configer interface {
 	ClearData() error
 	GetDBDir() string
+	GetUIDsDir() string
 	GetIMAPCachePath() string
+	GetIMAPKeywordsPath() string
 	GetAPIConfig() *pmapi.ClientConfig
 }
 
@@ -58,6 +60,7 @@ type PMAPIProvider interface {
 	Logout() error
 
 	GetEvent(eventID string) (*pmapi.Event, error)
+	SetInitialSync(isInitialSync bool)
 
 	CountMessages(addressID string) ([]*pmapi.MessagesCount, error)
 	ListMessages(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
@@ -68,6 +71,7 @@ type PMAPIProvider interface {
 	UnlabelMessages(apiIDs []string, labelID string) error
 	MarkMessagesRead(apiIDs []string) error
 	MarkMessagesUnread(apiIDs []string) error
+	MarkMessagesHam(apiIDs []string) error
 
 	ListLabels() ([]*pmapi.Label, error)
 	CreateLabel(label *pmapi.Label) (*pmapi.Label, error)
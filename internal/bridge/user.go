@@ -19,6 +19,7 @@ package bridge
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -49,6 +50,7 @@ type User struct {
 	store      *store.Store
 	storeCache *store.Cache
 	storePath  string
+	uidsPath   string
 
 	userID string
 	creds  *credentials.Credentials
@@ -70,6 +72,7 @@ func newUser(
 	apiClient PMAPIProvider,
 	storeCache *store.Cache,
 	storeDir string,
+	uidsDir string,
 ) (u *User, err error) {
 	log := log.WithField("user", userID)
 	log.Debug("Creating or loading user")
@@ -87,6 +90,7 @@ func newUser(
 		apiClient:    apiClient,
 		storeCache:   storeCache,
 		storePath:    getUserStorePath(storeDir, userID),
+		uidsPath:     getUserUIDsPath(uidsDir, userID),
 		userID:       userID,
 		creds:        creds,
 	}
@@ -147,7 +151,7 @@ func (u *User) init(idleUpdates chan interface{}, apiClient PMAPIProvider) (err
 		}
 		u.store = nil
 	}
-	store, err := store.New(u.panicHandler, u, u.apiClient, u.listener, u.storePath, u.storeCache)
+	store, err := store.New(u.panicHandler, u, u.apiClient, u.listener, u.storePath, u.uidsPath, u.storeCache)
 	if err != nil {
 		return errors.Wrap(err, "failed to create store")
 	}
@@ -159,6 +163,76 @@ func (u *User) init(idleUpdates chan interface{}, apiClient PMAPIProvider) (err
 	return err
 }
 
+// setIMAPKeywords sets which IMAP keywords are stored as labels.
+func (u *User) setIMAPKeywords(keywords map[string]string) {
+	if u.store == nil || len(keywords) == 0 {
+		return
+	}
+
+	u.store.SetKeywords(keywords)
+}
+
+// enableFullTextIndex starts building the local full-text index. The key of
+// the index is derived from the mailbox password so the index is readable
+// only with the user's credentials.
+func (u *User) enableFullTextIndex() {
+	if u.store == nil || u.creds.MailboxPassword == "" {
+		return
+	}
+
+	if err := u.store.EnableFullTextIndex([]byte(u.creds.MailboxPassword)); err != nil {
+		u.log.WithError(err).Error("Could not enable full-text index")
+	}
+}
+
+// enableMessageCache keeps up to maxSize megabytes of built messages on disk
+// encrypted by a key derived from the mailbox password held in the keychain.
+// Zero size removes the cache.
+func (u *User) enableMessageCache(maxSize int) {
+	if u.store == nil {
+		return
+	}
+
+	if maxSize <= 0 {
+		if err := u.store.RemoveMessageCache(); err != nil {
+			u.log.WithError(err).Error("Could not remove message cache")
+		}
+		return
+	}
+
+	if u.creds.MailboxPassword == "" {
+		return
+	}
+
+	if err := u.store.EnableMessageCache([]byte(u.creds.MailboxPassword), int64(maxSize)*1000*1000); err != nil {
+		u.log.WithError(err).Error("Could not enable message cache")
+	}
+}
+
+// enableAttachmentCache keeps up to maxSize megabytes of attachments on disk
+// encrypted by a key derived from the mailbox password held in the keychain.
+// Zero size removes the cache.
+func (u *User) enableAttachmentCache(maxSize int) {
+	if u.store == nil {
+		return
+	}
+
+	if maxSize <= 0 {
+		if err := u.store.RemoveAttachmentCache(); err != nil {
+			u.log.WithError(err).Error("Could not remove attachment cache")
+		}
+		return
+	}
+
+	if u.creds.MailboxPassword == "" {
+		return
+	}
+
+	if err := u.store.EnableAttachmentCache([]byte(u.creds.MailboxPassword), int64(maxSize)*1000*1000); err != nil {
+		u.log.WithError(err).Error("Could not enable attachment cache")
+	}
+}
+
 func (u *User) SetIMAPIdleUpdateChannel() {
 	if u.store == nil {
 		return
@@ -291,7 +365,7 @@ func (u *User) clearStore() error {
 		}
 	} else {
 		u.log.Warn("Store is not initialized: cleaning up store files manually")
-		if err := store.RemoveStore(u.storeCache, u.storePath, u.userID); err != nil {
+		if err := store.RemoveStore(u.storeCache, u.storePath, u.uidsPath, u.userID); err != nil {
 			return errors.Wrap(err, "failed to remove store manually")
 		}
 	}
@@ -311,12 +385,116 @@ func (u *User) closeStore() error {
 	return nil
 }
 
+// GetStoreDir returns the directory of the store database and cached messages.
+func (u *User) GetStoreDir() string {
+	return filepath.Dir(u.storePath)
+}
+
+// moveStore closes the store and moves its files to the directory.
+// The store is not opened again, bridge has to be restarted. When the move
+// fails, the store is opened again at the previous path.
+func (u *User) moveStore(storeDir string) error {
+	newPath := getUserStorePath(storeDir, u.userID)
+	if newPath == u.storePath {
+		return nil
+	}
+
+	u.log.WithField("dir", storeDir).Info("Moving user store")
+
+	if err := u.closeStore(); err != nil {
+		return err
+	}
+	if err := store.MoveStore(u.storePath, newPath); err != nil {
+		if openErr := u.reopenStore(); openErr != nil {
+			u.log.WithError(openErr).Error("Could not reopen store")
+		}
+		return errors.Wrap(err, "failed to move store")
+	}
+	u.storePath = newPath
+	return nil
+}
+
+// reopenStore opens the closed store again at the current path.
+func (u *User) reopenStore() error {
+	store, err := store.New(u.panicHandler, u, u.apiClient, u.listener, u.storePath, u.uidsPath, u.storeCache)
+	if err != nil {
+		u.store = nil
+		return errors.Wrap(err, "failed to create store")
+	}
+	u.store = store
+
+	if u.imapUpdatesChannel != nil {
+		u.store.SetIMAPUpdateChannel(u.imapUpdatesChannel)
+	}
+	return nil
+}
+
+// ExportStore writes a snapshot of the store to the file at path which can be
+// imported by the same user on another machine.
+func (u *User) ExportStore(path string) error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	u.log.WithField("path", path).Info("Exporting user store")
+
+	// Snapshot gets the final name only when it is complete.
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot")
+	}
+	if err := u.store.ExportSnapshot(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to export store")
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "failed to export store")
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// importStore closes the store and replaces it by the snapshot from the file
+// at path. The store is not opened again, bridge has to be restarted.
+func (u *User) importStore(path string) error {
+	f, err := os.Open(path) //nolint[gosec]
+	if err != nil {
+		return errors.Wrap(err, "failed to open snapshot")
+	}
+	defer f.Close() //nolint[errcheck]
+
+	u.log.WithField("path", path).Info("Importing user store")
+
+	if err := u.closeStore(); err != nil {
+		return err
+	}
+	if err := store.ImportSnapshot(f, u.storeCache, u.storePath, u.userID); err != nil {
+		return errors.Wrap(err, "failed to import store")
+	}
+	return nil
+}
+
 // getUserStorePath returns the file path of the store database for the given userID.
 func getUserStorePath(storeDir string, userID string) (path string) {
 	fileName := fmt.Sprintf("mailbox-%v.db", userID)
 	return filepath.Join(storeDir, fileName)
 }
 
+// getUserUIDsPath returns the file path of UIDs saved by the store for the given userID.
+// UIDs are not saved when uidsDir is empty.
+func getUserUIDsPath(uidsDir string, userID string) (path string) {
+	if uidsDir == "" {
+		return ""
+	}
+	fileName := fmt.Sprintf("uids-%v.db", userID)
+	return filepath.Join(uidsDir, fileName)
+}
+
 // GetTemporaryPMAPIClient returns an authorised PMAPI client.
 // Do not use! It's only for backward compatibility of old SMTP and IMAP implementations.
 // After proper refactor of SMTP and IMAP remove this method.
@@ -436,6 +614,20 @@ func (u *User) GetBridgePassword() string {
 // CheckBridgeLogin checks whether the user is logged in and the bridge
 // password is correct.
 func (u *User) CheckBridgeLogin(password string) error {
+	return u.checkBridgeLogin(func() error {
+		return u.creds.CheckPassword(password)
+	})
+}
+
+// CheckBridgeLoginCRAMMD5 is the same as CheckBridgeLogin for clients
+// sending the CRAM-MD5 digest of the bridge password instead of the password.
+func (u *User) CheckBridgeLoginCRAMMD5(challenge, digest string) error {
+	return u.checkBridgeLogin(func() error {
+		return u.creds.CheckCRAMMD5(challenge, digest)
+	})
+}
+
+func (u *User) checkBridgeLogin(checkPassword func() error) error {
 	if isApplicationOutdated {
 		u.listener.Emit(events.UpgradeApplicationEvent, "")
 		return pmapi.ErrUpgradeApplication
@@ -450,7 +642,7 @@ func (u *User) CheckBridgeLogin(password string) error {
 		return err
 	}
 
-	return u.creds.CheckPassword(password)
+	return checkPassword()
 }
 
 // UpdateUser updates user details from API and saves to the credentials.
@@ -485,6 +677,299 @@ func (u *User) UpdateUser() error {
 	return nil
 }
 
+// IsMailboxHidden returns whether the mailbox with labelID is hidden from IMAP LIST.
+func (u *User) IsMailboxHidden(labelID string) bool {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return false
+	}
+
+	return u.store.IsMailboxHidden(labelID)
+}
+
+// SetMailboxHidden hides or shows the mailbox with labelID in IMAP LIST.
+// Only mailboxes from store.HideableMailboxes can be hidden. Connections
+// are closed so clients list mailboxes again.
+func (u *User) SetMailboxHidden(labelID string, hidden bool) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	if err := u.store.SetMailboxHidden(labelID, hidden); err != nil {
+		u.log.WithError(err).Error("Could not set mailbox visibility")
+		return err
+	}
+
+	for _, address := range u.creds.EmailList() {
+		u.CloseConnection(address)
+	}
+
+	return nil
+}
+
+// GetDeleteAction returns what happens to messages flagged as \Deleted in
+// the mailbox with IMAP name.
+func (u *User) GetDeleteAction(mailboxName string) (store.DeleteAction, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.DeleteActionDefault, errors.New("store is not initialised")
+	}
+
+	labelID, err := u.store.GetMailboxLabelID(mailboxName)
+	if err != nil {
+		return store.DeleteActionDefault, err
+	}
+
+	return u.store.GetDeleteAction(labelID), nil
+}
+
+// SetDeleteAction sets what happens to messages flagged as \Deleted in the
+// mailbox with IMAP name: removal from the mailbox, move to Trash or Archive
+// or permanent delete.
+func (u *User) SetDeleteAction(mailboxName string, action store.DeleteAction) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	labelID, err := u.store.GetMailboxLabelID(mailboxName)
+	if err != nil {
+		return err
+	}
+
+	if err := u.store.SetDeleteAction(labelID, action); err != nil {
+		u.log.WithError(err).Error("Could not set delete action")
+		return err
+	}
+
+	return nil
+}
+
+// GetSyncWindow returns the window of the newest messages listed in the
+// mailbox with IMAP name.
+func (u *User) GetSyncWindow(mailboxName string) (store.SyncWindow, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.SyncWindow{}, errors.New("store is not initialised")
+	}
+
+	labelID, err := u.store.GetMailboxLabelID(mailboxName)
+	if err != nil {
+		return store.SyncWindow{}, err
+	}
+
+	return u.store.GetSyncWindow(labelID), nil
+}
+
+// SetSyncWindow limits the mailbox with IMAP name to the newest messages.
+// Older messages stay available in All Mail.
+func (u *User) SetSyncWindow(mailboxName string, window store.SyncWindow) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	labelID, err := u.store.GetMailboxLabelID(mailboxName)
+	if err != nil {
+		return err
+	}
+
+	if err := u.store.SetSyncWindow(labelID, window); err != nil {
+		u.log.WithError(err).Error("Could not set sync window")
+		return err
+	}
+
+	return nil
+}
+
+// IsMailboxExcluded returns whether messages of the mailbox with IMAP name
+// are not synced.
+func (u *User) IsMailboxExcluded(mailboxName string) (bool, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return false, errors.New("store is not initialised")
+	}
+
+	labelID, err := u.store.GetMailboxLabelID(mailboxName)
+	if err != nil {
+		return false, err
+	}
+
+	return u.store.IsMailboxExcluded(labelID), nil
+}
+
+// SetMailboxExcluded sets whether messages of the mailbox with IMAP name
+// are synced. Excluded mailbox is still listed and its messages are fetched
+// when a client opens it.
+func (u *User) SetMailboxExcluded(mailboxName string, excluded bool) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	labelID, err := u.store.GetMailboxLabelID(mailboxName)
+	if err != nil {
+		return err
+	}
+
+	if err := u.store.SetMailboxExcluded(labelID, excluded); err != nil {
+		u.log.WithError(err).Error("Could not set mailbox exclusion from sync")
+		return err
+	}
+
+	return nil
+}
+
+// GetSyncMonths returns the number of months of the newest messages which
+// are synced, zero when all messages are synced.
+func (u *User) GetSyncMonths() (uint, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return 0, errors.New("store is not initialised")
+	}
+
+	return u.store.GetSyncMonths(), nil
+}
+
+// SetSyncMonths limits the sync to messages of the last months, zero syncs
+// all messages. Older messages are fetched when a client opens a mailbox.
+func (u *User) SetSyncMonths(months uint) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	if err := u.store.SetSyncMonths(months); err != nil {
+		u.log.WithError(err).Error("Could not set sync limit")
+		return err
+	}
+
+	return nil
+}
+
+// CompactStore removes data of deleted messages from the store and rewrites
+// its database to the smallest file. Clients are disconnected because the
+// store is paused meanwhile.
+func (u *User) CompactStore() (store.CompactResult, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return store.CompactResult{}, errors.New("store is not initialised")
+	}
+
+	u.closeAllConnections()
+	defer u.store.SetIMAPUpdateChannel(u.imapUpdatesChannel)
+
+	result, err := u.store.Compact()
+	if err != nil {
+		u.log.WithError(err).Error("Could not compact store")
+	}
+	return result, err
+}
+
+// GetSyncProgress returns progress of the sync of all messages.
+func (u *User) GetSyncProgress() (store.SyncProgress, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.SyncProgress{}, errors.New("store is not initialised")
+	}
+
+	return u.store.GetSyncProgress(), nil
+}
+
+// GetStoreMetrics returns statistics of the store for troubleshooting.
+func (u *User) GetStoreMetrics() (store.Metrics, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return store.Metrics{}, errors.New("store is not initialised")
+	}
+
+	return u.store.GetMetrics()
+}
+
+// ListSavedSearches returns saved searches listed as mailboxes under
+// "Searches/".
+func (u *User) ListSavedSearches() []store.SavedSearch {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil
+	}
+
+	return u.store.ListSavedSearches()
+}
+
+// AddSavedSearch saves the search of messages from the sender with the
+// subject in the mailbox with IMAP name. Empty criteria are not used.
+func (u *User) AddSavedSearch(name, from, subject, mailboxName string) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	search := store.SavedSearch{Name: name, From: from, Subject: subject}
+	if mailboxName != "" {
+		labelID, err := u.store.GetMailboxLabelID(mailboxName)
+		if err != nil {
+			return err
+		}
+		search.LabelID = labelID
+	}
+
+	if err := u.store.AddSavedSearch(search); err != nil {
+		u.log.WithError(err).Error("Could not add saved search")
+		return err
+	}
+
+	return nil
+}
+
+// RemoveSavedSearch removes the saved search with its mailbox.
+func (u *User) RemoveSavedSearch(name string) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	if err := u.store.RemoveSavedSearch(name); err != nil {
+		u.log.WithError(err).Error("Could not remove saved search")
+		return err
+	}
+
+	return nil
+}
+
 // SwitchAddressMode changes mode from combined to split and vice versa. The mode to switch to is determined by the
 // state of the user's credentials in the credentials store. See `IsCombinedAddressMode` for more details.
 func (u *User) SwitchAddressMode() (err error) {
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/crammd5"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
@@ -66,7 +67,6 @@ func TestUserSwitchAddressMode(t *testing.T) {
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "user@pm.me"),
 		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
 		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
-		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		m.credentialsStore.EXPECT().SwitchAddressMode("user").Return(nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsSplit, nil),
@@ -83,7 +83,6 @@ func TestUserSwitchAddressMode(t *testing.T) {
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "alsouser@pm.me"),
 		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
 		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
-		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
 
 		m.credentialsStore.EXPECT().SwitchAddressMode("user").Return(nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
@@ -174,7 +173,7 @@ func TestCheckBridgeLoginLoggedOut(t *testing.T) {
 	defer m.ctrl.Finish()
 
 	m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil)
-	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", "")
 	m.pmapiClient.EXPECT().ListLabels().Return(nil, errors.New("ErrUnauthorized"))
 	m.pmapiClient.EXPECT().Addresses().Return(nil)
 	m.pmapiClient.EXPECT().SetAuths(gomock.Any())
@@ -206,3 +205,22 @@ func TestCheckBridgeLoginBadPassword(t *testing.T) {
 	waitForEvents()
 	assert.Equal(t, "backend/credentials: incorrect password", err.Error())
 }
+
+func TestCheckBridgeLoginCRAMMD5(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	user := testNewUser(m)
+	defer cleanUpUserData(user)
+
+	m.pmapiClient.EXPECT().Unlock("pass").Return(nil, nil)
+	m.pmapiClient.EXPECT().UnlockAddresses([]byte("pass")).Return(nil)
+
+	challenge := "<1896.697170952@127.0.0.1>"
+	err := user.CheckBridgeLoginCRAMMD5(challenge, crammd5.Digest(testCredentials.BridgePassword, challenge))
+	waitForEvents()
+	assert.NoError(t, err)
+
+	err = user.CheckBridgeLoginCRAMMD5(challenge, crammd5.Digest("wrong!", challenge))
+	assert.Equal(t, "backend/credentials: incorrect password", err.Error())
+}
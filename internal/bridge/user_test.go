@@ -18,6 +18,8 @@
 package bridge
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -44,7 +46,7 @@ func testNewUser(m mocks) *User {
 	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
 	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil).AnyTimes()
 
-	user, err := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	user, err := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", "")
 	assert.NoError(m.t, err)
 
 	err = user.init(nil, m.pmapiClient)
@@ -72,7 +74,7 @@ func testNewUserForLogout(m mocks) *User {
 	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
 	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil).AnyTimes()
 
-	user, err := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	user, err := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", "")
 	assert.NoError(m.t, err)
 
 	err = user.init(nil, m.pmapiClient)
@@ -111,3 +113,33 @@ func TestClearStoreWithoutStore(t *testing.T) {
 	assert.NotNil(t, user.store)
 	assert.Nil(t, user.clearStore())
 }
+
+func TestMoveStoreFailedReopensStore(t *testing.T) {
+	m := initMocks(t)
+	defer m.ctrl.Finish()
+
+	user := testNewUserForLogout(m)
+	defer cleanUpUserData(user)
+
+	// Reopened store continues the sync.
+	m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil).AnyTimes()
+
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	// Database already exists in the target directory.
+	require.NoError(t, ioutil.WriteFile(getUserStorePath(dir, "user"), []byte{}, 0600))
+
+	oldStore := user.store
+	storePath := user.storePath
+	assert.Error(t, user.moveStore(dir))
+	assert.Equal(t, storePath, user.storePath)
+	assert.FileExists(t, storePath)
+	require.NotNil(t, user.store)
+	assert.NotSame(t, oldStore, user.store)
+
+	addrs, err := user.store.GetAddressInfo()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, addrs)
+}
@@ -18,11 +18,17 @@
 package cli
 
 import (
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	"github.com/abiosoft/ishell"
 )
 
@@ -54,6 +60,8 @@ func (f *frontendCLI) showAccountInfo(c *ishell.Context) {
 		return
 	}
 
+	f.showAccountSyncInfo(user)
+
 	if user.IsCombinedAddressMode() {
 		f.showAccountAddressInfo(user, user.GetPrimaryAddress())
 	} else {
@@ -63,28 +71,81 @@ func (f *frontendCLI) showAccountInfo(c *ishell.Context) {
 	}
 }
 
+func (f *frontendCLI) showAccountSyncInfo(user types.BridgeUser) {
+	progress, err := user.GetSyncProgress()
+	if err != nil {
+		f.printAndLogError("Cannot get sync progress:", err)
+		return
+	}
+	if !progress.IsRunning {
+		f.Println(bold("Sync is not running"))
+		f.Println("")
+		return
+	}
+
+	percent := 0.0
+	if progress.Total > 0 {
+		percent = 100 * float64(progress.Done) / float64(progress.Total)
+	}
+	eta := "unknown"
+	if progress.ETA > 0 {
+		eta = progress.ETA.Round(time.Second).String()
+	}
+	f.Println(bold("Sync in progress"))
+	f.Printf("Mailbox:   %s\nMessages:  %d of %d (%.1f %%)\nSize:      %.1f MB\nRemaining: %s\n",
+		progress.Mailbox,
+		progress.Done,
+		progress.Total,
+		percent,
+		float64(progress.Bytes)/1000/1000,
+		eta,
+	)
+	f.Println("")
+}
+
 func (f *frontendCLI) showAccountAddressInfo(user types.BridgeUser, address string) {
 	smtpSecurity := "STARTTLS"
 	if f.preferences.GetBool(preferences.SMTPSSLKey) {
 		smtpSecurity = "SSL"
 	}
+	host := ports.ClientHost(f.preferences.Get(preferences.BindAddressKey), bridge.Host)
 	f.Println(bold("Configuration for " + address))
 	f.Printf("IMAP Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
-		bridge.Host,
+		host,
 		f.preferences.GetInt(preferences.IMAPPortKey),
 		address,
 		user.GetBridgePassword(),
 		"STARTTLS",
 	)
 	f.Println("")
+	if imapsPort := f.preferences.GetInt(preferences.IMAPSPortKey); imapsPort != 0 {
+		f.Printf("IMAPS Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
+			host,
+			imapsPort,
+			address,
+			user.GetBridgePassword(),
+			"SSL",
+		)
+		f.Println("")
+	}
 	f.Printf("SMTP Settings\nAddress:   %s\nIMAP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
-		bridge.Host,
+		host,
 		f.preferences.GetInt(preferences.SMTPPortKey),
 		address,
 		user.GetBridgePassword(),
 		smtpSecurity,
 	)
 	f.Println("")
+	if smtpsPort := f.preferences.GetInt(preferences.SMTPSPortKey); smtpsPort != 0 {
+		f.Printf("SMTPS Settings\nAddress:   %s\nSMTP port: %d\nUsername:  %s\nPassword:  %s\nSecurity:  %s\n",
+			host,
+			smtpsPort,
+			address,
+			user.GetBridgePassword(),
+			"SSL",
+		)
+		f.Println("")
+	}
 }
 
 func (f *frontendCLI) loginAccount(c *ishell.Context) { // nolint[funlen]
@@ -217,3 +278,460 @@ func (f *frontendCLI) changeMode(c *ishell.Context) {
 	}
 	f.Printf("Address mode for account %s changed to %s\n", user.Username(), newMode)
 }
+
+// hideableMailboxNames are IMAP names of store.HideableMailboxes.
+var hideableMailboxNames = map[string]string{ //nolint[gochecknoglobals]
+	pmapi.AllMailLabel:        "All Mail",
+	pmapi.SpamLabel:           "Spam",
+	pmapi.TrashLabel:          "Trash",
+	store.VirtualUnreadLabel:  "Unread",
+	store.VirtualStarredLabel: "Starred",
+}
+
+func (f *frontendCLI) changeHiddenMailboxes(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	for _, labelID := range store.HideableMailboxes {
+		name := hideableMailboxNames[labelID]
+		hidden := user.IsMailboxHidden(labelID)
+
+		question := "Hide " + bold(name) + " from IMAP clients of account " + bold(user.Username())
+		if hidden {
+			question = "Show " + bold(name) + " again in IMAP clients of account " + bold(user.Username())
+		}
+		if !f.yesNoQuestion(question) {
+			continue
+		}
+
+		if err := user.SetMailboxHidden(labelID, !hidden); err != nil {
+			f.printAndLogError("Cannot change visibility of "+name+":", err)
+			return
+		}
+	}
+
+	hiddenNames := []string{}
+	for _, labelID := range store.HideableMailboxes {
+		if user.IsMailboxHidden(labelID) {
+			hiddenNames = append(hiddenNames, hideableMailboxNames[labelID])
+		}
+	}
+	if len(hiddenNames) == 0 {
+		f.Printf("All mailboxes of account %s are shown in IMAP clients\n", user.Username())
+	} else {
+		f.Printf("Mailboxes of account %s hidden from IMAP clients: %s\n", user.Username(), strings.Join(hiddenNames, ", "))
+	}
+}
+
+// deleteActionNames are names of store.DeleteActions used in CLI.
+var deleteActionNames = map[store.DeleteAction]string{ //nolint[gochecknoglobals]
+	store.DeleteActionDefault:   "default",
+	store.DeleteActionTrash:     "trash",
+	store.DeleteActionArchive:   "archive",
+	store.DeleteActionPermanent: "delete",
+}
+
+func (f *frontendCLI) changeDeleteAction(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	mailboxName := f.readStringInAttempts("Mailbox, e.g. INBOX or Folders/Old", c.ReadLine, isNotEmpty)
+	if mailboxName == "" {
+		return
+	}
+
+	current, err := user.GetDeleteAction(mailboxName)
+	if err != nil {
+		f.printAndLogError("Cannot get delete action:", err)
+		return
+	}
+
+	name := f.readStringInAttempts("Set delete action default, trash, archive or delete (current "+deleteActionNames[current]+")", c.ReadLine, f.isDeleteActionName)
+	if name == "" {
+		return
+	}
+
+	for action, actionName := range deleteActionNames {
+		if actionName != name {
+			continue
+		}
+		if err := user.SetDeleteAction(mailboxName, action); err != nil {
+			f.printAndLogError("Cannot change delete action:", err)
+			return
+		}
+	}
+	f.Printf("Delete action of mailbox %s of account %s changed to %s\n", mailboxName, user.Username(), name)
+}
+
+func (f *frontendCLI) isDeleteActionName(value string) bool {
+	for _, name := range deleteActionNames {
+		if name == value {
+			return true
+		}
+	}
+	f.Println("Input", value, "is not a delete action.")
+	return false
+}
+
+func (f *frontendCLI) changeSyncWindow(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	mailboxName := f.readStringInAttempts("Mailbox, e.g. INBOX or Folders/Old", c.ReadLine, isNotEmpty)
+	if mailboxName == "" {
+		return
+	}
+
+	window, err := user.GetSyncWindow(mailboxName)
+	if err != nil {
+		f.printAndLogError("Cannot get sync window:", err)
+		return
+	}
+
+	messages := f.readStringInAttempts("Set number of the newest messages, 0 for all (current "+strconv.Itoa(int(window.Messages))+")", c.ReadLine, f.isWindowSize)
+	if messages != "" {
+		window.Messages = atoui(messages)
+	}
+	days := f.readStringInAttempts("Set number of days, 0 for all (current "+strconv.Itoa(int(window.Days))+")", c.ReadLine, f.isWindowSize)
+	if days != "" {
+		window.Days = atoui(days)
+	}
+
+	if err := user.SetSyncWindow(mailboxName, window); err != nil {
+		f.printAndLogError("Cannot change sync window:", err)
+		return
+	}
+	if window.IsZero() {
+		f.Printf("Mailbox %s of account %s lists all messages\n", mailboxName, user.Username())
+		return
+	}
+	f.Printf("Mailbox %s of account %s lists the newest messages, older messages are available in All Mail\n", mailboxName, user.Username())
+}
+
+func (f *frontendCLI) changeExcludedMailbox(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	mailboxName := f.readStringInAttempts("Mailbox, e.g. Folders/Archive 2015", c.ReadLine, isNotEmpty)
+	if mailboxName == "" {
+		return
+	}
+
+	excluded, err := user.IsMailboxExcluded(mailboxName)
+	if err != nil {
+		f.printAndLogError("Cannot get mailbox exclusion:", err)
+		return
+	}
+
+	question := "Exclude " + bold(mailboxName) + " of account " + bold(user.Username()) + " from sync, its messages are downloaded only when opened"
+	if excluded {
+		question = "Sync " + bold(mailboxName) + " of account " + bold(user.Username()) + " again"
+	}
+	if !f.yesNoQuestion(question) {
+		return
+	}
+
+	if err := user.SetMailboxExcluded(mailboxName, !excluded); err != nil {
+		f.printAndLogError("Cannot change mailbox exclusion:", err)
+		return
+	}
+	if excluded {
+		f.Printf("Mailbox %s of account %s is synced again\n", mailboxName, user.Username())
+		return
+	}
+	f.Printf("Mailbox %s of account %s is excluded from sync\n", mailboxName, user.Username())
+}
+
+func (f *frontendCLI) changeSyncMonths(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	months, err := user.GetSyncMonths()
+	if err != nil {
+		f.printAndLogError("Cannot get sync limit:", err)
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	newMonths := f.readStringInAttempts("Set number of months of synced messages, 0 for all (current "+strconv.Itoa(int(months))+")", c.ReadLine, f.isWindowSize)
+	if newMonths == "" {
+		return
+	}
+
+	months = atoui(newMonths)
+	if err := user.SetSyncMonths(months); err != nil {
+		f.printAndLogError("Cannot change sync limit:", err)
+		return
+	}
+	if months == 0 {
+		f.Printf("All messages of account %s are synced\n", user.Username())
+		return
+	}
+	f.Printf("Messages of account %s from the last %d months are synced, older messages are downloaded when a client opens a mailbox\n", user.Username(), months)
+}
+
+func (f *frontendCLI) changeStoreDir(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := user.GetStoreDir()
+	newDir := f.readStringInAttempts("Set absolute path of directory of store and cached messages, \"default\" for the default one (current "+current+")", c.ReadLine, f.isStoreDir)
+	if newDir == "" || newDir == current {
+		f.Println("Nothing changed")
+		return
+	}
+	if newDir == defaultStoreDir {
+		newDir = ""
+	}
+
+	if !f.yesNoQuestion("Move store of account " + bold(user.Username()) + ", the Bridge will be restarted") {
+		return
+	}
+
+	f.Println("Moving store...")
+	if err := f.bridge.MoveUserStore(user.ID(), newDir); err != nil {
+		f.printAndLogError("Cannot move store:", err)
+		return
+	}
+	f.Println("Restarting Bridge...")
+	f.appRestart = true
+	f.Stop()
+}
+
+const defaultStoreDir = "default"
+
+func (f *frontendCLI) isStoreDir(value string) bool {
+	if value == "" || value == defaultStoreDir || filepath.IsAbs(value) {
+		return true
+	}
+	f.Println("Input", value, "is not an absolute path.")
+	return false
+}
+
+func (f *frontendCLI) compactStore(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	if !f.yesNoQuestion("Compact store of account " + bold(user.Username()) + ", its clients will be disconnected") {
+		return
+	}
+
+	f.Println("Compacting store...")
+	result, err := user.CompactStore()
+	if err != nil {
+		f.printAndLogError("Cannot compact store:", err)
+		return
+	}
+	f.Printf("Store of account %s compacted from %.1f MB to %.1f MB, removed %d orphaned entries, %d cached messages and %d cached attachments\n",
+		user.Username(),
+		float64(result.SizeBefore)/1000/1000,
+		float64(result.SizeAfter)/1000/1000,
+		result.PrunedEntries,
+		result.PrunedCachedMessages,
+		result.PrunedCachedAttachments,
+	)
+}
+
+func (f *frontendCLI) exportStore(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	path := f.readStringInAttempts("Set absolute path of snapshot file", c.ReadLine, f.isSnapshotPath)
+	if path == "" {
+		return
+	}
+
+	f.Println("Exporting store...")
+	if err := user.ExportStore(path); err != nil {
+		f.printAndLogError("Cannot export store:", err)
+		return
+	}
+	f.Println("Store of account", bold(user.Username()), "exported to", path)
+	f.Println("The snapshot contains metadata of messages like subjects and recipients, keep it private.")
+}
+
+func (f *frontendCLI) importStore(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	path := f.readStringInAttempts("Set absolute path of snapshot file", c.ReadLine, f.isSnapshotPath)
+	if path == "" {
+		return
+	}
+
+	if !f.yesNoQuestion("Replace store of account " + bold(user.Username()) + " by the snapshot, the Bridge will be restarted") {
+		return
+	}
+
+	f.Println("Importing store...")
+	if err := f.bridge.ImportUserStore(user.ID(), path); err != nil {
+		f.printAndLogError("Cannot import store:", err)
+		return
+	}
+	f.Println("Restarting Bridge...")
+	f.appRestart = true
+	f.Stop()
+}
+
+func (f *frontendCLI) isSnapshotPath(value string) bool {
+	if value == "" || filepath.IsAbs(value) {
+		return true
+	}
+	f.Println("Input", value, "is not an absolute path.")
+	return false
+}
+
+func (f *frontendCLI) showStoreMetrics(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	metrics, err := user.GetStoreMetrics()
+	if err != nil {
+		f.printAndLogError("Cannot get store metrics:", err)
+		return
+	}
+
+	f.Println(bold("Mailboxes of " + user.Username()))
+	for _, mailbox := range metrics.Mailboxes {
+		f.Printf("%-30s %-30s %8d total %8d unread\n", mailbox.Address, mailbox.Name, mailbox.Total, mailbox.Unread)
+	}
+	f.Println("")
+
+	if metrics.CacheEnabled {
+		f.Printf("Message cache: %d messages, %.1f MB, %d hits, %d misses (%.1f %% hit rate)\n",
+			metrics.CachedMessages,
+			float64(metrics.CacheSize)/1000/1000,
+			metrics.CacheHits,
+			metrics.CacheMisses,
+			100*metrics.CacheHitRate(),
+		)
+	} else {
+		f.Println("Message cache: disabled")
+	}
+
+	if metrics.LastPollTime.IsZero() {
+		f.Println("Last event:    never")
+	} else {
+		f.Printf("Last event:    %s (%s ago)\n", metrics.LastPollTime.Format(time.RFC3339), metrics.EventLag.Round(time.Second))
+	}
+
+	switch {
+	case metrics.IsSyncing:
+		f.Println("Last sync:     in progress")
+	case metrics.LastSyncTime.IsZero():
+		f.Println("Last sync:     never")
+	default:
+		f.Printf("Last sync:     %s\n", metrics.LastSyncTime.Format(time.RFC3339))
+	}
+}
+
+func (f *frontendCLI) isWindowSize(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 {
+		f.Println("Input", value, "is not a valid number.")
+		return false
+	}
+	return true
+}
+
+func atoui(value string) uint {
+	number, _ := strconv.Atoi(value)
+	return uint(number)
+}
+
+func (f *frontendCLI) changeSavedSearches(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	names := []string{}
+	for _, search := range user.ListSavedSearches() {
+		names = append(names, search.Name)
+	}
+	if len(names) != 0 {
+		f.Printf("Saved searches of account %s: %s\n", user.Username(), strings.Join(names, ", "))
+	}
+
+	name := f.readStringInAttempts("Name of saved search to add or remove", c.ReadLine, isNotEmpty)
+	if name == "" {
+		return
+	}
+
+	for _, existing := range names {
+		if existing != name {
+			continue
+		}
+		if !f.yesNoQuestion("Remove saved search " + bold(name) + " of account " + bold(user.Username())) {
+			return
+		}
+		if err := user.RemoveSavedSearch(name); err != nil {
+			f.printAndLogError("Cannot remove saved search:", err)
+			return
+		}
+		f.Printf("Saved search %s of account %s removed\n", name, user.Username())
+		return
+	}
+
+	f.Println("Leave empty criteria which should not be used.")
+	f.Print("Sender contains: ")
+	from := c.ReadLine()
+	f.Print("Subject contains: ")
+	subject := c.ReadLine()
+	f.Print("Mailbox, e.g. INBOX or Labels/Work: ")
+	mailboxName := c.ReadLine()
+
+	if err := user.AddSavedSearch(name, from, subject, mailboxName); err != nil {
+		f.printAndLogError("Cannot add saved search:", err)
+		return
+	}
+	f.Printf("Saved search %s of account %s is listed as %s%s\n", name, user.Username(), store.SavedSearchesPrefix, name)
+}
@@ -40,6 +40,8 @@ type frontendCLI struct {
 	eventListener listener.Listener
 	updates       types.Updater
 	bridge        types.Bridger
+	outbox        types.Outbox
+	sendJournal   types.SendJournal
 
 	appRestart bool
 }
@@ -52,6 +54,8 @@ func New( //nolint[funlen]
 	eventListener listener.Listener,
 	updates types.Updater,
 	bridge types.Bridger,
+	outbox types.Outbox,
+	sendJournal types.SendJournal,
 ) *frontendCLI { //nolint[golint]
 	fe := &frontendCLI{
 		Shell: ishell.New(),
@@ -61,6 +65,8 @@ func New( //nolint[funlen]
 		eventListener: eventListener,
 		updates:       updates,
 		bridge:        bridge,
+		outbox:        outbox,
+		sendJournal:   sendJournal,
 
 		appRestart: false,
 	}
@@ -93,15 +99,125 @@ func New( //nolint[funlen]
 		Func:      fe.changeMode,
 		Completer: fe.completeUsernames,
 	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "hidden-mailboxes",
+		Help:      "hide or show All Mail, Spam, Trash, Unread and Starred in IMAP clients of account, e.g. to not download all messages twice. Use index or account name as parameter. (alias: hide)",
+		Aliases:   []string{"hide"},
+		Func:      fe.changeHiddenMailboxes,
+		Completer: fe.completeUsernames,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "delete-action",
+		Help:      "change what happens to messages deleted in a mailbox of account: removal from the mailbox (default), move to trash or archive, or permanent delete. Use index or account name as parameter. (alias: del)",
+		Aliases:   []string{"del"},
+		Func:      fe.changeDeleteAction,
+		Completer: fe.completeUsernames,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "sync-window",
+		Help:      "limit a mailbox of account to the newest messages by count or days, older messages stay in All Mail and are added when searched for. Use index or account name as parameter. (alias: window)",
+		Aliases:   []string{"window"},
+		Func:      fe.changeSyncWindow,
+		Completer: fe.completeUsernames,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "excluded-mailbox",
+		Help:      "exclude a mailbox of account from sync or sync it again, messages of excluded mailbox are downloaded when a client opens it. Use index or account name as parameter. (alias: exclude)",
+		Aliases:   []string{"exclude"},
+		Func:      fe.changeExcludedMailbox,
+		Completer: fe.completeUsernames,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "sync-months",
+		Help:      "sync only messages of account from the last months, older messages are downloaded when a client opens a mailbox. Use index or account name as parameter. (alias: months)",
+		Aliases:   []string{"months"},
+		Func:      fe.changeSyncMonths,
+		Completer: fe.completeUsernames,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "saved-searches",
+		Help:      "add or remove saved searches of account listed as read-only mailboxes under Searches in IMAP clients. Use index or account name as parameter. (alias: search)",
+		Aliases:   []string{"search"},
+		Func:      fe.changeSavedSearches,
+		Completer: fe.completeUsernames,
+	})
 	changeCmd.AddCmd(&ishell.Cmd{Name: "port",
-		Help:    "change port numbers of IMAP and SMTP servers. (alias: p)",
+		Help:    "change port numbers of IMAP, SMTP, SMTPS and LMTP servers. (alias: p)",
 		Aliases: []string{"p"},
 		Func:    fe.changePort,
 	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "bind-address",
+		Help:    "change address of IMAP and SMTP servers, e.g. 0.0.0.0 to accept connections from other machines. (alias: address)",
+		Aliases: []string{"address"},
+		Func:    fe.changeBindAddress,
+	})
 	changeCmd.AddCmd(&ishell.Cmd{Name: "proxy",
 		Help: "allow or disallow bridge to securely connect to proton via a third party when it is being blocked",
 		Func: fe.toggleAllowProxy,
 	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "attach-public-key",
+		Help: "attach or do not attach the sender public key to all outgoing messages regardless of account settings",
+		Func: fe.toggleAttachPublicKey,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "wkd",
+		Help: "allow or disallow bridge to look up keys of external recipients in Web Key Directory when sending",
+		Func: fe.toggleWKDLookup,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "rate-limit",
+		Help: "change maximum number of messages sent per minute by one account, messages over the limit wait in outbox",
+		Func: fe.changeRateLimit,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "send-delay",
+		Help: "change number of seconds sent messages wait in outbox before sending, so they can be cancelled (undo send)",
+		Func: fe.changeSendDelay,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "duplicate-send",
+		Help: "change detection of the same message sent again, e.g. disable it for heartbeat messages",
+		Func: fe.changeDuplicateSend,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "draft-cleanup",
+		Help: "delete or keep drafts created by bridge for messages which could not be sent",
+		Func: fe.toggleDraftCleanup,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "plain-alternative",
+		Help: "generate or do not generate plain text alternative of HTML-only messages sent to external recipients",
+		Func: fe.togglePlainTextAlternative,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "full-text-index",
+		Help: "build or do not build local full-text index of message bodies for IMAP SEARCH",
+		Func: fe.toggleFullTextIndex,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "sync-workers",
+		Help: "change number of pages of messages fetched in parallel during sync, more workers sync faster on fast connections",
+		Func: fe.changeSyncWorkers,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "poll-interval",
+		Help: "change seconds between polls of new events, failed polls are repeated later with growing backoff",
+		Func: fe.changePollInterval,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "prefetch",
+		Help: "change number of the newest messages of every mailbox downloaded and built in background after sync, so clients open them instantly. Zero disables prefetch",
+		Func: fe.changePrefetchMessages,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "store-dir",
+		Help:      "move store and cached messages of account to another directory, e.g. on a bigger disk. Use index or account name as parameter.",
+		Func:      fe.changeStoreDir,
+		Completer: fe.completeUsernames,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "bandwidth",
+		Help: "change limits of download and upload speed in kB/s during sync and while handling new events",
+		Func: fe.changeBandwidthLimits,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "cache-size",
+		Help: "change megabytes of messages and attachments cached on disk, the least recently fetched are removed over the limit",
+		Func: fe.changeCacheSize,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "compact-interval",
+		Help: "change after how many days the store database of every account is compacted when bridge starts",
+		Func: fe.changeCompactInterval,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "proxy-protocol",
+		Help: "require or do not require PROXY protocol header on IMAP and SMTP connections, e.g. behind HAProxy",
+		Func: fe.toggleProxyProtocol,
+	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "require-tls",
+		Help: "require or do not require STARTTLS or SSL before login to IMAP and SMTP, e.g. when reachable from other machines",
+		Func: fe.toggleRequireTLS,
+	})
 	changeCmd.AddCmd(&ishell.Cmd{Name: "smtp-security",
 		Help:    "change port numbers of IMAP and SMTP servers.(alias: ssl, starttls)",
 		Aliases: []string{"ssl", "starttls"},
@@ -129,6 +245,16 @@ func New( //nolint[funlen]
 		Aliases: []string{"log", "logs"},
 		Func:    fe.printLogDir,
 	})
+	traceCmd := &ishell.Cmd{Name: "trace-imap",
+		Help:    "capture protocol of the next IMAP connection to a file, credentials are redacted. Optionally use file path as parameter. (alias: trace)",
+		Func:    fe.traceIMAPConnection,
+		Aliases: []string{"trace"},
+	}
+	traceCmd.AddCmd(&ishell.Cmd{Name: "cancel",
+		Help: "cancel the trace of the next IMAP connection.",
+		Func: fe.cancelTraceIMAPConnection,
+	})
+	fe.AddCmd(traceCmd)
 	fe.AddCmd(&ishell.Cmd{Name: "manual",
 		Help:    "print URL with instructions. (alias: man)",
 		Aliases: []string{"man"},
@@ -156,6 +282,45 @@ func New( //nolint[funlen]
 		Completer: fe.completeUsernames,
 		Aliases:   []string{"i"},
 	})
+	outboxCmd := &ishell.Cmd{Name: "outbox",
+		Help:    "print the list of messages waiting to be sent. (alias: queue)",
+		Func:    fe.listOutbox,
+		Aliases: []string{"queue"},
+	}
+	outboxCmd.AddCmd(&ishell.Cmd{Name: "cancel",
+		Help:      "cancel sending of the message waiting in outbox. Use id as parameter. (alias: undo)",
+		Func:      fe.cancelOutboxItem,
+		Completer: fe.completeOutboxIDs,
+		Aliases:   []string{"undo"},
+	})
+	fe.AddCmd(outboxCmd)
+	fe.AddCmd(&ishell.Cmd{Name: "journal",
+		Help:    "print the latest messages sent over SMTP and what happened to them. Optionally filter by address, message ID or result as parameter. (alias: history)",
+		Func:    fe.listSendJournal,
+		Aliases: []string{"history"},
+	})
+	fe.AddCmd(&ishell.Cmd{Name: "compact",
+		Help:      "compact the store database of account and remove data of deleted messages. Clients are disconnected meanwhile. Use index or account name as parameter. (alias: vacuum)",
+		Func:      fe.noAccountWrapper(fe.compactStore),
+		Aliases:   []string{"vacuum"},
+		Completer: fe.completeUsernames,
+	})
+	fe.AddCmd(&ishell.Cmd{Name: "export-store",
+		Help:      "export store and cached messages of account to a snapshot file which can be imported on another machine without new sync. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.exportStore),
+		Completer: fe.completeUsernames,
+	})
+	fe.AddCmd(&ishell.Cmd{Name: "import-store",
+		Help:      "replace store and cached messages of account by a snapshot exported on another machine. Log in to the account first. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.importStore),
+		Completer: fe.completeUsernames,
+	})
+	fe.AddCmd(&ishell.Cmd{Name: "metrics",
+		Help:      "print statistics of the store of account: messages per mailbox, hit rate of message cache, time since the last event and the last sync. Use index or account name as parameter. (alias: stats)",
+		Func:      fe.noAccountWrapper(fe.showStoreMetrics),
+		Aliases:   []string{"stats"},
+		Completer: fe.completeUsernames,
+	})
 	fe.AddCmd(&ishell.Cmd{Name: "login",
 		Help:      "login procedure to add or connect account. Optionally use index or account as parameter. (aliases: a, add, con, connect)",
 		Func:      fe.loginAccount,
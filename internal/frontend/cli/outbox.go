@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"strings"
+	"time"
+
+	"github.com/abiosoft/ishell"
+)
+
+func (f *frontendCLI) listOutbox(c *ishell.Context) {
+	items := f.outbox.GetOutboxItems()
+	if len(items) == 0 {
+		f.Println("No messages are waiting to be sent.")
+		return
+	}
+
+	spacing := "%-16s %-25s %-30s %-8v %-20s\n"
+	f.Printf(bold(spacing), "id", "from", "to", "attempts", "next attempt")
+	for _, item := range items {
+		f.Printf(spacing,
+			item.ID,
+			item.From,
+			strings.Join(item.To, ", "),
+			item.Attempts,
+			item.NextAttempt.Format(time.RFC3339),
+		)
+		if item.LastError != "" {
+			f.Println("  last error:", item.LastError)
+		}
+	}
+	f.Println()
+}
+
+func (f *frontendCLI) cancelOutboxItem(c *ishell.Context) {
+	if len(c.Args) == 0 {
+		f.Println("Please, specify id of the message. Use `outbox` to list them.")
+		return
+	}
+	if err := f.outbox.CancelOutboxItem(c.Args[0]); err != nil {
+		f.printAndLogError("Cannot cancel message: ", err)
+		return
+	}
+	f.Println("Message", c.Args[0], "will not be sent.")
+}
+
+func (f *frontendCLI) completeOutboxIDs(args []string) (ids []string) {
+	if len(args) > 1 {
+		return
+	}
+	arg := ""
+	if len(args) == 1 {
+		arg = args[0]
+	}
+	for _, item := range f.outbox.GetOutboxItems() {
+		if strings.HasPrefix(item.ID, arg) {
+			ids = append(ids, item.ID)
+		}
+	}
+	return
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"strings"
+	"time"
+
+	"github.com/abiosoft/ishell"
+)
+
+// sendJournalListLimit is how many entries the journal command prints.
+const sendJournalListLimit = 20
+
+func (f *frontendCLI) listSendJournal(c *ishell.Context) {
+	query := strings.Join(c.Args, " ")
+	entries := f.sendJournal.GetJournalEntries(query, sendJournalListLimit)
+	if len(entries) == 0 {
+		if query == "" {
+			f.Println("No messages were sent yet.")
+		} else {
+			f.Println("No sent messages match", query)
+		}
+		return
+	}
+
+	spacing := "%-20s %-25s %-30s %-10v %-10s %s\n"
+	f.Printf(bold(spacing), "time", "from", "to", "size", "result", "message id")
+	for _, entry := range entries {
+		f.Printf(spacing,
+			entry.Time.Format(time.RFC3339),
+			entry.From,
+			strings.Join(entry.To, ", "),
+			entry.Size,
+			entry.Result,
+			entry.MessageID,
+		)
+		if entry.Error != "" {
+			f.Println("  error:", entry.Error)
+		}
+	}
+	f.Println()
+}
@@ -19,14 +19,19 @@ package cli
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/connection"
 	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	"github.com/abiosoft/ishell"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -53,6 +58,21 @@ func (f *frontendCLI) printLogDir(c *ishell.Context) {
 	f.Println("Log files are stored in\n\n ", f.config.GetLogDir())
 }
 
+func (f *frontendCLI) traceIMAPConnection(c *ishell.Context) {
+	path := strings.Join(c.Args, " ")
+	if path == "" {
+		path = f.config.GetIMAPTracePath()
+	}
+	f.eventListener.Emit(events.TraceIMAPConnectionEvent, path)
+	f.Println("The next IMAP connection will be traced to\n\n ", path)
+	f.Println("\nReconnect your client and attach the file to the bug report.")
+}
+
+func (f *frontendCLI) cancelTraceIMAPConnection(c *ishell.Context) {
+	f.eventListener.Emit(events.TraceIMAPConnectionEvent, "")
+	f.Println("Trace of the next IMAP connection was cancelled.")
+}
+
 func (f *frontendCLI) printManual(c *ishell.Context) {
 	f.Println("More instructions about the Bridge can be found at\n\n  https://protonmail.com/bridge")
 }
@@ -95,6 +115,270 @@ func (f *frontendCLI) changeSMTPSecurity(c *ishell.Context) {
 	}
 }
 
+func (f *frontendCLI) toggleProxyProtocol(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	var msg string
+	if f.preferences.GetBool(preferences.ProxyProtocolKey) {
+		f.Println("Bridge currently requires PROXY protocol header on IMAP and SMTP connections.")
+		msg = "Are you sure you want to accept direct connections and restart the Bridge"
+	} else {
+		f.Println("Bridge currently accepts direct IMAP and SMTP connections.")
+		f.Println("Enable PROXY protocol only if the Bridge is reachable just through the proxy, clients can send any address otherwise.")
+		msg = "Are you sure you want to require PROXY protocol header and restart the Bridge"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.ProxyProtocolKey, !f.preferences.GetBool(preferences.ProxyProtocolKey))
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) toggleRequireTLS(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	var msg string
+	if f.preferences.GetBool(preferences.RequireTLSKey) {
+		f.Println("Bridge currently refuses IMAP and SMTP login on unencrypted connections.")
+		msg = "Are you sure you want to allow login without STARTTLS and restart the Bridge"
+	} else {
+		f.Println("Bridge currently accepts IMAP and SMTP login on unencrypted connections.")
+		f.Println("Require TLS when the Bridge is reachable from other machines, the password is sent in plain text otherwise.")
+		msg = "Are you sure you want to require STARTTLS or SSL before login and restart the Bridge"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.RequireTLSKey, !f.preferences.GetBool(preferences.RequireTLSKey))
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) toggleFullTextIndex(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	var msg string
+	if f.preferences.GetBool(preferences.FullTextIndexKey) {
+		f.Println("Bridge currently keeps local full-text index of message bodies for IMAP SEARCH.")
+		msg = "Are you sure you want to search by API instead and restart the Bridge"
+	} else {
+		f.Println("Bridge currently searches message bodies by API.")
+		f.Println("The index needs all messages to be downloaded once and takes disk space.")
+		msg = "Are you sure you want to build local full-text index and restart the Bridge"
+	}
+
+	if f.yesNoQuestion(msg) {
+		f.preferences.SetBool(preferences.FullTextIndexKey, !f.preferences.GetBool(preferences.FullTextIndexKey))
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) changeSyncWorkers(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.SyncWorkersKey)
+	newWorkers := f.readStringInAttempts("Set number of sync workers from 1 to "+strconv.Itoa(store.SyncMaxWorkers)+" (current "+current+")", c.ReadLine, f.isSyncWorkers)
+	if newWorkers == "" || newWorkers == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	f.preferences.Set(preferences.SyncWorkersKey, newWorkers)
+	store.SetSyncMaxWorkers(f.preferences.GetInt(preferences.SyncWorkersKey))
+	f.Println("Saved sync workers", newWorkers, "used by the next sync, sync in progress keeps its workers")
+}
+
+func (f *frontendCLI) isSyncWorkers(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 1 || number > store.SyncMaxWorkers {
+		f.Println("Input", value, "is not a valid number of workers.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changePollInterval(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.EventPollIntervalKey)
+	newInterval := f.readStringInAttempts("Set seconds between polls of events, at least "+strconv.Itoa(int(store.PollMinInterval/time.Second))+" (current "+current+")", c.ReadLine, f.isPollInterval)
+	if newInterval == "" || newInterval == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	f.preferences.Set(preferences.EventPollIntervalKey, newInterval)
+	store.SetPollInterval(f.preferences.GetInt(preferences.EventPollIntervalKey))
+	f.Println("Saved poll interval", newInterval, "seconds used by the next poll")
+}
+
+func (f *frontendCLI) isPollInterval(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || time.Duration(number)*time.Second < store.PollMinInterval {
+		f.Println("Input", value, "is not a valid number of seconds.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changePrefetchMessages(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.PrefetchMessagesKey)
+	newCount := f.readStringInAttempts("Set number of the newest messages of every mailbox built after sync, 0 to disable, at most "+strconv.Itoa(store.PrefetchMaxCount)+" (current "+current+")", c.ReadLine, f.isPrefetchCount)
+	if newCount == "" || newCount == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	f.preferences.Set(preferences.PrefetchMessagesKey, newCount)
+	store.SetPrefetchCount(f.preferences.GetInt(preferences.PrefetchMessagesKey))
+	f.Println("Saved prefetch of", newCount, "messages used when clients connect next time")
+}
+
+func (f *frontendCLI) isPrefetchCount(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 || number > store.PrefetchMaxCount {
+		f.Println("Input", value, "is not a valid number of messages.")
+		return false
+	}
+	return true
+}
+
+// minBandwidthLimit in kB/s keeps the speed over the minimum speed of API
+// requests which are cancelled otherwise.
+const minBandwidthLimit = 16
+
+func (f *frontendCLI) changeBandwidthLimits(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	limits := []struct{ key, name string }{
+		{preferences.SyncDownloadLimitKey, "download during sync"},
+		{preferences.SyncUploadLimitKey, "upload during sync"},
+		{preferences.EventsDownloadLimitKey, "download after sync"},
+		{preferences.EventsUploadLimitKey, "upload after sync"},
+	}
+
+	changed := false
+	for _, limit := range limits {
+		current := f.preferences.Get(limit.key)
+		newLimit := f.readStringInAttempts("Set kB/s of "+limit.name+", 0 for no limit (current "+current+")", c.ReadLine, f.isBandwidthLimit)
+		if newLimit == "" || newLimit == current {
+			continue
+		}
+		f.preferences.Set(limit.key, newLimit)
+		changed = true
+	}
+
+	if !changed {
+		f.Println("Nothing changed")
+		return
+	}
+
+	bridge.SetBandwidthLimits(f.preferences)
+	f.Println("Bandwidth limits saved")
+}
+
+func (f *frontendCLI) isBandwidthLimit(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 || (number > 0 && number < minBandwidthLimit) {
+		f.Println("Input", value, "is not 0 or a speed of at least", minBandwidthLimit, "kB/s.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changeCacheSize(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	caches := []struct{ key, name string }{
+		{preferences.MessageCacheSizeKey, "cached messages"},
+		{preferences.AttachmentCacheSizeKey, "cached attachments"},
+	}
+
+	newSizes := map[string]string{}
+	for _, cache := range caches {
+		current := f.preferences.Get(cache.key)
+		newSize := f.readStringInAttempts("Set megabytes of "+cache.name+", 0 to not cache them on disk (current "+current+")", c.ReadLine, f.isCacheSize)
+		if newSize == "" || newSize == current {
+			continue
+		}
+		newSizes[cache.key] = newSize
+	}
+	if len(newSizes) == 0 {
+		f.Println("Nothing changed")
+		return
+	}
+
+	if f.yesNoQuestion("The change needs restart of the Bridge. Do you want to restart it now") {
+		for key, newSize := range newSizes {
+			f.preferences.Set(key, newSize)
+		}
+		f.Println("Restarting Bridge...")
+		f.appRestart = true
+		f.Stop()
+	}
+}
+
+func (f *frontendCLI) isCacheSize(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 {
+		f.Println("Input", value, "is not a valid number of megabytes.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changeCompactInterval(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.StoreCompactIntervalKey)
+	newDays := f.readStringInAttempts("Set days between compactions of store database done on start, 0 to not compact it (current "+current+")", c.ReadLine, f.isCompactInterval)
+	if newDays == "" || newDays == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	f.preferences.Set(preferences.StoreCompactIntervalKey, newDays)
+	store.SetCompactInterval(f.preferences.GetInt(preferences.StoreCompactIntervalKey))
+	f.Println("Saved compaction interval", newDays, "days used when bridge starts")
+}
+
+func (f *frontendCLI) isCompactInterval(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 {
+		f.Println("Input", value, "is not a valid number of days.")
+		return false
+	}
+	return true
+}
+
 func (f *frontendCLI) changePort(c *ishell.Context) {
 	f.ShowPrompt(false)
 	defer f.ShowPrompt(true)
@@ -106,6 +390,13 @@ func (f *frontendCLI) changePort(c *ishell.Context) {
 	}
 	imapPortChanged := newIMAPPort != currentPort
 
+	currentPort = f.preferences.Get(preferences.IMAPSPortKey)
+	newIMAPSPort := f.readStringInAttempts("Set IMAPS (implicit TLS) port, 0 to disable (current "+currentPort+")", c.ReadLine, f.isPortFree)
+	if newIMAPSPort == "" {
+		newIMAPSPort = currentPort
+	}
+	imapsPortChanged := newIMAPSPort != currentPort
+
 	currentPort = f.preferences.Get(preferences.SMTPPortKey)
 	newSMTPPort := f.readStringInAttempts("Set SMTP port (current "+currentPort+")", c.ReadLine, f.isPortFree)
 	if newSMTPPort == "" {
@@ -113,15 +404,32 @@ func (f *frontendCLI) changePort(c *ishell.Context) {
 	}
 	smtpPortChanged := newSMTPPort != currentPort
 
-	if newIMAPPort == newSMTPPort {
-		f.Println("SMTP and IMAP ports must be different!")
+	currentPort = f.preferences.Get(preferences.SMTPSPortKey)
+	newSMTPSPort := f.readStringInAttempts("Set SMTPS (implicit TLS) port, 0 to disable (current "+currentPort+")", c.ReadLine, f.isPortFree)
+	if newSMTPSPort == "" {
+		newSMTPSPort = currentPort
+	}
+	smtpsPortChanged := newSMTPSPort != currentPort
+
+	currentPort = f.preferences.Get(preferences.LMTPPortKey)
+	newLMTPPort := f.readStringInAttempts("Set LMTP port for local delivery, 0 to disable (current "+currentPort+")", c.ReadLine, f.isPortFree)
+	if newLMTPPort == "" {
+		newLMTPPort = currentPort
+	}
+	lmtpPortChanged := newLMTPPort != currentPort
+
+	if err := checkPorts(newIMAPPort, newIMAPSPort, newSMTPPort, newSMTPSPort, newLMTPPort); err != nil {
+		f.Println(err)
 		return
 	}
 
-	if imapPortChanged || smtpPortChanged {
-		f.Println("Saving values IMAP:", newIMAPPort, "SMTP:", newSMTPPort)
+	if imapPortChanged || imapsPortChanged || smtpPortChanged || smtpsPortChanged || lmtpPortChanged {
+		f.Println("Saving values IMAP:", newIMAPPort, "IMAPS:", newIMAPSPort, "SMTP:", newSMTPPort, "SMTPS:", newSMTPSPort, "LMTP:", newLMTPPort)
 		f.preferences.Set(preferences.IMAPPortKey, newIMAPPort)
+		f.preferences.Set(preferences.IMAPSPortKey, newIMAPSPort)
 		f.preferences.Set(preferences.SMTPPortKey, newSMTPPort)
+		f.preferences.Set(preferences.SMTPSPortKey, newSMTPSPort)
+		f.preferences.Set(preferences.LMTPPortKey, newLMTPPort)
 		f.Println("Restarting Bridge...")
 		f.appRestart = true
 		f.Stop()
@@ -130,6 +438,215 @@ func (f *frontendCLI) changePort(c *ishell.Context) {
 	}
 }
 
+// checkPorts returns error when some servers would listen on the same port.
+// Optional servers are disabled by port "0".
+func checkPorts(imapPort, imapsPort, smtpPort, smtpsPort, lmtpPort string) error {
+	if imapPort == smtpPort {
+		return errors.New("SMTP and IMAP ports must be different")
+	}
+
+	if imapsPort != "0" && (imapsPort == imapPort || imapsPort == smtpPort) {
+		return errors.New("IMAPS port must be different from IMAP and SMTP ports")
+	}
+
+	if smtpsPort != "0" && (smtpsPort == imapPort || smtpsPort == smtpPort || smtpsPort == imapsPort) {
+		return errors.New("SMTPS port must be different from IMAP, IMAPS and SMTP ports")
+	}
+
+	if lmtpPort != "0" && (lmtpPort == imapPort || lmtpPort == smtpPort || lmtpPort == imapsPort || lmtpPort == smtpsPort) {
+		return errors.New("LMTP port must be different from IMAP, IMAPS, SMTP and SMTPS ports")
+	}
+
+	return nil
+}
+
+func (f *frontendCLI) changeBindAddress(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	currentAddress := f.preferences.Get(preferences.BindAddressKey)
+	newAddress := f.readStringInAttempts("Set bind address (current "+currentAddress+")", c.ReadLine, f.isBindAddress)
+	if newAddress == "" || newAddress == currentAddress {
+		f.Println("Nothing changed")
+		return
+	}
+
+	if !ports.IsLocalHost(newAddress) {
+		f.Println("IMAP and SMTP servers will be reachable from other machines. Anyone who can connect")
+		f.Println("can try to guess the bridge password, protect the access by firewall.")
+		if !f.preferences.GetBool(preferences.RequireTLSKey) {
+			f.Println("Consider also to require TLS before login by `change require-tls`.")
+		}
+		if !f.yesNoQuestion("Are you sure you want to accept connections from other machines and restart the Bridge") {
+			return
+		}
+	}
+
+	f.Println("Saving bind address", newAddress)
+	f.preferences.Set(preferences.BindAddressKey, newAddress)
+	f.Println("Restarting Bridge...")
+	f.appRestart = true
+	f.Stop()
+}
+
+func (f *frontendCLI) isBindAddress(address string) bool {
+	if address == "" || address == "localhost" || net.ParseIP(address) != nil {
+		return true
+	}
+	f.Println("Input", address, "is not a valid IP address.")
+	return false
+}
+
+func (f *frontendCLI) toggleAttachPublicKey(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.AttachPublicKeyKey) {
+		f.Println("Bridge is currently set to attach the sender public key to all outgoing messages.")
+		if f.yesNoQuestion("Are you sure you want to attach it only when set in account settings") {
+			f.preferences.SetBool(preferences.AttachPublicKeyKey, false)
+		}
+	} else {
+		f.Println("Bridge is currently set to attach the sender public key only when set in account settings.")
+		if f.yesNoQuestion("Are you sure you want to attach it to all outgoing messages") {
+			f.preferences.SetBool(preferences.AttachPublicKeyKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) toggleWKDLookup(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.WKDLookupKey) {
+		f.Println("Bridge is currently set to look up keys of external recipients in Web Key Directory and encrypt messages with them.")
+		if f.yesNoQuestion("Are you sure you want to stop bridge from doing this") {
+			f.preferences.SetBool(preferences.WKDLookupKey, false)
+		}
+	} else {
+		f.Println("Bridge is currently set to NOT look up keys of external recipients in Web Key Directory.")
+		if f.yesNoQuestion("Are you sure you want to allow bridge to do this") {
+			f.preferences.SetBool(preferences.WKDLookupKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) toggleDraftCleanup(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.DraftCleanupKey) {
+		f.Println("Bridge is currently set to delete drafts it created for messages which could not be sent.")
+		if f.yesNoQuestion("Are you sure you want to keep such drafts") {
+			f.preferences.SetBool(preferences.DraftCleanupKey, false)
+		}
+	} else {
+		f.Println("Bridge is currently set to keep drafts it created for messages which could not be sent.")
+		if f.yesNoQuestion("Are you sure you want to delete such drafts") {
+			f.preferences.SetBool(preferences.DraftCleanupKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) togglePlainTextAlternative(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.PlainTextAlternativeKey) {
+		f.Println("Bridge is currently set to generate plain text alternative of HTML-only messages sent to external recipients.")
+		if f.yesNoQuestion("Are you sure you want to stop bridge from doing this") {
+			f.preferences.SetBool(preferences.PlainTextAlternativeKey, false)
+		}
+	} else {
+		f.Println("Bridge is currently set to send HTML-only messages to external recipients as they are.")
+		if f.yesNoQuestion("Are you sure you want to generate plain text alternative for them") {
+			f.preferences.SetBool(preferences.PlainTextAlternativeKey, true)
+		}
+	}
+}
+
+func (f *frontendCLI) changeRateLimit(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.SMTPRateLimitKey)
+	newLimit := f.readStringInAttempts("Set messages per minute, 0 for no limit (current "+current+")", c.ReadLine, f.isRateLimit)
+	if newLimit == "" || newLimit == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	f.preferences.Set(preferences.SMTPRateLimitKey, newLimit)
+	f.Println("Saved rate limit", newLimit)
+}
+
+func (f *frontendCLI) isRateLimit(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 {
+		f.Println("Input", value, "is not a valid number of messages.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changeSendDelay(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.SendDelayKey)
+	newDelay := f.readStringInAttempts("Set seconds to wait before sending, 0 to send immediately (current "+current+")", c.ReadLine, f.isSeconds)
+	if newDelay == "" || newDelay == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	f.preferences.Set(preferences.SendDelayKey, newDelay)
+	f.Println("Saved send delay", newDelay)
+}
+
+func (f *frontendCLI) isSeconds(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number < 0 {
+		f.Println("Input", value, "is not a valid number of seconds.")
+		return false
+	}
+	return true
+}
+
+func (f *frontendCLI) changeDuplicateSend(c *ishell.Context) {
+	if f.preferences.GetBool(preferences.DuplicateSendCheckKey) {
+		f.Println("Bridge is currently set to not send the same message again within", f.preferences.Get(preferences.DuplicateSendExpirationKey), "minutes.")
+		if f.yesNoQuestion("Do you want to send every message, even the same ones (e.g. heartbeat messages)") {
+			f.preferences.SetBool(preferences.DuplicateSendCheckKey, false)
+			return
+		}
+	} else {
+		f.Println("Bridge is currently set to send every message, even the same ones.")
+		if !f.yesNoQuestion("Do you want to detect the same message sent again, e.g. by client retrying on timeout") {
+			return
+		}
+		f.preferences.SetBool(preferences.DuplicateSendCheckKey, true)
+	}
+
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.preferences.Get(preferences.DuplicateSendExpirationKey)
+	expiration := f.readStringInAttempts("Set minutes to detect the same message (current "+current+")", c.ReadLine, f.isMinutes)
+	if expiration != "" {
+		f.preferences.Set(preferences.DuplicateSendExpirationKey, expiration)
+	}
+
+	current = f.preferences.Get(preferences.DuplicateSendDraftTimeoutKey)
+	draftTimeout := f.readStringInAttempts("Set minutes to wait for message being sent (current "+current+")", c.ReadLine, f.isMinutes)
+	if draftTimeout != "" {
+		f.preferences.Set(preferences.DuplicateSendDraftTimeoutKey, draftTimeout)
+	}
+}
+
+func (f *frontendCLI) isMinutes(value string) bool {
+	if value == "" {
+		return true
+	}
+	if number, err := strconv.Atoi(value); err != nil || number <= 0 {
+		f.Println("Input", value, "is not a valid number of minutes.")
+		return false
+	}
+	return true
+}
+
 func (f *frontendCLI) toggleAllowProxy(c *ishell.Context) {
 	if f.preferences.GetBool(preferences.AllowProxyKey) {
 		f.Println("Bridge is currently set to use alternative routing to connect to Proton if it is being blocked.")
@@ -0,0 +1,52 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPorts(t *testing.T) {
+	testData := []struct {
+		name                           string
+		imap, imaps, smtp, smtps, lmtp string
+		wantError                      bool
+	}{
+		{"defaults", "1143", "0", "1025", "0", "0", false},
+		{"all enabled", "1143", "1993", "1025", "1465", "1024", false},
+		{"same IMAP and SMTP", "1143", "0", "1143", "0", "0", true},
+		{"SMTPS on SMTP port", "1143", "0", "1025", "1025", "0", true},
+		{"SMTPS on IMAP port", "1143", "0", "1025", "1143", "0", true},
+		{"SMTPS on IMAPS port", "1143", "1465", "1025", "1465", "0", true},
+		{"IMAPS on SMTP port", "1143", "1025", "1025", "0", "0", true},
+		{"LMTP on SMTPS port", "1143", "0", "1025", "1465", "1465", true},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkPorts(tc.imap, tc.imaps, tc.smtp, tc.smtps, tc.lmtp)
+			if tc.wantError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -60,9 +60,11 @@ func New(
 	updates types.Updater,
 	bridge *bridge.Bridge,
 	noEncConfirmator types.NoEncConfirmator,
+	outbox types.Outbox,
+	sendJournal types.SendJournal,
 ) Frontend {
 	bridgeWrap := types.NewBridgeWrap(bridge)
-	return new(version, buildVersion, frontendType, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridgeWrap, noEncConfirmator)
+	return new(version, buildVersion, frontendType, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridgeWrap, noEncConfirmator, outbox, sendJournal)
 }
 
 func new(
@@ -77,10 +79,12 @@ func new(
 	updates types.Updater,
 	bridge types.Bridger,
 	noEncConfirmator types.NoEncConfirmator,
+	outbox types.Outbox,
+	sendJournal types.SendJournal,
 ) Frontend {
 	switch frontendType {
 	case "cli":
-		return cli.New(panicHandler, config, preferences, eventListener, updates, bridge)
+		return cli.New(panicHandler, config, preferences, eventListener, updates, bridge, outbox, sendJournal)
 	default:
 		return qt.New(version, buildVersion, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridge, noEncConfirmator)
 	}
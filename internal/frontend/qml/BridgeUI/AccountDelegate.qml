@@ -150,6 +150,29 @@ Column {
             textColor : Style.main.textBlue
         }
 
+        // sync progress
+        Text {
+            id: syncProgress
+            anchors {
+                verticalCenter : parent.verticalCenter
+                left           : logoutAccount.right
+                leftMargin     : Style.main.leftMargin
+            }
+            color   : Style.main.textDisabled
+            font.pointSize : Style.main.fontSize * Style.pt
+            visible : text != ""
+            text    : ""
+        }
+
+        Timer {
+            interval : 5000 //ms
+            repeat   : true
+            running  : root.state=="connected"
+            triggeredOnStart : true
+            onTriggered : syncProgress.text = go.getSyncProgress(root.iAccount)
+            onRunningChanged : if (!running) syncProgress.text = ""
+        }
+
         // remove
         ClickIconText {
             id: deleteAccount
@@ -346,6 +346,10 @@ Window {
             workAndClose()
         }
 
+        function getSyncProgress(index) {
+            return index == 0 ? "Syncing 42 %, 5m0s left" : ""
+        }
+
         function login(username,password) {
             delay(700)
             if (password=="wrong") {
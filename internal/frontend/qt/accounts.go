@@ -22,11 +22,13 @@ package qt
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/pkg/keychain"
+	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -61,7 +63,7 @@ func (s *FrontendQt) loadAccounts() {
 
 		// Set login info.
 		acc_info.SetUserID(user.ID())
-		acc_info.SetHostname(bridge.Host)
+		acc_info.SetHostname(ports.ClientHost(s.preferences.Get(preferences.BindAddressKey), bridge.Host))
 		acc_info.SetPassword(user.GetBridgePassword())
 		acc_info.SetPortIMAP(s.preferences.GetInt(preferences.IMAPPortKey))
 		acc_info.SetPortSMTP(s.preferences.GetInt(preferences.SMTPPortKey))
@@ -114,6 +116,25 @@ func (s *FrontendQt) logoutAccount(iAccount int) {
 	}
 }
 
+// getSyncProgress returns a short description of the running sync or
+// an empty string when the account is not being synced.
+func (s *FrontendQt) getSyncProgress(iAccount int) string {
+	userID := s.Accounts.get(iAccount).UserID()
+	user, err := s.bridge.GetUser(userID)
+	if err != nil {
+		return ""
+	}
+	progress, err := user.GetSyncProgress()
+	if err != nil || !progress.IsRunning || progress.Total == 0 {
+		return ""
+	}
+	description := fmt.Sprintf("Syncing %d %%", 100*progress.Done/progress.Total)
+	if progress.ETA > 0 {
+		description += ", " + progress.ETA.Round(time.Minute).String() + " left"
+	}
+	return description
+}
+
 func (s *FrontendQt) showLoginError(err error, scope string) bool {
 	if err == nil {
 		s.Qml.SetConnectionStatus(true) // If we are here connection is ok.
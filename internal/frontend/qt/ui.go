@@ -109,6 +109,7 @@ type GoQMLInterface struct {
 
 	_ func(iAccount int, removePreferences bool) `slot:"deleteAccount"`
 	_ func(iAccount int)                         `slot:"logoutAccount"`
+	_ func(iAccount int) string                  `slot:"getSyncProgress"`
 	_ func(iAccount int, iAddress int)           `slot:"configureAppleMail"`
 	_ func(iAccount int)                         `signal:"switchAddressMode"`
 
@@ -164,6 +165,7 @@ func (s *GoQMLInterface) SetFrontend(f *FrontendQt) {
 
 	s.ConnectDeleteAccount(f.deleteAccount)
 	s.ConnectLogoutAccount(f.logoutAccount)
+	s.ConnectGetSyncProgress(f.getSyncProgress)
 	s.ConnectConfigureAppleMail(f.configureAppleMail)
 	s.ConnectLogin(f.login)
 	s.ConnectAuth2FA(f.auth2FA)
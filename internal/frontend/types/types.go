@@ -20,6 +20,8 @@ package types
 
 import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/smtp"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/ProtonMail/proton-bridge/pkg/updates"
 )
@@ -41,6 +43,17 @@ type NoEncConfirmator interface {
 	ConfirmNoEncryption(string, bool)
 }
 
+// Outbox is an interface of SMTP outbox needed by frontend.
+type Outbox interface {
+	GetOutboxItems() []*smtp.OutboxItem
+	CancelOutboxItem(id string) error
+}
+
+// SendJournal is an interface of SMTP send journal needed by frontend.
+type SendJournal interface {
+	GetJournalEntries(query string, limit int) []*smtp.JournalEntry
+}
+
 // Bridger is an interface of bridge needed by frontend.
 type Bridger interface {
 	GetCurrentClient() string
@@ -52,6 +65,8 @@ type Bridger interface {
 	DeleteUser(userID string, clearCache bool) error
 	ReportBug(osType, osVersion, description, accountName, address, emailClient string) error
 	ClearData() error
+	MoveUserStore(userID, dir string) error
+	ImportUserStore(userID, path string) error
 }
 
 // BridgeUser is an interface of user needed by frontend.
@@ -64,6 +79,24 @@ type BridgeUser interface {
 	GetAddresses() []string
 	GetBridgePassword() string
 	SwitchAddressMode() error
+	IsMailboxHidden(labelID string) bool
+	SetMailboxHidden(labelID string, hidden bool) error
+	GetDeleteAction(mailboxName string) (store.DeleteAction, error)
+	SetDeleteAction(mailboxName string, action store.DeleteAction) error
+	GetSyncWindow(mailboxName string) (store.SyncWindow, error)
+	SetSyncWindow(mailboxName string, window store.SyncWindow) error
+	GetSyncProgress() (store.SyncProgress, error)
+	GetStoreMetrics() (store.Metrics, error)
+	IsMailboxExcluded(mailboxName string) (bool, error)
+	SetMailboxExcluded(mailboxName string, excluded bool) error
+	GetSyncMonths() (uint, error)
+	SetSyncMonths(months uint) error
+	CompactStore() (store.CompactResult, error)
+	GetStoreDir() string
+	ExportStore(path string) error
+	ListSavedSearches() []store.SavedSearch
+	AddSavedSearch(name, from, subject, mailboxName string) error
+	RemoveSavedSearch(name string) error
 	Logout() error
 }
 
@@ -34,6 +34,14 @@ type panicHandler interface {
 	HandlePanic()
 }
 
+type updateNotifier interface {
+	Notify(update interface{})
+}
+
+type updateDeliverer interface {
+	Deliver(update interface{}) bool
+}
+
 type imapBackend struct {
 	panicHandler  panicHandler
 	bridge        bridger
@@ -146,11 +154,28 @@ func (ib *imapBackend) deleteUser(address string) {
 	ib.usersLocker.Lock()
 	defer ib.usersLocker.Unlock()
 
-	delete(ib.users, strings.ToLower(address))
+	address = strings.ToLower(address)
+	if imapUser, ok := ib.users[address]; ok {
+		imapUser.prefetch.stop()
+	}
+	delete(ib.users, address)
 }
 
 // Login authenticates a user.
 func (ib *imapBackend) Login(username, password string) (goIMAPBackend.User, error) {
+	return ib.login(username, func(user bridgeUser) error {
+		return user.CheckBridgeLogin(password)
+	})
+}
+
+// loginCRAMMD5 authenticates a user by CRAM-MD5 digest of the bridge password.
+func (ib *imapBackend) loginCRAMMD5(username, challenge, digest string) (goIMAPBackend.User, error) {
+	return ib.login(username, func(user bridgeUser) error {
+		return user.CheckBridgeLoginCRAMMD5(challenge, digest)
+	})
+}
+
+func (ib *imapBackend) login(username string, checkPassword func(bridgeUser) error) (goIMAPBackend.User, error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer ib.panicHandler.HandlePanic()
 
@@ -160,7 +185,7 @@ func (ib *imapBackend) Login(username, password string) (goIMAPBackend.User, err
 		return nil, err
 	}
 
-	if err := imapUser.user.CheckBridgeLogin(password); err != nil {
+	if err := checkPassword(imapUser.user); err != nil {
 		log.WithError(err).Error("Could not check bridge password")
 		_ = imapUser.Logout()
 		// Apple Mail sometimes generates a lot of requests very quickly.
@@ -175,7 +200,9 @@ func (ib *imapBackend) Login(username, password string) (goIMAPBackend.User, err
 	// (otherwise the store will be locked for 1 sec per email during synchronization).
 	imapUser.user.SetIMAPIdleUpdateChannel()
 
-	return imapUser, nil
+	imapUser.startPrefetch()
+
+	return imapUser.forConnection(), nil
 }
 
 // Updates returns a channel of updates for IMAP IDLE extension.
@@ -186,6 +213,26 @@ func (ib *imapBackend) Updates() <-chan interface{} {
 	return ib.updates
 }
 
+// forwardUpdates passes every update to the notifier before go-imap gets it.
+// The notifier informs connections about not selected mailboxes. Updates of
+// the selected mailbox are sent by the deliverer and the rest by go-imap.
+func (ib *imapBackend) forwardUpdates(notifier updateNotifier, deliverer updateDeliverer) {
+	source := ib.updates
+	ib.updates = make(chan interface{})
+
+	go func() {
+		defer ib.panicHandler.HandlePanic()
+
+		for update := range source {
+			notifier.Notify(update)
+			if deliverer.Deliver(update) {
+				continue
+			}
+			ib.updates <- update
+		}
+	}()
+}
+
 func (ib *imapBackend) CreateMessageLimit() *uint32 {
 	return nil
 }
@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package binary implements IMAP BINARY extension (RFC 3516) so clients can
+// fetch decoded message parts instead of decoding base64 or
+// quoted-printable themselves.
+//
+// Literal8 is not supported by go-imap; it is translated to normal literal
+// in both directions by the literalplus connection.
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "BINARY"
+
+const (
+	binaryName     = "BINARY"
+	binaryPeekName = "BINARY.PEEK"
+	binarySizeName = "BINARY.SIZE"
+)
+
+// ErrUnknownCTE is returned when content transfer encoding of the part
+// cannot be decoded.
+var ErrUnknownCTE = server.ErrStatusResp(&imap.StatusResp{ //nolint[gochecknoglobals]
+	Type: imap.StatusNo,
+	Code: "UNKNOWN-CTE",
+	Info: "Cannot decode content transfer encoding of the part",
+})
+
+// Section is BINARY, BINARY.PEEK or BINARY.SIZE FETCH item.
+type Section struct {
+	// Path of the part, empty path means the whole message.
+	Path []int
+	// Peek means the message is not marked as read.
+	Peek bool
+	// Size means only size of decoded part is requested.
+	Size bool
+	// Partial is the origin and the length of the requested data.
+	Partial []int
+}
+
+// IsFetchItem returns whether the FETCH item belongs to BINARY extension.
+func IsFetchItem(item string) bool {
+	return strings.HasPrefix(item, binaryName+"[") ||
+		strings.HasPrefix(item, binaryPeekName+"[") ||
+		strings.HasPrefix(item, binarySizeName+"[")
+}
+
+// ParseSection parses the FETCH item, e.g. `BINARY.PEEK[1.2]<0.100>`.
+func ParseSection(item string) (*Section, error) {
+	partStart := strings.Index(item, "[")
+	partEnd := strings.LastIndex(item, "]")
+	if partStart == -1 || partEnd < partStart {
+		return nil, errors.New("invalid binary section: must contain brackets")
+	}
+
+	section := &Section{}
+	switch item[:partStart] {
+	case binaryName:
+	case binaryPeekName:
+		section.Peek = true
+	case binarySizeName:
+		section.Size = true
+	default:
+		return nil, errors.New("invalid binary section name")
+	}
+
+	if part := item[partStart+1 : partEnd]; part != "" {
+		for _, s := range strings.Split(part, ".") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return nil, errors.New("invalid binary section: part must be non-zero number")
+			}
+			section.Path = append(section.Path, n)
+		}
+	}
+
+	partial := item[partEnd+1:]
+	if partial == "" {
+		return section, nil
+	}
+	if section.Size || !strings.HasPrefix(partial, "<") || !strings.HasSuffix(partial, ">") {
+		return nil, errors.New("invalid binary section: invalid partial")
+	}
+	for _, s := range strings.SplitN(partial[1:len(partial)-1], ".", 2) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid binary section: invalid partial")
+		}
+		section.Partial = append(section.Partial, n)
+	}
+	return section, nil
+}
+
+// FetchItem returns the name of the item in the response. It is without
+// PEEK and the length of partial.
+func (section *Section) FetchItem() string {
+	name := binaryName
+	if section.Size {
+		name = binarySizeName
+	}
+
+	path := make([]string, len(section.Path))
+	for i, n := range section.Path {
+		path[i] = strconv.Itoa(n)
+	}
+	item := name + "[" + strings.Join(path, ".") + "]"
+
+	if len(section.Partial) > 0 {
+		item += "<" + strconv.Itoa(section.Partial[0]) + ">"
+	}
+	return item
+}
+
+// Decode returns content of the part decoded from its content transfer
+// encoding, or ErrUnknownCTE.
+func Decode(content []byte, contentTransferEncoding string) ([]byte, error) {
+	r := pmmime.DecodeContentEncoding(bytes.NewReader(content), strings.TrimSpace(contentTransferEncoding))
+	if r == nil {
+		return nil, ErrUnknownCTE
+	}
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, ErrUnknownCTE
+	}
+	return decoded, nil
+}
+
+type extension struct{}
+
+// NewExtension of BINARY. FETCH items are provided by the backend.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	return nil
+}
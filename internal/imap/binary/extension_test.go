@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package binary
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSection(t *testing.T) {
+	tests := []struct {
+		item     string
+		want     *Section
+		wantItem string
+	}{
+		{"BINARY[]", &Section{}, "BINARY[]"},
+		{"BINARY[1.2]", &Section{Path: []int{1, 2}}, "BINARY[1.2]"},
+		{"BINARY.PEEK[1]<10.20>", &Section{Path: []int{1}, Peek: true, Partial: []int{10, 20}}, "BINARY[1]<10>"},
+		{"BINARY.SIZE[3]", &Section{Path: []int{3}, Size: true}, "BINARY.SIZE[3]"},
+	}
+
+	for _, test := range tests {
+		section, err := ParseSection(test.item)
+		require.NoError(t, err, test.item)
+		assert.Equal(t, test.want, section, test.item)
+		assert.Equal(t, test.wantItem, section.FetchItem(), test.item)
+	}
+}
+
+func TestParseInvalidSection(t *testing.T) {
+	for _, item := range []string{
+		"BINARY",
+		"BINARY[TEXT]",
+		"BINARY[0]",
+		"BINARY.SIZE[1]<0.10>",
+		"BINARY[1]<a>",
+		"BODY[1]",
+	} {
+		_, err := ParseSection(item)
+		assert.Error(t, err, item)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		content, cte, want string
+	}{
+		{"AAFoZWxsbw==\r\n", "base64", "\x00\x01hello"},
+		{"caf=C3=A9=\r\n!", "Quoted-Printable", "café!"},
+		{"plain text", "7bit", "plain text"},
+		{"plain text", "", "plain text"},
+	}
+
+	for _, test := range tests {
+		decoded, err := Decode([]byte(test.content), test.cte)
+		require.NoError(t, err, test.cte)
+		assert.Equal(t, test.want, string(decoded), test.cte)
+	}
+
+	_, err := Decode([]byte("data"), "x-uuencode")
+	assert.Equal(t, ErrUnknownCTE, err)
+}
@@ -35,6 +35,7 @@ type bridger interface {
 type bridgeUser interface {
 	ID() string
 	CheckBridgeLogin(password string) error
+	CheckBridgeLoginCRAMMD5(challenge, digest string) error
 	IsCombinedAddressMode() bool
 	GetAddressID(address string) (string, error)
 	GetPrimaryAddress() string
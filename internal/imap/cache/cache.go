@@ -19,6 +19,7 @@ package cache
 
 import (
 	"bytes"
+	"io"
 	"sort"
 	"sync"
 	"time"
@@ -101,12 +102,14 @@ func BuildUnlock(messageID string) {
 	delete(buildLocks, messageID)
 }
 
-func LoadMail(mID string) (reader *bytes.Reader, structure *backendMessage.BodyStructure) {
-	reader = &bytes.Reader{}
+// LoadMail returns the reader of the cached message, or nil if the message
+// is not cached. Sections are read from the cached data only when they are
+// written, so the message is never copied.
+func LoadMail(mID string) (data io.ReaderAt, structure *backendMessage.BodyStructure) {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 	if message, ok := mailCache[mID]; ok && message.isValidOrDel() {
-		reader = bytes.NewReader(message.data)
+		data = bytes.NewReader(message.data)
 		structure = &message.structure
 
 		// Update timestamp to keep emails which are used often.
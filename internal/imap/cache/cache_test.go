@@ -20,6 +20,8 @@ package cache
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"testing"
 	"time"
 
@@ -36,16 +38,13 @@ func TestSaveAndLoad(t *testing.T) {
 	SaveMail(testUID, msg, bs)
 	require.Equal(t, mailCache[testUID].data, msg)
 
-	reader, _ := LoadMail(testUID)
-	require.Equal(t, reader.Len(), len(msg))
-	stored := make([]byte, len(msg))
-	_, _ = reader.Read(stored)
-	require.Equal(t, stored, msg)
+	stored, _ := LoadMail(testUID)
+	require.Equal(t, msg, readAll(t, stored))
 }
 
 func TestMissing(t *testing.T) {
-	reader, _ := LoadMail("non-existing")
-	require.Equal(t, reader.Len(), 0)
+	stored, _ := LoadMail("non-existing")
+	require.Nil(t, stored)
 }
 
 func TestClearOld(t *testing.T) {
@@ -54,8 +53,8 @@ func TestClearOld(t *testing.T) {
 	SaveMail(testUID, msg, bs)
 	time.Sleep(100 * time.Millisecond)
 
-	reader, _ := LoadMail(testUID)
-	require.Equal(t, reader.Len(), 0)
+	stored, _ := LoadMail(testUID)
+	require.Nil(t, stored)
 }
 
 func TestClearBig(t *testing.T) {
@@ -77,15 +76,13 @@ func TestClearBig(t *testing.T) {
 	// Check that the oldest are deleted first.
 	for i := 0; i < nSize*nSize; i++ {
 		iUID := fmt.Sprintf("%s%d", testUID, i)
-		reader, _ := LoadMail(iUID)
-		if i < nSize*(nSize-1) && reader.Len() != 0 {
+		stored, _ := LoadMail(iUID)
+		if i < nSize*(nSize-1) && stored != nil {
 			mail := mailCache[iUID]
 			t.Error("LoadMail should return empty but have:", mail.data, iUID, mail.key.Timestamp)
 		}
-		stored := make([]byte, len(msg))
-		_, _ = reader.Read(stored)
 
-		if i >= nSize*(nSize-1) && !bytes.Equal(stored, msg) {
+		if i >= nSize*(nSize-1) && (stored == nil || !bytes.Equal(readAll(t, stored), msg)) {
 			t.Error("LoadMail returned wrong message:", stored, iUID)
 		}
 	}
@@ -97,3 +94,9 @@ func TestConcurency(t *testing.T) {
 		go SaveMail(fmt.Sprintf("%s%d", testUID, i), msg, bs)
 	}
 }
+
+func readAll(t *testing.T, r io.ReaderAt) []byte {
+	b, err := ioutil.ReadAll(io.NewSectionReader(r, 0, 1<<20))
+	require.NoError(t, err)
+	return b
+}
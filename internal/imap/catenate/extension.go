@@ -0,0 +1,232 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package catenate implements CATENATE extension (RFC 4469) so clients can
+// APPEND a message composed of new text and parts of existing messages
+// referenced by URL, e.g. attachments of forwarded message in a draft,
+// without uploading them again.
+//
+// Only one message per APPEND is supported (no MULTIAPPEND) and URLs have
+// to point to this server, see URL.
+package catenate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "CATENATE"
+
+const (
+	catenate = "CATENATE"
+	textPart = "TEXT"
+	urlPart  = "URL"
+
+	codeBadURL = "BADURL"
+)
+
+// Part is TEXT or URL part of CATENATE; exactly one of them is set.
+type Part struct {
+	Text imap.Literal
+	URL  string
+}
+
+// Append is APPEND command with optional CATENATE message data.
+type Append struct {
+	commands.Append
+
+	// Parts are set when message was sent as CATENATE.
+	Parts []Part
+}
+
+func (cmd *Append) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return cmd.Append.Parse(fields)
+	}
+
+	last := len(fields) - 1
+	name, isAtom := fields[last-1].(string)
+	list, isList := fields[last].([]interface{})
+	if !isAtom || !isList || !strings.EqualFold(name, catenate) {
+		return cmd.Append.Parse(fields)
+	}
+
+	if err := cmd.parseParts(list); err != nil {
+		return err
+	}
+
+	// Mailbox, flags and date are the same as for normal APPEND.
+	fields = append(fields[:last-1:last-1], &bytes.Buffer{})
+	return cmd.Append.Parse(fields)
+}
+
+func (cmd *Append) parseParts(list []interface{}) error {
+	if len(list) == 0 || len(list)%2 != 0 {
+		return errors.New("CATENATE parts must be pairs of type and data")
+	}
+
+	for i := 0; i < len(list); i += 2 {
+		partType, _ := list[i].(string)
+		switch strings.ToUpper(partType) {
+		case textPart:
+			literal, ok := list[i+1].(imap.Literal)
+			if !ok {
+				return errors.New("CATENATE TEXT must be a literal")
+			}
+			cmd.Parts = append(cmd.Parts, Part{Text: literal})
+		case urlPart:
+			rawURL, ok := list[i+1].(string)
+			if !ok {
+				return errors.New("CATENATE URL must be a string")
+			}
+			cmd.Parts = append(cmd.Parts, Part{URL: rawURL})
+		default:
+			return errors.New("unknown CATENATE part " + partType)
+		}
+	}
+	return nil
+}
+
+func (cmd *Append) Handle(conn server.Conn) error {
+	if conn.Context().User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	if cmd.Parts != nil {
+		message, err := cmd.catenate(conn.Context())
+		if err != nil {
+			return err
+		}
+		cmd.Message = message
+	}
+
+	handler := &server.Append{Append: cmd.Append}
+	return handler.Handle(conn)
+}
+
+// catenate returns the message built from all parts.
+func (cmd *Append) catenate(ctx *server.Context) (imap.Literal, error) {
+	message := &bytes.Buffer{}
+	for _, part := range cmd.Parts {
+		if part.Text != nil {
+			if _, err := io.Copy(message, part.Text); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := fetchURL(ctx, part.URL)
+		if err != nil {
+			return nil, server.ErrStatusResp(&imap.StatusResp{
+				Type:      imap.StatusNo,
+				Code:      codeBadURL,
+				Arguments: []interface{}{part.URL},
+				Info:      err.Error(),
+			})
+		}
+		if _, err := io.Copy(message, data); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// fetchURL returns data referenced by the URL. Relative URL points to the
+// selected mailbox.
+func fetchURL(ctx *server.Context, rawURL string) (imap.Literal, error) {
+	u, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var mbox backend.Mailbox
+	if u.Mailbox == "" {
+		if mbox = ctx.Mailbox; mbox == nil {
+			return nil, errors.New("relative URL requires selected mailbox")
+		}
+	} else if mbox, err = ctx.User.GetMailbox(u.Mailbox); err != nil {
+		return nil, err
+	}
+
+	if u.UIDValidity != 0 {
+		status, err := mbox.Status([]string{imap.MailboxUidValidity})
+		if err != nil {
+			return nil, err
+		}
+		if status.UidValidity != u.UIDValidity {
+			return nil, errors.New("UIDVALIDITY does not match")
+		}
+	}
+
+	item := u.FetchItem()
+	if _, err := imap.NewBodySectionName(item); err != nil {
+		return nil, err
+	}
+
+	seqSet := &imap.SeqSet{}
+	seqSet.AddNum(u.UID)
+	messages := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- mbox.ListMessages(true, seqSet, []string{item}, messages)
+	}()
+
+	var data imap.Literal
+	for msg := range messages {
+		if data == nil {
+			data = msg.GetBody(item)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("message does not exist")
+	}
+	return data, nil
+}
+
+type extension struct{}
+
+// NewExtension of CATENATE.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != imap.Append {
+		return nil
+	}
+	return func() server.Handler {
+		return &Append{}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package catenate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		want     *URL
+		wantItem string
+	}{
+		{"/Drafts;UIDVALIDITY=385759045/;UID=20/;SECTION=1.MIME", &URL{Mailbox: "Drafts", UIDValidity: 385759045, UID: 20, Section: "1.MIME"}, "BODY.PEEK[1.MIME]"},
+		{"/Drafts/;UID=30", &URL{Mailbox: "Drafts", UID: 30}, "BODY.PEEK[]"},
+		{"/inbox/;uid=3/;section=text/;partial=10.20", &URL{Mailbox: "INBOX", UID: 3, Section: "TEXT", Partial: []int{10, 20}}, "BODY.PEEK[TEXT]<10.20>"},
+		{"/Folders/&AOk-/;UID=1", &URL{Mailbox: "Folders/é", UID: 1}, "BODY.PEEK[]"},
+		{";UID=20/;SECTION=2", &URL{UID: 20, Section: "2"}, "BODY.PEEK[2]"},
+	}
+
+	for _, test := range tests {
+		u, err := ParseURL(test.url)
+		require.NoError(t, err, test.url)
+		assert.Equal(t, test.want, u, test.url)
+		assert.Equal(t, test.wantItem, u.FetchItem(), test.url)
+	}
+}
+
+func TestParseInvalidURL(t *testing.T) {
+	for _, rawURL := range []string{
+		"imap://user@example.com/INBOX/;UID=1",
+		"/INBOX",
+		"/INBOX/;UID=0",
+		"/INBOX/;UID=x",
+		"/INBOX/;UID=1/;URLAUTH=anonymous",
+		"/INBOX/;UID=1/;PARTIAL=a",
+	} {
+		_, err := ParseURL(rawURL)
+		assert.Error(t, err, rawURL)
+	}
+}
+
+func TestParseAppend(t *testing.T) {
+	text := bytes.NewBufferString("Subject: test\r\n\r\n")
+	cmd := &Append{}
+	require.NoError(t, cmd.Parse([]interface{}{
+		"Drafts",
+		[]interface{}{"\\Draft"},
+		"CATENATE",
+		[]interface{}{"TEXT", text, "URL", "/INBOX/;UID=1/;SECTION=2"},
+	}))
+	assert.Equal(t, "Drafts", cmd.Mailbox)
+	assert.Equal(t, []string{"\\Draft"}, cmd.Flags)
+	assert.Equal(t, []Part{{Text: text}, {URL: "/INBOX/;UID=1/;SECTION=2"}}, cmd.Parts)
+
+	cmd = &Append{}
+	require.NoError(t, cmd.Parse([]interface{}{"INBOX", text}))
+	assert.Equal(t, text, cmd.Message)
+	assert.Nil(t, cmd.Parts)
+
+	cmd = &Append{}
+	assert.Error(t, cmd.Parse([]interface{}{"INBOX", "CATENATE", []interface{}{"TEXT"}}))
+	assert.Error(t, cmd.Parse([]interface{}{"INBOX", "CATENATE", []interface{}{"FILE", "x"}}))
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package catenate
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// URL is a reference to a message or its part on this server as defined
+// by RFC 5092. Only URLs without server (absolute path or relative to the
+// selected mailbox) and without URLAUTH are supported.
+type URL struct {
+	// Mailbox is empty for URL relative to the selected mailbox.
+	Mailbox     string
+	UIDValidity uint32
+	UID         uint32
+	Section     string
+	Partial     []int
+}
+
+// ParseURL parses the URL, e.g. `/Drafts;UIDVALIDITY=385759045/;UID=20/;SECTION=1.MIME`.
+func ParseURL(rawURL string) (*URL, error) {
+	if !strings.HasPrefix(rawURL, "/") && !strings.HasPrefix(rawURL, ";") {
+		return nil, errors.New("only URLs of this server without host are supported")
+	}
+
+	// Relative URL `;UID=20` is the same as `/;UID=20` without mailbox.
+	if strings.HasPrefix(rawURL, ";") {
+		rawURL = "/" + rawURL
+	}
+
+	u := &URL{}
+	parts := strings.Split(rawURL, "/;")
+
+	if mailbox := parts[0]; mailbox != "" {
+		if err := u.parseMailbox(mailbox); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("invalid URL part " + part)
+		}
+
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToUpper(kv[0]) {
+		case "UID":
+			if u.UID, err = parseNumber(value); err != nil {
+				return nil, err
+			}
+		case "SECTION":
+			u.Section = strings.ToUpper(value)
+		case "PARTIAL":
+			if u.Partial, err = parsePartial(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("unsupported URL part " + kv[0])
+		}
+	}
+
+	if u.UID == 0 {
+		return nil, errors.New("URL has to contain UID")
+	}
+	return u, nil
+}
+
+// parseMailbox parses `/Drafts;UIDVALIDITY=385759045` or `;UIDVALIDITY=...`
+// of relative URL. Mailbox is %-escaped modified UTF-7.
+func (u *URL) parseMailbox(mailbox string) (err error) {
+	mailbox = strings.TrimPrefix(mailbox, "/")
+	if i := strings.Index(strings.ToUpper(mailbox), ";UIDVALIDITY="); i != -1 {
+		if u.UIDValidity, err = parseNumber(mailbox[i+len(";UIDVALIDITY="):]); err != nil {
+			return err
+		}
+		mailbox = mailbox[:i]
+	}
+
+	if mailbox, err = url.PathUnescape(mailbox); err != nil {
+		return err
+	}
+	if mailbox, err = utf7.Decoder.String(mailbox); err != nil {
+		return err
+	}
+	u.Mailbox = imap.CanonicalMailboxName(mailbox)
+	return nil
+}
+
+// FetchItem returns BODY.PEEK FETCH item of the referenced data so reading
+// them does not mark the message as read.
+func (u *URL) FetchItem() string {
+	item := "BODY.PEEK[" + u.Section + "]"
+	if len(u.Partial) > 0 {
+		item += "<" + strconv.Itoa(u.Partial[0])
+		if len(u.Partial) > 1 {
+			item += "." + strconv.Itoa(u.Partial[1])
+		}
+		item += ">"
+	}
+	return item
+}
+
+func parseNumber(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, errors.New("invalid number " + s)
+	}
+	return uint32(n), nil
+}
+
+func parsePartial(s string) (partial []int, err error) {
+	for _, part := range strings.SplitN(s, ".", 2) {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid partial " + s)
+		}
+		partial = append(partial, n)
+	}
+	return partial, nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"strings"
+	"sync"
+
+	imapid "github.com/ProtonMail/go-imap-id"
+	"github.com/emersion/go-imap"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// outlookMailboxes are names of default folders which Outlook creates when
+// it does not recognise the special-use mailboxes.
+var outlookMailboxes = map[string]string{ //nolint[gochecknoglobals]
+	"Sent Items":    "Sent",
+	"Deleted Items": "Trash",
+	"Junk Email":    "Spam",
+	"Junk E-mail":   "Spam",
+}
+
+// mailClient is the client of one IMAP connection as identified by ID
+// command. Workarounds for known clients are enabled based on its name.
+type mailClient struct {
+	lock sync.RWMutex
+	id   imapid.ID
+}
+
+func (c *mailClient) setID(id imapid.ID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.id = id
+}
+
+func (c *mailClient) name() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.id[imapid.FieldName]
+}
+
+// isAppleMail is true for Apple Mail which APPENDs again messages which are
+// already in the mailbox.
+func (c *mailClient) isAppleMail() bool {
+	return c.name() == clientAppleMail
+}
+
+// isOutlook is true for Outlook which uses its own names of special folders.
+func (c *mailClient) isOutlook() bool {
+	name := c.name()
+	return name == clientOutlookWin || name == clientOutlookMac
+}
+
+// mailboxName returns the name of mailbox the client means by name.
+func (c *mailClient) mailboxName(name string) string {
+	if c.isOutlook() {
+		if alias, ok := outlookMailboxes[name]; ok {
+			return alias
+		}
+	}
+	return name
+}
+
+// SetClientID is called by ID extension when the client sends ID after
+// authentication. ID sent before authentication is set by applyClientID.
+func (iu *imapUser) SetClientID(id imapid.ID) {
+	log.WithField("address", iu.currentAddressLowercase).
+		WithField("client", id[imapid.FieldName]).
+		WithField("version", id[imapid.FieldVersion]).
+		Info("Mail client identified")
+
+	iu.mailClient.setID(id)
+	iu.backend.setLastMailClient(id)
+}
+
+// clientIDExtension provides ID command and overrides LOGIN and AUTHENTICATE
+// commands to pass the ID sent before authentication to the authenticated
+// user. It must be enabled as the last extension so its connection is not
+// wrapped by other extensions (e.g. COMPRESS) and can be found again.
+type clientIDExtension struct {
+	imapserver.Extension
+}
+
+func newClientIDExtension(serverID imapid.ID) *clientIDExtension {
+	return &clientIDExtension{Extension: imapid.NewExtension(serverID)}
+}
+
+func (ext *clientIDExtension) Command(name string) imapserver.HandlerFactory {
+	switch strings.ToUpper(name) {
+	case imap.Login:
+		return func() imapserver.Handler { return &loginWithClientID{} }
+	case imap.Authenticate:
+		return func() imapserver.Handler { return &authenticateWithClientID{} }
+	}
+
+	newHandler := ext.Extension.Command(name)
+	if newHandler == nil {
+		return nil
+	}
+	return func() imapserver.Handler {
+		return &idWithClientID{Handler: newHandler()}
+	}
+}
+
+func (ext *clientIDExtension) NewConn(c imapserver.Conn) imapserver.Conn {
+	return &clientIDConn{Conn: c}
+}
+
+type clientIDConn struct {
+	imapserver.Conn
+
+	id imapid.ID
+}
+
+// findClientIDConn returns the outermost connection with the context of conn.
+func findClientIDConn(conn imapserver.Conn) (found *clientIDConn) {
+	conn.Server().ForEachConn(func(candidate imapserver.Conn) {
+		if candidate.Context() != conn.Context() {
+			return
+		}
+		if idConn, ok := candidate.(*clientIDConn); ok {
+			found = idConn
+		}
+	})
+	return
+}
+
+type idWithClientID struct {
+	imapserver.Handler
+}
+
+func (cmd *idWithClientID) Handle(conn imapserver.Conn) error {
+	if hdlr, ok := cmd.Handler.(*imapid.Handler); ok {
+		if idConn := findClientIDConn(conn); idConn != nil {
+			idConn.id = hdlr.Command.ID
+		}
+	}
+	return cmd.Handler.Handle(conn)
+}
+
+type loginWithClientID struct {
+	imapserver.Login
+}
+
+func (cmd *loginWithClientID) Handle(conn imapserver.Conn) error {
+	err := cmd.Login.Handle(conn)
+	applyClientID(conn)
+	return err
+}
+
+type authenticateWithClientID struct {
+	imapserver.Authenticate
+}
+
+func (cmd *authenticateWithClientID) Handle(conn imapserver.Conn) error {
+	err := cmd.Authenticate.Handle(conn)
+	applyClientID(conn)
+	return err
+}
+
+// applyClientID passes ID of the connection to the authenticated user.
+// Successful authentication returns status response as error, therefore
+// the user of connection is checked instead.
+func applyClientID(conn imapserver.Conn) {
+	user, ok := conn.Context().User.(imapid.User)
+	if !ok {
+		return
+	}
+
+	if idConn := findClientIDConn(conn); idConn != nil && idConn.id != nil {
+		user.SetClientID(idConn.id)
+	}
+}
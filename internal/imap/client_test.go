@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+
+	imapid "github.com/ProtonMail/go-imap-id"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMailClientMailboxName(t *testing.T) {
+	client := &mailClient{}
+	assert.Equal(t, "Sent Items", client.mailboxName("Sent Items"))
+
+	client.setID(imapid.ID{imapid.FieldName: clientOutlookWin})
+	assert.Equal(t, "Sent", client.mailboxName("Sent Items"))
+	assert.Equal(t, "Trash", client.mailboxName("Deleted Items"))
+	assert.Equal(t, "Spam", client.mailboxName("Junk Email"))
+	assert.Equal(t, "Folders/Sent Items", client.mailboxName("Folders/Sent Items"))
+
+	client.setID(imapid.ID{imapid.FieldName: clientThunderbird})
+	assert.Equal(t, "Sent Items", client.mailboxName("Sent Items"))
+}
+
+func TestMailClientWorkarounds(t *testing.T) {
+	tests := []struct {
+		name                   string
+		isAppleMail, isOutlook bool
+	}{
+		{clientNone, false, false},
+		{clientAppleMail, true, false},
+		{clientThunderbird, false, false},
+		{clientOutlookMac, false, true},
+		{clientOutlookWin, false, true},
+	}
+	for _, test := range tests {
+		client := &mailClient{}
+		client.setID(imapid.ID{imapid.FieldName: test.name})
+		assert.Equal(t, test.isAppleMail, client.isAppleMail(), test.name)
+		assert.Equal(t, test.isOutlook, client.isOutlook(), test.name)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package compress
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+)
+
+// deflateConn is a connection compressed in both directions by DEFLATE
+// (RFC1951) without any header as required by RFC4978.
+type deflateConn struct {
+	net.Conn
+
+	r io.Reader
+	w *flate.Writer
+}
+
+func newDeflateConn(c net.Conn) (net.Conn, error) {
+	w, err := flate.NewWriter(c, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return &deflateConn{
+		Conn: c,
+		r:    flate.NewReader(c),
+		w:    w,
+	}, nil
+}
+
+func (c *deflateConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *deflateConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+// Flush is called by go-imap after each response so the client gets it
+// without waiting for more data to fill the compression window.
+func (c *deflateConn) Flush() error {
+	return c.w.Flush()
+}
+
+// Close does not finish the streams; go-imap can close the connection while
+// other goroutine writes a response and the client does not need the final
+// block of closed connection anyway.
+func (c *deflateConn) Close() error {
+	return c.Conn.Close()
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package compress implements COMPRESS=DEFLATE extension as defined in RFC4978.
+package compress
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/literalplus"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "COMPRESS=DEFLATE"
+
+const (
+	compress           = "COMPRESS"
+	deflate            = "DEFLATE"
+	compressionActive  = "COMPRESSIONACTIVE"
+	compressionEnabled = "DEFLATE active"
+)
+
+// Compress is a COMPRESS command.
+type Compress struct {
+	Mechanism string
+
+	ext *extension
+}
+
+func (cmd *Compress) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("no enough arguments")
+	}
+	mechanism, ok := fields[0].(string)
+	if !ok {
+		return errors.New("compression mechanism must be a string")
+	}
+	cmd.Mechanism = strings.ToUpper(mechanism)
+	return nil
+}
+
+func (cmd *Compress) Handle(conn server.Conn) error {
+	if cmd.Mechanism != deflate {
+		return errors.New("unsupported compression mechanism")
+	}
+	if cmd.ext.isCompressed(conn) {
+		return server.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusNo,
+			Code: compressionActive,
+			Info: "Compression is already active",
+		})
+	}
+	return server.ErrStatusResp(&imap.StatusResp{
+		Type: imap.StatusOk,
+		Info: compressionEnabled,
+	})
+}
+
+// Upgrade starts the compression once the OK response was sent.
+func (cmd *Compress) Upgrade(conn server.Conn) error {
+	u := &upgrade{conn: conn}
+	if err := conn.WriteResp(u); err != nil {
+		return err
+	}
+	if u.err != nil {
+		return u.err
+	}
+	cmd.ext.setCompressed(conn)
+	return nil
+}
+
+// upgrade is sent as a response to replace the connection by the goroutine
+// writing responses. go-imap flushes the OK response in that goroutine and
+// upgrading the connection from the command goroutine would race with it.
+type upgrade struct {
+	conn server.Conn
+	err  error
+}
+
+func (u *upgrade) WriteTo(*imap.Writer) error {
+	u.err = u.conn.Upgrade(literalplus.Upgrader(func(c net.Conn) (net.Conn, error) {
+		return newDeflateConn(c)
+	}))
+	return u.err
+}
+
+type extension struct {
+	lock       sync.Mutex
+	compressed map[*server.Context]bool
+}
+
+// NewExtension of COMPRESS=DEFLATE.
+func NewExtension() server.Extension {
+	return &extension{
+		compressed: map[*server.Context]bool{},
+	}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 && !ext.isCompressed(c) {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != compress {
+		return nil
+	}
+	return func() server.Handler {
+		return &Compress{ext: ext}
+	}
+}
+
+// NewConn forgets compression of the connection once it is closed.
+func (ext *extension) NewConn(c server.Conn) server.Conn {
+	return &conn{Conn: c, ext: ext}
+}
+
+type conn struct {
+	server.Conn
+	ext *extension
+}
+
+func (c *conn) Close() error {
+	c.ext.lock.Lock()
+	delete(c.ext.compressed, c.Context())
+	c.ext.lock.Unlock()
+	return c.Conn.Close()
+}
+
+func (ext *extension) isCompressed(c server.Conn) bool {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+	return ext.compressed[c.Context()]
+}
+
+func (ext *extension) setCompressed(c server.Conn) {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+	ext.compressed[c.Context()] = true
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package compress
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/literalplus"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressConnection(t *testing.T) {
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(literalplus.NewExtension(), NewExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// Only the listener is closed, go-imap closing connections from other
+	// goroutine is racy.
+	go s.Serve(l)   //nolint[errcheck]
+	defer l.Close() //nolint[errcheck]
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close() //nolint[errcheck]
+
+	r := bufio.NewReader(c)
+	readUntilTag(t, r, "*")
+	send(t, c, "a LOGIN username password")
+	readUntilTag(t, r, "a OK")
+
+	send(t, c, "b CAPABILITY")
+	require.Contains(t, readUntilTag(t, r, "b OK"), Capability)
+
+	send(t, c, "c COMPRESS DEFLATE")
+	readUntilTag(t, r, "c OK")
+
+	compressed, err := newDeflateConn(c)
+	require.NoError(t, err)
+	compressedReader := bufio.NewReader(compressed)
+
+	send(t, compressed, "d CAPABILITY")
+	require.NoError(t, compressed.(*deflateConn).Flush())
+	require.NotContains(t, readUntilTag(t, compressedReader, "d OK"), Capability)
+
+	send(t, compressed, "e COMPRESS DEFLATE")
+	require.NoError(t, compressed.(*deflateConn).Flush())
+	require.Contains(t, readUntilTag(t, compressedReader, "e NO"), compressionActive)
+
+	// Non-synchronizing literals are still recognised in the compressed stream.
+	send(t, compressed, "f APPEND INBOX {4+}\r\nHi\r\n")
+	require.NoError(t, compressed.(*deflateConn).Flush())
+	require.True(t, strings.HasPrefix(readUntilTag(t, compressedReader, "f "), "f OK"))
+}
+
+func send(t *testing.T, c net.Conn, command string) {
+	_, err := fmt.Fprintf(c, "%s\r\n", command)
+	require.NoError(t, err)
+}
+
+// readUntilTag returns all lines up to the one starting with the prefix.
+func readUntilTag(t *testing.T, r *bufio.Reader, prefix string) string {
+	lines := ""
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		lines += line
+		if strings.HasPrefix(line, prefix) {
+			return lines
+		}
+	}
+}
@@ -0,0 +1,625 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package condstore
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+)
+
+// Enable is an ENABLE command, as defined in RFC 5161.
+type Enable struct {
+	Capabilities []string
+
+	ext *extension
+}
+
+func (cmd *Enable) Parse(fields []interface{}) error {
+	if len(fields) == 0 {
+		return errors.New("missing capabilities")
+	}
+	for _, f := range fields {
+		capability, ok := f.(string)
+		if !ok {
+			return errors.New("capability must be a string")
+		}
+		cmd.Capabilities = append(cmd.Capabilities, strings.ToUpper(capability))
+	}
+	return nil
+}
+
+func (cmd *Enable) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+	if ctx.Mailbox != nil {
+		return errors.New("ENABLE is not allowed when mailbox is selected")
+	}
+
+	fields := []interface{}{enabled}
+	for _, capability := range cmd.Capabilities {
+		switch capability {
+		case Capability:
+			cmd.ext.enableCondstore(conn)
+		case QResyncCapability:
+			cmd.ext.enableQResync(conn)
+		default:
+			continue
+		}
+		fields = append(fields, capability)
+	}
+
+	return conn.WriteResp(imap.NewUntaggedResp(fields))
+}
+
+// qresyncParams are parameters of SELECT (QRESYNC ...) without the optional
+// sequence match data which is not needed thanks to VANISHED (EARLIER).
+type qresyncParams struct {
+	uidValidity uint32
+	modSeq      uint64
+	knownUIDs   *imap.SeqSet
+}
+
+// Select is a SELECT or EXAMINE command with CONDSTORE or QRESYNC parameter.
+type Select struct {
+	server.Select
+
+	condstore bool
+	qresync   *qresyncParams
+
+	ext *extension
+}
+
+func (cmd *Select) Parse(fields []interface{}) error {
+	if len(fields) > 1 {
+		params, ok := fields[1].([]interface{})
+		if !ok {
+			return errors.New("select parameters must be a list")
+		}
+		if err := cmd.parseParams(params); err != nil {
+			return err
+		}
+		fields = fields[:1]
+	}
+	return cmd.Select.Parse(fields)
+}
+
+func (cmd *Select) parseParams(params []interface{}) error {
+	for i := 0; i < len(params); i++ {
+		name, _ := params[i].(string)
+		switch strings.ToUpper(name) {
+		case Capability:
+			cmd.condstore = true
+		case QResyncCapability:
+			i++
+			if i >= len(params) {
+				return errors.New("missing QRESYNC parameters")
+			}
+			qresync, ok := params[i].([]interface{})
+			if !ok || len(qresync) < 2 {
+				return errors.New("QRESYNC parameters must be a list")
+			}
+			var err error
+			cmd.qresync = &qresyncParams{}
+			if cmd.qresync.uidValidity, err = imap.ParseNumber(qresync[0]); err != nil {
+				return err
+			}
+			if cmd.qresync.modSeq, err = parseModSeq(qresync[1]); err != nil {
+				return err
+			}
+			if len(qresync) > 2 {
+				knownUIDs, _ := qresync[2].(string)
+				if cmd.qresync.knownUIDs, err = imap.NewSeqSet(knownUIDs); err != nil {
+					return err
+				}
+			}
+		default:
+			return errors.New("unknown select parameter " + name)
+		}
+	}
+	return nil
+}
+
+func (cmd *Select) Handle(conn server.Conn) error {
+	state := cmd.ext.getState(conn)
+	if cmd.qresync != nil && !state.qresync {
+		return errors.New("QRESYNC is not enabled")
+	}
+	if cmd.condstore {
+		cmd.ext.enableCondstore(conn)
+	}
+
+	// Failed SELECT leaves the connection without selected mailbox, which is
+	// also the way to know whether the selection succeeded.
+	ctx := conn.Context()
+	if ctx.Mailbox != nil && state.qresync {
+		if err := conn.WriteResp(&imap.StatusResp{Type: imap.StatusOk, Code: codeClosed, Info: "Previous mailbox closed"}); err != nil {
+			return err
+		}
+	}
+	ctx.Mailbox = nil
+	ctx.MailboxReadOnly = false
+
+	selectErr := cmd.Select.Handle(conn)
+	if ctx.Mailbox == nil {
+		return selectErr
+	}
+
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		if err := conn.WriteResp(&imap.StatusResp{Type: imap.StatusOk, Code: codeNoModSeq, Info: "No mod-sequences"}); err != nil {
+			return err
+		}
+		return selectErr
+	}
+
+	highestModSeq, err := mbox.HighestModSeq()
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteResp(&imap.StatusResp{
+		Type:      imap.StatusOk,
+		Code:      codeHighestModSeq,
+		Arguments: []interface{}{formatNumber(highestModSeq)},
+		Info:      "Highest",
+	}); err != nil {
+		return err
+	}
+
+	if cmd.qresync != nil {
+		if err := cmd.resync(conn, mbox); err != nil {
+			return err
+		}
+	}
+
+	return selectErr
+}
+
+// resync sends changes since the state known by the client. Nothing is sent
+// when UIDVALIDITY changed, the client has to fetch everything again anyway.
+func (cmd *Select) resync(conn server.Conn, mbox Mailbox) error {
+	status, err := mbox.Status([]string{imap.MailboxUidValidity})
+	if err != nil {
+		return err
+	}
+	if status.UidValidity != cmd.qresync.uidValidity {
+		return nil
+	}
+
+	knownUIDs := cmd.qresync.knownUIDs
+	if knownUIDs == nil {
+		knownUIDs, _ = imap.NewSeqSet("1:*")
+	}
+	if err := writeVanished(conn, mbox, knownUIDs, cmd.qresync.modSeq); err != nil {
+		return err
+	}
+
+	changed, err := changedSinceSet(mbox, true, knownUIDs, cmd.qresync.modSeq)
+	if err != nil || changed.Empty() {
+		return err
+	}
+	return fetch(conn, mbox, true, changed, []string{imap.UidMsgAttr, imap.FlagsMsgAttr, ModSeqMsgAttr})
+}
+
+// Fetch is a FETCH command with CHANGEDSINCE and VANISHED modifiers.
+type Fetch struct {
+	server.Fetch
+
+	changedSince    uint64
+	hasChangedSince bool
+	vanished        bool
+
+	ext *extension
+}
+
+func (cmd *Fetch) Parse(fields []interface{}) error {
+	if len(fields) > 2 {
+		modifiers, ok := fields[2].([]interface{})
+		if !ok {
+			return errors.New("fetch modifiers must be a list")
+		}
+		if err := cmd.parseModifiers(modifiers); err != nil {
+			return err
+		}
+		fields = fields[:2]
+	}
+	return cmd.Fetch.Parse(fields)
+}
+
+func (cmd *Fetch) parseModifiers(modifiers []interface{}) (err error) {
+	for i := 0; i < len(modifiers); i++ {
+		name, _ := modifiers[i].(string)
+		switch strings.ToUpper(name) {
+		case changedSince:
+			i++
+			if i >= len(modifiers) {
+				return errors.New("missing CHANGEDSINCE value")
+			}
+			if cmd.changedSince, err = parseModSeq(modifiers[i]); err != nil {
+				return err
+			}
+			cmd.hasChangedSince = true
+		case vanished:
+			cmd.vanished = true
+		default:
+			return errors.New("unknown fetch modifier " + name)
+		}
+	}
+	return nil
+}
+
+func (cmd *Fetch) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	if cmd.vanished && (!uid || !cmd.hasChangedSince || !cmd.ext.getState(conn).qresync) {
+		return errors.New("VANISHED requires UID FETCH with CHANGEDSINCE and enabled QRESYNC")
+	}
+	if cmd.hasChangedSince || hasItem(cmd.Items, ModSeqMsgAttr) {
+		cmd.ext.enableCondstore(conn)
+	}
+
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok || !cmd.ext.getState(conn).condstore {
+		return cmd.fetch(uid, conn)
+	}
+
+	// Once CONDSTORE is enabled, all FETCH responses contain mod-sequence.
+	if !hasItem(cmd.Items, ModSeqMsgAttr) {
+		cmd.Items = append(cmd.Items, ModSeqMsgAttr)
+	}
+
+	if cmd.hasChangedSince {
+		if cmd.vanished {
+			if err := writeVanished(conn, mbox, cmd.SeqSet, cmd.changedSince); err != nil {
+				return err
+			}
+		}
+		changed, err := changedSinceSet(mbox, uid, cmd.SeqSet, cmd.changedSince)
+		if err != nil || changed.Empty() {
+			return err
+		}
+		cmd.SeqSet = changed
+	}
+
+	return cmd.fetch(uid, conn)
+}
+
+func (cmd *Fetch) fetch(uid bool, conn server.Conn) error {
+	if uid {
+		return cmd.Fetch.UidHandle(conn)
+	}
+	return cmd.Fetch.Handle(conn)
+}
+
+func (cmd *Fetch) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Fetch) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+// Store is a STORE command with UNCHANGEDSINCE modifier.
+type Store struct {
+	server.Store
+
+	unchangedSince    uint64
+	hasUnchangedSince bool
+
+	ext *extension
+}
+
+func (cmd *Store) Parse(fields []interface{}) (err error) {
+	if len(fields) < 4 {
+		return cmd.Store.Parse(fields)
+	}
+	modifiers, ok := fields[1].([]interface{})
+	if !ok {
+		return cmd.Store.Parse(fields)
+	}
+	for i := 0; i < len(modifiers); i++ {
+		name, _ := modifiers[i].(string)
+		if strings.ToUpper(name) != unchangedSince || i+1 >= len(modifiers) {
+			return errors.New("unknown store modifier " + name)
+		}
+		i++
+		if cmd.unchangedSince, err = parseModSeq(modifiers[i]); err != nil {
+			return err
+		}
+		cmd.hasUnchangedSince = true
+	}
+	fields = append([]interface{}{fields[0]}, fields[2:]...)
+	return cmd.Store.Parse(fields)
+}
+
+func (cmd *Store) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return server.ErrMailboxReadOnly
+	}
+
+	if cmd.hasUnchangedSince {
+		cmd.ext.enableCondstore(conn)
+	}
+
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		return cmd.store(uid, conn)
+	}
+
+	modSeqs := map[uint32]uint64{}
+	unchanged := uint64(math.MaxUint64)
+	if cmd.hasUnchangedSince {
+		var err error
+		if modSeqs, err = mbox.ModSeqs(uid, cmd.SeqSet); err != nil {
+			return err
+		}
+		unchanged = cmd.unchangedSince
+	}
+
+	// Mod-sequences are changed before flags of every STORE, so the next
+	// conditional STORE fails even when the change was not applied yet.
+	changed, err := mbox.ChangeModSeqs(uid, cmd.SeqSet, unchanged)
+	if err != nil {
+		return err
+	}
+	unmodified, modified := &imap.SeqSet{}, &imap.SeqSet{}
+	for id := range changed {
+		unmodified.AddNum(id)
+	}
+	for id := range modSeqs {
+		if _, ok := changed[id]; !ok {
+			modified.AddNum(id)
+		}
+	}
+	cmd.SeqSet = unmodified
+
+	if !cmd.SeqSet.Empty() {
+		if err := cmd.store(uid, conn); err != nil {
+			return err
+		}
+		if cmd.ext.getState(conn).condstore {
+			items := []string{ModSeqMsgAttr}
+			if uid {
+				items = append(items, imap.UidMsgAttr)
+			}
+			if err := fetch(conn, mbox, uid, cmd.SeqSet, items); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !modified.Empty() {
+		return server.ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusOk,
+			Code:      codeModified,
+			Arguments: []interface{}{modified},
+			Info:      "Conditional STORE failed",
+		})
+	}
+	return nil
+}
+
+func (cmd *Store) store(uid bool, conn server.Conn) error {
+	if uid {
+		return cmd.Store.UidHandle(conn)
+	}
+	return cmd.Store.Handle(conn)
+}
+
+func (cmd *Store) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Store) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+// Search is a SEARCH command with MODSEQ criterion.
+type Search struct {
+	server.Search
+
+	modSeq    uint64
+	hasModSeq bool
+
+	ext *extension
+}
+
+func (cmd *Search) Parse(fields []interface{}) (err error) {
+	rest := []interface{}{}
+	for i := 0; i < len(fields); i++ {
+		if name, _ := fields[i].(string); strings.ToUpper(name) != ModSeqMsgAttr {
+			rest = append(rest, fields[i])
+			continue
+		}
+		// Optional entry name and entry type precede the value.
+		if i+1 < len(fields) {
+			if _, err := parseModSeq(fields[i+1]); err != nil {
+				i += 2
+			}
+		}
+		i++
+		if i >= len(fields) {
+			return errors.New("missing MODSEQ value")
+		}
+		if cmd.modSeq, err = parseModSeq(fields[i]); err != nil {
+			return err
+		}
+		cmd.hasModSeq = true
+	}
+	if len(rest) == 0 {
+		rest = append(rest, "ALL")
+	}
+	return cmd.Search.Parse(rest)
+}
+
+func (cmd *Search) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !cmd.hasModSeq || !ok {
+		if uid {
+			return cmd.Search.UidHandle(conn)
+		}
+		return cmd.Search.Handle(conn)
+	}
+
+	cmd.ext.enableCondstore(conn)
+
+	ids, err := ctx.Mailbox.SearchMessages(uid, cmd.Criteria)
+	if err != nil {
+		return err
+	}
+	found := &imap.SeqSet{}
+	found.AddNum(ids...)
+	modSeqs := map[uint32]uint64{}
+	if len(ids) > 0 {
+		if modSeqs, err = mbox.ModSeqs(uid, found); err != nil {
+			return err
+		}
+	}
+
+	return conn.WriteResp(newSearchResponse(ids, modSeqs, cmd.modSeq))
+}
+
+func (cmd *Search) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Search) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+// SearchResponse is a SEARCH response with messages matching MODSEQ criterion.
+type SearchResponse struct {
+	Ids []uint32
+
+	// ModSeqs are mod-sequences of found messages.
+	ModSeqs map[uint32]uint64
+}
+
+// newSearchResponse returns SEARCH response with messages changed at least
+// at `modSeq`.
+func newSearchResponse(ids []uint32, modSeqs map[uint32]uint64, modSeq uint64) *SearchResponse {
+	res := &SearchResponse{ModSeqs: map[uint32]uint64{}}
+	for _, id := range ids {
+		if modSeqs[id] < modSeq {
+			continue
+		}
+		res.Ids = append(res.Ids, id)
+		res.ModSeqs[id] = modSeqs[id]
+	}
+	sort.Slice(res.Ids, func(i, j int) bool { return res.Ids[i] < res.Ids[j] })
+	return res
+}
+
+// HighestModSeq returns the highest mod-sequence of messages `ids`.
+func (res *SearchResponse) HighestModSeq(ids ...uint32) uint64 {
+	highest := uint64(0)
+	for _, id := range ids {
+		if res.ModSeqs[id] > highest {
+			highest = res.ModSeqs[id]
+		}
+	}
+	return highest
+}
+
+// WriteTo writes found messages with the highest mod-sequence of them.
+func (res *SearchResponse) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{imap.Search}
+	for _, id := range res.Ids {
+		fields = append(fields, id)
+	}
+	if highest := res.HighestModSeq(res.Ids...); highest > 0 {
+		fields = append(fields, []interface{}{ModSeqMsgAttr, formatNumber(highest)})
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// changedSinceSet returns subset of seqSet with messages changed after modSeq.
+func changedSinceSet(mbox Mailbox, uid bool, seqSet *imap.SeqSet, modSeq uint64) (*imap.SeqSet, error) {
+	modSeqs, err := mbox.ModSeqs(uid, seqSet)
+	if err != nil {
+		return nil, err
+	}
+	changed := &imap.SeqSet{}
+	for id, messageModSeq := range modSeqs {
+		if messageModSeq > modSeq {
+			changed.AddNum(id)
+		}
+	}
+	return changed, nil
+}
+
+// writeVanished sends UIDs from uidSet removed after modSeq.
+func writeVanished(conn server.Conn, mbox Mailbox, uidSet *imap.SeqSet, modSeq uint64) error {
+	expunged, err := mbox.ExpungedSince(modSeq)
+	if err != nil {
+		return err
+	}
+	vanishedSet := &imap.SeqSet{}
+	for _, uid := range expunged {
+		if uidSet.Contains(uid) {
+			vanishedSet.AddNum(uid)
+		}
+	}
+	if vanishedSet.Empty() {
+		return nil
+	}
+	log.WithField("uids", vanishedSet).Debug("Sending vanished messages")
+	return conn.WriteResp(imap.NewUntaggedResp([]interface{}{vanished, []interface{}{earlier}, vanishedSet}))
+}
+
+// fetch sends FETCH responses with the items for messages in seqSet.
+func fetch(conn server.Conn, mbox Mailbox, uid bool, seqSet *imap.SeqSet, items []string) error {
+	ch := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.WriteResp(&responses.Fetch{Messages: ch})
+	}()
+
+	if err := mbox.ListMessages(uid, seqSet, items, ch); err != nil {
+		return err
+	}
+	return <-done
+}
+
+func hasItem(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
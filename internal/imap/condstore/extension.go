@@ -0,0 +1,218 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package condstore DOES NOT implement full RFC7162!
+//
+// Excluded parts are:
+//   - MODSEQ in unsolicited FETCH responses: updates from the backend are sent
+//     to all connections the same way and go-imap cannot add MODSEQ only for
+//     connections with enabled CONDSTORE. Clients get changed messages with
+//     the next `FETCH (CHANGEDSINCE)` instead.
+//   - VANISHED instead of EXPUNGE for unsolicited responses for the same
+//     reason; VANISHED (EARLIER) is sent for SELECT and UID FETCH with QRESYNC.
+//   - MODSEQ search criterion inside of OR and NOT, and per-flag metadata
+//     entries (all entries are treated as `all`).
+//
+// STORE assigns new mod-sequences at once, but flags are changed through the
+// API and the event loop assigns another one when it applies the change. The
+// client gets it with the next `FETCH (CHANGEDSINCE)`; a conditional STORE
+// using the value from the STORE response meanwhile fails with MODIFIED.
+//
+// Otherwise the standard RFC7162 is followed, including ENABLE (RFC5161).
+package condstore
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/server"
+	"github.com/sirupsen/logrus"
+)
+
+// Capabilities of extensions.
+const (
+	Capability        = "CONDSTORE"
+	QResyncCapability = "QRESYNC"
+	EnableCapability  = "ENABLE"
+)
+
+// ModSeqMsgAttr is the FETCH item with mod-sequence of message.
+const ModSeqMsgAttr = "MODSEQ"
+
+// MailboxHighestModSeq is the STATUS item with the highest mod-sequence of mailbox.
+const MailboxHighestModSeq = "HIGHESTMODSEQ"
+
+const (
+	enable            = "ENABLE"
+	enabled           = "ENABLED"
+	vanished          = "VANISHED"
+	earlier           = "EARLIER"
+	changedSince      = "CHANGEDSINCE"
+	unchangedSince    = "UNCHANGEDSINCE"
+	codeHighestModSeq = MailboxHighestModSeq
+	codeNoModSeq      = "NOMODSEQ"
+	codeModified      = "MODIFIED"
+	codeClosed        = "CLOSED"
+)
+
+var log = logrus.WithField("pkg", "imap/condstore") //nolint[gochecknoglobals]
+
+// Mailbox is a backend mailbox which keeps mod-sequences of its messages.
+// Mailboxes not implementing it are reported with NOMODSEQ.
+type Mailbox interface {
+	backend.Mailbox
+
+	// HighestModSeq returns the highest mod-sequence of all changes in the mailbox.
+	HighestModSeq() (uint64, error)
+
+	// ModSeqs returns mod-sequences of messages in seqSet. The set and returned
+	// keys are UIDs if uid is true and sequence numbers otherwise.
+	ModSeqs(uid bool, seqSet *imap.SeqSet) (map[uint32]uint64, error)
+
+	// ChangeModSeqs assigns new mod-sequences to messages in seqSet whose
+	// mod-sequence is not higher than unchangedSince and returns the new
+	// values keyed as by ModSeqs. It is called before flags are changed by
+	// STORE and has to check and change the messages at once.
+	ChangeModSeqs(uid bool, seqSet *imap.SeqSet, unchangedSince uint64) (map[uint32]uint64, error)
+
+	// ExpungedSince returns UIDs of messages removed from the mailbox after
+	// the mod-sequence.
+	ExpungedSince(modSeq uint64) ([]uint32, error)
+}
+
+// connState holds which extensions were enabled by the client.
+type connState struct {
+	condstore bool
+	qresync   bool
+}
+
+type extension struct {
+	lock   sync.Mutex
+	states map[*server.Context]*connState
+}
+
+// NewExtension of CONDSTORE and QRESYNC.
+func NewExtension() server.Extension {
+	return &extension{
+		states: map[*server.Context]*connState{},
+	}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability, QResyncCapability, EnableCapability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	switch name {
+	case enable:
+		return func() server.Handler { return &Enable{ext: ext} }
+	case imap.Select:
+		return func() server.Handler { return &Select{ext: ext} }
+	case imap.Examine:
+		return func() server.Handler {
+			hdlr := &Select{ext: ext}
+			hdlr.ReadOnly = true
+			return hdlr
+		}
+	case imap.Fetch:
+		return func() server.Handler { return &Fetch{ext: ext} }
+	case imap.Store:
+		return func() server.Handler { return &Store{ext: ext} }
+	case imap.Search:
+		return func() server.Handler { return &Search{ext: ext} }
+	}
+	return nil
+}
+
+// NewConn forgets state of the connection once it is closed.
+func (ext *extension) NewConn(c server.Conn) server.Conn {
+	return &conn{Conn: c, ext: ext}
+}
+
+type conn struct {
+	server.Conn
+	ext *extension
+}
+
+func (c *conn) Close() error {
+	c.ext.lock.Lock()
+	delete(c.ext.states, c.Context())
+	c.ext.lock.Unlock()
+	return c.Conn.Close()
+}
+
+// getState returns copy of the state of the connection.
+func (ext *extension) getState(c server.Conn) connState {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+	if state, ok := ext.states[c.Context()]; ok {
+		return *state
+	}
+	return connState{}
+}
+
+func (ext *extension) enableCondstore(c server.Conn) {
+	ext.updateState(c, func(state *connState) { state.condstore = true })
+}
+
+func (ext *extension) enableQResync(c server.Conn) {
+	ext.updateState(c, func(state *connState) {
+		state.condstore = true
+		state.qresync = true
+	})
+}
+
+func (ext *extension) updateState(c server.Conn, update func(*connState)) {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+	state, ok := ext.states[c.Context()]
+	if !ok {
+		state = &connState{}
+		ext.states[c.Context()] = state
+	}
+	update(state)
+}
+
+// FormatModSeq returns the mod-sequence as the value of MODSEQ FETCH item.
+func FormatModSeq(modSeq uint64) interface{} {
+	return []interface{}{formatNumber(modSeq)}
+}
+
+// formatNumber returns 64-bit number as atom, go-imap can write only 32-bit ones.
+func formatNumber(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+func parseModSeq(f interface{}) (uint64, error) {
+	switch v := f.(type) {
+	case uint32:
+		return uint64(v), nil
+	case string:
+		modSeq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid mod-sequence %q", v)
+		}
+		return modSeq, nil
+	}
+	return 0, fmt.Errorf("invalid mod-sequence %v", f)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package condstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModSeq(t *testing.T) {
+	modSeq, err := parseModSeq(uint32(42))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), modSeq)
+
+	modSeq, err = parseModSeq("90060128194045007")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(90060128194045007), modSeq)
+
+	_, err = parseModSeq("abc")
+	assert.Error(t, err)
+
+	_, err = parseModSeq([]interface{}{"1"})
+	assert.Error(t, err)
+}
+
+func TestParseSelectQResync(t *testing.T) {
+	cmd := &Select{}
+	require.NoError(t, cmd.Parse([]interface{}{
+		"INBOX",
+		[]interface{}{"QRESYNC", []interface{}{uint32(67890007), "90060115194045000", "41:211,214:541"}},
+	}))
+	assert.Equal(t, "INBOX", cmd.Mailbox)
+	require.NotNil(t, cmd.qresync)
+	assert.Equal(t, uint32(67890007), cmd.qresync.uidValidity)
+	assert.Equal(t, uint64(90060115194045000), cmd.qresync.modSeq)
+	assert.Equal(t, "41:211,214:541", cmd.qresync.knownUIDs.String())
+
+	cmd = &Select{}
+	require.NoError(t, cmd.Parse([]interface{}{"INBOX", []interface{}{"condstore"}}))
+	assert.True(t, cmd.condstore)
+	assert.Nil(t, cmd.qresync)
+
+	cmd = &Select{}
+	assert.Error(t, cmd.Parse([]interface{}{"INBOX", []interface{}{"QRESYNC"}}))
+}
+
+func TestParseFetchModifiers(t *testing.T) {
+	cmd := &Fetch{}
+	require.NoError(t, cmd.Parse([]interface{}{
+		"1:*",
+		[]interface{}{"FLAGS"},
+		[]interface{}{"CHANGEDSINCE", uint32(12345), "VANISHED"},
+	}))
+	assert.Equal(t, []string{imap.FlagsMsgAttr}, cmd.Items)
+	assert.True(t, cmd.hasChangedSince)
+	assert.Equal(t, uint64(12345), cmd.changedSince)
+	assert.True(t, cmd.vanished)
+
+	cmd = &Fetch{}
+	assert.Error(t, cmd.Parse([]interface{}{"1", "FLAGS", []interface{}{"UNKNOWN"}}))
+}
+
+func TestParseStoreUnchangedSince(t *testing.T) {
+	cmd := &Store{}
+	require.NoError(t, cmd.Parse([]interface{}{
+		"7,9",
+		[]interface{}{"UNCHANGEDSINCE", uint32(320162338)},
+		"+FLAGS.SILENT",
+		[]interface{}{`\Deleted`},
+	}))
+	assert.Equal(t, "7,9", cmd.SeqSet.String())
+	assert.Equal(t, "+FLAGS.SILENT", cmd.Item)
+	assert.True(t, cmd.hasUnchangedSince)
+	assert.Equal(t, uint64(320162338), cmd.unchangedSince)
+
+	cmd = &Store{}
+	require.NoError(t, cmd.Parse([]interface{}{"1", "FLAGS", []interface{}{`\Seen`}}))
+	assert.False(t, cmd.hasUnchangedSince)
+}
+
+func TestParseSearchModSeq(t *testing.T) {
+	cmd := &Search{}
+	require.NoError(t, cmd.Parse([]interface{}{"MODSEQ", `/flags/\draft`, "all", uint32(620162338)}))
+	assert.True(t, cmd.hasModSeq)
+	assert.Equal(t, uint64(620162338), cmd.modSeq)
+
+	cmd = &Search{}
+	require.NoError(t, cmd.Parse([]interface{}{"SEEN", "MODSEQ", "5"}))
+	assert.True(t, cmd.hasModSeq)
+	assert.Equal(t, uint64(5), cmd.modSeq)
+	assert.True(t, cmd.Criteria.Seen)
+}
+
+func TestSearchResponse(t *testing.T) {
+	modSeqs := map[uint32]uint64{2: 10, 5: 3, 7: 12}
+
+	assert.Equal(t, "* SEARCH 2 7 (MODSEQ 12)\r\n", writeResp(t, newSearchResponse([]uint32{7, 5, 2}, modSeqs, 10)))
+	assert.Equal(t, "* SEARCH\r\n", writeResp(t, newSearchResponse([]uint32{5}, modSeqs, 10)))
+}
+
+func TestConnState(t *testing.T) {
+	ext := NewExtension().(*extension)
+	c := &contextConn{ctx: &server.Context{}}
+
+	assert.Equal(t, connState{}, ext.getState(c))
+	ext.enableCondstore(c)
+	assert.Equal(t, connState{condstore: true}, ext.getState(c))
+	ext.enableQResync(c)
+	assert.Equal(t, connState{condstore: true, qresync: true}, ext.getState(c))
+
+	other := &contextConn{ctx: &server.Context{}}
+	assert.Equal(t, connState{}, ext.getState(other))
+}
+
+// contextConn is a connection providing only its context.
+type contextConn struct {
+	server.Conn
+	ctx *server.Context
+}
+
+func (c *contextConn) Context() *server.Context {
+	return c.ctx
+}
+
+func writeResp(t *testing.T, resp imap.WriterTo) string {
+	b := &bytes.Buffer{}
+	w := imap.NewWriter(b)
+	require.NoError(t, resp.WriteTo(w))
+	require.NoError(t, w.Flush())
+	return b.String()
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package esearch
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/condstore"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+)
+
+const (
+	esearch   = "ESEARCH"
+	returnArg = "RETURN"
+	resultRef = "$"
+
+	optionMin   = "MIN"
+	optionMax   = "MAX"
+	optionAll   = "ALL"
+	optionCount = "COUNT"
+	optionSave  = "SAVE"
+)
+
+// missingID replaces empty saved result in search criteria. No message can
+// have such sequence number or UID.
+const missingID = "4294967295"
+
+// stringArgKeys are search keys followed by an argument which is never
+// a sequence set, so `$` there is just a string.
+var stringArgKeys = map[string]bool{ //nolint[gochecknoglobals]
+	"BCC": true, "BEFORE": true, "BODY": true, "CC": true, "CHARSET": true,
+	"FROM": true, "HEADER": true, "KEYWORD": true, "LARGER": true, "ON": true,
+	"SENTBEFORE": true, "SENTON": true, "SENTSINCE": true, "SINCE": true,
+	"SMALLER": true, "SUBJECT": true, "TEXT": true, "TO": true, "UNKEYWORD": true,
+}
+
+// Command is a command accepting `$` in place of sequence set. SEARCH also
+// accepts RETURN options.
+type Command struct {
+	name  string
+	inner server.Handler
+
+	fields       []interface{}
+	hasResultRef bool
+
+	// options of extended SEARCH; nil for the standard one.
+	options map[string]bool
+
+	ext *extension
+}
+
+// Parse is postponed to Handle when `$` is used because the saved result is
+// known only with the connection.
+func (cmd *Command) Parse(fields []interface{}) (err error) {
+	if cmd.name == imap.Search {
+		if fields, err = cmd.parseReturn(fields); err != nil {
+			return err
+		}
+	}
+	cmd.fields = fields
+	if _, cmd.hasResultRef = cmd.replaceResultRef(fields, ""); cmd.hasResultRef {
+		return nil
+	}
+	return cmd.inner.Parse(fields)
+}
+
+func (cmd *Command) parseReturn(fields []interface{}) ([]interface{}, error) {
+	if len(fields) < 2 {
+		return fields, nil
+	}
+	if name, _ := fields[0].(string); strings.ToUpper(name) != returnArg {
+		return fields, nil
+	}
+	options, ok := fields[1].([]interface{})
+	if !ok {
+		return nil, errors.New("RETURN options must be a list")
+	}
+	cmd.options = map[string]bool{}
+	for _, f := range options {
+		option, _ := f.(string)
+		option = strings.ToUpper(option)
+		switch option {
+		case optionMin, optionMax, optionAll, optionCount, optionSave:
+			cmd.options[option] = true
+		default:
+			return nil, errors.New("unsupported RETURN option")
+		}
+	}
+	if len(options) == 0 {
+		cmd.options[optionAll] = true
+	}
+	return fields[2:], nil
+}
+
+// replaceResultRef returns copy of fields with `$` replaced by `set` and
+// whether there was any `$`.
+func (cmd *Command) replaceResultRef(fields []interface{}, set string) ([]interface{}, bool) {
+	if cmd.name != imap.Search {
+		if len(fields) == 0 || fields[0] != resultRef {
+			return fields, false
+		}
+		replaced := append([]interface{}{set}, fields[1:]...)
+		return replaced, true
+	}
+	return replaceSearchResultRef(fields, set)
+}
+
+func replaceSearchResultRef(fields []interface{}, set string) ([]interface{}, bool) {
+	replaced := make([]interface{}, len(fields))
+	found := false
+	for i, f := range fields {
+		replaced[i] = f
+		switch f := f.(type) {
+		case []interface{}:
+			var foundInList bool
+			if replaced[i], foundInList = replaceSearchResultRef(f, set); foundInList {
+				found = true
+			}
+		case string:
+			if f == resultRef && !isStringArg(fields, i) {
+				replaced[i] = set
+				found = true
+			}
+		}
+	}
+	return replaced, found
+}
+
+// isStringArg returns whether fields[i] is an argument of the search key.
+func isStringArg(fields []interface{}, i int) bool {
+	if i >= 1 {
+		if key, _ := fields[i-1].(string); stringArgKeys[strings.ToUpper(key)] {
+			return true
+		}
+	}
+	if i >= 2 {
+		// HEADER has two arguments.
+		if key, _ := fields[i-2].(string); strings.ToUpper(key) == "HEADER" {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmd *Command) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	if cmd.hasResultRef {
+		set, err := cmd.ext.resultSet(conn, uid)
+		if err != nil {
+			return err
+		}
+		if set == "" {
+			// Nothing to do for the empty set apart from searching.
+			if cmd.name != imap.Search {
+				return nil
+			}
+			set = missingID
+		}
+		fields, _ := cmd.replaceResultRef(cmd.fields, set)
+		if err := cmd.inner.Parse(fields); err != nil {
+			return err
+		}
+	}
+
+	if cmd.options == nil {
+		return cmd.handleInner(uid, conn)
+	}
+	return cmd.search(uid, conn)
+}
+
+func (cmd *Command) handleInner(uid bool, conn server.Conn) error {
+	if !uid {
+		return cmd.inner.Handle(conn)
+	}
+	hdlr, ok := cmd.inner.(server.UidHandler)
+	if !ok {
+		return errors.New("command unsupported with UID")
+	}
+	return hdlr.UidHandle(conn)
+}
+
+// search handles extended SEARCH. Found messages are taken from the SEARCH
+// response of the inner handler.
+func (cmd *Command) search(uid bool, conn server.Conn) error {
+	found := &searchConn{Conn: conn}
+	err := cmd.handleInner(uid, found)
+	sort.Slice(found.ids, func(i, j int) bool { return found.ids[i] < found.ids[j] })
+
+	if cmd.options[optionSave] {
+		// Failed SEARCH saves empty result.
+		if err != nil {
+			cmd.ext.forget(conn)
+			return err
+		}
+		if err := cmd.ext.save(conn, uid, cmd.savedIDs(found.ids)); err != nil {
+			return err
+		}
+		if len(cmd.options) == 1 {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(cmd.newResponse(uid, found))
+}
+
+// savedIDs returns IDs to be saved. Only the minimum and maximum are saved when
+// they are the only other options.
+func (cmd *Command) savedIDs(ids []uint32) []uint32 {
+	if len(ids) == 0 || cmd.options[optionAll] || cmd.options[optionCount] ||
+		(!cmd.options[optionMin] && !cmd.options[optionMax]) {
+		return ids
+	}
+	saved := []uint32{}
+	if cmd.options[optionMin] {
+		saved = append(saved, ids[0])
+	}
+	if cmd.options[optionMax] {
+		saved = append(saved, ids[len(ids)-1])
+	}
+	return saved
+}
+
+func (cmd *Command) newResponse(uid bool, found *searchConn) imap.WriterTo {
+	fields := []interface{}{esearch}
+	if uid {
+		fields = append(fields, imap.Uid)
+	}
+
+	ids := found.ids
+	if len(ids) != 0 {
+		if cmd.options[optionMin] {
+			fields = append(fields, optionMin, ids[0])
+		}
+		if cmd.options[optionMax] {
+			fields = append(fields, optionMax, ids[len(ids)-1])
+		}
+		if cmd.options[optionAll] {
+			seqSet := &imap.SeqSet{}
+			seqSet.AddNum(ids...)
+			fields = append(fields, optionAll, seqSet)
+		}
+	}
+	if cmd.options[optionCount] {
+		fields = append(fields, optionCount, uint32(len(ids)))
+	}
+
+	// MODSEQ is known only for searches with MODSEQ criterion.
+	if found.modSeqs != nil {
+		withModSeq := cmd.savedIDs(ids)
+		if highest := found.modSeqs.HighestModSeq(withModSeq...); highest > 0 {
+			fields = append(fields, condstore.ModSeqMsgAttr, strconv.FormatUint(highest, 10))
+		}
+	}
+
+	return imap.NewUntaggedResp(fields)
+}
+
+func (cmd *Command) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Command) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+// searchConn catches SEARCH response instead of sending it to the client.
+type searchConn struct {
+	server.Conn
+
+	ids     []uint32
+	modSeqs *condstore.SearchResponse
+}
+
+func (c *searchConn) WriteResp(res imap.WriterTo) error {
+	switch res := res.(type) {
+	case *responses.Search:
+		c.ids = res.Ids
+		return nil
+	case *condstore.SearchResponse:
+		c.ids = res.Ids
+		c.modSeqs = res
+		return nil
+	}
+	return c.Conn.WriteResp(res)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package esearch implements IMAP ESEARCH (RFC 4731) and SEARCHRES (RFC 5182)
+// extensions.
+//
+// go-imap does not pass the command tag to handlers, therefore ESEARCH
+// responses are sent without the optional search correlator (TAG "...").
+package esearch
+
+import (
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capabilities of extensions.
+const (
+	Capability          = "ESEARCH"
+	SearchResCapability = "SEARCHRES"
+)
+
+const move = "MOVE"
+
+// result is the search result saved by SAVE return option.
+type result struct {
+	mailbox backend.Mailbox
+	uids    *imap.SeqSet
+}
+
+type extension struct {
+	exts []server.Extension
+
+	lock    sync.Mutex
+	results map[*server.Context]*result
+}
+
+// NewExtension of ESEARCH and SEARCHRES. Commands accepting `$` are handled by
+// the first of `exts` overriding them or by go-imap handlers otherwise, so
+// this extension has to be enabled before `exts`.
+func NewExtension(exts ...server.Extension) server.Extension {
+	return &extension{
+		exts:    exts,
+		results: map[*server.Context]*result{},
+	}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability, SearchResCapability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if ext.newInner(name) == nil {
+		return nil
+	}
+	return func() server.Handler {
+		return &Command{name: name, inner: ext.newInner(name), ext: ext}
+	}
+}
+
+// newInner returns handler of the command `name` which would be used without
+// this extension. Nil is returned for commands not accepting `$`.
+func (ext *extension) newInner(name string) server.Handler {
+	switch name {
+	case imap.Search, imap.Fetch, imap.Store, imap.Copy, imap.Expunge, move:
+	default:
+		return nil
+	}
+	for _, other := range ext.exts {
+		if newHandler := other.Command(name); newHandler != nil {
+			return newHandler()
+		}
+	}
+	switch name {
+	case imap.Search:
+		return &server.Search{}
+	case imap.Fetch:
+		return &server.Fetch{}
+	case imap.Store:
+		return &server.Store{}
+	case imap.Copy:
+		return &server.Copy{}
+	case imap.Expunge:
+		return &server.Expunge{}
+	}
+	return nil
+}
+
+// NewConn forgets saved result of the connection once it is closed.
+func (ext *extension) NewConn(c server.Conn) server.Conn {
+	return &conn{Conn: c, ext: ext}
+}
+
+type conn struct {
+	server.Conn
+	ext *extension
+}
+
+func (c *conn) Close() error {
+	c.ext.lock.Lock()
+	delete(c.ext.results, c.Context())
+	c.ext.lock.Unlock()
+	return c.Conn.Close()
+}
+
+// save stores `ids` as the search result of the selected mailbox.
+func (ext *extension) save(c server.Conn, uid bool, ids []uint32) error {
+	ctx := c.Context()
+	uids := &imap.SeqSet{}
+	uids.AddNum(ids...)
+	if !uid && len(ids) != 0 {
+		found, err := ctx.Mailbox.SearchMessages(true, &imap.SearchCriteria{SeqSet: uids})
+		if err != nil {
+			ext.forget(c)
+			return err
+		}
+		uids = &imap.SeqSet{}
+		uids.AddNum(found...)
+	}
+
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+	ext.results[ctx] = &result{mailbox: ctx.Mailbox, uids: uids}
+	return nil
+}
+
+func (ext *extension) forget(c server.Conn) {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+	delete(ext.results, c.Context())
+}
+
+// resultSet returns the saved result as sequence set of UIDs or sequence
+// numbers. Empty string is returned for empty result or when there is no saved
+// result for the selected mailbox.
+func (ext *extension) resultSet(c server.Conn, uid bool) (string, error) {
+	ctx := c.Context()
+
+	ext.lock.Lock()
+	saved := ext.results[ctx]
+	ext.lock.Unlock()
+
+	if saved == nil || saved.mailbox != ctx.Mailbox || saved.uids.Empty() {
+		return "", nil
+	}
+	if uid {
+		return saved.uids.String(), nil
+	}
+
+	seqNums, err := ctx.Mailbox.SearchMessages(false, &imap.SearchCriteria{Uid: saved.uids})
+	if err != nil || len(seqNums) == 0 {
+		return "", err
+	}
+	seqSet := &imap.SeqSet{}
+	seqSet.AddNum(seqNums...)
+	return seqSet.String(), nil
+}
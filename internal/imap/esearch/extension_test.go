@@ -0,0 +1,156 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package esearch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/condstore"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceResultRef(t *testing.T) {
+	fetch := &Command{name: imap.Fetch}
+	fields, found := fetch.replaceResultRef([]interface{}{"$", "FLAGS"}, "1:3")
+	assert.True(t, found)
+	assert.Equal(t, []interface{}{"1:3", "FLAGS"}, fields)
+
+	_, found = fetch.replaceResultRef([]interface{}{"1", "$"}, "1:3")
+	assert.False(t, found)
+
+	search := &Command{name: imap.Search}
+	fields, found = search.replaceResultRef([]interface{}{
+		"$", "SUBJECT", "$", "HEADER", "X-A", "$", "OR", []interface{}{"UID", "$"}, "NOT", "$",
+	}, "1:3")
+	assert.True(t, found)
+	assert.Equal(t, []interface{}{
+		"1:3", "SUBJECT", "$", "HEADER", "X-A", "$", "OR", []interface{}{"UID", "1:3"}, "NOT", "1:3",
+	}, fields)
+
+	_, found = search.replaceResultRef([]interface{}{"TEXT", "$"}, "1:3")
+	assert.False(t, found)
+}
+
+func TestParseReturn(t *testing.T) {
+	cmd := &Command{name: imap.Search, inner: &server.Search{}}
+	require.NoError(t, cmd.Parse([]interface{}{"RETURN", []interface{}{}, "ALL"}))
+	assert.Equal(t, map[string]bool{optionAll: true}, cmd.options)
+
+	cmd = &Command{name: imap.Search, inner: &server.Search{}}
+	require.NoError(t, cmd.Parse([]interface{}{"RETURN", []interface{}{"min", "SAVE"}, "SEEN"}))
+	assert.Equal(t, map[string]bool{optionMin: true, optionSave: true}, cmd.options)
+
+	cmd = &Command{name: imap.Search, inner: &server.Search{}}
+	require.Error(t, cmd.Parse([]interface{}{"RETURN", []interface{}{"PARTIAL"}, "ALL"}))
+}
+
+func TestNewResponse(t *testing.T) {
+	found := &searchConn{
+		ids:     []uint32{2, 5, 7},
+		modSeqs: &condstore.SearchResponse{Ids: []uint32{2, 5, 7}, ModSeqs: map[uint32]uint64{2: 4, 5: 9, 7: 6}},
+	}
+
+	cmd := &Command{options: map[string]bool{optionMin: true, optionMax: true}}
+	assert.Equal(t, "* ESEARCH UID MIN 2 MAX 7 MODSEQ 6\r\n", writeResp(t, cmd.newResponse(true, found)))
+
+	cmd = &Command{options: map[string]bool{optionAll: true, optionCount: true}}
+	assert.Equal(t, "* ESEARCH ALL 2,5,7 COUNT 3 MODSEQ 9\r\n", writeResp(t, cmd.newResponse(false, found)))
+
+	assert.Equal(t, "* ESEARCH COUNT 0\r\n", writeResp(t, cmd.newResponse(false, &searchConn{})))
+}
+
+func TestExtendedSearch(t *testing.T) {
+	// Messages are added directly, go-imap writing continuation requests
+	// for APPEND literals from other goroutine is racy.
+	be := memory.New()
+	user, err := be.Login("username", "password")
+	require.NoError(t, err)
+	inbox, err := user.GetMailbox("INBOX")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, inbox.(*memory.Mailbox).CreateMessage(nil, time.Time{}, bytes.NewBufferString("Hi")))
+	}
+
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	s.Enable(NewExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// Only the listener is closed, go-imap closing connections from other
+	// goroutine is racy.
+	go s.Serve(l)   //nolint[errcheck]
+	defer l.Close() //nolint[errcheck]
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c.Close() //nolint[errcheck]
+
+	r := bufio.NewReader(c)
+	readUntilTag(t, r, "*")
+	send(t, c, "a LOGIN username password")
+	readUntilTag(t, r, "a OK")
+	send(t, c, "c SELECT INBOX")
+	readUntilTag(t, r, "c OK")
+
+	send(t, c, "d SEARCH RETURN (MIN MAX COUNT) ALL")
+	assert.Equal(t, "* ESEARCH MIN 1 MAX 3 COUNT 3\r\nd OK SEARCH completed\r\n", readUntilTag(t, r, "d "))
+
+	send(t, c, "e UID SEARCH RETURN () ALL")
+	assert.Equal(t, "* ESEARCH UID ALL 6:8\r\ne OK UID SEARCH completed\r\n", readUntilTag(t, r, "e "))
+
+	// Nothing is saved yet.
+	send(t, c, "f FETCH $ (UID)")
+	assert.Equal(t, "f OK FETCH completed\r\n", readUntilTag(t, r, "f "))
+}
+
+func writeResp(t *testing.T, res imap.WriterTo) string {
+	b := &strings.Builder{}
+	w := imap.NewWriter(b)
+	require.NoError(t, res.WriteTo(w))
+	require.NoError(t, w.Flush())
+	return b.String()
+}
+
+func send(t *testing.T, c net.Conn, format string, args ...interface{}) {
+	_, err := fmt.Fprintf(c, format+"\r\n", args...)
+	require.NoError(t, err)
+}
+
+// readUntilTag returns all lines up to the one starting with the prefix.
+func readUntilTag(t *testing.T, r *bufio.Reader, prefix string) string {
+	lines := ""
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		lines += line
+		if strings.HasPrefix(line, prefix) {
+			return lines
+		}
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package listextended implements IMAP LIST-EXTENDED (RFC 5258) and
+// LIST-STATUS (RFC 5819) extensions. Thanks to LIST-STATUS clients can get
+// counts of all mailboxes by one command instead of STATUS for each of them.
+package listextended
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	specialuse "github.com/emersion/go-imap-specialuse"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// Capabilities of extensions.
+const (
+	Capability       = "LIST-EXTENDED"
+	StatusCapability = "LIST-STATUS"
+)
+
+// Selection options.
+const (
+	SelectSubscribed     = "SUBSCRIBED"
+	SelectRemote         = "REMOTE"
+	SelectRecursiveMatch = "RECURSIVEMATCH"
+	SelectSpecialUse     = "SPECIAL-USE"
+)
+
+// Return options.
+const (
+	ReturnSubscribed = "SUBSCRIBED"
+	ReturnChildren   = "CHILDREN"
+	ReturnSpecialUse = "SPECIAL-USE"
+	ReturnStatus     = "STATUS"
+)
+
+// Mailbox attributes returned on request.
+const (
+	SubscribedAttr    = "\\Subscribed"
+	HasChildrenAttr   = "\\HasChildren"
+	HasNoChildrenAttr = "\\HasNoChildren"
+)
+
+const (
+	list      = "LIST"
+	returnArg = "RETURN"
+	childInfo = "CHILDINFO"
+)
+
+var specialUseAttrs = map[string]bool{ //nolint[gochecknoglobals]
+	specialuse.All:     true,
+	specialuse.Archive: true,
+	specialuse.Drafts:  true,
+	specialuse.Flagged: true,
+	specialuse.Junk:    true,
+	specialuse.Sent:    true,
+	specialuse.Trash:   true,
+}
+
+// List is a LIST command with optional selection and return options.
+type List struct {
+	Reference string
+	Patterns  []string
+
+	SelectSubscribed     bool
+	SelectRecursiveMatch bool
+	SelectSpecialUse     bool
+
+	ReturnSubscribed bool
+	ReturnChildren   bool
+	ReturnSpecialUse bool
+
+	// StatusItems are items of STATUS response sent for each listed mailbox.
+	// No STATUS response is sent when empty.
+	StatusItems []string
+}
+
+func (cmd *List) Parse(fields []interface{}) error {
+	if len(fields) > 0 {
+		if options, ok := fields[0].([]interface{}); ok {
+			if err := cmd.parseSelectionOptions(options); err != nil {
+				return err
+			}
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) < 2 {
+		return errors.New("no enough arguments")
+	}
+
+	reference, ok := fields[0].(string)
+	if !ok {
+		return errors.New("reference name must be a string")
+	}
+	var err error
+	if cmd.Reference, err = decodeMailboxName(reference); err != nil {
+		return err
+	}
+
+	var patterns []interface{}
+	switch pattern := fields[1].(type) {
+	case string:
+		patterns = []interface{}{pattern}
+	case []interface{}:
+		patterns = pattern
+	default:
+		return errors.New("mailbox name must be a string or a list")
+	}
+	if len(patterns) == 0 {
+		return errors.New("mailbox pattern list is empty")
+	}
+	for _, v := range patterns {
+		pattern, ok := v.(string)
+		if !ok {
+			return errors.New("mailbox name must be a string")
+		}
+		if pattern, err = decodeMailboxName(pattern); err != nil {
+			return err
+		}
+		cmd.Patterns = append(cmd.Patterns, pattern)
+	}
+
+	fields = fields[2:]
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) != 2 {
+		return errors.New("unexpected arguments")
+	}
+	if name, ok := fields[0].(string); !ok || strings.ToUpper(name) != returnArg {
+		return errors.New("expected return options")
+	}
+	options, ok := fields[1].([]interface{})
+	if !ok {
+		return errors.New("return options must be a list")
+	}
+	return cmd.parseReturnOptions(options)
+}
+
+func (cmd *List) parseSelectionOptions(options []interface{}) error {
+	for _, v := range options {
+		option, ok := v.(string)
+		if !ok {
+			return errors.New("selection option must be a string")
+		}
+		switch strings.ToUpper(option) {
+		case SelectSubscribed:
+			cmd.SelectSubscribed = true
+			cmd.ReturnSubscribed = true
+		case SelectRemote:
+			// All mailboxes are remote.
+		case SelectRecursiveMatch:
+			cmd.SelectRecursiveMatch = true
+		case SelectSpecialUse:
+			cmd.SelectSpecialUse = true
+			cmd.ReturnSpecialUse = true
+		default:
+			return errors.New("unknown selection option " + option)
+		}
+	}
+	if cmd.SelectRecursiveMatch && !cmd.SelectSubscribed && !cmd.SelectSpecialUse {
+		return errors.New("RECURSIVEMATCH must be combined with other selection option")
+	}
+	return nil
+}
+
+func (cmd *List) parseReturnOptions(options []interface{}) error {
+	for i := 0; i < len(options); i++ {
+		option, ok := options[i].(string)
+		if !ok {
+			return errors.New("return option must be a string")
+		}
+		switch strings.ToUpper(option) {
+		case ReturnSubscribed:
+			cmd.ReturnSubscribed = true
+		case ReturnChildren:
+			cmd.ReturnChildren = true
+		case ReturnSpecialUse:
+			cmd.ReturnSpecialUse = true
+		case ReturnStatus:
+			i++
+			if i == len(options) {
+				return errors.New("missing status items")
+			}
+			items, ok := options[i].([]interface{})
+			if !ok || len(items) == 0 {
+				return errors.New("status items must be a non-empty list")
+			}
+			for _, v := range items {
+				item, _ := v.(string)
+				cmd.StatusItems = append(cmd.StatusItems, strings.ToUpper(item))
+			}
+		default:
+			return errors.New("unknown return option " + option)
+		}
+	}
+	return nil
+}
+
+func decodeMailboxName(name string) (string, error) {
+	name, err := utf7.Decoder.String(name)
+	if err != nil {
+		return "", err
+	}
+	return imap.CanonicalMailboxName(name), nil
+}
+
+type listedMailbox struct {
+	mbox       backend.Mailbox
+	info       *imap.MailboxInfo
+	subscribed bool
+}
+
+func (cmd *List) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	mailboxes, err := listMailboxes(ctx.User)
+	if err != nil {
+		return err
+	}
+
+	// An empty mailbox name is the special request for the hierarchy delimiter.
+	if len(cmd.Patterns) == 1 && cmd.Patterns[0] == "" {
+		if len(mailboxes) == 0 {
+			return nil
+		}
+		info := &imap.MailboxInfo{
+			Attributes: []string{imap.NoSelectAttr},
+			Delimiter:  mailboxes[0].info.Delimiter,
+			Name:       mailboxes[0].info.Delimiter,
+		}
+		return conn.WriteResp(newListResp(info, nil))
+	}
+
+	for _, mailbox := range mailboxes {
+		if !cmd.match(mailbox.info) {
+			continue
+		}
+
+		selected := cmd.isSelected(mailbox)
+		var extended []interface{}
+		if cmd.SelectRecursiveMatch && cmd.SelectSubscribed && hasSubscribedChild(mailbox, mailboxes) {
+			extended = []interface{}{imap.Quoted(childInfo), []interface{}{imap.Quoted(SelectSubscribed)}}
+		}
+		if !selected && extended == nil {
+			continue
+		}
+
+		info := &imap.MailboxInfo{
+			Attributes: cmd.attributes(mailbox, mailboxes),
+			Delimiter:  mailbox.info.Delimiter,
+			Name:       mailbox.info.Name,
+		}
+		if err := conn.WriteResp(newListResp(info, extended)); err != nil {
+			return err
+		}
+
+		if selected && len(cmd.StatusItems) != 0 && !hasAttr(mailbox.info, imap.NoSelectAttr) {
+			if err := cmd.writeStatus(conn, mailbox.mbox); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (cmd *List) writeStatus(conn server.Conn, mbox backend.Mailbox) error {
+	status, err := mbox.Status(cmd.StatusItems)
+	if err != nil {
+		return err
+	}
+
+	// Only keep items that have been requested.
+	items := make(map[string]interface{})
+	for _, k := range cmd.StatusItems {
+		items[k] = status.Items[k]
+	}
+	status.Items = items
+
+	return conn.WriteResp(&responses.Status{Mailbox: status})
+}
+
+func (cmd *List) match(info *imap.MailboxInfo) bool {
+	for _, pattern := range cmd.Patterns {
+		if info.Match(cmd.Reference, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmd *List) isSelected(mailbox *listedMailbox) bool {
+	if cmd.SelectSubscribed && !mailbox.subscribed {
+		return false
+	}
+	if cmd.SelectSpecialUse && !hasSpecialUseAttr(mailbox.info) {
+		return false
+	}
+	return true
+}
+
+// attributes returns attributes of the mailbox extended by the ones requested
+// by return options.
+func (cmd *List) attributes(mailbox *listedMailbox, mailboxes []*listedMailbox) []string {
+	// Special-use attributes are returned always, as for plain LIST.
+	attributes := append([]string{}, mailbox.info.Attributes...)
+	if cmd.ReturnSubscribed && mailbox.subscribed {
+		attributes = append(attributes, SubscribedAttr)
+	}
+	if cmd.ReturnChildren && !hasAttr(mailbox.info, imap.NoInferiorsAttr) {
+		if hasChild(mailbox, mailboxes, false) {
+			attributes = append(attributes, HasChildrenAttr)
+		} else {
+			attributes = append(attributes, HasNoChildrenAttr)
+		}
+	}
+	return attributes
+}
+
+func listMailboxes(user backend.User) ([]*listedMailbox, error) {
+	subscribedMailboxes, err := user.ListMailboxes(true)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := map[string]bool{}
+	for _, mbox := range subscribedMailboxes {
+		subscribed[mbox.Name()] = true
+	}
+
+	mailboxes, err := user.ListMailboxes(false)
+	if err != nil {
+		return nil, err
+	}
+	listed := []*listedMailbox{}
+	for _, mbox := range mailboxes {
+		info, err := mbox.Info()
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, &listedMailbox{
+			mbox:       mbox,
+			info:       info,
+			subscribed: subscribed[info.Name],
+		})
+	}
+	return listed, nil
+}
+
+func hasSubscribedChild(mailbox *listedMailbox, mailboxes []*listedMailbox) bool {
+	return hasChild(mailbox, mailboxes, true)
+}
+
+func hasChild(mailbox *listedMailbox, mailboxes []*listedMailbox, onlySubscribed bool) bool {
+	prefix := mailbox.info.Name + mailbox.info.Delimiter
+	for _, other := range mailboxes {
+		if onlySubscribed && !other.subscribed {
+			continue
+		}
+		if strings.HasPrefix(other.info.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(info *imap.MailboxInfo, attr string) bool {
+	for _, a := range info.Attributes {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSpecialUseAttr(info *imap.MailboxInfo) bool {
+	for _, attr := range info.Attributes {
+		if specialUseAttrs[attr] {
+			return true
+		}
+	}
+	return false
+}
+
+func newListResp(info *imap.MailboxInfo, extended []interface{}) *imap.Resp {
+	fields := append([]interface{}{list}, info.Format()...)
+	if extended != nil {
+		fields = append(fields, extended)
+	}
+	return imap.NewUntaggedResp(fields)
+}
+
+type extension struct{}
+
+// NewExtension of LIST-EXTENDED and LIST-STATUS.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability, StatusCapability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != list {
+		return nil
+	}
+	return func() server.Handler {
+		return &List{}
+	}
+}
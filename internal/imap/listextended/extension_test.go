@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package listextended
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap"
+	specialuse "github.com/emersion/go-imap-specialuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlainList(t *testing.T) {
+	cmd := &List{}
+	require.NoError(t, cmd.Parse([]interface{}{"", "*"}))
+	assert.Equal(t, &List{Reference: "", Patterns: []string{"*"}}, cmd)
+}
+
+func TestParseExtendedList(t *testing.T) {
+	cmd := &List{}
+	require.NoError(t, cmd.Parse([]interface{}{
+		[]interface{}{"subscribed", "RECURSIVEMATCH"},
+		"",
+		[]interface{}{"INBOX", "Folders/*"},
+		"RETURN",
+		[]interface{}{"CHILDREN", "STATUS", []interface{}{"messages", "UNSEEN"}},
+	}))
+	assert.Equal(t, &List{
+		Reference:            "",
+		Patterns:             []string{"INBOX", "Folders/*"},
+		SelectSubscribed:     true,
+		SelectRecursiveMatch: true,
+		ReturnSubscribed:     true,
+		ReturnChildren:       true,
+		StatusItems:          []string{imap.MailboxMessages, imap.MailboxUnseen},
+	}, cmd)
+}
+
+func TestParseInvalidList(t *testing.T) {
+	tests := [][]interface{}{
+		{""},
+		{[]interface{}{"RECURSIVEMATCH"}, "", "*"},
+		{[]interface{}{"UNKNOWN"}, "", "*"},
+		{"", []interface{}{}},
+		{"", "*", "RETURN"},
+		{"", "*", "OTHER", []interface{}{}},
+		{"", "*", "RETURN", []interface{}{"STATUS"}},
+		{"", "*", "RETURN", []interface{}{"STATUS", []interface{}{}}},
+	}
+	for _, fields := range tests {
+		assert.Error(t, (&List{}).Parse(fields), fields)
+	}
+}
+
+func newListedMailbox(name string, subscribed bool, attributes ...string) *listedMailbox {
+	return &listedMailbox{
+		info: &imap.MailboxInfo{
+			Attributes: attributes,
+			Delimiter:  "/",
+			Name:       name,
+		},
+		subscribed: subscribed,
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	inbox := newListedMailbox(imap.InboxName, true, imap.NoInferiorsAttr)
+	sent := newListedMailbox("Sent", false, imap.NoInferiorsAttr, specialuse.Sent)
+	folders := newListedMailbox("Folders", true, imap.NoSelectAttr)
+	folder := newListedMailbox("Folders/a", true)
+	labels := newListedMailbox("Labels", true, imap.NoSelectAttr)
+	mailboxes := []*listedMailbox{inbox, sent, folders, folder, labels}
+
+	cmd := &List{ReturnSubscribed: true, ReturnChildren: true}
+	assert.Equal(t, []string{imap.NoInferiorsAttr, SubscribedAttr}, cmd.attributes(inbox, mailboxes))
+	assert.Equal(t, []string{imap.NoInferiorsAttr, specialuse.Sent}, cmd.attributes(sent, mailboxes))
+	assert.Equal(t, []string{imap.NoSelectAttr, SubscribedAttr, HasChildrenAttr}, cmd.attributes(folders, mailboxes))
+	assert.Equal(t, []string{SubscribedAttr, HasNoChildrenAttr}, cmd.attributes(folder, mailboxes))
+	assert.Equal(t, []string{imap.NoSelectAttr, SubscribedAttr, HasNoChildrenAttr}, cmd.attributes(labels, mailboxes))
+
+	cmd = &List{}
+	assert.Equal(t, []string{imap.NoInferiorsAttr}, cmd.attributes(inbox, mailboxes))
+}
+
+func TestIsSelected(t *testing.T) {
+	inbox := newListedMailbox(imap.InboxName, true, imap.NoInferiorsAttr)
+	sent := newListedMailbox("Sent", false, imap.NoInferiorsAttr, specialuse.Sent)
+
+	assert.True(t, (&List{}).isSelected(inbox))
+	assert.True(t, (&List{SelectSubscribed: true}).isSelected(inbox))
+	assert.False(t, (&List{SelectSubscribed: true}).isSelected(sent))
+	assert.False(t, (&List{SelectSpecialUse: true}).isSelected(inbox))
+	assert.True(t, (&List{SelectSpecialUse: true}).isSelected(sent))
+}
+
+func TestHasSubscribedChild(t *testing.T) {
+	folders := newListedMailbox("Folders", false, imap.NoSelectAttr)
+	folder := newListedMailbox("Folders/a", true)
+	labels := newListedMailbox("Labels", false, imap.NoSelectAttr)
+	label := newListedMailbox("Labels/a", false)
+	mailboxes := []*listedMailbox{folders, folder, labels, label}
+
+	assert.True(t, hasSubscribedChild(folders, mailboxes))
+	assert.False(t, hasSubscribedChild(labels, mailboxes))
+	assert.False(t, hasSubscribedChild(folder, mailboxes))
+}
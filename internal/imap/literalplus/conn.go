@@ -0,0 +1,254 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package literalplus
+
+import (
+	"bytes"
+	"net"
+	"sync"
+)
+
+// maxLiteralSize protects the size from overflow; go-imap cannot read bigger
+// literal anyway.
+const maxLiteralSize = 1 << 32
+
+// continuation is the continuation request sent by go-imap for each literal.
+var continuation = []byte("+ send literal\r\n") //nolint[gochecknoglobals]
+
+type readState int
+
+const (
+	stateNormal readState = iota
+	stateQuoted
+	stateQuotedEscape
+	stateLiteralOpen
+	stateLiteralSize
+	stateLiteralPlus
+	stateLiteralClose
+	stateLiteralCR
+	stateLiteralData
+	stateTilde
+)
+
+// literalConn removes `+` from non-synchronizing literals `{123+}` read from
+// the client and drops continuation request which go-imap sends for them.
+// Literal8 `~{123}` (RFC 3516) read from the client is changed to normal
+// literal as well and literals sent as BINARY FETCH items are changed to
+// literal8, see binaryWriter.
+type literalConn struct {
+	net.Conn
+
+	lock sync.Mutex
+
+	state     readState
+	size      int64
+	nonSync   bool
+	remaining int64
+
+	// pending is number of continuation requests to drop.
+	pending int
+
+	out binaryWriter
+}
+
+func newLiteralConn(c net.Conn) *literalConn {
+	return &literalConn{Conn: c}
+}
+
+func (c *literalConn) current() net.Conn {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.Conn
+}
+
+func (c *literalConn) replace(conn net.Conn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Conn = conn
+}
+
+func (c *literalConn) Read(b []byte) (int, error) {
+	c.lock.Lock()
+	conn := c.Conn
+	// Tilde held back by the previous read is written before the new data
+	// when it does not start literal8, so one byte has to be kept free.
+	start := 0
+	if c.state == stateTilde {
+		if len(b) < 2 {
+			c.state = stateNormal
+			c.lock.Unlock()
+			b[0] = '~'
+			return 1, nil
+		}
+		start = 1
+	}
+	c.lock.Unlock()
+
+	n, err := conn.Read(b[start:])
+	if n > 0 {
+		c.lock.Lock()
+		n = c.rewrite(b[:start+n], start)
+		c.lock.Unlock()
+	}
+	return n, err
+}
+
+func (c *literalConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	conn := c.Conn
+	drop := c.pending > 0 && bytes.HasPrefix(b, continuation)
+	if drop {
+		c.pending--
+	}
+	c.lock.Unlock()
+
+	rest := b
+	if drop {
+		rest = b[len(continuation):]
+	}
+	if len(rest) == 0 {
+		return len(b), nil
+	}
+
+	c.lock.Lock()
+	rest = c.out.rewrite(rest)
+	c.lock.Unlock()
+
+	if _, err := conn.Write(rest); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush is required by go-imap to flush connection below, e.g. compression.
+func (c *literalConn) Flush() error {
+	if f, ok := c.current().(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// rewrite removes `+` of non-synchronizing literals and `~` of literal8 from
+// `b` in place and returns the new length. Data of `b` start at `start`, the
+// bytes before are free for the tilde held back by the previous call.
+// Literal data and quoted strings are skipped.
+func (c *literalConn) rewrite(b []byte, start int) int { //nolint[gocyclo,funlen]
+	w := 0
+	for i := start; i < len(b); i++ {
+		if c.state == stateLiteralData {
+			n := int64(len(b) - i)
+			if n > c.remaining {
+				n = c.remaining
+			}
+			w += copy(b[w:], b[i:i+int(n)])
+			i += int(n) - 1
+			if c.remaining -= n; c.remaining == 0 {
+				c.state = stateNormal
+			}
+			continue
+		}
+
+		ch := b[i]
+		if c.state == stateTilde {
+			c.state = stateNormal
+			if ch != '{' {
+				b[w] = '~'
+				w++
+			}
+		}
+
+		switch c.state {
+		case stateQuoted:
+			switch ch {
+			case '\\':
+				c.state = stateQuotedEscape
+			case '"', '\n':
+				c.state = stateNormal
+			}
+		case stateQuotedEscape:
+			c.state = stateQuoted
+		case stateLiteralOpen, stateLiteralSize:
+			switch {
+			case ch >= '0' && ch <= '9' && c.size < maxLiteralSize:
+				c.size = c.size*10 + int64(ch-'0')
+				c.state = stateLiteralSize
+			case ch == '+' && c.state == stateLiteralSize:
+				c.nonSync = true
+				c.state = stateLiteralPlus
+				continue
+			case ch == '}' && c.state == stateLiteralSize:
+				c.state = stateLiteralClose
+			default:
+				c.normal(ch)
+			}
+		case stateLiteralPlus:
+			if ch == '}' {
+				c.state = stateLiteralClose
+			} else {
+				c.normal(ch)
+			}
+		case stateLiteralClose:
+			if ch == '\r' {
+				c.state = stateLiteralCR
+			} else {
+				c.normal(ch)
+			}
+		case stateLiteralCR:
+			if ch == '\n' {
+				c.startLiteral()
+			} else {
+				c.normal(ch)
+			}
+		default:
+			if ch == '~' {
+				c.state = stateTilde
+				continue
+			}
+			c.normal(ch)
+		}
+
+		b[w] = ch
+		w++
+	}
+	return w
+}
+
+// normal processes character outside of any string.
+func (c *literalConn) normal(ch byte) {
+	switch ch {
+	case '"':
+		c.state = stateQuoted
+	case '{':
+		c.state = stateLiteralOpen
+		c.size = 0
+		c.nonSync = false
+	default:
+		c.state = stateNormal
+	}
+}
+
+func (c *literalConn) startLiteral() {
+	if c.nonSync {
+		c.pending++
+	}
+	c.state = stateNormal
+	if c.size > 0 {
+		c.state = stateLiteralData
+		c.remaining = c.size
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package literalplus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		in, want string
+		pending  int
+	}{
+		{"a LOGIN user pass\r\n", "a LOGIN user pass\r\n", 0},
+		{"a LOGIN {4}\r\nuser {4}\r\npass\r\n", "a LOGIN {4}\r\nuser {4}\r\npass\r\n", 0},
+		{"a LOGIN {4+}\r\nuser {4+}\r\npass\r\n", "a LOGIN {4}\r\nuser {4}\r\npass\r\n", 2},
+		{"a APPEND INBOX {0+}\r\n\r\n", "a APPEND INBOX {0}\r\n\r\n", 1},
+		{"a APPEND INBOX {7+}\r\n{1+}\r\nx\r\n", "a APPEND INBOX {7}\r\n{1+}\r\nx\r\n", 1},
+		{"a LOGIN \"{4+}\r\n\" \"\\\"{4+}\r\n\"\r\n", "a LOGIN \"{4+}\r\n\" \"\\\"{4+}\r\n\"\r\n", 0},
+		{"a SEARCH {2+}x\r\n", "a SEARCH {2}x\r\n", 0},
+		{"a APPEND INBOX ~{2}\r\n\x00~\r\n", "a APPEND INBOX {2}\r\n\x00~\r\n", 0},
+		{"a APPEND INBOX ~{2+}\r\n~{\r\n", "a APPEND INBOX {2}\r\n~{\r\n", 1},
+		{"a SELECT ~user \"~{\"\r\n", "a SELECT ~user \"~{\"\r\n", 0},
+		{"a SELECT ~~\r\n", "a SELECT ~~\r\n", 0},
+	}
+
+	for _, test := range tests {
+		c := newLiteralConn(nil)
+		b := []byte(test.in)
+		assert.Equal(t, test.want, string(b[:c.rewrite(b, 0)]), test.in)
+		assert.Equal(t, test.pending, c.pending, test.in)
+
+		// The same byte by byte, as if each character came in separate read.
+		c = newLiteralConn(nil)
+		got := ""
+		for i := range test.in {
+			// One byte is kept free for held tilde as Read does.
+			b := []byte{0, test.in[i]}
+			got += string(b[:c.rewrite(b, 1)])
+		}
+		assert.Equal(t, test.want, got, test.in)
+		assert.Equal(t, test.pending, c.pending, test.in)
+	}
+}
+
+func TestRewriteBinaryLiterals(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"* 1 FETCH (UID 1)\r\n", "* 1 FETCH (UID 1)\r\n"},
+		{"* 1 FETCH (BINARY[1] {2}\r\n\x00{\r\n", "* 1 FETCH (BINARY[1] ~{2}\r\n\x00{\r\n"},
+		{"* 1 FETCH (UID 1 BINARY[1.2]<0> {1}\r\nx)\r\n", "* 1 FETCH (UID 1 BINARY[1.2]<0> ~{1}\r\nx)\r\n"},
+		{"* 1 FETCH (BODY[] {11}\r\nBINARY[] {1} BINARY.SIZE[1] 5)\r\n", "* 1 FETCH (BODY[] {11}\r\nBINARY[] {1} BINARY.SIZE[1] 5)\r\n"},
+		{"* 1 FETCH (ENVELOPE (\"BINARY[1] {1}\"))\r\n", "* 1 FETCH (ENVELOPE (\"BINARY[1] {1}\"))\r\n"},
+	}
+
+	for _, test := range tests {
+		w := &binaryWriter{}
+		assert.Equal(t, test.want, string(w.rewrite([]byte(test.in))), test.in)
+
+		// The same byte by byte, as if each character came in separate write.
+		w = &binaryWriter{}
+		got := ""
+		for i := range test.in {
+			got += string(w.rewrite([]byte{test.in[i]}))
+		}
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package literalplus implements IMAP LITERAL+ extension as defined in RFC 7888.
+//
+// go-imap asks for every literal by continuation request. Non-synchronizing
+// literals of the client are therefore rewritten to the synchronizing ones
+// before go-imap reads them and continuation requests for them are dropped
+// before they reach the client. Clients supporting only LITERAL- understand
+// LITERAL+ as well; the server accepts non-synchronizing literal of any size.
+//
+// Literal8 of BINARY extension (RFC 3516) is rewritten the same way: `~` is
+// removed from literals of the client and added to the literals which the
+// server sends for BINARY FETCH items.
+package literalplus
+
+import (
+	"net"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "LITERAL+"
+
+const startTLS = "STARTTLS"
+
+type extension struct{}
+
+// NewExtension of LITERAL+.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	return []string{Capability}
+}
+
+// Command overrides STARTTLS to keep the literal rewriting above TLS.
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != startTLS {
+		return nil
+	}
+	return func() server.Handler {
+		return &StartTLS{}
+	}
+}
+
+// NewConn wraps the network connection of new IMAP connection. Nothing is
+// read or written yet so it is safe to upgrade the connection right away.
+func (ext *extension) NewConn(c server.Conn) server.Conn {
+	_ = c.Upgrade(func(conn net.Conn) (net.Conn, error) {
+		return newLiteralConn(conn), nil
+	})
+	return c
+}
+
+// Upgrader returns upgrader which applies `upgrader` below the literal
+// rewriting. Everything which changes the stream of the connection (TLS,
+// compression) has to upgrade the connection through it, otherwise
+// the rewriting would work with encrypted or compressed data.
+func Upgrader(upgrader imap.ConnUpgrader) imap.ConnUpgrader {
+	return func(c net.Conn) (net.Conn, error) {
+		lc, ok := c.(*literalConn)
+		if !ok {
+			return upgrader(c)
+		}
+		upgraded, err := upgrader(lc.current())
+		if err != nil {
+			return nil, err
+		}
+		lc.replace(upgraded)
+		return lc, nil
+	}
+}
+
+// StartTLS is a STARTTLS command upgrading the connection by Upgrader.
+type StartTLS struct {
+	server.StartTLS
+}
+
+func (cmd *StartTLS) Upgrade(conn server.Conn) error {
+	return cmd.StartTLS.Upgrade(&upgradeConn{Conn: conn})
+}
+
+type upgradeConn struct {
+	server.Conn
+}
+
+func (c *upgradeConn) Upgrade(upgrader imap.ConnUpgrader) error {
+	return c.Conn.Upgrade(Upgrader(upgrader))
+}
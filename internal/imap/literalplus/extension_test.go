@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package literalplus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/require"
+)
+
+const message = "Subject: Hello\r\n\r\nHi\r\n"
+
+func TestNonSynchronizingLiterals(t *testing.T) {
+	c, r := dial(t, nil)
+	defer c.Close() //nolint[errcheck]
+	testLiterals(t, c, r)
+}
+
+func TestNonSynchronizingLiteralsAfterStartTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "literalplus")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	tlsConfig, err := config.GetTLSConfig(&tlsConfiger{dir: dir})
+	require.NoError(t, err)
+
+	c, r := dial(t, tlsConfig)
+	defer c.Close() //nolint[errcheck]
+
+	send(t, c, "s STARTTLS")
+	readUntilTag(t, r, "s OK")
+
+	tlsConn := tls.Client(c, &tls.Config{RootCAs: tlsConfig.RootCAs, ServerName: tlsConfig.ServerName})
+	require.NoError(t, tlsConn.Handshake())
+	testLiterals(t, tlsConn, bufio.NewReader(tlsConn))
+}
+
+func testLiterals(t *testing.T, c net.Conn, r *bufio.Reader) {
+	send(t, c, "a CAPABILITY")
+	require.Contains(t, readUntilTag(t, r, "a OK"), Capability)
+
+	send(t, c, "b LOGIN username password")
+	readUntilTag(t, r, "b OK")
+
+	send(t, c, fmt.Sprintf("c APPEND INBOX {%d+}\r\n%s", len(message), message))
+	require.True(t, strings.HasPrefix(readUntilTag(t, r, "c "), "c OK"))
+
+	// Synchronizing literals still get continuation request.
+	send(t, c, fmt.Sprintf("d APPEND INBOX {%d}", len(message)))
+	readUntilTag(t, r, "+")
+	send(t, c, message)
+	readUntilTag(t, r, "d OK")
+}
+
+func dial(t *testing.T, tlsConfig *tls.Config) (net.Conn, *bufio.Reader) {
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.TLSConfig = tlsConfig
+	s.Enable(NewExtension())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// Only the listener is closed, go-imap closing connections from other
+	// goroutine is racy.
+	go s.Serve(l) //nolint[errcheck]
+	t.Cleanup(func() { _ = l.Close() })
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+
+	r := bufio.NewReader(c)
+	readUntilTag(t, r, "*")
+	return c, r
+}
+
+type tlsConfiger struct {
+	dir string
+}
+
+func (c *tlsConfiger) GetTLSCertPath() string {
+	return filepath.Join(c.dir, "cert.pem")
+}
+
+func (c *tlsConfiger) GetTLSKeyPath() string {
+	return filepath.Join(c.dir, "key.pem")
+}
+
+func send(t *testing.T, c net.Conn, command string) {
+	_, err := fmt.Fprintf(c, "%s\r\n", command)
+	require.NoError(t, err)
+}
+
+// readUntilTag returns all lines up to the one starting with the prefix.
+func readUntilTag(t *testing.T, r *bufio.Reader, prefix string) string {
+	lines := ""
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		lines += line
+		if strings.HasPrefix(line, prefix) {
+			return lines
+		}
+	}
+}
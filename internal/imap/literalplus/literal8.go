@@ -0,0 +1,141 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package literalplus
+
+import "bytes"
+
+// binaryItemPrefix is the beginning of BINARY FETCH item with data,
+// e.g. `BINARY[1]` or `BINARY[1]<0>`; BINARY.SIZE has a number.
+var binaryItemPrefix = []byte("BINARY[") //nolint[gochecknoglobals]
+
+// maxAtomSize is enough to recognise BINARY items.
+const maxAtomSize = 64
+
+// binaryWriter adds `~` to literals written after BINARY FETCH item so the
+// data of the part are sent as literal8; they can contain NUL which is not
+// allowed in normal literals. go-imap can write only normal literals.
+type binaryWriter struct {
+	state     readState
+	size      int64
+	remaining int64
+
+	atom     []byte
+	isBinary bool
+}
+
+// rewrite returns `b` with literal8 instead of literals of BINARY items.
+// Literal data and quoted strings are skipped.
+func (w *binaryWriter) rewrite(b []byte) []byte { //nolint[gocyclo]
+	var out []byte
+	last := 0
+	for i := 0; i < len(b); i++ {
+		if w.state == stateLiteralData {
+			n := int64(len(b) - i)
+			if n > w.remaining {
+				n = w.remaining
+			}
+			i += int(n) - 1
+			if w.remaining -= n; w.remaining == 0 {
+				w.state = stateNormal
+			}
+			continue
+		}
+
+		ch := b[i]
+		switch w.state {
+		case stateQuoted:
+			switch ch {
+			case '\\':
+				w.state = stateQuotedEscape
+			case '"', '\n':
+				w.state = stateNormal
+			}
+		case stateQuotedEscape:
+			w.state = stateQuoted
+		case stateLiteralOpen, stateLiteralSize:
+			switch {
+			case ch >= '0' && ch <= '9' && w.size < maxLiteralSize:
+				w.size = w.size*10 + int64(ch-'0')
+				w.state = stateLiteralSize
+			case ch == '}' && w.state == stateLiteralSize:
+				w.state = stateLiteralClose
+			default:
+				w.normal(ch)
+			}
+		case stateLiteralClose:
+			if ch == '\r' {
+				w.state = stateLiteralCR
+			} else {
+				w.normal(ch)
+			}
+		case stateLiteralCR:
+			if ch == '\n' {
+				w.startLiteral()
+			} else {
+				w.normal(ch)
+			}
+		default:
+			if ch == '{' && w.isBinary {
+				out = append(out, b[last:i]...)
+				out = append(out, '~')
+				last = i
+			}
+			w.normal(ch)
+		}
+	}
+
+	if out == nil {
+		return b
+	}
+	return append(out, b[last:]...)
+}
+
+// normal processes character outside of any string and remembers whether
+// the last atom was BINARY item.
+func (w *binaryWriter) normal(ch byte) {
+	isBinary := false
+	switch ch {
+	case '"':
+		w.state = stateQuoted
+	case '{':
+		w.state = stateLiteralOpen
+		w.size = 0
+	case ' ':
+		w.state = stateNormal
+		isBinary = bytes.HasPrefix(w.atom, binaryItemPrefix)
+	default:
+		w.state = stateNormal
+		w.isBinary = false
+		if ch == '(' || ch == ')' || ch == '\r' || ch == '\n' {
+			w.atom = w.atom[:0]
+		} else if len(w.atom) < maxAtomSize {
+			w.atom = append(w.atom, ch)
+		}
+		return
+	}
+	w.atom = w.atom[:0]
+	w.isBinary = isBinary
+}
+
+func (w *binaryWriter) startLiteral() {
+	w.state = stateNormal
+	if w.size > 0 {
+		w.state = stateLiteralData
+		w.remaining = w.size
+	}
+}
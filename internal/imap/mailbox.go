@@ -18,8 +18,11 @@
 package imap
 
 import (
+	"strconv"
 	"strings"
 
+	"github.com/ProtonMail/proton-bridge/internal/imap/condstore"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/emersion/go-imap"
@@ -30,7 +33,10 @@ import (
 type imapMailbox struct {
 	panicHandler panicHandler
 	user         *imapUser
-	name         string
+
+	// readOnly is set when the mailbox is opened by EXAMINE or when the
+	// mailbox is always read-only.
+	readOnly bool
 
 	log *logrus.Entry
 
@@ -44,25 +50,25 @@ func newIMAPMailbox(panicHandler panicHandler, user *imapUser, storeMailbox stor
 	return &imapMailbox{
 		panicHandler: panicHandler,
 		user:         user,
-		name:         storeMailbox.Name(),
 
 		log: log.
-			WithField("addressID", user.storeAddress.AddressID()).
+			WithField("addressID", storeMailbox.Address().AddressID()).
 			WithField("userID", user.storeUser.UserID()).
 			WithField("labelID", storeMailbox.LabelID()),
 
 		storeUser:    user.storeUser,
-		storeAddress: user.storeAddress,
+		storeAddress: storeMailbox.Address(),
 		storeMailbox: storeMailbox,
 	}
 }
 
-// Name returns this mailbox name.
+// Name returns this mailbox name. The name is not kept, so the selected
+// mailbox renamed in the web app gets updates sent under its new name.
 func (im *imapMailbox) Name() string {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
-	return im.name
+	return im.storeMailbox.Name()
 }
 
 // Info returns this mailbox info.
@@ -73,14 +79,17 @@ func (im *imapMailbox) Info() (*imap.MailboxInfo, error) {
 	info := &imap.MailboxInfo{
 		Attributes: im.getFlags(),
 		Delimiter:  im.storeMailbox.GetDelimiter(),
-		Name:       im.name,
+		Name:       im.storeMailbox.Name(),
 	}
 
 	return info, nil
 }
 
 func (im *imapMailbox) getFlags() []string {
-	flags := []string{imap.NoInferiorsAttr} // Subfolders are not yet supported by API.
+	flags := []string{}
+	if !im.storeMailbox.IsFolder() {
+		flags = append(flags, imap.NoInferiorsAttr) // Only folders can have subfolders.
+	}
 	switch im.storeMailbox.LabelID() {
 	case pmapi.SentLabel:
 		flags = append(flags, specialuse.Sent)
@@ -94,6 +103,8 @@ func (im *imapMailbox) getFlags() []string {
 		flags = append(flags, specialuse.All)
 	case pmapi.DraftLabel:
 		flags = append(flags, specialuse.Drafts)
+	case pmapi.StarredLabel, store.VirtualStarredLabel:
+		flags = append(flags, specialuse.Flagged)
 	}
 
 	return flags
@@ -113,28 +124,39 @@ func (im *imapMailbox) Status(items []string) (*imap.MailboxStatus, error) {
 	l := log.WithField("status-label", im.storeMailbox.LabelID())
 	l.Data["user"] = im.storeUser.UserID()
 	l.Data["address"] = im.storeAddress.AddressID()
-	status := imap.NewMailboxStatus(im.name, items)
+	status := imap.NewMailboxStatus(im.storeMailbox.Name(), items)
 	status.UidValidity = im.storeMailbox.UIDValidity()
+	status.ReadOnly = im.storeMailbox.IsReadOnly()
 	status.PermanentFlags = []string{
 		imap.SeenFlag, strings.ToUpper(imap.SeenFlag),
 		imap.FlaggedFlag, strings.ToUpper(imap.FlaggedFlag),
 		imap.DeletedFlag, strings.ToUpper(imap.DeletedFlag),
 		imap.DraftFlag, strings.ToUpper(imap.DraftFlag),
+		imap.AnsweredFlag, strings.ToUpper(imap.AnsweredFlag),
+		message.ForwardedFlag,
 		message.AppleMailJunkFlag,
 		message.ThunderbirdJunkFlag,
 		message.ThunderbirdNonJunkFlag,
 	}
+	status.PermanentFlags = append(status.PermanentFlags, im.storeUser.ListKeywords()...)
 
-	dbTotal, dbUnread, err := im.storeMailbox.GetCounts()
-	l.Debugln("DB: total", dbTotal, "unread", dbUnread, "err", err)
-	if err == nil {
-		status.Messages = uint32(dbTotal)
-		status.Unseen = uint32(dbUnread)
-	}
-
-	if status.UidNext, err = im.storeMailbox.GetNextUID(); err != nil {
+	// Numbers are kept by the store so STATUS does not loop the messages.
+	dbTotal, dbUnread, uidNext, err := im.storeMailbox.GetStatus()
+	l.Debugln("DB: total", dbTotal, "unread", dbUnread, "uidNext", uidNext, "err", err)
+	if err != nil {
 		return nil, err
 	}
+	status.Messages = uint32(dbTotal)
+	status.Unseen = uint32(dbUnread)
+	status.UidNext = uidNext
+
+	if _, ok := status.Items[condstore.MailboxHighestModSeq]; ok {
+		highestModSeq, err := im.HighestModSeq()
+		if err != nil {
+			return nil, err
+		}
+		status.Items[condstore.MailboxHighestModSeq] = strconv.FormatUint(highestModSeq, 10)
+	}
 
 	return status, nil
 }
@@ -177,11 +199,30 @@ func (im *imapMailbox) Check() error {
 
 // Expunge permanently removes all messages that have the \Deleted flag set
 // from the currently selected mailbox.
-// Our messages do not have \Deleted flag, nothing to do here.
 func (im *imapMailbox) Expunge() error {
-	return nil
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	// CLOSE of mailbox opened by EXAMINE does not remove messages.
+	if im.readOnly {
+		return nil
+	}
+	return im.storeMailbox.RemoveDeleted(nil)
+}
+
+// UIDExpunge removes only messages with the \Deleted flag set which are
+// in the UID set, so messages flagged by other clients are kept.
+func (im *imapMailbox) UIDExpunge(seqSet *imap.SeqSet) error {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	apiIDs, err := im.apiIDsFromSeqSet(true, seqSet)
+	if err != nil || len(apiIDs) == 0 {
+		return err
+	}
+	return im.storeMailbox.RemoveDeleted(apiIDs)
 }
 
 func (im *imapMailbox) ListQuotas() ([]string, error) {
-	return []string{""}, nil
+	return []string{quotaRoot}, nil
 }
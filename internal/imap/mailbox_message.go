@@ -19,7 +19,6 @@ package imap
 
 import (
 	"bytes"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -32,13 +31,16 @@ import (
 	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/imap/binary"
 	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
+	"github.com/ProtonMail/proton-bridge/internal/imap/condstore"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/ProtonMail/proton-bridge/internal/imap/xgm"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/parallel"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-textwrapper"
+	imapappendlimit "github.com/emersion/go-imap-appendlimit"
 	"github.com/hashicorp/go-multierror"
 	enmime "github.com/jhillyerd/enmime"
 	"github.com/pkg/errors"
@@ -71,6 +73,15 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	if im.storeMailbox.IsVirtual() {
+		return errVirtualMailbox
+	}
+
+	// Clients should respect APPENDLIMIT but not all of them do.
+	if limit := im.user.CreateMessageLimit(); limit != nil && uint32(body.Len()) > *limit {
+		return imapappendlimit.ErrTooBig
+	}
+
 	m, _, _, readers, err := message.Parse(body, "", "")
 	if err != nil {
 		return err
@@ -118,8 +129,9 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 		if err == nil && user.ID() == im.storeUser.UserID() {
 			logEntry := im.log.WithField("addr", sanitizedSender).WithField("extID", m.Header.Get("Message-Id"))
 
-			// If we find the message in the store already, we can skip importing it.
-			if foundUID := im.storeMailbox.GetUIDByHeader(&m.Header); foundUID != uint32(0) {
+			// Clients such as Apple Mail or Outlook APPEND the copy of message
+			// sent over SMTP; the API already created it, so the copy is merged.
+			if foundUID := im.storeMailbox.GetUIDOfSentCopy(m); foundUID != uint32(0) {
 				logEntry.Info("Ignoring APPEND of duplicate to Sent folder")
 				return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), &uidplus.OrderedSeq{foundUID})
 			}
@@ -127,8 +139,8 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 			// We didn't find the message in the store, so we are currently sending it.
 			logEntry.WithField("time", date).Info("No matching UID, continuing APPEND to Sent")
 
-			// For now we don't import user's own messages to Sent because GetUIDByHeader is not smart enough.
-			// This will be fixed in GODT-143.
+			// For now we don't import user's own messages to Sent because it could be
+			// the copy of message which was not sent yet. This will be fixed in GODT-143.
 			return nil
 		}
 
@@ -136,6 +148,15 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 		m.Flags |= pmapi.FlagSent
 	}
 
+	// Apple Mail APPENDs again messages which are already in the mailbox,
+	// e.g. after moving them when offline.
+	if im.user.mailClient.isAppleMail() && m.Header.Get("Message-Id") != "" {
+		if foundUID := im.storeMailbox.GetUIDByHeader(&m.Header); foundUID != uint32(0) {
+			im.log.WithField("extID", m.Header.Get("Message-Id")).Info("Ignoring APPEND of duplicate from Apple Mail")
+			return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), &uidplus.OrderedSeq{foundUID})
+		}
+	}
+
 	message.ParseFlags(m, flags)
 	if !date.IsZero() {
 		m.Time = date.Unix()
@@ -168,7 +189,7 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 				return err
 			}
 
-			targetSeq := im.storeMailbox.GetUIDList([]string{m.ID})
+			targetSeq := im.storeMailbox.GetUIDList(IDs)
 			return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), targetSeq)
 		}
 	}
@@ -179,79 +200,21 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 		return err
 	}
 
+	for _, f := range flags {
+		if _, isMapped := im.storeUser.GetKeywordLabelID(f); isMapped {
+			if err := im.storeUser.LabelMessagesWithKeyword([]string{m.ID}, f); err != nil {
+				im.log.WithError(err).WithField("keyword", f).Warn("Cannot set keyword of imported message")
+			}
+		}
+	}
+
 	targetSeq := im.storeMailbox.GetUIDList([]string{m.ID})
 	return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), targetSeq)
 }
 
-func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *pmcrypto.KeyRing) (err error) { // nolint[funlen]
-	b := &bytes.Buffer{}
-
-	// Overwrite content for main header for import.
-	// Even if message has just simple body we should upload as multipart/mixed.
-	// Each part has encrypted body and header reflects the original header.
-	mainHeader := message.GetHeader(m)
-	mainHeader.Set("Content-Type", "multipart/mixed; boundary="+message.GetBoundary(m))
-	mainHeader.Del("Content-Disposition")
-	mainHeader.Del("Content-Transfer-Encoding")
-	if err = writeHeader(b, mainHeader); err != nil {
-		return
-	}
-	mw := multipart.NewWriter(b)
-	if err = mw.SetBoundary(message.GetBoundary(m)); err != nil {
-		return
-	}
-
-	// Write the body part.
-	bodyHeader := make(textproto.MIMEHeader)
-	bodyHeader.Set("Content-Type", m.MIMEType+"; charset=utf-8")
-	bodyHeader.Set("Content-Disposition", "inline")
-	bodyHeader.Set("Content-Transfer-Encoding", "7bit")
-
-	var p io.Writer
-	if p, err = mw.CreatePart(bodyHeader); err != nil {
-		return
-	}
-	// First, encrypt the message body.
-	if err = m.Encrypt(kr, kr); err != nil {
-		return err
-	}
-	if _, err := io.WriteString(p, m.Body); err != nil {
-		return err
-	}
-
-	// Write the attachments parts.
-	for i := 0; i < len(m.Attachments); i++ {
-		att := m.Attachments[i]
-		r := readers[i]
-		h := message.GetAttachmentHeader(att)
-		if p, err = mw.CreatePart(h); err != nil {
-			return
-		}
-		// Create line wrapper writer.
-		ww := textwrapper.NewRFC822(p)
-
-		// Create base64 writer.
-		bw := base64.NewEncoder(base64.StdEncoding, ww)
-
-		data, err := ioutil.ReadAll(r)
-		if err != nil {
-			return err
-		}
-
-		// Create encrypted writer.
-		pgpMessage, err := kr.Encrypt(pmcrypto.NewPlainMessage(data), nil)
-		if err != nil {
-			return err
-		}
-		if _, err := bw.Write(pgpMessage.GetBinary()); err != nil {
-			return err
-		}
-		if err := bw.Close(); err != nil {
-			return err
-		}
-	}
-
-	if err := mw.Close(); err != nil {
+func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *pmcrypto.KeyRing) (err error) {
+	body, err := message.BuildEncrypted(m, readers, kr)
+	if err != nil {
 		return err
 	}
 
@@ -262,7 +225,7 @@ func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *
 		}
 	}
 
-	return im.storeMailbox.ImportMessage(m, b.Bytes(), labels)
+	return im.storeMailbox.ImportMessage(m, body, labels)
 }
 
 func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []string) (msg *imap.Message, err error) {
@@ -277,19 +240,29 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []str
 
 	msg = imap.NewMessage(seqNum, items)
 	for _, item := range items {
+		if binary.IsFetchItem(item) {
+			if err = im.getBinarySection(msg, storeMessage, item); err != nil {
+				return
+			}
+			continue
+		}
+
 		switch item {
 		case imap.EnvelopeMsgAttr:
 			msg.Envelope = message.GetEnvelope(m)
 		case imap.BodyMsgAttr, imap.BodyStructureMsgAttr:
 			var structure *message.BodyStructure
-			if structure, _, err = im.getBodyStructure(storeMessage); err != nil {
+			if structure, err = im.getStoredBodyStructure(storeMessage); err != nil {
 				return
 			}
 			if msg.BodyStructure, err = structure.IMAPBodyStructure([]int{}); err != nil {
 				return
 			}
 		case imap.FlagsMsgAttr:
-			msg.Flags = message.GetFlags(m)
+			msg.Flags = append(message.GetFlags(m), im.storeUser.GetMessageKeywords(m)...)
+			if storeMessage.IsDeleted() {
+				msg.Flags = append(msg.Flags, imap.DeletedFlag)
+			}
 		case imap.InternalDateMsgAttr:
 			msg.InternalDate = time.Unix(m.Time, 0)
 		case imap.SizeMsgAttr:
@@ -306,6 +279,16 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []str
 			if err != nil {
 				return nil, err
 			}
+		case condstore.ModSeqMsgAttr:
+			var modSeq uint64
+			if modSeq, err = storeMessage.ModSeq(); err != nil {
+				return nil, err
+			}
+			msg.Items[item] = condstore.FormatModSeq(modSeq)
+		case xgm.LabelsMsgAttr:
+			msg.Items[item] = xgm.FormatLabels(im.getGmailLabels(m))
+		case xgm.MsgIDMsgAttr:
+			msg.Items[item] = xgm.FormatMsgID(xgm.MsgID(m.ID))
 		default:
 			s := item
 
@@ -327,43 +310,185 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []str
 	return msg, err
 }
 
+// gmailSystemLabels are X-GM-LABELS of system labels. Archive and All Mail
+// have no label, Gmail archived messages have no label at all.
+var gmailSystemLabels = map[string]string{ //nolint[gochecknoglobals]
+	pmapi.InboxLabel:     xgm.InboxLabel,
+	pmapi.SentLabel:      xgm.SentLabel,
+	pmapi.AllSentLabel:   xgm.SentLabel,
+	pmapi.DraftLabel:     xgm.DraftLabel,
+	pmapi.AllDraftsLabel: xgm.DraftLabel,
+	pmapi.StarredLabel:   xgm.StarredLabel,
+	pmapi.SpamLabel:      xgm.SpamLabel,
+	pmapi.TrashLabel:     xgm.TrashLabel,
+	pmapi.ArchiveLabel:   "",
+	pmapi.AllMailLabel:   "",
+}
+
+// getGmailLabels returns X-GM-LABELS of the message: Gmail labels of system
+// labels and IMAP names of folders and labels.
+func (im *imapMailbox) getGmailLabels(m *pmapi.Message) []string {
+	labels := []string{}
+	userLabelIDs := []string{}
+	added := map[string]bool{}
+	for _, labelID := range m.LabelIDs {
+		label, isSystem := gmailSystemLabels[labelID]
+		if !isSystem {
+			userLabelIDs = append(userLabelIDs, labelID)
+			continue
+		}
+		// Sent and drafts have two system labels each.
+		if label != "" && !added[label] {
+			labels = append(labels, label)
+			added[label] = true
+		}
+	}
+	return append(labels, im.storeAddress.GetMailboxNames(userLabelIDs)...)
+}
+
 func (im *imapMailbox) getBodyStructure(storeMessage storeMessageProvider) (
 	structure *message.BodyStructure,
-	bodyReader *bytes.Reader, err error,
+	body io.ReaderAt, err error,
 ) {
 	m := storeMessage.Message()
 	id := im.storeUser.UserID() + m.ID
 	cache.BuildLock(id)
-	if bodyReader, structure = cache.LoadMail(id); bodyReader.Len() == 0 || structure == nil {
-		var body []byte
-		structure, body, err = im.buildMessage(m)
-		if err == nil && structure != nil && len(body) > 0 {
-			m.Size = int64(len(body))
-			if err := storeMessage.SetSize(m.Size); err != nil {
-				im.log.WithError(err).
-					WithField("newSize", m.Size).
-					WithField("msgID", m.ID).
-					Warn("Cannot update size while building")
-			}
-			if err := storeMessage.SetContentTypeAndHeader(m.MIMEType, m.Header); err != nil {
-				im.log.WithError(err).
-					WithField("msgID", m.ID).
-					Warn("Cannot update header while building")
+	if body, structure = cache.LoadMail(id); body == nil || structure == nil {
+		var built []byte
+		if built, structure = im.loadCachedMessage(storeMessage); built != nil {
+			cache.SaveMail(id, built, structure)
+		} else {
+			structure, built, err = im.buildMessage(m)
+			if err == nil && structure != nil && len(built) > 0 {
+				m.Size = int64(len(built))
+				if err := storeMessage.SetSize(m.Size); err != nil {
+					im.log.WithError(err).
+						WithField("newSize", m.Size).
+						WithField("msgID", m.ID).
+						Warn("Cannot update size while building")
+				}
+				if err := storeMessage.SetContentTypeAndHeader(m.MIMEType, m.Header); err != nil {
+					im.log.WithError(err).
+						WithField("msgID", m.ID).
+						Warn("Cannot update header while building")
+				}
+				// Drafts can change and we don't want to cache them.
+				if !isMessageInDraftFolder(m) {
+					cache.SaveMail(id, built, structure)
+					if err := storeMessage.SetBodyStructure(structure); err != nil {
+						im.log.WithError(err).
+							WithField("msgID", m.ID).
+							Warn("Cannot store body structure while building")
+					}
+					if err := storeMessage.SetCachedBody(built); err != nil {
+						im.log.WithError(err).
+							WithField("msgID", m.ID).
+							Warn("Cannot cache message on disk while building")
+					}
+				}
 			}
-			// Drafts can change and we don't want to cache them.
-			if !isMessageInDraftFolder(m) {
-				cache.SaveMail(id, body, structure)
+			if _, ok := err.(*doNotCacheError); ok {
+				im.log.WithField("msgID", m.ID).Errorf("do not cache message: %v", err)
+				err = nil
 			}
-			bodyReader = bytes.NewReader(body)
 		}
+		if built != nil {
+			body = bytes.NewReader(built)
+		}
+	}
+	cache.BuildUnlock(id)
+	return structure, body, err
+}
+
+// loadCachedMessage returns the message built before and cached on disk
+// together with its stored structure, or nil if it has to be built.
+func (im *imapMailbox) loadCachedMessage(storeMessage storeMessageProvider) ([]byte, *message.BodyStructure) {
+	if isMessageInDraftFolder(storeMessage.Message()) {
+		return nil, nil
+	}
+	structure, err := storeMessage.GetBodyStructure()
+	if err != nil || structure == nil {
+		return nil, nil
+	}
+	body, err := storeMessage.GetCachedBody()
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", storeMessage.ID()).Warn("Cannot load cached message")
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	return body, structure
+}
+
+// getStoredBodyStructure returns the structure stored when the message was
+// built before, so BODYSTRUCTURE does not need to download and build it again.
+func (im *imapMailbox) getStoredBodyStructure(storeMessage storeMessageProvider) (*message.BodyStructure, error) {
+	structure, err := storeMessage.GetBodyStructure()
+	if err != nil {
+		im.log.WithError(err).WithField("msgID", storeMessage.ID()).Warn("Cannot load stored body structure")
+	}
+	if structure != nil && !isMessageInDraftFolder(storeMessage.Message()) {
+		return structure, nil
+	}
+	structure, _, err = im.getBodyStructure(storeMessage)
+	return structure, err
+}
+
+// getLazySectionContent returns content of the section of the message without
+// downloading attachments the section does not contain. The body part is
+// taken from the message built without attachments and a single attachment
+// is downloaded (or loaded from the attachment cache) alone. It returns false
+// when the message is built already or the section needs the whole message.
+func (im *imapMailbox) getLazySectionContent(storeMessage storeMessageProvider, path []int) (*io.SectionReader, bool, error) {
+	m := storeMessage.Message()
+	if !isLazySection(m, path) {
+		return nil, false, nil
+	}
+	if body, _ := cache.LoadMail(im.storeUser.UserID() + m.ID); body != nil || storeMessage.HasCachedBody() {
+		return nil, false, nil
+	}
+	if structure, err := storeMessage.GetBodyStructure(); err != nil || structure == nil {
+		return nil, false, nil
+	}
+
+	if path[0] == 1 {
+		structure, body, err := im.buildMessageParts(m, false)
 		if _, ok := err.(*doNotCacheError); ok {
-			im.log.WithField("msgID", m.ID).Errorf("do not cache message: %v", err)
 			err = nil
-			bodyReader = bytes.NewReader(body)
 		}
+		if err != nil {
+			return nil, false, err
+		}
+		content, err := structure.GetSectionContentReader(bytes.NewReader(body), path)
+		return content, err == nil, err
 	}
-	cache.BuildUnlock(id)
-	return structure, bodyReader, err
+
+	if err := im.fetchMessage(m); err != nil {
+		return nil, false, err
+	}
+	atts, _ := message.SeparateInlineAttachments(m)
+	if path[0]-2 >= len(atts) {
+		return nil, false, nil
+	}
+	buf := &bytes.Buffer{}
+	if err := im.writeAttachmentBody(buf, m, atts[path[0]-2]); err != nil {
+		return nil, false, err
+	}
+	return newBytesSectionReader(buf.Bytes()), true, nil
+}
+
+// isLazySection returns whether the section of the message can be served
+// without building the whole message. Only messages with attachments built
+// by the bridge qualify: part 1 is the body and every next part is one
+// attachment.
+func isLazySection(m *pmapi.Message, path []int) bool {
+	if len(path) == 0 || m.NumAttachments == 0 || m.MIMEType == pmapi.ContentTypeMultipartMixed {
+		return false
+	}
+	if isMessageInDraftFolder(m) {
+		return false
+	}
+	return path[0] == 1 || len(path) == 1
 }
 
 func isMessageInDraftFolder(m *pmapi.Message) bool {
@@ -379,10 +504,11 @@ func isMessageInDraftFolder(m *pmapi.Message) bool {
 // extract data (header,body, both) and trim the output if needed.
 func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider, section *imap.BodySectionName) (literal imap.Literal, err error) { // nolint[funlen]
 	var (
-		structure  *message.BodyStructure
-		bodyReader *bytes.Reader
-		header     textproto.MIMEHeader
-		response   []byte
+		structure     *message.BodyStructure
+		body          io.ReaderAt
+		sectionReader *io.SectionReader
+		header        textproto.MIMEHeader
+		response      []byte
 	)
 
 	im.log.WithField("msgID", storeMessage.ID()).Trace("Getting message body")
@@ -406,9 +532,27 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 			}
 			header = message.GetHeader(m)
 		}
+	} else if section.Specifier == imap.EntireSpecifier && len(section.Path) != 0 {
+		// Non-empty section with no specifier (imap.EntireSpecifier) refers to section content without header.
+		var isLazy bool
+		if sectionReader, isLazy, err = im.getLazySectionContent(storeMessage, section.Path); err != nil {
+			return
+		}
+		if !isLazy {
+			if structure, body, err = im.getBodyStructure(storeMessage); err != nil {
+				return
+			}
+			sectionReader, err = structure.GetSectionContentReader(body, section.Path)
+		}
+	} else if len(section.Path) != 0 && (section.Specifier == imap.MimeSpecifier || section.Specifier == imap.HeaderSpecifier) {
+		// Headers of parts are in the stored structure.
+		if structure, err = im.getStoredBodyStructure(storeMessage); err != nil {
+			return
+		}
+		header, err = structure.GetSectionHeader(section.Path)
 	} else {
 		// The rest of cases need download and decrypt.
-		structure, bodyReader, err = im.getBodyStructure(storeMessage)
+		structure, body, err = im.getBodyStructure(storeMessage)
 		if err != nil {
 			return
 		}
@@ -416,11 +560,10 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 		switch {
 		case section.Specifier == imap.EntireSpecifier && len(section.Path) == 0:
 			//  An empty section specification refers to the entire message, including the header.
-			response, err = structure.GetSection(bodyReader, section.Path)
-		case section.Specifier == imap.TextSpecifier || (section.Specifier == imap.EntireSpecifier && len(section.Path) != 0):
+			sectionReader, err = structure.GetSectionReader(body, section.Path)
+		case section.Specifier == imap.TextSpecifier:
 			// The TEXT specifier refers to the content of the message (or section), omitting the [RFC-2822] header.
-			// Non-empty section with no specifier (imap.EntireSpecifier) refers to section content without header.
-			response, err = structure.GetSectionContent(bodyReader, section.Path)
+			sectionReader, err = structure.GetSectionContentReader(body, section.Path)
 		case section.Specifier == imap.MimeSpecifier:
 			// The MIME part specifier refers to the [MIME-IMB] header for this part.
 			fallthrough
@@ -435,6 +578,10 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 		return
 	}
 
+	if sectionReader != nil {
+		return newSectionLiteral(sectionReader, section.Partial), nil
+	}
+
 	// Filter header. Options are: all fields, only selected fields, all fields except selected.
 	if header != nil {
 		// remove fields
@@ -474,6 +621,115 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 	return literal, nil
 }
 
+// sectionLiteral is the literal which reads the section of the message
+// only when go-imap writes it to the connection.
+type sectionLiteral struct {
+	*io.SectionReader
+}
+
+func (l sectionLiteral) Len() int {
+	return int(l.Size())
+}
+
+// WriteTo writes the section to the connection. go-imap copies literals by
+// io.Copy which prefers io.WriterTo of the literal, so the section is read
+// from the cached message straight into the buffer of the connection instead
+// of through a temporary copy buffer.
+func (l sectionLiteral) WriteTo(w io.Writer) (int64, error) {
+	if imapWriter, ok := w.(*imap.Writer); ok {
+		w = imapWriter.Writer
+	}
+	return io.Copy(w, l.SectionReader)
+}
+
+// newSectionLiteral returns the literal with the part of the section
+// requested by partial (origin and optional length) without copying it.
+func newSectionLiteral(section *io.SectionReader, partial []int) imap.Literal {
+	if len(partial) == 0 {
+		return sectionLiteral{section}
+	}
+	from, size := int64(partial[0]), section.Size()
+	if from > size {
+		from = size
+	}
+	if len(partial) == 2 && int64(partial[1]) < size-from {
+		size = from + int64(partial[1])
+	}
+	return sectionLiteral{io.NewSectionReader(section, from, size-from)}
+}
+
+func newBytesSectionReader(b []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b)))
+}
+
+// getBinarySection sets BINARY or BINARY.SIZE item of the message with
+// the section decoded from its content transfer encoding.
+func (im *imapMailbox) getBinarySection(msg *imap.Message, storeMessage storeMessageProvider, item string) error {
+	section, err := binary.ParseSection(item)
+	if err != nil {
+		return err
+	}
+
+	var content *io.SectionReader
+	if len(section.Path) == 0 {
+		structure, body, err := im.getBodyStructure(storeMessage)
+		if err != nil {
+			return err
+		}
+		// The whole message has no content transfer encoding.
+		if content, err = structure.GetSectionReader(body, section.Path); err != nil {
+			return err
+		}
+	} else {
+		structure, err := im.getStoredBodyStructure(storeMessage)
+		if err != nil {
+			return err
+		}
+		path := section.Path
+		var header textproto.MIMEHeader
+		header, err = structure.GetSectionHeader(path)
+		// Part 1 of non-multipart message is its body.
+		if err != nil && len(path) == 1 && path[0] == 1 {
+			path = []int{}
+			header, err = structure.GetSectionHeader(path)
+		}
+		if err != nil {
+			return err
+		}
+		var isLazy bool
+		if content, isLazy, err = im.getLazySectionContent(storeMessage, path); err != nil {
+			return err
+		}
+		if !isLazy {
+			var body io.ReaderAt
+			if structure, body, err = im.getBodyStructure(storeMessage); err != nil {
+				return err
+			}
+			if content, err = structure.GetSectionContentReader(body, path); err != nil {
+				return err
+			}
+		}
+		// The content has to be read whole to decode it.
+		encoded, err := ioutil.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		decoded, err := binary.Decode(encoded, header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return err
+		}
+		content = newBytesSectionReader(decoded)
+	}
+
+	delete(msg.Items, item)
+	if section.Size {
+		msg.Items[section.FetchItem()] = uint32(content.Size())
+	} else {
+		msg.Items[section.FetchItem()] = newSectionLiteral(content, section.Partial)
+	}
+	return nil
+}
+
 func (im *imapMailbox) fetchMessage(m *pmapi.Message) (err error) {
 	im.log.Trace("Fetching message")
 
@@ -545,6 +801,15 @@ func (im *imapMailbox) writeAndParseMIMEBody(m *pmapi.Message) (mime *enmime.Env
 }
 
 func (im *imapMailbox) writeAttachmentBody(w io.Writer, m *pmapi.Message, att *pmapi.Attachment) (err error) {
+	cached, err := im.storeUser.GetCachedAttachment(att.ID)
+	if err != nil {
+		im.log.WithError(err).WithField("attID", att.ID).Warn("Cannot load cached attachment")
+	}
+	if len(cached) != 0 {
+		_, err = w.Write(cached)
+		return
+	}
+
 	// Retrieve encrypted attachment.
 	r, err := im.user.client.GetAttachment(att.ID)
 	if err != nil {
@@ -552,13 +817,22 @@ func (im *imapMailbox) writeAttachmentBody(w io.Writer, m *pmapi.Message, att *p
 	}
 	defer r.Close() //nolint[errcheck]
 
+	buf := &bytes.Buffer{}
+	name := att.Name
 	kr := im.user.client.KeyRingForAddressID(m.AddressID)
-	if err = message.WriteAttachmentBody(w, kr, m, att, r); err != nil {
+	if err = message.WriteAttachmentBody(buf, kr, m, att, r); err != nil {
 		// Returning an error here makes certain mail clients behave badly,
 		// trying to retrieve the message again and again.
 		im.log.Warn("Cannot write attachment body: ", err)
 		err = nil
+	} else if att.Name == name {
+		// Attachment which could not be decrypted is renamed and it is
+		// not cached so the header matches its content next time.
+		if err := im.storeUser.SetCachedAttachment(m.ID, att.ID, buf.Bytes()); err != nil {
+			im.log.WithError(err).WithField("attID", att.ID).Warn("Cannot cache attachment on disk")
+		}
 	}
+	_, err = buf.WriteTo(w)
 	return
 }
 
@@ -621,6 +895,9 @@ func (im *imapMailbox) setMessageContentType(m *pmapi.Message) (multipartType in
 		multipartType = simpleMultipart
 	}
 
+	if m.Header == nil {
+		m.Header = make(mail.Header)
+	}
 	h := textproto.MIMEHeader(m.Header)
 	if multipartType == noMultipart {
 		message.SetBodyContentFields(&h, m)
@@ -636,6 +913,12 @@ func (im *imapMailbox) setMessageContentType(m *pmapi.Message) (multipartType in
 
 // buildMessage from PM to IMAP.
 func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodyStructure, msgBody []byte, err error) {
+	return im.buildMessageParts(m, true)
+}
+
+// buildMessageParts builds the message. Without attachments, their parts are
+// left empty and only the structure of other parts matches the whole message.
+func (im *imapMailbox) buildMessageParts(m *pmapi.Message, withAttachments bool) (structure *message.BodyStructure, msgBody []byte, err error) {
 	im.log.Trace("Building message")
 
 	var errNoCache doNotCacheError
@@ -660,13 +943,13 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 	// and that fails. For any building error is better to return custom
 	// message than error because it will not be fixed and users would
 	// get error message all the time and could not see some messages.
-	structure, msgBody, err = im.buildMessageInner(m, kr)
+	structure, msgBody, err = im.buildMessageInner(m, kr, withAttachments)
 	if err == pmapi.ErrAPINotReachable || err == pmapi.ErrInvalidToken || err == pmapi.ErrUpgradeApplication {
 		return nil, nil, err
 	} else if err != nil {
 		errNoCache.add(err)
 		im.customMessage(m, err, true)
-		structure, msgBody, err = im.buildMessageInner(m, kr)
+		structure, msgBody, err = im.buildMessageInner(m, kr, withAttachments)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -677,7 +960,7 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 	return structure, msgBody, err
 }
 
-func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing) (structure *message.BodyStructure, msgBody []byte, err error) { // nolint[funlen]
+func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing, withAttachments bool) (structure *message.BodyStructure, msgBody []byte, err error) { // nolint[funlen]
 	multipartType, err := im.setMessageContentType(m)
 	if err != nil {
 		return
@@ -685,7 +968,7 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing)
 
 	tmpBuf := &bytes.Buffer{}
 	mainHeader := message.GetHeader(m)
-	if err = writeHeader(tmpBuf, mainHeader); err != nil {
+	if err = message.WriteHeader(tmpBuf, mainHeader); err != nil {
 		return
 	}
 	_, _ = io.WriteString(tmpBuf, "\r\n")
@@ -741,6 +1024,9 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing)
 			att := value.(*pmapi.Attachment)
 
 			buf := &bytes.Buffer{}
+			if !withAttachments {
+				return buf, nil
+			}
 			if err = im.writeAttachmentBody(buf, m, att); err != nil {
 				return nil, err
 			}
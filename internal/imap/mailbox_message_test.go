@@ -18,9 +18,14 @@
 package imap
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"io/ioutil"
 	"testing"
 
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
 	"github.com/stretchr/testify/require"
 )
 
@@ -39,3 +44,52 @@ func TestDoNotCache(t *testing.T) {
 	dnc.add(errors.New("third"))
 	t.Log(dnc.errorOrNil())
 }
+
+func TestSectionLiteral(t *testing.T) {
+	data := []byte("0123456789")
+	for _, test := range []struct {
+		partial []int
+		want    string
+	}{
+		{nil, "0123456789"},
+		{[]int{3}, "3456789"},
+		{[]int{3, 2}, "34"},
+		{[]int{8, 5}, "89"},
+		{[]int{20, 5}, ""},
+	} {
+		literal := newSectionLiteral(newBytesSectionReader(data), test.partial)
+		require.Equal(t, len(test.want), literal.Len(), test.partial)
+		b, err := ioutil.ReadAll(literal)
+		require.NoError(t, err)
+		require.Equal(t, test.want, string(b), test.partial)
+	}
+}
+
+func TestSectionLiteralWriteTo(t *testing.T) {
+	literal := newSectionLiteral(newBytesSectionReader([]byte("0123456789")), []int{3, 4})
+
+	// The literal is read by the writer of the connection itself.
+	conn := &bytes.Buffer{}
+	n, err := io.Copy(&imap.Writer{Writer: conn}, literal)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), n)
+	require.Equal(t, "3456", conn.String())
+}
+
+func TestIsLazySection(t *testing.T) {
+	withAttachments := &pmapi.Message{MIMEType: "text/html", NumAttachments: 2, LabelIDs: []string{pmapi.InboxLabel}}
+	require.False(t, isLazySection(withAttachments, []int{}))
+	require.True(t, isLazySection(withAttachments, []int{1}))
+	require.True(t, isLazySection(withAttachments, []int{1, 2}))
+	require.True(t, isLazySection(withAttachments, []int{3}))
+	require.False(t, isLazySection(withAttachments, []int{3, 1}))
+
+	noAttachments := &pmapi.Message{MIMEType: "text/html", LabelIDs: []string{pmapi.InboxLabel}}
+	require.False(t, isLazySection(noAttachments, []int{1}))
+
+	external := &pmapi.Message{MIMEType: pmapi.ContentTypeMultipartMixed, NumAttachments: 2}
+	require.False(t, isLazySection(external, []int{2}))
+
+	draft := &pmapi.Message{MIMEType: "text/html", NumAttachments: 2, LabelIDs: []string{pmapi.DraftLabel}}
+	require.False(t, isLazySection(draft, []int{2}))
+}
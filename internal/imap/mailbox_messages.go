@@ -25,11 +25,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/imap/binary"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/parallel"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/emersion/go-imap"
+	imapserver "github.com/emersion/go-imap/server"
 	"github.com/sirupsen/logrus"
 )
 
@@ -46,6 +48,12 @@ func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operat
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	// \Seen and \Flagged can be changed in All Mail but messages cannot be
+	// removed from it.
+	if operation != imap.RemoveFlags && isStringInListFold(flags, imap.DeletedFlag) && !im.storeMailbox.CanDeleteMessages() {
+		return errVirtualMailbox
+	}
+
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
 		return err
@@ -68,11 +76,18 @@ func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operat
 				_ = im.storeMailbox.MarkMessagesUnstarred(messageIDs)
 			}
 		case imap.DeletedFlag:
-			if operation == imap.RemoveFlags {
-				break // Nothing to do, no message has the \Deleted flag.
+			// Messages are removed from the mailbox by EXPUNGE.
+			switch operation {
+			case imap.SetFlags, imap.AddFlags:
+				_ = im.storeMailbox.MarkMessagesDeleted(messageIDs)
+			case imap.RemoveFlags:
+				_ = im.storeMailbox.MarkMessagesUndeleted(messageIDs)
 			}
-			_ = im.storeMailbox.DeleteMessages(messageIDs)
-		case imap.AnsweredFlag, imap.DraftFlag, imap.RecentFlag:
+		case imap.AnsweredFlag:
+			_ = im.storeUser.MarkMessagesAnswered(messageIDs, operation != imap.RemoveFlags)
+		case message.ForwardedFlag:
+			_ = im.storeUser.MarkMessagesForwarded(messageIDs, operation != imap.RemoveFlags)
+		case imap.DraftFlag, imap.RecentFlag:
 			// Not supported.
 		case message.AppleMailJunkFlag, message.ThunderbirdJunkFlag:
 			storeMailbox, err := im.storeAddress.GetMailbox(pmapi.SpamLabel)
@@ -89,6 +104,34 @@ func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operat
 			case imap.RemoveFlags:
 				_ = storeMailbox.UnlabelMessages(messageIDs)
 			}
+		default:
+			if _, isMapped := im.storeUser.GetKeywordLabelID(f); !isMapped {
+				break // Unknown keywords are not stored.
+			}
+			switch operation {
+			case imap.SetFlags, imap.AddFlags:
+				_ = im.storeUser.LabelMessagesWithKeyword(messageIDs, f)
+			case imap.RemoveFlags:
+				_ = im.storeUser.UnlabelMessagesWithKeyword(messageIDs, f)
+			}
+		}
+	}
+
+	// Setting flags replaces all keywords and answered flags, not only the listed ones.
+	if operation == imap.SetFlags {
+		if !isStringInListFold(flags, imap.DeletedFlag) {
+			_ = im.storeMailbox.MarkMessagesUndeleted(messageIDs)
+		}
+		if !isStringInListFold(flags, imap.AnsweredFlag) {
+			_ = im.storeUser.MarkMessagesAnswered(messageIDs, false)
+		}
+		if !isStringInListFold(flags, message.ForwardedFlag) {
+			_ = im.storeUser.MarkMessagesForwarded(messageIDs, false)
+		}
+		for _, keyword := range im.storeUser.ListKeywords() {
+			if !isStringInListFold(flags, keyword) {
+				_ = im.storeUser.UnlabelMessagesWithKeyword(messageIDs, keyword)
+			}
 		}
 	}
 
@@ -109,56 +152,206 @@ func (im *imapMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, targetLabel s
 
 	// It is needed to get UID list before LabelingMessages because
 	// messages can be removed from source during labeling (e.g. folder1 -> folder2).
-	sourceSeqSet := im.storeMailbox.GetUIDList(messageIDs)
+	sourceUIDs := getUIDsByAPIID(im.storeMailbox, messageIDs)
 
-	targetStoreMBX, err := im.storeAddress.GetMailbox(targetLabel)
+	targetStoreMBX, err := im.user.storeAddress.GetMailbox(im.user.mailClient.mailboxName(targetLabel))
 	if err != nil {
 		return err
 	}
+	if targetStoreMBX.IsSearch() {
+		return errVirtualMailbox
+	}
 	if err = targetStoreMBX.LabelMessages(messageIDs); err != nil {
 		return err
 	}
 
-	targetSeqSet := targetStoreMBX.GetUIDList(messageIDs)
-	return uidplus.CopyResponse(im.storeMailbox.UIDValidity(), sourceSeqSet, targetSeqSet)
+	// UIDVALIDITY in COPYUID belongs to the destination mailbox.
+	sourceSeqSet, targetSeqSet := pairCopiedUIDs(messageIDs, sourceUIDs, getUIDsByAPIID(targetStoreMBX, messageIDs))
+	return uidplus.CopyResponse(targetStoreMBX.UIDValidity(), sourceSeqSet, targetSeqSet)
 }
 
 // MoveMessages adds dest's label and removes this mailbox' label from each message.
-//
-// This should not be used until MOVE extension has option to send UIDPLUS
-// responses.
-func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, newLabel string) error {
+// Moving between folders is done only by labeling because a message can be
+// in one folder at a time.
+func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, newLabel string, copied func(*imap.StatusResp) error) error {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	if im.readOnly {
+		return imapserver.ErrMailboxReadOnly
+	}
+
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
 		return err
 	}
-	storeMailbox, err := im.storeAddress.GetMailbox(newLabel)
+	storeMailbox, err := im.user.storeAddress.GetMailbox(im.user.mailClient.mailboxName(newLabel))
 	if err != nil {
 		return err
 	}
+	if storeMailbox.IsSearch() {
+		return errVirtualMailbox
+	}
+
+	// It is needed to get UID list before labeling as in CopyMessages.
+	sourceUIDs := getUIDsByAPIID(im.storeMailbox, messageIDs)
+
 	// Label messages first to not loss them. If message is only in trash and we unlabel
 	// it, it will be removed completely and we cannot label it back.
 	if err := storeMailbox.LabelMessages(messageIDs); err != nil {
 		return err
 	}
+
+	sourceSeqSet, targetSeqSet := pairCopiedUIDs(messageIDs, sourceUIDs, getUIDsByAPIID(storeMailbox, messageIDs))
+	if res := uidplus.MoveResponse(storeMailbox.UIDValidity(), sourceSeqSet, targetSeqSet); res != nil {
+		if err := copied(res); err != nil {
+			return err
+		}
+	}
+
+	if isExclusiveMailbox(im.storeMailbox) && isExclusiveMailbox(storeMailbox) {
+		return nil
+	}
+	// Messages cannot be removed from All Mail and searches.
+	if im.storeMailbox.LabelID() == pmapi.AllMailLabel || im.storeMailbox.IsSearch() {
+		return nil
+	}
 	return im.storeMailbox.UnlabelMessages(messageIDs)
 }
 
+// getUIDsByAPIID returns UIDs of messages found in the mailbox.
+func getUIDsByAPIID(storeMailbox storeMailboxProvider, apiIDs []string) map[string]uint32 {
+	uids := map[string]uint32{}
+	for _, apiID := range apiIDs {
+		if uidList := storeMailbox.GetUIDList([]string{apiID}); uidList.Len() == 1 {
+			uids[apiID] = (*uidList)[0]
+		}
+	}
+	return uids
+}
+
+// pairCopiedUIDs returns source and target UIDs in the same order for messages
+// found in both mailboxes. Messages not yet in the target mailbox (e.g. when
+// the API refused to label some of them) are left out so COPYUID is still
+// correct for the rest.
+func pairCopiedUIDs(apiIDs []string, sourceUIDs, targetUIDs map[string]uint32) (sourceSeq, targetSeq *uidplus.OrderedSeq) {
+	sourceSeq, targetSeq = &uidplus.OrderedSeq{}, &uidplus.OrderedSeq{}
+	for _, apiID := range apiIDs {
+		sourceUID, inSource := sourceUIDs[apiID]
+		targetUID, inTarget := targetUIDs[apiID]
+		if inSource && inTarget {
+			sourceSeq.Add(sourceUID)
+			targetSeq.Add(targetUID)
+		}
+	}
+	return sourceSeq, targetSeq
+}
+
+// isExclusiveMailbox returns whether message can be only in one such mailbox
+// at a time, i.e. labeling to other one removes it from the previous one.
+func isExclusiveMailbox(storeMailbox storeMailboxProvider) bool {
+	if storeMailbox.IsFolder() {
+		return true
+	}
+	switch storeMailbox.LabelID() {
+	case pmapi.InboxLabel, pmapi.ArchiveLabel, pmapi.TrashLabel, pmapi.SpamLabel:
+		return true
+	}
+	return false
+}
+
 // SearchMessages searches messages. The returned list must contain UIDs if
 // uid is set to true, or sequence numbers otherwise.
-func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) { //nolint[gocyclo]
+func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	storeMessages, err := im.searchStoreMessages(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, storeMessage := range storeMessages {
+		id, err := getMessageID(isUID, storeMessage)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// searchSince returns the time of the oldest messages the criteria search
+// for (zero for all messages), or false if the criteria do not limit dates.
+func searchSince(criteria *imap.SearchCriteria) (since int64, ok bool) {
+	for _, t := range []time.Time{criteria.Since, criteria.On, criteria.SentSince, criteria.SentOn} {
+		if t.IsZero() {
+			continue
+		}
+		if truncated := t.Truncate(24 * time.Hour).Unix(); !ok || truncated < since {
+			since = truncated
+		}
+		ok = true
+	}
+	if !ok && !(criteria.Before.IsZero() && criteria.SentBefore.IsZero()) {
+		return 0, true
+	}
+	return since, ok
+}
+
+// getMessageID returns UID of the message if isUID is true or sequence number otherwise.
+func getMessageID(isUID bool, storeMessage storeMessageProvider) (uint32, error) {
+	if isUID {
+		return storeMessage.UID()
+	}
+	return storeMessage.SequenceNumber()
+}
+
+// searchStoreMessages returns messages matching the criteria.
+func (im *imapMailbox) searchStoreMessages(criteria *imap.SearchCriteria) (storeMessages []storeMessageProvider, err error) { //nolint[gocyclo]
 	if criteria.Not != nil || criteria.Or[0] != nil {
 		return nil, errors.New("unsupported search query")
 	}
 
-	if criteria.Body != "" || criteria.Text != "" {
-		log.Warn("Body and Text criteria not applied.")
+	// Bodies are not available in the metadata and the API cannot search
+	// them because they are encrypted on the server. Bodies of messages
+	// matching all other criteria are searched at the end. The local
+	// full-text index, if it is enabled and complete, limits them to
+	// messages which may match.
+	var apiIDsFromIndex []map[string]bool
+	var bodyCriteria []bodyCriterion
+	for _, criterion := range []bodyCriterion{{criteria.Body, true}, {criteria.Text, false}} {
+		if criterion.text == "" {
+			continue
+		}
+		bodyCriteria = append(bodyCriteria, criterion)
+		apiIDs, err := im.storeMailbox.SearchFullText(criterion.text, criterion.bodyOnly)
+		if err != nil {
+			log.WithError(err).Debug("Full-text index not used")
+			continue
+		}
+		apiIDsFromIndex = append(apiIDsFromIndex, newStringSet(apiIDs))
+	}
+
+	// Sender, recipient and subject are searched by the API to limit
+	// messages whose bodies have to be downloaded. The result is checked
+	// by the local filters below anyway.
+	var apiIDsFromAPI map[string]bool
+	if len(bodyCriteria) != 0 && (criteria.From != "" || criteria.To != "" || criteria.Subject != "") {
+		if apiIDs, err := im.storeMailbox.SearchAPIIDs(criteria.From, criteria.To, criteria.Subject); err != nil {
+			log.WithError(err).Warn("Cannot search messages by API")
+		} else {
+			apiIDsFromAPI = newStringSet(apiIDs)
+		}
+	}
+
+	// Messages older than the sync window are added on demand when they
+	// are searched for.
+	if since, ok := searchSince(criteria); ok {
+		if err := im.storeMailbox.ExtendSyncWindow(since); err != nil {
+			log.WithError(err).Warn("Cannot extend sync window")
+		}
 	}
 
 	var apiIDs []string
@@ -171,17 +364,28 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 		return nil, err
 	}
 
-	var apiIDsFromUID []string
+	var apiIDsFromUID map[string]bool
 	if criteria.Uid != nil {
+		apiIDsFromUID = map[string]bool{}
 		if apiIDs, err := im.apiIDsFromSeqSet(true, criteria.Uid); err == nil {
-			apiIDsFromUID = append(apiIDsFromUID, apiIDs...)
+			apiIDsFromUID = newStringSet(apiIDs)
 		}
 	}
 
 	// Apply filters.
 	for _, apiID := range apiIDs {
 		// Filter on UIDs.
-		if len(apiIDsFromUID) > 0 && !isStringInList(apiIDsFromUID, apiID) {
+		if apiIDsFromUID != nil && !apiIDsFromUID[apiID] {
+			continue
+		}
+
+		// Filter on body and text searched by the full-text index.
+		if !isStringInAllSets(apiIDsFromIndex, apiID) {
+			continue
+		}
+
+		// Filter on criteria searched by the API.
+		if apiIDsFromAPI != nil && !apiIDsFromAPI[apiID] {
 			continue
 		}
 
@@ -211,10 +415,10 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 		if criteria.Subject != "" && !strings.Contains(strings.ToLower(m.Subject), strings.ToLower(criteria.Subject)) {
 			continue
 		}
-		if criteria.Keyword != "" && !hasKeyword(m, criteria.Keyword) {
+		if criteria.Keyword != "" && !im.hasKeyword(m, criteria.Keyword) {
 			continue
 		}
-		if criteria.Unkeyword != "" && hasKeyword(m, criteria.Unkeyword) {
+		if criteria.Unkeyword != "" && im.hasKeyword(m, criteria.Unkeyword) {
 			continue
 		}
 		if criteria.Header[0] != "" {
@@ -239,10 +443,12 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 		if criteria.Unseen && m.Unread == 0 {
 			continue
 		}
-		if criteria.Deleted {
+		if criteria.Deleted && !storeMessage.IsDeleted() {
+			continue
+		}
+		if criteria.Undeleted && storeMessage.IsDeleted() {
 			continue
 		}
-		// if criteria.Undeleted { // All messages matches this criteria }
 		if criteria.Draft && (m.Has(pmapi.FlagSent) || m.Has(pmapi.FlagReceived)) {
 			continue
 		}
@@ -314,23 +520,43 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 			}
 		}
 
-		// Add the ID to response.
-		var id uint32
-		if isUID {
-			id, err = storeMessage.UID()
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			id, err = storeMessage.SequenceNumber()
-			if err != nil {
-				return nil, err
-			}
+		storeMessages = append(storeMessages, storeMessage)
+	}
+
+	for _, criterion := range bodyCriteria {
+		if storeMessages, err = im.searchBodies(storeMessages, criterion); err != nil {
+			return nil, err
 		}
-		ids = append(ids, id)
 	}
 
-	return ids, nil
+	return storeMessages, nil
+}
+
+// bodyCriterion is BODY (bodyOnly) or TEXT search criterion.
+type bodyCriterion struct {
+	text     string
+	bodyOnly bool
+}
+
+// searchBodies returns those storeMessages whose bodies match the criterion.
+func (im *imapMailbox) searchBodies(storeMessages []storeMessageProvider, criterion bodyCriterion) ([]storeMessageProvider, error) {
+	apiIDs := make([]string, 0, len(storeMessages))
+	for _, storeMessage := range storeMessages {
+		apiIDs = append(apiIDs, storeMessage.ID())
+	}
+	matchedAPIIDs, err := im.storeMailbox.SearchBodies(apiIDs, criterion.text, criterion.bodyOnly)
+	if err != nil {
+		return nil, err
+	}
+	matched := newStringSet(matchedAPIIDs)
+
+	filtered := storeMessages[:0]
+	for _, storeMessage := range storeMessages {
+		if matched[storeMessage.ID()] {
+			filtered = append(filtered, storeMessage)
+		}
+	}
+	return filtered, nil
 }
 
 // ListMessages returns a list of messages. seqset must be interpreted as UIDs
@@ -377,6 +603,8 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []str
 		input[i] = apiID
 	}
 
+	readsBinary := isBinaryRead(items)
+
 	processCallback := func(value interface{}) (interface{}, error) {
 		apiID := value.(string)
 
@@ -388,24 +616,33 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []str
 		}
 
 		msg, err := im.getMessage(storeMessage, items)
+		if err == binary.ErrUnknownCTE {
+			// Status response has to be passed to the client as it is.
+			return nil, err
+		}
 		if err != nil {
 			err = fmt.Errorf("list message build: %v", err)
 			l.WithField("metaID", storeMessage.ID()).Error(err)
 			return nil, err
 		}
 
-		if storeMessage.Message().Unread == 1 {
+		// Mailbox opened by EXAMINE must not change the messages.
+		if storeMessage.Message().Unread == 1 && !im.readOnly {
+			markAsRead := readsBinary
 			for section := range msg.Body {
 				// Peek means get messages without marking them as read.
 				// If client does not only ask for peek, we have to mark them as read.
 				if !section.Peek {
-					markAsReadMutex.Lock()
-					markAsReadIDs = append(markAsReadIDs, storeMessage.ID())
-					markAsReadMutex.Unlock()
-					msg.Flags = append(msg.Flags, imap.SeenFlag)
+					markAsRead = true
 					break
 				}
 			}
+			if markAsRead {
+				markAsReadMutex.Lock()
+				markAsReadIDs = append(markAsReadIDs, storeMessage.ID())
+				markAsReadMutex.Unlock()
+				msg.Flags = append(msg.Flags, imap.SeenFlag)
+			}
 		}
 
 		return msg, nil
@@ -430,6 +667,20 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []str
 	return nil
 }
 
+// isBinaryRead returns whether items contain BINARY item without PEEK which
+// marks the message as read the same way as BODY section.
+func isBinaryRead(items []string) bool {
+	for _, item := range items {
+		if !binary.IsFetchItem(item) {
+			continue
+		}
+		if section, err := binary.ParseSection(item); err == nil && !section.Peek && !section.Size {
+			return true
+		}
+	}
+	return false
+}
+
 // apiIDsFromSeqSet takes an IMAP sequence set (which can contain either
 // sequence numbers or UIDs) and returns all known API IDs in this range.
 func (im *imapMailbox) apiIDsFromSeqSet(uid bool, seqSet *imap.SeqSet) ([]string, error) {
@@ -471,6 +722,32 @@ func isStringInList(list []string, s string) bool {
 	return false
 }
 
+func isStringInListFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func newStringSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, v := range list {
+		set[v] = true
+	}
+	return set
+}
+
+func isStringInAllSets(sets []map[string]bool, s string) bool {
+	for _, set := range sets {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
+
 func addressMatch(addresses []*mail.Address, criteria string) bool {
 	for _, addr := range addresses {
 		if strings.Contains(strings.ToLower(addr.String()), strings.ToLower(criteria)) {
@@ -480,7 +757,16 @@ func addressMatch(addresses []*mail.Address, criteria string) bool {
 	return false
 }
 
-func hasKeyword(m *pmapi.Message, keyword string) bool {
+// hasKeyword returns whether message has label mapped to the keyword.
+// Messages are matched by header for keywords without mapping.
+func (im *imapMailbox) hasKeyword(m *pmapi.Message, keyword string) bool {
+	if labelID, isMapped := im.storeUser.GetKeywordLabelID(keyword); isMapped {
+		return labelID != "" && isStringInList(m.LabelIDs, labelID)
+	}
+	return hasKeywordInHeader(m, keyword)
+}
+
+func hasKeywordInHeader(m *pmapi.Message, keyword string) bool {
 	for _, v := range message.GetHeader(m) {
 		if strings.Contains(strings.ToLower(strings.Join(v, " ")), strings.ToLower(keyword)) {
 			return true
@@ -0,0 +1,67 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairCopiedUIDs(t *testing.T) {
+	apiIDs := []string{"a", "b", "c", "d"}
+	sourceUIDs := map[string]uint32{"a": 1, "b": 2, "c": 3, "d": 4}
+	targetUIDs := map[string]uint32{"a": 10, "c": 11, "d": 12}
+
+	sourceSeq, targetSeq := pairCopiedUIDs(apiIDs, sourceUIDs, targetUIDs)
+	require.Equal(t, &uidplus.OrderedSeq{1, 3, 4}, sourceSeq)
+	require.Equal(t, &uidplus.OrderedSeq{10, 11, 12}, targetSeq)
+
+	sourceSeq, targetSeq = pairCopiedUIDs(apiIDs, sourceUIDs, map[string]uint32{})
+	require.Equal(t, 0, sourceSeq.Len())
+	require.Equal(t, 0, targetSeq.Len())
+}
+
+func TestIsBinaryRead(t *testing.T) {
+	require.True(t, isBinaryRead([]string{"UID", "BINARY[1]"}))
+	require.False(t, isBinaryRead([]string{"UID", "BINARY.PEEK[1]", "BINARY.SIZE[1]"}))
+	require.False(t, isBinaryRead([]string{"BODY[1]"}))
+}
+
+func TestSearchSince(t *testing.T) {
+	day1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	_, ok := searchSince(&imap.SearchCriteria{Subject: "foo"})
+	require.False(t, ok)
+
+	since, ok := searchSince(&imap.SearchCriteria{Since: day2, SentSince: day1})
+	require.True(t, ok)
+	require.Equal(t, day1.Unix(), since)
+
+	since, ok = searchSince(&imap.SearchCriteria{On: day2, Before: day1})
+	require.True(t, ok)
+	require.Equal(t, day2.Unix(), since)
+
+	since, ok = searchSince(&imap.SearchCriteria{SentBefore: day1})
+	require.True(t, ok)
+	require.Equal(t, int64(0), since)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// HighestModSeq returns the highest mod-sequence of the mailbox for CONDSTORE.
+func (im *imapMailbox) HighestModSeq() (uint64, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.storeMailbox.GetHighestModSeq()
+}
+
+// ModSeqs returns mod-sequences of messages in seqSet for CONDSTORE.
+// The last message is included for `*` as for any other command.
+func (im *imapMailbox) ModSeqs(uid bool, seqSet *imap.SeqSet) (map[uint32]uint64, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	uids, modSeqs, err := im.storeMailbox.GetModSeqs()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[uint32]uint64{}
+	for i, messageUID := range uids {
+		id := uint32(i + 1)
+		if uid {
+			id = messageUID
+		}
+		if seqSet.Contains(id) || (i == len(uids)-1 && seqSet.Contains(0)) {
+			result[id] = modSeqs[i]
+		}
+	}
+	return result, nil
+}
+
+// ChangeModSeqs assigns new mod-sequences to messages in seqSet not changed
+// after unchangedSince for STORE. Keys are as for ModSeqs.
+func (im *imapMailbox) ChangeModSeqs(uid bool, seqSet *imap.SeqSet, unchangedSince uint64) (map[uint32]uint64, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	uids, _, err := im.storeMailbox.GetModSeqs()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[uint32]uint32{}
+	selected := []uint32{}
+	for i, messageUID := range uids {
+		id := uint32(i + 1)
+		if uid {
+			id = messageUID
+		}
+		if seqSet.Contains(id) || (i == len(uids)-1 && seqSet.Contains(0)) {
+			ids[messageUID] = id
+			selected = append(selected, messageUID)
+		}
+	}
+
+	changed, err := im.storeMailbox.ChangeModSeqs(selected, unchangedSince)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[uint32]uint64{}
+	for messageUID, modSeq := range changed {
+		result[ids[messageUID]] = modSeq
+	}
+	return result, nil
+}
+
+// ExpungedSince returns UIDs of messages removed after modSeq for QRESYNC.
+func (im *imapMailbox) ExpungedSince(modSeq uint64) ([]uint32, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	return im.storeMailbox.GetUIDsExpungedSince(modSeq)
+}
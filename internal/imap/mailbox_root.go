@@ -19,6 +19,7 @@ package imap
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/store"
@@ -36,48 +37,57 @@ import (
 //		Labels						<< this
 //			Labels/Security
 //
+// The same is used for saved searches ("Searches") and for namespaces of
+// addresses in combined mode, e.g. "Addresses" and "Addresses/alias@pm.me".
+//
 // This mailbox cannot be modified or read in any way.
 type imapRootMailbox struct {
-	isFolder bool
+	name string
 }
 
 func newFoldersRootMailbox() *imapRootMailbox {
-	return &imapRootMailbox{isFolder: true}
+	return &imapRootMailbox{name: store.UserFoldersMailboxName}
 }
 
 func newLabelsRootMailbox() *imapRootMailbox {
-	return &imapRootMailbox{isFolder: false}
+	return &imapRootMailbox{name: store.UserLabelsMailboxName}
 }
 
-func (m *imapRootMailbox) Name() string {
-	if m.isFolder {
-		return store.UserFoldersMailboxName
+func newSavedSearchesRootMailbox() *imapRootMailbox {
+	return &imapRootMailbox{name: store.SavedSearchesMailboxName}
+}
+
+// newNamespaceRootMailboxes returns the root mailboxes of namespaces.
+func newNamespaceRootMailboxes(namespaces []string) []*imapRootMailbox {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	mailboxes := []*imapRootMailbox{{name: store.AddressNamespacesMailboxName}}
+	for _, namespace := range namespaces {
+		mailboxes = append(mailboxes,
+			&imapRootMailbox{name: strings.TrimSuffix(namespace, store.PathDelimiter)},
+			&imapRootMailbox{name: namespace + store.UserFoldersMailboxName},
+			&imapRootMailbox{name: namespace + store.UserLabelsMailboxName},
+		)
 	}
-	return store.UserLabelsMailboxName
+	return mailboxes
+}
+
+func (m *imapRootMailbox) Name() string {
+	return m.name
 }
 
 func (m *imapRootMailbox) Info() (info *imap.MailboxInfo, err error) {
 	info = &imap.MailboxInfo{
 		Attributes: []string{imap.NoSelectAttr},
 		Delimiter:  store.PathDelimiter,
+		Name:       m.name,
 	}
-
-	if m.isFolder {
-		info.Name = store.UserFoldersMailboxName
-	} else {
-		info.Name = store.UserLabelsMailboxName
-	}
-
 	return
 }
 
 func (m *imapRootMailbox) Status(items []string) (status *imap.MailboxStatus, err error) {
-	status = &imap.MailboxStatus{}
-	if m.isFolder {
-		status.Name = store.UserFoldersMailboxName
-	} else {
-		status.Name = store.UserLabelsMailboxName
-	}
+	status = &imap.MailboxStatus{Name: m.name}
 	return
 }
 
@@ -114,7 +124,7 @@ func (m *imapRootMailbox) CopyMessages(uid bool, seqset *imap.SeqSet, dest strin
 	return nil
 }
 
-// Expunge is not used by Bridge. We delete the message once it is flagged as \Deleted.
+// Expunge does nothing because root mailbox has no messages.
 func (m *imapRootMailbox) Expunge() error {
 	return nil
 }
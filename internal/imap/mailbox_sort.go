@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/sortthread"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+)
+
+// SortThreadMessages returns data needed to SORT or THREAD messages matching
+// the criteria. The returned IDs must be UIDs if uid is set to true, or
+// sequence numbers otherwise.
+func (im *imapMailbox) SortThreadMessages(isUID bool, criteria *imap.SearchCriteria) ([]*sortthread.Message, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	storeMessages, err := im.searchStoreMessages(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := []*sortthread.Message{}
+	for _, storeMessage := range storeMessages {
+		id, err := getMessageID(isUID, storeMessage)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, newSortThreadMessage(id, storeMessage.Message()))
+	}
+
+	return msgs, nil
+}
+
+func newSortThreadMessage(id uint32, m *pmapi.Message) *sortthread.Message {
+	msg := &sortthread.Message{
+		ID:        id,
+		Date:      time.Unix(m.Time, 0),
+		Arrival:   time.Unix(m.Time, 0),
+		Size:      uint32(m.Size),
+		Subject:   m.Subject,
+		From:      firstAddress([]*mail.Address{m.Sender}),
+		To:        firstAddress(m.ToList),
+		Cc:        firstAddress(m.CCList),
+		MessageID: sortThreadMessageID(m),
+	}
+
+	if date, err := m.Header.Date(); err == nil && !date.IsZero() {
+		msg.Date = date
+	}
+
+	// The conversation comes first so that messages of the same conversation
+	// are threaded together even when clients do not keep the headers.
+	if m.ConversationID != "" {
+		msg.References = append(msg.References, "<"+m.ConversationID+"@protonmail.conversationid>")
+	}
+	references := strings.Fields(m.Header.Get("References"))
+	if len(references) == 0 {
+		references = strings.Fields(m.Header.Get("In-Reply-To"))
+	}
+	for _, reference := range references {
+		if reference != msg.MessageID && strings.HasPrefix(reference, "<") && strings.HasSuffix(reference, ">") {
+			msg.References = append(msg.References, reference)
+		}
+	}
+
+	return msg
+}
+
+// sortThreadMessageID returns the same message ID as the served headers.
+func sortThreadMessageID(m *pmapi.Message) string {
+	if m.ExternalID != "" {
+		return "<" + m.ExternalID + ">"
+	}
+	if messageID := strings.TrimSpace(m.Header.Get("Message-Id")); messageID != "" {
+		return messageID
+	}
+	return "<" + m.ID + "@protonmail.internalid>"
+}
+
+func firstAddress(addresses []*mail.Address) string {
+	if len(addresses) == 0 || addresses[0] == nil {
+		return ""
+	}
+	return addresses[0].Address
+}
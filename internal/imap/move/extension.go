@@ -0,0 +1,128 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package move implements MOVE extension as defined in RFC6851.
+//
+// Together with UIDPLUS the COPYUID response is sent as untagged OK before
+// EXPUNGE responses of moved messages, so mailbox has to provide a callback
+// for it in the middle of the move.
+package move
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// Capability extension identifier.
+const Capability = "MOVE"
+
+const move = "MOVE"
+
+// Mailbox is a backend mailbox which can move messages in one step.
+type Mailbox interface {
+	backend.Mailbox
+
+	// MoveMessages moves messages in seqSet to the dest mailbox. The copied
+	// callback has to be called with untagged response about copied messages
+	// before they are removed from the mailbox, if there is any.
+	MoveMessages(uid bool, seqSet *imap.SeqSet, dest string, copied func(*imap.StatusResp) error) error
+}
+
+// Move is a MOVE command.
+type Move struct {
+	SeqSet  *imap.SeqSet
+	Mailbox string
+}
+
+func (cmd *Move) Parse(fields []interface{}) (err error) {
+	if len(fields) < 2 {
+		return errors.New("no enough arguments")
+	}
+
+	seqSet, ok := fields[0].(string)
+	if !ok {
+		return errors.New("invalid sequence set")
+	}
+	if cmd.SeqSet, err = imap.NewSeqSet(seqSet); err != nil {
+		return err
+	}
+
+	mailbox, ok := fields[1].(string)
+	if !ok {
+		return errors.New("mailbox name must be a string")
+	}
+	if mailbox, err = utf7.Decoder.String(mailbox); err != nil {
+		return err
+	}
+	cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
+
+	return nil
+}
+
+func (cmd *Move) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return server.ErrMailboxReadOnly
+	}
+
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		return errors.New("MOVE is not supported by the mailbox")
+	}
+
+	return mbox.MoveMessages(uid, cmd.SeqSet, cmd.Mailbox, func(res *imap.StatusResp) error {
+		return conn.WriteResp(res)
+	})
+}
+
+func (cmd *Move) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Move) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+type extension struct{}
+
+// NewExtension of MOVE.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != move {
+		return nil
+	}
+	return func() server.Handler {
+		return &Move{}
+	}
+}
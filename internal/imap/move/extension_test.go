@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package move
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMove(t *testing.T) {
+	cmd := &Move{}
+	require.NoError(t, cmd.Parse([]interface{}{"1:3,5", "inbox"}))
+	assert.Equal(t, "1:3,5", cmd.SeqSet.String())
+	assert.Equal(t, imap.InboxName, cmd.Mailbox)
+
+	cmd = &Move{}
+	require.NoError(t, cmd.Parse([]interface{}{"1", "Folders/&AMk-t&AOk-"}))
+	assert.Equal(t, "Folders/Été", cmd.Mailbox)
+
+	assert.Error(t, (&Move{}).Parse([]interface{}{"1"}))
+	assert.Error(t, (&Move{}).Parse([]interface{}{"x", "INBOX"}))
+	assert.Error(t, (&Move{}).Parse([]interface{}{"1", []interface{}{"INBOX"}}))
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package namespace implements NAMESPACE command (RFC 2342). Only personal
+// namespaces are used, there are no other users or shared mailboxes.
+package namespace
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "NAMESPACE"
+
+const namespace = "NAMESPACE"
+
+// User can list more personal namespaces than the default one with empty
+// prefix, e.g. mailboxes of other addresses of the account.
+type User interface {
+	ListNamespaces() []string
+}
+
+// Namespace is a NAMESPACE command.
+type Namespace struct {
+	delimiter string
+}
+
+func (cmd *Namespace) Parse(fields []interface{}) error {
+	return nil
+}
+
+func (cmd *Namespace) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	prefixes := []string{""}
+	if user, ok := ctx.User.(User); ok {
+		prefixes = append(prefixes, user.ListNamespaces()...)
+	}
+
+	return conn.WriteResp(newNamespaceResp(prefixes, cmd.delimiter))
+}
+
+// namespaceResp is untagged NAMESPACE response. The namespaces are written
+// without spaces between them as required by RFC 2342 which go-imap lists
+// cannot do.
+type namespaceResp struct {
+	prefixes  []string
+	delimiter string
+}
+
+func newNamespaceResp(prefixes []string, delimiter string) *namespaceResp {
+	return &namespaceResp{prefixes: prefixes, delimiter: delimiter}
+}
+
+func (resp *namespaceResp) WriteTo(w *imap.Writer) error {
+	personal := ""
+	for _, prefix := range resp.prefixes {
+		personal += "(" + strconv.Quote(prefix) + " " + strconv.Quote(resp.delimiter) + ")"
+	}
+	_, err := io.WriteString(w, "* "+namespace+" ("+personal+") NIL NIL\r\n")
+	return err
+}
+
+type extension struct {
+	delimiter string
+}
+
+// NewExtension of NAMESPACE with the hierarchy delimiter of all namespaces.
+func NewExtension(delimiter string) server.Extension {
+	return &extension{delimiter: delimiter}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != namespace {
+		return nil
+	}
+	return func() server.Handler {
+		return &Namespace{delimiter: ext.delimiter}
+	}
+}
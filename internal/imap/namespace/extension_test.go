@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package namespace
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceResp(t *testing.T) {
+	tests := []struct {
+		prefixes []string
+		want     string
+	}{
+		{[]string{""}, `* NAMESPACE (("" "/")) NIL NIL` + "\r\n"},
+		{[]string{"", "Addresses/alias@pm.me/"}, `* NAMESPACE (("" "/")("Addresses/alias@pm.me/" "/")) NIL NIL` + "\r\n"},
+	}
+	for _, test := range tests {
+		b := &bytes.Buffer{}
+		require.NoError(t, newNamespaceResp(test.prefixes, "/").WriteTo(imap.NewWriter(b)))
+		require.Equal(t, test.want, b.String())
+	}
+}
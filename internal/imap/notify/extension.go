@@ -0,0 +1,376 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package notify DOES NOT implement full RFC5465!
+//
+// Excluded parts are:
+//   - Filters `selected` and `selected-delayed`: go-imap sends updates of
+//     the selected mailbox to every connection, so they cannot be turned off
+//     or changed for a single connection. They are accepted but have no effect.
+//   - Events MailboxName, SubscriptionChange, AnnotationChange and
+//     MailboxMetadataChange are refused with BADEVENT.
+//   - Fetch attributes after MessageNew are ignored because new messages
+//     appear only in not selected mailboxes which get STATUS responses.
+//
+// Changes of not selected mailboxes are collected for a short time and sent
+// as one STATUS response per mailbox to avoid flooding the client during
+// the synchronisation.
+//
+// Otherwise the standard RFC5465 is followed.
+package notify
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+	"github.com/sirupsen/logrus"
+)
+
+// Capability extension identifier.
+const Capability = "NOTIFY"
+
+const (
+	notify = "NOTIFY"
+	set    = "SET"
+	none   = "NONE"
+	status = "STATUS"
+
+	codeBadEvent = "BADEVENT"
+
+	// notifyDelay is how long changes are collected before STATUS is sent.
+	notifyDelay = 500 * time.Millisecond
+
+	// sendTimeout protects from waiting for connection which was closed.
+	sendTimeout = 1 * time.Second
+)
+
+var log = logrus.WithField("pkg", "imap/notify") //nolint[gochecknoglobals]
+
+// connState holds filters set by the client and changes waiting to be sent.
+type connState struct {
+	conn    server.Conn
+	filters []*filter
+
+	// pending are events per mailbox name.
+	pending map[string]map[string]bool
+	timer   *time.Timer
+}
+
+// Extension is NOTIFY extension which has to receive backend updates.
+type Extension struct {
+	delimiter string
+
+	lock   sync.Mutex
+	states map[*server.Context]*connState
+}
+
+// NewExtension of NOTIFY; delimiter is used for `subtree` filter.
+func NewExtension(delimiter string) *Extension {
+	return &Extension{
+		delimiter: delimiter,
+		states:    map[*server.Context]*connState{},
+	}
+}
+
+func (ext *Extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *Extension) Command(name string) server.HandlerFactory {
+	if name != notify {
+		return nil
+	}
+	return func() server.Handler {
+		return &Notify{ext: ext}
+	}
+}
+
+// NewConn forgets filters of the connection once it is closed.
+func (ext *Extension) NewConn(c server.Conn) server.Conn {
+	return &conn{Conn: c, ext: ext}
+}
+
+type conn struct {
+	server.Conn
+	ext *Extension
+}
+
+func (c *conn) Close() error {
+	c.ext.setFilters(c, nil)
+	return c.Conn.Close()
+}
+
+func (ext *Extension) setFilters(c server.Conn, filters []*filter) {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	if state, ok := ext.states[c.Context()]; ok && state.timer != nil {
+		state.timer.Stop()
+	}
+	if len(filters) == 0 {
+		delete(ext.states, c.Context())
+		return
+	}
+	ext.states[c.Context()] = &connState{
+		conn:    c,
+		filters: filters,
+		pending: map[string]map[string]bool{},
+	}
+}
+
+// Notify records the backend update for connections with matching filter.
+// It has to be called for every update before it is passed to go-imap.
+func (ext *Extension) Notify(update interface{}) {
+	var (
+		u     *backend.Update
+		event string
+	)
+	switch update := update.(type) {
+	case *backend.MessageUpdate:
+		u, event = &update.Update, eventMessageNew
+	case *backend.MailboxUpdate:
+		u, event = &update.Update, eventMessageNew
+	case *backend.ExpungeUpdate:
+		u, event = &update.Update, eventMessageExpunge
+	default:
+		return
+	}
+	if u.Username == "" || u.Mailbox == "" {
+		return
+	}
+
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	for ctx, state := range ext.states {
+		if ctx.User == nil || ctx.User.Username() != u.Username || !state.wants(event) {
+			continue
+		}
+		if state.pending[u.Mailbox] == nil {
+			state.pending[u.Mailbox] = map[string]bool{}
+		}
+		state.pending[u.Mailbox][event] = true
+		if state.timer == nil {
+			ctx := ctx
+			state.timer = time.AfterFunc(notifyDelay, func() { ext.flush(ctx) })
+		}
+	}
+}
+
+func (state *connState) wants(event string) bool {
+	for _, f := range state.filters {
+		if f.events[event] {
+			return true
+		}
+	}
+	return false
+}
+
+// flush sends STATUS for all pending mailboxes of the connection.
+func (ext *Extension) flush(ctx *server.Context) {
+	ext.lock.Lock()
+	state, ok := ext.states[ctx]
+	if !ok {
+		ext.lock.Unlock()
+		return
+	}
+	pending := state.pending
+	state.pending = map[string]map[string]bool{}
+	state.timer = nil
+	ext.lock.Unlock()
+
+	m := newMatcher(ctx.User, ext.delimiter)
+	for name, events := range pending {
+		if ctx.Mailbox != nil && ctx.Mailbox.Name() == name {
+			continue
+		}
+		items := state.statusItems(m, name, events)
+		if len(items) == 0 {
+			continue
+		}
+		res, err := getStatus(ctx.User, name, items)
+		if err != nil {
+			log.WithError(err).WithField("mailbox", name).Warn("Cannot get status for notification")
+			continue
+		}
+		send(ctx, res)
+	}
+}
+
+// statusItems returns which STATUS items should be sent for the events from
+// the mailbox, or nothing if the client is not interested in that mailbox.
+func (state *connState) statusItems(m *matcher, name string, events map[string]bool) []string {
+	wanted := false
+	flagChange := false
+	for _, f := range state.filters {
+		if !m.matches(f, name) {
+			continue
+		}
+		for event := range events {
+			wanted = wanted || f.events[event]
+		}
+		flagChange = flagChange || f.events[eventFlagChange]
+	}
+	if !wanted {
+		return nil
+	}
+	items := []string{imap.MailboxMessages, imap.MailboxUidNext}
+	if flagChange {
+		items = append(items, imap.MailboxUnseen)
+	}
+	return items
+}
+
+func getStatus(user backend.User, name string, items []string) (*responses.Status, error) {
+	mbox, err := user.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	mboxStatus, err := mbox.Status(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only keep items that have been requested.
+	requested := map[string]interface{}{}
+	for _, k := range items {
+		requested[k] = mboxStatus.Items[k]
+	}
+	mboxStatus.Items = requested
+
+	return &responses.Status{Mailbox: mboxStatus}, nil
+}
+
+func send(ctx *server.Context, res imap.WriterTo) {
+	select {
+	case ctx.Responses <- res:
+	case <-time.After(sendTimeout):
+		log.Warn("Could not send notification (timeout)")
+	}
+}
+
+// Notify is a NOTIFY command.
+type Notify struct {
+	Filters []*filter
+	Status  bool
+
+	unsupported bool
+
+	ext *Extension
+}
+
+func (cmd *Notify) Parse(fields []interface{}) error {
+	if len(fields) == 0 {
+		return errors.New("missing NOTIFY arguments")
+	}
+	switch name, _ := fields[0].(string); strings.ToUpper(name) {
+	case none:
+		if len(fields) > 1 {
+			return errors.New("NOTIFY NONE does not take arguments")
+		}
+		return nil
+	case set:
+	default:
+		return errors.New("NOTIFY expects SET or NONE")
+	}
+
+	fields = fields[1:]
+	if len(fields) > 0 {
+		if name, ok := fields[0].(string); ok && strings.ToUpper(name) == status {
+			cmd.Status = true
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return errors.New("missing event groups")
+	}
+
+	for _, field := range fields {
+		group, ok := field.([]interface{})
+		if !ok {
+			return errors.New("event group must be a list")
+		}
+		f, unsupported, err := parseFilter(group)
+		if err != nil {
+			return err
+		}
+		cmd.unsupported = cmd.unsupported || unsupported
+		cmd.Filters = append(cmd.Filters, f)
+	}
+	return nil
+}
+
+func (cmd *Notify) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	if cmd.unsupported {
+		return server.ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusNo,
+			Code:      codeBadEvent,
+			Arguments: []interface{}{supportedEvents},
+			Info:      "Unsupported event",
+		})
+	}
+
+	cmd.ext.setFilters(conn, cmd.Filters)
+
+	if cmd.Status {
+		return cmd.writeStatuses(conn)
+	}
+	return nil
+}
+
+// writeStatuses sends the current STATUS of all mailboxes matching filters.
+func (cmd *Notify) writeStatuses(conn server.Conn) error {
+	ctx := conn.Context()
+	mailboxes, err := ctx.User.ListMailboxes(false)
+	if err != nil {
+		return err
+	}
+
+	m := newMatcher(ctx.User, cmd.ext.delimiter)
+	for _, mbox := range mailboxes {
+		name := mbox.Name()
+		if ctx.Mailbox != nil && ctx.Mailbox.Name() == name {
+			continue
+		}
+		items := (&connState{filters: cmd.Filters}).statusItems(m, name, allEvents)
+		if len(items) == 0 {
+			continue
+		}
+		res, err := getStatus(ctx.User, name, items)
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteResp(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
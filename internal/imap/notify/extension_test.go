@@ -0,0 +1,144 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNotifySet(t *testing.T) {
+	cmd := &Notify{}
+	require.NoError(t, cmd.Parse([]interface{}{
+		"SET", "STATUS",
+		[]interface{}{"selected", []interface{}{"MessageNew", []interface{}{"UID", "FLAGS"}, "MessageExpunge", "FlagChange"}},
+		[]interface{}{"subtree", []interface{}{"Folders", "Labels"}, []interface{}{"MessageNew", "MessageExpunge"}},
+		[]interface{}{"mailboxes", "inbox", "NONE"},
+	}))
+
+	assert.True(t, cmd.Status)
+	assert.False(t, cmd.unsupported)
+	require.Len(t, cmd.Filters, 3)
+
+	assert.Equal(t, filterSelected, cmd.Filters[0].kind)
+	assert.Equal(t, allEvents, cmd.Filters[0].events)
+
+	assert.Equal(t, filterSubtree, cmd.Filters[1].kind)
+	assert.Equal(t, []string{"Folders", "Labels"}, cmd.Filters[1].mailboxes)
+	assert.Equal(t, map[string]bool{eventMessageNew: true, eventMessageExpunge: true}, cmd.Filters[1].events)
+
+	assert.Equal(t, filterMailboxes, cmd.Filters[2].kind)
+	assert.Equal(t, []string{imap.InboxName}, cmd.Filters[2].mailboxes)
+	assert.Empty(t, cmd.Filters[2].events)
+}
+
+func TestParseNotifyErrors(t *testing.T) {
+	tests := [][]interface{}{
+		{},
+		{"NONE", "STATUS"},
+		{"SET"},
+		{"SET", []interface{}{"unknown", []interface{}{"MessageNew", "MessageExpunge"}}},
+		{"SET", []interface{}{"personal", []interface{}{"MessageNew"}}},
+		{"SET", []interface{}{"personal", []interface{}{"FlagChange"}}},
+		{"SET", []interface{}{"mailboxes", []interface{}{"MessageNew", "MessageExpunge"}}},
+	}
+	for _, fields := range tests {
+		assert.Error(t, (&Notify{}).Parse(fields), "%v", fields)
+	}
+
+	cmd := &Notify{}
+	require.NoError(t, cmd.Parse([]interface{}{"SET", []interface{}{"personal", []interface{}{"MailboxName"}}}))
+	assert.True(t, cmd.unsupported)
+}
+
+func TestMatcher(t *testing.T) {
+	m := newMatcher(nil, "/")
+
+	assert.True(t, m.matches(&filter{kind: filterInboxes}, imap.InboxName))
+	assert.False(t, m.matches(&filter{kind: filterInboxes}, "Sent"))
+	assert.True(t, m.matches(&filter{kind: filterPersonal}, "Sent"))
+	assert.False(t, m.matches(&filter{kind: filterSelected}, "Sent"))
+
+	subtree := &filter{kind: filterSubtree, mailboxes: []string{"Folders"}}
+	assert.True(t, m.matches(subtree, "Folders"))
+	assert.True(t, m.matches(subtree, "Folders/a/b"))
+	assert.False(t, m.matches(subtree, "FoldersX"))
+
+	mailboxes := &filter{kind: filterMailboxes, mailboxes: []string{"Folders"}}
+	assert.True(t, m.matches(mailboxes, "Folders"))
+	assert.False(t, m.matches(mailboxes, "Folders/a"))
+}
+
+func TestNotifyNotSelectedMailbox(t *testing.T) {
+	user, err := memory.New().Login("username", "password")
+	require.NoError(t, err)
+	require.NoError(t, user.CreateMailbox("Archive"))
+	archive, err := user.GetMailbox("Archive")
+	require.NoError(t, err)
+
+	responsesCh := make(chan imap.WriterTo, 10)
+	c := &contextConn{ctx: &server.Context{User: user, Mailbox: archive, Responses: responsesCh}}
+
+	ext := NewExtension("/")
+	ext.setFilters(c, []*filter{{kind: filterPersonal, events: allEvents}})
+
+	ext.Notify(newMessageUpdate("username", imap.InboxName))
+	ext.Notify(newMessageUpdate("username", imap.InboxName))
+	ext.Notify(newMessageUpdate("username", "Archive"))
+	ext.Notify(newMessageUpdate("other", imap.InboxName))
+
+	select {
+	case res := <-responsesCh:
+		status, ok := res.(*responses.Status)
+		require.True(t, ok)
+		assert.Equal(t, imap.InboxName, status.Mailbox.Name)
+		assert.Equal(t, uint32(1), status.Mailbox.Messages)
+		assert.Len(t, status.Mailbox.Items, 3)
+		assert.Contains(t, status.Mailbox.Items, imap.MailboxUnseen)
+	case <-time.After(2 * notifyDelay):
+		require.Fail(t, "no notification")
+	}
+
+	time.Sleep(notifyDelay)
+	assert.Empty(t, responsesCh)
+}
+
+func newMessageUpdate(username, mailbox string) *backend.MessageUpdate {
+	update := &backend.MessageUpdate{Message: imap.NewMessage(1, nil)}
+	update.Username = username
+	update.Mailbox = mailbox
+	return update
+}
+
+// contextConn is a connection providing only its context.
+type contextConn struct {
+	server.Conn
+	ctx *server.Context
+}
+
+func (c *contextConn) Context() *server.Context {
+	return c.ctx
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package notify
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// Events are kept uppercase, the names are case-insensitive.
+const (
+	eventMessageNew     = "MESSAGENEW"
+	eventMessageExpunge = "MESSAGEEXPUNGE"
+	eventFlagChange     = "FLAGCHANGE"
+)
+
+// Mailbox specifiers of filters.
+const (
+	filterSelected        = "SELECTED"
+	filterSelectedDelayed = "SELECTED-DELAYED"
+	filterInboxes         = "INBOXES"
+	filterPersonal        = "PERSONAL"
+	filterSubscribed      = "SUBSCRIBED"
+	filterSubtree         = "SUBTREE"
+	filterMailboxes       = "MAILBOXES"
+)
+
+var supportedEvents = []interface{}{"MessageNew", "MessageExpunge", "FlagChange"} //nolint[gochecknoglobals]
+
+var allEvents = map[string]bool{ //nolint[gochecknoglobals]
+	eventMessageNew:     true,
+	eventMessageExpunge: true,
+	eventFlagChange:     true,
+}
+
+// filter is one event group of NOTIFY SET command.
+type filter struct {
+	kind      string
+	mailboxes []string
+	events    map[string]bool
+}
+
+// parseFilter parses event group; unsupported is true when the group
+// contains an event which is valid but not supported.
+func parseFilter(group []interface{}) (f *filter, unsupported bool, err error) {
+	if len(group) < 2 {
+		return nil, false, errors.New("event group must have mailboxes and events")
+	}
+
+	kind, _ := group[0].(string)
+	f = &filter{kind: strings.ToUpper(kind), events: map[string]bool{}}
+	switch f.kind {
+	case filterSelected, filterSelectedDelayed, filterInboxes, filterPersonal, filterSubscribed:
+		group = group[1:]
+	case filterSubtree, filterMailboxes:
+		if len(group) < 3 {
+			return nil, false, errors.New("missing mailboxes of event group")
+		}
+		if f.mailboxes, err = parseMailboxes(group[1]); err != nil {
+			return nil, false, err
+		}
+		group = group[2:]
+	default:
+		return nil, false, errors.New("unknown mailbox specifier " + kind)
+	}
+
+	if len(group) != 1 {
+		return nil, false, errors.New("event group must have one list of events")
+	}
+	if name, ok := group[0].(string); ok && strings.ToUpper(name) == none {
+		return f, false, nil
+	}
+	events, ok := group[0].([]interface{})
+	if !ok {
+		return nil, false, errors.New("events must be a list")
+	}
+	for _, e := range events {
+		name, ok := e.(string)
+		if !ok {
+			// Fetch attributes of MessageNew.
+			continue
+		}
+		name = strings.ToUpper(name)
+		if allEvents[name] {
+			f.events[name] = true
+		} else {
+			unsupported = true
+		}
+	}
+
+	// RFC5465 section 5: MessageNew and MessageExpunge go together and
+	// FlagChange requires both of them.
+	if f.events[eventMessageNew] != f.events[eventMessageExpunge] {
+		return nil, false, errors.New("MessageNew and MessageExpunge must be specified together")
+	}
+	if f.events[eventFlagChange] && !f.events[eventMessageNew] {
+		return nil, false, errors.New("FlagChange requires MessageNew and MessageExpunge")
+	}
+
+	return f, unsupported, nil
+}
+
+func parseMailboxes(field interface{}) ([]string, error) {
+	var names []interface{}
+	if list, ok := field.([]interface{}); ok {
+		names = list
+	} else {
+		names = []interface{}{field}
+	}
+
+	mailboxes := []string{}
+	for _, n := range names {
+		name, ok := n.(string)
+		if !ok {
+			return nil, errors.New("mailbox name must be a string")
+		}
+		name, err := utf7.Decoder.String(name)
+		if err != nil {
+			return nil, err
+		}
+		mailboxes = append(mailboxes, imap.CanonicalMailboxName(name))
+	}
+	return mailboxes, nil
+}
+
+// matcher decides whether mailbox belongs to a filter. List of subscribed
+// mailboxes is loaded only when needed.
+type matcher struct {
+	user      backend.User
+	delimiter string
+
+	subscribed map[string]bool
+}
+
+func newMatcher(user backend.User, delimiter string) *matcher {
+	return &matcher{user: user, delimiter: delimiter}
+}
+
+func (m *matcher) matches(f *filter, name string) bool {
+	switch f.kind {
+	case filterInboxes:
+		return name == imap.InboxName
+	case filterPersonal:
+		return true
+	case filterSubscribed:
+		return m.isSubscribed(name)
+	case filterMailboxes:
+		for _, mailbox := range f.mailboxes {
+			if mailbox == name {
+				return true
+			}
+		}
+	case filterSubtree:
+		for _, mailbox := range f.mailboxes {
+			if mailbox == name || strings.HasPrefix(name, mailbox+m.delimiter) {
+				return true
+			}
+		}
+	}
+	// Selected mailbox is handled by go-imap.
+	return false
+}
+
+func (m *matcher) isSubscribed(name string) bool {
+	if m.subscribed == nil {
+		m.subscribed = map[string]bool{}
+		mailboxes, err := m.user.ListMailboxes(true)
+		if err != nil {
+			log.WithError(err).Warn("Cannot list subscribed mailboxes")
+		}
+		for _, mbox := range mailboxes {
+			m.subscribed[mbox.Name()] = true
+		}
+	}
+	return m.subscribed[name]
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// prefetchSyncCheckInterval is how often the prefetch checks whether the
+// sync finished.
+const prefetchSyncCheckInterval = 30 * time.Second
+
+// prefetcher builds the newest messages of every mailbox of the user in
+// background after the sync finished. Built messages are cached, so the first
+// fetch by client does not wait for the download and decryption.
+type prefetcher struct {
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stopCh    chan struct{}
+}
+
+func newPrefetcher() *prefetcher {
+	return &prefetcher{stopCh: make(chan struct{})}
+}
+
+// stop cancels the prefetch, e.g. when the user is disconnected.
+func (p *prefetcher) stop() {
+	p.stopOnce.Do(func() { close(p.stopCh) })
+}
+
+func (p *prefetcher) isStopped() bool {
+	select {
+	case <-p.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// startPrefetch starts the prefetch after the first login of the user.
+func (iu *imapUser) startPrefetch() {
+	iu.prefetch.startOnce.Do(func() {
+		go func() {
+			defer iu.panicHandler.HandlePanic()
+			iu.prefetchMessages()
+		}()
+	})
+}
+
+func (iu *imapUser) prefetchMessages() {
+	for !iu.storeUser.IsSyncFinished() {
+		select {
+		case <-iu.prefetch.stopCh:
+			return
+		case <-time.After(prefetchSyncCheckInterval):
+		}
+	}
+
+	count := store.GetPrefetchCount()
+	if count == 0 {
+		return
+	}
+
+	log.WithField("address", iu.currentAddressLowercase).WithField("count", count).Debug("Prefetching newest messages")
+	for _, storeMailbox := range iu.storeAddress.ListMailboxes() {
+		if iu.prefetch.isStopped() {
+			return
+		}
+		// Searches list messages of other mailboxes and drafts are not cached.
+		if storeMailbox.IsSearch() || storeMailbox.LabelID() == pmapi.DraftLabel || iu.storeUser.IsMailboxHidden(storeMailbox.LabelID()) {
+			continue
+		}
+		im := newIMAPMailbox(iu.panicHandler, iu, storeMailbox)
+		if err := im.prefetchMessages(count, iu.prefetch); err != nil {
+			im.log.WithError(err).Warn("Prefetch of messages failed")
+			return
+		}
+	}
+}
+
+// prefetchMessages builds the newest count messages of the mailbox which are
+// not cached yet, starting with the newest one.
+func (im *imapMailbox) prefetchMessages(count int, p *prefetcher) error {
+	total, _, _, err := im.storeMailbox.GetStatus()
+	if err != nil || total == 0 {
+		return err
+	}
+
+	apiIDs, err := im.storeMailbox.GetAPIIDsFromSequenceRange(getPrefetchRange(total, count))
+	if err != nil {
+		return err
+	}
+
+	for i := len(apiIDs) - 1; i >= 0; i-- {
+		if p.isStopped() {
+			return nil
+		}
+		storeMessage, err := im.storeMailbox.GetMessage(apiIDs[i])
+		if err != nil {
+			continue
+		}
+		if storeMessage.HasCachedBody() {
+			continue
+		}
+		if _, _, err := im.getBodyStructure(storeMessage); err != nil {
+			// Other messages cannot be built without API either.
+			if err == pmapi.ErrAPINotReachable || err == pmapi.ErrInvalidToken || err == pmapi.ErrUpgradeApplication {
+				return err
+			}
+			im.log.WithError(err).WithField("msgID", apiIDs[i]).Warn("Cannot prefetch message")
+		}
+	}
+	return nil
+}
+
+// getPrefetchRange returns sequence numbers of the newest count messages of
+// the mailbox with total messages.
+func getPrefetchRange(total uint, count int) (first, last uint32) {
+	first = 1
+	if total > uint(count) {
+		first = uint32(total - uint(count) + 1)
+	}
+	return first, uint32(total)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPrefetchRange(t *testing.T) {
+	first, last := getPrefetchRange(5, 20)
+	assert.Equal(t, uint32(1), first)
+	assert.Equal(t, uint32(5), last)
+
+	first, last = getPrefetchRange(100, 20)
+	assert.Equal(t, uint32(81), first)
+	assert.Equal(t, uint32(100), last)
+}
+
+func TestPrefetcherStop(t *testing.T) {
+	p := newPrefetcher()
+	assert.False(t, p.isStopped())
+
+	p.stop()
+	p.stop()
+	assert.True(t, p.isStopped())
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"github.com/emersion/go-imap"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// errVirtualMailbox is returned when client tries to add or remove messages
+// of mailbox which shows messages of other mailboxes, e.g. All Mail.
+var errVirtualMailbox = imapserver.ErrStatusResp(&imap.StatusResp{ //nolint[gochecknoglobals]
+	Type: imap.StatusNo,
+	Code: "CANNOT",
+	Info: "Messages cannot be added to or removed from virtual mailbox",
+})
+
+// readOnlyExtension overrides SELECT and EXAMINE of selectExtension to tell
+// the selected mailbox that it is read-only. go-imap rejects STORE and
+// EXPUNGE itself but FETCH is handled by the mailbox which would otherwise
+// mark the fetched messages as seen. It must be enabled before the other
+// extensions providing SELECT.
+type readOnlyExtension struct {
+	selectExtension imapserver.Extension
+}
+
+func newReadOnlyExtension(selectExtension imapserver.Extension) *readOnlyExtension {
+	return &readOnlyExtension{selectExtension: selectExtension}
+}
+
+func (ext *readOnlyExtension) Capabilities(c imapserver.Conn) []string {
+	return nil
+}
+
+func (ext *readOnlyExtension) Command(name string) imapserver.HandlerFactory {
+	if name != imap.Select && name != imap.Examine {
+		return nil
+	}
+	newHandler := ext.selectExtension.Command(name)
+	if newHandler == nil {
+		return nil
+	}
+	return func() imapserver.Handler {
+		return &selectReadOnly{Handler: newHandler()}
+	}
+}
+
+type selectReadOnly struct {
+	imapserver.Handler
+}
+
+func (cmd *selectReadOnly) Handle(conn imapserver.Conn) error {
+	err := cmd.Handler.Handle(conn)
+	ctx := conn.Context()
+	if mbox, ok := ctx.Mailbox.(*imapMailbox); ok {
+		mbox.readOnly = ctx.MailboxReadOnly
+	}
+	return err
+}
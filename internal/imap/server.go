@@ -21,17 +21,34 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	imapid "github.com/ProtonMail/go-imap-id"
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/imap/binary"
+	"github.com/ProtonMail/proton-bridge/internal/imap/catenate"
+	"github.com/ProtonMail/proton-bridge/internal/imap/compress"
+	"github.com/ProtonMail/proton-bridge/internal/imap/condstore"
+	"github.com/ProtonMail/proton-bridge/internal/imap/esearch"
+	"github.com/ProtonMail/proton-bridge/internal/imap/listextended"
+	"github.com/ProtonMail/proton-bridge/internal/imap/literalplus"
+	"github.com/ProtonMail/proton-bridge/internal/imap/move"
+	"github.com/ProtonMail/proton-bridge/internal/imap/namespace"
+	"github.com/ProtonMail/proton-bridge/internal/imap/notify"
+	"github.com/ProtonMail/proton-bridge/internal/imap/sortthread"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/ProtonMail/proton-bridge/internal/imap/xgm"
+	"github.com/ProtonMail/proton-bridge/internal/imap/xlist"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/crammd5"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/proxyproto"
 	"github.com/emersion/go-imap"
 	imapappendlimit "github.com/emersion/go-imap-appendlimit"
-	imapidle "github.com/emersion/go-imap-idle"
 	imapquota "github.com/emersion/go-imap-quota"
 	imapspecialuse "github.com/emersion/go-imap-specialuse"
 	imapunselect "github.com/emersion/go-imap-unselect"
@@ -43,14 +60,20 @@ import (
 type imapServer struct {
 	server        *imapserver.Server
 	eventListener listener.Listener
+	proxyProtocol bool
+	trace         *traceExtension
 }
 
 // NewIMAPServer constructs a new IMAP server configured with the given options.
-func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, imapBackend *imapBackend, eventListener listener.Listener) *imapServer { //nolint[golint]
+// The server listens on the host, use bridge.Host to accept only local connections.
+// With proxyProtocol the connections have to start with PROXY protocol header.
+// With requireTLS the login is disabled until the connection is encrypted.
+func NewIMAPServer(debugClient, debugServer bool, host string, port int, proxyProtocol, requireTLS bool, tls *tls.Config, imapBackend *imapBackend, eventListener listener.Listener) *imapServer { //nolint[golint]
 	s := imapserver.New(imapBackend)
-	s.Addr = fmt.Sprintf("%v:%v", bridge.Host, port)
+	s.Addr = net.JoinHostPort(host, strconv.Itoa(port))
 	s.TLSConfig = tls
-	s.AllowInsecureAuth = true
+	// Without TLS go-imap advertises LOGINDISABLED and refuses LOGIN and AUTHENTICATE.
+	s.AllowInsecureAuth = !requireTLS
 	s.ErrorLog = newServerErrorLogger("server-imap")
 	s.AutoLogout = 30 * time.Minute
 
@@ -72,17 +95,37 @@ func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, ima
 	}
 
 	s.EnableAuth(sasl.Login, func(conn imapserver.Conn) sasl.Server {
-		conn.Server().ForEachConn(func(candidate imapserver.Conn) {
-			if id, ok := candidate.(imapid.Conn); ok {
-				if conn.Context() == candidate.Context() {
-					imapBackend.setLastMailClient(id.ID())
-					return
-				}
+		return sasl.NewLoginServer(func(address, password string) error {
+			user, err := conn.Server().Backend.Login(address, password)
+			if err != nil {
+				return err
 			}
+
+			ctx := conn.Context()
+			ctx.State = imap.AuthenticatedState
+			ctx.User = user
+			return nil
 		})
+	})
 
-		return sasl.NewLoginServer(func(address, password string) error {
-			user, err := conn.Server().Backend.Login(address, password)
+	// There is no OAuth provider, the bearer token is the bridge password.
+	s.EnableAuth(sasl.OAuthBearer, func(conn imapserver.Conn) sasl.Server {
+		return sasl.NewOAuthBearerServer(func(opts sasl.OAuthBearerOptions) *sasl.OAuthBearerError {
+			user, err := conn.Server().Backend.Login(opts.Username, opts.Token)
+			if err != nil {
+				return &sasl.OAuthBearerError{Status: "invalid_token", Schemes: "bearer"}
+			}
+
+			ctx := conn.Context()
+			ctx.State = imap.AuthenticatedState
+			ctx.User = user
+			return nil
+		})
+	})
+
+	s.EnableAuth(crammd5.Mechanism, func(conn imapserver.Conn) sasl.Server {
+		return crammd5.NewServer(bridge.Host, func(address, challenge, digest string) error {
+			user, err := imapBackend.loginCRAMMD5(address, challenge, digest)
 			if err != nil {
 				return err
 			}
@@ -94,29 +137,61 @@ func NewIMAPServer(debugClient, debugServer bool, port int, tls *tls.Config, ima
 		})
 	})
 
+	notifyExtension := notify.NewExtension(store.PathDelimiter)
+	selectedUpdatesExtension := newSelectedUpdatesExtension()
+	imapBackend.forwardUpdates(notifyExtension, selectedUpdatesExtension)
+
+	traceExtension := newTraceExtension()
+	moveExtension := move.NewExtension()
+	uidplusExtension := uidplus.NewExtension()
+	condstoreExtension := condstore.NewExtension()
+
 	s.Enable(
-		imapidle.NewExtension(),
-		//imapmove.NewExtension(), // extension is not fully implemented: if UIDPLUS exists it MUST return COPYUID and EXPUNGE continuous responses
+		traceExtension, // Must be the first to access the connection of go-imap.
+		newReadOnlyExtension(condstoreExtension),
+		esearch.NewExtension(moveExtension, uidplusExtension, condstoreExtension),
+		newIDLEExtension(),
+		moveExtension,
 		imapspecialuse.NewExtension(),
-		imapid.NewExtension(serverID),
 		imapquota.NewExtension(),
 		imapappendlimit.NewExtension(),
 		imapunselect.NewExtension(),
-		uidplus.NewExtension(),
+		uidplusExtension,
+		condstoreExtension,
+		notifyExtension,
+		compress.NewExtension(),
+		xlist.NewExtension(),
+		xgm.NewExtension(),
+		literalplus.NewExtension(),
+		binary.NewExtension(),
+		catenate.NewExtension(),
+		sortthread.NewExtension(),
+		listextended.NewExtension(),
+		namespace.NewExtension(store.PathDelimiter),
+		selectedUpdatesExtension,
+		newClientIDExtension(serverID),
 	)
 
 	return &imapServer{
 		server:        s,
 		eventListener: eventListener,
+		proxyProtocol: proxyProtocol,
+		trace:         traceExtension,
 	}
 }
 
 // Starts the server.
 func (s *imapServer) ListenAndServe() {
 	go s.monitorDisconnectedUsers()
+	go s.monitorTraceRequests()
 
-	log.Info("IMAP server listening at ", s.server.Addr)
-	err := s.server.ListenAndServe()
+	log.WithField("proxyProtocol", s.proxyProtocol).Info("IMAP server listening at ", s.server.Addr)
+	var err error
+	if s.proxyProtocol {
+		err = s.listenAndServeProxyProtocol()
+	} else {
+		err = s.server.ListenAndServe()
+	}
 	if err != nil {
 		s.eventListener.Emit(events.ErrorEvent, "IMAP failed: "+err.Error())
 		log.Error("IMAP failed: ", err)
@@ -127,6 +202,40 @@ func (s *imapServer) ListenAndServe() {
 	log.Info("IMAP server stopped")
 }
 
+// ListenAndServeIMAPS accepts implicit TLS connections (IMAPS) on the port
+// in addition to ListenAndServe. Both listeners are served by the same server
+// so connections of both get the updates of the backend.
+func (s *imapServer) ListenAndServeIMAPS(port int, tlsConfig *tls.Config) {
+	host, _, _ := net.SplitHostPort(s.server.Addr)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	log.WithField("proxyProtocol", s.proxyProtocol).Info("IMAPS server listening at ", addr)
+	tcpListener, err := net.Listen("tcp", addr)
+	if err == nil {
+		var l net.Listener = tcpListener
+		if s.proxyProtocol {
+			// PROXY header is before TLS handshake because the proxy passes TLS through.
+			l = proxyproto.NewListener(l)
+		}
+		err = s.server.Serve(tls.NewListener(l, tlsConfig))
+	}
+	if err != nil {
+		s.eventListener.Emit(events.ErrorEvent, "IMAPS failed: "+err.Error())
+		log.Error("IMAPS failed: ", err)
+		return
+	}
+
+	log.Info("IMAPS server stopped")
+}
+
+func (s *imapServer) listenAndServeProxyProtocol() error {
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(proxyproto.NewListener(l))
+}
+
 // Stops the server.
 func (s *imapServer) Close() {
 	_ = s.server.Close()
@@ -149,6 +258,22 @@ func (s *imapServer) monitorDisconnectedUsers() {
 	}
 }
 
+// monitorTraceRequests enables the trace of the next connection. The event
+// data is the path of the trace file, empty path cancels the request.
+func (s *imapServer) monitorTraceRequests() {
+	ch := make(chan string)
+	s.eventListener.Add(events.TraceIMAPConnectionEvent, ch)
+
+	for path := range ch {
+		if path == "" {
+			log.Info("Cancelling trace of the next IMAP connection")
+		} else {
+			log.WithField("path", path).Info("Trace of the next IMAP connection requested")
+		}
+		s.trace.traceNextConnection(path)
+	}
+}
+
 // logWithFields is used for debuging with additional field.
 type logWithFields struct {
 	log    *logrus.Entry
@@ -0,0 +1,210 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAddress  = "user@pm.me"
+	testPassword = "bridgepassword"
+)
+
+type testPanicHandler struct{}
+
+func (ph *testPanicHandler) HandlePanic() {}
+
+type testConfig struct{ dir string }
+
+func (c *testConfig) GetEventsPath() string    { return filepath.Join(c.dir, "events.json") }
+func (c *testConfig) GetDBDir() string         { return c.dir }
+func (c *testConfig) GetIMAPCachePath() string { return filepath.Join(c.dir, "imap.json") }
+func (c *testConfig) GetTLSCertPath() string   { return filepath.Join(c.dir, "cert.pem") }
+func (c *testConfig) GetTLSKeyPath() string    { return filepath.Join(c.dir, "key.pem") }
+
+type testBridge struct{}
+
+func (b *testBridge) SetCurrentClient(clientName, clientVersion string) {}
+
+func (b *testBridge) GetUser(query string) (bridgeUser, error) {
+	if query != testAddress {
+		return nil, errors.New("user not found")
+	}
+	return &testBridgeUser{}, nil
+}
+
+// testBridgeUser implements only what is needed to log in, the other
+// methods of the embedded interface are not called.
+type testBridgeUser struct{ bridgeUser }
+
+func (u *testBridgeUser) ID() string { return "userID" }
+
+func (u *testBridgeUser) CheckBridgeLogin(password string) error {
+	if password != testPassword {
+		return errors.New("wrong password")
+	}
+	return nil
+}
+
+func (u *testBridgeUser) IsCombinedAddressMode() bool                   { return true }
+func (u *testBridgeUser) GetPrimaryAddress() string                     { return testAddress }
+func (u *testBridgeUser) GetAddressID(address string) (string, error)   { return "addressID", nil }
+func (u *testBridgeUser) SetIMAPIdleUpdateChannel()                     {}
+func (u *testBridgeUser) GetStore() storeUserProvider                   { return &testStoreUser{} }
+func (u *testBridgeUser) GetTemporaryPMAPIClient() bridge.PMAPIProvider { return nil }
+
+type testStoreUser struct{ storeUserProvider }
+
+func (u *testStoreUser) GetAddress(addressID string) (storeAddressProvider, error) {
+	return &testStoreAddress{}, nil
+}
+
+func (u *testStoreUser) IsSyncFinished() bool              { return false }
+func (u *testStoreUser) GetMaxMessageSize() (int64, error) { return 0, nil }
+
+type testStoreAddress struct{ storeAddressProvider }
+
+func (a *testStoreAddress) AddressID() string { return "addressID" }
+
+func startTestServer(t *testing.T, requireTLS bool) (*imapServer, string) {
+	dir, err := ioutil.TempDir("", "imap-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	cfg := &testConfig{dir: dir}
+	tlsConfig, err := config.GetTLSConfig(cfg)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	eventListener := listener.New()
+	backend := newIMAPBackend(&testPanicHandler{}, cfg, &testBridge{}, eventListener)
+	s := NewIMAPServer(false, false, "127.0.0.1", port, false, requireTLS, tlsConfig, backend, eventListener)
+	go s.ListenAndServe()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return s, addr
+}
+
+func TestRequireTLS(t *testing.T) {
+	s, addr := startTestServer(t, true)
+	c, r := dial(t, addr)
+	defer closeTestServer(t, s, c)
+
+	send(t, c, "a CAPABILITY")
+	assert.Contains(t, readUntilTag(t, r, "a "), "LOGINDISABLED")
+
+	send(t, c, fmt.Sprintf("b LOGIN %q %q", testAddress, testPassword))
+	assert.False(t, strings.HasPrefix(lastLine(readUntilTag(t, r, "b ")), "b OK"))
+
+	send(t, c, "c STARTTLS")
+	readUntilTag(t, r, "c OK")
+	tlsConn := tls.Client(c, &tls.Config{InsecureSkipVerify: true}) //nolint[gosec]
+	require.NoError(t, tlsConn.Handshake())
+	r = bufio.NewReader(tlsConn)
+
+	send(t, tlsConn, "d CAPABILITY")
+	assert.NotContains(t, readUntilTag(t, r, "d "), "LOGINDISABLED")
+
+	send(t, tlsConn, fmt.Sprintf("e LOGIN %q %q", testAddress, testPassword))
+	assert.True(t, strings.HasPrefix(lastLine(readUntilTag(t, r, "e ")), "e OK"))
+}
+
+func TestAllowInsecureLogin(t *testing.T) {
+	s, addr := startTestServer(t, false)
+	c, r := dial(t, addr)
+	defer closeTestServer(t, s, c)
+
+	send(t, c, fmt.Sprintf("a LOGIN %q %q", testAddress, testPassword))
+	assert.True(t, strings.HasPrefix(lastLine(readUntilTag(t, r, "a ")), "a OK"))
+}
+
+// closeTestServer closes the client connection and waits until the server
+// drops it before closing the server, go-imap closing connections from other
+// goroutine is racy.
+func closeTestServer(t *testing.T, s *imapServer, c net.Conn) {
+	require.NoError(t, c.Close())
+	require.Eventually(t, func() bool {
+		conns := 0
+		s.server.ForEachConn(func(imapserver.Conn) { conns++ })
+		return conns == 0
+	}, time.Second, 10*time.Millisecond)
+	s.Close()
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	r := bufio.NewReader(c)
+	readUntilTag(t, r, "*")
+	return c, r
+}
+
+func send(t *testing.T, c net.Conn, command string) {
+	_, err := fmt.Fprintf(c, "%s\r\n", command)
+	require.NoError(t, err)
+}
+
+// readUntilTag returns all lines up to the one starting with the prefix.
+func readUntilTag(t *testing.T, r *bufio.Reader, prefix string) string {
+	lines := ""
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		lines += line
+		if strings.HasPrefix(line, prefix) {
+			return lines
+		}
+	}
+}
+
+func lastLine(lines string) string {
+	lines = strings.TrimSuffix(lines, "\r\n")
+	return lines[strings.LastIndex(lines, "\n")+1:]
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package sortthread implements IMAP SORT and THREAD extensions as defined in
+// RFC 5256. Both THREAD=ORDEREDSUBJECT and THREAD=REFERENCES are supported.
+package sortthread
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capabilities of extensions.
+const (
+	SortCapability                 = "SORT"
+	ThreadOrderedSubjectCapability = "THREAD=" + OrderedSubject
+	ThreadReferencesCapability     = "THREAD=" + References
+)
+
+// Threading algorithms.
+const (
+	OrderedSubject = "ORDEREDSUBJECT"
+	References     = "REFERENCES"
+)
+
+const (
+	sort   = "SORT"
+	thread = "THREAD"
+
+	codeBadCharset = "BADCHARSET"
+)
+
+var errNotSupported = errors.New("mailbox does not support sorting") //nolint[gochecknoglobals]
+
+// Message is the data of message needed to sort or thread it.
+type Message struct {
+	// ID is UID or sequence number, whichever is requested.
+	ID uint32
+
+	// Date is the sent date or the internal date if the sent date is unknown.
+	Date    time.Time
+	Arrival time.Time
+	Size    uint32
+	Subject string
+
+	// From, To and Cc are the first addresses of the fields.
+	From, To, Cc string
+
+	// MessageID and References are message IDs with angle brackets; the last
+	// reference is the parent of the message.
+	MessageID  string
+	References []string
+}
+
+// Mailbox is a backend mailbox which can provide data for sorting.
+type Mailbox interface {
+	backend.Mailbox
+
+	// SortThreadMessages returns messages matching the criteria. ID of each
+	// message is UID if uid is true or sequence number otherwise.
+	SortThreadMessages(uid bool, criteria *imap.SearchCriteria) ([]*Message, error)
+}
+
+// Sort is a SORT command.
+type Sort struct {
+	Criteria       []SortCriterion
+	Charset        string
+	SearchCriteria *imap.SearchCriteria
+}
+
+func (cmd *Sort) Parse(fields []interface{}) (err error) {
+	if len(fields) < 3 {
+		return errors.New("no enough arguments")
+	}
+	criteria, ok := fields[0].([]interface{})
+	if !ok {
+		return errors.New("sort criteria must be a list")
+	}
+	if cmd.Criteria, err = parseSortCriteria(criteria); err != nil {
+		return err
+	}
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("charset must be a string")
+	}
+	cmd.SearchCriteria = &imap.SearchCriteria{}
+	return cmd.SearchCriteria.Parse(fields[2:])
+}
+
+func (cmd *Sort) handle(uid bool, conn server.Conn) error {
+	msgs, err := getMessages(uid, conn, cmd.Charset, cmd.SearchCriteria)
+	if err != nil {
+		return err
+	}
+	sortMessages(msgs, cmd.Criteria)
+
+	fields := []interface{}{sort}
+	for _, msg := range msgs {
+		fields = append(fields, msg.ID)
+	}
+	return conn.WriteResp(imap.NewUntaggedResp(fields))
+}
+
+func (cmd *Sort) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Sort) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+// Thread is a THREAD command.
+type Thread struct {
+	Algorithm      string
+	Charset        string
+	SearchCriteria *imap.SearchCriteria
+}
+
+func (cmd *Thread) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("no enough arguments")
+	}
+	algorithm, ok := fields[0].(string)
+	if !ok {
+		return errors.New("threading algorithm must be a string")
+	}
+	cmd.Algorithm = strings.ToUpper(algorithm)
+	if cmd.Algorithm != OrderedSubject && cmd.Algorithm != References {
+		return errors.New("unsupported threading algorithm")
+	}
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("charset must be a string")
+	}
+	cmd.SearchCriteria = &imap.SearchCriteria{}
+	return cmd.SearchCriteria.Parse(fields[2:])
+}
+
+func (cmd *Thread) handle(uid bool, conn server.Conn) error {
+	msgs, err := getMessages(uid, conn, cmd.Charset, cmd.SearchCriteria)
+	if err != nil {
+		return err
+	}
+
+	var threads []*MessageThread
+	if cmd.Algorithm == OrderedSubject {
+		threads = threadOrderedSubject(msgs)
+	} else {
+		threads = threadReferences(msgs)
+	}
+	return conn.WriteResp(&threadResp{threads: threads})
+}
+
+func (cmd *Thread) Handle(conn server.Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Thread) UidHandle(conn server.Conn) error { //nolint[golint]
+	return cmd.handle(true, conn)
+}
+
+func getMessages(uid bool, conn server.Conn, charset string, criteria *imap.SearchCriteria) ([]*Message, error) {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return nil, server.ErrNoMailboxSelected
+	}
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		return nil, errNotSupported
+	}
+	if charset = strings.ToUpper(charset); charset != "UTF-8" && charset != "US-ASCII" {
+		return nil, server.ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusNo,
+			Code:      codeBadCharset,
+			Arguments: []interface{}{[]interface{}{"UTF-8", "US-ASCII"}},
+			Info:      "Unsupported charset",
+		})
+	}
+	return mbox.SortThreadMessages(uid, criteria)
+}
+
+type extension struct{}
+
+// NewExtension of SORT and THREAD.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{SortCapability, ThreadOrderedSubjectCapability, ThreadReferencesCapability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	switch name {
+	case sort:
+		return func() server.Handler { return &Sort{} }
+	case thread:
+		return func() server.Handler { return &Thread{} }
+	}
+	return nil
+}
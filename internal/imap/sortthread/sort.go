@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sortthread
+
+import (
+	"errors"
+	gosort "sort"
+	"strings"
+)
+
+// Sort keys.
+const (
+	SortArrival = "ARRIVAL"
+	SortCc      = "CC"
+	SortDate    = "DATE"
+	SortFrom    = "FROM"
+	SortSize    = "SIZE"
+	SortSubject = "SUBJECT"
+	SortTo      = "TO"
+
+	sortReverse = "REVERSE"
+)
+
+// SortCriterion is a sort key optionally in the reverse order.
+type SortCriterion struct {
+	Key     string
+	Reverse bool
+}
+
+func parseSortCriteria(fields []interface{}) ([]SortCriterion, error) {
+	criteria := []SortCriterion{}
+	reverse := false
+	for _, f := range fields {
+		key, ok := f.(string)
+		if !ok {
+			return nil, errors.New("sort key must be a string")
+		}
+		key = strings.ToUpper(key)
+		switch key {
+		case sortReverse:
+			reverse = true
+			continue
+		case SortArrival, SortCc, SortDate, SortFrom, SortSize, SortSubject, SortTo:
+		default:
+			return nil, errors.New("unsupported sort key " + key)
+		}
+		criteria = append(criteria, SortCriterion{Key: key, Reverse: reverse})
+		reverse = false
+	}
+	if len(criteria) == 0 || reverse {
+		return nil, errors.New("missing sort key")
+	}
+	return criteria, nil
+}
+
+// sortMessages sorts messages by criteria. Messages equal by all criteria
+// are in the order of the mailbox.
+func sortMessages(msgs []*Message, criteria []SortCriterion) {
+	gosort.SliceStable(msgs, func(i, j int) bool {
+		for _, criterion := range criteria {
+			result := compare(msgs[i], msgs[j], criterion.Key)
+			if criterion.Reverse {
+				result = -result
+			}
+			if result != 0 {
+				return result < 0
+			}
+		}
+		return msgs[i].ID < msgs[j].ID
+	})
+}
+
+func compare(a, b *Message, key string) int {
+	switch key {
+	case SortArrival:
+		return compareInt(a.Arrival.Unix(), b.Arrival.Unix())
+	case SortDate:
+		return compareInt(a.Date.Unix(), b.Date.Unix())
+	case SortSize:
+		return compareInt(int64(a.Size), int64(b.Size))
+	case SortSubject:
+		aSubject, _ := baseSubject(a.Subject)
+		bSubject, _ := baseSubject(b.Subject)
+		return strings.Compare(strings.ToUpper(aSubject), strings.ToUpper(bSubject))
+	case SortFrom:
+		return compareAddresses(a.From, b.From)
+	case SortTo:
+		return compareAddresses(a.To, b.To)
+	case SortCc:
+		return compareAddresses(a.Cc, b.Cc)
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareAddresses compares the local parts of addresses.
+func compareAddresses(a, b string) int {
+	return strings.Compare(strings.ToUpper(addrMailbox(a)), strings.ToUpper(addrMailbox(b)))
+}
+
+func addrMailbox(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[:i]
+	}
+	return address
+}
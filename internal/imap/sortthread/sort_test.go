@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sortthread
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSortCriteria(t *testing.T) {
+	criteria, err := parseSortCriteria([]interface{}{"reverse", "DATE", "subject", "REVERSE", "size"})
+	require.NoError(t, err)
+	assert.Equal(t, []SortCriterion{
+		{Key: SortDate, Reverse: true},
+		{Key: SortSubject},
+		{Key: SortSize, Reverse: true},
+	}, criteria)
+
+	for _, fields := range [][]interface{}{
+		{},
+		{"REVERSE"},
+		{"DATE", "REVERSE"},
+		{"UNKNOWN"},
+		{[]interface{}{"DATE"}},
+	} {
+		_, err := parseSortCriteria(fields)
+		assert.Error(t, err, fields)
+	}
+}
+
+func TestSortMessages(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	msgs := []*Message{
+		{ID: 1, Date: day(3), Arrival: day(1), Size: 30, Subject: "Re: b", From: "Bob@example.com", To: "z@example.com"},
+		{ID: 2, Date: day(1), Arrival: day(2), Size: 10, Subject: "a", From: "alice@example.com", Cc: "c@example.com"},
+		{ID: 3, Date: day(2), Arrival: day(3), Size: 20, Subject: "B", From: "carol@example.com", To: "a@example.com"},
+		{ID: 4, Date: day(2), Arrival: day(3), Size: 20, Subject: "[list] a", From: "bob@other.com"},
+	}
+
+	tests := []struct {
+		criteria []SortCriterion
+		want     []uint32
+	}{
+		{[]SortCriterion{{Key: SortArrival}}, []uint32{1, 2, 3, 4}},
+		{[]SortCriterion{{Key: SortArrival, Reverse: true}}, []uint32{3, 4, 2, 1}},
+		{[]SortCriterion{{Key: SortDate}}, []uint32{2, 3, 4, 1}},
+		{[]SortCriterion{{Key: SortSize}}, []uint32{2, 3, 4, 1}},
+		{[]SortCriterion{{Key: SortSubject}}, []uint32{2, 4, 1, 3}},
+		{[]SortCriterion{{Key: SortSubject}, {Key: SortDate, Reverse: true}}, []uint32{4, 2, 1, 3}},
+		{[]SortCriterion{{Key: SortFrom}}, []uint32{2, 1, 4, 3}},
+		{[]SortCriterion{{Key: SortTo}}, []uint32{2, 4, 3, 1}},
+		{[]SortCriterion{{Key: SortCc, Reverse: true}}, []uint32{2, 1, 3, 4}},
+	}
+	for _, test := range tests {
+		sorted := append([]*Message{}, msgs...)
+		sortMessages(sorted, test.criteria)
+		ids := []uint32{}
+		for _, msg := range sorted {
+			ids = append(ids, msg.ID)
+		}
+		assert.Equal(t, test.want, ids, test.criteria)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sortthread
+
+import (
+	"regexp"
+	"strings"
+)
+
+var ( //nolint[gochecknoglobals]
+	whitespaceRegexp = regexp.MustCompile(`[\t\r\n ]+`)
+	trailerRegexp    = regexp.MustCompile(`(?i)\(fwd\)$`)
+	leaderRegexp     = regexp.MustCompile(`(?i)^(\[[^\[\]]*\] *)*(re|fwd?) *(\[[^\[\]]*\] *)?:`)
+	blobRegexp       = regexp.MustCompile(`^\[[^\[\]]*\] *`)
+	fwdHeaderRegexp  = regexp.MustCompile(`(?i)^\[fwd:(.*)\]$`)
+)
+
+// baseSubject returns the base subject as defined in RFC 5256 section 2.1
+// and whether the subject indicates reply or forward.
+func baseSubject(subject string) (base string, isReply bool) {
+	base = whitespaceRegexp.ReplaceAllString(subject, " ")
+
+	for {
+		// Step 2: remove all trailing (fwd) and whitespace.
+		for {
+			base = strings.TrimRight(base, " ")
+			if !trailerRegexp.MatchString(base) {
+				break
+			}
+			base = trailerRegexp.ReplaceAllString(base, "")
+			isReply = true
+		}
+
+		// Steps 3 and 4: remove leaders and blobs until nothing changes.
+		for {
+			base = strings.TrimLeft(base, " ")
+			if leader := leaderRegexp.FindString(base); leader != "" {
+				base = base[len(leader):]
+				isReply = true
+				continue
+			}
+			if blob := blobRegexp.FindString(base); blob != "" && strings.TrimSpace(base[len(blob):]) != "" {
+				base = base[len(blob):]
+				continue
+			}
+			break
+		}
+
+		// Step 5: remove [fwd: ...] wrapper and start again.
+		match := fwdHeaderRegexp.FindStringSubmatch(base)
+		if match == nil {
+			return base, isReply
+		}
+		base = match[1]
+		isReply = true
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sortthread
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    string
+		isReply bool
+	}{
+		{"", "", false},
+		{"Hello", "Hello", false},
+		{"  Hello \t world  ", "Hello world", false},
+		{"Re: Hello", "Hello", true},
+		{"RE:Hello", "Hello", true},
+		{"Fwd: Fw: re: Hello", "Hello", true},
+		{"Re[2]: Hello", "Hello", true},
+		{"Hello (fwd)", "Hello", true},
+		{"Hello (FWD) (fwd)", "Hello", true},
+		{"[PATCH] Hello", "Hello", false},
+		{"[list] Re: [PATCH] Hello", "Hello", true},
+		{"[PATCH]", "[PATCH]", false},
+		{"[Fwd: Re: Hello]", "Hello", true},
+		{"[fwd: Hello (fwd)]", "Hello", true},
+		{"Reply me", "Reply me", false},
+	}
+	for _, test := range tests {
+		base, isReply := baseSubject(test.subject)
+		assert.Equal(t, test.want, base, test.subject)
+		assert.Equal(t, test.isReply, isReply, test.subject)
+	}
+}
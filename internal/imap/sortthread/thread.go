@@ -0,0 +1,342 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sortthread
+
+import (
+	"bytes"
+	gosort "sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// MessageThread is a node of the thread tree. ID is zero for a missing
+// parent of several messages.
+type MessageThread struct {
+	ID       uint32
+	Children []*MessageThread
+}
+
+type threadResp struct {
+	threads []*MessageThread
+}
+
+// WriteTo writes the response already formatted because the nested lists
+// of THREAD response do not have spaces between them.
+func (r *threadResp) WriteTo(w *imap.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("* " + thread)
+	if len(r.threads) != 0 {
+		b.WriteString(" ")
+	}
+	for _, t := range r.threads {
+		b.WriteString("(" + formatThread(t) + ")")
+	}
+	b.WriteString("\r\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func formatThread(t *MessageThread) string {
+	if t.ID == 0 {
+		return formatNested(t.Children)
+	}
+	members := []string{strconv.FormatUint(uint64(t.ID), 10)}
+	for len(t.Children) == 1 && t.Children[0].ID != 0 {
+		t = t.Children[0]
+		members = append(members, strconv.FormatUint(uint64(t.ID), 10))
+	}
+	if len(t.Children) != 0 {
+		members = append(members, formatNested(t.Children))
+	}
+	return strings.Join(members, " ")
+}
+
+func formatNested(threads []*MessageThread) string {
+	nested := ""
+	for _, t := range threads {
+		nested += "(" + formatThread(t) + ")"
+	}
+	return nested
+}
+
+// threadOrderedSubject threads messages by the ORDEREDSUBJECT algorithm:
+// messages with the same base subject are children of the oldest one.
+func threadOrderedSubject(msgs []*Message) []*MessageThread {
+	sorted := make([]*Message, len(msgs))
+	copy(sorted, msgs)
+	sortMessages(sorted, []SortCriterion{{Key: SortSubject}, {Key: SortDate}})
+
+	threads := []*MessageThread{}
+	dates := map[*MessageThread]int64{}
+	lastSubject := ""
+	var parent *MessageThread
+	for _, msg := range sorted {
+		subject, _ := baseSubject(msg.Subject)
+		subject = strings.ToUpper(subject)
+		if parent == nil || subject != lastSubject {
+			parent = &MessageThread{ID: msg.ID}
+			threads = append(threads, parent)
+			dates[parent] = msg.Date.Unix()
+			lastSubject = subject
+			continue
+		}
+		parent.Children = append(parent.Children, &MessageThread{ID: msg.ID})
+	}
+
+	gosort.SliceStable(threads, func(i, j int) bool {
+		if dates[threads[i]] != dates[threads[j]] {
+			return dates[threads[i]] < dates[threads[j]]
+		}
+		return threads[i].ID < threads[j].ID
+	})
+	return threads
+}
+
+type container struct {
+	msg      *Message
+	parent   *container
+	children []*container
+}
+
+func (c *container) setParent(parent *container) {
+	if c.parent != nil {
+		siblings := c.parent.children
+		for i, sibling := range siblings {
+			if sibling == c {
+				c.parent.children = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+	c.parent = parent
+	if parent != nil {
+		parent.children = append(parent.children, c)
+	}
+}
+
+// isAncestorOf returns true if c is other or any of its parents.
+func (c *container) isAncestorOf(other *container) bool {
+	for ; other != nil; other = other.parent {
+		if other == c {
+			return true
+		}
+	}
+	return false
+}
+
+// firstMessage returns the message of the container or of its first child
+// in case of a missing message.
+func (c *container) firstMessage() *Message {
+	for ; c.msg == nil && len(c.children) != 0; c = c.children[0] {
+	}
+	return c.msg
+}
+
+// threadReferences threads messages by the REFERENCES algorithm as
+// described in RFC 5256 section 3.
+func threadReferences(msgs []*Message) []*MessageThread {
+	all := []*container{}
+	byID := map[string]*container{}
+	getContainer := func(id string) *container {
+		c, ok := byID[id]
+		if !ok {
+			c = &container{}
+			byID[id] = c
+			all = append(all, c)
+		}
+		return c
+	}
+
+	// Step 1: link messages by their references.
+	for _, msg := range msgs {
+		var c *container
+		if existing, ok := byID[msg.MessageID]; msg.MessageID == "" || (ok && existing.msg != nil) {
+			c = &container{}
+			all = append(all, c)
+		} else {
+			c = getContainer(msg.MessageID)
+		}
+		c.msg = msg
+
+		var prev *container
+		for _, reference := range msg.References {
+			ref := getContainer(reference)
+			if prev != nil && ref.parent == nil && !ref.isAncestorOf(prev) {
+				ref.setParent(prev)
+			}
+			prev = ref
+		}
+		if prev != nil && c.isAncestorOf(prev) {
+			prev = nil
+		}
+		c.setParent(prev)
+	}
+
+	// Steps 2 to 4: gather, prune and sort the root set.
+	roots := []*container{}
+	for _, c := range all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	roots = pruneContainers(roots, true)
+	sortContainers(roots)
+
+	// Steps 5 and 6: group by subject and sort all siblings.
+	roots = groupBySubject(roots)
+	for _, c := range roots {
+		sortContainersRecursively(c.children)
+	}
+	sortContainers(roots)
+
+	return toMessageThreads(roots)
+}
+
+// pruneContainers removes empty containers and replaces containers
+// without message by their children, except on the root level where
+// such container is kept if it has more than one child.
+func pruneContainers(list []*container, isRoot bool) []*container {
+	pruned := []*container{}
+	for _, c := range list {
+		c.children = pruneContainers(c.children, false)
+		if c.msg == nil {
+			if len(c.children) == 0 {
+				continue
+			}
+			if !isRoot || len(c.children) == 1 {
+				for _, child := range c.children {
+					child.parent = c.parent
+				}
+				pruned = append(pruned, c.children...)
+				continue
+			}
+		}
+		pruned = append(pruned, c)
+	}
+	return pruned
+}
+
+func sortContainers(list []*container) {
+	gosort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].firstMessage(), list[j].firstMessage()
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.ID < b.ID
+	})
+}
+
+func sortContainersRecursively(list []*container) {
+	for _, c := range list {
+		sortContainersRecursively(c.children)
+	}
+	sortContainers(list)
+}
+
+func containerSubject(c *container) (string, bool) {
+	subject, isReply := baseSubject(c.firstMessage().Subject)
+	return strings.ToUpper(subject), isReply
+}
+
+// groupBySubject merges root threads with the same base subject as
+// described in step 5 of the REFERENCES algorithm.
+func groupBySubject(roots []*container) []*container { //nolint[gocyclo]
+	table := map[string]*container{}
+	for _, c := range roots {
+		subject, isReply := containerSubject(c)
+		if subject == "" {
+			continue
+		}
+		old, ok := table[subject]
+		if !ok ||
+			(c.msg == nil && old.msg != nil) ||
+			(old.msg != nil && c.msg != nil && !isReply && isContainerReply(old)) {
+			table[subject] = c
+		}
+	}
+
+	merged := []*container{}
+	for _, c := range roots {
+		subject, isReply := containerSubject(c)
+		target, ok := table[subject]
+		if c.parent != nil {
+			continue
+		}
+		if subject == "" || !ok || target == c {
+			merged = append(merged, c)
+			continue
+		}
+
+		switch {
+		case target.msg == nil && c.msg == nil:
+			for _, child := range append([]*container{}, c.children...) {
+				child.setParent(target)
+			}
+		case target.msg == nil:
+			c.setParent(target)
+		case isReply && !isContainerReply(target):
+			c.setParent(target)
+		default:
+			dummy := &container{}
+			if !replaceContainer(merged, target, dummy) {
+				merged = append(merged, dummy)
+			}
+			table[subject] = dummy
+			target.setParent(dummy)
+			c.setParent(dummy)
+		}
+	}
+
+	// Keep only containers which stayed on the root level.
+	result := []*container{}
+	for _, c := range merged {
+		if c.parent == nil {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func isContainerReply(c *container) bool {
+	_, isReply := containerSubject(c)
+	return isReply
+}
+
+func replaceContainer(list []*container, old, replacement *container) bool {
+	for i, c := range list {
+		if c == old {
+			list[i] = replacement
+			return true
+		}
+	}
+	return false
+}
+
+func toMessageThreads(list []*container) []*MessageThread {
+	threads := []*MessageThread{}
+	for _, c := range list {
+		t := &MessageThread{Children: toMessageThreads(c.children)}
+		if c.msg != nil {
+			t.ID = c.msg.ID
+		}
+		threads = append(threads, t)
+	}
+	return threads
+}
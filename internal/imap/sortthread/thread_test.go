@@ -0,0 +1,97 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sortthread
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formatResp(t *testing.T, threads []*MessageThread) string {
+	var b bytes.Buffer
+	require.NoError(t, (&threadResp{threads: threads}).WriteTo(imap.NewWriter(&b)))
+	return b.String()
+}
+
+func day(d int) time.Time {
+	return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestThreadResp(t *testing.T) {
+	assert.Equal(t, "* THREAD\r\n", formatResp(t, nil))
+
+	// Example from RFC 5256 section 4.
+	threads := []*MessageThread{
+		{ID: 2},
+		{ID: 3, Children: []*MessageThread{
+			{ID: 6, Children: []*MessageThread{
+				{ID: 4, Children: []*MessageThread{{ID: 23}}},
+				{ID: 44, Children: []*MessageThread{
+					{ID: 7, Children: []*MessageThread{{ID: 96}}},
+				}},
+			}},
+		}},
+		{Children: []*MessageThread{{ID: 5}, {ID: 8}}},
+	}
+	assert.Equal(t, "* THREAD (2)(3 6 (4 23)(44 7 96))((5)(8))\r\n", formatResp(t, threads))
+}
+
+func TestThreadOrderedSubject(t *testing.T) {
+	msgs := []*Message{
+		{ID: 1, Subject: "a", Date: day(2)},
+		{ID: 2, Subject: "b", Date: day(1)},
+		{ID: 3, Subject: "Re: a", Date: day(3)},
+		{ID: 4, Subject: "re: B", Date: day(4)},
+		{ID: 5, Subject: "[list] a", Date: day(5)},
+	}
+	assert.Equal(t, "* THREAD (2 4)(1 (3)(5))\r\n", formatResp(t, threadOrderedSubject(msgs)))
+}
+
+func TestThreadReferences(t *testing.T) {
+	msgs := []*Message{
+		{ID: 1, MessageID: "<a>", Subject: "hello", Date: day(1)},
+		{ID: 2, MessageID: "<b>", References: []string{"<a>"}, Subject: "Re: hello", Date: day(2)},
+		{ID: 3, MessageID: "<c>", References: []string{"<a>"}, Subject: "Re: hello", Date: day(3)},
+		{ID: 4, MessageID: "<d>", References: []string{"<a>", "<b>"}, Subject: "Re: hello", Date: day(4)},
+		{ID: 5, MessageID: "<e>", References: []string{"<missing>"}, Subject: "other", Date: day(5)},
+		{ID: 6, MessageID: "<f>", References: []string{"<missing>"}, Subject: "Re: other", Date: day(6)},
+		{ID: 7, MessageID: "<g>", Subject: "hello", Date: day(7)},
+		{ID: 8, MessageID: "<h>", Subject: "unrelated", Date: day(8)},
+		{ID: 9, MessageID: "<i>", References: []string{"<i>"}, Subject: "self", Date: day(9)},
+		{ID: 10, MessageID: "<h>", Subject: "Re: unrelated", Date: day(10)},
+		{ID: 11, Subject: "no id", Date: day(11)},
+	}
+	assert.Equal(t,
+		"* THREAD ((1 (2 4)(3))(7))((5)(6))(8 10)(9)(11)\r\n",
+		formatResp(t, threadReferences(msgs)),
+	)
+}
+
+// The second message is not linked to its reference which is already its child.
+func TestThreadReferencesLoop(t *testing.T) {
+	msgs := []*Message{
+		{ID: 1, MessageID: "<a>", References: []string{"<b>"}, Subject: "a", Date: day(1)},
+		{ID: 2, MessageID: "<b>", References: []string{"<a>"}, Subject: "b", Date: day(2)},
+	}
+	assert.Equal(t, "* THREAD (2 1)\r\n", formatResp(t, threadReferences(msgs)))
+}
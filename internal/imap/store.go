@@ -24,16 +24,35 @@ import (
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
 	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
 type storeUserProvider interface {
 	UserID() string
 	GetSpace() (usedSpace, maxSpace uint, err error)
-	GetMaxUpload() (uint, error)
+	GetMaxMessageSize() (int64, error)
 
 	GetAddress(addressID string) (storeAddressProvider, error)
 
+	IsMailboxHidden(labelID string) bool
+
+	ListKeywords() []string
+	GetMessageKeywords(msg *pmapi.Message) []string
+	GetKeywordLabelID(keyword string) (labelID string, isMapped bool)
+	LabelMessagesWithKeyword(apiIDs []string, keyword string) error
+	UnlabelMessagesWithKeyword(apiIDs []string, keyword string) error
+
+	MarkMessagesAnswered(apiIDs []string, answered bool) error
+	MarkMessagesForwarded(apiIDs []string, forwarded bool) error
+
+	StartIdle()
+	StopIdle()
+	IsSyncFinished() bool
+
+	GetCachedAttachment(attachmentID string) ([]byte, error)
+	SetCachedAttachment(messageID, attachmentID string, data []byte) error
+
 	CreateDraft(
 		kr *pmcrypto.KeyRing,
 		message *pmapi.Message,
@@ -51,6 +70,8 @@ type storeAddressProvider interface {
 	CreateMailbox(name string) error
 	ListMailboxes() []storeMailboxProvider
 	GetMailbox(name string) (storeMailboxProvider, error)
+	GetMailboxNames(labelIDs []string) []string
+	ListNamespaces() []string
 }
 
 type storeMailboxProvider interface {
@@ -59,19 +80,34 @@ type storeMailboxProvider interface {
 	Color() string
 	IsSystem() bool
 	IsFolder() bool
+	IsVirtual() bool
+	IsSearch() bool
+	IsSavedSearch() bool
+	IsReadOnly() bool
+	CanDeleteMessages() bool
 	UIDValidity() uint32
+	Address() storeAddressProvider
 
 	Rename(newName string) error
 	Delete() error
+	FetchOnDemand()
+	ExtendSyncWindow(since int64) error
 
 	GetAPIIDsFromUIDRange(start, stop uint32) ([]string, error)
 	GetAPIIDsFromSequenceRange(start, stop uint32) ([]string, error)
 	GetLatestAPIID() (string, error)
-	GetNextUID() (uint32, error)
-	GetCounts() (dbTotal, dbUnread uint, err error)
+	GetStatus() (dbTotal, dbUnread uint, uidNext uint32, err error)
 	GetUIDList(apiIDs []string) *uidplus.OrderedSeq
 	GetUIDByHeader(header *mail.Header) uint32
+	GetUIDOfSentCopy(msg *pmapi.Message) uint32
 	GetDelimiter() string
+	GetHighestModSeq() (uint64, error)
+	GetModSeqs() (uids []uint32, modSeqs []uint64, err error)
+	ChangeModSeqs(uids []uint32, unchangedSince uint64) (map[uint32]uint64, error)
+	GetUIDsExpungedSince(modSeq uint64) ([]uint32, error)
+	SearchAPIIDs(from, to, subject string) ([]string, error)
+	SearchBodies(apiIDs []string, text string, bodyOnly bool) ([]string, error)
+	SearchFullText(text string, bodyOnly bool) ([]string, error)
 
 	GetMessage(apiID string) (storeMessageProvider, error)
 	FetchMessage(apiID string) (storeMessageProvider, error)
@@ -82,17 +118,26 @@ type storeMailboxProvider interface {
 	MarkMessagesStarred(apiID []string) error
 	MarkMessagesUnstarred(apiID []string) error
 	ImportMessage(msg *pmapi.Message, body []byte, labelIDs []string) error
-	DeleteMessages(apiID []string) error
+	MarkMessagesDeleted(apiID []string) error
+	MarkMessagesUndeleted(apiID []string) error
+	RemoveDeleted(apiIDs []string) error
 }
 
 type storeMessageProvider interface {
 	ID() string
 	UID() (uint32, error)
 	SequenceNumber() (uint32, error)
+	ModSeq() (uint64, error)
 	Message() *pmapi.Message
+	IsDeleted() bool
 
 	SetSize(int64) error
 	SetContentTypeAndHeader(string, mail.Header) error
+	GetBodyStructure() (*message.BodyStructure, error)
+	SetBodyStructure(*message.BodyStructure) error
+	GetCachedBody() ([]byte, error)
+	SetCachedBody([]byte) error
+	HasCachedBody() bool
 }
 
 type storeUserWrap struct {
@@ -147,6 +192,10 @@ func newStoreMailboxWrap(mailbox *store.Mailbox) *storeMailboxWrap {
 	return &storeMailboxWrap{Mailbox: mailbox}
 }
 
+func (s *storeMailboxWrap) Address() storeAddressProvider {
+	return newStoreAddressWrap(s.Mailbox.Address())
+}
+
 func (s *storeMailboxWrap) GetMessage(apiID string) (storeMessageProvider, error) {
 	return s.Mailbox.GetMessage(apiID)
 }
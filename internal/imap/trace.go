@@ -0,0 +1,218 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+const traceRedacted = "<redacted>"
+
+// traceExtension captures the protocol of the next accepted connection to
+// a file. It must be enabled as the first extension to get the connection
+// of go-imap which can change its debug writer.
+type traceExtension struct {
+	lock sync.Mutex
+	path string
+}
+
+func newTraceExtension() *traceExtension {
+	return &traceExtension{}
+}
+
+// traceNextConnection sets the file for the trace of the next connection.
+// Empty path cancels the trace which has not started yet.
+func (ext *traceExtension) traceNextConnection(path string) {
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	ext.path = path
+}
+
+func (ext *traceExtension) Capabilities(c imapserver.Conn) []string {
+	return nil
+}
+
+func (ext *traceExtension) Command(name string) imapserver.HandlerFactory {
+	return nil
+}
+
+func (ext *traceExtension) NewConn(c imapserver.Conn) imapserver.Conn {
+	ext.lock.Lock()
+	path := ext.path
+	ext.path = ""
+	ext.lock.Unlock()
+
+	if path == "" {
+		return c
+	}
+
+	debugConn, ok := c.(interface{ SetDebug(io.Writer) })
+	if !ok {
+		log.Error("Cannot trace IMAP connection wrapped by other extension")
+		return c
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.WithError(err).Error("Cannot create file for IMAP trace")
+		return c
+	}
+
+	l := log.WithField("path", path)
+	if addrConn, ok := c.(interface{ RemoteAddr() net.Addr }); ok {
+		l = l.WithField("remote", addrConn.RemoteAddr())
+	}
+	l.Info("Tracing IMAP connection")
+
+	trace := newProtocolTrace(f)
+	debugConn.SetDebug(imap.NewDebugWriter(trace.server(), trace.client()))
+
+	return &traceConn{Conn: c, trace: trace}
+}
+
+type traceConn struct {
+	imapserver.Conn
+	trace *protocolTrace
+}
+
+func (c *traceConn) Close() error {
+	if err := c.trace.Close(); err != nil {
+		log.WithError(err).Warn("Cannot close IMAP trace")
+	}
+	return c.Conn.Close()
+}
+
+// protocolTrace writes lines of both sides of connection with the time and
+// direction. Credentials sent by LOGIN or AUTHENTICATE are redacted.
+type protocolTrace struct {
+	lock   sync.Mutex
+	w      io.WriteCloser
+	closed bool
+
+	clientLine, serverLine []byte
+
+	// redactTag is the tag of authentication command in progress. Every
+	// line from the client is redacted until the server completes it.
+	redactTag string
+}
+
+func newProtocolTrace(w io.WriteCloser) *protocolTrace {
+	return &protocolTrace{w: w}
+}
+
+func (t *protocolTrace) client() io.Writer {
+	return traceWriter(func(p []byte) { t.write(&t.clientLine, p, t.writeClientLine) })
+}
+
+func (t *protocolTrace) server() io.Writer {
+	return traceWriter(func(p []byte) { t.write(&t.serverLine, p, t.writeServerLine) })
+}
+
+type traceWriter func(p []byte)
+
+func (w traceWriter) Write(p []byte) (int, error) {
+	w(p)
+	return len(p), nil
+}
+
+func (t *protocolTrace) write(line *[]byte, p []byte, writeLine func(string)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return
+	}
+
+	*line = append(*line, p...)
+	for {
+		i := bytes.IndexByte(*line, '\n')
+		if i < 0 {
+			return
+		}
+		writeLine(strings.TrimRight(string((*line)[:i]), "\r"))
+		*line = (*line)[i+1:]
+	}
+}
+
+func (t *protocolTrace) writeClientLine(line string) {
+	if t.redactTag != "" {
+		line = traceRedacted
+	} else if tag, rest := splitTraceLine(line); isAuthCommand(rest) {
+		t.redactTag = tag
+		line = tag + " " + strings.Fields(rest)[0] + " " + traceRedacted
+	}
+	t.writeLine("C", line)
+}
+
+func (t *protocolTrace) writeServerLine(line string) {
+	if t.redactTag != "" && strings.HasPrefix(line, t.redactTag+" ") {
+		t.redactTag = ""
+	}
+	t.writeLine("S", line)
+}
+
+func (t *protocolTrace) writeLine(direction, line string) {
+	_, _ = fmt.Fprintf(t.w, "%s %s: %s\n", time.Now().Format("2006-01-02 15:04:05.000"), direction, line)
+}
+
+// Close writes the unfinished lines and closes the file.
+func (t *protocolTrace) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	if len(t.clientLine) > 0 {
+		t.writeClientLine(string(t.clientLine))
+	}
+	if len(t.serverLine) > 0 {
+		t.writeServerLine(string(t.serverLine))
+	}
+	return t.w.Close()
+}
+
+func splitTraceLine(line string) (tag, rest string) {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) < 2 {
+		return line, ""
+	}
+	return fields[0], fields[1]
+}
+
+func isAuthCommand(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	name := strings.ToUpper(fields[0])
+	return name == imap.Login || name == imap.Authenticate
+}
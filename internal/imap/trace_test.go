@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestProtocolTraceRedactsCredentials(t *testing.T) {
+	buf := &bytes.Buffer{}
+	trace := newProtocolTrace(nopWriteCloser{buf})
+
+	write := func(w io.Writer, s string) {
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+	}
+
+	write(trace.server(), "* OK ready\r\n")
+	write(trace.client(), "a1 login user pass")
+	write(trace.client(), "word\r\n")
+	write(trace.server(), "a1 OK Logged in\r\n")
+	write(trace.client(), "a2 AUTHENTICATE PLAIN\r\n")
+	write(trace.server(), "+ \r\n")
+	write(trace.client(), "dXNlcgB1c2VyAHBhc3N3b3Jk\r\n")
+	write(trace.server(), "a2 OK Authenticated\r\n")
+	write(trace.client(), "a3 SELECT INBOX\r\n")
+	write(trace.client(), "a4 NOOP")
+	require.NoError(t, trace.Close())
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		// Skip the date and time.
+		lines = append(lines, strings.SplitN(line, " ", 3)[2])
+	}
+	assert.Equal(t, []string{
+		"S: * OK ready",
+		"C: a1 login <redacted>",
+		"S: a1 OK Logged in",
+		"C: a2 AUTHENTICATE <redacted>",
+		"S: + ",
+		"C: <redacted>",
+		"S: a2 OK Authenticated",
+		"C: a3 SELECT INBOX",
+		"C: a4 NOOP",
+	}, lines)
+	assert.NotContains(t, buf.String(), "password")
+
+	write(trace.client(), "a5 LOGOUT\r\n")
+	assert.NotContains(t, buf.String(), "LOGOUT")
+}
@@ -25,11 +25,12 @@
 package uidplus
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
 	"github.com/emersion/go-imap/server"
-	"github.com/sirupsen/logrus"
 )
 
 // Capability extension identifier
@@ -39,11 +40,10 @@ const (
 	copyuid      = "COPYUID"
 	appenduid    = "APPENDUID"
 	copySuccess  = "COPY successful"
+	moveSuccess  = "MOVE successful"
 	appendSucess = "APPEND successful"
 )
 
-var log = logrus.WithField("pkg", "impa/uidplus") //nolint[gochecknoglobals]
-
 // OrderedSeq to remember Seq in order they are added.
 // We didn't find any restriction in RFC that server must respond with ranges
 // so we decided to always do explicit list. This makes sure that no dynamic
@@ -113,18 +113,62 @@ func (os *OrderedSeq) String() string {
 	return out
 }
 
-// UIDExpunge implements server.Handler but has no effect because Bridge is not
-// using EXPUNGE at all. The message is deleted right after it was flagged as
-// \Deleted Bridge should simply ignore this command with empty `OK` response.
-//
-// If not implemented it would cause harmless IMAP error.
-//
-// This overrides the standard EXPUNGE functionality.
-type UIDExpunge struct{}
+// Mailbox is a backend mailbox which can expunge only some of the messages.
+type Mailbox interface {
+	backend.Mailbox
+
+	// UIDExpunge permanently removes messages in seqSet of UIDs which have
+	// the \Deleted flag set.
+	UIDExpunge(seqSet *imap.SeqSet) error
+}
+
+// UIDExpunge is EXPUNGE command which also handles UID EXPUNGE with the set
+// of UIDs. Plain EXPUNGE is handled by go-imap.
+type UIDExpunge struct {
+	server.Expunge
+
+	SeqSet *imap.SeqSet
+}
+
+func (e *UIDExpunge) Parse(fields []interface{}) (err error) {
+	if len(fields) == 0 {
+		return nil
+	}
+	seqSet, ok := fields[0].(string)
+	if !ok {
+		return errors.New("invalid UID set")
+	}
+	e.SeqSet, err = imap.NewSeqSet(seqSet)
+	return err
+}
 
-func (e *UIDExpunge) Parse(fields []interface{}) error { log.Traceln("parse", fields); return nil }
-func (e *UIDExpunge) Handle(conn server.Conn) error    { log.Traceln("handle"); return nil }
-func (e *UIDExpunge) UidHandle(conn server.Conn) error { log.Traceln("uid handle"); return nil } //nolint[golint]
+func (e *UIDExpunge) Handle(conn server.Conn) error {
+	if e.SeqSet != nil {
+		return errors.New("unexpected arguments of EXPUNGE")
+	}
+	return e.Expunge.Handle(conn)
+}
+
+func (e *UIDExpunge) UidHandle(conn server.Conn) error { //nolint[golint]
+	if e.SeqSet == nil {
+		return errors.New("missing UID set")
+	}
+
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return server.ErrMailboxReadOnly
+	}
+
+	mbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		return errors.New("UID EXPUNGE is not supported by mailbox")
+	}
+	// EXPUNGE responses are sent as updates of the backend.
+	return mbox.UIDExpunge(e.SeqSet)
+}
 
 type extension struct{}
 
@@ -150,18 +194,26 @@ func (ext *extension) Command(name string) server.HandlerFactory {
 	return nil
 }
 
+func hasCopyUID(sourceSeq, targetSeq *OrderedSeq) bool {
+	return sourceSeq.Len() != 0 && targetSeq.Len() != 0 &&
+		sourceSeq.Len() == targetSeq.Len()
+}
+
+func getCopyUIDInfo(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq, success string) string {
+	return fmt.Sprintf("[%s %d %s %s] %s",
+		copyuid,
+		uidValidity,
+		sourceSeq.String(),
+		targetSeq.String(),
+		success,
+	)
+}
+
 func getStatusResponseCopy(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq) *imap.StatusResp {
 	info := copySuccess
 
-	if sourceSeq.Len() != 0 && targetSeq.Len() != 0 &&
-		sourceSeq.Len() == targetSeq.Len() {
-		info = fmt.Sprintf("[%s %d %s %s] %s",
-			copyuid,
-			uidValidity,
-			sourceSeq.String(),
-			targetSeq.String(),
-			copySuccess,
-		)
+	if hasCopyUID(sourceSeq, targetSeq) {
+		info = getCopyUIDInfo(uidValidity, sourceSeq, targetSeq, copySuccess)
 	}
 
 	return &imap.StatusResp{
@@ -175,6 +227,20 @@ func CopyResponse(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq) error {
 	return server.ErrStatusResp(getStatusResponseCopy(uidValidity, sourceSeq, targetSeq))
 }
 
+// MoveResponse prepares untagged OK response with extended UID information
+// about moved messages which has to be sent before EXPUNGE responses (see
+// RFC6851 section 4.3). It returns nil if there is no UID information.
+func MoveResponse(uidValidity uint32, sourceSeq, targetSeq *OrderedSeq) *imap.StatusResp {
+	if !hasCopyUID(sourceSeq, targetSeq) {
+		return nil
+	}
+	return &imap.StatusResp{
+		Tag:  "*",
+		Type: imap.StatusOk,
+		Info: getCopyUIDInfo(uidValidity, sourceSeq, targetSeq, moveSuccess),
+	}
+}
+
 func getStatusResponseAppend(uidValidity uint32, targetSeq *OrderedSeq) *imap.StatusResp {
 	info := appendSucess
 	if targetSeq.Len() > 0 {
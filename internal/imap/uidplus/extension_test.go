@@ -18,6 +18,7 @@
 package uidplus
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -46,6 +47,14 @@ func (td *testResponseData) testCopyAndAppendResponses(tb testing.TB) {
 	gotCopyResp := getStatusResponseCopy(uidValidity, sourceSeq, targetSeq)
 	assert.Equal(tb, td.expCopyInfo, gotCopyResp.Info, "source: %v\ntarget: %v", td.sourceList, td.targetList)
 
+	gotMoveResp := MoveResponse(uidValidity, sourceSeq, targetSeq)
+	if td.expCopyInfo == copySuccess {
+		assert.Nil(tb, gotMoveResp, "source: %v\ntarget: %v", td.sourceList, td.targetList)
+	} else if assert.NotNil(tb, gotMoveResp, "source: %v\ntarget: %v", td.sourceList, td.targetList) {
+		expMoveInfo := strings.Replace(td.expCopyInfo, copySuccess, moveSuccess, 1)
+		assert.Equal(tb, expMoveInfo, gotMoveResp.Info, "source: %v\ntarget: %v", td.sourceList, td.targetList)
+	}
+
 	gotAppendResp := getStatusResponseAppend(uidValidity, targetSeq)
 	assert.Equal(tb, td.expAppendInfo, gotAppendResp.Info, "source: %v\ntarget: %v", td.sourceList, td.targetList)
 }
@@ -0,0 +1,320 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/emersion/go-imap"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/responses"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+// selectedUpdatesExtension delivers updates of the selected mailbox to every
+// connection in the same order as they were created by the store.
+//
+// go-imap sends every update to every connection from its own goroutine and
+// does not wait for it, so two updates waiting for the same connection (for
+// example EXPUNGE of two messages) could be written in any order. Clients
+// with several connections to the same mailbox (Apple Mail opens four or
+// more) then ended with different sequence numbers than the bridge.
+// maxPendingUpdates is the most updates waiting for one connection.
+const maxPendingUpdates = 1000
+
+type selectedUpdatesExtension struct {
+	lock  sync.Mutex
+	conns map[*imapserver.Context]*selectedUpdatesConn
+}
+
+func newSelectedUpdatesExtension() *selectedUpdatesExtension {
+	return &selectedUpdatesExtension{
+		conns: map[*imapserver.Context]*selectedUpdatesConn{},
+	}
+}
+
+func (ext *selectedUpdatesExtension) Capabilities(c imapserver.Conn) []string {
+	return nil
+}
+
+func (ext *selectedUpdatesExtension) Command(name string) imapserver.HandlerFactory {
+	return nil
+}
+
+// NewConn registers the connection and starts its delivery of updates
+// which runs until the connection is closed.
+func (ext *selectedUpdatesExtension) NewConn(c imapserver.Conn) imapserver.Conn {
+	conn := &selectedUpdatesConn{
+		Conn:   c,
+		ext:    ext,
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+
+	ext.lock.Lock()
+	ext.conns[c.Context()] = conn
+	ext.lock.Unlock()
+
+	go conn.deliver()
+
+	return conn
+}
+
+// Deliver queues the update for all connections with the mailbox selected.
+// It returns false for updates which do not target one mailbox; these have
+// to be passed to go-imap.
+func (ext *selectedUpdatesExtension) Deliver(update interface{}) bool {
+	var u *goIMAPBackend.Update
+	switch update := update.(type) {
+	case *goIMAPBackend.MessageUpdate:
+		u = &update.Update
+	case *goIMAPBackend.MailboxUpdate:
+		u = &update.Update
+	case *goIMAPBackend.ExpungeUpdate:
+		u = &update.Update
+	default:
+		return false
+	}
+	if u.Username == "" || u.Mailbox == "" {
+		return false
+	}
+
+	ext.lock.Lock()
+	defer ext.lock.Unlock()
+
+	conns := []*selectedUpdatesConn{}
+	for ctx, conn := range ext.conns {
+		if ctx.User == nil || ctx.User.Username() != u.Username {
+			continue
+		}
+		if ctx.Mailbox == nil || ctx.Mailbox.Name() != u.Mailbox {
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	if len(conns) == 0 {
+		goIMAPBackend.DoneUpdate(u)
+		return true
+	}
+
+	// The update is done once written to all connections as with go-imap.
+	done := &updateDone{update: u, pending: int32(len(conns))}
+	for _, conn := range conns {
+		conn.push(conn.Context().Mailbox, update, done)
+	}
+	return true
+}
+
+// updateDone marks the update done when the last connection wrote or
+// dropped it.
+type updateDone struct {
+	update  *goIMAPBackend.Update
+	pending int32
+}
+
+func (d *updateDone) done() {
+	if atomic.AddInt32(&d.pending, -1) == 0 {
+		goIMAPBackend.DoneUpdate(d.update)
+	}
+}
+
+// writtenResponse marks the update done after it is written.
+type writtenResponse struct {
+	imap.WriterTo
+	done *updateDone
+}
+
+func (r *writtenResponse) WriteTo(w *imap.Writer) error {
+	defer r.done.done()
+	return r.WriterTo.WriteTo(w)
+}
+
+// newUpdateResponse creates the response the same way as go-imap does.
+// Every connection needs its own response because the ones with channels
+// can be written only once.
+func newUpdateResponse(update interface{}) imap.WriterTo {
+	switch update := update.(type) {
+	case *goIMAPBackend.MessageUpdate:
+		ch := make(chan *imap.Message, 1)
+		ch <- update.Message
+		close(ch)
+		return &responses.Fetch{Messages: ch}
+	case *goIMAPBackend.MailboxUpdate:
+		return &responses.Select{Mailbox: update.MailboxStatus}
+	case *goIMAPBackend.ExpungeUpdate:
+		ch := make(chan uint32, 1)
+		ch <- update.SeqNum
+		close(ch)
+		return &responses.Expunge{SeqNums: ch}
+	}
+	return nil
+}
+
+type selectedUpdate struct {
+	mailbox goIMAPBackend.Mailbox
+	update  interface{}
+	done    *updateDone
+}
+
+type selectedUpdatesConn struct {
+	imapserver.Conn
+	ext *selectedUpdatesExtension
+
+	lock    sync.Mutex
+	pending []selectedUpdate
+
+	wake      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *selectedUpdatesConn) Close() error {
+	c.ext.lock.Lock()
+	delete(c.ext.conns, c.Context())
+	c.ext.lock.Unlock()
+
+	c.closeOnce.Do(func() { close(c.closed) })
+
+	c.lock.Lock()
+	for _, update := range c.pending {
+		update.done.done()
+	}
+	c.pending = nil
+	c.lock.Unlock()
+
+	return c.Conn.Close()
+}
+
+// push queues the update. A FETCH update replaces the pending one of the
+// same message, so a client which does not send any command for a long time
+// does not make the queue grow with every flag change. When the queue grows
+// over maxPendingUpdates anyway, the connection is closed and the client
+// gets the current state after it connects again.
+func (c *selectedUpdatesConn) push(mailbox goIMAPBackend.Mailbox, update interface{}, done *updateDone) {
+	c.lock.Lock()
+	select {
+	case <-c.closed:
+		c.lock.Unlock()
+		done.done()
+		return
+	default:
+	}
+	if !c.replacePending(mailbox, update, done) {
+		c.pending = append(c.pending, selectedUpdate{mailbox: mailbox, update: update, done: done})
+	}
+	overflow := len(c.pending) > maxPendingUpdates
+	c.lock.Unlock()
+
+	if overflow {
+		// Deliver holds the lock of the extension which Close needs.
+		log.WithField("pending", maxPendingUpdates).Warn("Too many pending updates, closing IMAP connection")
+		go c.Close() //nolint[errcheck]
+		return
+	}
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replacePending replaces the pending FETCH update of the same message
+// unless some message was expunged since, because the sequence number of
+// the same message would be different. The new update has to carry all
+// items of the replaced one. It has to be called with the lock held.
+func (c *selectedUpdatesConn) replacePending(mailbox goIMAPBackend.Mailbox, update interface{}, done *updateDone) bool {
+	newUpdate, ok := update.(*goIMAPBackend.MessageUpdate)
+	if !ok {
+		return false
+	}
+	for i := len(c.pending) - 1; i >= 0; i-- {
+		pending := c.pending[i]
+		if pending.mailbox != mailbox {
+			return false
+		}
+		switch pendingUpdate := pending.update.(type) {
+		case *goIMAPBackend.ExpungeUpdate:
+			return false
+		case *goIMAPBackend.MessageUpdate:
+			if pendingUpdate.Message.SeqNum != newUpdate.Message.SeqNum {
+				continue
+			}
+			if !hasAllItems(newUpdate.Message, pendingUpdate.Message) {
+				return false
+			}
+			pending.done.done()
+			c.pending[i] = selectedUpdate{mailbox: mailbox, update: update, done: done}
+			return true
+		}
+	}
+	return false
+}
+
+func hasAllItems(msg, other *imap.Message) bool {
+	for item := range other.Items {
+		if _, ok := msg.Items[item]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *selectedUpdatesConn) pop() (update selectedUpdate, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.pending) == 0 {
+		return
+	}
+	update, c.pending = c.pending[0], c.pending[1:]
+	return update, true
+}
+
+// deliver writes pending updates one by one. go-imap writes them only while
+// the connection is processing some command, so the queue can grow while
+// the client does not send anything. Updates queued before the mailbox was
+// selected again are dropped because the client got new state by SELECT.
+func (c *selectedUpdatesConn) deliver() {
+	ctx := c.Context()
+	for {
+		select {
+		case <-c.wake:
+		case <-c.closed:
+			return
+		}
+
+		for {
+			update, ok := c.pop()
+			if !ok {
+				break
+			}
+			if ctx.Mailbox != update.mailbox {
+				update.done.done()
+				continue
+			}
+			res := &writtenResponse{WriterTo: newUpdateResponse(update.update), done: update.done}
+			select {
+			case ctx.Responses <- res:
+			case <-c.closed:
+				update.done.done()
+				return
+			}
+		}
+	}
+}
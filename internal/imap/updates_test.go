@@ -0,0 +1,200 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	goIMAPBackend "github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/responses"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectedUpdatesInOrder(t *testing.T) {
+	ext, c, responsesCh := newTestSelectedUpdatesConn(t)
+	defer c.Close() //nolint[errcheck]
+
+	for seqNum := uint32(5); seqNum > 0; seqNum-- {
+		require.True(t, ext.Deliver(newExpungeUpdate("username", imap.InboxName, seqNum)))
+	}
+	require.True(t, ext.Deliver(newExpungeUpdate("other", imap.InboxName, 1)))
+	require.True(t, ext.Deliver(newExpungeUpdate("username", "Archive", 1)))
+	require.False(t, ext.Deliver(&goIMAPBackend.StatusUpdate{}))
+
+	for seqNum := uint32(5); seqNum > 0; seqNum-- {
+		assert.Equal(t, seqNum, receiveExpunge(t, responsesCh))
+	}
+	assert.Empty(t, responsesCh)
+}
+
+func TestSelectedUpdatesDroppedAfterSelect(t *testing.T) {
+	ext, c, responsesCh := newTestSelectedUpdatesConn(t)
+	defer c.Close() //nolint[errcheck]
+
+	// Client selects the same mailbox again while an update is queued.
+	ctx := c.Context()
+	selected := ctx.Mailbox
+	ctx.Mailbox = &reselectedMailbox{Mailbox: selected}
+	update := newExpungeUpdate("username", imap.InboxName, 2)
+	c.(*selectedUpdatesConn).push(selected, update, &updateDone{update: &update.Update, pending: 1})
+	require.True(t, ext.Deliver(newExpungeUpdate("username", imap.InboxName, 3)))
+
+	// The update queued before SELECT is dropped.
+	assert.Equal(t, uint32(3), receiveExpunge(t, responsesCh))
+	assert.Empty(t, responsesCh)
+}
+
+func TestSelectedUpdateDoneAfterWrite(t *testing.T) {
+	ext, c, responsesCh := newTestSelectedUpdatesConn(t)
+	defer c.Close() //nolint[errcheck]
+
+	update := newExpungeUpdate("username", imap.InboxName, 1)
+	done := update.Done()
+	require.True(t, ext.Deliver(update))
+
+	var res imap.WriterTo
+	select {
+	case res = <-responsesCh:
+	case <-time.After(time.Second):
+		require.Fail(t, "no update")
+	}
+	select {
+	case <-done:
+		require.Fail(t, "update done before it was written")
+	default:
+	}
+
+	require.NoError(t, res.WriteTo(imap.NewWriter(&bytes.Buffer{})))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "update not done after it was written")
+	}
+}
+
+func TestSelectedUpdatesFetchMerged(t *testing.T) {
+	ext, c, _ := newTestSelectedUpdatesConn(t)
+	defer c.Close() //nolint[errcheck]
+
+	// Nobody receives responses, so the first update blocks the queue.
+	c.Context().Responses = make(chan imap.WriterTo)
+	require.True(t, ext.Deliver(newFetchUpdate("username", imap.InboxName, 1, imap.SeenFlag)))
+	time.Sleep(100 * time.Millisecond)
+
+	require.True(t, ext.Deliver(newFetchUpdate("username", imap.InboxName, 2, imap.SeenFlag)))
+	require.True(t, ext.Deliver(newFetchUpdate("username", imap.InboxName, 2, imap.FlaggedFlag)))
+	require.True(t, ext.Deliver(newFetchUpdate("username", imap.InboxName, 3, imap.SeenFlag)))
+	require.True(t, ext.Deliver(newExpungeUpdate("username", imap.InboxName, 1)))
+	require.True(t, ext.Deliver(newFetchUpdate("username", imap.InboxName, 2, imap.SeenFlag)))
+
+	conn := c.(*selectedUpdatesConn)
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	require.Len(t, conn.pending, 4)
+	msg := conn.pending[0].update.(*goIMAPBackend.MessageUpdate).Message
+	assert.Equal(t, uint32(2), msg.SeqNum)
+	assert.Equal(t, []string{imap.FlaggedFlag}, msg.Flags)
+}
+
+func TestSelectedUpdatesOverflowClosesConn(t *testing.T) {
+	ext, c, _ := newTestSelectedUpdatesConn(t)
+	defer c.Close() //nolint[errcheck]
+
+	c.Context().Responses = make(chan imap.WriterTo)
+	for seqNum := uint32(1); seqNum <= maxPendingUpdates+2; seqNum++ {
+		require.True(t, ext.Deliver(newExpungeUpdate("username", imap.InboxName, 1)))
+	}
+
+	conn := c.(*selectedUpdatesConn)
+	require.Eventually(t, func() bool {
+		select {
+		case <-conn.closed:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func newTestSelectedUpdatesConn(t *testing.T) (*selectedUpdatesExtension, imapserver.Conn, chan imap.WriterTo) {
+	user, err := memory.New().Login("username", "password")
+	require.NoError(t, err)
+	inbox, err := user.GetMailbox(imap.InboxName)
+	require.NoError(t, err)
+
+	responsesCh := make(chan imap.WriterTo, 10)
+	ext := newSelectedUpdatesExtension()
+	c := ext.NewConn(&contextConn{ctx: &imapserver.Context{User: user, Mailbox: inbox, Responses: responsesCh}})
+	return ext, c, responsesCh
+}
+
+func newExpungeUpdate(username, mailbox string, seqNum uint32) *goIMAPBackend.ExpungeUpdate {
+	update := &goIMAPBackend.ExpungeUpdate{SeqNum: seqNum}
+	update.Username = username
+	update.Mailbox = mailbox
+	return update
+}
+
+func newFetchUpdate(username, mailbox string, seqNum uint32, flags ...string) *goIMAPBackend.MessageUpdate {
+	msg := imap.NewMessage(seqNum, []string{imap.FlagsMsgAttr})
+	msg.Flags = flags
+	update := &goIMAPBackend.MessageUpdate{Message: msg}
+	update.Username = username
+	update.Mailbox = mailbox
+	return update
+}
+
+func receiveExpunge(t *testing.T, responsesCh chan imap.WriterTo) uint32 {
+	select {
+	case res := <-responsesCh:
+		written, ok := res.(*writtenResponse)
+		require.True(t, ok)
+		expunge, ok := written.WriterTo.(*responses.Expunge)
+		require.True(t, ok)
+		return <-expunge.SeqNums
+	case <-time.After(time.Second):
+		require.Fail(t, "no update")
+	}
+	return 0
+}
+
+// reselectedMailbox is a new instance of the same mailbox as returned by
+// the bridge for every SELECT.
+type reselectedMailbox struct {
+	goIMAPBackend.Mailbox
+}
+
+// contextConn is a connection providing only its context.
+type contextConn struct {
+	imapserver.Conn
+	ctx *imapserver.Context
+}
+
+func (c *contextConn) Context() *imapserver.Context {
+	return c.ctx
+}
+
+func (c *contextConn) Close() error {
+	return nil
+}
@@ -19,6 +19,7 @@ package imap
 
 import (
 	"errors"
+	"math"
 	"strings"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
@@ -26,8 +27,12 @@ import (
 	goIMAPBackend "github.com/emersion/go-imap/backend"
 )
 
+// quotaRoot is the only quota root, shared by all mailboxes of the account.
+const quotaRoot = ""
+
 var (
-	errNoSuchMailbox = errors.New("no such mailbox") //nolint[gochecknoglobals]
+	errNoSuchMailbox   = errors.New("no such mailbox")    //nolint[gochecknoglobals]
+	errNoSuchQuotaRoot = errors.New("no such quota root") //nolint[gochecknoglobals]
 )
 
 type imapUser struct {
@@ -40,6 +45,9 @@ type imapUser struct {
 	storeAddress storeAddressProvider
 
 	currentAddressLowercase string
+
+	mailClient *mailClient
+	prefetch   *prefetcher
 }
 
 // newIMAPUser returns struct implementing go-imap/user interface.
@@ -74,9 +82,20 @@ func newIMAPUser(
 		storeAddress: storeAddress,
 
 		currentAddressLowercase: strings.ToLower(address),
+
+		mailClient: &mailClient{},
+		prefetch:   newPrefetcher(),
 	}, err
 }
 
+// forConnection returns the user for a new IMAP connection. Connections of
+// the same address share everything but the mail client.
+func (iu *imapUser) forConnection() *imapUser {
+	conn := *iu
+	conn.mailClient = &mailClient{}
+	return &conn
+}
+
 func (iu *imapUser) isSubscribed(labelID string) bool {
 	subscriptionExceptions := iu.backend.getCacheList(iu.storeUser.UserID(), SubscriptionException)
 	exceptions := strings.Split(subscriptionExceptions, ";")
@@ -107,38 +126,62 @@ func (iu *imapUser) Username() string {
 
 // ListMailboxes returns a list of mailboxes belonging to this user.
 // If subscribed is set to true, returns only subscribed mailboxes.
+// Mailboxes hidden in the account settings are not listed.
 func (iu *imapUser) ListMailboxes(showOnlySubcribed bool) ([]goIMAPBackend.Mailbox, error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
 	mailboxes := []goIMAPBackend.Mailbox{}
+	hasSavedSearches := false
 	for _, storeMailbox := range iu.storeAddress.ListMailboxes() {
 		if showOnlySubcribed && !iu.isSubscribed(storeMailbox.LabelID()) {
 			continue
 		}
+		if iu.storeUser.IsMailboxHidden(storeMailbox.LabelID()) {
+			continue
+		}
 		mailbox := newIMAPMailbox(iu.panicHandler, iu, storeMailbox)
 		mailboxes = append(mailboxes, mailbox)
+		hasSavedSearches = hasSavedSearches || storeMailbox.IsSavedSearch()
 	}
 
 	mailboxes = append(mailboxes, newLabelsRootMailbox())
 	mailboxes = append(mailboxes, newFoldersRootMailbox())
+	if hasSavedSearches {
+		mailboxes = append(mailboxes, newSavedSearchesRootMailbox())
+	}
+	for _, mailbox := range newNamespaceRootMailboxes(iu.storeAddress.ListNamespaces()) {
+		mailboxes = append(mailboxes, mailbox)
+	}
 
 	log.WithField("mailboxes", mailboxes).Trace("Listing mailboxes")
 
 	return mailboxes, nil
 }
 
+// ListNamespaces returns prefixes of personal namespaces other than the
+// default one. In combined mode there is one for each secondary address.
+func (iu *imapUser) ListNamespaces() []string {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer iu.panicHandler.HandlePanic()
+
+	return iu.storeAddress.ListNamespaces()
+}
+
 // GetMailbox returns a mailbox. If it doesn't exist, it returns ErrNoSuchMailbox.
 func (iu *imapUser) GetMailbox(name string) (mb goIMAPBackend.Mailbox, err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
-	storeMailbox, err := iu.storeAddress.GetMailbox(name)
+	storeMailbox, err := iu.storeAddress.GetMailbox(iu.mailClient.mailboxName(name))
 	if err != nil {
 		log.WithField("name", name).WithError(err).Error("Could not get mailbox")
 		return
 	}
 
+	// Messages which are not synced are downloaded when mailbox is opened.
+	storeMailbox.FetchOnDemand()
+
 	return newIMAPMailbox(iu.panicHandler, iu, storeMailbox), nil
 }
 
@@ -147,6 +190,11 @@ func (iu *imapUser) CreateMailbox(name string) error {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
+	// Special folders of the client already exist under other names.
+	if iu.mailClient.mailboxName(name) != name {
+		return nil
+	}
+
 	return iu.storeAddress.CreateMailbox(name)
 }
 
@@ -155,7 +203,7 @@ func (iu *imapUser) DeleteMailbox(name string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
-	storeMailbox, err := iu.storeAddress.GetMailbox(name)
+	storeMailbox, err := iu.storeAddress.GetMailbox(iu.mailClient.mailboxName(name))
 	if err != nil {
 		log.WithField("name", name).WithError(err).Error("Could not get mailbox")
 		return
@@ -197,23 +245,35 @@ func (iu *imapUser) GetQuota(name string) (*imapquota.Status, error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
+	if name != quotaRoot {
+		return nil, errNoSuchQuotaRoot
+	}
+
 	usedSpace, maxSpace, err := iu.storeUser.GetSpace()
 	if err != nil {
 		log.Error("Failed getting quota: ", err)
 		return nil, err
 	}
 
-	resources := make(map[string][2]uint32)
-	var list [2]uint32
-	list[0] = uint32(usedSpace / 1000)
-	list[1] = uint32(maxSpace / 1000)
-	resources[imapquota.ResourceStorage] = list
-	status := &imapquota.Status{
-		Name:      "",
-		Resources: resources,
-	}
+	return &imapquota.Status{
+		Name: quotaRoot,
+		Resources: map[string][2]uint32{
+			imapquota.ResourceStorage: {quotaStorageUnits(usedSpace), quotaStorageUnits(maxSpace)},
+		},
+	}, nil
+}
 
-	return status, nil
+// quotaStorageUnits converts bytes to units of 1024 octets used by STORAGE
+// resource, rounded up so that any usage is visible.
+func quotaStorageUnits(bytes uint) uint32 {
+	units := uint64(bytes) / 1024
+	if bytes%1024 != 0 {
+		units++
+	}
+	if units > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(units)
 }
 
 func (iu *imapUser) SetQuota(name string, resources map[string]uint32) error {
@@ -227,13 +287,17 @@ func (iu *imapUser) CreateMessageLimit() *uint32 {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer iu.panicHandler.HandlePanic()
 
-	maxUpload, err := iu.storeUser.GetMaxUpload()
+	maxSize, err := iu.storeUser.GetMaxMessageSize()
 	if err != nil {
 		log.Error("Failed getting current user for message limit: ", err)
-		zero := uint32(0)
-		return &zero
+		return nil
+	}
+
+	// Unknown limit is advertised as plain APPENDLIMIT without any value.
+	if maxSize <= 0 || maxSize > math.MaxUint32 {
+		return nil
 	}
 
-	upload := uint32(maxUpload)
-	return &upload
+	limit := uint32(maxSize)
+	return &limit
 }
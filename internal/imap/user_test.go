@@ -18,15 +18,17 @@
 package imap
 
 import (
-	"io"
-	"net/http"
-	"net/textproto"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
-func writeHeader(w io.Writer, h textproto.MIMEHeader) (err error) {
-	if err = http.Header(h).Write(w); err != nil {
-		return
-	}
-	_, err = io.WriteString(w, "\r\n")
-	return
+func TestQuotaStorageUnits(t *testing.T) {
+	assert.Equal(t, uint32(0), quotaStorageUnits(0))
+	assert.Equal(t, uint32(1), quotaStorageUnits(1))
+	assert.Equal(t, uint32(1), quotaStorageUnits(1024))
+	assert.Equal(t, uint32(2), quotaStorageUnits(1025))
+	assert.Equal(t, uint32(500*1024), quotaStorageUnits(500*1024*1024))
+	assert.Equal(t, uint32(math.MaxUint32), quotaStorageUnits(math.MaxUint64))
 }
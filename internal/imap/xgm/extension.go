@@ -0,0 +1,100 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package xgm implements FETCH items of Gmail IMAP extensions (X-GM-EXT-1)
+// so clients and scripts written for Gmail see all labels of a message
+// without selecting every mailbox.
+//
+// Only X-GM-LABELS and X-GM-MSGID FETCH items are supported. Excluded are
+// X-GM-THRID, X-GM-RAW and other SEARCH criteria and STORE of X-GM-LABELS;
+// labels are changed by COPY and MOVE as before.
+package xgm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-imap/utf7"
+)
+
+// Capability extension identifier.
+const Capability = "X-GM-EXT-1"
+
+// FETCH items with labels and ID of message.
+const (
+	LabelsMsgAttr = "X-GM-LABELS"
+	MsgIDMsgAttr  = "X-GM-MSGID"
+)
+
+// Labels used by Gmail for system mailboxes instead of their names.
+const (
+	InboxLabel   = "\\Inbox"
+	SentLabel    = "\\Sent"
+	DraftLabel   = "\\Draft"
+	StarredLabel = "\\Starred"
+	SpamLabel    = "\\Spam"
+	TrashLabel   = "\\Trash"
+)
+
+// FormatLabels returns the labels as the value of X-GM-LABELS FETCH item.
+// Names of mailboxes are encoded in modified UTF-7 the same way as in LIST.
+func FormatLabels(labels []string) interface{} {
+	fields := make([]interface{}, 0, len(labels))
+	for _, label := range labels {
+		if !strings.HasPrefix(label, "\\") {
+			label, _ = utf7.Encoder.String(label)
+		}
+		fields = append(fields, label)
+	}
+	return fields
+}
+
+// MsgID returns the 64-bit number used as X-GM-MSGID of the message with
+// apiID. It is derived from the ID so it is the same in all mailboxes and
+// all connections.
+func MsgID(apiID string) uint64 {
+	sum := sha256.Sum256([]byte(apiID))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// FormatMsgID returns the ID as the value of X-GM-MSGID FETCH item.
+// It is written as atom, go-imap can write only 32-bit numbers.
+func FormatMsgID(msgID uint64) interface{} {
+	return strconv.FormatUint(msgID, 10)
+}
+
+type extension struct{}
+
+// NewExtension of X-GM-EXT-1. FETCH items are provided by the backend.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package xgm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t,
+		[]interface{}{InboxLabel, "Labels/Work", "Folders/&AMk-t&AOk-"},
+		FormatLabels([]string{InboxLabel, "Labels/Work", "Folders/Été"}),
+	)
+	assert.Equal(t, []interface{}{}, FormatLabels(nil))
+}
+
+func TestMsgID(t *testing.T) {
+	assert.Equal(t, MsgID("msg1"), MsgID("msg1"))
+	assert.NotEqual(t, MsgID("msg1"), MsgID("msg2"))
+	assert.Equal(t, "18446744073709551615", FormatMsgID(^uint64(0)))
+}
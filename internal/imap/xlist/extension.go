@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package xlist implements XLIST command used by older clients (e.g. Apple
+// Mail and Outlook) instead of SPECIAL-USE. XLIST was never standardised, it
+// is LIST with Gmail-specific attributes of well-known mailboxes.
+package xlist
+
+import (
+	"github.com/emersion/go-imap"
+	specialuse "github.com/emersion/go-imap-specialuse"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/server"
+)
+
+// Capability extension identifier.
+const Capability = "XLIST"
+
+const xlist = "XLIST"
+
+// Attributes used by XLIST instead of the SPECIAL-USE ones.
+const (
+	InboxAttr   = "\\Inbox"
+	AllMailAttr = "\\AllMail"
+	SpamAttr    = "\\Spam"
+	StarredAttr = "\\Starred"
+)
+
+// XList is a XLIST command.
+type XList struct {
+	commands.List
+}
+
+func (cmd *XList) Handle(conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return server.ErrNotAuthenticated
+	}
+
+	mailboxes, err := ctx.User.ListMailboxes(false)
+	if err != nil {
+		return err
+	}
+
+	for _, mbox := range mailboxes {
+		info, err := mbox.Info()
+		if err != nil {
+			return err
+		}
+
+		// The same special request as for LIST to get the hierarchy delimiter.
+		if cmd.Mailbox == "" {
+			info = &imap.MailboxInfo{
+				Attributes: []string{imap.NoSelectAttr},
+				Delimiter:  info.Delimiter,
+				Name:       info.Delimiter,
+			}
+			return conn.WriteResp(newXListResp(info))
+		}
+
+		if !info.Match(cmd.Reference, cmd.Mailbox) {
+			continue
+		}
+
+		info.Attributes = xlistAttributes(info)
+		if err := conn.WriteResp(newXListResp(info)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newXListResp(info *imap.MailboxInfo) *imap.Resp {
+	return imap.NewUntaggedResp(append([]interface{}{xlist}, info.Format()...))
+}
+
+// xlistAttributes returns attributes of mailbox with SPECIAL-USE attributes
+// translated to XLIST ones.
+func xlistAttributes(info *imap.MailboxInfo) []string {
+	attributes := []string{}
+	if info.Name == imap.InboxName {
+		attributes = append(attributes, InboxAttr)
+	}
+	for _, attr := range info.Attributes {
+		switch attr {
+		case specialuse.All:
+			attr = AllMailAttr
+		case specialuse.Junk:
+			attr = SpamAttr
+		case specialuse.Flagged:
+			attr = StarredAttr
+		}
+		attributes = append(attributes, attr)
+	}
+	return attributes
+}
+
+type extension struct{}
+
+// NewExtension of XLIST.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{Capability}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != xlist {
+		return nil
+	}
+	return func() server.Handler {
+		return &XList{}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package xlist
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap"
+	specialuse "github.com/emersion/go-imap-specialuse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXListAttributes(t *testing.T) {
+	tests := []struct {
+		info *imap.MailboxInfo
+		want []string
+	}{
+		{&imap.MailboxInfo{Name: imap.InboxName, Attributes: []string{imap.NoInferiorsAttr}}, []string{InboxAttr, imap.NoInferiorsAttr}},
+		{&imap.MailboxInfo{Name: "All Mail", Attributes: []string{specialuse.All}}, []string{AllMailAttr}},
+		{&imap.MailboxInfo{Name: "Spam", Attributes: []string{specialuse.Junk}}, []string{SpamAttr}},
+		{&imap.MailboxInfo{Name: "Starred", Attributes: []string{specialuse.Flagged}}, []string{StarredAttr}},
+		{&imap.MailboxInfo{Name: "Sent", Attributes: []string{specialuse.Sent}}, []string{specialuse.Sent}},
+		{&imap.MailboxInfo{Name: "Folders/a", Attributes: []string{}}, []string{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, xlistAttributes(test.info), test.info.Name)
+	}
+}
@@ -28,18 +28,53 @@ import (
 
 // Keys of preferences in JSON file.
 const (
-	FirstStartKey          = "first_time_start"
-	NextHeartbeatKey       = "next_heartbeat"
-	APIPortKey             = "user_port_api"
-	IMAPPortKey            = "user_port_imap"
-	SMTPPortKey            = "user_port_smtp"
-	SMTPSSLKey             = "user_ssl_smtp"
-	AllowProxyKey          = "allow_proxy"
-	AutostartKey           = "autostart"
-	ReportOutgoingNoEncKey = "report_outgoing_email_without_encryption"
-	LastVersionKey         = "last_used_version"
+	FirstStartKey                = "first_time_start"
+	NextHeartbeatKey             = "next_heartbeat"
+	APIPortKey                   = "user_port_api"
+	IMAPPortKey                  = "user_port_imap"
+	IMAPSPortKey                 = "user_port_imaps"
+	SMTPPortKey                  = "user_port_smtp"
+	SMTPSSLKey                   = "user_ssl_smtp"
+	SMTPSPortKey                 = "user_port_smtps"
+	LMTPPortKey                  = "user_port_lmtp"
+	BindAddressKey               = "bind_address"
+	ProxyProtocolKey             = "proxy_protocol"
+	RequireTLSKey                = "require_tls"
+	WKDLookupKey                 = "wkd_lookup"
+	AttachPublicKeyKey           = "attach_public_key"
+	SMTPRateLimitKey             = "smtp_rate_limit"
+	SendDelayKey                 = "send_delay"
+	DuplicateSendCheckKey        = "duplicate_send_check"
+	DuplicateSendExpirationKey   = "duplicate_send_expiration"
+	DuplicateSendDraftTimeoutKey = "duplicate_send_draft_timeout"
+	DraftCleanupKey              = "draft_cleanup"
+	PlainTextAlternativeKey      = "plain_text_alternative"
+	FullTextIndexKey             = "full_text_index"
+	MessageCacheSizeKey          = "message_cache_size"
+	AttachmentCacheSizeKey       = "attachment_cache_size"
+	StoreCompactIntervalKey      = "store_compact_interval"
+	SyncWorkersKey               = "sync_workers"
+	EventPollIntervalKey         = "event_poll_interval"
+	PrefetchMessagesKey          = "prefetch_messages"
+	SyncDownloadLimitKey         = "sync_download_limit"
+	SyncUploadLimitKey           = "sync_upload_limit"
+	EventsDownloadLimitKey       = "events_download_limit"
+	EventsUploadLimitKey         = "events_upload_limit"
+	AllowProxyKey                = "allow_proxy"
+	AutostartKey                 = "autostart"
+	ReportOutgoingNoEncKey       = "report_outgoing_email_without_encryption"
+	LastVersionKey               = "last_used_version"
 )
 
+// userStoreDirKeyPrefix is followed by user ID in keys of directories of
+// stores of accounts. Empty value means the default cache directory.
+const userStoreDirKeyPrefix = "user_store_dir_"
+
+// UserStoreDirKey returns the key of directory of store and cached messages of the user.
+func UserStoreDirKey(userID string) string {
+	return userStoreDirKeyPrefix + userID
+}
+
 type configProvider interface {
 	GetPreferencesPath() string
 	GetDefaultAPIPort() int
@@ -72,7 +107,75 @@ func setDefaults(preferences *config.Preferences, cfg configProvider) {
 	preferences.SetDefault(AutostartKey, "true")
 	preferences.SetDefault(ReportOutgoingNoEncKey, "false")
 	preferences.SetDefault(LastVersionKey, "")
+	preferences.SetDefault(WKDLookupKey, "false")
+	preferences.SetDefault(AttachPublicKeyKey, "false")
+
+	// Maximum number of messages sent per minute by one user. Zero disables the limit.
+	preferences.SetDefault(SMTPRateLimitKey, "0")
+
+	// Seconds every sent message waits in the outbox so it can be cancelled (undo send). Zero disables it.
+	preferences.SetDefault(SendDelayKey, "0")
+
+	// Detection of the same message sent again, e.g. by clients retrying on timeout.
+	// Timeouts are in minutes; users with heartbeat mails can shorten them or disable the check.
+	preferences.SetDefault(DuplicateSendCheckKey, "true")
+	preferences.SetDefault(DuplicateSendExpirationKey, "30")
+	preferences.SetDefault(DuplicateSendDraftTimeoutKey, "10")
+
+	// Deleting of drafts created by bridge for sends which did not complete within the draft timeout.
+	preferences.SetDefault(DraftCleanupKey, "false")
+
+	// Generating of text/plain alternative for HTML-only messages to external recipients.
+	preferences.SetDefault(PlainTextAlternativeKey, "false")
+
+	// Local full-text index of message bodies used by IMAP SEARCH.
+	preferences.SetDefault(FullTextIndexKey, "false")
+
+	// Megabytes of built messages cached on disk, the least recently fetched are removed over the limit. Zero disables the cache.
+	preferences.SetDefault(MessageCacheSizeKey, "1000")
+
+	// Megabytes of attachments cached on disk, which are downloaded only when a client fetches them. Zero disables the cache.
+	preferences.SetDefault(AttachmentCacheSizeKey, "1000")
+
+	// Days after which the store database is compacted when it is opened. Zero disables the scheduled compaction.
+	preferences.SetDefault(StoreCompactIntervalKey, "0")
+
+	// Number of pages of messages fetched in parallel during sync.
+	preferences.SetDefault(SyncWorkersKey, "5")
+
+	// Seconds between polls of new events, failed polls are repeated later with growing backoff.
+	preferences.SetDefault(EventPollIntervalKey, "30")
+
+	// Number of the newest messages of every mailbox built in background after sync so the first fetch is fast. Zero disables prefetch.
+	preferences.SetDefault(PrefetchMessagesKey, "20")
+
+	// Kilobytes per second of API traffic during sync of all messages and while handling events. Zero means no limit.
+	preferences.SetDefault(SyncDownloadLimitKey, "0")
+	preferences.SetDefault(SyncUploadLimitKey, "0")
+	preferences.SetDefault(EventsDownloadLimitKey, "0")
+	preferences.SetDefault(EventsUploadLimitKey, "0")
 
 	// By default, stick to STARTTLS. If the user uses catalina+applemail they'll have to change to SSL.
 	preferences.SetDefault(SMTPSSLKey, "false")
+
+	// Additional implicit TLS (IMAPS) listener for clients which cannot do STARTTLS. Zero disables it.
+	preferences.SetDefault(IMAPSPortKey, "0")
+
+	// Additional implicit TLS (SMTPS) listener for clients which cannot do STARTTLS. Zero disables it.
+	preferences.SetDefault(SMTPSPortKey, "0")
+
+	// PROXY protocol header is required on IMAP and SMTP connections when enabled,
+	// so it must be enabled only when the bridge is reachable just through the proxy.
+	preferences.SetDefault(ProxyProtocolKey, "false")
+
+	// Address of IMAP, SMTP and LMTP listeners. Other than loopback address makes
+	// the bridge reachable from other machines, e.g. when running in Docker.
+	preferences.SetDefault(BindAddressKey, "127.0.0.1")
+
+	// Login over IMAP and SMTP is refused until the connection is encrypted by
+	// STARTTLS or implicit TLS. Bridge on localhost accepts plaintext logins.
+	preferences.SetDefault(RequireTLSKey, "false")
+
+	// LMTP listener importing messages for local delivery agents. Zero disables it.
+	preferences.SetDefault(LMTPPortKey, "0")
 }
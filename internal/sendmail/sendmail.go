@@ -0,0 +1,261 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package sendmail implements sendmail(1) compatible command submitting
+// messages through the bridge SMTP server, so cron jobs and daemons can send
+// mail without setting up an SMTP client.
+package sendmail
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+	goSMTP "github.com/emersion/go-smtp"
+)
+
+// Exit codes from sysexits.h used by sendmail.
+const (
+	ExitOK          = 0
+	ExitUsage       = 64
+	ExitDataErr     = 65
+	ExitNoUser      = 67
+	ExitUnavailable = 69
+	ExitSoftware    = 70
+	ExitTempFail    = 75
+)
+
+// ErrNoRecipients is returned when there is nobody to send the message to.
+var ErrNoRecipients = errors.New("no recipients given") //nolint[gochecknoglobals]
+
+// Options are parsed sendmail command line arguments.
+type Options struct {
+	// From is the envelope sender set by -f.
+	From string
+	// FullName is the sender name set by -F used when message has no From header.
+	FullName string
+	// ReadRecipients is set by -t; recipients are read from To, Cc and Bcc headers.
+	ReadRecipients bool
+	// IgnoreDots is set by -i or -oi; otherwise a line with a single dot ends the message.
+	IgnoreDots bool
+	// Recipients given as arguments.
+	Recipients []string
+}
+
+// ParseArgs parses sendmail arguments `args`, without the program name.
+// Options which do not make sense for the bridge (e.g. queue or delivery
+// mode) are accepted and ignored, so existing scripts keep working.
+func ParseArgs(args []string) (*Options, error) {
+	opts := &Options{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.Recipients = append(opts.Recipients, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			opts.Recipients = append(opts.Recipients, arg)
+			continue
+		}
+
+		// Options with value accept it in the same or the next argument.
+		value := func() (string, error) {
+			if len(arg) > 2 {
+				return arg[2:], nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s requires a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch {
+		case arg == "-t":
+			opts.ReadRecipients = true
+		case arg == "-i", arg == "-oi":
+			opts.IgnoreDots = true
+		case strings.HasPrefix(arg, "-f"), strings.HasPrefix(arg, "-r"):
+			opts.From, err = value()
+		case strings.HasPrefix(arg, "-F"):
+			opts.FullName, err = value()
+		case hasAnyPrefix(arg, "-B", "-L", "-N", "-O", "-R", "-V", "-X"):
+			// Ignored options with value, e.g. body type or DSN options.
+			_, err = value()
+		case arg == "-bm", arg == "-v", arg == "-U", arg == "-m", hasAnyPrefix(arg, "-o", "-e"):
+			// Ignored options without value, e.g. delivery mode.
+		default:
+			err = fmt.Errorf("unsupported option %s", arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMessage reads the message from `r` and returns it with CRLF line
+// endings, together with the envelope sender and recipients. With -t, Bcc
+// header is removed from the message after its recipients are collected.
+func ReadMessage(r io.Reader, opts *Options) (msg []byte, from string, to []string, err error) {
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if !opts.IgnoreDots && line == "." {
+			break
+		}
+		buf.WriteString(line + "\r\n")
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("cannot parse message: %v", err)
+	}
+
+	from = opts.From
+	if from == "" {
+		if addr, err := mail.ParseAddress(m.Header.Get("From")); err == nil {
+			from = addr.Address
+		}
+	}
+
+	to = append(to, opts.Recipients...)
+	if opts.ReadRecipients {
+		for _, key := range []string{"To", "Cc", "Bcc"} {
+			addrs, err := m.Header.AddressList(key)
+			if err != nil && err != mail.ErrHeaderNotPresent {
+				return nil, "", nil, fmt.Errorf("cannot parse %s header: %v", key, err)
+			}
+			for _, addr := range addrs {
+				to = append(to, addr.Address)
+			}
+		}
+	}
+	if len(to) == 0 {
+		return nil, "", nil, ErrNoRecipients
+	}
+
+	msg = buf.Bytes()
+	if opts.ReadRecipients {
+		msg = removeHeader(msg, "Bcc")
+	}
+	if m.Header.Get("From") == "" && from != "" {
+		sender := &mail.Address{Name: opts.FullName, Address: from}
+		msg = append([]byte("From: "+sender.String()+"\r\n"), msg...)
+	}
+	return msg, from, to, nil
+}
+
+// removeHeader removes all header fields `key` including continuation lines.
+func removeHeader(msg []byte, key string) []byte {
+	var out bytes.Buffer
+	prefix := strings.ToLower(key) + ":"
+	inHeader, skipping := true, false
+	for _, line := range bytes.SplitAfter(msg, []byte("\n")) {
+		if inHeader {
+			if len(bytes.TrimSpace(line)) == 0 {
+				inHeader = false
+			} else if skipping && (line[0] == ' ' || line[0] == '\t') {
+				continue
+			} else {
+				skipping = strings.HasPrefix(strings.ToLower(string(line)), prefix)
+				if skipping {
+					continue
+				}
+			}
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// Server is the bridge SMTP server and credentials used to submit messages.
+type Server struct {
+	Addr      string
+	UseSSL    bool
+	TLSConfig *tls.Config
+	Username  string
+	Password  string
+}
+
+// Send submits the message through the bridge SMTP server.
+func (s *Server) Send(from string, to []string, msg []byte) error {
+	var c *goSMTP.Client
+	var err error
+	if s.UseSSL {
+		c, err = goSMTP.DialTLS(s.Addr, s.TLSConfig)
+	} else {
+		c, err = goSMTP.Dial(s.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint[errcheck]
+
+	if !s.UseSSL {
+		if err := c.StartTLS(s.TLSConfig); err != nil {
+			return err
+		}
+	}
+	if err := c.Auth(sasl.NewPlainClient("", s.Username, s.Password)); err != nil {
+		return err
+	}
+	if err := c.SendMail(from, to, bytes.NewReader(msg)); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// GetExitCode returns sendmail exit code for error returned by Send.
+func GetExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if smtpErr, ok := err.(*goSMTP.SMTPError); ok {
+		if smtpErr.Temporary() {
+			return ExitTempFail
+		}
+		if smtpErr.EnhancedCode[1] == 1 {
+			return ExitNoUser
+		}
+		return ExitDataErr
+	}
+	return ExitUnavailable
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package sendmail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := ParseArgs([]string{"-t", "-oi", "-f", "cron@pm.me", "-FCron Daemon", "-odi", "-N", "never", "a@pm.me", "--", "-b@pm.me"})
+	require.NoError(t, err)
+	assert.Equal(t, &Options{
+		From:           "cron@pm.me",
+		FullName:       "Cron Daemon",
+		ReadRecipients: true,
+		IgnoreDots:     true,
+		Recipients:     []string{"a@pm.me", "-b@pm.me"},
+	}, opts)
+
+	opts, err = ParseArgs([]string{"-fcron@pm.me", "a@pm.me"})
+	require.NoError(t, err)
+	assert.Equal(t, "cron@pm.me", opts.From)
+
+	for _, args := range [][]string{{"-bs"}, {"-q"}, {"-f"}} {
+		_, err := ParseArgs(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	input := "To: a@pm.me\nCc: B <b@pm.me>\nBcc: c@pm.me,\n d@pm.me\nSubject: Report\n\nline\n.\nafter dot\n"
+
+	msg, from, to, err := ReadMessage(strings.NewReader(input), &Options{ReadRecipients: true, From: "cron@pm.me", FullName: "Cron"})
+	require.NoError(t, err)
+	assert.Equal(t, "cron@pm.me", from)
+	assert.Equal(t, []string{"a@pm.me", "b@pm.me", "c@pm.me", "d@pm.me"}, to)
+	assert.Equal(t, "From: \"Cron\" <cron@pm.me>\r\nTo: a@pm.me\r\nCc: B <b@pm.me>\r\nSubject: Report\r\n\r\nline\r\n", string(msg))
+
+	msg, _, to, err = ReadMessage(strings.NewReader(input), &Options{IgnoreDots: true, Recipients: []string{"e@pm.me"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e@pm.me"}, to)
+	assert.Contains(t, string(msg), "Bcc: c@pm.me,\r\n d@pm.me\r\n")
+	assert.Contains(t, string(msg), "\r\n.\r\nafter dot\r\n")
+
+	_, from, _, err = ReadMessage(strings.NewReader("From: Me <me@pm.me>\n\nhi\n"), &Options{Recipients: []string{"a@pm.me"}})
+	require.NoError(t, err)
+	assert.Equal(t, "me@pm.me", from)
+
+	_, _, _, err = ReadMessage(strings.NewReader("Subject: nobody\n\nhi\n"), &Options{})
+	assert.Equal(t, ErrNoRecipients, err)
+}
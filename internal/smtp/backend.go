@@ -19,10 +19,12 @@ package smtp
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	goSMTPBackend "github.com/emersion/go-smtp"
@@ -39,21 +41,34 @@ type smtpBackend struct {
 	bridge                  bridger
 	shouldSendNoEncChannels map[string]chan bool
 	sendRecorder            *sendRecorder
+	sendJournal             *sendJournal
+	draftTracker            *draftTracker
+	outbox                  *outbox
+	outboxWakeCh            chan struct{}
+	rateLimiter             *rateLimiter
+	wkdLookup               wkdLookuper
+
+	sessions     map[*goSMTPBackend.Conn]*smtpUser
+	sessionsLock sync.Mutex
 }
 
 // NewSMTPBackend returns struct implementing go-smtp/backend interface.
 func NewSMTPBackend(
 	panicHandler panicHandler,
 	eventListener listener.Listener,
+	cfg configProvider,
 	preferences *config.Preferences,
 	bridge *bridge.Bridge,
 ) *smtpBackend { //nolint[golint]
-	return newSMTPBackend(panicHandler, eventListener, preferences, newBridgeWrap(bridge))
+	backend := newSMTPBackend(panicHandler, eventListener, cfg, preferences, newBridgeWrap(bridge))
+	go backend.processOutbox()
+	return backend
 }
 
 func newSMTPBackend(
 	panicHandler panicHandler,
 	eventListener listener.Listener,
+	cfg configProvider,
 	preferences *config.Preferences,
 	bridge bridger,
 ) *smtpBackend {
@@ -63,39 +78,123 @@ func newSMTPBackend(
 		preferences:             preferences,
 		bridge:                  bridge,
 		shouldSendNoEncChannels: make(map[string]chan bool),
-		sendRecorder:            newSendRecorder(),
+		sendRecorder:            newSendRecorder(cfg.GetSendRecorderPath()),
+		sendJournal:             newSendJournal(cfg.GetSendJournalPath()),
+		draftTracker:            newDraftTracker(),
+		outbox:                  newOutbox(cfg.GetOutboxPath()),
+		outboxWakeCh:            make(chan struct{}, 1),
+		rateLimiter:             newRateLimiter(),
+		wkdLookup:               newWKDLookuper(),
+		sessions:                make(map[*goSMTPBackend.Conn]*smtpUser),
+	}
+}
+
+// NewSession creates a new session for the connection. The session is not
+// authenticated until the client calls AUTH.
+func (sb *smtpBackend) NewSession(conn *goSMTPBackend.Conn) (goSMTPBackend.Session, error) {
+	session := newSMTPUser(sb.panicHandler, sb.eventListener, sb, conn)
+
+	sb.sessionsLock.Lock()
+	defer sb.sessionsLock.Unlock()
+	sb.sessions[conn] = session
+
+	return session, nil
+}
+
+func (sb *smtpBackend) removeSession(conn *goSMTPBackend.Conn) {
+	sb.sessionsLock.Lock()
+	defer sb.sessionsLock.Unlock()
+	delete(sb.sessions, conn)
+}
+
+// closeAuthenticatedSessions closes all connections with logged in user.
+func (sb *smtpBackend) closeAuthenticatedSessions() {
+	sb.sessionsLock.Lock()
+	var conns []*goSMTPBackend.Conn
+	for conn, session := range sb.sessions {
+		if session.isAuthenticated() {
+			conns = append(conns, conn)
+		}
+	}
+	sb.sessionsLock.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
 	}
 }
 
 // Login authenticates a user.
-func (sb *smtpBackend) Login(username, password string) (goSMTPBackend.User, error) {
+func (sb *smtpBackend) Login(username, password string) (user bridgeUser, addressID string, err error) {
+	return sb.login(username, func(user bridgeUser) error {
+		return user.CheckBridgeLogin(password)
+	})
+}
+
+// LoginCRAMMD5 authenticates a user by CRAM-MD5 digest of the bridge password.
+func (sb *smtpBackend) LoginCRAMMD5(username, challenge, digest string) (user bridgeUser, addressID string, err error) {
+	return sb.login(username, func(user bridgeUser) error {
+		return user.CheckBridgeLoginCRAMMD5(challenge, digest)
+	})
+}
+
+func (sb *smtpBackend) login(username string, checkPassword func(bridgeUser) error) (user bridgeUser, addressID string, err error) {
 	// Called from go-smtp in goroutines - we need to handle panics for each function.
 	defer sb.panicHandler.HandlePanic()
-	username = strings.ToLower(username)
 
-	user, err := sb.bridge.GetUser(username)
+	user, addressID, err = sb.getUser(username)
 	if err != nil {
-		log.Warn("Cannot get user: ", err)
-		return nil, err
+		return nil, "", err
 	}
-	if err := user.CheckBridgeLogin(password); err != nil {
+	if err := checkPassword(user); err != nil {
 		log.WithError(err).Error("Could not check bridge password")
 		// Apple Mail sometimes generates a lot of requests very quickly. It's good practice
 		// to have a timeout after bad logins so that we can slow those requests down a little bit.
 		time.Sleep(10 * time.Second)
-		return nil, err
+		return nil, "", err
+	}
+	return user, addressID, nil
+}
+
+// getUser returns the user with address `username` and ID of that address.
+func (sb *smtpBackend) getUser(username string) (user bridgeUser, addressID string, err error) {
+	username = strings.ToLower(username)
+
+	user, err = sb.bridge.GetUser(username)
+	if err != nil {
+		log.Warn("Cannot get user: ", err)
+		return nil, "", err
 	}
 	// Client can log in only using address so we can properly close all SMTP connections.
-	addressID, err := user.GetAddressID(username)
+	addressID, err = user.GetAddressID(username)
 	if err != nil {
 		log.Error("Cannot get addressID: ", err)
-		return nil, err
+		return nil, "", err
 	}
 	// AddressID is only for split mode--it has to be empty for combined mode.
 	if user.IsCombinedAddressMode() {
 		addressID = ""
 	}
-	return newSMTPUser(sb.panicHandler, sb.eventListener, sb, user, addressID)
+	return user, addressID, nil
+}
+
+// getMaxMessageBytes returns the biggest message size limit of connected users.
+// Zero is returned when no limit is known.
+func (sb *smtpBackend) getMaxMessageBytes() (maxMessageBytes int64) {
+	for _, user := range sb.bridge.GetUsers() {
+		storeUser := user.GetStore()
+		if storeUser == nil {
+			continue
+		}
+		maxUpload, err := storeUser.GetMaxUpload()
+		if err != nil {
+			log.WithError(err).Warn("Cannot get max upload size")
+			continue
+		}
+		if limit := store.MessageSizeLimit(maxUpload); limit > maxMessageBytes {
+			maxMessageBytes = limit
+		}
+	}
+	return
 }
 
 func (sb *smtpBackend) shouldReportOutgoingNoEnc() bool {
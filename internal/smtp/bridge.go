@@ -21,12 +21,20 @@ import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 )
 
+type configProvider interface {
+	GetSendRecorderPath() string
+	GetOutboxPath() string
+	GetSendJournalPath() string
+}
+
 type bridger interface {
 	GetUser(query string) (bridgeUser, error)
+	GetUsers() []bridgeUser
 }
 
 type bridgeUser interface {
 	CheckBridgeLogin(password string) error
+	CheckBridgeLoginCRAMMD5(challenge, digest string) error
 	IsCombinedAddressMode() bool
 	GetAddressID(address string) (string, error)
 	GetTemporaryPMAPIClient() bridge.PMAPIProvider
@@ -52,6 +60,13 @@ func (b *bridgeWrap) GetUser(query string) (bridgeUser, error) {
 	return newBridgeUserWrap(user), nil
 }
 
+func (b *bridgeWrap) GetUsers() (users []bridgeUser) {
+	for _, user := range b.Bridge.GetUsers() {
+		users = append(users, newBridgeUserWrap(user))
+	}
+	return
+}
+
 type bridgeUserWrap struct {
 	*bridge.User
 }
@@ -61,5 +76,10 @@ func newBridgeUserWrap(bridgeUser *bridge.User) *bridgeUserWrap {
 }
 
 func (u *bridgeUserWrap) GetStore() storeUserProvider {
-	return u.User.GetStore()
+	store := u.User.GetStore()
+	if store == nil {
+		// Return untyped nil so callers can check for missing store.
+		return nil
+	}
+	return store
 }
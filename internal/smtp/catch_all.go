@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// getSendingAddress returns the address used to send as `email`. Unknown
+// address of a custom domain is sent through its catch-all address.
+func getSendingAddress(addresses pmapi.AddressList, email string) *pmapi.Address {
+	if addr := addresses.ByEmail(email); addr != nil {
+		return addr
+	}
+	return addresses.ByCatchAllDomain(email)
+}
+
+// getCatchAllSenderAddress returns the sender address when sending through
+// the catch-all address `addressEmail` of a custom domain. Any address of the
+// domain is kept, the From header one is preferred as with plus-addressing.
+func getCatchAllSenderAddress(envelopeFrom, headerFrom, addressEmail string) string {
+	for _, email := range []string{headerFrom, envelopeFrom} {
+		if isSameDomain(email, addressEmail) {
+			return email
+		}
+	}
+	return addressEmail
+}
+
+func isSameDomain(email, addressEmail string) bool {
+	at := strings.LastIndex(email, "@")
+	addressAt := strings.LastIndex(addressEmail, "@")
+	if at <= 0 || addressAt < 0 {
+		return false
+	}
+	return strings.EqualFold(email[at:], addressEmail[addressAt:])
+}
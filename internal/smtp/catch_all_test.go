@@ -0,0 +1,56 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCatchAllSenderAddress(t *testing.T) {
+	tests := []struct {
+		envelopeFrom, headerFrom, want string
+	}{
+		{"catchall@custom.test", "catchall@custom.test", "catchall@custom.test"},
+		{"anything@custom.test", "", "anything@custom.test"},
+		{"anything@custom.test", "anything@custom.test", "anything@custom.test"},
+		{"catchall@custom.test", "header@Custom.Test", "header@Custom.Test"},
+		{"envelope@custom.test", "header@other.test", "envelope@custom.test"},
+		{"envelope@other.test", "header@other.test", "catchall@custom.test"},
+		{"@custom.test", "invalid", "catchall@custom.test"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, getCatchAllSenderAddress(tc.envelopeFrom, tc.headerFrom, "catchall@custom.test"), "%s, %s", tc.envelopeFrom, tc.headerFrom)
+	}
+}
+
+func TestGetSendingAddress(t *testing.T) {
+	addresses := pmapi.AddressList{
+		{ID: "user", Email: "user@pm.me"},
+		{ID: "custom", Email: "custom@custom.test"},
+		{ID: "catchall", Email: "catchall@catchall.test", CatchAll: pmapi.CatchAllAddress},
+	}
+
+	assert.Equal(t, "user", getSendingAddress(addresses, "user+tag@pm.me").ID)
+	assert.Equal(t, "catchall", getSendingAddress(addresses, "catchall@catchall.test").ID)
+	assert.Equal(t, "catchall", getSendingAddress(addresses, "anything@CatchAll.test").ID)
+	assert.Nil(t, getSendingAddress(addresses, "anything@custom.test"))
+	assert.Nil(t, getSendingAddress(addresses, "anything@pm.me"))
+}
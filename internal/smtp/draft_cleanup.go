@@ -0,0 +1,118 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// trackedDraft is a draft created by bridge for sending a message.
+type trackedDraft struct {
+	username  string
+	messageID string
+	created   time.Time
+}
+
+// draftTracker keeps drafts of messages which are being sent. Drafts of sent
+// messages are removed right away, so the remaining old ones belong to sends
+// which never completed. It is kept in memory only; drafts abandoned before
+// restart are not cleaned up.
+type draftTracker struct {
+	lock   *sync.Mutex
+	drafts []trackedDraft
+}
+
+func newDraftTracker() *draftTracker {
+	return &draftTracker{lock: &sync.Mutex{}}
+}
+
+func (t *draftTracker) add(username, messageID string, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.drafts = append(t.drafts, trackedDraft{username: username, messageID: messageID, created: now})
+}
+
+func (t *draftTracker) remove(messageID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i, draft := range t.drafts {
+		if draft.messageID == messageID {
+			t.drafts = append(t.drafts[:i], t.drafts[i+1:]...)
+			return
+		}
+	}
+}
+
+// popCreatedBefore removes and returns drafts created before `deadline`.
+func (t *draftTracker) popCreatedBefore(deadline time.Time) (drafts []trackedDraft) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	i := 0
+	for _, draft := range t.drafts {
+		if draft.created.Before(deadline) {
+			drafts = append(drafts, draft)
+		} else {
+			t.drafts[i] = draft
+			i++
+		}
+	}
+	t.drafts = t.drafts[:i]
+	return drafts
+}
+
+// cleanupAbandonedDrafts deletes drafts of sends which did not complete
+// within the same timeout the send recorder gives up waiting for them.
+// Drafts are deleted only if they are still drafts, i.e., were not sent.
+func (sb *smtpBackend) cleanupAbandonedDrafts() {
+	_, draftTimeout := sb.getDuplicateSendTimeouts()
+	drafts := sb.draftTracker.popCreatedBefore(time.Now().Add(-draftTimeout))
+	if len(drafts) == 0 || !sb.preferences.GetBool(preferences.DraftCleanupKey) {
+		return
+	}
+
+	for _, draft := range drafts {
+		l := log.WithField("messageID", draft.messageID)
+
+		user, _, err := sb.getUser(draft.username)
+		if err != nil {
+			continue
+		}
+		client := user.GetTemporaryPMAPIClient()
+
+		message, err := client.GetMessage(draft.messageID)
+		if err != nil {
+			l.WithError(err).Debug("Cannot get draft of abandoned send")
+			continue
+		}
+		if message.Type != pmapi.MessageTypeDraft {
+			continue
+		}
+		if err := client.DeleteMessages([]string{draft.messageID}); err != nil {
+			l.WithError(err).Warn("Cannot delete draft of abandoned send")
+			continue
+		}
+		l.Info("Draft of abandoned send was deleted")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDraftTracker(t *testing.T) {
+	now := time.Now()
+	tracker := newDraftTracker()
+	tracker.add("user", "old", now.Add(-time.Hour))
+	tracker.add("user", "sent", now.Add(-time.Hour))
+	tracker.add("user", "new", now)
+
+	tracker.remove("sent")
+	tracker.remove("unknown")
+
+	drafts := tracker.popCreatedBefore(now.Add(-time.Minute))
+	require.Len(t, drafts, 1)
+	assert.Equal(t, "old", drafts[0].messageID)
+	assert.Equal(t, "user", drafts[0].username)
+
+	assert.Empty(t, tracker.popCreatedBefore(now.Add(-time.Minute)), "popped drafts are not returned again")
+
+	drafts = tracker.popCreatedBefore(now.Add(time.Minute))
+	require.Len(t, drafts, 1)
+	assert.Equal(t, "new", drafts[0].messageID)
+}
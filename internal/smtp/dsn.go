@@ -0,0 +1,401 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+)
+
+// dsnRequest holds delivery status notification parameters (RFC 3461)
+// requested by the client for the currently processed message.
+//
+// Sending is synchronous, so every failure is known before the reply to DATA.
+// Each failure is reported exactly once: either in the SMTP reply, or, when
+// the message is accepted, in a failure notification. The message is accepted
+// (and a failure notification imported into the Inbox) only for a permanent
+// failure of a recipient and only if all recipients asked to be notified about
+// failures. Otherwise the failure is returned in the SMTP reply and no
+// notification is generated.
+type dsnRequest struct {
+	envelopeID string
+	ret        goSMTPBackend.DSNReturn
+	recipients []*dsnRecipient
+}
+
+type dsnRecipient struct {
+	address               string
+	originalRecipientType string
+	originalRecipient     string
+	notify                []goSMTPBackend.DSNNotify
+}
+
+// dsnRecipientStatus is the result of sending to one recipient.
+type dsnRecipientStatus struct {
+	recipient  *dsnRecipient
+	action     string
+	status     goSMTPBackend.EnhancedCode
+	diagnostic string
+}
+
+func newDSNRequest(opts *goSMTPBackend.MailOptions) *dsnRequest {
+	req := &dsnRequest{}
+	if opts != nil {
+		req.envelopeID = opts.EnvelopeID
+		req.ret = opts.Return
+	}
+	return req
+}
+
+func (req *dsnRequest) addRecipient(address string, opts *goSMTPBackend.RcptOptions) {
+	recipient := &dsnRecipient{address: address}
+	if opts != nil {
+		recipient.originalRecipientType = string(opts.OriginalRecipientType)
+		recipient.originalRecipient = opts.OriginalRecipient
+		recipient.notify = opts.Notify
+	}
+	req.recipients = append(req.recipients, recipient)
+}
+
+// isRequested returns whether any recipient explicitly asked for a notification.
+func (req *dsnRequest) isRequested() bool {
+	if req == nil {
+		return false
+	}
+	for _, recipient := range req.recipients {
+		if recipient.wants(goSMTPBackend.DSNNotifySuccess) || recipient.wants(goSMTPBackend.DSNNotifyFailure) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotifySet returns whether the client set NOTIFY of any recipient,
+// including NEVER.
+func (req *dsnRequest) isNotifySet() bool {
+	if req == nil {
+		return false
+	}
+	for _, recipient := range req.recipients {
+		if len(recipient.notify) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldBounce returns whether the message should be accepted and the failure
+// `sendErr` reported by a notification instead of the SMTP reply.
+func (req *dsnRequest) shouldBounce(sendErr error) bool {
+	switch err := sendErr.(type) {
+	case *recipientError:
+		if !err.isPermanent() {
+			return false
+		}
+	case *partialSendError:
+		if !err.isPermanent() {
+			return false
+		}
+	default:
+		return false
+	}
+	if len(req.recipients) == 0 {
+		return false
+	}
+	for _, recipient := range req.recipients {
+		if !recipient.wants(goSMTPBackend.DSNNotifyFailure) {
+			return false
+		}
+	}
+	return true
+}
+
+// getRecipientStatuses returns statuses of recipients which want to be notified
+// about the result of sending. If `sendErr` is nil, sending succeeded.
+// If the message was sent only to some recipients, `sendErr` is partialSendError.
+// Otherwise, when sending failed because of one recipient, the message was not
+// sent to other recipients either.
+func (req *dsnRequest) getRecipientStatuses(sendErr error) (statuses []*dsnRecipientStatus) {
+	rcptErr, _ := sendErr.(*recipientError)
+	partialErr, _ := sendErr.(*partialSendError)
+
+	for _, recipient := range req.recipients {
+		failed := sendErr != nil
+		if partialErr != nil {
+			rcptErr = partialErr.getRecipientError(recipient.address)
+			failed = rcptErr != nil
+		}
+
+		notify := goSMTPBackend.DSNNotifySuccess
+		if failed {
+			notify = goSMTPBackend.DSNNotifyFailure
+		}
+		if !recipient.wants(notify) {
+			continue
+		}
+
+		status := &dsnRecipientStatus{recipient: recipient}
+		switch {
+		case !failed:
+			// ProtonMail does not generate notifications upon final delivery.
+			status.action = "relayed"
+			status.status = goSMTPBackend.EnhancedCode{2, 0, 0}
+		case rcptErr != nil && strings.EqualFold(rcptErr.address, recipient.address):
+			status.action = "failed"
+			status.status = rcptErr.status
+			status.diagnostic = getDiagnosticCode(rcptErr.replyCode(), rcptErr.status, rcptErr.Error())
+		case rcptErr != nil:
+			status.action = "failed"
+			status.status = statusOther
+			status.diagnostic = getDiagnosticCode(554, statusOther, "message not sent because sending to "+rcptErr.address+" failed")
+		default:
+			status.action = "failed"
+			status.status = getAPIErrorStatus(sendErr)
+			status.diagnostic = getDiagnosticCode(getReplyCode(status.status), status.status, sendErr.Error())
+		}
+		statuses = append(statuses, status)
+	}
+	return
+}
+
+func (r *dsnRecipient) wants(notify goSMTPBackend.DSNNotify) bool {
+	for _, n := range r.notify {
+		if n == notify {
+			return true
+		}
+	}
+	return false
+}
+
+func getDiagnosticCode(code int, status goSMTPBackend.EnhancedCode, text string) string {
+	return fmt.Sprintf("smtp; %d %s %s", code, formatStatus(status), sanitizeHeaderValue(text))
+}
+
+func formatStatus(status goSMTPBackend.EnhancedCode) string {
+	return fmt.Sprintf("%d.%d.%d", status[0], status[1], status[2])
+}
+
+// sanitizeHeaderValue makes `value` safe to use as a header value: whitespace
+// including line breaks is collapsed to single spaces and other control
+// characters are dropped.
+func sanitizeHeaderValue(value string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r' || r == '\n' || r == '\t':
+			return ' '
+		case r < ' ' || r == 0x7f:
+			return -1
+		}
+		return r
+	}, value)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+// buildDSN builds a delivery status notification (RFC 3464) with `statuses`
+// of recipients of the `original` message sent from `from`.
+func (req *dsnRequest) buildDSN(from string, original []byte, statuses []*dsnRecipientStatus) ([]byte, error) { //nolint[funlen]
+	b := &bytes.Buffer{}
+	mw := multipart.NewWriter(b)
+
+	failed := false
+	for _, status := range statuses {
+		if status.action == "failed" {
+			failed = true
+		}
+	}
+
+	result := "Success"
+	if failed {
+		result = "Failure"
+	}
+
+	domain := from[strings.LastIndex(from, "@")+1:]
+	mainHeader := textproto.MIMEHeader{}
+	mainHeader.Set("From", (&mail.Address{Name: "Mail Delivery System", Address: "MAILER-DAEMON@" + domain}).String())
+	mainHeader.Set("To", (&mail.Address{Address: from}).String())
+	mainHeader.Set("Subject", "Delivery Status Notification ("+result+")")
+	mainHeader.Set("Date", time.Now().Format(time.RFC1123Z))
+	mainHeader.Set("MIME-Version", "1.0")
+	mainHeader.Set("Content-Type", "multipart/report; report-type=delivery-status; boundary="+mw.Boundary())
+	if err := message.WriteHeader(b, mainHeader); err != nil {
+		return nil, err
+	}
+
+	// Human readable part.
+	textHeader := textproto.MIMEHeader{}
+	textHeader.Set("Content-Type", "text/plain; charset=utf-8")
+	p, err := mw.CreatePart(textHeader)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDSNText(p, statuses, failed); err != nil {
+		return nil, err
+	}
+
+	// Machine readable part.
+	statusHeader := textproto.MIMEHeader{}
+	statusHeader.Set("Content-Type", "message/delivery-status")
+	if p, err = mw.CreatePart(statusHeader); err != nil {
+		return nil, err
+	}
+	if err := req.writeDeliveryStatus(p, statuses); err != nil {
+		return nil, err
+	}
+
+	// Original message or its header only.
+	originalHeader := textproto.MIMEHeader{}
+	if req.ret == goSMTPBackend.DSNReturnFull {
+		originalHeader.Set("Content-Type", "message/rfc822")
+	} else {
+		originalHeader.Set("Content-Type", "text/rfc822-headers")
+		original = getHeader(original)
+	}
+	if p, err = mw.CreatePart(originalHeader); err != nil {
+		return nil, err
+	}
+	if _, err := p.Write(original); err != nil {
+		return nil, err
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func writeDSNText(w io.Writer, statuses []*dsnRecipientStatus, failed bool) error {
+	intro := "Your message was successfully sent to the following recipients:"
+	if failed {
+		intro = "Your message could not be sent to the following recipients:"
+	}
+	if _, err := fmt.Fprintf(w, "%s\r\n\r\n", intro); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		line := status.recipient.address
+		if status.diagnostic != "" {
+			line += ": " + strings.TrimPrefix(status.diagnostic, "smtp; ")
+		}
+		if _, err := fmt.Fprintf(w, "    %s\r\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (req *dsnRequest) writeDeliveryStatus(w io.Writer, statuses []*dsnRecipientStatus) error {
+	perMessage := textproto.MIMEHeader{}
+	perMessage.Set("Reporting-MTA", "dns; "+bridge.Host)
+	if req.envelopeID != "" {
+		perMessage.Set("Original-Envelope-Id", sanitizeHeaderValue(req.envelopeID))
+	}
+	perMessage.Set("Arrival-Date", time.Now().Format(time.RFC1123Z))
+	if err := message.WriteHeader(w, perMessage); err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		perRecipient := textproto.MIMEHeader{}
+		if status.recipient.originalRecipient != "" {
+			perRecipient.Set("Original-Recipient", status.recipient.originalRecipientType+"; "+sanitizeHeaderValue(status.recipient.originalRecipient))
+		}
+		perRecipient.Set("Final-Recipient", "rfc822; "+status.recipient.address)
+		perRecipient.Set("Action", status.action)
+		perRecipient.Set("Status", formatStatus(status.status))
+		if status.diagnostic != "" {
+			perRecipient.Set("Diagnostic-Code", status.diagnostic)
+		}
+		if err := message.WriteHeader(w, perRecipient); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getHeader returns the header section of the message including the final line break.
+func getHeader(msg []byte) []byte {
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		return msg[:i+2]
+	}
+	if i := bytes.Index(msg, []byte("\n\n")); i >= 0 {
+		return msg[:i+1]
+	}
+	return msg
+}
+
+// handleDSN generates notifications requested for the sent `original` message
+// and returns the error to reply to the client with. See dsnRequest for details.
+func (su *smtpUser) handleDSN(original []byte, sendErr error) error {
+	if sendErr != nil && !su.dsn.shouldBounce(sendErr) {
+		return toSMTPError(sendErr)
+	}
+
+	statuses := su.dsn.getRecipientStatuses(sendErr)
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	if err := su.importDSN(original, statuses); err != nil {
+		log.WithError(err).WithField("from", su.from).Error("Cannot import DSN")
+		// Failure notification was not delivered, so the client has to know.
+		return toSMTPError(sendErr)
+	}
+
+	return nil
+}
+
+// importDSN imports the delivery status notification into the sender's Inbox.
+func (su *smtpUser) importDSN(original []byte, statuses []*dsnRecipientStatus) error {
+	addr := getSendingAddress(su.client.Addresses(), su.from)
+	if addr == nil {
+		return errors.New("address not owned by user")
+	}
+
+	report, err := su.dsn.buildDSN(su.from, original, statuses)
+	if err != nil {
+		return errors.Wrap(err, "cannot build DSN")
+	}
+
+	m, _, _, readers, err := message.Parse(bytes.NewReader(report), "", "")
+	if err != nil {
+		return errors.Wrap(err, "cannot parse DSN")
+	}
+	m.AddressID = addr.ID
+
+	body, err := message.BuildEncrypted(m, readers, addr.KeyRing())
+	if err != nil {
+		return errors.Wrap(err, "cannot encrypt DSN")
+	}
+
+	_, err = su.storeUser.ImportMessage(addr.ID, body, []string{pmapi.InboxLabel})
+	return err
+}
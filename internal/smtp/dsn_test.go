@@ -0,0 +1,246 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDSNOriginal = "From: <from@pm.me>\r\nTo: <to@example.com>\r\nSubject: Hello\r\n\r\nBody of the message\r\n"
+
+func newTestDSNRequest(ret goSMTPBackend.DSNReturn, envelopeID string, notify ...[]goSMTPBackend.DSNNotify) *dsnRequest {
+	req := newDSNRequest(&goSMTPBackend.MailOptions{Return: ret, EnvelopeID: envelopeID})
+	addresses := []string{"to@example.com", "second@example.com"}
+	for i, n := range notify {
+		req.addRecipient(addresses[i], &goSMTPBackend.RcptOptions{
+			Notify:                n,
+			OriginalRecipientType: goSMTPBackend.DSNAddressTypeRFC822,
+			OriginalRecipient:     "orig-" + addresses[i],
+		})
+	}
+	return req
+}
+
+var (
+	notifyNever   = []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifyNever}
+	notifySuccess = []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifySuccess}
+	notifyFailure = []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifyFailure}
+	notifyDelay   = []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifyDelayed}
+)
+
+func TestDSNRequest_isRequested(t *testing.T) {
+	testData := []struct {
+		name   string
+		req    *dsnRequest
+		wantOK bool
+	}{
+		{"no request", nil, false},
+		{"no notify", newTestDSNRequest("", "", nil), false},
+		{"never", newTestDSNRequest("", "", notifyNever), false},
+		{"delay", newTestDSNRequest("", "", notifyDelay), false},
+		{"success", newTestDSNRequest("", "", notifySuccess), true},
+		{"failure", newTestDSNRequest("", "", notifyFailure), true},
+		{"one of recipients", newTestDSNRequest("", "", notifyNever, notifyFailure), true},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantOK, tc.req.isRequested())
+		})
+	}
+}
+
+func TestDSNRequest_isNotifySet(t *testing.T) {
+	assert.False(t, (*dsnRequest)(nil).isNotifySet())
+	assert.False(t, newTestDSNRequest("", "", nil).isNotifySet())
+	assert.True(t, newTestDSNRequest("", "", notifyNever).isNotifySet())
+	assert.True(t, newTestDSNRequest("", "", nil, notifyFailure).isNotifySet())
+}
+
+func TestDSNRequest_shouldBounce(t *testing.T) {
+	permanentErr := newRecipientError("to@example.com", statusBadMailbox, errors.New("no such address"))
+	transientErr := newRecipientError("to@example.com", statusNoAnswer, errors.New("cannot reach the server"))
+
+	testData := []struct {
+		name    string
+		req     *dsnRequest
+		sendErr error
+		wantOK  bool
+	}{
+		{"all want failure", newTestDSNRequest("", "", notifyFailure, notifyFailure), permanentErr, true},
+		{"one does not want failure", newTestDSNRequest("", "", notifyFailure, notifySuccess), permanentErr, false},
+		{"never", newTestDSNRequest("", "", notifyNever), permanentErr, false},
+		{"transient failure", newTestDSNRequest("", "", notifyFailure), transientErr, false},
+		{"partial permanent failure", newTestDSNRequest("", "", notifyFailure, notifyFailure), newPartialSendError([]*recipientError{permanentErr}), true},
+		{"partial transient failure", newTestDSNRequest("", "", notifyFailure, notifyFailure), newPartialSendError([]*recipientError{permanentErr, transientErr}), false},
+		{"not recipient failure", newTestDSNRequest("", "", notifyFailure), errors.New("cannot parse"), false},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantOK, tc.req.shouldBounce(tc.sendErr))
+		})
+	}
+}
+
+func TestDSNRequest_getRecipientStatuses(t *testing.T) {
+	badAddressErr := newRecipientError(
+		"second@example.com",
+		getAPIErrorStatus(&pmapi.Error{Code: keysMissingAddressCode, ErrorMessage: "Address does not exist"}),
+		errors.New("backend: cannot get recipients' public keys: Address does not exist"),
+	)
+
+	testData := []struct {
+		name         string
+		req          *dsnRequest
+		sendErr      error
+		wantStatuses []dsnRecipientStatus
+	}{
+		{
+			"success",
+			newTestDSNRequest("", "", notifySuccess, notifyFailure),
+			nil,
+			[]dsnRecipientStatus{{action: "relayed", status: goSMTPBackend.EnhancedCode{2, 0, 0}}},
+		},
+		{
+			"failure of one recipient",
+			newTestDSNRequest("", "", notifyFailure, notifyFailure),
+			badAddressErr,
+			[]dsnRecipientStatus{
+				{action: "failed", status: statusOther, diagnostic: "smtp; 554 5.0.0 message not sent because sending to second@example.com failed"},
+				{action: "failed", status: statusBadMailbox, diagnostic: "smtp; 550 5.1.1 backend: cannot get recipients' public keys: Address does not exist"},
+			},
+		},
+		{
+			"partial failure",
+			newTestDSNRequest("", "", notifySuccess, notifyFailure),
+			newPartialSendError([]*recipientError{badAddressErr}),
+			[]dsnRecipientStatus{
+				{action: "relayed", status: goSMTPBackend.EnhancedCode{2, 0, 0}},
+				{action: "failed", status: statusBadMailbox, diagnostic: "smtp; 550 5.1.1 backend: cannot get recipients' public keys: Address does not exist"},
+			},
+		},
+		{
+			"failure not requested",
+			newTestDSNRequest("", "", notifySuccess, notifyNever),
+			badAddressErr,
+			nil,
+		},
+		{
+			"failure text with line breaks",
+			newTestDSNRequest("", "", notifyFailure),
+			newRecipientError("to@example.com", statusCryptographicIssue, errors.New("first line\r\nBcc: injected\r\n")),
+			[]dsnRecipientStatus{{action: "failed", status: statusCryptographicIssue, diagnostic: "smtp; 550 5.7.5 first line Bcc: injected"}},
+		},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			statuses := tc.req.getRecipientStatuses(tc.sendErr)
+			require.Len(t, statuses, len(tc.wantStatuses))
+			for i, want := range tc.wantStatuses {
+				assert.Equal(t, want.action, statuses[i].action)
+				assert.Equal(t, want.status, statuses[i].status)
+				assert.Equal(t, want.diagnostic, statuses[i].diagnostic)
+			}
+		})
+	}
+}
+
+func TestGetAPIErrorStatus(t *testing.T) {
+	assert.Equal(t, statusBadMailbox, getAPIErrorStatus(&pmapi.Error{Code: keysMissingAddressCode}))
+	assert.Equal(t, statusBadMailboxSyntax, getAPIErrorStatus(&pmapi.Error{Code: keysInvalidAddressCode}))
+	assert.Equal(t, statusNoAnswer, getAPIErrorStatus(pmapi.ErrAPINotReachable))
+	assert.Equal(t, statusOther, getAPIErrorStatus(errors.New("other")))
+	assert.Equal(t, statusOther, getAPIErrorStatus(&pmapi.Error{Code: 2001, Status: http.StatusUnprocessableEntity}))
+	assert.Equal(t, statusMessageTooBig, getAPIErrorStatus(&pmapi.Error{Code: pmapi.ImportMessageTooLong}))
+	assert.Equal(t, statusNotAuthorized, getAPIErrorStatus(&pmapi.Error{Code: pmapi.BansRequests, Status: http.StatusUnprocessableEntity}))
+	assert.Equal(t, statusMessageTooBig, getAPIErrorStatus(&pmapi.Error{Status: http.StatusRequestEntityTooLarge}))
+	assert.Equal(t, statusNotAuthorized, getAPIErrorStatus(&pmapi.Error{Status: http.StatusForbidden}))
+	assert.Equal(t, statusSystemNotAccepting, getAPIErrorStatus(&pmapi.Error{Status: http.StatusServiceUnavailable}))
+	assert.Equal(t, statusBadConnection, getAPIErrorStatus(&pmapi.Error{Status: http.StatusGatewayTimeout}))
+	assert.Equal(t, statusSystemTemporary, getAPIErrorStatus(&pmapi.Error{Status: http.StatusInternalServerError}))
+}
+
+func TestDSNRequest_buildDSN(t *testing.T) {
+	sendErr := newRecipientError("to@example.com", statusBadMailbox, errors.New("Address does not exist"))
+
+	testData := []struct {
+		name        string
+		req         *dsnRequest
+		sendErr     error
+		wantParts   []string
+		unwantParts []string
+	}{
+		{
+			"success with headers only",
+			newTestDSNRequest(goSMTPBackend.DSNReturnHeaders, "", notifySuccess),
+			nil,
+			[]string{
+				"Subject: Delivery Status Notification (Success)",
+				"From: \"Mail Delivery System\" <MAILER-DAEMON@pm.me>",
+				"Content-Type: multipart/report; report-type=delivery-status;",
+				"Content-Type: message/delivery-status",
+				"Final-Recipient: rfc822; to@example.com",
+				"Original-Recipient: RFC822; orig-to@example.com",
+				"Action: relayed",
+				"Status: 2.0.0",
+				"Content-Type: text/rfc822-headers",
+				"Subject: Hello",
+			},
+			[]string{"Original-Envelope-Id", "Diagnostic-Code", "Body of the message"},
+		},
+		{
+			"failure with full message and envelope ID",
+			newTestDSNRequest(goSMTPBackend.DSNReturnFull, "envelope-1", notifyFailure),
+			sendErr,
+			[]string{
+				"Subject: Delivery Status Notification (Failure)",
+				"Your message could not be sent to the following recipients:",
+				"to@example.com: 550 5.1.1 Address does not exist",
+				"Original-Envelope-Id: envelope-1",
+				"Action: failed",
+				"Status: 5.1.1",
+				"Diagnostic-Code: smtp; 550 5.1.1 Address does not exist",
+				"Content-Type: message/rfc822",
+				"Body of the message",
+			},
+			[]string{"text/rfc822-headers"},
+		},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := tc.req.buildDSN("from@pm.me", []byte(testDSNOriginal), tc.req.getRecipientStatuses(tc.sendErr))
+			require.NoError(t, err)
+			for _, part := range tc.wantParts {
+				assert.Contains(t, string(report), part)
+			}
+			for _, part := range tc.unwantParts {
+				assert.NotContains(t, string(report), part)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"strings"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	goSMTPBackend "github.com/emersion/go-smtp"
+)
+
+// encryptToHeader overrides for a single message whether it is encrypted
+// for external recipients. The value is a comma separated list of
+// `address=yes` or `address=no`; the header can be used more than once.
+// Messages to internal recipients are always encrypted.
+const encryptToHeader = "X-Pm-Encrypt-To"
+
+var errInvalidEncryptTo = &goSMTPBackend.SMTPError{ //nolint[gochecknoglobals]
+	Code:         554,
+	EnhancedCode: goSMTPBackend.EnhancedCode{5, 6, 0},
+	Message:      "invalid " + encryptToHeader + " header",
+}
+
+// parseEncryptToHeader returns the encryption preference for each address
+// listed in the header `values`. Addresses are lowercased.
+func parseEncryptToHeader(values []string) (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 {
+				return nil, errInvalidEncryptTo
+			}
+			address := strings.ToLower(strings.TrimSpace(parts[0]))
+			encrypt, ok := parseYesNo(parts[1])
+			if address == "" || !ok {
+				return nil, errInvalidEncryptTo
+			}
+			overrides[address] = encrypt
+		}
+	}
+	return overrides, nil
+}
+
+// applyEncryptOverride changes encryption of the message for the external
+// recipient. Encryption is possible only when there is a key of the
+// recipient, either pinned in the contact or provided by the API or WKD.
+func applyEncryptOverride(
+	sendingInfo SendingInfo,
+	contactMeta *ContactMetadata,
+	encrypt bool,
+	apiKeys,
+	contactKeys []*pmcrypto.KeyRing,
+	composeMode string,
+	settingsSign bool,
+	settingsPgpScheme int,
+) (SendingInfo, error) {
+	if sendingInfo.Encrypt == encrypt {
+		return sendingInfo, nil
+	}
+
+	sendingInfo.Encrypt = encrypt
+	if encrypt {
+		contactKeys, err := pmcrypto.FilterExpiredKeys(contactKeys)
+		if err != nil {
+			return sendingInfo, err
+		}
+		switch {
+		case len(contactKeys) > 0:
+			sendingInfo.PublicKey = contactKeys[0]
+		case len(apiKeys) > 0:
+			sendingInfo.PublicKey = apiKeys[0]
+		default:
+			return sendingInfo, errors.New("no public key to encrypt the message for the recipient")
+		}
+		sendingInfo.Sign = true
+	} else {
+		sendingInfo.PublicKey = nil
+		if contactMeta != nil && !contactMeta.SignMissing {
+			sendingInfo.Sign = contactMeta.Sign
+		} else {
+			sendingInfo.Sign = settingsSign
+		}
+	}
+
+	var err error
+	sendingInfo.Scheme, sendingInfo.MIMEType, err = schemeAndMIME(contactMeta,
+		settingsPgpScheme,
+		composeMode,
+		sendingInfo.Encrypt,
+		sendingInfo.Sign)
+	return sendingInfo, err
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"strings"
+	"testing"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEncryptToHeader(t *testing.T) {
+	overrides, err := parseEncryptToHeader([]string{"Alice@example.com=no, bob@example.com=yes", "carol@example.com = no"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"alice@example.com": false,
+		"bob@example.com":   true,
+		"carol@example.com": false,
+	}, overrides)
+
+	overrides, err = parseEncryptToHeader(nil)
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	for _, value := range []string{"alice@example.com", "alice@example.com=maybe", "=no"} {
+		_, err = parseEncryptToHeader([]string{value})
+		assert.Equal(t, errInvalidEncryptTo, err, value)
+	}
+}
+
+func TestApplyEncryptOverride(t *testing.T) {
+	pubKey, err := pmcrypto.ReadArmoredKeyRing(strings.NewReader(testPublicKey))
+	require.NoError(t, err)
+
+	clear := SendingInfo{Scheme: pmapi.ClearPackage, MIMEType: pmapi.ContentTypeHTML}
+	encrypted := SendingInfo{Encrypt: true, Sign: true, Scheme: pmapi.PGPMIMEPackage, MIMEType: pmapi.ContentTypeMultipartMixed, PublicKey: pubKey}
+
+	sendingInfo, err := applyEncryptOverride(clear, nil, true, []*pmcrypto.KeyRing{pubKey}, nil, pmapi.ContentTypeHTML, false, pmapi.PGPMIMEPackage)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, sendingInfo)
+
+	sendingInfo, err = applyEncryptOverride(encrypted, nil, false, []*pmcrypto.KeyRing{pubKey}, nil, pmapi.ContentTypeHTML, false, pmapi.PGPMIMEPackage)
+	require.NoError(t, err)
+	assert.Equal(t, clear, sendingInfo)
+
+	sendingInfo, err = applyEncryptOverride(encrypted, &ContactMetadata{Sign: true}, false, nil, []*pmcrypto.KeyRing{pubKey}, pmapi.ContentTypeHTML, false, pmapi.PGPMIMEPackage)
+	require.NoError(t, err)
+	assert.Equal(t, SendingInfo{Sign: true, Scheme: pmapi.ClearMIMEPackage, MIMEType: pmapi.ContentTypeMultipartMixed}, sendingInfo)
+
+	_, err = applyEncryptOverride(clear, nil, true, nil, nil, pmapi.ContentTypeHTML, false, pmapi.PGPMIMEPackage)
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var errNoSuchUser = &goSMTPBackend.SMTPError{ //nolint[gochecknoglobals]
+	Code:         550,
+	EnhancedCode: statusBadMailbox,
+	Message:      "No such user here",
+}
+
+// lmtpMaxMessageBytes limits the read message when no limit of connected
+// users is known.
+const lmtpMaxMessageBytes = 64 * 1024 * 1024
+
+// lmtpBackend creates sessions of LMTP server (RFC 2033) which imports
+// messages into the Inbox of recipients, e.g. handed over by fetchmail,
+// getmail or a local MTA.
+type lmtpBackend struct {
+	*smtpBackend
+}
+
+// NewLMTPServer returns an LMTP server importing messages to the connected users.
+// No authentication is needed, recipients have to be addresses of connected users.
+// Therefore the server listens only on localhost regardless of the bind address
+// of IMAP and SMTP.
+func NewLMTPServer(debug bool, port int, smtpBackend *smtpBackend, eventListener listener.Listener) *smtpServer { //nolint[golint]
+	return &smtpServer{
+		newServer: func(maxMessageBytes int64) *goSMTPBackend.Server {
+			return newLMTPGoSMTPServer(debug, smtpBackend, maxMessageBytes)
+		},
+		addr:          net.JoinHostPort(bridge.Host, strconv.Itoa(port)),
+		backend:       smtpBackend,
+		eventListener: eventListener,
+	}
+}
+
+func newLMTPGoSMTPServer(debug bool, smtpBackend *smtpBackend, maxMessageBytes int64) *goSMTPBackend.Server {
+	s := goSMTPBackend.NewServer(&lmtpBackend{smtpBackend: smtpBackend})
+	s.LMTP = true
+	s.Domain = bridge.Host
+	s.EnableSMTPUTF8 = true
+	// Refreshed by monitorMaxMessageBytes as for SMTP.
+	s.MaxMessageBytes = maxMessageBytes
+
+	if debug {
+		s.Debug = logrus.
+			WithField("pkg", "lmtp/server").
+			WriterLevel(logrus.DebugLevel)
+	}
+
+	return s
+}
+
+func (lb *lmtpBackend) NewSession(_ *goSMTPBackend.Conn) (goSMTPBackend.Session, error) {
+	return &lmtpSession{backend: lb.smtpBackend}, nil
+}
+
+type lmtpRecipient struct {
+	address string
+	user    bridgeUser
+}
+
+type lmtpSession struct {
+	backend    *smtpBackend
+	from       string
+	recipients []*lmtpRecipient
+}
+
+func (ls *lmtpSession) AuthPlain(username, password string) error {
+	return goSMTPBackend.ErrAuthUnsupported
+}
+
+func (ls *lmtpSession) Mail(from string, opts *goSMTPBackend.MailOptions) error {
+	ls.from = from
+	return nil
+}
+
+// Rcpt accepts only addresses of connected users.
+func (ls *lmtpSession) Rcpt(to string, opts *goSMTPBackend.RcptOptions) error {
+	to = strings.ToLower(to)
+	user, err := ls.backend.bridge.GetUser(to)
+	if err != nil {
+		return errNoSuchUser
+	}
+	if _, err := user.GetAddressID(to); err != nil {
+		return errNoSuchUser
+	}
+	ls.recipients = append(ls.recipients, &lmtpRecipient{address: to, user: user})
+	return nil
+}
+
+// Data is used only if the client does not speak LMTP; the first error is returned.
+func (ls *lmtpSession) Data(r io.Reader) error {
+	msg, err := ls.readMessage(r)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range ls.recipients {
+		if err := ls.importMessage(rcpt, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LMTPData imports the message for each recipient and reports each result separately.
+func (ls *lmtpSession) LMTPData(r io.Reader, status goSMTPBackend.StatusCollector) error {
+	msg, err := ls.readMessage(r)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range ls.recipients {
+		status.SetStatus(rcpt.address, ls.importMessage(rcpt, msg))
+	}
+	return nil
+}
+
+// readMessage reads the whole message up to the size limit of connected users.
+func (ls *lmtpSession) readMessage(r io.Reader) ([]byte, error) {
+	limit := ls.backend.getMaxMessageBytes()
+	if limit == 0 {
+		limit = lmtpMaxMessageBytes
+	}
+	return ioutil.ReadAll(newLimitedReader(r, limit))
+}
+
+func (ls *lmtpSession) Reset() {
+	ls.from = ""
+	ls.recipients = nil
+}
+
+func (ls *lmtpSession) Logout() error {
+	return nil
+}
+
+// importMessage encrypts the message by the recipient address key and
+// imports it into the Inbox.
+func (ls *lmtpSession) importMessage(rcpt *lmtpRecipient, msg []byte) error {
+	l := log.WithField("recipient", rcpt.address)
+
+	storeUser := rcpt.user.GetStore()
+	if storeUser == nil {
+		return toSMTPError(newRecipientError(rcpt.address, statusNoAnswer, errors.New("user database is not initialized")))
+	}
+	addr := rcpt.user.GetTemporaryPMAPIClient().Addresses().ByEmail(rcpt.address)
+	if addr == nil {
+		return errNoSuchUser
+	}
+
+	m, _, _, readers, err := message.Parse(bytes.NewReader(msg), "", "")
+	if err != nil {
+		return toSMTPError(newRecipientError(rcpt.address, statusInvalidMessage, errors.Wrap(err, "cannot parse message")))
+	}
+	m.AddressID = addr.ID
+
+	body, err := message.BuildEncrypted(m, readers, addr.KeyRing())
+	if err != nil {
+		return toSMTPError(newRecipientError(rcpt.address, statusCryptographicIssue, errors.Wrap(err, "cannot encrypt message")))
+	}
+
+	if _, err := storeUser.ImportMessage(addr.ID, body, []string{pmapi.InboxLabel}); err != nil {
+		l.WithError(err).Error("Cannot import LMTP message")
+		return toSMTPError(newRecipientError(rcpt.address, getAPIErrorStatus(err), err))
+	}
+
+	l.WithField("from", ls.from).Info("LMTP message imported")
+	return nil
+}
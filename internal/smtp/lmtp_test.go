@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLMTPServerListensOnLocalhost(t *testing.T) {
+	backend := newSMTPBackend(&testPanicHandler{}, listener.New(), &testConfig{}, nil, &testBridge{})
+	s := NewLMTPServer(false, 2400, backend, listener.New())
+	assert.Equal(t, bridge.Host+":2400", s.addr)
+}
+
+func TestLMTPReadMessageLimit(t *testing.T) {
+	b := &testBridge{users: []bridgeUser{&testBridgeUser{maxUpload: 3}}}
+	ls := &lmtpSession{backend: newSMTPBackend(&testPanicHandler{}, listener.New(), &testConfig{}, nil, b)}
+
+	limit := ls.backend.getMaxMessageBytes()
+	msg, err := ls.readMessage(bytes.NewReader(make([]byte, limit)))
+	require.NoError(t, err)
+	assert.Len(t, msg, int(limit))
+
+	_, err = ls.readMessage(bytes.NewReader(make([]byte, limit+1)))
+	assert.Equal(t, errMessageTooLarge, err)
+}
+
+func TestLMTPReadMessageWithoutKnownLimit(t *testing.T) {
+	ls := &lmtpSession{backend: newSMTPBackend(&testPanicHandler{}, listener.New(), &testConfig{}, nil, &testBridge{})}
+
+	_, err := ls.readMessage(bytes.NewReader(make([]byte, lmtpMaxMessageBytes+1)))
+	assert.Equal(t, errMessageTooLarge, err)
+}
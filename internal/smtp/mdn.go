@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// dispositionNotificationToHeader requests message disposition notification
+// (read receipt), see RFC 8098.
+const dispositionNotificationToHeader = "Disposition-Notification-To"
+
+// requestsDispositionNotification returns whether the sender asks recipients
+// for read receipt. The API then has to know about it from message flags.
+func requestsDispositionNotification(h mail.Header) bool {
+	return strings.TrimSpace(h.Get(dispositionNotificationToHeader)) != ""
+}
+
+// isDispositionNotification returns whether the message is a read receipt
+// generated by the client.
+func isDispositionNotification(h mail.Header) bool {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "multipart/report" && strings.EqualFold(params["report-type"], "disposition-notification")
+}
+
+// keepMIMEStructure switches external recipients to MIME packages, because
+// receiving clients recognise notifications only by the structure of the
+// message which is lost when sending body and attachments separately.
+// Internal recipients always receive the message through ProtonMail.
+func keepMIMEStructure(sendingInfo SendingInfo) SendingInfo {
+	switch sendingInfo.Scheme {
+	case pmapi.ClearPackage:
+		sendingInfo.Scheme = pmapi.ClearMIMEPackage
+	case pmapi.PGPInlinePackage:
+		sendingInfo.Scheme = pmapi.PGPMIMEPackage
+	}
+	return sendingInfo
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestsDispositionNotification(t *testing.T) {
+	assert.True(t, requestsDispositionNotification(mail.Header{"Disposition-Notification-To": {"<a@pm.me>"}}))
+	assert.False(t, requestsDispositionNotification(mail.Header{"Disposition-Notification-To": {" "}}))
+	assert.False(t, requestsDispositionNotification(mail.Header{}))
+}
+
+func TestIsDispositionNotification(t *testing.T) {
+	testCases := map[string]bool{
+		`multipart/report; report-type=disposition-notification; boundary="XX"`: true,
+		`multipart/report; report-type="Disposition-Notification"`:              true,
+		`multipart/report; report-type=delivery-status`:                         false,
+		`multipart/mixed; boundary="XX"`:                                        false,
+		`not a content type`:                                                    false,
+	}
+	for contentType, want := range testCases {
+		assert.Equal(t, want, isDispositionNotification(mail.Header{"Content-Type": {contentType}}), contentType)
+	}
+}
+
+func TestKeepMIMEStructure(t *testing.T) {
+	testCases := map[int]int{
+		pmapi.InternalPackage:  pmapi.InternalPackage,
+		pmapi.ClearPackage:     pmapi.ClearMIMEPackage,
+		pmapi.PGPInlinePackage: pmapi.PGPMIMEPackage,
+		pmapi.PGPMIMEPackage:   pmapi.PGPMIMEPackage,
+		pmapi.ClearMIMEPackage: pmapi.ClearMIMEPackage,
+	}
+	for scheme, want := range testCases {
+		assert.Equal(t, want, keepMIMEStructure(SendingInfo{Scheme: scheme}).Scheme, scheme)
+	}
+}
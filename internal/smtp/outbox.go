@@ -0,0 +1,586 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+)
+
+const (
+	outboxCheckInterval = 30 * time.Second
+	outboxMinRetryDelay = time.Minute
+	outboxMaxRetryDelay = time.Hour
+	// outboxExpiration is how long temporary errors are retried before
+	// the message is bounced, the same as the usual MTA queue lifetime.
+	outboxExpiration = 5 * 24 * time.Hour
+
+	outboxItemExt = ".json"
+)
+
+// OutboxItem is a message accepted over SMTP which could not be sent yet
+// because of a temporary error, such as the API not being reachable.
+type OutboxItem struct {
+	ID          string
+	Username    string
+	From        string
+	To          []string
+	Created     time.Time
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+
+	// SendAfter is the time the message is scheduled to be sent at.
+	SendAfter time.Time
+
+	// RateLimited is whether the message was counted by the rate limit
+	// already, so retries do not count it again.
+	RateLimited bool
+
+	// Message is the original message encrypted by the sender address key.
+	Message []byte `json:",omitempty"`
+}
+
+// outbox keeps queued messages, one file per message in directory `path`.
+type outbox struct {
+	lock    *sync.Mutex
+	items   map[string]*OutboxItem
+	sending map[string]bool
+	path    string
+}
+
+// newOutbox returns outbox persisted in directory `path`.
+// If `path` is empty, the outbox is kept in memory only.
+func newOutbox(path string) *outbox {
+	o := &outbox{
+		lock:    &sync.Mutex{},
+		items:   map[string]*OutboxItem{},
+		sending: map[string]bool{},
+		path:    path,
+	}
+
+	if err := o.load(); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("Could not load outbox")
+	}
+
+	return o
+}
+
+func (o *outbox) load() error {
+	if o.path == "" {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(o.path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != outboxItemExt {
+			continue
+		}
+		item, err := loadOutboxItem(filepath.Join(o.path, file.Name()))
+		if err != nil {
+			log.WithError(err).WithField("file", file.Name()).Warn("Could not load outbox item")
+			continue
+		}
+		o.items[item.ID] = item
+	}
+
+	return nil
+}
+
+func loadOutboxItem(path string) (*OutboxItem, error) {
+	f, err := os.Open(path) //nolint[gosec]
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	item := &OutboxItem{}
+	if err := json.NewDecoder(f).Decode(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func getOutboxItemID(item *OutboxItem) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(item.Username + item.From + strings.Join(item.To, ",")))
+	_, _ = h.Write([]byte(item.Created.String()))
+	_, _ = h.Write(item.Message)
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// add stores a new item in the outbox.
+func (o *outbox) add(item *OutboxItem) error {
+	item.ID = getOutboxItemID(item)
+	return o.update(item)
+}
+
+// update saves the item and then replaces the one with the same ID.
+// Each item has its own file so the lock is not held while writing.
+func (o *outbox) update(item *OutboxItem) error {
+	if err := o.save(item); err != nil {
+		return err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.items[item.ID] = item
+	return nil
+}
+
+// remove deletes the item and returns whether it was in the outbox.
+func (o *outbox) remove(id string) bool {
+	o.lock.Lock()
+	_, ok := o.items[id]
+	delete(o.items, id)
+	o.lock.Unlock()
+
+	o.removeFile(id)
+	return ok
+}
+
+// cancel deletes the item unless it is being sent at the moment.
+func (o *outbox) cancel(id string) (*OutboxItem, error) {
+	o.lock.Lock()
+	item, ok := o.items[id]
+	switch {
+	case !ok:
+		o.lock.Unlock()
+		return nil, errors.New("no such message in outbox")
+	case o.sending[id]:
+		o.lock.Unlock()
+		return nil, errors.New("message is being sent")
+	}
+	delete(o.items, id)
+	o.lock.Unlock()
+
+	o.removeFile(id)
+	return item, nil
+}
+
+func (o *outbox) removeFile(id string) {
+	if o.path == "" {
+		return
+	}
+	if err := os.Remove(o.getItemPath(id)); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("id", id).Warn("Could not remove outbox item")
+	}
+}
+
+// startSending marks the item as being sent, so it cannot be cancelled
+// until finishSending is called. It returns false if the item is not
+// in the outbox anymore.
+func (o *outbox) startSending(id string) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if _, ok := o.items[id]; !ok {
+		return false
+	}
+	o.sending[id] = true
+	return true
+}
+
+func (o *outbox) finishSending(id string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.sending, id)
+}
+
+// getItems returns copies of all items sorted from the oldest.
+// If `withMessage` is false, the message itself is not included.
+func (o *outbox) getItems(withMessage bool) []*OutboxItem {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	items := []*OutboxItem{}
+	for _, item := range o.items {
+		itemCopy := *item
+		itemCopy.To = append([]string{}, item.To...)
+		if !withMessage {
+			itemCopy.Message = nil
+		}
+		items = append(items, &itemCopy)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Created.Before(items[j].Created)
+	})
+	return items
+}
+
+// getDueItems returns items which should be retried at `now`.
+// If `all` is true, all items are returned regardless of their next attempt,
+// except those scheduled to be sent later.
+func (o *outbox) getDueItems(now time.Time, all bool) (items []*OutboxItem) {
+	for _, item := range o.getItems(true) {
+		if item.SendAfter.After(now) {
+			continue
+		}
+		if all || !item.NextAttempt.After(now) {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+func (o *outbox) getItemPath(id string) string {
+	return filepath.Join(o.path, id+outboxItemExt)
+}
+
+// save writes the item to a temporary file which then replaces the old one,
+// so a crash during writing never leaves a truncated item behind.
+func (o *outbox) save(item *OutboxItem) error {
+	if o.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(o.path, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(o.path, item.ID+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) //nolint[errcheck]
+
+	if err := json.NewEncoder(f).Encode(item); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, o.getItemPath(item.ID))
+}
+
+// getOutboxRetryDelay returns the delay before the next attempt, doubled
+// after each failed attempt.
+func getOutboxRetryDelay(attempts int) time.Duration {
+	delay := outboxMinRetryDelay
+	for i := 1; i < attempts && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxRetryDelay {
+		return outboxMaxRetryDelay
+	}
+	return delay
+}
+
+// isTemporarySendError returns whether sending can succeed later,
+// i.e., the message should be queued in the outbox.
+func isTemporarySendError(err error) bool {
+	return err != nil && getAPIErrorStatus(err)[0] == 4
+}
+
+// isExpired returns whether temporary errors should not be retried anymore.
+// Scheduled messages expire counting from the time they are scheduled at.
+func (item *OutboxItem) isExpired(now time.Time) bool {
+	since := item.Created
+	if item.SendAfter.After(since) {
+		since = item.SendAfter
+	}
+	return now.Sub(since) >= outboxExpiration
+}
+
+// queueMessage stores the `original` message in the outbox to be sent later
+// to recipients `to`. The message is sent at `sendAfter` if set, otherwise
+// it is retried after failed sending with `sendErr`.
+func (su *smtpUser) queueMessage(original []byte, to []string, sendAfter time.Time, sendErr error) error {
+	addr := getSendingAddress(su.client.Addresses(), su.from)
+	if addr == nil {
+		return errors.New("address not owned by user")
+	}
+
+	encrypted, err := addr.KeyRing().Encrypt(pmcrypto.NewPlainMessage(original), nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot encrypt message")
+	}
+
+	now := time.Now()
+	item := &OutboxItem{
+		Username:    su.username,
+		From:        su.from,
+		To:          append([]string{}, to...),
+		Created:     now,
+		NextAttempt: sendAfter,
+		SendAfter:   sendAfter,
+		Message:     encrypted.GetBinary(),
+	}
+	switch {
+	case sendErr == errRateLimited:
+		// Nothing failed yet, see retryOutboxItem.
+		item.LastError = sendErr.Error()
+	case sendErr != nil:
+		// Sending was attempted, so the message was counted already.
+		item.RateLimited = true
+		item.Attempts = 1
+		item.NextAttempt = now.Add(getOutboxRetryDelay(1))
+		item.LastError = sendErr.Error()
+	}
+	if err := su.backend.outbox.add(item); err != nil {
+		return err
+	}
+
+	log.WithField("id", item.ID).WithField("sendAfter", sendAfter).WithError(sendErr).Info("Message queued in outbox")
+	return nil
+}
+
+// sendOutboxItem decrypts the queued message and sends it.
+func (su *smtpUser) sendOutboxItem(item *OutboxItem) (messageID string, size int, err error) {
+	addr := getSendingAddress(su.client.Addresses(), item.From)
+	if addr == nil {
+		return "", 0, errors.New("backend: invalid email address: not owned by user")
+	}
+
+	original, err := addr.KeyRing().Decrypt(pmcrypto.NewPGPMessage(item.Message), nil, 0)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "cannot decrypt queued message")
+	}
+
+	messageID, err = su.Send(item.From, item.To, original.NewReader())
+	return messageID, len(original.GetBinary()), err
+}
+
+// bounceOutboxItem imports a failure notification for all recipients of
+// the queued message which will not be retried anymore.
+func (su *smtpUser) bounceOutboxItem(item *OutboxItem, sendErr error) error {
+	addr := getSendingAddress(su.client.Addresses(), item.From)
+	if addr == nil {
+		return errors.New("address not owned by user")
+	}
+
+	original, err := addr.KeyRing().Decrypt(pmcrypto.NewPGPMessage(item.Message), nil, 0)
+	if err != nil {
+		return errors.Wrap(err, "cannot decrypt queued message")
+	}
+
+	su.dsn = newDSNRequest(nil)
+	for _, to := range item.To {
+		su.dsn.addRecipient(to, &goSMTPBackend.RcptOptions{
+			Notify: []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifyFailure},
+		})
+	}
+
+	return su.importDSN(original.GetBinary(), su.dsn.getRecipientStatuses(sendErr))
+}
+
+// GetOutboxItems returns messages waiting in the outbox, without their content.
+func (sb *smtpBackend) GetOutboxItems() []*OutboxItem {
+	return sb.outbox.getItems(false)
+}
+
+// CancelOutboxItem removes the message with `id` from the outbox so it is
+// never sent. Message which is being sent at the moment cannot be cancelled.
+func (sb *smtpBackend) CancelOutboxItem(id string) error {
+	item, err := sb.outbox.cancel(id)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("id", id).Info("Queued message was cancelled")
+	sb.sendJournal.add(newJournalEntry(item.Username, item.From, item.To, 0, "", JournalResultCancelled, nil))
+	return nil
+}
+
+// getSendDelay returns how long sent messages wait in the outbox before
+// they are sent, so the user can cancel them.
+func (sb *smtpBackend) getSendDelay() time.Duration {
+	return time.Duration(sb.preferences.GetInt(preferences.SendDelayKey)) * time.Second
+}
+
+// wakeOutboxAt makes the outbox to retry due items at `t`, sooner than
+// with the usual check interval.
+func (sb *smtpBackend) wakeOutboxAt(t time.Time) {
+	time.AfterFunc(time.Until(t), func() {
+		select {
+		case sb.outboxWakeCh <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// processOutbox periodically retries sending of queued messages.
+// All of them are retried immediately when the internet connection is back.
+// Drafts of abandoned sends are cleaned up periodically as well.
+func (sb *smtpBackend) processOutbox() {
+	defer sb.panicHandler.HandlePanic()
+
+	internetOnCh := make(chan string)
+	sb.eventListener.Add(events.InternetOnEvent, internetOnCh)
+
+	ticker := time.NewTicker(outboxCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sb.retryOutbox(false)
+			sb.cleanupAbandonedDrafts()
+		case <-internetOnCh:
+			sb.retryOutbox(true)
+		case <-sb.outboxWakeCh:
+			sb.retryOutbox(false)
+		}
+	}
+}
+
+func (sb *smtpBackend) retryOutbox(all bool) {
+	for _, item := range sb.outbox.getDueItems(time.Now(), all) {
+		sb.retryOutboxItem(item)
+	}
+}
+
+func (sb *smtpBackend) retryOutboxItem(item *OutboxItem) {
+	l := log.WithField("id", item.ID)
+
+	// The item could be cancelled since the due items were listed.
+	if !sb.outbox.startSending(item.ID) {
+		return
+	}
+	defer sb.outbox.finishSending(item.ID)
+
+	// Waiting for the rate limit is not a failed attempt and never expires.
+	// Each message is counted once, failed attempts are not counted again.
+	if !item.RateLimited {
+		if wait := sb.rateLimiter.take(item.Username, sb.getRateLimit(), time.Now()); wait > 0 {
+			l.WithField("wait", wait).Debug("Queued message is over the rate limit")
+			item.NextAttempt = time.Now().Add(wait)
+			item.LastError = errRateLimited.Error()
+			if err := sb.outbox.update(item); err != nil {
+				l.WithError(err).Warn("Could not update outbox item")
+			}
+			return
+		}
+		item.RateLimited = true
+	}
+
+	// The user can be logged out in the meantime; such item is retried
+	// until it expires the same way as when the API is not reachable.
+	var messageID string
+	var size int
+	su, err := sb.newOutboxSession(item)
+	if err == nil {
+		messageID, size, err = su.sendOutboxItem(item)
+	}
+
+	if partialErr, ok := err.(*partialSendError); ok {
+		sb.handlePartiallySentOutboxItem(su, item, messageID, size, partialErr)
+		return
+	}
+
+	switch {
+	case err == nil:
+		l.Info("Queued message was sent")
+		sb.outbox.remove(item.ID)
+		sb.sendJournal.add(newJournalEntry(item.Username, item.From, item.To, size, messageID, JournalResultSent, nil))
+	case (su == nil || isTemporarySendError(err)) && !item.isExpired(time.Now()):
+		l.WithError(err).Debug("Queued message cannot be sent yet")
+		item.Attempts++
+		item.NextAttempt = time.Now().Add(getOutboxRetryDelay(item.Attempts))
+		item.LastError = err.Error()
+		if err := sb.outbox.update(item); err != nil {
+			l.WithError(err).Warn("Could not update outbox item")
+		}
+	default:
+		l.WithError(err).Error("Queued message cannot be sent")
+		sb.outbox.remove(item.ID)
+		sb.sendJournal.add(newJournalEntry(item.Username, item.From, item.To, size, messageID, JournalResultFailed, err))
+		sb.eventListener.Emit(events.ErrorEvent, "Queued message from "+item.From+" cannot be sent: "+err.Error())
+		if su == nil {
+			return
+		}
+		if err := su.bounceOutboxItem(item, err); err != nil {
+			l.WithError(err).Error("Cannot import DSN for queued message")
+		}
+	}
+}
+
+// handlePartiallySentOutboxItem keeps in the outbox only recipients which
+// failed temporarily, so the others do not get the message again. Recipients
+// which failed permanently, or all of them when the item expired, get
+// a failure notification.
+func (sb *smtpBackend) handlePartiallySentOutboxItem(su *smtpUser, item *OutboxItem, messageID string, size int, partialErr *partialSendError) {
+	l := log.WithField("id", item.ID)
+	sb.sendJournal.add(newJournalEntry(item.Username, item.From, item.To, size, messageID, JournalResultPartial, partialErr))
+
+	temporary, permanent := partialErr.split()
+	if item.isExpired(time.Now()) {
+		permanent = append(permanent, temporary...)
+		temporary = nil
+	}
+
+	if len(permanent) > 0 {
+		failedErr := newPartialSendError(permanent)
+		l.WithError(failedErr).Error("Queued message cannot be sent to all recipients")
+		sb.eventListener.Emit(events.ErrorEvent, "Queued message from "+item.From+" cannot be sent: "+failedErr.Error())
+		if err := su.bounceOutboxItem(item, failedErr); err != nil {
+			l.WithError(err).Error("Cannot import DSN for queued message")
+		}
+	}
+
+	if len(temporary) == 0 {
+		sb.outbox.remove(item.ID)
+		return
+	}
+	l.WithError(partialErr).Debug("Queued message cannot be sent to all recipients yet")
+	item.To = getRecipientAddresses(temporary)
+	item.Attempts++
+	item.NextAttempt = time.Now().Add(getOutboxRetryDelay(item.Attempts))
+	item.LastError = partialErr.Error()
+	if err := sb.outbox.update(item); err != nil {
+		l.WithError(err).Warn("Could not update outbox item")
+	}
+}
+
+// newOutboxSession returns session of the user who queued the item.
+func (sb *smtpBackend) newOutboxSession(item *OutboxItem) (*smtpUser, error) {
+	user, addressID, err := sb.getUser(item.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	su := newSMTPUser(sb.panicHandler, sb.eventListener, sb, nil)
+	if err := su.setUser(item.Username, user, addressID); err != nil {
+		return nil, err
+	}
+	su.from = item.From
+	su.to = item.To
+	return su, nil
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	bridgemocks "github.com/ProtonMail/proton-bridge/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/golang/mock/gomock"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox_persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	o := newOutbox(dir)
+	first := &OutboxItem{Username: "user@pm.me", From: "user@pm.me", To: []string{"a@pm.me"}, Created: time.Now(), Message: []byte("first")}
+	second := &OutboxItem{Username: "user@pm.me", From: "user@pm.me", To: []string{"b@pm.me"}, Created: time.Now().Add(time.Second), Message: []byte("second")}
+	require.NoError(t, o.add(second))
+	require.NoError(t, o.add(first))
+	assert.NotEqual(t, first.ID, second.ID)
+
+	loaded := newOutbox(dir)
+	items := loaded.getItems(true)
+	require.Len(t, items, 2)
+	assert.Equal(t, first.ID, items[0].ID)
+	assert.Equal(t, []byte("first"), items[0].Message)
+	assert.Equal(t, second.ID, items[1].ID)
+
+	assert.True(t, loaded.remove(first.ID))
+	assert.False(t, loaded.remove(first.ID))
+	items = newOutbox(dir).getItems(false)
+	require.Len(t, items, 1)
+	assert.Equal(t, second.ID, items[0].ID)
+	assert.Nil(t, items[0].Message)
+}
+
+func TestCancelOutboxItem(t *testing.T) {
+	sb := &smtpBackend{outbox: newOutbox(""), sendJournal: newSendJournal("")}
+	item := &OutboxItem{Username: "user@pm.me", From: "user@pm.me", To: []string{"a@pm.me"}, Created: time.Now()}
+	require.NoError(t, sb.outbox.add(item))
+
+	require.NoError(t, sb.CancelOutboxItem(item.ID))
+	assert.Empty(t, sb.GetOutboxItems())
+	assert.Len(t, sb.GetJournalEntries(JournalResultCancelled, 0), 1)
+
+	assert.Error(t, sb.CancelOutboxItem(item.ID))
+}
+
+func TestCancelOutboxItemBeingSent(t *testing.T) {
+	sb := &smtpBackend{outbox: newOutbox(""), sendJournal: newSendJournal("")}
+	item := &OutboxItem{Username: "user@pm.me", From: "user@pm.me", To: []string{"a@pm.me"}, Created: time.Now()}
+	require.NoError(t, sb.outbox.add(item))
+
+	require.True(t, sb.outbox.startSending(item.ID))
+	assert.Error(t, sb.CancelOutboxItem(item.ID))
+	assert.Len(t, sb.GetOutboxItems(), 1)
+	assert.Empty(t, sb.GetJournalEntries(JournalResultCancelled, 0))
+
+	sb.outbox.finishSending(item.ID)
+	require.NoError(t, sb.CancelOutboxItem(item.ID))
+	assert.False(t, sb.outbox.startSending(item.ID))
+}
+
+func TestOutbox_getDueItems(t *testing.T) {
+	now := time.Now()
+	o := newOutbox("")
+	require.NoError(t, o.add(&OutboxItem{From: "due", Created: now, NextAttempt: now.Add(-time.Minute)}))
+	require.NoError(t, o.add(&OutboxItem{From: "later", Created: now, NextAttempt: now.Add(time.Minute)}))
+
+	items := o.getDueItems(now, false)
+	require.Len(t, items, 1)
+	assert.Equal(t, "due", items[0].From)
+
+	assert.Len(t, o.getDueItems(now, true), 2)
+
+	require.NoError(t, o.add(&OutboxItem{From: "scheduled", Created: now, NextAttempt: now.Add(time.Hour), SendAfter: now.Add(time.Hour)}))
+	assert.Len(t, o.getDueItems(now, true), 2)
+	assert.Len(t, o.getDueItems(now.Add(time.Hour), false), 3)
+}
+
+func TestGetOutboxRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, getOutboxRetryDelay(1))
+	assert.Equal(t, 2*time.Minute, getOutboxRetryDelay(2))
+	assert.Equal(t, 32*time.Minute, getOutboxRetryDelay(6))
+	assert.Equal(t, time.Hour, getOutboxRetryDelay(7))
+	assert.Equal(t, time.Hour, getOutboxRetryDelay(1000))
+}
+
+func TestIsTemporarySendError(t *testing.T) {
+	assert.False(t, isTemporarySendError(nil))
+	assert.False(t, isTemporarySendError(errors.New("other")))
+	assert.False(t, isTemporarySendError(newRecipientError("a@pm.me", statusBadMailbox, &pmapi.Error{Code: keysMissingAddressCode})))
+	assert.True(t, isTemporarySendError(pmapi.ErrAPINotReachable))
+	assert.True(t, isTemporarySendError(pkgErrors.Wrap(pmapi.ErrAPINotReachable, "wrapped")))
+	assert.True(t, isTemporarySendError(newRecipientError("a@pm.me", statusNoAnswer, pmapi.ErrAPINotReachable)))
+	assert.True(t, isTemporarySendError(&pmapi.Error{Status: http.StatusServiceUnavailable}))
+	assert.False(t, isTemporarySendError(&pmapi.Error{Status: http.StatusRequestEntityTooLarge}))
+}
+
+// testImportStore records imported messages, i.e. failure notifications.
+type testImportStore struct {
+	testBridgeUser
+	imported int
+}
+
+func (s *testImportStore) ImportMessage(string, []byte, []string) (string, error) {
+	s.imported++
+	return "importedID", nil
+}
+
+func newTestOutboxUser(t *testing.T, to ...string) (*smtpUser, *testImportStore) {
+	key, err := pmcrypto.GetGopenPGP().GenerateKey("user", testAddress, "passphrase", "x25519", 256)
+	require.NoError(t, err)
+	kr, err := pmcrypto.ReadArmoredKeyRing(strings.NewReader(key))
+	require.NoError(t, err)
+	require.NoError(t, kr.UnlockWithPassphrase("passphrase"))
+
+	client := bridgemocks.NewMockPMAPIProvider(gomock.NewController(t))
+	client.EXPECT().Addresses().Return(pmapi.AddressList{
+		{ID: "addressID", Email: testAddress, Keys: pmapi.PMKeys{KeyRing: kr}},
+	}).AnyTimes()
+
+	storeUser := &testImportStore{}
+	sb := &smtpBackend{outbox: newOutbox(""), sendJournal: newSendJournal(""), eventListener: listener.New()}
+	su := newSMTPUser(&testPanicHandler{}, sb.eventListener, sb, nil)
+	su.username = testAddress
+	su.client = client
+	su.storeUser = storeUser
+	su.from = testAddress
+	su.to = to
+	su.dsn = newDSNRequest(nil)
+	return su, storeUser
+}
+
+func TestHandlePartialSend(t *testing.T) {
+	su, storeUser := newTestOutboxUser(t, "alice@pm.test", "bob@pm.test", "carol@pm.test")
+	partialErr := newPartialSendError([]*recipientError{
+		newRecipientError("bob@pm.test", statusNoAnswer, pmapi.ErrAPINotReachable),
+		newRecipientError("carol@pm.test", statusBadMailbox, errors.New("no such address")),
+	})
+
+	require.NoError(t, su.handlePartialSend([]byte("Subject: hello\r\n\r\nhello\r\n"), "messageID", partialErr))
+
+	items := su.backend.GetOutboxItems()
+	require.Len(t, items, 1)
+	assert.Equal(t, []string{"bob@pm.test"}, items[0].To)
+	assert.Equal(t, 1, items[0].Attempts)
+	assert.Equal(t, 1, storeUser.imported)
+	assert.Len(t, su.backend.GetJournalEntries(JournalResultPartial, 0), 1)
+}
+
+func TestHandlePartialSendWithoutNotification(t *testing.T) {
+	su, storeUser := newTestOutboxUser(t, "alice@pm.test", "carol@pm.test")
+	for _, to := range su.to {
+		su.dsn.addRecipient(to, &goSMTPBackend.RcptOptions{Notify: []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifyNever}})
+	}
+	partialErr := newPartialSendError([]*recipientError{
+		newRecipientError("carol@pm.test", statusBadMailbox, errors.New("no such address")),
+	})
+
+	require.NoError(t, su.handlePartialSend([]byte("Subject: hello\r\n\r\nhello\r\n"), "messageID", partialErr))
+
+	assert.Empty(t, su.backend.GetOutboxItems())
+	assert.Equal(t, 0, storeUser.imported)
+	assert.Len(t, su.backend.GetJournalEntries(JournalResultPartial, 0), 1)
+}
+
+func TestHandlePartiallySentOutboxItem(t *testing.T) {
+	su, storeUser := newTestOutboxUser(t, "alice@pm.test", "bob@pm.test", "carol@pm.test")
+	require.NoError(t, su.queueMessage([]byte("Subject: hello\r\n\r\nhello\r\n"), su.to, time.Time{}, pmapi.ErrAPINotReachable))
+	item := su.backend.outbox.getItems(true)[0]
+	partialErr := newPartialSendError([]*recipientError{
+		newRecipientError("bob@pm.test", statusNoAnswer, pmapi.ErrAPINotReachable),
+		newRecipientError("carol@pm.test", statusBadMailbox, errors.New("no such address")),
+	})
+
+	su.backend.handlePartiallySentOutboxItem(su, item, "messageID", 0, partialErr)
+
+	items := su.backend.GetOutboxItems()
+	require.Len(t, items, 1)
+	assert.Equal(t, []string{"bob@pm.test"}, items[0].To)
+	assert.Equal(t, 2, items[0].Attempts)
+	assert.Equal(t, 1, storeUser.imported)
+
+	// Expired item is bounced to all remaining recipients.
+	item = su.backend.outbox.getItems(true)[0]
+	item.Created = time.Now().Add(-outboxExpiration)
+	su.backend.handlePartiallySentOutboxItem(su, item, "messageID", 0, newPartialSendError(partialErr.failed[:1]))
+
+	assert.Empty(t, su.backend.GetOutboxItems())
+	assert.Equal(t, 2, storeUser.imported)
+}
+
+func TestQueueMessageRateLimited(t *testing.T) {
+	su, _ := newTestOutboxUser(t, "alice@pm.test")
+	original := []byte("Subject: hello\r\n\r\nhello\r\n")
+
+	// Only messages which were sent already took the rate limit token.
+	require.NoError(t, su.queueMessage(original, su.to, time.Time{}, pmapi.ErrAPINotReachable))
+	require.NoError(t, su.queueMessage(original, su.to, time.Time{}, errRateLimited))
+	require.NoError(t, su.queueMessage(original, su.to, time.Now().Add(time.Hour), nil))
+
+	rateLimited := map[string]bool{}
+	for _, item := range su.backend.GetOutboxItems() {
+		rateLimited[item.LastError] = item.RateLimited
+	}
+	assert.Equal(t, map[string]bool{
+		pmapi.ErrAPINotReachable.Error(): true,
+		errRateLimited.Error():           false,
+		"":                               false,
+	}, rateLimited)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// plainTextDetector finds out whether the message contains any text/plain
+// body part, i.e. whether it is not HTML-only.
+type plainTextDetector struct {
+	hasPlainText bool
+}
+
+func (d *plainTextDetector) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSibling bool, isFirst, isLast bool) error {
+	if !isFirst || !pmmime.IsLeaf(header) {
+		return nil
+	}
+	disp, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if disp != "attachment" && (mediaType == "text/plain" || header.Get("Content-Type") == "") {
+		d.hasPlainText = true
+	}
+	return nil
+}
+
+// isHTMLOnly returns whether the client submitted the message without any
+// plain text alternative of its HTML body.
+func isHTMLOnly(composeMode string, rawMessage []byte) bool {
+	if composeMode != pmapi.ContentTypeHTML {
+		return false
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(rawMessage))
+	if err != nil {
+		return false
+	}
+	detector := &plainTextDetector{}
+	if err := pmmime.VisitAll(m.Body, textproto.MIMEHeader(m.Header), pmmime.NewMimeVisitor(detector)); err != nil {
+		return false
+	}
+	return !detector.hasPlainText
+}
+
+// addPlainTextAlternative switches external recipients of HTML body to MIME
+// package. The MIME body built by the parser contains text/plain alternative
+// generated from the HTML, which is otherwise lost for them.
+func addPlainTextAlternative(sendingInfo SendingInfo) SendingInfo {
+	if sendingInfo.Scheme == pmapi.ClearPackage && sendingInfo.MIMEType == pmapi.ContentTypeHTML {
+		sendingInfo.Scheme = pmapi.ClearMIMEPackage
+	}
+	return sendingInfo
+}
+
+func (sb *smtpBackend) isPlainTextAlternativeEnabled() bool {
+	return sb.preferences.GetBool(preferences.PlainTextAlternativeKey)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHTMLOnly(t *testing.T) {
+	testCases := map[string]bool{
+		"Content-Type: text/html\r\n\r\n<b>hello</b>\r\n": true,
+		"Content-Type: text/plain\r\n\r\nhello\r\n":       false,
+		"Subject: no content type\r\n\r\nhello\r\n":       false,
+		"Content-Type: multipart/alternative; boundary=XX\r\n\r\n" +
+			"--XX\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+			"--XX\r\nContent-Type: text/html\r\n\r\n<b>hello</b>\r\n" +
+			"--XX--\r\n": false,
+		"Content-Type: multipart/mixed; boundary=XX\r\n\r\n" +
+			"--XX\r\nContent-Type: text/html\r\n\r\n<b>hello</b>\r\n" +
+			"--XX\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=notes.txt\r\n\r\nnotes\r\n" +
+			"--XX--\r\n": true,
+	}
+	for rawMessage, want := range testCases {
+		assert.Equal(t, want, isHTMLOnly(pmapi.ContentTypeHTML, []byte(rawMessage)), rawMessage)
+	}
+
+	assert.False(t, isHTMLOnly(pmapi.ContentTypePlainText, []byte("Content-Type: text/html\r\n\r\n<b>hello</b>\r\n")))
+}
+
+func TestAddPlainTextAlternative(t *testing.T) {
+	testCases := []struct {
+		in       SendingInfo
+		wantType int
+	}{
+		{SendingInfo{Scheme: pmapi.ClearPackage, MIMEType: pmapi.ContentTypeHTML}, pmapi.ClearMIMEPackage},
+		{SendingInfo{Scheme: pmapi.ClearPackage, MIMEType: pmapi.ContentTypePlainText}, pmapi.ClearPackage},
+		{SendingInfo{Scheme: pmapi.InternalPackage, MIMEType: pmapi.ContentTypeHTML}, pmapi.InternalPackage},
+		{SendingInfo{Scheme: pmapi.PGPMIMEPackage, MIMEType: pmapi.ContentTypeHTML}, pmapi.PGPMIMEPackage},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.wantType, addPlainTextAlternative(tc.in).Scheme, tc.in)
+	}
+}
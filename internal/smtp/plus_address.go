@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// getSenderAddress returns the sender address with the plus-addressing tag,
+// e.g. `user+tag@pm.me`, which is sent for `addressEmail` as the base address.
+// The tag of the envelope address is used, however the From header tagged
+// address of the same base address is preserved, so clients can set the tag
+// in the header only.
+func getSenderAddress(envelopeFrom, headerFrom, addressEmail string) string {
+	tag := getPlusTag(envelopeFrom)
+	if headerTag := getPlusTag(headerFrom); headerTag != "" && strings.EqualFold(pmapi.SanitizeEmail(headerFrom), addressEmail) {
+		tag = headerTag
+	}
+	if tag == "" {
+		return addressEmail
+	}
+
+	at := strings.LastIndex(addressEmail, "@")
+	if at < 0 {
+		return addressEmail
+	}
+	return addressEmail[:at] + "+" + tag + addressEmail[at:]
+}
+
+// getPlusTag returns everything after the first plus in the local part.
+func getPlusTag(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	plus := strings.Index(email[:at], "+")
+	if plus < 0 {
+		return ""
+	}
+	return email[plus+1 : at]
+}
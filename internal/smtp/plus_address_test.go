@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSenderAddress(t *testing.T) {
+	tests := []struct {
+		envelopeFrom, headerFrom, want string
+	}{
+		{"user@pm.me", "user@pm.me", "user@pm.me"},
+		{"user@pm.me", "", "user@pm.me"},
+		{"user+tag@pm.me", "user@pm.me", "user+tag@pm.me"},
+		{"user@pm.me", "user+tag@pm.me", "user+tag@pm.me"},
+		{"User@PM.me", "USER+Tag@pm.me", "user+Tag@pm.me"},
+		{"user+envelope@pm.me", "user+header@pm.me", "user+header@pm.me"},
+		{"user@pm.me", "user+tag+more@pm.me", "user+tag+more@pm.me"},
+		// Tag of another address is not used for the sending address.
+		{"user@pm.me", "other+tag@pm.me", "user@pm.me"},
+		{"user+tag@pm.me", "other+header@pm.me", "user+tag@pm.me"},
+		{"invalid", "invalid+tag", "user@pm.me"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, getSenderAddress(tc.envelopeFrom, tc.headerFrom, "user@pm.me"), "%s, %s", tc.envelopeFrom, tc.headerFrom)
+	}
+}
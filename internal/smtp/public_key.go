@@ -0,0 +1,40 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+)
+
+// attachPublicKeyHeader overrides for a single message whether the sender's
+// public key is attached. The value is yes or no.
+const attachPublicKeyHeader = "X-Pm-Attach-Public-Key"
+
+// shouldAttachPublicKey returns whether the sender's public key should be
+// attached to the message. The per-send `header` is preferred; otherwise the
+// key is attached if either the account or the bridge is set to do so.
+func shouldAttachPublicKey(accountSetting, bridgeSetting bool, header string) bool {
+	if override, ok := parseYesNo(header); ok {
+		return override
+	}
+	return accountSetting || bridgeSetting
+}
+
+func (sb *smtpBackend) isAttachPublicKeyEnabled() bool {
+	return sb.preferences.GetBool(preferences.AttachPublicKeyKey)
+}
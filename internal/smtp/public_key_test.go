@@ -0,0 +1,42 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldAttachPublicKey(t *testing.T) {
+	testCases := []struct {
+		accountSetting, bridgeSetting bool
+		header                        string
+		want                          bool
+	}{
+		{false, false, "", false},
+		{true, false, "", true},
+		{false, true, "", true},
+		{true, true, "no", false},
+		{false, false, "Yes", true},
+		{false, false, "maybe", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, shouldAttachPublicKey(tc.accountSetting, tc.bridgeSetting, tc.header), "%+v", tc)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+)
+
+// errRateLimited is the reason of queueing messages over the rate limit.
+// Such messages are sent by the outbox once the limit allows it.
+var errRateLimited = errors.New("rate limit of sent messages exceeded") //nolint[gochecknoglobals]
+
+// rateLimiter limits number of messages sent by each user per minute using
+// token bucket. The bucket holds at most one minute worth of tokens, so
+// a burst of that many messages is sent immediately.
+type rateLimiter struct {
+	lock    *sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		lock:    &sync.Mutex{},
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// take returns zero if message of the user can be sent at `now` with rate
+// `perMinute` and the token is taken. Otherwise it returns how long to wait
+// for the next token. Non-positive rate means no limit.
+func (rl *rateLimiter) take(username string, perMinute int, now time.Time) time.Duration {
+	if perMinute <= 0 {
+		return 0
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	capacity := float64(perMinute)
+	bucket, ok := rl.buckets[username]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		rl.buckets[username] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens += capacity * elapsed.Minutes()
+		bucket.last = now
+	}
+	if bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / capacity * float64(time.Minute))
+}
+
+// getRateLimit returns maximum number of messages sent by one user per minute.
+func (sb *smtpBackend) getRateLimit() int {
+	return sb.preferences.GetInt(preferences.SMTPRateLimitKey)
+}
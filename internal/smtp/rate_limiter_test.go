@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	rl := newRateLimiter()
+
+	assert.Zero(t, rl.take("user", 0, now), "no limit")
+
+	for i := 0; i < 2; i++ {
+		assert.Zero(t, rl.take("user", 2, now), "burst %d", i)
+	}
+	assert.Equal(t, 30*time.Second, rl.take("user", 2, now))
+	assert.Zero(t, rl.take("other", 2, now), "other user has own bucket")
+
+	assert.Equal(t, 20*time.Second, rl.take("user", 2, now.Add(10*time.Second)))
+	assert.Zero(t, rl.take("user", 2, now.Add(30*time.Second)))
+
+	// Bucket never holds more than one minute worth of tokens.
+	later := now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		assert.Zero(t, rl.take("user", 2, later), "burst %d", i)
+	}
+	assert.NotZero(t, rl.take("user", 2, later))
+}
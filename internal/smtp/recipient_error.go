@@ -0,0 +1,242 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+)
+
+// API error codes returned when getting public keys of a recipient.
+const (
+	keysInvalidAddressCode = 33101
+	keysMissingAddressCode = 33102
+)
+
+var (
+	// See RFC 3463 for the meaning of enhanced status codes.
+	statusOther              = goSMTPBackend.EnhancedCode{5, 0, 0}
+	statusBadMailbox         = goSMTPBackend.EnhancedCode{5, 1, 1}
+	statusBadMailboxSyntax   = goSMTPBackend.EnhancedCode{5, 1, 3}
+	statusMessageTooBig      = goSMTPBackend.EnhancedCode{5, 2, 3}
+	statusSystemTemporary    = goSMTPBackend.EnhancedCode{4, 3, 0}
+	statusSystemNotAccepting = goSMTPBackend.EnhancedCode{4, 3, 2}
+	statusNoAnswer           = goSMTPBackend.EnhancedCode{4, 4, 1}
+	statusBadConnection      = goSMTPBackend.EnhancedCode{4, 4, 2}
+	statusInvalidMessage     = goSMTPBackend.EnhancedCode{5, 6, 0}
+	statusNotAuthorized      = goSMTPBackend.EnhancedCode{5, 7, 1}
+	statusCryptographicIssue = goSMTPBackend.EnhancedCode{5, 7, 5}
+)
+
+// recipientError is an error which prevented sending the message to one recipient.
+type recipientError struct {
+	address string
+	status  goSMTPBackend.EnhancedCode
+	err     error
+}
+
+func newRecipientError(address string, status goSMTPBackend.EnhancedCode, err error) *recipientError {
+	return &recipientError{
+		address: address,
+		status:  status,
+		err:     err,
+	}
+}
+
+// getAPIErrorStatus returns enhanced status code matching the API error.
+// The API error code takes precedence over the HTTP status of the response.
+func getAPIErrorStatus(err error) goSMTPBackend.EnhancedCode {
+	cause := errors.Cause(err)
+	if cause == pmapi.ErrAPINotReachable {
+		return statusNoAnswer
+	}
+	apiErr, ok := cause.(*pmapi.Error)
+	if !ok {
+		return statusOther
+	}
+
+	switch apiErr.Code {
+	case keysInvalidAddressCode:
+		return statusBadMailboxSyntax
+	case keysMissingAddressCode:
+		return statusBadMailbox
+	case pmapi.ImportMessageTooLong:
+		return statusMessageTooBig
+	case pmapi.BansRequests:
+		return statusNotAuthorized
+	}
+
+	switch {
+	case apiErr.Status == http.StatusRequestEntityTooLarge:
+		return statusMessageTooBig
+	case apiErr.Status == http.StatusForbidden:
+		return statusNotAuthorized
+	case apiErr.Status == http.StatusServiceUnavailable:
+		return statusSystemNotAccepting
+	case apiErr.Status == http.StatusBadGateway, apiErr.Status == http.StatusGatewayTimeout:
+		return statusBadConnection
+	case apiErr.Status >= http.StatusInternalServerError:
+		return statusSystemTemporary
+	}
+	return statusOther
+}
+
+// getReplyCode returns basic SMTP reply code to the whole message matching the status.
+func getReplyCode(status goSMTPBackend.EnhancedCode) int {
+	switch {
+	case status == statusMessageTooBig:
+		return 552
+	case status[0] == 4:
+		return 451
+	}
+	return 554
+}
+
+func (err *recipientError) Error() string {
+	return err.err.Error()
+}
+
+func (err *recipientError) Cause() error {
+	return err.err
+}
+
+func (err *recipientError) isPermanent() bool {
+	return err.status[0] == 5
+}
+
+// replyCode returns basic SMTP reply code matching the status.
+func (err *recipientError) replyCode() int {
+	if err.isPermanent() {
+		return 550
+	}
+	return 451
+}
+
+// partialSendError is returned when the message was sent only to some
+// recipients; `failed` are those which did not get it.
+type partialSendError struct {
+	failed []*recipientError
+}
+
+func newPartialSendError(failed []*recipientError) *partialSendError {
+	return &partialSendError{failed: failed}
+}
+
+func (err *partialSendError) Error() string {
+	msgs := make([]string, 0, len(err.failed))
+	for _, rcptErr := range err.failed {
+		msgs = append(msgs, rcptErr.address+": "+rcptErr.Error())
+	}
+	return "message not sent to all recipients: " + strings.Join(msgs, "; ")
+}
+
+// Cause returns cause of the first failed recipient so temporary errors are
+// recognised the same way as when sending to one recipient only.
+func (err *partialSendError) Cause() error {
+	return err.failed[0]
+}
+
+func (err *partialSendError) isPermanent() bool {
+	for _, rcptErr := range err.failed {
+		if !rcptErr.isPermanent() {
+			return false
+		}
+	}
+	return true
+}
+
+// split returns failed recipients which can succeed later and those which
+// failed permanently.
+func (err *partialSendError) split() (temporary, permanent []*recipientError) {
+	for _, rcptErr := range err.failed {
+		if rcptErr.isPermanent() {
+			permanent = append(permanent, rcptErr)
+		} else {
+			temporary = append(temporary, rcptErr)
+		}
+	}
+	return
+}
+
+// getRecipientError returns error of recipient `address` or nil if the
+// message was sent to the recipient.
+func (err *partialSendError) getRecipientError(address string) *recipientError {
+	for _, rcptErr := range err.failed {
+		if strings.EqualFold(rcptErr.address, address) {
+			return rcptErr
+		}
+	}
+	return nil
+}
+
+func getRecipientAddresses(rcptErrs []*recipientError) []string {
+	addresses := make([]string, 0, len(rcptErrs))
+	for _, rcptErr := range rcptErrs {
+		addresses = append(addresses, rcptErr.address)
+	}
+	return addresses
+}
+
+// toSMTPError converts recipient and API errors to SMTP errors with proper
+// status codes. Other errors are returned unchanged.
+func toSMTPError(err error) error {
+	if rcptErr, ok := err.(*recipientError); ok {
+		return &goSMTPBackend.SMTPError{
+			Code:         rcptErr.replyCode(),
+			EnhancedCode: rcptErr.status,
+			Message:      rcptErr.Error(),
+		}
+	}
+	if partialErr, ok := err.(*partialSendError); ok {
+		rcptErr := partialErr.failed[0]
+		return &goSMTPBackend.SMTPError{
+			Code:         rcptErr.replyCode(),
+			EnhancedCode: rcptErr.status,
+			Message:      partialErr.Error(),
+		}
+	}
+	if status := getAPIErrorStatus(err); status != statusOther {
+		return &goSMTPBackend.SMTPError{
+			Code:         getReplyCode(status),
+			EnhancedCode: status,
+			Message:      err.Error(),
+		}
+	}
+	return err
+}
+
+// checkRecipient returns recipient error when the API reports the address
+// cannot receive messages, e.g. it does not exist. Such recipients are
+// rejected already by RCPT so the message can be sent to the valid ones.
+// Other errors are only logged; they are reported again when sending.
+func checkRecipient(client bridge.PMAPIProvider, address string) error {
+	if _, _, err := client.GetPublicKeysForEmail(address); err != nil {
+		err = errors.Wrap(err, "backend: cannot get recipients' public keys")
+		status := getAPIErrorStatus(err)
+		if status == statusBadMailbox || status == statusBadMailboxSyntax {
+			return newRecipientError(address, status, err)
+		}
+		log.WithError(err).WithField("address", address).Warn("Cannot check recipient")
+	}
+	return nil
+}
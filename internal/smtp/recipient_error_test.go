@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	bridgemocks "github.com/ProtonMail/proton-bridge/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/golang/mock/gomock"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRecipient(t *testing.T) {
+	testCases := []struct {
+		apiErr       error
+		wantRejected bool
+		wantStatus   goSMTPBackend.EnhancedCode
+	}{
+		{nil, false, goSMTPBackend.EnhancedCode{}},
+		{&pmapi.Error{Code: keysMissingAddressCode}, true, statusBadMailbox},
+		{&pmapi.Error{Code: keysInvalidAddressCode}, true, statusBadMailboxSyntax},
+		{&pmapi.Error{Code: 2001}, false, goSMTPBackend.EnhancedCode{}},
+		{pmapi.ErrAPINotReachable, false, goSMTPBackend.EnhancedCode{}},
+		{errors.New("other"), false, goSMTPBackend.EnhancedCode{}},
+	}
+	for _, tc := range testCases {
+		ctrl := gomock.NewController(t)
+		client := bridgemocks.NewMockPMAPIProvider(ctrl)
+		client.EXPECT().GetPublicKeysForEmail("bob@pm.test").Return(nil, false, tc.apiErr)
+
+		err := checkRecipient(client, "bob@pm.test")
+		ctrl.Finish()
+
+		if !tc.wantRejected {
+			assert.NoError(t, err, "API error: %v", tc.apiErr)
+			continue
+		}
+		smtpErr, ok := toSMTPError(err).(*goSMTPBackend.SMTPError)
+		require.True(t, ok, "API error: %v", tc.apiErr)
+		assert.Equal(t, 550, smtpErr.Code)
+		assert.Equal(t, tc.wantStatus, smtpErr.EnhancedCode)
+	}
+}
+
+func TestPartialSendError(t *testing.T) {
+	err := newPartialSendError([]*recipientError{
+		newRecipientError("bob@pm.test", statusBadMailbox, errors.New("no such address")),
+		newRecipientError("alice@pm.test", statusNoAnswer, pmapi.ErrAPINotReachable),
+	})
+
+	assert.NotNil(t, err.getRecipientError("BOB@pm.test"))
+	assert.Nil(t, err.getRecipientError("carol@pm.test"))
+	assert.False(t, err.isPermanent())
+
+	smtpErr, ok := toSMTPError(err).(*goSMTPBackend.SMTPError)
+	require.True(t, ok)
+	assert.Equal(t, 550, smtpErr.Code)
+	assert.Equal(t, statusBadMailbox, smtpErr.EnhancedCode)
+	assert.Equal(t, "message not sent to all recipients: bob@pm.test: no such address; alice@pm.test: cannot reach the server", smtpErr.Message)
+}
+
+func TestToSMTPError(t *testing.T) {
+	testCases := []struct {
+		err        error
+		wantCode   int
+		wantStatus goSMTPBackend.EnhancedCode
+	}{
+		{newRecipientError("bob@pm.test", statusBadMailbox, errors.New("no such address")), 550, statusBadMailbox},
+		{newRecipientError("bob@pm.test", statusNoAnswer, pmapi.ErrAPINotReachable), 451, statusNoAnswer},
+		{&pmapi.Error{Status: http.StatusRequestEntityTooLarge, ErrorMessage: "too big"}, 552, statusMessageTooBig},
+		{&pmapi.Error{Status: http.StatusForbidden, ErrorMessage: "not allowed"}, 554, statusNotAuthorized},
+		{pkgErrors.Wrap(&pmapi.Error{Status: http.StatusServiceUnavailable}, "wrapped"), 451, statusSystemNotAccepting},
+	}
+	for _, tc := range testCases {
+		smtpErr, ok := toSMTPError(tc.err).(*goSMTPBackend.SMTPError)
+		require.True(t, ok, "error: %v", tc.err)
+		assert.Equal(t, tc.wantCode, smtpErr.Code, "error: %v", tc.err)
+		assert.Equal(t, tc.wantStatus, smtpErr.EnhancedCode, "error: %v", tc.err)
+		assert.Equal(t, tc.err.Error(), smtpErr.Message)
+	}
+
+	otherErr := errors.New("other")
+	assert.Equal(t, otherErr, toSMTPError(otherErr))
+}
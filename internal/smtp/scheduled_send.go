@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	goSMTPBackend "github.com/emersion/go-smtp"
+)
+
+// scheduledSendHeader is set by clients which want the message to be sent later.
+// The value is either a date in RFC 5322 format or a Unix timestamp.
+const scheduledSendHeader = "X-Pm-Scheduled-Send"
+
+var errInvalidScheduledSend = &goSMTPBackend.SMTPError{ //nolint[gochecknoglobals]
+	Code:         554,
+	EnhancedCode: goSMTPBackend.EnhancedCode{5, 6, 0},
+	Message:      "invalid " + scheduledSendHeader + " header",
+}
+
+// getScheduledSendTime returns the time the message should be sent at,
+// or zero time if the message is not scheduled.
+func getScheduledSendTime(msg []byte) (time.Time, error) {
+	value := strings.TrimSpace(readHeader(msg).Get(scheduledSendHeader))
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+	if date, err := mail.ParseDate(value); err == nil {
+		return date, nil
+	}
+	return time.Time{}, errInvalidScheduledSend
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetScheduledSendTime(t *testing.T) {
+	testCases := []struct {
+		msg      string
+		wantTime time.Time
+		wantErr  error
+	}{
+		{"Subject: Hello\r\n\r\nBody\r\n", time.Time{}, nil},
+		{"Subject: Hello\r\nX-Pm-Scheduled-Send: 1600000000\r\n\r\nBody\r\n", time.Unix(1600000000, 0), nil},
+		{"x-pm-scheduled-send: Sun, 13 Sep 2020 12:26:40 +0000\nSubject: Hello\n\nBody\n", time.Unix(1600000000, 0), nil},
+		{"Subject: Hello\r\nX-Pm-Scheduled-Send: tomorrow\r\n\r\nBody\r\n", time.Time{}, errInvalidScheduledSend},
+		{"Broken header\r\n\r\nBody\r\n", time.Time{}, nil},
+		{"Subject: No body", time.Time{}, nil},
+	}
+	for _, tc := range testCases {
+		got, err := getScheduledSendTime([]byte(tc.msg))
+		require.Equal(t, tc.wantErr, err, tc.msg)
+		assert.True(t, tc.wantTime.Equal(got), "%s: got %v", tc.msg, got)
+	}
+}
+
+func TestOutboxItem_isExpired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, (&OutboxItem{Created: now}).isExpired(now))
+	assert.True(t, (&OutboxItem{Created: now.Add(-outboxExpiration)}).isExpired(now))
+	assert.False(t, (&OutboxItem{Created: now.Add(-outboxExpiration), SendAfter: now.Add(-time.Hour)}).isExpired(now))
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sendJournalMaxEntries is how many of the latest entries are kept.
+	sendJournalMaxEntries = 1000
+	// sendJournalCompactBatch is how many entries over the maximum are
+	// appended before the file is rewritten with the latest ones only.
+	sendJournalCompactBatch = 100
+)
+
+// Results of the message submission recorded in the journal.
+const (
+	JournalResultSent   = "sent"
+	JournalResultQueued = "queued"
+	// JournalResultCancelled means the queued message was cancelled by the user.
+	JournalResultCancelled = "cancelled"
+	// JournalResultRejected means the error was returned to the client.
+	JournalResultRejected = "rejected"
+	// JournalResultFailed means the message was accepted, but then it could
+	// not be sent and a failure notification was imported instead.
+	JournalResultFailed = "failed"
+	// JournalResultPartial means the message was sent only to some
+	// recipients; the others are queued or got a failure notification.
+	JournalResultPartial = "partial"
+)
+
+// JournalEntry records what bridge did with one message submitted over SMTP.
+type JournalEntry struct {
+	Time     time.Time
+	Username string
+	From     string
+	To       []string
+	Size     int
+
+	// MessageID is the API ID of the sent message.
+	MessageID string `json:",omitempty"`
+	Result    string
+	Error     string `json:",omitempty"`
+}
+
+// matches returns whether any field of the entry contains lowercase `query`.
+func (entry *JournalEntry) matches(query string) bool {
+	fields := append([]string{entry.Username, entry.From, entry.MessageID, entry.Result, entry.Error}, entry.To...)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendJournal keeps the latest entries in memory and appends them, one JSON
+// per line, to file `path`.
+type sendJournal struct {
+	lock    *sync.Mutex
+	entries []*JournalEntry
+	path    string
+}
+
+// newSendJournal returns journal persisted in file `path`.
+// If `path` is empty, the journal is kept in memory only.
+func newSendJournal(path string) *sendJournal {
+	j := &sendJournal{
+		lock: &sync.Mutex{},
+		path: path,
+	}
+
+	if err := j.load(); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("Could not load send journal")
+	}
+
+	return j
+}
+
+func (j *sendJournal) load() error {
+	if j.path == "" {
+		return nil
+	}
+
+	f, err := os.Open(j.path) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			log.WithError(err).Warn("Skipping invalid send journal entry")
+			continue
+		}
+		j.entries = append(j.entries, entry)
+	}
+	if len(j.entries) > sendJournalMaxEntries {
+		j.entries = j.entries[len(j.entries)-sendJournalMaxEntries:]
+	}
+	return scanner.Err()
+}
+
+// add records the entry. Writing to the file is only logged when it fails
+// because the journal must never affect sending itself.
+func (j *sendJournal) add(entry *JournalEntry) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.entries = append(j.entries, entry)
+
+	var err error
+	if len(j.entries) > sendJournalMaxEntries+sendJournalCompactBatch {
+		j.entries = j.entries[len(j.entries)-sendJournalMaxEntries:]
+		err = j.rewrite()
+	} else {
+		err = j.append(entry)
+	}
+	if err != nil {
+		log.WithError(err).Warn("Could not save send journal")
+	}
+}
+
+func (j *sendJournal) append(entry *JournalEntry) error {
+	if j.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (j *sendJournal) rewrite() error {
+	if j.path == "" {
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(j.path), filepath.Base(j.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) //nolint[errcheck]
+
+	enc := json.NewEncoder(f)
+	for _, entry := range j.entries {
+		if err := enc.Encode(entry); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, j.path)
+}
+
+// search returns at most `limit` latest entries containing `query`
+// (case-insensitive) in any field, newest first. Empty query matches all.
+// Zero limit means no limit.
+func (j *sendJournal) search(query string, limit int) (entries []*JournalEntry) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	query = strings.ToLower(query)
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		if query == "" || j.entries[i].matches(query) {
+			entries = append(entries, j.entries[i])
+		}
+	}
+	return entries
+}
+
+// addJournalEntry records result of the current message of the session.
+func (su *smtpUser) addJournalEntry(size int, messageID, result string, err error) {
+	su.backend.sendJournal.add(newJournalEntry(su.username, su.from, su.to, size, messageID, result, err))
+}
+
+func newJournalEntry(username, from string, to []string, size int, messageID, result string, err error) *JournalEntry {
+	entry := &JournalEntry{
+		Time:      time.Now(),
+		Username:  username,
+		From:      from,
+		To:        append([]string{}, to...),
+		Size:      size,
+		MessageID: messageID,
+		Result:    result,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// GetJournalEntries returns at most `limit` latest submitted messages
+// matching `query`, newest first.
+func (sb *smtpBackend) GetJournalEntries(query string, limit int) []*JournalEntry {
+	return sb.sendJournal.search(query, limit)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendJournal_search(t *testing.T) {
+	dir, err := ioutil.TempDir("", "send_journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "send_journal.json")
+
+	j := newSendJournal(path)
+	assert.Empty(t, j.search("", 0))
+
+	j.add(newJournalEntry("user", "from@pm.me", []string{"a@pm.me", "b@pm.me"}, 42, "msgID", JournalResultSent, nil))
+	j.add(newJournalEntry("user", "from@pm.me", []string{"c@pm.me"}, 10, "", JournalResultRejected, errors.New("no such user")))
+
+	entries := j.search("", 0)
+	require.Len(t, entries, 2)
+	assert.Equal(t, JournalResultRejected, entries[0].Result, "newest first")
+	assert.Equal(t, "no such user", entries[0].Error)
+	assert.Equal(t, "msgID", entries[1].MessageID)
+	assert.Equal(t, 42, entries[1].Size)
+
+	assert.Len(t, j.search("B@PM.ME", 0), 1)
+	assert.Len(t, j.search("such", 0), 1)
+	assert.Len(t, j.search("from@", 1), 1)
+	assert.Empty(t, j.search("nothing", 0))
+
+	// Entries are loaded after restart.
+	j = newSendJournal(path)
+	entries = j.search("", 0)
+	require.Len(t, entries, 2)
+	assert.Equal(t, []string{"a@pm.me", "b@pm.me"}, entries[1].To)
+}
+
+func TestSendJournal_keepsLatestEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "send_journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "send_journal.json")
+
+	j := newSendJournal(path)
+	count := sendJournalMaxEntries + sendJournalCompactBatch + 1
+	for i := 0; i < count; i++ {
+		j.add(newJournalEntry("user", "from@pm.me", nil, i, strconv.Itoa(i), JournalResultSent, nil))
+	}
+
+	entries := j.search("", 0)
+	require.Len(t, entries, sendJournalMaxEntries)
+	assert.Equal(t, strconv.Itoa(count-1), entries[0].MessageID)
+
+	j = newSendJournal(path)
+	entries = j.search("", 0)
+	require.Len(t, entries, sendJournalMaxEntries)
+	assert.Equal(t, strconv.Itoa(count-sendJournalMaxEntries), entries[len(entries)-1].MessageID)
+}
+
+func TestSendJournal_inMemory(t *testing.T) {
+	j := newSendJournal("")
+	j.add(newJournalEntry("user", "from@pm.me", nil, 1, "", JournalResultQueued, nil))
+	assert.Len(t, j.search("queued", 0), 1)
+}
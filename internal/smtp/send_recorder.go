@@ -19,13 +19,34 @@ package smtp
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
+const (
+	// It's hard to find a good expiration time.
+	// On the one hand, a user could set up some cron job sending the same message over and over again (heartbeat).
+	// On the the other, a user could put the device into sleep mode while sending.
+	// Changing the expiration time will always make one of the edge cases worse.
+	// But both edge cases are something we don't care much about. Important thing is we don't send the same message many times.
+	// Users who care can change it in preferences, see getDuplicateSendTimeouts.
+	defaultSendRecorderExpiration = 30 * time.Minute
+
+	// If message is in draft for a long time, let's assume there is
+	// some problem and message will not be sent anymore.
+	defaultSendRecorderDraftTimeout = 10 * time.Minute
+)
+
 type messageGetter interface {
 	GetMessage(string) (*pmapi.Message, error)
 }
@@ -33,53 +54,155 @@ type messageGetter interface {
 type sendRecorderValue struct {
 	messageID string
 	time      time.Time
+	// sentRecipients are set only if the message was not sent to all recipients.
+	sentRecipients []string
+}
+
+// sendRecorderFileValue is the on-disk representation of sendRecorderValue.
+type sendRecorderFileValue struct {
+	MessageID      string
+	Time           time.Time
+	SentRecipients []string `json:",omitempty"`
 }
 
 type sendRecorder struct {
-	lock   *sync.RWMutex
-	hashes map[string]sendRecorderValue
+	lock     *sync.RWMutex
+	hashes   map[string]sendRecorderValue
+	revision int
+
+	expiration   time.Duration
+	draftTimeout time.Duration
+
+	// saveLock serialises writes to the file at `path` so that sending
+	// does not wait for file I/O while holding `lock`.
+	saveLock      *sync.Mutex
+	savedRevision int
+	path          string
 }
 
-func newSendRecorder() *sendRecorder {
-	return &sendRecorder{
-		lock:   &sync.RWMutex{},
-		hashes: map[string]sendRecorderValue{},
+// newSendRecorder returns a send recorder persisted to the file at `path`.
+// Previously recorded hashes are loaded so duplicate detection survives restarts.
+// If `path` is empty, the recorder is kept in memory only.
+func newSendRecorder(path string) *sendRecorder {
+	q := &sendRecorder{
+		lock:         &sync.RWMutex{},
+		hashes:       map[string]sendRecorderValue{},
+		expiration:   defaultSendRecorderExpiration,
+		draftTimeout: defaultSendRecorderDraftTimeout,
+		saveLock:     &sync.Mutex{},
+		path:         path,
+	}
+
+	if err := q.load(); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warn("Could not load send recorder")
 	}
+
+	return q
 }
 
+// setTimeouts changes how long hashes are kept and how long a draft of sent
+// message is considered to be still sending.
+func (q *sendRecorder) setTimeouts(expiration, draftTimeout time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.expiration = expiration
+	q.draftTimeout = draftTimeout
+}
+
+// getMessageHash identifies the message by its Message-ID set by the client
+// if present, so retries are caught even when the client regenerated e.g.
+// the body, and different messages with the same content are not mixed up.
+// The same Message-ID can be sent to other recipients separately, therefore
+// recipients are always part of the hash.
 func (q *sendRecorder) getMessageHash(message *pmapi.Message) string {
 	h := sha256.New()
+	if message.ExternalID != "" {
+		_, _ = h.Write([]byte(message.AddressID + "<" + message.ExternalID + ">"))
+		writeRecipients(h, message)
+		return fmt.Sprintf("%x", h.Sum(nil))
+	}
+
 	_, _ = h.Write([]byte(message.AddressID + message.Subject))
+	writeRecipients(h, message)
+	_, _ = h.Write([]byte(message.Body))
+	for _, att := range message.Attachments {
+		_, _ = h.Write([]byte(att.Name + att.MIMEType + fmt.Sprintf("%d", att.Size)))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func writeRecipients(w io.Writer, message *pmapi.Message) {
 	if message.Sender != nil {
-		_, _ = h.Write([]byte(message.Sender.Address))
+		_, _ = w.Write([]byte(message.Sender.Address))
 	}
 	for _, to := range message.ToList {
-		_, _ = h.Write([]byte(to.Address))
+		_, _ = w.Write([]byte(to.Address))
 	}
 	for _, to := range message.CCList {
-		_, _ = h.Write([]byte(to.Address))
+		_, _ = w.Write([]byte(to.Address))
 	}
 	for _, to := range message.BCCList {
-		_, _ = h.Write([]byte(to.Address))
-	}
-	_, _ = h.Write([]byte(message.Body))
-	for _, att := range message.Attachments {
-		_, _ = h.Write([]byte(att.Name + att.MIMEType + fmt.Sprintf("%d", att.Size)))
+		_, _ = w.Write([]byte(to.Address))
 	}
-	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
 func (q *sendRecorder) addMessage(hash, messageID string) {
 	q.lock.Lock()
-	defer q.lock.Unlock()
-
 	q.deleteExpiredKeys()
 	q.hashes[hash] = sendRecorderValue{
 		messageID: messageID,
 		time:      time.Now(),
+		// Retry sent to the remaining recipients keeps those sent before.
+		sentRecipients: q.hashes[hash].sentRecipients,
+	}
+	q.revision++
+	revision, values := q.revision, q.getFileValues()
+	q.lock.Unlock()
+
+	if err := q.save(revision, values); err != nil {
+		log.WithError(err).Warn("Could not save send recorder")
 	}
 }
 
+// setSentRecipients records that the message was sent only to `recipients`,
+// so a retry of the message is sent to the remaining ones. Nil means the
+// message was sent to all recipients.
+func (q *sendRecorder) setSentRecipients(hash string, recipients []string) {
+	q.lock.Lock()
+	value, ok := q.hashes[hash]
+	if !ok {
+		q.lock.Unlock()
+		return
+	}
+	value.sentRecipients = recipients
+	q.hashes[hash] = value
+	q.revision++
+	revision, values := q.revision, q.getFileValues()
+	q.lock.Unlock()
+
+	if err := q.save(revision, values); err != nil {
+		log.WithError(err).Warn("Could not save send recorder")
+	}
+}
+
+// getSentRecipients returns recipients the message was sent to if it was
+// not sent to all of them, otherwise nil.
+func (q *sendRecorder) getSentRecipients(hash string) []string {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	return q.hashes[hash].sentRecipients
+}
+
+// getMessageID returns ID of the message recorded under `hash`.
+func (q *sendRecorder) getMessageID(hash string) string {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	return q.hashes[hash].messageID
+}
+
 func (q *sendRecorder) isSendingOrSent(client messageGetter, hash string) (isSending bool, wasSent bool) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
@@ -96,9 +219,7 @@ func (q *sendRecorder) isSendingOrSent(client messageGetter, hash string) (isSen
 		return
 	}
 	if message.Type == pmapi.MessageTypeDraft {
-		// If message is in draft for a long time, let's assume there is
-		// some problem and message will not be sent anymore.
-		if time.Since(time.Unix(message.Time, 0)).Minutes() > 10 {
+		if time.Since(time.Unix(message.Time, 0)) > q.draftTimeout {
 			return
 		}
 		isSending = true
@@ -112,13 +233,117 @@ func (q *sendRecorder) isSendingOrSent(client messageGetter, hash string) (isSen
 
 func (q *sendRecorder) deleteExpiredKeys() {
 	for key, value := range q.hashes {
-		// It's hard to find a good expiration time.
-		// On the one hand, a user could set up some cron job sending the same message over and over again (heartbeat).
-		// On the the other, a user could put the device into sleep mode while sending.
-		// Changing the expiration time will always make one of the edge cases worse.
-		// But both edge cases are something we don't care much about. Important thing is we don't send the same message many times.
-		if time.Since(value.time) > 30*time.Minute {
+		if time.Since(value.time) > q.expiration {
 			delete(q.hashes, key)
 		}
 	}
 }
+
+func (q *sendRecorder) load() error {
+	if q.path == "" {
+		return nil
+	}
+
+	f, err := os.Open(q.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	values := map[string]sendRecorderFileValue{}
+	if err := json.NewDecoder(f).Decode(&values); err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		q.hashes[key] = sendRecorderValue{
+			messageID:      value.MessageID,
+			time:           value.Time,
+			sentRecipients: value.SentRecipients,
+		}
+	}
+	q.deleteExpiredKeys()
+
+	return nil
+}
+
+func (q *sendRecorder) getFileValues() map[string]sendRecorderFileValue {
+	values := map[string]sendRecorderFileValue{}
+	for key, value := range q.hashes {
+		values[key] = sendRecorderFileValue{
+			MessageID:      value.messageID,
+			Time:           value.time,
+			SentRecipients: value.sentRecipients,
+		}
+	}
+	return values
+}
+
+// save writes `values` to a temporary file which then replaces the old file,
+// so a crash during writing never leaves a truncated file behind.
+// Values older than already saved ones (lower `revision`) are skipped.
+func (q *sendRecorder) save(revision int, values map[string]sendRecorderFileValue) error {
+	if q.path == "" {
+		return nil
+	}
+
+	q.saveLock.Lock()
+	defer q.saveLock.Unlock()
+
+	if revision <= q.savedRevision {
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(q.path), filepath.Base(q.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) //nolint[errcheck]
+
+	if err := json.NewEncoder(f).Encode(values); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return err
+	}
+
+	q.savedRevision = revision
+	return nil
+}
+
+func (sb *smtpBackend) isDuplicateSendCheckEnabled() bool {
+	return sb.preferences.GetBool(preferences.DuplicateSendCheckKey)
+}
+
+// getDuplicateSendTimeouts returns timeouts of the send recorder set in
+// preferences in minutes. Defaults are used for invalid values.
+func (sb *smtpBackend) getDuplicateSendTimeouts() (expiration, draftTimeout time.Duration) {
+	expiration = time.Duration(sb.preferences.GetInt(preferences.DuplicateSendExpirationKey)) * time.Minute
+	if expiration <= 0 {
+		expiration = defaultSendRecorderExpiration
+	}
+	draftTimeout = time.Duration(sb.preferences.GetInt(preferences.DuplicateSendDraftTimeoutKey)) * time.Minute
+	if draftTimeout <= 0 {
+		draftTimeout = defaultSendRecorderDraftTimeout
+	}
+	return
+}
+
+// getRemainingRecipients returns recipients from `to` which are not in `sent`.
+func getRemainingRecipients(to, sent []string) (remaining []string) {
+	isSent := make(map[string]bool, len(sent))
+	for _, email := range sent {
+		isSent[strings.ToLower(email)] = true
+	}
+	for _, email := range to {
+		if !isSent[strings.ToLower(email)] {
+			remaining = append(remaining, email)
+		}
+	}
+	return remaining
+}
@@ -20,12 +20,16 @@ package smtp
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/mail"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testSendRecorderGetMessageMock struct {
@@ -38,7 +42,7 @@ func (m *testSendRecorderGetMessageMock) GetMessage(messageID string) (*pmapi.Me
 }
 
 func TestSendRecorder_getMessageHash(t *testing.T) {
-	q := newSendRecorder()
+	q := newSendRecorder("")
 
 	message := &pmapi.Message{
 		AddressID: "address123",
@@ -363,8 +367,29 @@ func TestSendRecorder_getMessageHash(t *testing.T) {
 	}
 }
 
+func TestSendRecorder_getMessageHashWithMessageID(t *testing.T) {
+	q := newSendRecorder("")
+
+	newMessage := func(externalID, to, body string) *pmapi.Message {
+		return &pmapi.Message{
+			AddressID:  "address123",
+			ExternalID: externalID,
+			Subject:    "Report",
+			Sender:     &mail.Address{Address: "from@pm.me"},
+			ToList:     []*mail.Address{{Address: to}},
+			Body:       body,
+		}
+	}
+	hash := q.getMessageHash(newMessage("id@pm.me", "to@pm.me", "body"))
+
+	assert.Equal(t, hash, q.getMessageHash(newMessage("id@pm.me", "to@pm.me", "regenerated body")), "retry of the same Message-ID")
+	assert.NotEqual(t, hash, q.getMessageHash(newMessage("other@pm.me", "to@pm.me", "body")), "different Message-ID with the same content")
+	assert.NotEqual(t, hash, q.getMessageHash(newMessage("id@pm.me", "other@pm.me", "body")), "the same Message-ID to other recipient")
+	assert.NotEqual(t, hash, q.getMessageHash(newMessage("", "to@pm.me", "body")), "no Message-ID")
+}
+
 func TestSendRecorder_isSendingOrSent(t *testing.T) {
-	q := newSendRecorder()
+	q := newSendRecorder("")
 	q.addMessage("hash", "messageID")
 
 	testCases := []struct {
@@ -394,7 +419,7 @@ func TestSendRecorder_isSendingOrSent(t *testing.T) {
 }
 
 func TestSendRecorder_deleteExpiredKeys(t *testing.T) {
-	q := newSendRecorder()
+	q := newSendRecorder("")
 
 	q.hashes["hash1"] = sendRecorderValue{
 		messageID: "msg1",
@@ -412,3 +437,128 @@ func TestSendRecorder_deleteExpiredKeys(t *testing.T) {
 	_, ok = q.hashes["hash2"]
 	assert.False(t, ok)
 }
+
+func TestSendRecorder_setTimeouts(t *testing.T) {
+	q := newSendRecorder("")
+	q.setTimeouts(time.Minute, time.Minute)
+
+	q.hashes["hash"] = sendRecorderValue{
+		messageID: "msg",
+		time:      time.Now().Add(-30 * time.Second),
+	}
+	messageGetter := &testSendRecorderGetMessageMock{
+		message: &pmapi.Message{Type: pmapi.MessageTypeDraft, Time: time.Now().Add(-2 * time.Minute).Unix()},
+	}
+	isSending, _ := q.isSendingOrSent(messageGetter, "hash")
+	assert.False(t, isSending, "draft is older than draft timeout")
+
+	q.hashes["hash"] = sendRecorderValue{
+		messageID: "msg",
+		time:      time.Now().Add(-2 * time.Minute),
+	}
+	q.deleteExpiredKeys()
+	assert.Empty(t, q.hashes)
+}
+
+func TestSendRecorder_persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "send_recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "send_recorder.json")
+
+	q := newSendRecorder(path)
+	q.addMessage("hash", "messageID")
+
+	// Simulate restart by loading the recorder from the same file.
+	q = newSendRecorder(path)
+
+	value, ok := q.hashes["hash"]
+	require.True(t, ok)
+	assert.Equal(t, "messageID", value.messageID)
+	assert.WithinDuration(t, time.Now(), value.time, time.Minute)
+}
+
+func TestSendRecorder_persistenceExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "send_recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "send_recorder.json")
+
+	q := newSendRecorder(path)
+	q.hashes["hash1"] = sendRecorderValue{
+		messageID: "msg1",
+		time:      time.Now().Add(-31 * time.Minute),
+	}
+	q.addMessage("hash2", "msg2")
+
+	q = newSendRecorder(path)
+
+	_, ok := q.hashes["hash1"]
+	assert.False(t, ok)
+	_, ok = q.hashes["hash2"]
+	assert.True(t, ok)
+}
+
+func TestSendRecorder_saveSkipsOlderRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "send_recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "send_recorder.json")
+
+	q := newSendRecorder(path)
+	newer := map[string]sendRecorderFileValue{"hash2": {MessageID: "msg2", Time: time.Now()}}
+	older := map[string]sendRecorderFileValue{"hash1": {MessageID: "msg1", Time: time.Now()}}
+	require.NoError(t, q.save(2, newer))
+	require.NoError(t, q.save(1, older))
+
+	q = newSendRecorder(path)
+
+	_, ok := q.hashes["hash1"]
+	assert.False(t, ok)
+	_, ok = q.hashes["hash2"]
+	assert.True(t, ok)
+
+	// Only the final file is left, no temporary ones.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "send_recorder.json", files[0].Name())
+}
+
+func TestSendRecorder_sentRecipients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "send_recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "send_recorder.json")
+
+	q := newSendRecorder(path)
+	q.setSentRecipients("hash", []string{"a@pm.me"})
+	assert.Nil(t, q.getSentRecipients("hash"), "unknown hash")
+
+	q.addMessage("hash", "msg1")
+	assert.Nil(t, q.getSentRecipients("hash"))
+	q.setSentRecipients("hash", []string{"a@pm.me"})
+	assert.Equal(t, []string{"a@pm.me"}, q.getSentRecipients("hash"))
+
+	// Retry keeps recipients until it is sent.
+	q.addMessage("hash", "msg2")
+	assert.Equal(t, []string{"a@pm.me"}, q.getSentRecipients("hash"))
+
+	q = newSendRecorder(path)
+	assert.Equal(t, "msg2", q.hashes["hash"].messageID)
+	assert.Equal(t, []string{"a@pm.me"}, q.getSentRecipients("hash"))
+
+	q.setSentRecipients("hash", nil)
+	assert.Nil(t, q.getSentRecipients("hash"))
+}
+
+func TestGetRemainingRecipients(t *testing.T) {
+	to := []string{"a@pm.me", "B@pm.me", "c@pm.me"}
+	assert.Equal(t, to, getRemainingRecipients(to, nil))
+	assert.Equal(t, []string{"c@pm.me"}, getRemainingRecipients(to, []string{"A@pm.me", "b@pm.me"}))
+	assert.Nil(t, getRemainingRecipients(to, to))
+}
@@ -19,29 +19,84 @@ package smtp
 
 import (
 	"crypto/tls"
-	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/crammd5"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/proxyproto"
 	"github.com/emersion/go-sasl"
 	goSMTP "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 type smtpServer struct {
-	server        *goSMTP.Server
+	newServer     func(maxMessageBytes int64) *goSMTP.Server
+	addr          string
+	tls           *tls.Config
+	backend       *smtpBackend
 	eventListener listener.Listener
 	useSSL        bool
+	proxyProtocol bool
+
+	// go-smtp reads MaxMessageBytes in connection goroutines without any
+	// lock, so the limit cannot be changed on the running server. Instead,
+	// new connections are passed to a new server with the new limit while
+	// the previous ones keep the limit they were told in EHLO.
+	lock            sync.Mutex
+	listener        net.Listener
+	servers         []*goSMTP.Server
+	conns           *serverListener
+	maxMessageBytes int64
+	closed          bool
 }
 
 // NewSMTPServer returns an SMTP server configured with the given options.
-func NewSMTPServer(debug bool, port int, useSSL bool, tls *tls.Config, smtpBackend goSMTP.Backend, eventListener listener.Listener) *smtpServer { //nolint[golint]
+// The server listens on the host, use bridge.Host to accept only local connections.
+// With proxyProtocol the connections have to start with PROXY protocol header.
+// With requireTLS the login is disabled until the connection is encrypted.
+func NewSMTPServer(debug bool, host string, port int, useSSL, proxyProtocol, requireTLS bool, tls *tls.Config, smtpBackend *smtpBackend, eventListener listener.Listener) *smtpServer { //nolint[golint]
+	return &smtpServer{
+		newServer: func(maxMessageBytes int64) *goSMTP.Server {
+			return newGoSMTPServer(debug, requireTLS, tls, smtpBackend, maxMessageBytes)
+		},
+		addr:          net.JoinHostPort(host, strconv.Itoa(port)),
+		tls:           tls,
+		backend:       smtpBackend,
+		eventListener: eventListener,
+		useSSL:        useSSL,
+		proxyProtocol: proxyProtocol,
+	}
+}
+
+func newGoSMTPServer(debug, requireTLS bool, tls *tls.Config, smtpBackend *smtpBackend, maxMessageBytes int64) *goSMTP.Server {
 	s := goSMTP.NewServer(smtpBackend)
-	s.Addr = fmt.Sprintf("%v:%v", bridge.Host, port)
 	s.TLSConfig = tls
 	s.Domain = bridge.Host
-	s.AllowInsecureAuth = true
+	// Without TLS go-smtp does not advertise AUTH and refuses it.
+	s.AllowInsecureAuth = !requireTLS
+	s.EnableDSN = true
+	// PIPELINING is always advertised by go-smtp. Commands are read from
+	// the buffered connection one by one, so the session handles pipelined
+	// commands the same way as commands sent after each response.
+	// 8BITMIME is always advertised and the message is read as bytes.
+	// With SMTPUTF8 the addresses and headers are UTF-8 encoded (RFC 6531
+	// and RFC 6532) and passed to the API without any conversion.
+	s.EnableSMTPUTF8 = true
+	// CHUNKING (BDAT) is always advertised by go-smtp and chunks are streamed
+	// to the same Data call as with DATA. BINARYMIME is not enabled because
+	// the message parser expects text bodies only.
+	s.EnableBINARYMIME = false
+	// SIZE is advertised before authentication, so the limit of any connected
+	// user is used. The limit of the authenticated user is resolved after AUTH
+	// and checked in session. The advertised one is refreshed by
+	// monitorMaxMessageBytes; zero advertises SIZE without limit.
+	s.MaxMessageBytes = maxMessageBytes
 
 	if debug {
 		s.Debug = logrus.
@@ -51,48 +106,148 @@ func NewSMTPServer(debug bool, port int, useSSL bool, tls *tls.Config, smtpBacke
 
 	s.EnableAuth(sasl.Login, func(conn *goSMTP.Conn) sasl.Server {
 		return sasl.NewLoginServer(func(address, password string) error {
-			user, err := conn.Server().Backend.Login(address, password)
-			if err != nil {
-				return err
-			}
+			return conn.Session().AuthPlain(address, password)
+		})
+	})
 
-			conn.SetUser(user)
+	// There is no OAuth provider, the bearer token is the bridge password.
+	s.EnableAuth(sasl.OAuthBearer, func(conn *goSMTP.Conn) sasl.Server {
+		return sasl.NewOAuthBearerServer(func(opts sasl.OAuthBearerOptions) *sasl.OAuthBearerError {
+			if err := conn.Session().AuthPlain(opts.Username, opts.Token); err != nil {
+				return &sasl.OAuthBearerError{Status: "invalid_token", Schemes: "bearer"}
+			}
 			return nil
 		})
 	})
 
-	return &smtpServer{
-		server:        s,
-		eventListener: eventListener,
-		useSSL:        useSSL,
-	}
+	s.EnableAuth(crammd5.Mechanism, func(conn *goSMTP.Conn) sasl.Server {
+		return crammd5.NewServer(bridge.Host, func(address, challenge, digest string) error {
+			return conn.Session().(*smtpUser).AuthCRAMMD5(address, challenge, digest)
+		})
+	})
+
+	return s
 }
 
 // Starts the server.
 func (s *smtpServer) ListenAndServe() {
-	go s.monitorDisconnectedUsers()
-	l := log.WithField("useSSL", s.useSSL).WithField("address", s.server.Addr)
+	l := log.WithField("useSSL", s.useSSL).WithField("address", s.addr)
 
-	l.Info("SMTP server is starting")
-	var err error
-	if s.useSSL {
-		err = s.server.ListenAndServeTLS()
-	} else {
-		err = s.server.ListenAndServe()
+	l.WithField("proxyProtocol", s.proxyProtocol).Info("SMTP server is starting")
+	err := s.listen()
+	if err == nil {
+		go s.monitorDisconnectedUsers()
+		go s.monitorMaxMessageBytes()
+		err = s.serve()
 	}
 	if err != nil {
 		s.eventListener.Emit(events.ErrorEvent, "SMTP failed: "+err.Error())
 		l.Error("SMTP failed: ", err)
 		return
 	}
-	defer s.server.Close()
+	defer s.Close()
 
 	l.Info("SMTP server stopped")
 }
 
+// listen opens the listener. With proxy protocol, PROXY header is read
+// before TLS handshake because the proxy passes TLS through.
+func (s *smtpServer) listen() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if s.proxyProtocol {
+		l = proxyproto.NewListener(l)
+	}
+	if s.useSSL {
+		l = tls.NewListener(l, s.tls)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.listener = l
+	s.startServer(s.backend.getMaxMessageBytes())
+	return nil
+}
+
+// serve passes accepted connections to the current server until closed.
+func (s *smtpServer) serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() { //nolint[staticcheck]
+				log.WithError(err).Warn("SMTP accept error")
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.handOver(conn)
+	}
+}
+
+func (s *smtpServer) handOver(conn net.Conn) {
+	for {
+		s.lock.Lock()
+		conns := s.conns
+		s.lock.Unlock()
+
+		select {
+		case conns.ch <- conn:
+			return
+		case <-conns.closed:
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				_ = conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// startServer starts a new go-smtp server for new connections.
+// It has to be called with the lock held.
+func (s *smtpServer) startServer(maxMessageBytes int64) {
+	if s.conns != nil {
+		_ = s.conns.Close()
+	}
+
+	server := s.newServer(maxMessageBytes)
+	conns := newServerListener(s.listener.Addr())
+	go func() {
+		if err := server.Serve(conns); err != nil && err != errServerListenerClosed {
+			log.WithError(err).Error("SMTP server failed")
+		}
+	}()
+
+	s.servers = append(s.servers, server)
+	s.conns = conns
+	s.maxMessageBytes = maxMessageBytes
+}
+
 // Stops the server.
 func (s *smtpServer) Close() {
-	s.server.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed || s.listener == nil {
+		return
+	}
+	s.closed = true
+	_ = s.listener.Close()
+	for _, server := range s.servers {
+		_ = server.Close()
+	}
 }
 
 func (s *smtpServer) monitorDisconnectedUsers() {
@@ -101,12 +256,71 @@ func (s *smtpServer) monitorDisconnectedUsers() {
 
 	for address := range ch {
 		log.Info("Disconnecting all open SMTP connections for ", address)
-		disconnectUser := func(conn *goSMTP.Conn) {
-			connUser := conn.User()
-			if connUser != nil {
-				_ = conn.Close()
-			}
-		}
-		s.server.ForEachConn(disconnectUser)
+		s.backend.closeAuthenticatedSessions()
+	}
+}
+
+// monitorMaxMessageBytes updates the advertised SIZE when a user logs in or
+// the API is reachable again. The limit is not known when the server starts
+// without any connected user or without internet.
+func (s *smtpServer) monitorMaxMessageBytes() {
+	ch := make(chan string)
+	s.eventListener.Add(events.UserRefreshEvent, ch)
+	s.eventListener.Add(events.InternetOnEvent, ch)
+
+	for range ch {
+		s.updateMaxMessageBytes()
 	}
 }
+
+// updateMaxMessageBytes sets the limit go-smtp advertises in EHLO responses
+// of new connections and checks in MAIL and DATA.
+func (s *smtpServer) updateMaxMessageBytes() {
+	maxMessageBytes := s.backend.getMaxMessageBytes()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed || maxMessageBytes == s.maxMessageBytes {
+		return
+	}
+	log.WithField("size", maxMessageBytes).Info("Updating SMTP message size limit")
+	s.startServer(maxMessageBytes)
+}
+
+var errServerListenerClosed = errors.New("server listener closed") //nolint[gochecknoglobals]
+
+// serverListener is the listener of one go-smtp server which gets
+// connections accepted by smtpServer.
+type serverListener struct {
+	addr      net.Addr
+	ch        chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newServerListener(addr net.Addr) *serverListener {
+	return &serverListener{
+		addr:   addr,
+		ch:     make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *serverListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.ch:
+		return conn, nil
+	case <-l.closed:
+		return nil, errServerListenerClosed
+	}
+}
+
+func (l *serverListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *serverListener) Addr() net.Addr {
+	return l.addr
+}
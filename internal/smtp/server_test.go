@@ -0,0 +1,240 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAddress  = "user@pm.me"
+	testPassword = "bridgepassword"
+)
+
+type testPanicHandler struct{}
+
+func (ph *testPanicHandler) HandlePanic() {}
+
+type testConfig struct{ dir string }
+
+func (c *testConfig) GetSendRecorderPath() string { return "" }
+func (c *testConfig) GetOutboxPath() string       { return "" }
+func (c *testConfig) GetSendJournalPath() string  { return "" }
+func (c *testConfig) GetTLSCertPath() string      { return filepath.Join(c.dir, "cert.pem") }
+func (c *testConfig) GetTLSKeyPath() string       { return filepath.Join(c.dir, "key.pem") }
+
+type testBridge struct {
+	users []bridgeUser
+}
+
+func (b *testBridge) GetUser(query string) (bridgeUser, error) {
+	for _, user := range b.users {
+		if _, err := user.GetAddressID(query); err == nil {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (b *testBridge) GetUsers() []bridgeUser {
+	return b.users
+}
+
+type testBridgeUser struct {
+	maxUpload uint
+}
+
+func (u *testBridgeUser) CheckBridgeLogin(password string) error {
+	if password != testPassword {
+		return errors.New("wrong password")
+	}
+	return nil
+}
+
+func (u *testBridgeUser) CheckBridgeLoginCRAMMD5(challenge, digest string) error {
+	return errors.New("not supported")
+}
+
+func (u *testBridgeUser) IsCombinedAddressMode() bool { return true }
+
+func (u *testBridgeUser) GetAddressID(address string) (string, error) {
+	if address != testAddress {
+		return "", errors.New("address not found")
+	}
+	return "addressID", nil
+}
+
+func (u *testBridgeUser) GetTemporaryPMAPIClient() bridge.PMAPIProvider { return nil }
+
+func (u *testBridgeUser) GetStore() storeUserProvider { return u }
+
+func (u *testBridgeUser) CreateDraft(*pmcrypto.KeyRing, *pmapi.Message, []io.Reader, string, string, string) (*pmapi.Message, []*pmapi.Attachment, error) {
+	return nil, nil, errors.New("not supported")
+}
+
+func (u *testBridgeUser) SendMessage(string, *pmapi.SendMessageReq) error {
+	return errors.New("not supported")
+}
+
+func (u *testBridgeUser) ImportMessage(string, []byte, []string) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (u *testBridgeUser) GetMaxUpload() (uint, error) { return u.maxUpload, nil }
+
+// startTestServer starts SMTP server on a free local port and returns it
+// together with its event listener and address.
+func startTestServer(t *testing.T, b bridger, useSSL, requireTLS bool) (*smtpServer, listener.Listener, string) {
+	dir, err := ioutil.TempDir("", "smtp-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	cfg := &testConfig{dir: dir}
+	tlsConfig, err := config.GetTLSConfig(cfg)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	eventListener := listener.New()
+	backend := newSMTPBackend(&testPanicHandler{}, eventListener, cfg, nil, b)
+	s := NewSMTPServer(false, "127.0.0.1", port, useSSL, false, requireTLS, tlsConfig, backend, eventListener)
+	go s.ListenAndServe()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return s, eventListener, addr
+}
+
+func TestMaxMessageBytesUpdatedAfterLogin(t *testing.T) {
+	b := &testBridge{}
+	s, eventListener, addr := startTestServer(t, b, false, false)
+	defer s.Close()
+
+	c, err := smtp.Dial(addr)
+	require.NoError(t, err)
+	ok, size := c.Extension("SIZE")
+	assert.True(t, ok)
+	assert.Equal(t, "", size)
+	require.NoError(t, c.Quit())
+
+	b.users = []bridgeUser{&testBridgeUser{maxUpload: 3 * 1024 * 1024}}
+	eventListener.Emit(events.UserRefreshEvent, "userID")
+
+	wantSize := store.MessageSizeLimit(3 * 1024 * 1024)
+	require.Eventually(t, func() bool {
+		c, err := smtp.Dial(addr)
+		if err != nil {
+			return false
+		}
+		defer c.Close() //nolint[errcheck]
+		_, size := c.Extension("SIZE")
+		return size == strconv.FormatInt(wantSize, 10)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSMTPSHandshake(t *testing.T) {
+	s, _, addr := startTestServer(t, &testBridge{users: []bridgeUser{&testBridgeUser{}}}, true, false)
+	defer s.Close()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}) //nolint[gosec]
+	require.NoError(t, err)
+	c, err := smtp.NewClient(conn, "127.0.0.1")
+	require.NoError(t, err)
+	defer c.Close() //nolint[errcheck]
+
+	require.NoError(t, c.Hello("localhost"))
+	ok, mechanisms := c.Extension("AUTH")
+	assert.True(t, ok)
+	assert.Contains(t, mechanisms, "PLAIN")
+	ok, _ = c.Extension("STARTTLS")
+	assert.False(t, ok)
+
+	require.NoError(t, c.Auth(smtp.PlainAuth("", testAddress, testPassword, "127.0.0.1")))
+}
+
+func TestRequireTLS(t *testing.T) {
+	s, _, addr := startTestServer(t, &testBridge{users: []bridgeUser{&testBridgeUser{}}}, false, true)
+	defer s.Close()
+
+	c, err := smtp.Dial(addr)
+	require.NoError(t, err)
+	defer c.Close() //nolint[errcheck]
+
+	require.NoError(t, c.Hello("localhost"))
+	ok, _ := c.Extension("AUTH")
+	assert.False(t, ok)
+
+	// Client refuses to authenticate without advertised AUTH, so the command is sent directly.
+	credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + testAddress + "\x00" + testPassword))
+	id, err := c.Text.Cmd("AUTH PLAIN %s", credentials)
+	require.NoError(t, err)
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(235)
+	c.Text.EndResponse(id)
+	require.Error(t, err)
+
+	require.NoError(t, c.StartTLS(&tls.Config{InsecureSkipVerify: true})) //nolint[gosec]
+	ok, _ = c.Extension("AUTH")
+	assert.True(t, ok)
+	require.NoError(t, c.Auth(smtp.PlainAuth("", testAddress, testPassword, "127.0.0.1")))
+}
+
+func TestAllowInsecureAuth(t *testing.T) {
+	s, _, addr := startTestServer(t, &testBridge{users: []bridgeUser{&testBridgeUser{}}}, false, false)
+	defer s.Close()
+
+	c, err := smtp.Dial(addr)
+	require.NoError(t, err)
+	defer c.Close() //nolint[errcheck]
+
+	require.NoError(t, c.Hello("localhost"))
+	ok, _ := c.Extension("AUTH")
+	assert.True(t, ok)
+	require.NoError(t, c.Auth(smtp.PlainAuth("", testAddress, testPassword, "127.0.0.1")))
+}
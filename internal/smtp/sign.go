@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"strings"
+)
+
+// signHeader overrides for a single message whether messages to external
+// recipients which are not encrypted are signed. The value is yes, no, or
+// the scheme of the signature: pgp-mime (or mime) and pgp-inline (or inline).
+const signHeader = "X-Pm-Sign"
+
+// parseSignHeader returns whether to sign and the requested scheme, or empty
+// scheme if the default one should be used. ok is false for invalid values.
+func parseSignHeader(value string) (sign bool, scheme string, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case pgpMime, "mime":
+		return true, pgpMime, true
+	case pgpInline, "inline":
+		return true, pgpInline, true
+	}
+	sign, ok = parseYesNo(value)
+	return sign, "", ok
+}
+
+// applySignOverride changes signing of the message for the recipient
+// according to the `header`. Encrypted messages are always signed, so only
+// recipients receiving the message in clear text are affected.
+func applySignOverride(
+	sendingInfo SendingInfo,
+	contactMeta *ContactMetadata,
+	header string,
+	composeMode string,
+	settingsPgpScheme int,
+) (SendingInfo, error) {
+	sign, scheme, ok := parseSignHeader(header)
+	if !ok || sendingInfo.Encrypt {
+		return sendingInfo, nil
+	}
+
+	meta := &ContactMetadata{}
+	if contactMeta != nil {
+		*meta = *contactMeta
+	}
+	if scheme != "" {
+		meta.Scheme = scheme
+	}
+
+	var err error
+	sendingInfo.Sign = sign
+	sendingInfo.Scheme, sendingInfo.MIMEType, err = schemeAndMIME(meta, settingsPgpScheme, composeMode, false, sign)
+	return sendingInfo, err
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignHeader(t *testing.T) {
+	testCases := []struct {
+		header     string
+		wantSign   bool
+		wantScheme string
+		wantOK     bool
+	}{
+		{"", false, "", false},
+		{"yes", true, "", true},
+		{"No", false, "", true},
+		{"mime", true, pgpMime, true},
+		{"PGP-Inline", true, pgpInline, true},
+		{"maybe", false, "", false},
+	}
+	for _, tc := range testCases {
+		sign, scheme, ok := parseSignHeader(tc.header)
+		assert.Equal(t, tc.wantSign, sign, "%+v", tc)
+		assert.Equal(t, tc.wantScheme, scheme, "%+v", tc)
+		assert.Equal(t, tc.wantOK, ok, "%+v", tc)
+	}
+}
+
+func TestApplySignOverride(t *testing.T) {
+	clear := SendingInfo{Scheme: pmapi.ClearPackage, MIMEType: pmapi.ContentTypeHTML}
+	encrypted := SendingInfo{Encrypt: true, Sign: true, Scheme: pmapi.PGPMIMEPackage, MIMEType: pmapi.ContentTypeMultipartMixed}
+
+	testCases := []struct {
+		sendingInfo SendingInfo
+		contactMeta *ContactMetadata
+		header      string
+		want        SendingInfo
+	}{
+		{clear, nil, "", clear},
+		{encrypted, nil, "no", encrypted},
+		{clear, nil, "yes", SendingInfo{Sign: true, Scheme: pmapi.ClearMIMEPackage, MIMEType: pmapi.ContentTypeMultipartMixed}},
+		{clear, nil, "inline", SendingInfo{Sign: true, Scheme: pmapi.ClearPackage, MIMEType: pmapi.ContentTypePlainText}},
+		{clear, &ContactMetadata{Scheme: pgpInline}, "mime", SendingInfo{Sign: true, Scheme: pmapi.ClearMIMEPackage, MIMEType: pmapi.ContentTypeMultipartMixed}},
+		{SendingInfo{Sign: true, Scheme: pmapi.ClearMIMEPackage, MIMEType: pmapi.ContentTypeMultipartMixed}, nil, "no", clear},
+	}
+	for _, tc := range testCases {
+		sendingInfo, err := applySignOverride(tc.sendingInfo, tc.contactMeta, tc.header, pmapi.ContentTypeHTML, pmapi.PGPMIMEPackage)
+		assert.NoError(t, err, "%+v", tc)
+		assert.Equal(t, tc.want, sendingInfo, "%+v", tc)
+	}
+}
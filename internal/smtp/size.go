@@ -0,0 +1,138 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	goSMTPBackend "github.com/emersion/go-smtp"
+)
+
+var errMessageTooLarge = &goSMTPBackend.SMTPError{ //nolint[gochecknoglobals]
+	Code:         552,
+	EnhancedCode: goSMTPBackend.EnhancedCode{5, 3, 4},
+	Message:      "message size exceeds fixed maximum message size",
+}
+
+// newAttachmentsTooLargeError returns 552 error telling the user the limit
+// of attachments `maxUpload` in megabytes (at least one).
+func newAttachmentsTooLargeError(maxUpload uint) *goSMTPBackend.SMTPError {
+	megabytes := (maxUpload + 1024*1024 - 1) / (1024 * 1024)
+	return &goSMTPBackend.SMTPError{
+		Code:         552,
+		EnhancedCode: goSMTPBackend.EnhancedCode{5, 3, 4},
+		Message:      fmt.Sprintf("attachments exceed maximum size of %d MB per message", megabytes),
+	}
+}
+
+// checkAttachmentsSize rejects the message whose decoded attachments are
+// bigger than the API upload limit `maxUpload` before anything is uploaded.
+// Zero limit or message which cannot be parsed are left to the API.
+func checkAttachmentsSize(rawMessage []byte, maxUpload uint) error {
+	if maxUpload == 0 {
+		return nil
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(rawMessage))
+	if err != nil {
+		return nil
+	}
+	size, err := getAttachmentsSize(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		log.WithError(err).Debug("Cannot compute size of attachments")
+		return nil
+	}
+	if size > int64(maxUpload) {
+		return newAttachmentsTooLargeError(maxUpload)
+	}
+	return nil
+}
+
+// getAttachmentsSize returns the decoded size of all parts which are
+// uploaded as attachments, i.e. all parts except the text bodies.
+func getAttachmentsSize(header textproto.MIMEHeader, body io.Reader) (int64, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var size int64
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return size, nil
+			}
+			if err != nil {
+				return 0, err
+			}
+			partSize, err := getAttachmentsSize(part.Header, part)
+			if err != nil {
+				return 0, err
+			}
+			size += partSize
+		}
+	}
+
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if strings.HasPrefix(mediaType, "text/") && disposition != "attachment" {
+		return 0, nil
+	}
+
+	var decoded io.Reader = body
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		decoded = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		decoded = quotedprintable.NewReader(body)
+	}
+	return io.Copy(ioutil.Discard, decoded)
+}
+
+// limitedReader reads from `r` until `limit` bytes are read. Reading more
+// than the limit fails with errMessageTooLarge. Zero limit means no limit.
+type limitedReader struct {
+	r        io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func newLimitedReader(r io.Reader, limit int64) *limitedReader {
+	return &limitedReader{r: r, limit: limit}
+}
+
+func (lr *limitedReader) Read(p []byte) (n int, err error) {
+	n, err = lr.r.Read(p)
+	lr.read += int64(n)
+	if lr.limit > 0 && lr.read > lr.limit {
+		lr.exceeded = true
+		return 0, errMessageTooLarge
+	}
+	return n, err
+}
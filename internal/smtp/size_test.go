@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedReader(t *testing.T) {
+	testData := []struct {
+		name      string
+		limit     int64
+		wantError bool
+	}{
+		{"no limit", 0, false},
+		{"under limit", 20, false},
+		{"exact limit", 11, false},
+		{"over limit", 10, true},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := newLimitedReader(strings.NewReader("hello world"), tc.limit)
+			data, err := ioutil.ReadAll(r)
+			if tc.wantError {
+				require.Equal(t, errMessageTooLarge, err)
+				assert.True(t, r.exceeded)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "hello world", string(data))
+				assert.False(t, r.exceeded)
+			}
+		})
+	}
+}
+
+func TestCheckAttachmentsSize(t *testing.T) {
+	message := "From: sender@pm.me\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"xxx\"\r\n" +
+		"\r\n" +
+		"--xxx\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"body text which is not counted\r\n" +
+		"--xxx\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"a.bin\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"MDEyMzQ1\r\n" +
+		"Njc4OQ==\r\n" +
+		"--xxx\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=\"a.txt\"\r\n" +
+		"\r\n" +
+		"hello\r\n" +
+		"--xxx--\r\n"
+
+	size, err := getAttachmentsSize(textproto.MIMEHeader{"Content-Type": {"multipart/mixed; boundary=\"xxx\""}}, strings.NewReader(message[strings.Index(message, "\r\n\r\n")+4:]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), size)
+
+	assert.NoError(t, checkAttachmentsSize([]byte(message), 0))
+	assert.NoError(t, checkAttachmentsSize([]byte(message), 15))
+	assert.Equal(t, newAttachmentsTooLargeError(14), checkAttachmentsSize([]byte(message), 14))
+	assert.NoError(t, checkAttachmentsSize([]byte("not a message"), 14))
+}
+
+func TestNewAttachmentsTooLargeError(t *testing.T) {
+	err := newAttachmentsTooLargeError(25 * 1024 * 1024)
+	assert.Equal(t, 552, err.Code)
+	assert.Equal(t, "attachments exceed maximum size of 25 MB per message", err.Message)
+	assert.Equal(t, "attachments exceed maximum size of 1 MB per message", newAttachmentsTooLargeError(14).Message)
+}
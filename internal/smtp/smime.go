@@ -0,0 +1,46 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// isSMIMESigned returns whether the message is signed by the client using
+// S/MIME (multipart/signed with PKCS #7 signature, see RFC 8551).
+func isSMIMESigned(h mail.Header) bool {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/signed" {
+		return false
+	}
+	protocol := strings.ToLower(params["protocol"])
+	return protocol == "application/pkcs7-signature" || protocol == "application/x-pkcs7-signature"
+}
+
+// keepSMIMESignature makes sure external recipients receive the signed MIME
+// tree as it was submitted. Signing it again with PGP would wrap the tree
+// into another multipart/signed which clients would not verify as S/MIME.
+func keepSMIMESignature(sendingInfo SendingInfo) SendingInfo {
+	sendingInfo = keepMIMEStructure(sendingInfo)
+	if !sendingInfo.Encrypt {
+		sendingInfo.Sign = false
+	}
+	return sendingInfo
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSMIMESigned(t *testing.T) {
+	testCases := map[string]bool{
+		`multipart/signed; protocol="application/pkcs7-signature"; micalg=sha-256; boundary="XX"`: true,
+		`multipart/signed; protocol="application/x-pkcs7-signature"; boundary="XX"`:               true,
+		`multipart/signed; protocol="Application/PKCS7-Signature"`:                                true,
+		`multipart/signed; protocol="application/pgp-signature"; boundary="XX"`:                   false,
+		`multipart/mixed; boundary="XX"`:                                                          false,
+		`not a content type`:                                                                      false,
+	}
+	for contentType, want := range testCases {
+		assert.Equal(t, want, isSMIMESigned(mail.Header{"Content-Type": {contentType}}), contentType)
+	}
+}
+
+func TestKeepSMIMESignature(t *testing.T) {
+	testCases := []struct {
+		in, want SendingInfo
+	}{
+		{
+			in:   SendingInfo{Scheme: pmapi.InternalPackage, Encrypt: true, Sign: true},
+			want: SendingInfo{Scheme: pmapi.InternalPackage, Encrypt: true, Sign: true},
+		},
+		{
+			in:   SendingInfo{Scheme: pmapi.ClearPackage, Sign: true},
+			want: SendingInfo{Scheme: pmapi.ClearMIMEPackage},
+		},
+		{
+			in:   SendingInfo{Scheme: pmapi.ClearMIMEPackage},
+			want: SendingInfo{Scheme: pmapi.ClearMIMEPackage},
+		},
+		{
+			in:   SendingInfo{Scheme: pmapi.PGPInlinePackage, Encrypt: true, Sign: true},
+			want: SendingInfo{Scheme: pmapi.PGPMIMEPackage, Encrypt: true, Sign: true},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, keepSMIMESignature(tc.in))
+	}
+}
@@ -33,4 +33,6 @@ type storeUserProvider interface {
 		attachedPublicKeyName string,
 		parentID string) (*pmapi.Message, []*pmapi.Attachment, error)
 	SendMessage(messageID string, req *pmapi.SendMessageReq) error
+	ImportMessage(addressID string, body []byte, labelIDs []string) (string, error)
+	GetMaxUpload() (uint, error)
 }
@@ -22,19 +22,21 @@ package smtp
 import (
 	"bytes"
 	"encoding/base64"
-	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"mime"
 	"net/mail"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -46,71 +48,326 @@ type smtpUser struct {
 	panicHandler  panicHandler
 	eventListener listener.Listener
 	backend       *smtpBackend
+	conn          *goSMTPBackend.Conn
+	username      string
 	user          bridgeUser
 	client        bridge.PMAPIProvider
 	storeUser     storeUserProvider
 	addressID     string
+
+	// maxMessageBytes is the size limit of the user's messages, zero if unknown.
+	maxMessageBytes int64
+	// maxUpload is the size limit of attachments of one message, zero if unknown.
+	maxUpload uint
+
+	// userLock guards `user`, which is read when closing connections
+	// from other goroutines than the one serving the session.
+	userLock sync.RWMutex
+
+	from string
+	to   []string
+	dsn  *dsnRequest
 }
 
 // newSMTPUser returns struct implementing go-smtp/session interface.
+// The session has no user until it is authenticated by AuthPlain.
 func newSMTPUser(
 	panicHandler panicHandler,
 	eventListener listener.Listener,
 	smtpBackend *smtpBackend,
-	user bridgeUser,
-	addressID string,
-) (goSMTPBackend.User, error) {
-	// Using client directly is deprecated. Code should be moved to store.
-	client := user.GetTemporaryPMAPIClient()
+	conn *goSMTPBackend.Conn,
+) *smtpUser {
+	return &smtpUser{
+		panicHandler:  panicHandler,
+		eventListener: eventListener,
+		backend:       smtpBackend,
+		conn:          conn,
+	}
+}
+
+// AuthPlain authenticates the session using username and password.
+func (su *smtpUser) AuthPlain(username, password string) error {
+	// Called from go-smtp in goroutines - we need to handle panics for each function.
+	defer su.panicHandler.HandlePanic()
+
+	user, addressID, err := su.backend.Login(username, password)
+	if err != nil {
+		// Remote address is the client one also behind a proxy with PROXY protocol.
+		log.WithField("remote", su.conn.Conn().RemoteAddr()).Warn("SMTP authentication failed")
+		return err
+	}
+
+	return su.setUser(username, user, addressID)
+}
+
+// AuthCRAMMD5 authenticates the session by CRAM-MD5 digest of the bridge password.
+func (su *smtpUser) AuthCRAMMD5(username, challenge, digest string) error {
+	// Called from go-smtp in goroutines - we need to handle panics for each function.
+	defer su.panicHandler.HandlePanic()
+
+	user, addressID, err := su.backend.LoginCRAMMD5(username, challenge, digest)
+	if err != nil {
+		log.WithField("remote", su.conn.Conn().RemoteAddr()).Warn("SMTP authentication failed")
+		return err
+	}
+
+	return su.setUser(username, user, addressID)
+}
 
+// setUser sets the user the session sends messages for.
+func (su *smtpUser) setUser(username string, user bridgeUser, addressID string) error {
 	storeUser := user.GetStore()
 	if storeUser == nil {
-		return nil, errors.New("user database is not initialized")
+		return errors.New("user database is not initialized")
 	}
 
-	return &smtpUser{
-		panicHandler:  panicHandler,
-		eventListener: eventListener,
-		backend:       smtpBackend,
-		user:          user,
-		client:        client,
-		storeUser:     storeUser,
-		addressID:     addressID,
-	}, nil
+	maxUpload, err := storeUser.GetMaxUpload()
+	if err != nil {
+		log.WithError(err).Warn("Cannot get max upload size")
+	}
+
+	su.userLock.Lock()
+	defer su.userLock.Unlock()
+
+	su.maxMessageBytes = store.MessageSizeLimit(maxUpload)
+	su.maxUpload = maxUpload
+	su.username = strings.ToLower(username)
+	su.user = user
+	// Using client directly is deprecated. Code should be moved to store.
+	su.client = user.GetTemporaryPMAPIClient()
+	su.storeUser = storeUser
+	su.addressID = addressID
+	return nil
+}
+
+func (su *smtpUser) isAuthenticated() bool {
+	su.userLock.RLock()
+	defer su.userLock.RUnlock()
+
+	return su.user != nil
+}
+
+// Mail sets the sender of the message.
+func (su *smtpUser) Mail(from string, opts *goSMTPBackend.MailOptions) error {
+	if !su.isAuthenticated() {
+		return goSMTPBackend.ErrAuthRequired
+	}
+	if opts != nil && su.maxMessageBytes > 0 && opts.Size > su.maxMessageBytes {
+		return errMessageTooLarge
+	}
+	su.from = from
+	su.dsn = newDSNRequest(opts)
+	return nil
+}
+
+// Rcpt adds a recipient of the message.
+func (su *smtpUser) Rcpt(to string, opts *goSMTPBackend.RcptOptions) error {
+	if !su.isAuthenticated() {
+		return goSMTPBackend.ErrAuthRequired
+	}
+	if err := checkRecipient(su.client, to); err != nil {
+		return toSMTPError(err)
+	}
+	su.to = append(su.to, to)
+	su.dsn.addRecipient(to, opts)
+	return nil
+}
+
+// Data sends the message to all set recipients.
+// When the message cannot be sent because of a temporary error, it is
+// scheduled to be sent later, sending is delayed so the user can cancel it,
+// or the user exceeded the rate limit, it is queued in the outbox and accepted.
+// Notifications are then generated only if it finally fails.
+// Message sent only to some recipients is accepted, see handlePartialSend.
+func (su *smtpUser) Data(r io.Reader) error {
+	// Keep copy of the message to be able to queue it or include it in the notification.
+	original, err := ioutil.ReadAll(newLimitedReader(r, su.maxMessageBytes))
+	if err != nil {
+		return err
+	}
+
+	// Checked before queueing so the client learns it right away, not by a notification.
+	if err := checkAttachmentsSize(original, su.maxUpload); err != nil {
+		su.addJournalEntry(len(original), "", JournalResultRejected, err)
+		return err
+	}
+
+	sendAfter, err := getScheduledSendTime(original)
+	if err != nil {
+		su.addJournalEntry(len(original), "", JournalResultRejected, err)
+		return err
+	}
+	if sendAfter.After(time.Now()) {
+		return su.queueMessageWithJournal(original, sendAfter, nil)
+	}
+	if delay := su.backend.getSendDelay(); delay > 0 {
+		sendAfter = time.Now().Add(delay)
+		su.backend.wakeOutboxAt(sendAfter)
+		return su.queueMessageWithJournal(original, sendAfter, nil)
+	}
+	if su.backend.rateLimiter.take(su.username, su.backend.getRateLimit(), time.Now()) > 0 {
+		return su.queueMessageWithJournal(original, time.Time{}, errRateLimited)
+	}
+
+	messageID, err := su.Send(su.from, su.to, bytes.NewReader(original))
+
+	if partialErr, ok := err.(*partialSendError); ok {
+		return su.handlePartialSend(original, messageID, partialErr)
+	}
+
+	if isTemporarySendError(err) {
+		queueErr := su.queueMessage(original, su.to, time.Time{}, err)
+		if queueErr == nil {
+			su.addJournalEntry(len(original), "", JournalResultQueued, err)
+			return nil
+		}
+		log.WithError(queueErr).Error("Cannot queue message in outbox")
+	}
+
+	switch {
+	case err == nil:
+		su.addJournalEntry(len(original), messageID, JournalResultSent, nil)
+	case su.dsn.isRequested():
+		su.addJournalEntry(len(original), messageID, JournalResultFailed, err)
+	default:
+		su.addJournalEntry(len(original), messageID, JournalResultRejected, err)
+	}
+
+	if !su.dsn.isRequested() {
+		return toSMTPError(err)
+	}
+	return su.handleDSN(original, err)
+}
+
+// handlePartialSend accepts the message which was sent only to some
+// recipients, because any failure reply would make the client send it again
+// to all of them. Recipients which failed temporarily are queued in the
+// outbox, those which failed permanently get a failure notification unless
+// they asked for none. The result is recorded in the journal in any case.
+func (su *smtpUser) handlePartialSend(original []byte, messageID string, partialErr *partialSendError) error {
+	temporary, permanent := partialErr.split()
+	if len(temporary) > 0 {
+		if err := su.queueMessage(original, getRecipientAddresses(temporary), time.Time{}, newPartialSendError(temporary)); err != nil {
+			log.WithError(err).Error("Cannot queue message in outbox")
+			permanent = append(permanent, temporary...)
+			temporary = nil
+		}
+	}
+	su.addJournalEntry(len(original), messageID, JournalResultPartial, partialErr)
+
+	if len(permanent) == 0 {
+		return nil
+	}
+
+	// Without DSN parameters, failures are notified as any MTA does.
+	if !su.dsn.isNotifySet() {
+		su.dsn = newDSNRequest(nil)
+		for _, address := range su.to {
+			su.dsn.addRecipient(address, &goSMTPBackend.RcptOptions{
+				Notify: []goSMTPBackend.DSNNotify{goSMTPBackend.DSNNotifyFailure},
+			})
+		}
+	}
+
+	// Queued recipients are notified by the outbox if they finally fail.
+	isQueued := map[string]bool{}
+	for _, rcptErr := range temporary {
+		isQueued[strings.ToLower(rcptErr.address)] = true
+	}
+	var statuses []*dsnRecipientStatus
+	for _, status := range su.dsn.getRecipientStatuses(newPartialSendError(permanent)) {
+		if !isQueued[strings.ToLower(status.recipient.address)] {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	// Replying with failure now would send the message again to recipients
+	// who already got it, so the user is told by an error event instead.
+	if err := su.importDSN(original, statuses); err != nil {
+		log.WithError(err).WithField("from", su.from).Error("Cannot import DSN")
+		su.eventListener.Emit(events.ErrorEvent, "Message from "+su.from+" was not sent to all recipients: "+partialErr.Error())
+	}
+	return nil
+}
+
+// queueMessageWithJournal queues the message and records the result in the journal.
+func (su *smtpUser) queueMessageWithJournal(original []byte, sendAfter time.Time, sendErr error) error {
+	if err := su.queueMessage(original, su.to, sendAfter, sendErr); err != nil {
+		su.addJournalEntry(len(original), "", JournalResultRejected, err)
+		return err
+	}
+	su.addJournalEntry(len(original), "", JournalResultQueued, sendErr)
+	return nil
+}
+
+// Reset discards the currently processed message.
+func (su *smtpUser) Reset() {
+	su.from = ""
+	su.to = nil
+	su.dsn = nil
 }
 
 // Send sends an email from the given address to the given addresses with the given body.
-func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err error) { //nolint[funlen]
+func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (messageID string, err error) { //nolint[funlen]
 	// Called from go-smtp in goroutines - we need to handle panics for each function.
 	defer su.panicHandler.HandlePanic()
 
 	mailSettings, err := su.client.GetMailSettings()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	var addr *pmapi.Address = su.client.Addresses().ByEmail(from)
+	var addr *pmapi.Address = getSendingAddress(su.client.Addresses(), from)
 	if addr == nil {
 		err = errors.New("backend: invalid email address: not owned by user")
 		return
 	}
 	kr := addr.KeyRing()
 
+	rawMessage, err := ioutil.ReadAll(messageReader)
+	if err != nil {
+		return "", err
+	}
+	submissionHeader := readHeader(rawMessage)
+
 	var attachedPublicKey string
 	var attachedPublicKeyName string
-	if mailSettings.AttachPublicKey > 0 {
+	if shouldAttachPublicKey(mailSettings.AttachPublicKey > 0, su.backend.isAttachPublicKeyEnabled(), submissionHeader.Get(attachPublicKeyHeader)) {
 		attachedPublicKey, err = kr.GetArmoredPublicKey()
 		if err != nil {
-			return err
+			return "", err
 		}
 		attachedPublicKeyName = "publickey - " + kr.Identities()[0].Name
 	}
 
-	message, mimeBody, plainBody, attReaders, err := message.Parse(messageReader, attachedPublicKey, attachedPublicKeyName)
+	message, mimeBody, plainBody, attReaders, err := message.Parse(bytes.NewReader(rawMessage), attachedPublicKey, attachedPublicKeyName)
 	if err != nil {
 		return
 	}
 	clearBody := message.Body
+	// Parsing restructures the MIME tree which would invalidate S/MIME signature.
+	smimeSigned := isSMIMESigned(message.Header)
+	if smimeSigned {
+		mimeBody = string(rawMessage)
+	}
+
+	// The headers are meant only for bridge, recipients should not see them.
+	wkdOverride := submissionHeader.Get(wkdHeader)
+	signOverride := submissionHeader.Get(signHeader)
+	encryptOverrides, err := parseEncryptToHeader(submissionHeader[encryptToHeader])
+	if err != nil {
+		return "", err
+	}
+	// Recipients must not see Bcc either; the API gets them in BCCList.
+	hiddenHeaders := []string{scheduledSendHeader, wkdHeader, attachPublicKeyHeader, signHeader, encryptToHeader, "Bcc"}
+	for _, key := range hiddenHeaders {
+		delete(message.Header, key)
+	}
+	mimeBody = removeHeaders(mimeBody, hiddenHeaders...)
+	isWKDLookupEnabled := su.backend.isWKDLookupEnabled()
 
 	externalID := message.Header.Get("Message-Id")
 	externalID = strings.Trim(externalID, "<>")
@@ -118,11 +375,16 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	draftID, parentID := su.handleReferencesHeader(message)
 
 	if err = su.handleSenderAndRecipients(message, addr, from, to); err != nil {
-		return err
+		return "", err
 	}
 
 	message.AddressID = addr.ID
 
+	if requestsDispositionNotification(message.Header) {
+		message.Flags |= pmapi.FlagReceiptRequest
+	}
+	isNotification := isDispositionNotification(message.Header)
+
 	// Apple Mail Message-Id has to be stored to avoid recovered message after each send.
 	// Before it was done only for Apple Mail, but it should work for any client. Also, the client
 	// is set up from IMAP and no one can be sure that the same client is used for SMTP as well.
@@ -137,28 +399,45 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	// sending queue, we wait a minute to finish the first request. If the message is still being
 	// sent after the timeout, we return an error back to the client. The UX is not the best,
 	// but it's better than sending the message many times. If the message was sent, we simply return
-	// nil to indicate it's OK.
-	sendRecorderMessageHash := su.backend.sendRecorder.getMessageHash(message)
-	isSending, wasSent := su.backend.sendRecorder.isSendingOrSent(su.client, sendRecorderMessageHash)
-	if isSending {
-		log.Debug("Message is in send queue, waiting")
-		time.Sleep(60 * time.Second)
-		isSending, wasSent = su.backend.sendRecorder.isSendingOrSent(su.client, sendRecorderMessageHash)
-	}
-	if isSending {
-		log.Debug("Message is still in send queue, returning error")
-		return errors.New("message is sending")
-	}
-	if wasSent {
-		log.Debug("Message was already sent")
-		return nil
+	// nil to indicate it's OK. Users sending the same message on purpose can disable it.
+	var sendRecorderMessageHash string
+	var sentRecipients []string
+	if su.backend.isDuplicateSendCheckEnabled() {
+		su.backend.sendRecorder.setTimeouts(su.backend.getDuplicateSendTimeouts())
+		sendRecorderMessageHash = su.backend.sendRecorder.getMessageHash(message)
+		isSending, wasSent := su.backend.sendRecorder.isSendingOrSent(su.client, sendRecorderMessageHash)
+		if isSending {
+			log.Debug("Message is in send queue, waiting")
+			time.Sleep(60 * time.Second)
+			isSending, wasSent = su.backend.sendRecorder.isSendingOrSent(su.client, sendRecorderMessageHash)
+		}
+		if isSending {
+			log.Debug("Message is still in send queue, returning error")
+			return "", errors.New("message is sending")
+		}
+		if wasSent {
+			sentRecipients = su.backend.sendRecorder.getSentRecipients(sendRecorderMessageHash)
+			if sentRecipients == nil {
+				log.Debug("Message was already sent")
+				return su.backend.sendRecorder.getMessageID(sendRecorderMessageHash), nil
+			}
+			if to = getRemainingRecipients(to, sentRecipients); len(to) == 0 {
+				log.Debug("Message was already sent to all recipients")
+				su.backend.sendRecorder.setSentRecipients(sendRecorderMessageHash, nil)
+				return su.backend.sendRecorder.getMessageID(sendRecorderMessageHash), nil
+			}
+			log.WithField("recipients", len(to)).Debug("Message was sent only partially, sending to the remaining recipients")
+		}
 	}
 
 	message, atts, err := su.storeUser.CreateDraft(kr, message, attReaders, attachedPublicKey, attachedPublicKeyName, parentID)
 	if err != nil {
 		return
 	}
-	su.backend.sendRecorder.addMessage(sendRecorderMessageHash, message.ID)
+	if sendRecorderMessageHash != "" {
+		su.backend.sendRecorder.addMessage(sendRecorderMessageHash, message.ID)
+	}
+	su.backend.draftTracker.add(su.username, message.ID, time.Now())
 
 	// We always have to create a new draft even if there already is one,
 	// because clients don't necessarily save the draft before sending, which
@@ -178,10 +457,10 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	for _, att := range atts {
 		var keyPackets []byte
 		if keyPackets, err = base64.StdEncoding.DecodeString(att.KeyPackets); err != nil {
-			return errors.Wrap(err, "decoding attachment key packets")
+			return "", errors.Wrap(err, "decoding attachment key packets")
 		}
 		if attkeys[att.ID], err = kr.DecryptSessionKey(keyPackets); err != nil {
-			return errors.Wrap(err, "decrypting attachment session key")
+			return "", errors.Wrap(err, "decrypting attachment session key")
 		}
 		attkeysEncoded[att.ID] = pmapi.AlgoKey{
 			Key:       attkeys[att.ID].GetBase64Key(),
@@ -203,17 +482,23 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 
 	// PMEL 3.
 	composeMode := message.MIMEType
+	plainTextAlternative := su.backend.isPlainTextAlternativeEnabled() && !smimeSigned && isHTMLOnly(composeMode, rawMessage)
 
 	var plainKey, htmlKey, mimeKey *pmcrypto.SymmetricKey
 	var plainData, htmlData, mimeData []byte
 
 	containsUnencryptedRecipients := false
 
+	// Recipients which cannot be handled do not block sending to the others.
+	// They are reported back to the client and retry sends only to them.
+	var failedRecipients []*recipientError
+	var succeededRecipients []string
+
 	for _, email := range to {
 		// PMEL 1.
 		contactEmails, err := su.client.GetContactEmailByEmail(email, 0, 1000)
 		if err != nil {
-			return err
+			return "", err
 		}
 		var contactMeta *ContactMetadata
 		var contactKeys []*pmcrypto.KeyRing
@@ -223,20 +508,20 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 			}
 			contact, err := su.client.GetContactByID(contactEmail.ContactID)
 			if err != nil {
-				return err
+				return "", err
 			}
 			decryptedCards, err := su.client.DecryptAndVerifyCards(contact.Cards)
 			if err != nil {
-				return err
+				return "", err
 			}
 			contactMeta, err = GetContactMetadataFromVCards(decryptedCards, email)
 			if err != nil {
-				return err
+				return "", err
 			}
 			for _, contactRawKey := range contactMeta.Keys {
 				contactKey, err := pmcrypto.ReadKeyRing(bytes.NewBufferString(contactRawKey))
 				if err != nil {
-					return err
+					return "", err
 				}
 				contactKeys = append(contactKeys, contactKey)
 			}
@@ -247,25 +532,50 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		// PMEL 4.
 		apiRawKeyList, isInternal, err := su.client.GetPublicKeysForEmail(email)
 		if err != nil {
-			err = fmt.Errorf("backend: cannot get recipients' public keys: %v", err)
-			return err
+			err = errors.Wrap(err, "backend: cannot get recipients' public keys")
+			failedRecipients = append(failedRecipients, newRecipientError(email, getAPIErrorStatus(err), err))
+			continue
 		}
 
 		var apiKeys []*pmcrypto.KeyRing
 		for _, apiRawKey := range apiRawKeyList {
 			var kr *pmcrypto.KeyRing
 			if kr, err = pmcrypto.ReadArmoredKeyRing(strings.NewReader(apiRawKey.PublicKey)); err != nil {
-				return err
+				return "", err
 			}
 			apiKeys = append(apiKeys, kr)
 		}
 
+		// Keys of external recipients are looked up by bridge if the API did not return any.
+		if !isInternal && len(apiKeys) == 0 && len(contactKeys) == 0 && shouldLookupWKD(isWKDLookupEnabled, wkdOverride, contactMeta) {
+			if wkdKey := getWKDKey(su.backend.wkdLookup, email); wkdKey != nil {
+				apiKeys = append(apiKeys, wkdKey)
+			}
+		}
+
 		sendingInfo, err := generateSendingInfo(su.eventListener, contactMeta, isInternal, composeMode, apiKeys, contactKeys, settingsSign, settingsPgpScheme)
+		if encrypt, ok := encryptOverrides[strings.ToLower(email)]; ok && err == nil && !isInternal {
+			sendingInfo, err = applyEncryptOverride(sendingInfo, contactMeta, encrypt, apiKeys, contactKeys, composeMode, settingsSign, settingsPgpScheme)
+		}
+		if err == nil {
+			sendingInfo, err = applySignOverride(sendingInfo, contactMeta, signOverride, composeMode, settingsPgpScheme)
+		}
+		if err != nil {
+			err = errors.Wrap(err, "error sending to user "+email)
+			failedRecipients = append(failedRecipients, newRecipientError(email, statusCryptographicIssue, err))
+			continue
+		}
 		if !sendingInfo.Encrypt {
 			containsUnencryptedRecipients = true
 		}
-		if err != nil {
-			return errors.New("error sending to user " + email + ": " + err.Error())
+		if isNotification {
+			sendingInfo = keepMIMEStructure(sendingInfo)
+		}
+		if smimeSigned {
+			sendingInfo = keepSMIMESignature(sendingInfo)
+		}
+		if plainTextAlternative {
+			sendingInfo = addPlainTextAlternative(sendingInfo)
 		}
 
 		var signature int
@@ -277,13 +587,13 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		if sendingInfo.Scheme == pmapi.PGPMIMEPackage || sendingInfo.Scheme == pmapi.ClearMIMEPackage {
 			if mimeKey == nil {
 				if mimeKey, mimeData, err = encryptSymmetric(kr, mimeBody, true); err != nil {
-					return err
+					return "", err
 				}
 			}
 			if sendingInfo.Scheme == pmapi.PGPMIMEPackage {
 				mimeBodyPacket, _, err := createPackets(sendingInfo.PublicKey, mimeKey, map[string]*pmcrypto.SymmetricKey{})
 				if err != nil {
-					return err
+					return "", err
 				}
 				mimeAddressMap[email] = &pmapi.MessageAddress{Type: sendingInfo.Scheme, BodyKeyPacket: mimeBodyPacket, Signature: signature}
 			} else {
@@ -295,14 +605,14 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 			case pmapi.ContentTypePlainText:
 				if plainKey == nil {
 					if plainKey, plainData, err = encryptSymmetric(kr, plainBody, true); err != nil {
-						return err
+						return "", err
 					}
 				}
 				newAddress := &pmapi.MessageAddress{Type: sendingInfo.Scheme, Signature: signature}
 				if sendingInfo.Encrypt && sendingInfo.PublicKey != nil {
 					newAddress.BodyKeyPacket, newAddress.AttachmentKeyPackets, err = createPackets(sendingInfo.PublicKey, plainKey, attkeys)
 					if err != nil {
-						return err
+						return "", err
 					}
 				}
 				plainAddressMap[email] = newAddress
@@ -310,31 +620,36 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 			case pmapi.ContentTypeHTML:
 				if htmlKey == nil {
 					if htmlKey, htmlData, err = encryptSymmetric(kr, clearBody, true); err != nil {
-						return err
+						return "", err
 					}
 				}
 				newAddress := &pmapi.MessageAddress{Type: sendingInfo.Scheme, Signature: signature}
 				if sendingInfo.Encrypt && sendingInfo.PublicKey != nil {
 					newAddress.BodyKeyPacket, newAddress.AttachmentKeyPackets, err = createPackets(sendingInfo.PublicKey, htmlKey, attkeys)
 					if err != nil {
-						return err
+						return "", err
 					}
 				}
 				htmlAddressMap[email] = newAddress
 				htmlSharedScheme |= sendingInfo.Scheme
 			}
 		}
+		succeededRecipients = append(succeededRecipients, email)
+	}
+
+	if len(succeededRecipients) == 0 && len(failedRecipients) > 0 {
+		return "", failedRecipients[0]
 	}
 
 	if containsUnencryptedRecipients {
 		dec := new(mime.WordDecoder)
 		subject, err := dec.DecodeHeader(message.Header.Get("Subject"))
 		if err != nil {
-			return errors.New("error decoding subject message " + message.Header.Get("Subject"))
+			return "", errors.New("error decoding subject message " + message.Header.Get("Subject"))
 		}
 		if !su.continueSendingUnencryptedMail(subject) {
 			_ = su.client.DeleteMessages([]string{message.ID})
-			return errors.New("sending was canceled by user")
+			return "", errors.New("sending was canceled by user")
 		}
 	}
 
@@ -363,7 +678,22 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		req.Packages = append(req.Packages, pkg)
 	}
 
-	return su.storeUser.SendMessage(message.ID, req)
+	if err = su.storeUser.SendMessage(message.ID, req); err != nil {
+		return "", err
+	}
+	su.backend.draftTracker.remove(message.ID)
+
+	if sendRecorderMessageHash != "" {
+		if len(failedRecipients) > 0 {
+			su.backend.sendRecorder.setSentRecipients(sendRecorderMessageHash, append(sentRecipients, succeededRecipients...))
+		} else if sentRecipients != nil {
+			su.backend.sendRecorder.setSentRecipients(sendRecorderMessageHash, nil)
+		}
+	}
+	if len(failedRecipients) > 0 {
+		return message.ID, newPartialSendError(failedRecipients)
+	}
+	return message.ID, nil
 }
 
 func (su *smtpUser) handleReferencesHeader(m *pmapi.Message) (draftID, parentID string) {
@@ -422,7 +752,15 @@ func isDraft(m *pmapi.Message) bool {
 }
 
 func (su *smtpUser) handleSenderAndRecipients(m *pmapi.Message, addr *pmapi.Address, from string, to []string) (err error) {
-	from = pmapi.ConstructAddress(from, addr.Email)
+	var headerFrom string
+	if m.Sender != nil {
+		headerFrom = m.Sender.Address
+	}
+	if addr.CatchAll == pmapi.CatchAllAddress {
+		from = getCatchAllSenderAddress(from, headerFrom, addr.Email)
+	} else {
+		from = getSenderAddress(from, headerFrom, addr.Email)
+	}
 
 	// Check sender.
 	if m.Sender == nil {
@@ -442,7 +780,8 @@ func (su *smtpUser) handleSenderAndRecipients(m *pmapi.Message, addr *pmapi.Addr
 	for _, keep := range m.ToList {
 		keepThis := false
 		for _, addr := range to {
-			if addr == keep.Address {
+			// Addresses can differ in case, also non-ASCII ones with SMTPUTF8.
+			if strings.EqualFold(addr, keep.Address) {
 				keepThis = true
 				break
 			}
@@ -463,11 +802,11 @@ func (su *smtpUser) handleSenderAndRecipients(m *pmapi.Message, addr *pmapi.Addr
 
 	rm := map[string]bool{}
 	for _, r := range recipients {
-		rm[r.Address] = true
+		rm[strings.ToLower(r.Address)] = true
 	}
 
 	for _, r := range to {
-		if !rm[r] {
+		if !rm[strings.ToLower(r)] {
 			// Recipient is not known, add it to Bcc.
 			m.BCCList = append(m.BCCList, &mail.Address{Address: r})
 		}
@@ -509,5 +848,6 @@ func (su *smtpUser) continueSendingUnencryptedMail(subject string) bool {
 // Logout is called when this User will no longer be used.
 func (su *smtpUser) Logout() error {
 	log.Debug("SMTP client logged out user ", su.addressID)
+	su.backend.removeSession(su.conn)
 	return nil
 }
@@ -18,7 +18,11 @@
 package smtp
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/base64"
+	"net/textproto"
+	"strings"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -94,3 +98,62 @@ func buildPackage(
 	}
 	return pkg
 }
+
+// readHeader returns the header of the raw message `msg`. Broken header is
+// reported later by the message parser, so as much as possible is returned.
+func readHeader(msg []byte) textproto.MIMEHeader {
+	header, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(msg))).ReadMIMEHeader()
+	if header == nil {
+		header = textproto.MIMEHeader{}
+	}
+	return header
+}
+
+// parseYesNo parses value of headers controlling sending of one message.
+// Second return value is false if the value is neither yes nor no.
+func parseYesNo(value string) (yes, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true":
+		return true, true
+	case "no", "false":
+		return false, true
+	}
+	return false, false
+}
+
+// removeHeaders removes fields `keys` from the top-level header of the MIME
+// `body`, including their folded lines. The rest of the body is kept as is.
+func removeHeaders(body string, keys ...string) string {
+	remove := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		remove[textproto.CanonicalMIMEHeaderKey(key)] = true
+	}
+
+	var result strings.Builder
+	skipping := false
+	rest := body
+	for rest != "" {
+		line := rest
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+
+		if strings.TrimRight(line, "\r\n") == "" {
+			result.WriteString(line)
+			result.WriteString(rest)
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			key := line
+			if i := strings.IndexByte(line, ':'); i >= 0 {
+				key = line[:i]
+			}
+			skipping = remove[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))]
+		}
+		if !skipping {
+			result.WriteString(line)
+		}
+	}
+	return result.String()
+}
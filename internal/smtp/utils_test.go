@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveHeaders(t *testing.T) {
+	testData := []struct {
+		name, body, want string
+	}{
+		{
+			"removed fields",
+			"From: a@pm.me\r\nX-Pm-Attach-Public-Key: yes\r\nSubject: hi\r\nx-pm-wkd: no\r\n\r\nhello\r\n",
+			"From: a@pm.me\r\nSubject: hi\r\n\r\nhello\r\n",
+		},
+		{
+			"folded field",
+			"X-Pm-Scheduled-Send: Mon, 02 Jan 2006\r\n 15:04:05 +0000\r\nSubject: hi\r\n\nX-Pm-Wkd: body\r\n",
+			"Subject: hi\r\n\nX-Pm-Wkd: body\r\n",
+		},
+		{
+			"nothing to remove",
+			"Subject: hi\n\nhello",
+			"Subject: hi\n\nhello",
+		},
+		{
+			"no body",
+			"Subject: hi\r\nX-Pm-Wkd: yes",
+			"Subject: hi\r\n",
+		},
+	}
+	for _, tc := range testData {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, removeHeaders(tc.body, attachPublicKeyHeader, wkdHeader, scheduledSendHeader))
+		})
+	}
+}
+
+func TestRemoveHeaders_bcc(t *testing.T) {
+	body := "To: undisclosed-recipients:;\r\nBcc: a@pm.me,\r\n\tb@pm.me\r\nSubject: hi\r\n\r\nhello\r\n"
+	assert.Equal(t, "To: undisclosed-recipients:;\r\nSubject: hi\r\n\r\nhello\r\n", removeHeaders(body, "Bcc"))
+}
@@ -27,13 +27,14 @@ import (
 )
 
 type ContactMetadata struct {
-	Email       string
-	Keys        []string
-	Scheme      string
-	Sign        bool
-	SignMissing bool
-	Encrypt     bool
-	MIMEType    string
+	Email          string
+	Keys           []string
+	Scheme         string
+	Sign           bool
+	SignMissing    bool
+	Encrypt        bool
+	EncryptMissing bool
+	MIMEType       string
 }
 
 const (
@@ -72,6 +73,7 @@ func GetContactMetadataFromVCards(cards []pmapi.Card, email string) (contactMeta
 		// Warn: ParseBool treats 1, T, True, true as true and 0, F, Fale, false as false.
 		//       However PMEL declares 'true' is true, 'false' is false. every other string is true
 		encrypt, _ := strconv.ParseBool(parsedCard.GetValueByGroup(FieldPMEncrypt, group))
+		encryptMissing := len(parsedCard[FieldPMEncrypt]) == 0
 		var sign, signMissing bool
 		if len(parsedCard[FieldPMSign]) == 0 {
 			signMissing = true
@@ -81,14 +83,15 @@ func GetContactMetadataFromVCards(cards []pmapi.Card, email string) (contactMeta
 		}
 		mimeType := parsedCard.GetValueByGroup(FieldPMMIMEType, group)
 		return &ContactMetadata{
-			Email:       email,
-			Keys:        keys,
-			Scheme:      scheme,
-			Sign:        sign,
-			SignMissing: signMissing,
-			Encrypt:     encrypt,
-			MIMEType:    mimeType,
+			Email:          email,
+			Keys:           keys,
+			Scheme:         scheme,
+			Sign:           sign,
+			SignMissing:    signMissing,
+			Encrypt:        encrypt,
+			EncryptMissing: encryptMissing,
+			MIMEType:       mimeType,
 		}, nil
 	}
-	return &ContactMetadata{}, nil
+	return &ContactMetadata{EncryptMissing: true}, nil
 }
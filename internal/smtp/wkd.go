@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"strings"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/wkd"
+)
+
+// wkdHeader overrides for a single message whether keys of external
+// recipients are looked up in Web Key Directory. The value is yes or no.
+const wkdHeader = "X-Pm-Wkd"
+
+type wkdLookuper func(email string) ([]byte, error)
+
+func newWKDLookuper() wkdLookuper {
+	client := wkd.NewClient()
+	return func(email string) ([]byte, error) {
+		return wkd.Lookup(client, email)
+	}
+}
+
+// shouldLookupWKD returns whether the key of an external recipient without
+// any known key should be looked up. The per-send `header` is preferred over
+// the contact's encryption preference, which is preferred over `enabled`.
+func shouldLookupWKD(enabled bool, header string, contactMeta *ContactMetadata) bool {
+	if override, ok := parseYesNo(header); ok {
+		return override
+	}
+	if contactMeta != nil && !contactMeta.EncryptMissing {
+		return contactMeta.Encrypt
+	}
+	return enabled
+}
+
+// getWKDKey returns valid key published for `email`, or nil if there is none.
+func getWKDKey(lookup wkdLookuper, email string) *pmcrypto.KeyRing {
+	l := log.WithField("email", email)
+
+	rawKey, err := lookup(email)
+	if err != nil {
+		l.WithError(err).Debug("No key found in WKD")
+		return nil
+	}
+
+	kr, err := pmcrypto.ReadKeyRing(bytes.NewReader(rawKey))
+	if err != nil {
+		l.WithError(err).Warn("Cannot read key from WKD")
+		return nil
+	}
+
+	// The directory can be served by anyone controlling the domain,
+	// but the key has to be at least issued for the address.
+	if !hasIdentity(kr, email) {
+		l.Warn("Key from WKD is not issued for the address")
+		return nil
+	}
+
+	validKeys, err := pmcrypto.FilterExpiredKeys([]*pmcrypto.KeyRing{kr})
+	if err != nil || len(validKeys) == 0 {
+		l.WithError(err).Warn("Key from WKD is expired")
+		return nil
+	}
+
+	return validKeys[0]
+}
+
+func hasIdentity(kr *pmcrypto.KeyRing, email string) bool {
+	for _, identity := range kr.Identities() {
+		if strings.EqualFold(identity.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sb *smtpBackend) isWKDLookupEnabled() bool {
+	return sb.preferences.GetBool(preferences.WKDLookupKey)
+}
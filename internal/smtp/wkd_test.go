@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestShouldLookupWKD(t *testing.T) {
+	noPreference := &ContactMetadata{EncryptMissing: true}
+	encrypt := &ContactMetadata{Encrypt: true}
+	doNotEncrypt := &ContactMetadata{Encrypt: false}
+
+	testCases := []struct {
+		enabled     bool
+		header      string
+		contactMeta *ContactMetadata
+		want        bool
+	}{
+		{false, "", nil, false},
+		{true, "", nil, true},
+		{true, "", noPreference, true},
+		{false, "", encrypt, true},
+		{true, "", doNotEncrypt, false},
+		{false, "yes", doNotEncrypt, true},
+		{true, " No ", encrypt, false},
+		{false, "invalid", nil, false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, shouldLookupWKD(tc.enabled, tc.header, tc.contactMeta), "%+v", tc)
+	}
+}
+
+func TestGetWKDKey(t *testing.T) {
+	entity, err := openpgp.NewEntity("Joe", "", "joe@example.org", nil)
+	require.NoError(t, err)
+	publicKey := &bytes.Buffer{}
+	require.NoError(t, entity.Serialize(publicKey))
+
+	lookup := func(email string) ([]byte, error) {
+		if email == "missing@example.org" {
+			return nil, errors.New("not found")
+		}
+		return publicKey.Bytes(), nil
+	}
+
+	kr := getWKDKey(lookup, "Joe@Example.org")
+	require.NotNil(t, kr)
+	assert.Equal(t, "joe@example.org", kr.Identities()[0].Email)
+
+	assert.Nil(t, getWKDKey(lookup, "jane@example.org"), "key for other address")
+	assert.Nil(t, getWKDKey(lookup, "missing@example.org"))
+	assert.Nil(t, getWKDKey(func(string) ([]byte, error) { return []byte("garbage"), nil }, "joe@example.org"))
+}
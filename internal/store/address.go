@@ -24,13 +24,20 @@ import (
 )
 
 // Address holds mailboxes for IMAP user (login address). In combined mode
-// there is only one address, in split mode there is one object per address.
+// there is only one login address, in split mode there is one object per
+// address. Secondary addresses in combined mode are namespaces of the login
+// address: their mailboxes hold only messages of the address and are listed
+// under the namespace prefix, e.g. "Addresses/alias@pm.me/INBOX".
 type Address struct {
 	store     *Store
 	address   string
 	addressID string
 	mailboxes map[string]*Mailbox
 
+	// owner is the login address of namespace address, nil otherwise.
+	owner     *Address
+	namespace string
+
 	log *logrus.Entry
 }
 
@@ -39,21 +46,38 @@ func newAddress(
 	address, addressID string,
 	labels []*pmapi.Label,
 ) (addr *Address, err error) {
-	l := log.WithField("addressID", addressID)
-
-	storeAddress := &Address{
+	return initAddress(&Address{
 		store:     store,
 		address:   address,
 		addressID: addressID,
-		log:       l,
-	}
+		log:       log.WithField("addressID", addressID),
+	}, labels)
+}
+
+// newNamespaceAddress returns secondary address listed under its namespace
+// of the owner address.
+func newNamespaceAddress(
+	owner *Address,
+	address, addressID string,
+	labels []*pmapi.Label,
+) (addr *Address, err error) {
+	return initAddress(&Address{
+		store:     owner.store,
+		address:   address,
+		addressID: addressID,
+		owner:     owner,
+		namespace: AddressNamespacesPrefix + address + PathDelimiter,
+		log:       log.WithField("addressID", addressID),
+	}, labels)
+}
 
-	if err = storeAddress.init(labels); err != nil {
-		l.WithField("address", address).
+func initAddress(storeAddress *Address, labels []*pmapi.Label) (*Address, error) {
+	if err := storeAddress.init(labels); err != nil {
+		storeAddress.log.WithField("address", storeAddress.address).
 			WithError(err).
 			Error("Could not initialise store address")
 
-		return
+		return nil, err
 	}
 
 	return storeAddress, nil
@@ -66,10 +90,8 @@ func (storeAddress *Address) init(foldersAndLabels []*pmapi.Label) (err error) {
 
 	err = storeAddress.store.db.Update(func(tx *bolt.Tx) error {
 		for _, label := range foldersAndLabels {
-			prefix := getLabelPrefix(label)
-
 			var mailbox *Mailbox
-			if mailbox, err = txNewMailbox(tx, storeAddress, label.ID, prefix, label.Name, label.Color); err != nil {
+			if mailbox, err = txNewMailbox(tx, storeAddress, label); err != nil {
 				storeAddress.log.
 					WithError(err).
 					WithField("labelID", label.ID).
@@ -79,17 +101,80 @@ func (storeAddress *Address) init(foldersAndLabels []*pmapi.Label) (err error) {
 
 			storeAddress.mailboxes[label.ID] = mailbox
 		}
+		if err := storeAddress.txInitSearches(tx); err != nil {
+			return err
+		}
+		storeAddress.updateMailboxNames()
 		return nil
 	})
 
 	return
 }
 
+// txInitSearches creates built-in virtual mailboxes and mailboxes of saved
+// searches. Namespaces do not have them because the login address lists
+// messages of all addresses. Built-in mailboxes created for already synced
+// store are filled from the metadata bucket.
+func (storeAddress *Address) txInitSearches(tx *bolt.Tx) error {
+	if storeAddress.isNamespace() {
+		return nil
+	}
+	searches, err := txListSavedSearches(tx)
+	if err != nil {
+		return err
+	}
+	queries := map[string]SavedSearch{}
+	for labelID, search := range builtInSearches {
+		queries[labelID] = search
+	}
+	for _, search := range searches {
+		queries[search.labelID()] = search
+	}
+
+	newMailboxes := []*Mailbox{}
+	for labelID, search := range queries {
+		isNew := tx.Bucket(mailboxesBucket).Bucket(getMailboxBucketName(storeAddress.addressID, labelID)) == nil
+		mailbox, err := txNewSearchMailbox(tx, storeAddress, labelID, search)
+		if err != nil {
+			storeAddress.log.
+				WithError(err).
+				WithField("labelID", labelID).
+				Error("Could not init mailbox for search")
+			return err
+		}
+		storeAddress.mailboxes[labelID] = mailbox
+		if isNew && isBuiltInSearchLabel(labelID) {
+			newMailboxes = append(newMailboxes, mailbox)
+		}
+	}
+	if len(newMailboxes) == 0 {
+		return nil
+	}
+	return storeAddress.store.txFillMailboxes(tx, newMailboxes)
+}
+
+// deleteMailboxes removes buckets of all mailboxes of the address. It is used
+// when the address was deleted or disabled so its mailboxes do not keep stale
+// messages if it is enabled again.
+func (storeAddress *Address) deleteMailboxes() error {
+	return storeAddress.store.db.Update(func(tx *bolt.Tx) error {
+		for _, mailbox := range storeAddress.mailboxes {
+			err := tx.Bucket(mailboxesBucket).DeleteBucket(mailbox.getBucketName())
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // getLabelPrefix returns the correct prefix for a pmapi label according to whether it is exclusive or not.
 func getLabelPrefix(l *pmapi.Label) string {
 	switch {
-	case pmapi.IsSystemLabel(l.ID):
+	case pmapi.IsSystemLabel(l.ID), isBuiltInSearchLabel(l.ID):
 		return ""
+	case isSavedSearchLabel(l.ID):
+		return SavedSearchesPrefix
 	case l.Exclusive == 1:
 		return UserFoldersPrefix
 	default:
@@ -107,6 +192,19 @@ func (storeAddress *Address) AddressID() string {
 	return storeAddress.addressID
 }
 
+// isNamespace returns whether the address is namespace of other address.
+func (storeAddress *Address) isNamespace() bool {
+	return storeAddress.owner != nil
+}
+
+// loginAddress returns the address of IMAP user which lists the mailboxes.
+func (storeAddress *Address) loginAddress() string {
+	if storeAddress.isNamespace() {
+		return storeAddress.owner.address
+	}
+	return storeAddress.address
+}
+
 // APIAddress returns the `pmapi.Address` struct.
 func (storeAddress *Address) APIAddress() *pmapi.Address {
 	return storeAddress.store.api.Addresses().ByEmail(storeAddress.address)
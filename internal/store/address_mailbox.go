@@ -19,46 +19,122 @@ package store
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
-// ListMailboxes returns all mailboxes.
+// ListMailboxes returns all mailboxes including mailboxes of namespaces.
 func (storeAddress *Address) ListMailboxes() []*Mailbox {
 	storeAddress.store.lock.RLock()
 	defer storeAddress.store.lock.RUnlock()
 
 	mailboxes := make([]*Mailbox, 0, len(storeAddress.mailboxes))
-	for _, m := range storeAddress.mailboxes {
-		mailboxes = append(mailboxes, m)
+	for _, a := range storeAddress.withNamespaces() {
+		addressMailboxes := make([]*Mailbox, 0, len(a.mailboxes))
+		for _, m := range a.mailboxes {
+			addressMailboxes = append(addressMailboxes, m)
+		}
+		sortMailboxes(addressMailboxes)
+		mailboxes = append(mailboxes, addressMailboxes...)
 	}
 	return mailboxes
 }
 
-// GetMailbox returns mailbox with the given IMAP name.
+// sortMailboxes sorts mailboxes in the order set in the web app: system
+// folders first, then folders, labels and saved searches, each group by
+// its order and name.
+func sortMailboxes(mailboxes []*Mailbox) {
+	sort.Slice(mailboxes, func(i, j int) bool {
+		mi, mj := mailboxes[i], mailboxes[j]
+		if mi.labelPrefix != mj.labelPrefix {
+			return mi.labelPrefix < mj.labelPrefix
+		}
+		if mi.order != mj.order {
+			return mi.order < mj.order
+		}
+		return mi.labelName < mj.labelName
+	})
+}
+
+// GetMailbox returns mailbox with the given IMAP name. The name can be
+// also of mailbox in namespace.
 func (storeAddress *Address) GetMailbox(name string) (*Mailbox, error) {
 	storeAddress.store.lock.RLock()
 	defer storeAddress.store.lock.RUnlock()
 
-	for _, m := range storeAddress.mailboxes {
-		if m.Name() == name {
-			return m, nil
+	for _, a := range storeAddress.withNamespaces() {
+		for _, m := range a.mailboxes {
+			if m.Name() == name {
+				return m, nil
+			}
 		}
 	}
 
 	return nil, fmt.Errorf("mailbox %v does not exist", name)
 }
 
+// ListNamespaces returns prefixes of mailbox names of namespaces.
+func (storeAddress *Address) ListNamespaces() []string {
+	storeAddress.store.lock.RLock()
+	defer storeAddress.store.lock.RUnlock()
+
+	namespaces := []string{}
+	for _, a := range storeAddress.withNamespaces()[1:] {
+		namespaces = append(namespaces, a.namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// withNamespaces returns the address followed by its namespace addresses.
+func (storeAddress *Address) withNamespaces() []*Address {
+	addresses := []*Address{storeAddress}
+	for _, a := range storeAddress.store.addresses {
+		if a.owner == storeAddress {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+// GetMailboxNames returns IMAP names of mailboxes with labelIDs. Labels
+// without mailbox of this address are skipped.
+func (storeAddress *Address) GetMailboxNames(labelIDs []string) []string {
+	storeAddress.store.lock.RLock()
+	defer storeAddress.store.lock.RUnlock()
+
+	names := []string{}
+	for _, labelID := range labelIDs {
+		if m, ok := storeAddress.mailboxes[labelID]; ok {
+			names = append(names, m.Name())
+		}
+	}
+	return names
+}
+
 // CreateMailbox creates the mailbox by calling an API.
 // Mailbox is created in the structure by processing event.
 func (storeAddress *Address) CreateMailbox(name string) error {
-	return storeAddress.store.createMailbox(name)
+	return storeAddress.store.createMailbox(storeAddress.trimNamespace(name))
+}
+
+// trimNamespace returns the name without prefix of namespace because
+// folders and labels are shared by all addresses.
+func (storeAddress *Address) trimNamespace(name string) string {
+	for _, namespace := range storeAddress.ListNamespaces() {
+		if strings.HasPrefix(name, namespace) {
+			return strings.TrimPrefix(name, namespace)
+		}
+	}
+	return name
 }
 
 // updateMailbox updates the mailbox by calling an API.
 // Mailbox is updated in the structure by processing event.
-func (storeAddress *Address) updateMailbox(labelID, newName, color string) error {
-	return storeAddress.store.updateMailbox(labelID, newName, color)
+func (storeAddress *Address) updateMailbox(labelID, newName, parentID, color string) error {
+	return storeAddress.store.updateMailbox(labelID, newName, parentID, color)
 }
 
 // deleteMailbox deletes the mailbox by calling an API.
@@ -70,18 +146,23 @@ func (storeAddress *Address) deleteMailbox(labelID string) error {
 // createOrUpdateMailboxEvent creates or updates the mailbox in the structure.
 // This is called from the event loop.
 func (storeAddress *Address) createOrUpdateMailboxEvent(label *pmapi.Label) error {
-	prefix := getLabelPrefix(label)
 	mailbox, ok := storeAddress.mailboxes[label.ID]
 	if !ok {
-		mailbox, err := newMailbox(storeAddress, label.ID, prefix, label.Name, label.Color)
+		mailbox, err := newMailbox(storeAddress, label)
 		if err != nil {
 			return err
 		}
 		storeAddress.mailboxes[label.ID] = mailbox
 	} else {
-		mailbox.labelName = prefix + label.Name
+		mailbox.name = label.Name
 		mailbox.color = label.Color
+		mailbox.order = label.Order
+		if mailbox.IsFolder() {
+			mailbox.parentID = label.ParentID
+		}
 	}
+	// Renamed or moved folder changes names of all its subfolders.
+	storeAddress.updateMailboxNames()
 	return nil
 }
 
@@ -94,6 +175,7 @@ func (storeAddress *Address) deleteMailboxEvent(labelID string) error {
 		return nil
 	}
 	delete(storeAddress.mailboxes, labelID)
+	storeAddress.updateMailboxNames()
 	return storeMailbox.deleteMailboxEvent()
 }
 
@@ -104,3 +186,23 @@ func (storeAddress *Address) getMailboxByID(labelID string) (*Mailbox, error) {
 	}
 	return storeMailbox, nil
 }
+
+// updateMailboxNames sets IMAP names of all mailboxes. The name of folder
+// is the path of its parent folders, e.g. "Folders/Parent/Child".
+// Subfolder of missing parent is listed as top-level folder.
+func (storeAddress *Address) updateMailboxNames() {
+	for _, mailbox := range storeAddress.mailboxes {
+		path := mailbox.name
+		visited := map[string]bool{mailbox.labelID: true}
+		for parentID := mailbox.parentID; parentID != "" && !visited[parentID]; {
+			parent, ok := storeAddress.mailboxes[parentID]
+			if !ok || !parent.IsFolder() {
+				break
+			}
+			visited[parentID] = true
+			path = parent.name + PathDelimiter + path
+			parentID = parent.parentID
+		}
+		mailbox.labelName = storeAddress.namespace + mailbox.labelPrefix + path
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacesOfCombinedAddress(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+
+	primary := m.store.addresses[addrID1]
+	require.Equal(t, primary, m.store.addresses[addrID2].owner)
+
+	namespace := AddressNamespacesPrefix + addr2 + PathDelimiter
+	a.Equal(t, []string{namespace}, primary.ListNamespaces())
+
+	msg1 := getTestMessage("msg1", "Test message 1", addr1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg1.AddressID = addrID1
+	msg2 := getTestMessage("msg2", "Test message 2", addr2, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg2.AddressID = addrID2
+	require.NoError(t, m.store.createOrUpdateMessagesEvent([]*pmapi.Message{msg1, msg2}))
+
+	inbox, err := primary.GetMailbox("INBOX")
+	require.NoError(t, err)
+	checkMailboxCounts(t, inbox, 2, 0)
+
+	// Namespace lists only messages of its address.
+	namespaceInbox, err := primary.GetMailbox(namespace + "INBOX")
+	require.NoError(t, err)
+	a.Equal(t, addrID2, namespaceInbox.Address().AddressID())
+	checkMailboxCounts(t, namespaceInbox, 1, 0)
+
+	apiIDs, err := namespaceInbox.GetAPIIDsFromSequenceRange(1, 1)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg2"}, apiIDs)
+
+	// Namespace does not have virtual Unread and Starred.
+	a.Len(t, primary.ListMailboxes(), 2*len(primary.mailboxes)-len(builtInSearches))
+}
+
+func TestNoNamespacesInSplitMode(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(false)
+
+	for _, storeAddress := range m.store.addresses {
+		a.False(t, storeAddress.isNamespace())
+		a.Empty(t, storeAddress.ListNamespaces())
+	}
+}
+
+func TestSwitchAddressModeKeepsUIDs(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+	m.api.EXPECT().ListLabels().AnyTimes()
+	m.api.EXPECT().CountMessages("").AnyTimes()
+
+	msg1 := getTestMessage("msg1", "Test message 1", addr1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg1.AddressID = addrID1
+	msg2 := getTestMessage("msg2", "Test message 2", addr2, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg2.AddressID = addrID2
+	require.NoError(t, m.store.createOrUpdateMessagesEvent([]*pmapi.Message{msg1, msg2}))
+
+	uidValidity := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].UIDValidity()
+	checkInbox := func(addressID string, wantIDs []string, wantUIDs []uint32) {
+		inbox := m.store.addresses[addressID].mailboxes[pmapi.InboxLabel]
+		a.Equal(t, uidValidity, inbox.UIDValidity())
+		apiIDs, err := inbox.GetAPIIDsFromUIDRange(1, 0)
+		require.NoError(t, err)
+		a.Equal(t, wantIDs, apiIDs)
+		for i, apiID := range apiIDs {
+			uid, err := inbox.getUID(apiID)
+			require.NoError(t, err)
+			a.Equal(t, wantUIDs[i], uid)
+		}
+	}
+
+	checkInbox(addrID1, []string{"msg1", "msg2"}, []uint32{1, 2})
+	checkInbox(addrID2, []string{"msg2"}, []uint32{1})
+
+	require.NoError(t, m.store.UseCombinedMode(false))
+	checkInbox(addrID1, []string{"msg1"}, []uint32{1})
+	checkInbox(addrID2, []string{"msg2"}, []uint32{1})
+	a.False(t, m.store.addresses[addrID2].isNamespace())
+
+	require.NoError(t, m.store.UseCombinedMode(true))
+	checkInbox(addrID1, []string{"msg1", "msg2"}, []uint32{1, 3})
+	checkInbox(addrID2, []string{"msg2"}, []uint32{1})
+	a.True(t, m.store.addresses[addrID2].isNamespace())
+}
+
+func TestDisableAndEnableNamespaceAddress(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+	m.api.EXPECT().ListLabels().AnyTimes()
+	m.api.EXPECT().CountMessages("").AnyTimes()
+
+	msg2 := getTestMessage("msg2", "Test message 2", addr2, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg2.AddressID = addrID2
+	require.NoError(t, m.store.createOrUpdateMessagesEvent([]*pmapi.Message{msg2}))
+
+	primary := m.store.addresses[addrID1]
+	namespace := AddressNamespacesPrefix + addr2 + PathDelimiter
+
+	require.NoError(t, m.store.createOrUpdateAddressInfo(pmapi.AddressList{
+		{ID: addrID1, Email: addr1, Type: pmapi.OriginalAddress, Receive: pmapi.CanReceive},
+		{ID: addrID2, Email: addr2, Type: pmapi.AliasAddress, Receive: pmapi.CannotReceive},
+	}))
+	changed, err := m.store.createOrDeleteAddressesEvent()
+	require.NoError(t, err)
+	a.Equal(t, []string{addr1}, changed)
+	a.Empty(t, primary.ListNamespaces())
+	a.NotContains(t, m.store.addresses, addrID2)
+
+	require.NoError(t, m.store.createOrUpdateAddressInfo(pmapi.AddressList{
+		{ID: addrID1, Email: addr1, Type: pmapi.OriginalAddress, Receive: pmapi.CanReceive},
+		{ID: addrID2, Email: addr2, Type: pmapi.AliasAddress, Receive: pmapi.CanReceive},
+	}))
+	changed, err = m.store.createOrDeleteAddressesEvent()
+	require.NoError(t, err)
+	a.Equal(t, []string{addr1}, changed)
+	a.Equal(t, []string{namespace}, primary.ListNamespaces())
+
+	// Messages of enabled address are listed in its namespace again.
+	namespaceInbox, err := primary.GetMailbox(namespace + "INBOX")
+	require.NoError(t, err)
+	checkMailboxCounts(t, namespaceInbox, 1, 0)
+}
+
+func TestLabelEventsUpdateMailboxes(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(false)
+
+	storeAddress := m.store.addresses[addrID1]
+	folder := func(id, name string, order int) *pmapi.Label {
+		return &pmapi.Label{ID: id, Name: name, Order: order, Exclusive: 1, Type: pmapi.LabelTypeMailbox}
+	}
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(folder("workID", "Work", 2)))
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(folder("homeID", "Home", 1)))
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(&pmapi.Label{ID: "todoID", Name: "Todo", Order: 1, Type: pmapi.LabelTypeMailbox}))
+
+	listUserMailboxes := func() []string {
+		names := []string{}
+		for _, mailbox := range storeAddress.ListMailboxes() {
+			if mailbox.IsFolder() || mailbox.IsLabel() {
+				names = append(names, mailbox.Name())
+			}
+		}
+		return names
+	}
+	a.Equal(t, []string{"Folders/Home", "Folders/Work", "Labels/Todo"}, listUserMailboxes())
+	a.Equal(t, "INBOX", storeAddress.ListMailboxes()[0].Name())
+
+	// Renamed, recolored and reordered in the web app.
+	work, err := storeAddress.getMailboxByID("workID")
+	require.NoError(t, err)
+	renamed := folder("workID", "Job", 0)
+	renamed.Color = "#ff0000"
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(renamed))
+
+	a.Equal(t, []string{"Folders/Job", "Folders/Home", "Labels/Todo"}, listUserMailboxes())
+	a.Equal(t, "Folders/Job", work.Name())
+	a.Equal(t, "#ff0000", work.Color())
+	_, err = storeAddress.GetMailbox("Folders/Work")
+	a.Error(t, err)
+}
+
+func TestSwitchAddressModeWithoutAddresses(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+
+	oldAddresses := m.store.addresses
+	require.NoError(t, m.store.createOrUpdateAddressInfo(pmapi.AddressList{}))
+	m.api.EXPECT().Addresses().Return(pmapi.AddressList{})
+
+	require.Error(t, m.store.UseCombinedMode(false))
+	a.Equal(t, oldAddresses, m.store.addresses)
+	a.True(t, m.store.IsCombinedMode())
+}
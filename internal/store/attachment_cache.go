@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Attachments are cached separately from built messages, so a client which
+// fetches only some parts of message downloads only the attachments it
+// asked for and the attachments are not downloaded again when the message
+// is built later. The cache is the same kind as the message cache: files
+// are encrypted, named by keyed hash of attachment ID and the least recently
+// used ones are removed over the size limit. Metadata do not list attachments,
+// so the message of every cached attachment is kept in the database and
+// attachments of deleted messages are removed by compaction.
+
+// getAttachmentCachePath returns the directory of cached attachments next to
+// the database file.
+func getAttachmentCachePath(storePath string) string {
+	return strings.TrimSuffix(storePath, filepath.Ext(storePath)) + ".attachments"
+}
+
+// EnableAttachmentCache starts to keep decrypted and encoded attachments on
+// disk encrypted by the key derived from the secret. When the size of cache
+// exceeds maxSize bytes, the least recently fetched ones are removed.
+func (store *Store) EnableAttachmentCache(secret []byte, maxSize int64) error {
+	ac, err := newMessageCache(getAttachmentCachePath(store.filePath), secret, maxSize)
+	if err != nil {
+		return err
+	}
+
+	store.messageCacheLock.Lock()
+	defer store.messageCacheLock.Unlock()
+
+	store.attachmentCache = ac
+	return nil
+}
+
+// RemoveAttachmentCache stops caching and removes all cached attachments.
+func (store *Store) RemoveAttachmentCache() error {
+	store.messageCacheLock.Lock()
+	defer store.messageCacheLock.Unlock()
+
+	store.attachmentCache = nil
+	return os.RemoveAll(getAttachmentCachePath(store.filePath))
+}
+
+func (store *Store) getAttachmentCache() *messageCache {
+	store.messageCacheLock.RLock()
+	defer store.messageCacheLock.RUnlock()
+
+	return store.attachmentCache
+}
+
+// GetCachedAttachment returns the attachment stored by SetCachedAttachment
+// or nil if it is not cached or the cache is not enabled.
+func (store *Store) GetCachedAttachment(attachmentID string) ([]byte, error) {
+	ac := store.getAttachmentCache()
+	if ac == nil {
+		return nil, nil
+	}
+	return ac.load(attachmentID)
+}
+
+// SetCachedAttachment stores the attachment of the message on disk if the
+// cache is enabled.
+func (store *Store) SetCachedAttachment(messageID, attachmentID string, data []byte) error {
+	ac := store.getAttachmentCache()
+	if ac == nil {
+		return nil
+	}
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cachedAttsBucket).Put([]byte(attachmentID), []byte(messageID))
+	}); err != nil {
+		return err
+	}
+	return ac.save(attachmentID, data)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestAttachmentCache(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	// Nothing is cached until the cache is enabled.
+	require.NoError(t, m.store.SetCachedAttachment("msg1", "att1", []byte("data")))
+	cached, err := m.store.GetCachedAttachment("att1")
+	require.NoError(t, err)
+	a.Nil(t, cached)
+
+	require.NoError(t, m.store.EnableAttachmentCache(bytes.Repeat([]byte{1}, 32), 1000))
+	require.NoError(t, m.store.SetCachedAttachment("msg1", "att1", []byte("data")))
+	cached, err = m.store.GetCachedAttachment("att1")
+	require.NoError(t, err)
+	a.Equal(t, []byte("data"), cached)
+
+	// Attachments do not mix with cached messages.
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 1000))
+	a.False(t, m.store.getMessageCache().has("att1"))
+
+	require.NoError(t, m.store.RemoveAttachmentCache())
+	cached, err = m.store.GetCachedAttachment("att1")
+	require.NoError(t, err)
+	a.Nil(t, cached)
+	_, err = os.Stat(getAttachmentCachePath(m.store.filePath))
+	a.True(t, os.IsNotExist(err))
+}
+
+func TestCompactPrunesAttachmentCache(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	stopEventLoop(t, m)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.EnableAttachmentCache(bytes.Repeat([]byte{1}, 32), 1000))
+	require.NoError(t, m.store.SetCachedAttachment("msg1", "att1", []byte("data 1")))
+	require.NoError(t, m.store.SetCachedAttachment("msg2", "att2", []byte("data 2")))
+
+	result, err := m.store.Compact()
+	require.NoError(t, err)
+	a.Equal(t, 1, result.PrunedCachedAttachments)
+
+	cached, err := m.store.GetCachedAttachment("att1")
+	require.NoError(t, err)
+	a.Equal(t, []byte("data 1"), cached)
+	cached, err = m.store.GetCachedAttachment("att2")
+	require.NoError(t, err)
+	a.Nil(t, cached)
+
+	require.NoError(t, m.store.db.View(func(tx *bolt.Tx) error {
+		a.Nil(t, tx.Bucket(cachedAttsBucket).Get([]byte("att2")))
+		return nil
+	}))
+}
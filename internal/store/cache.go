@@ -61,6 +61,11 @@ func (c *Cache) setEventID(userID, eventID string) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	_ = c.loadCache()
+
+	if c.cache == nil {
+		c.cache = map[string]map[string]string{}
+	}
 	if c.cache[userID] == nil {
 		c.cache[userID] = map[string]string{}
 	}
@@ -48,19 +48,23 @@ func (store *Store) imapNotice(address, notice string) {
 	store.imapSendUpdate(update)
 }
 
-func (store *Store) imapUpdateMessage(address, mailboxName string, uid, sequenceNumber uint32, msg *pmapi.Message) {
+func (store *Store) imapUpdateMessage(address, mailboxName string, uid, sequenceNumber uint32, msg *pmapi.Message, deleted bool) {
+	flags := append(message.GetFlags(msg), store.GetMessageKeywords(msg)...)
+	if deleted {
+		flags = append(flags, imap.DeletedFlag)
+	}
 	store.log.WithFields(logrus.Fields{
 		"address": address,
 		"mailbox": mailboxName,
 		"seqNum":  sequenceNumber,
 		"uid":     uid,
-		"flags":   message.GetFlags(msg),
+		"flags":   flags,
 	}).Trace("IDLE update")
 	update := new(imapBackend.MessageUpdate)
 	update.Username = address
 	update.Mailbox = mailboxName
 	update.Message = imap.NewMessage(sequenceNumber, []string{imap.FlagsMsgAttr, imap.UidMsgAttr})
-	update.Message.Flags = message.GetFlags(msg)
+	update.Message.Flags = flags
 	update.Message.Uid = uid
 	store.imapSendUpdate(update)
 }
@@ -78,6 +82,23 @@ func (store *Store) imapDeleteMessage(address, mailboxName string, sequenceNumbe
 	store.imapSendUpdate(update)
 }
 
+// imapMailboxExists informs about the new number of messages in the mailbox.
+// It has to be sent before the new message is referenced by its sequence
+// number, otherwise the client does not know about it.
+func (store *Store) imapMailboxExists(address, mailboxName string, total uint32) {
+	store.log.WithFields(logrus.Fields{
+		"address": address,
+		"mailbox": mailboxName,
+		"total":   total,
+	}).Trace("IDLE exists")
+	update := new(imapBackend.MailboxUpdate)
+	update.Username = address
+	update.Mailbox = mailboxName
+	update.MailboxStatus = imap.NewMailboxStatus(mailboxName, []string{imap.MailboxMessages})
+	update.MailboxStatus.Messages = total
+	store.imapSendUpdate(update)
+}
+
 func (store *Store) imapMailboxStatus(address, mailboxName string, total, unread uint) {
 	store.log.WithFields(logrus.Fields{
 		"address": address,
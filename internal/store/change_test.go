@@ -66,6 +66,29 @@ func TestCreateOrUpdateMessageIMAPUpdatesBulkUpdate(t *testing.T) {
 	close(updates)
 }
 
+func TestCreateMessageIMAPUpdatesExistsFirst(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	updates := make(chan interface{})
+
+	m.newStoreNoEvents(true)
+	m.store.SetIMAPUpdateChannel(updates)
+
+	go checkIMAPUpdates(t, updates, []func(interface{}) bool{
+		checkMailboxExists(addr1, "All Mail", 1),
+		checkMessageUpdate(addr1, "All Mail", 1, 1),
+		checkMailboxExists(addr1, "All Mail", 2),
+		checkMessageUpdate(addr1, "All Mail", 2, 2),
+	})
+
+	msg1 := getTestMessage("msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel})
+	msg2 := getTestMessage("msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel})
+	require.Nil(t, m.store.createOrUpdateMessagesEvent([]*pmapi.Message{msg1, msg2}))
+
+	close(updates)
+}
+
 func TestDeleteMessageIMAPUpdate(t *testing.T) {
 	m, clear := initMocks(t)
 	defer clear()
@@ -127,3 +150,16 @@ func checkMessageDelete(username, mailbox string, seqNum int) func(interface{})
 		}
 	}
 }
+
+func checkMailboxExists(username, mailbox string, total int) func(interface{}) bool {
+	return func(update interface{}) bool {
+		switch u := update.(type) {
+		case *imapBackend.MailboxUpdate:
+			return (u.Update.Username == username &&
+				u.Update.Mailbox == mailbox &&
+				u.MailboxStatus.Messages == uint32(total))
+		default:
+			return false
+		}
+	}
+}
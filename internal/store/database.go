@@ -0,0 +1,148 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// storeBuckets are the buckets which every database of the store has.
+var storeBuckets = [][]byte{metadataBucket, countsBucket, addressInfoBucket, syncStateBucket, mailboxesBucket} //nolint[gochecknoglobals]
+
+// database is the bolt database of the store which can be replaced by its
+// compacted copy while the store is used. Every transaction holds the read
+// lock, so the file is replaced only when no transaction is running and
+// transactions started meanwhile wait for the new file. As with bolt itself,
+// transactions must not be nested in one goroutine.
+type database struct {
+	lock sync.RWMutex
+	db   *bolt.DB
+}
+
+func newDatabase(db *bolt.DB) *database {
+	return &database{db: db}
+}
+
+// View executes a read-only transaction, see bolt.DB.View.
+func (d *database) View(fn func(*bolt.Tx) error) error {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.db.View(fn)
+}
+
+// Update executes a read-write transaction, see bolt.DB.Update.
+func (d *database) Update(fn func(*bolt.Tx) error) error {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.db.Update(fn)
+}
+
+// Path returns the path of the database file.
+func (d *database) Path() string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.db.Path()
+}
+
+// Close closes the database file.
+func (d *database) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.db.Close()
+}
+
+// replace writes the database to a new file by write and replaces the
+// current file with it. No transaction runs meanwhile. The new file is
+// checked before the current one is closed, and when the new file cannot
+// be used, the current one is opened again, so the database stays usable.
+func (d *database) replace(write func(src *bolt.DB, dstPath string) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	path := d.db.Path()
+	tmpPath := path + ".compact"
+	if err := write(d.db, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := checkDatabase(tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "new database is not valid")
+	}
+
+	if err := d.db.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "cannot close database")
+	}
+
+	// The current file is kept until the new one is opened.
+	backupPath := path + ".backup"
+	replaceErr := os.Rename(path, backupPath)
+	if replaceErr == nil {
+		if replaceErr = os.Rename(tmpPath, path); replaceErr != nil {
+			_ = os.Rename(backupPath, path)
+		}
+	}
+	if replaceErr == nil {
+		db, err := openBoltDatabase(path)
+		if err == nil {
+			d.db = db
+			_ = os.Remove(backupPath)
+			return nil
+		}
+		replaceErr = err
+		_ = os.Remove(path)
+		_ = os.Rename(backupPath, path)
+	}
+	_ = os.Remove(tmpPath)
+
+	db, err := openBoltDatabase(path)
+	if err != nil {
+		return errors.Wrap(err, "cannot open database again")
+	}
+	d.db = db
+	return errors.Wrap(replaceErr, "cannot replace database")
+}
+
+// checkDatabase returns error when the file cannot be opened as bolt
+// database with all buckets of the store.
+func checkDatabase(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint[errcheck]
+
+	return db.View(func(tx *bolt.Tx) error {
+		for _, name := range storeBuckets {
+			if tx.Bucket(name) == nil {
+				return errors.Errorf("missing bucket %q", name)
+			}
+		}
+		return nil
+	})
+}
@@ -18,6 +18,8 @@
 package store
 
 import (
+	"math/rand"
+	"sync/atomic"
 	"time"
 
 	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
@@ -27,9 +29,45 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const pollInterval = 30 * time.Second
+const (
+	// PollDefaultInterval is the default time between polls of events.
+	PollDefaultInterval = 30 * time.Second
+	// PollMinInterval is the shortest allowed time between polls of events.
+	PollMinInterval = 10 * time.Second
+
+	// pollMaxBackoff is the longest time between polls after failed polls.
+	pollMaxBackoff = 5 * time.Minute
+
+	// idlePollInterval is used instead of pollInterval while some IMAP client
+	// is in IDLE so new messages are pushed to the client without delay.
+	idlePollInterval = 2 * time.Second
+
+	// trimInterval is how often messages which got older than sync windows
+	// of mailboxes are removed from them.
+	trimInterval = time.Hour
+
+	// verifyInterval is how often the store is cross-checked with the server.
+	verifyInterval = 6 * time.Hour
+)
+
+var pollIntervalNanos = int64(PollDefaultInterval) //nolint[gochecknoglobals]
+
+// SetPollInterval sets seconds between polls of events, used by the next
+// poll. Values under PollMinInterval are limited to it.
+func SetPollInterval(seconds int) {
+	interval := time.Duration(seconds) * time.Second
+	if interval < PollMinInterval {
+		interval = PollMinInterval
+	}
+	atomic.StoreInt64(&pollIntervalNanos, int64(interval))
+}
+
+func getPollInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&pollIntervalNanos))
+}
 
 type eventLoop struct {
+	lastPollTime   int64 // Unix nanoseconds of the last successful poll, accessed atomically.
 	cache          *Cache
 	currentEventID string
 	pollCh         chan chan struct{}
@@ -37,6 +75,8 @@ type eventLoop struct {
 	notifyStopCh   chan struct{}
 	isRunning      bool
 	hasInternet    bool
+	idleCount      int32
+	failedPolls    int
 
 	log *logrus.Entry
 
@@ -97,6 +137,20 @@ func (loop *eventLoop) pollNow() {
 	close(eventProcessedCh)
 }
 
+// startIdle makes the loop poll events with idlePollInterval till the
+// matching stopIdle is called.
+func (loop *eventLoop) startIdle() {
+	atomic.AddInt32(&loop.idleCount, 1)
+}
+
+func (loop *eventLoop) stopIdle() {
+	atomic.AddInt32(&loop.idleCount, -1)
+}
+
+func (loop *eventLoop) isIdle() bool {
+	return atomic.LoadInt32(&loop.idleCount) > 0
+}
+
 func (loop *eventLoop) stop() {
 	if loop.isRunning {
 		loop.isRunning = false
@@ -130,8 +184,17 @@ func (loop *eventLoop) start() { // nolint[funlen]
 		loop.log.WithField("lastEventID", loop.currentEventID).Info("Subscription stopped")
 	}()
 
-	t := time.NewTicker(pollInterval)
-	defer t.Stop()
+	pollTimer := time.NewTimer(getPollInterval())
+	defer pollTimer.Stop()
+
+	idleTicker := time.NewTicker(idlePollInterval)
+	defer idleTicker.Stop()
+
+	trimTicker := time.NewTicker(trimInterval)
+	defer trimTicker.Stop()
+
+	verifyTicker := time.NewTicker(verifyInterval)
+	defer verifyTicker.Stop()
 
 	loop.hasInternet = true
 
@@ -144,7 +207,20 @@ func (loop *eventLoop) start() { // nolint[funlen]
 			close(loop.notifyStopCh)
 			return
 		case eventProcessedCh = <-loop.pollCh:
-		case <-t.C:
+		case <-pollTimer.C:
+		case <-idleTicker.C:
+			// Failed polls are not repeated faster even for idle clients.
+			if !loop.isIdle() || loop.failedPolls > 0 {
+				continue
+			}
+		case <-trimTicker.C:
+			if err := loop.store.trimMailboxesToWindows(); err != nil {
+				loop.log.WithError(err).Error("Cannot trim mailboxes to sync windows")
+			}
+			continue
+		case <-verifyTicker.C:
+			loop.store.triggerVerify()
+			continue
 		}
 
 		// Before we fetch the first event, check whether this is the first time we've
@@ -182,7 +258,45 @@ func (loop *eventLoop) start() { // nolint[funlen]
 		if more {
 			go loop.pollNow()
 		}
+
+		if !pollTimer.Stop() {
+			select {
+			case <-pollTimer.C:
+			default:
+			}
+		}
+		pollTimer.Reset(loop.getNextPollDelay())
+	}
+}
+
+// getNextPollDelay returns the poll interval or, after failed polls, the
+// interval doubled by every failure up to pollMaxBackoff. Only a random part
+// of the second half of the backoff is used so clients do not retry all at
+// once when the server is available again.
+func (loop *eventLoop) getNextPollDelay() time.Duration {
+	interval := getPollInterval()
+	if loop.failedPolls == 0 {
+		return interval
+	}
+
+	backoff := interval
+	for i := 0; i < loop.failedPolls && backoff < pollMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > pollMaxBackoff {
+		backoff = pollMaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)) //nolint[gosec]
+}
+
+// getLastPollTime returns the time of the last successful poll or zero time
+// if events were not polled yet.
+func (loop *eventLoop) getLastPollTime() time.Time {
+	lastPollTime := atomic.LoadInt64(&loop.lastPollTime)
+	if lastPollTime == 0 {
+		return time.Time{}
 	}
+	return time.Unix(0, lastPollTime)
 }
 
 // isBeforeFirstStart returns whether the initial event ID was already set or not.
@@ -199,6 +313,13 @@ func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[fun
 	// We only want to consider invalid tokens as real errors because all other errors might fix themselves eventually
 	// (e.g. no internet, ulimit reached etc.)
 	defer func() {
+		if err != nil {
+			loop.failedPolls++
+		} else {
+			loop.failedPolls = 0
+			atomic.StoreInt64(&loop.lastPollTime, time.Now().UnixNano())
+		}
+
 		if errors.Cause(err) == pmapi.ErrAPINotReachable {
 			l.Warn("Internet unavailable")
 			loop.events.Emit(bridgeEvents.InternetOffEvent, "")
@@ -298,6 +419,11 @@ func (loop *eventLoop) processEvent(event *pmapi.Event) (err error) {
 		}
 	}
 
+	// User is sent whenever its status changes, e.g. the used space.
+	if event.User.MaxSpace != 0 {
+		loop.store.updateSpace(&event.User)
+	}
+
 	if len(event.Notices) != 0 {
 		loop.processNotices(eventLog, event.Notices)
 	}
@@ -334,7 +460,10 @@ func (loop *eventLoop) processAddresses(log *logrus.Entry, addressEvents []*pmap
 			email := oldAddress.Email
 			log.WithField("email", email).Debug("Address was updated")
 			if addressEvent.Address.Receive != oldAddress.Receive {
-				loop.events.Emit(bridgeEvents.AddressChangedLogoutEvent, email)
+				if addressEvent.Address.Receive != pmapi.CanReceive {
+					loop.user.CloseConnection(email)
+				}
+				loop.events.Emit(bridgeEvents.AddressChangedEvent, email)
 			}
 
 		case pmapi.EventDelete:
@@ -347,7 +476,7 @@ func (loop *eventLoop) processAddresses(log *logrus.Entry, addressEvents []*pmap
 			email := oldAddress.Email
 			log.WithField("email", email).Debug("Address was deleted")
 			loop.user.CloseConnection(email)
-			loop.events.Emit(bridgeEvents.AddressChangedLogoutEvent, email)
+			loop.events.Emit(bridgeEvents.AddressChangedEvent, email)
 		}
 	}
 
@@ -355,10 +484,19 @@ func (loop *eventLoop) processAddresses(log *logrus.Entry, addressEvents []*pmap
 		return errors.Wrap(err, "failed to update address IDs in store")
 	}
 
-	if err = loop.store.createOrDeleteAddressesEvent(); err != nil {
+	changed, err := loop.store.createOrDeleteAddressesEvent()
+	if err != nil {
 		return errors.Wrap(err, "failed to create/delete store addresses")
 	}
 
+	// Clients load namespaces only after they connect. Connections of login
+	// addresses with added or removed namespaces are closed to make clients
+	// reload the list of mailboxes.
+	for _, address := range changed {
+		log.WithField("email", address).Debug("Closing connections to reload namespaces")
+		loop.user.CloseConnection(address)
+	}
+
 	return nil
 }
 
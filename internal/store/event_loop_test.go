@@ -64,12 +64,43 @@ func TestEventLoopProcessMoreEvents(t *testing.T) {
 	}, time.Second, 10*time.Millisecond)
 
 	// For normal event we need to wait to next polling.
-	time.Sleep(pollInterval)
+	time.Sleep(getPollInterval())
 	require.Eventually(t, func() bool {
 		return m.store.eventLoop.currentEventID == "event71"
 	}, time.Second, 10*time.Millisecond)
 }
 
+func TestEventLoopPollsFasterWhileIdle(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	gomock.InOrder(
+		m.api.EXPECT().GetEvent("latestEventID").Return(&pmapi.Event{
+			EventID: "event50",
+			More:    0,
+		}, nil),
+		m.api.EXPECT().GetEvent("event50").Return(&pmapi.Event{
+			EventID: "event51",
+			More:    0,
+		}, nil),
+	)
+	m.newStoreNoEvents(true)
+	m.api.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+
+	go m.store.eventLoop.start()
+
+	require.Eventually(t, func() bool {
+		return m.cache.getEventID("userID") == "event50"
+	}, time.Second, 10*time.Millisecond)
+
+	// Next event is polled well before poll interval while client is idle.
+	m.store.StartIdle()
+	defer m.store.StopIdle()
+	require.Eventually(t, func() bool {
+		return m.cache.getEventID("userID") == "event51"
+	}, 2*idlePollInterval, 10*time.Millisecond)
+}
+
 func TestEventLoopUpdateMessageFromLoop(t *testing.T) {
 	m, clear := initMocks(t)
 	defer clear()
@@ -151,3 +182,32 @@ func TestEventLoopUpdateMessage(t *testing.T) {
 
 	require.Equal(t, newMsg, msg)
 }
+
+func TestEventLoopBacksOffAfterFailedPolls(t *testing.T) {
+	loop := &eventLoop{}
+	interval := getPollInterval()
+
+	require.Equal(t, interval, loop.getNextPollDelay())
+
+	loop.failedPolls = 1
+	for i := 0; i < 10; i++ {
+		delay := loop.getNextPollDelay()
+		require.True(t, delay >= interval && delay <= 2*interval, delay)
+	}
+
+	loop.failedPolls = 100
+	for i := 0; i < 10; i++ {
+		delay := loop.getNextPollDelay()
+		require.True(t, delay >= pollMaxBackoff/2 && delay <= pollMaxBackoff, delay)
+	}
+}
+
+func TestSetPollInterval(t *testing.T) {
+	defer SetPollInterval(int(PollDefaultInterval / time.Second))
+
+	SetPollInterval(120)
+	require.Equal(t, 2*time.Minute, getPollInterval())
+
+	SetPollInterval(1)
+	require.Equal(t, PollMinInterval, getPollInterval())
+}
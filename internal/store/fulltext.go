@@ -0,0 +1,432 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	fullTextVersion = 2
+
+	fullTextBodyPrefix   = "body:"
+	fullTextHeaderPrefix = "header:"
+
+	// fullTextTokenSize is the length of tokens in runes. Words are indexed
+	// by all their substrings of this length, shorter words as whole.
+	fullTextTokenSize = 3
+
+	// fullTextKeyInfo binds the derived key to its use.
+	fullTextKeyInfo = "proton-bridge full-text index"
+)
+
+//nolint[gochecknoglobals]
+var (
+	// fullTextSaltKey in fullTextBucket is the random salt of key derivation.
+	fullTextSaltKey = []byte("salt")
+
+	// fullTextCheckKey in fullTextBucket is keyed hash of its name to check
+	// the index was written with the same key.
+	fullTextCheckKey = []byte("check")
+)
+
+// ErrNotIndexed when full-text index is disabled or not complete yet.
+var ErrNotIndexed = errors.New("messages are not indexed") //nolint[gochecknoglobals]
+
+// fullTextIndex holds the state of the running indexer. Tokens of words are
+// stored only as keyed hashes so the index does not reveal message content
+// without the key.
+type fullTextIndex struct {
+	key    []byte
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func (ft *fullTextIndex) hash(prefix, word string) []byte {
+	mac := hmac.New(sha256.New, ft.key)
+	_, _ = mac.Write([]byte(prefix + word))
+	return mac.Sum(nil)
+}
+
+func (ft *fullTextIndex) hashTokens(prefix string, tokens []string) (hashes [][]byte) {
+	for _, token := range tokens {
+		hashes = append(hashes, ft.hash(prefix, token))
+	}
+	return
+}
+
+// fullTextWords returns lower-cased words of the text.
+func fullTextWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// wordTokens returns substrings of the word of fullTextTokenSize runes,
+// or the word itself if it is shorter.
+func wordTokens(word string) []string {
+	runes := []rune(word)
+	if len(runes) < fullTextTokenSize {
+		return []string{word}
+	}
+	tokens := make([]string, 0, len(runes)-fullTextTokenSize+1)
+	for i := 0; i+fullTextTokenSize <= len(runes); i++ {
+		tokens = append(tokens, string(runes[i:i+fullTextTokenSize]))
+	}
+	return tokens
+}
+
+// fullTextTokens returns unique tokens of all words of the text.
+func fullTextTokens(text string) (tokens []string) {
+	seen := map[string]bool{}
+	for _, word := range fullTextWords(text) {
+		for _, token := range wordTokens(word) {
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return
+}
+
+// fullTextQueryTokens returns tokens which every text containing the query
+// as a substring has. The first and the last word of the query can be parts
+// of longer words, so they are used only when they are not shorter than
+// tokens. No tokens are returned when the index cannot narrow the search.
+func fullTextQueryTokens(query string) (tokens []string) {
+	words := fullTextWords(query)
+	for i, word := range words {
+		isWhole := i > 0 && i < len(words)-1
+		if !isWhole && len([]rune(word)) < fullTextTokenSize {
+			continue
+		}
+		tokens = append(tokens, wordTokens(word)...)
+	}
+	return
+}
+
+// EnableFullTextIndex starts indexing of all messages in the background.
+// Message bodies are downloaded and decrypted once, new messages are indexed
+// as they come from sync or events. The key of the index is derived from
+// the secret, and the index is built again when the secret changed.
+func (store *Store) EnableFullTextIndex(secret []byte) error {
+	if store.getFullTextIndex() != nil {
+		return nil
+	}
+
+	var key []byte
+	err := store.db.Update(func(tx *bolt.Tx) (err error) {
+		key, err = txDeriveFullTextKey(tx, secret)
+		return
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot derive full-text index key")
+	}
+
+	store.startFullTextIndex(key)
+	return nil
+}
+
+// txDeriveFullTextKey returns the key derived from the secret and the salt
+// stored with the index. When the index was written with a different key,
+// it cannot be searched, so it is removed to be built again.
+func txDeriveFullTextKey(tx *bolt.Tx, secret []byte) ([]byte, error) {
+	b := tx.Bucket(fullTextBucket)
+
+	salt := b.Get(fullTextSaltKey)
+	if len(salt) != saltSize {
+		var err error
+		if salt, err = newSalt(); err != nil {
+			return nil, err
+		}
+		if err := b.Put(fullTextSaltKey, salt); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := deriveKey(secret, salt, fullTextKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	check := (&fullTextIndex{key: key}).hash("", string(fullTextCheckKey))
+	if hmac.Equal(b.Get(fullTextCheckKey), check) {
+		return key, nil
+	}
+	for _, name := range [][]byte{fullTextTokensBucket, fullTextMessagesBucket} {
+		if err := b.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return nil, err
+		}
+		if _, err := b.CreateBucket(name); err != nil {
+			return nil, err
+		}
+	}
+	return key, b.Put(fullTextCheckKey, check)
+}
+
+// startFullTextIndex starts the indexer with already derived key.
+func (store *Store) startFullTextIndex(key []byte) {
+	store.fullTextLock.Lock()
+	defer store.fullTextLock.Unlock()
+
+	if store.fullText != nil {
+		return
+	}
+	ft := &fullTextIndex{
+		key:    key,
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	store.fullText = ft
+
+	go func() {
+		defer store.panicHandler.HandlePanic()
+		store.runFullTextIndexer(ft)
+	}()
+}
+
+func (store *Store) getFullTextIndex() *fullTextIndex {
+	store.fullTextLock.Lock()
+	defer store.fullTextLock.Unlock()
+
+	return store.fullText
+}
+
+// stopFullTextIndex stops the indexer and waits until it finishes.
+func (store *Store) stopFullTextIndex() {
+	store.fullTextLock.Lock()
+	ft := store.fullText
+	store.fullText = nil
+	store.fullTextLock.Unlock()
+
+	if ft != nil {
+		close(ft.stop)
+		<-ft.done
+	}
+}
+
+// notifyFullTextIndex wakes up the indexer to index new messages.
+func (store *Store) notifyFullTextIndex() {
+	if ft := store.getFullTextIndex(); ft != nil {
+		select {
+		case ft.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (store *Store) runFullTextIndexer(ft *fullTextIndex) {
+	defer close(ft.done)
+
+	for {
+		store.indexPendingMessages(ft)
+
+		select {
+		case <-ft.notify:
+		case <-ft.stop:
+			return
+		}
+	}
+}
+
+func (store *Store) indexPendingMessages(ft *fullTextIndex) {
+	var pending []string
+	err := store.db.View(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket)
+		return tx.Bucket(metadataBucket).ForEach(func(apiID, _ []byte) error {
+			if !isFullTextIndexed(indexed.Get(apiID)) {
+				pending = append(pending, string(apiID))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Cannot list messages to index")
+		return
+	}
+
+	for _, apiID := range pending {
+		select {
+		case <-ft.stop:
+			return
+		default:
+		}
+
+		// Indexing is tried again with the next notification.
+		if err := store.indexMessage(ft, apiID); err != nil {
+			store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot index message")
+			return
+		}
+	}
+}
+
+func (store *Store) indexMessage(ft *fullTextIndex, apiID string) error {
+	msg, err := store.fetchMessage(apiID)
+	if err == ErrNoSuchAPIID {
+		// Message was deleted meanwhile and it will be removed by an event.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Message which cannot be decrypted is indexed without body
+	// to not download it again and again.
+	var body string
+	if err := msg.Decrypt(store.api.KeyRingForAddressID(msg.AddressID)); err != nil {
+		store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot decrypt message to index")
+	} else {
+		body = getBodyText(msg)
+	}
+
+	hashes := append(ft.hashTokens(fullTextBodyPrefix, fullTextTokens(body)), ft.hashTokens(fullTextHeaderPrefix, fullTextTokens(getHeaderText(msg)))...)
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return txIndexMessage(tx, apiID, hashes)
+	})
+}
+
+// isFullTextIndexed returns whether the value of message in the index was
+// written by the current version. Older versions are indexed again.
+func isFullTextIndexed(value []byte) bool {
+	return len(value) > 0 && value[0] == fullTextVersion
+}
+
+func txIndexMessage(tx *bolt.Tx, apiID string, hashes [][]byte) error {
+	if err := txRemoveFullText(tx, apiID); err != nil {
+		return err
+	}
+
+	tokens := tx.Bucket(fullTextBucket).Bucket(fullTextTokensBucket)
+	for _, hash := range hashes {
+		postings, err := tokens.CreateBucketIfNotExists(hash)
+		if err != nil {
+			return errors.Wrap(err, "cannot create token bucket")
+		}
+		if err := postings.Put([]byte(apiID), []byte{}); err != nil {
+			return errors.Wrap(err, "cannot add message to token")
+		}
+	}
+
+	value := append([]byte{fullTextVersion}, bytes.Join(hashes, nil)...)
+	return tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket).Put([]byte(apiID), value)
+}
+
+// txRemoveFullText removes the message from the index, including tokens
+// which are not used by any other message.
+func txRemoveFullText(tx *bolt.Tx, apiID string) error {
+	messages := tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket)
+	value := messages.Get([]byte(apiID))
+	if value == nil {
+		return nil
+	}
+	hashes := make([]byte, len(value)-1)
+	copy(hashes, value[1:])
+
+	tokens := tx.Bucket(fullTextBucket).Bucket(fullTextTokensBucket)
+	for len(hashes) >= sha256.Size {
+		hash := hashes[:sha256.Size]
+		hashes = hashes[sha256.Size:]
+
+		postings := tokens.Bucket(hash)
+		if postings == nil {
+			continue
+		}
+		if err := postings.Delete([]byte(apiID)); err != nil {
+			return err
+		}
+		if key, _ := postings.Cursor().First(); key == nil {
+			if err := tokens.DeleteBucket(hash); err != nil {
+				return err
+			}
+		}
+	}
+
+	return messages.Delete([]byte(apiID))
+}
+
+// searchFullText returns those apiIDs which may contain the text as a
+// substring. Tokens are searched in the body, or also in the subject and
+// addresses if bodyOnly is false. Tokens do not keep positions of words,
+// so matched messages have to be checked by their bodies, but only those.
+// ErrNotIndexed is returned if any of the messages is not indexed yet or
+// the text is too short to be searched by tokens.
+func (store *Store) searchFullText(apiIDs []string, text string, bodyOnly bool) (matched []string, err error) {
+	ft := store.getFullTextIndex()
+	if ft == nil {
+		return nil, ErrNotIndexed
+	}
+
+	tokens := fullTextQueryTokens(text)
+	if len(tokens) == 0 {
+		return nil, ErrNotIndexed
+	}
+	err = store.db.View(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket)
+		postingsOf := func(prefix string) (postings []*bolt.Bucket) {
+			for _, token := range tokens {
+				postings = append(postings, tx.Bucket(fullTextBucket).Bucket(fullTextTokensBucket).Bucket(ft.hash(prefix, token)))
+			}
+			return
+		}
+		bodyPostings := postingsOf(fullTextBodyPrefix)
+		headerPostings := postingsOf(fullTextHeaderPrefix)
+
+		for _, apiID := range apiIDs {
+			if !isFullTextIndexed(indexed.Get([]byte(apiID))) {
+				return ErrNotIndexed
+			}
+			isMatching := true
+			for i := range tokens {
+				if !hasPosting(bodyPostings[i], apiID) && (bodyOnly || !hasPosting(headerPostings[i], apiID)) {
+					isMatching = false
+					break
+				}
+			}
+			if isMatching {
+				matched = append(matched, apiID)
+			}
+		}
+		return nil
+	})
+	return matched, err
+}
+
+func hasPosting(postings *bolt.Bucket, apiID string) bool {
+	return postings != nil && postings.Get([]byte(apiID)) != nil
+}
+
+// SearchFullText returns API IDs of messages in the mailbox which may
+// contain the text using the local full-text index. See searchFullText.
+func (storeMailbox *Mailbox) SearchFullText(text string, bodyOnly bool) ([]string, error) {
+	apiIDs, err := storeMailbox.GetAPIIDsFromSequenceRange(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return storeMailbox.store.searchFullText(apiIDs, text, bodyOnly)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestFullTextTokens(t *testing.T) {
+	a.Equal(t, []string{"hel", "ell", "llo", "wor", "orl", "rld", "ünï", "42"}, fullTextTokens("Hello, world! HELLO ünï-42"))
+	a.Nil(t, fullTextTokens(" ... "))
+}
+
+func TestFullTextQueryTokens(t *testing.T) {
+	a.Equal(t, []string{"ell"}, fullTextQueryTokens("ELL"))
+	a.Equal(t, []string{"llo"}, fullTextQueryTokens("llo wo"))
+	a.Equal(t, []string{"ab", "xyz"}, fullTextQueryTokens("c ab xyz"))
+	a.Equal(t, []string{"abc", "de"}, fullTextQueryTokens("abc de f"))
+	a.Nil(t, fullTextQueryTokens("ab"))
+	a.Nil(t, fullTextQueryTokens("a, b"))
+}
+
+func TestSearchFullText(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Subject one", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Subject two", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Subject three", addrID1, 0, []string{pmapi.AllMailLabel})
+
+	_, err := m.store.searchFullText([]string{"msg1"}, "hello", true)
+	a.Equal(t, ErrNotIndexed, err)
+
+	ft := &fullTextIndex{key: []byte("key")}
+	m.store.fullText = ft
+	index := func(apiID, body, header string) {
+		hashes := append(ft.hashTokens(fullTextBodyPrefix, fullTextTokens(body)), ft.hashTokens(fullTextHeaderPrefix, fullTextTokens(header))...)
+		require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+			return txIndexMessage(tx, apiID, hashes)
+		}))
+	}
+	index("msg1", "Hello World", "Subject one")
+	index("msg2", "hello there", "Subject two")
+
+	tests := []struct {
+		text     string
+		bodyOnly bool
+		want     []string
+	}{
+		{"hello", true, []string{"msg1", "msg2"}},
+		{"WORLD hello", true, []string{"msg1"}},
+		{"hell", true, []string{"msg1", "msg2"}},
+		{"lo wor", true, []string{"msg1"}},
+		{"orl", true, []string{"msg1"}},
+		{"subject", true, nil},
+		{"subject hello", false, []string{"msg1", "msg2"}},
+		{"one world", false, []string{"msg1"}},
+	}
+	for _, test := range tests {
+		matched, err := m.store.searchFullText([]string{"msg1", "msg2"}, test.text, test.bodyOnly)
+		require.NoError(t, err)
+		a.Equal(t, test.want, matched, test.text)
+	}
+
+	// Texts without tokens are searched in bodies.
+	_, err = m.store.searchFullText([]string{"msg1", "msg2"}, "lo", true)
+	a.Equal(t, ErrNotIndexed, err)
+
+	matched, err := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].SearchFullText("there", true)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg2"}, matched)
+
+	_, err = m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel].SearchFullText("there", true)
+	a.Equal(t, ErrNotIndexed, err)
+
+	// Deleted message is removed from the index including its unique words.
+	require.NoError(t, m.store.deleteMessageEvent("msg1"))
+	matched, err = m.store.searchFullText([]string{"msg2"}, "hello", true)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg2"}, matched)
+	require.NoError(t, m.store.db.View(func(tx *bolt.Tx) error {
+		tokens := tx.Bucket(fullTextBucket).Bucket(fullTextTokensBucket)
+		a.Nil(t, tokens.Bucket(ft.hash(fullTextBodyPrefix, "wor")))
+		a.NotNil(t, tokens.Bucket(ft.hash(fullTextBodyPrefix, "hel")))
+		a.Nil(t, tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket).Get([]byte("msg1")))
+		return nil
+	}))
+
+	m.store.fullText = nil
+}
+
+func TestFullTextIndexer(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Subject one", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().GetMessage("msg1").Return(&pmapi.Message{
+		ID:        "msg1",
+		AddressID: addrID1,
+		Subject:   "Subject one",
+		MIMEType:  pmapi.ContentTypeHTML,
+		Body:      "<p>quick <b>brown</b> fox</p>",
+	}, nil)
+	m.api.EXPECT().KeyRingForAddressID(addrID1).Return(nil)
+
+	require.NoError(t, m.store.EnableFullTextIndex([]byte("secret")))
+
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	var matched []string
+	require.Eventually(t, func() bool {
+		var err error
+		matched, err = storeMailbox.SearchFullText("brown fox", true)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	a.Equal(t, []string{"msg1"}, matched)
+}
+
+func TestFullTextIndexRebuiltWithOtherSecret(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	var key []byte
+	deriveKey := func(secret string) {
+		require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) (err error) {
+			key, err = txDeriveFullTextKey(tx, []byte(secret))
+			return
+		}))
+	}
+	isIndexed := func() (indexed bool) {
+		require.NoError(t, m.store.db.View(func(tx *bolt.Tx) error {
+			indexed = tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket).Get([]byte("msg1")) != nil
+			return nil
+		}))
+		return
+	}
+
+	deriveKey("secret")
+	firstKey := key
+	a.NotEqual(t, []byte("secret"), firstKey)
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return txIndexMessage(tx, "msg1", [][]byte{(&fullTextIndex{key: key}).hash(fullTextBodyPrefix, "hel")})
+	}))
+
+	deriveKey("secret")
+	a.Equal(t, firstKey, key)
+	a.True(t, isIndexed())
+
+	deriveKey("other")
+	a.NotEqual(t, firstKey, key)
+	a.False(t, isIndexed())
+}
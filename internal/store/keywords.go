@@ -0,0 +1,204 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// LoadKeywords reads the mapping of IMAP keywords to label names from file
+// at path. The file is a JSON object, e.g. {"$Work": "Work"}, where values
+// are names of labels without the Labels/ prefix. It is not an error when
+// the file does not exist; no keyword is mapped in that case.
+func LoadKeywords(path string) (map[string]string, error) {
+	f, err := os.Open(path) //nolint[gosec]
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	keywords := map[string]string{}
+	if err := json.NewDecoder(f).Decode(&keywords); err != nil {
+		return nil, errors.Wrap(err, "cannot parse keywords")
+	}
+	for keyword, labelName := range keywords {
+		if keyword == "" || strings.HasPrefix(keyword, "\\") || labelName == "" || strings.Contains(labelName, PathDelimiter) {
+			return nil, errors.Errorf("invalid keyword mapping %q: %q", keyword, labelName)
+		}
+	}
+	return keywords, nil
+}
+
+// SetKeywords sets the mapping of IMAP keywords to label names. Messages
+// with the label have the keyword and setting the keyword labels messages.
+func (store *Store) SetKeywords(keywords map[string]string) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	store.keywordsLock.Lock()
+	store.keywords = map[string]string{}
+	for keyword, labelName := range keywords {
+		store.keywords[keyword] = UserLabelsPrefix + labelName
+	}
+	store.keywordsLock.Unlock()
+
+	store.updateKeywordLabels()
+}
+
+// updateKeywordLabels refreshes IDs of labels mapped to keywords.
+// Store lock must be held by the caller.
+func (store *Store) updateKeywordLabels() {
+	store.keywordsLock.Lock()
+	defer store.keywordsLock.Unlock()
+
+	store.keywordLabelIDs = map[string]string{}
+	if len(store.keywords) == 0 {
+		return
+	}
+	for _, a := range store.addresses {
+		for _, m := range a.mailboxes {
+			for keyword, labelName := range store.keywords {
+				if m.labelName == labelName {
+					store.keywordLabelIDs[m.labelID] = keyword
+				}
+			}
+		}
+	}
+}
+
+// ListKeywords returns all mapped keywords.
+func (store *Store) ListKeywords() []string {
+	store.keywordsLock.RLock()
+	defer store.keywordsLock.RUnlock()
+
+	keywords := []string{}
+	for keyword := range store.keywords {
+		keywords = append(keywords, keyword)
+	}
+	return keywords
+}
+
+// GetMessageKeywords returns keywords of labels of the message.
+func (store *Store) GetMessageKeywords(msg *pmapi.Message) []string {
+	store.keywordsLock.RLock()
+	defer store.keywordsLock.RUnlock()
+
+	keywords := []string{}
+	for _, labelID := range msg.LabelIDs {
+		if keyword, ok := store.keywordLabelIDs[labelID]; ok {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+// GetKeywordLabelID returns ID of label mapped to the keyword. The ID is
+// empty when the keyword is mapped but the label does not exist yet.
+// Keywords are matched case-insensitively.
+func (store *Store) GetKeywordLabelID(keyword string) (labelID string, isMapped bool) {
+	store.keywordsLock.RLock()
+	defer store.keywordsLock.RUnlock()
+
+	keyword, isMapped = store.findKeyword(keyword)
+	if !isMapped {
+		return "", false
+	}
+	for labelID, k := range store.keywordLabelIDs {
+		if k == keyword {
+			return labelID, true
+		}
+	}
+	return "", true
+}
+
+// findKeyword returns keyword as it is configured.
+// Keywords lock must be held by the caller.
+func (store *Store) findKeyword(keyword string) (string, bool) {
+	for k := range store.keywords {
+		if strings.EqualFold(k, keyword) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// LabelMessagesWithKeyword adds label mapped to the keyword by calling an API.
+// The label is created when it does not exist yet.
+// The propagation is processed by the event loop.
+func (store *Store) LabelMessagesWithKeyword(apiIDs []string, keyword string) error {
+	labelID, isMapped := store.GetKeywordLabelID(keyword)
+	if !isMapped {
+		return errors.Errorf("keyword %v is not mapped to any label", keyword)
+	}
+	defer store.eventLoop.pollNow()
+
+	if labelID == "" {
+		var err error
+		if labelID, err = store.createKeywordLabel(keyword); err != nil {
+			return err
+		}
+	}
+	return store.api.LabelMessages(apiIDs, labelID)
+}
+
+// UnlabelMessagesWithKeyword removes label mapped to the keyword by calling an API.
+// The propagation is processed by the event loop.
+func (store *Store) UnlabelMessagesWithKeyword(apiIDs []string, keyword string) error {
+	labelID, isMapped := store.GetKeywordLabelID(keyword)
+	if !isMapped {
+		return errors.Errorf("keyword %v is not mapped to any label", keyword)
+	}
+	if labelID == "" {
+		return nil // No message has label which does not exist.
+	}
+	defer store.eventLoop.pollNow()
+	return store.api.UnlabelMessages(apiIDs, labelID)
+}
+
+func (store *Store) createKeywordLabel(keyword string) (string, error) {
+	store.keywordsLock.RLock()
+	keyword, _ = store.findKeyword(keyword)
+	labelName := strings.TrimPrefix(store.keywords[keyword], UserLabelsPrefix)
+	store.keywordsLock.RUnlock()
+
+	store.log.WithField("keyword", keyword).WithField("label", labelName).Info("Creating label for keyword")
+
+	label, err := store.api.CreateLabel(&pmapi.Label{
+		Name:      labelName,
+		Color:     store.leastUsedColor(),
+		Exclusive: 0,
+		Type:      pmapi.LabelTypeMailbox,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create label for keyword")
+	}
+
+	store.keywordsLock.Lock()
+	store.keywordLabelIDs[label.ID] = keyword
+	store.keywordsLock.Unlock()
+
+	return label.ID, nil
+}
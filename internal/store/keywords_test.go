@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadKeywords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keywords-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+	path := filepath.Join(dir, "keywords.json")
+
+	keywords, err := LoadKeywords(path)
+	require.NoError(t, err)
+	a.Empty(t, keywords)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"$Work": "Work", "$Todo": "To do"}`), 0600))
+	keywords, err = LoadKeywords(path)
+	require.NoError(t, err)
+	a.Equal(t, map[string]string{"$Work": "Work", "$Todo": "To do"}, keywords)
+
+	for _, content := range []string{`["$Work"]`, `{"$Work": "Labels/Work"}`, `{"\\Seen": "Seen"}`, `{"$Work": ""}`} {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		_, err = LoadKeywords(path)
+		a.Error(t, err, content)
+	}
+}
+
+func TestMessageKeywords(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	m.store.SetKeywords(map[string]string{"$Work": "Work", "$Todo": "Todo"})
+
+	labelID, isMapped := m.store.GetKeywordLabelID("$work")
+	a.True(t, isMapped)
+	a.Equal(t, "", labelID)
+
+	require.NoError(t, m.store.createOrUpdateMailboxEvent(&pmapi.Label{ID: "workID", Name: "Work", Type: pmapi.LabelTypeMailbox}))
+
+	labelID, isMapped = m.store.GetKeywordLabelID("$work")
+	a.True(t, isMapped)
+	a.Equal(t, "workID", labelID)
+
+	_, isMapped = m.store.GetKeywordLabelID("$Other")
+	a.False(t, isMapped)
+
+	a.ElementsMatch(t, []string{"$Work", "$Todo"}, m.store.ListKeywords())
+	a.Equal(t, []string{"$Work"}, m.store.GetMessageKeywords(&pmapi.Message{LabelIDs: []string{pmapi.InboxLabel, "workID"}}))
+	a.Equal(t, []string{}, m.store.GetMessageKeywords(&pmapi.Message{LabelIDs: []string{pmapi.InboxLabel}}))
+
+	require.NoError(t, m.store.deleteMailboxEvent("workID"))
+	a.Equal(t, []string{}, m.store.GetMessageKeywords(&pmapi.Message{LabelIDs: []string{"workID"}}))
+}
+
+func TestLabelMessagesWithKeyword(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	m.store.SetKeywords(map[string]string{"$Todo": "Todo"})
+
+	m.api.EXPECT().CreateLabel(gomock.Any()).DoAndReturn(func(label *pmapi.Label) (*pmapi.Label, error) {
+		a.Equal(t, "Todo", label.Name)
+		a.Equal(t, 0, label.Exclusive)
+		return &pmapi.Label{ID: "todoID", Name: "Todo"}, nil
+	})
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, "todoID")
+	require.NoError(t, m.store.LabelMessagesWithKeyword([]string{"msg1"}, "$TODO"))
+	a.Equal(t, []string{"$Todo"}, m.store.GetMessageKeywords(&pmapi.Message{LabelIDs: []string{"todoID"}}))
+
+	m.api.EXPECT().UnlabelMessages([]string{"msg1"}, "todoID")
+	require.NoError(t, m.store.UnlabelMessagesWithKeyword([]string{"msg1"}, "$Todo"))
+
+	a.Error(t, m.store.LabelMessagesWithKeyword([]string{"msg1"}, "$Other"))
+}
@@ -34,31 +34,46 @@ type Mailbox struct {
 
 	labelID     string
 	labelPrefix string
-	labelName   string
+	labelName   string // IMAP name with prefix and names of parent folders.
+	name        string // Name of the label without parent folders.
+	parentID    string
 	color       string
+	order       int
+
+	// search is the query of virtual mailbox listing messages matching it
+	// (Unread, Starred or saved search), nil otherwise.
+	search *SavedSearch
 
 	log *logrus.Entry
 }
 
-func newMailbox(storeAddress *Address, labelID, labelPrefix, labelName, color string) (mb *Mailbox, err error) {
+func newMailbox(storeAddress *Address, label *pmapi.Label) (mb *Mailbox, err error) {
 	_ = storeAddress.store.db.Update(func(tx *bolt.Tx) error {
-		mb, err = txNewMailbox(tx, storeAddress, labelID, labelPrefix, labelName, color)
+		mb, err = txNewMailbox(tx, storeAddress, label)
 		return err
 	})
 	return
 }
 
-func txNewMailbox(tx *bolt.Tx, storeAddress *Address, labelID, labelPrefix, labelName, color string) (*Mailbox, error) {
-	l := log.WithField("addrID", storeAddress.addressID).WithField("labelID", labelID)
+// txNewMailbox creates the mailbox for the label. The IMAP name of folders
+// contains names of parent folders, see Address.updateMailboxNames.
+func txNewMailbox(tx *bolt.Tx, storeAddress *Address, label *pmapi.Label) (*Mailbox, error) {
+	l := log.WithField("addrID", storeAddress.addressID).WithField("labelID", label.ID)
+	labelPrefix := getLabelPrefix(label)
 	mb := &Mailbox{
 		store:        storeAddress.store,
 		storeAddress: storeAddress,
-		labelID:      labelID,
+		labelID:      label.ID,
 		labelPrefix:  labelPrefix,
-		labelName:    labelPrefix + labelName,
-		color:        color,
+		labelName:    labelPrefix + label.Name,
+		name:         label.Name,
+		color:        label.Color,
+		order:        label.Order,
 		log:          l,
 	}
+	if mb.IsFolder() {
+		mb.parentID = label.ParentID
+	}
 
 	err := initMailboxBucket(tx, mb.getBucketName())
 	if err != nil {
@@ -142,8 +157,17 @@ func initMailboxBucket(tx *bolt.Tx, bucketName []byte) error {
 	if _, err := bucket.CreateBucketIfNotExists(apiIDsBucket); err != nil {
 		return err
 	}
+	if _, err := bucket.CreateBucketIfNotExists(modSeqsBucket); err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucketIfNotExists(expungedBucket); err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucketIfNotExists(deletedIDsBucket); err != nil {
+		return err
+	}
 
-	return nil
+	return txRestoreSequences(tx, bucket, bucketName)
 }
 
 // LabelID returns ID of mailbox.
@@ -156,6 +180,11 @@ func (storeMailbox *Mailbox) Name() string {
 	return storeMailbox.labelName
 }
 
+// Address returns the store address which the mailbox belongs to.
+func (storeMailbox *Mailbox) Address() *Address {
+	return storeMailbox.storeAddress
+}
+
 // Color returns the color of mailbox.
 func (storeMailbox *Mailbox) Color() string {
 	return storeMailbox.color
@@ -181,37 +210,106 @@ func (storeMailbox *Mailbox) IsSystem() bool {
 	return storeMailbox.labelPrefix == ""
 }
 
+// IsSavedSearch returns whether the mailbox lists messages matching saved
+// search (has "Searches/" prefix).
+func (storeMailbox *Mailbox) IsSavedSearch() bool {
+	return storeMailbox.labelPrefix == SavedSearchesPrefix
+}
+
+// IsSearch returns whether the mailbox lists messages matching a query
+// (Unread, Starred or saved search) instead of a label.
+func (storeMailbox *Mailbox) IsSearch() bool {
+	return storeMailbox.search != nil
+}
+
+// IsVirtual returns whether the mailbox only shows messages of other
+// mailboxes (All Mail, All Sent, All Drafts and searches). Messages cannot
+// be added to virtual mailbox and removed from it.
+func (storeMailbox *Mailbox) IsVirtual() bool {
+	switch storeMailbox.labelID {
+	case pmapi.AllMailLabel, pmapi.AllSentLabel, pmapi.AllDraftsLabel:
+		return true
+	}
+	return storeMailbox.IsSearch()
+}
+
+// IsReadOnly returns whether the mailbox is always selected read-only.
+// Flags of messages in saved search would change whether they match.
+func (storeMailbox *Mailbox) IsReadOnly() bool {
+	return storeMailbox.IsSavedSearch()
+}
+
+// CanDeleteMessages returns whether messages flagged as \Deleted are removed
+// from the mailbox. Virtual mailbox can delete messages only with delete
+// action set.
+func (storeMailbox *Mailbox) CanDeleteMessages() bool {
+	if storeMailbox.IsReadOnly() {
+		return false
+	}
+	if !storeMailbox.IsVirtual() {
+		return true
+	}
+	return storeMailbox.store.GetDeleteAction(storeMailbox.labelID) != DeleteActionDefault
+}
+
 // Rename updates the mailbox by calling an API.
 // Change has to be propagated to all the same mailboxes in all addresses.
 // The propagation is processed by the event loop.
+// Renamed folder can be moved to other parent folder together with its
+// subfolders. Missing parent folders are created.
 func (storeMailbox *Mailbox) Rename(newName string) error {
 	if storeMailbox.IsSystem() {
 		return fmt.Errorf("cannot rename system mailboxes")
 	}
+	if storeMailbox.IsSavedSearch() {
+		return fmt.Errorf("cannot rename saved searches")
+	}
+
+	// Folders and labels are shared by all addresses, namespace is not
+	// part of their names.
+	namespace := storeMailbox.storeAddress.namespace
+	if !strings.HasPrefix(newName, namespace) {
+		return fmt.Errorf("cannot move mailbox to other namespace")
+	}
+	newName = strings.TrimPrefix(newName, namespace)
 
 	if storeMailbox.IsFolder() {
 		if !strings.HasPrefix(newName, UserFoldersPrefix) {
 			return fmt.Errorf("cannot rename folder to non-folder")
 		}
 
-		newName = strings.TrimPrefix(newName, UserFoldersPrefix)
-	}
+		if strings.HasPrefix(newName, strings.TrimPrefix(storeMailbox.labelName, namespace)+PathDelimiter) {
+			return fmt.Errorf("cannot move folder to its subfolder")
+		}
 
-	if storeMailbox.IsLabel() {
-		if !strings.HasPrefix(newName, UserLabelsPrefix) {
-			return fmt.Errorf("cannot rename label to non-label")
+		parentPath, name := splitFolderPath(strings.TrimPrefix(newName, UserFoldersPrefix))
+		parentID, err := storeMailbox.store.getOrCreateFolder(parentPath)
+		if err != nil {
+			return err
 		}
 
-		newName = strings.TrimPrefix(newName, UserLabelsPrefix)
+		return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, name, parentID, storeMailbox.color)
+	}
+
+	if !strings.HasPrefix(newName, UserLabelsPrefix) {
+		return fmt.Errorf("cannot rename label to non-label")
 	}
 
-	return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, newName, storeMailbox.color)
+	newName = strings.TrimPrefix(newName, UserLabelsPrefix)
+
+	return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, newName, "", storeMailbox.color)
 }
 
 // Delete deletes the mailbox by calling an API.
 // Deletion has to be propagated to all the same mailboxes in all addresses.
 // The propagation is processed by the event loop.
 func (storeMailbox *Mailbox) Delete() error {
+	if storeMailbox.IsSavedSearch() {
+		return fmt.Errorf("saved searches are removed in settings")
+	}
+	if storeMailbox.IsSearch() {
+		return fmt.Errorf("cannot delete virtual mailboxes")
+	}
 	return storeMailbox.storeAddress.deleteMailbox(storeMailbox.labelID)
 }
 
@@ -263,6 +361,6 @@ func (storeMailbox *Mailbox) api() PMAPIProvider {
 }
 
 // update is a proxy for the store's db's `Update`.
-func (storeMailbox *Mailbox) db() *bolt.DB {
+func (storeMailbox *Mailbox) db() *database {
 	return storeMailbox.store.db
 }
@@ -27,16 +27,77 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
+// Keys of the message counts bucket of mailbox.
+var (
+	totalCountKey  = []byte("total")  //nolint[gochecknoglobals]
+	unreadCountKey = []byte("unread") //nolint[gochecknoglobals]
+)
+
 // GetCounts returns numbers of total and unread messages in this mailbox bucket.
+// The numbers are updated with every change of the mailbox, messages are
+// counted only once for mailboxes stored before the numbers were kept.
 func (storeMailbox *Mailbox) GetCounts() (total, unread uint, err error) {
+	isCounted := false
 	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		isCounted = storeMailbox.txGetCountsBucket(tx) != nil
+		total, unread, err = storeMailbox.txGetCounts(tx)
+		return err
+	})
+	if err != nil || isCounted {
+		return
+	}
+	err = storeMailbox.db().Update(func(tx *bolt.Tx) error {
+		if _, err := storeMailbox.txInitCounts(tx); err != nil {
+			return err
+		}
 		total, unread, err = storeMailbox.txGetCounts(tx)
 		return err
 	})
 	return
 }
 
+// GetStatus returns numbers of total and unread messages and the next UID
+// of this mailbox. All are read in one transaction from the persisted
+// numbers so the mailbox can be polled by STATUS often.
+func (storeMailbox *Mailbox) GetStatus() (total, unread uint, uidNext uint32, err error) {
+	isCounted := false
+	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		if storeMailbox.txGetCountsBucket(tx) == nil {
+			return nil
+		}
+		isCounted = true
+		if total, unread, err = storeMailbox.txGetCounts(tx); err != nil {
+			return err
+		}
+		uidNext, err = storeMailbox.txGetNextUID(storeMailbox.txGetIMAPIDsBucket(tx), false)
+		return err
+	})
+	if err != nil || isCounted {
+		return
+	}
+	if total, unread, err = storeMailbox.GetCounts(); err != nil {
+		return
+	}
+	uidNext, err = storeMailbox.GetNextUID()
+	return
+}
+
 func (storeMailbox *Mailbox) txGetCounts(tx *bolt.Tx) (total, unread uint, err error) {
+	if b := storeMailbox.txGetCountsBucket(tx); b != nil {
+		return getCount(b, totalCountKey), getCount(b, unreadCountKey), nil
+	}
+	return storeMailbox.txCountMessages(tx, nil)
+}
+
+// txGetCountsBucket returns the bucket with numbers of messages or nil when
+// the mailbox was not counted yet.
+func (storeMailbox *Mailbox) txGetCountsBucket(tx *bolt.Tx) *bolt.Bucket {
+	return storeMailbox.txGetBucket(tx).Bucket(msgCountsBucket)
+}
+
+// txCountMessages loops all messages of mailbox. IDs of unread messages
+// are stored to unreadIDs bucket if it is not nil.
+func (storeMailbox *Mailbox) txCountMessages(tx *bolt.Tx, unreadIDs *bolt.Bucket) (total, unread uint, err error) {
 	// For total it would be enough to use `bolt.Bucket.Stats().KeyN` but
 	// we also need to retrieve the count of unread emails therefore we are
 	// looping all messages in this mailbox by `bolt.Cursor`
@@ -55,11 +116,111 @@ func (storeMailbox *Mailbox) txGetCounts(tx *bolt.Tx) (total, unread uint, err e
 		// where `1` means true (i.e. message is unread)
 		if bytes.Contains(rawMsg, []byte(`"Unread":1`)) {
 			unread++
+			if unreadIDs != nil {
+				if err := unreadIDs.Put(apiID, []byte{}); err != nil {
+					return 0, 0, err
+				}
+			}
 		}
 	}
 	return total, unread, err
 }
 
+// txInitCounts returns the bucket with numbers of messages. Messages are
+// counted when the mailbox was not counted yet.
+func (storeMailbox *Mailbox) txInitCounts(tx *bolt.Tx) (*bolt.Bucket, error) {
+	if b := storeMailbox.txGetCountsBucket(tx); b != nil {
+		return b, nil
+	}
+
+	b, err := storeMailbox.txGetBucket(tx).CreateBucket(msgCountsBucket)
+	if err != nil {
+		return nil, err
+	}
+	unreadIDs, err := b.CreateBucket(unreadIDsBucket)
+	if err != nil {
+		return nil, err
+	}
+	total, unread, err := storeMailbox.txCountMessages(tx, unreadIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Put(totalCountKey, itob(uint32(total))); err != nil {
+		return nil, err
+	}
+	if err := b.Put(unreadCountKey, itob(uint32(unread))); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// txCountMessage updates numbers of messages by the message which is being
+// added to the mailbox (isNew) or which is already in the mailbox.
+// The new message has to be counted before it is added to the mailbox.
+func (storeMailbox *Mailbox) txCountMessage(tx *bolt.Tx, msg *pmapi.Message, isNew bool) error {
+	b, err := storeMailbox.txInitCounts(tx)
+	if err != nil {
+		return err
+	}
+	if isNew {
+		if err := addCount(b, totalCountKey, 1); err != nil {
+			return err
+		}
+	}
+
+	unreadIDs := b.Bucket(unreadIDsBucket)
+	wasUnread := unreadIDs.Get([]byte(msg.ID)) != nil
+	switch isUnread := msg.Unread == 1; {
+	case isUnread && !wasUnread:
+		if err := unreadIDs.Put([]byte(msg.ID), []byte{}); err != nil {
+			return err
+		}
+		return addCount(b, unreadCountKey, 1)
+	case !isUnread && wasUnread:
+		if err := unreadIDs.Delete([]byte(msg.ID)); err != nil {
+			return err
+		}
+		return addCount(b, unreadCountKey, -1)
+	}
+	return nil
+}
+
+// txUncountMessage updates numbers of messages by the message which is
+// being removed from the mailbox. It has to be called before the removal.
+func (storeMailbox *Mailbox) txUncountMessage(tx *bolt.Tx, apiID string) error {
+	b, err := storeMailbox.txInitCounts(tx)
+	if err != nil {
+		return err
+	}
+	if err := addCount(b, totalCountKey, -1); err != nil {
+		return err
+	}
+
+	unreadIDs := b.Bucket(unreadIDsBucket)
+	if unreadIDs.Get([]byte(apiID)) == nil {
+		return nil
+	}
+	if err := unreadIDs.Delete([]byte(apiID)); err != nil {
+		return err
+	}
+	return addCount(b, unreadCountKey, -1)
+}
+
+func getCount(b *bolt.Bucket, key []byte) uint {
+	if countb := b.Get(key); countb != nil {
+		return uint(btoi(countb))
+	}
+	return 0
+}
+
+func addCount(b *bolt.Bucket, key []byte, delta int) error {
+	count := int(getCount(b, key)) + delta
+	if count < 0 {
+		count = 0
+	}
+	return b.Put(key, itob(uint32(count)))
+}
+
 type mailboxCounts struct {
 	LabelID     string
 	LabelName   string
@@ -102,6 +263,15 @@ func getSystemFolders() []*mailboxCounts {
 	}
 }
 
+func getSystemFolderName(labelID string) string {
+	for _, folder := range getSystemFolders() {
+		if folder.LabelID == labelID {
+			return folder.LabelName
+		}
+	}
+	return ""
+}
+
 // skipThisLabel decides to skip labelIDs that *are* pmapi system labels but *aren't* local system labels
 // (i.e. if it's in `pmapi.SystemLabels` but not in `getSystemFolders` then we skip it, otherwise we don't).
 func skipThisLabel(labelID string) bool {
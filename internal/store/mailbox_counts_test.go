@@ -22,6 +22,8 @@ import (
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 )
 
 func newLabel(order int, id, name string) *pmapi.Label {
@@ -124,3 +126,84 @@ func TestMailboxCountRemove(t *testing.T) {
 	a.NoError(t, m.store.removeMailboxCount(pop.LabelID))
 	checkCounts(t, testCounts, m.store)
 }
+
+func checkMailboxCounts(t *testing.T, storeMailbox *Mailbox, wantTotal, wantUnread uint) {
+	total, unread, err := storeMailbox.GetCounts()
+	require.NoError(t, err)
+	a.Equal(t, wantTotal, total, "total")
+	a.Equal(t, wantUnread, unread, "unread")
+}
+
+func TestMailboxGetCountsIsUpdatedByChanges(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkMailboxCounts(t, inbox, 3, 2)
+
+	// Marking read message as read again does not change counts.
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkMailboxCounts(t, inbox, 3, 1)
+
+	// Moved message is removed from mailbox.
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	checkMailboxCounts(t, inbox, 2, 0)
+	checkMailboxCounts(t, m.store.addresses[addrID1].mailboxes[pmapi.ArchiveLabel], 1, 1)
+
+	require.NoError(t, m.store.deleteMessageEvent("msg2"))
+	checkMailboxCounts(t, inbox, 1, 0)
+	checkMailboxCounts(t, m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel], 2, 1)
+}
+
+func TestMailboxGetCountsCountsMailboxOnce(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Mailbox stored by older version has no counts.
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return inbox.txGetBucket(tx).DeleteBucket(msgCountsBucket)
+	}))
+	checkMailboxCounts(t, inbox, 2, 1)
+
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkMailboxCounts(t, inbox, 2, 2)
+}
+
+func TestMailboxGetStatus(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+	m.newStoreNoEvents(true)
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	total, unread, uidNext, err := inbox.GetStatus()
+	require.NoError(t, err)
+	a.Equal(t, uint(2), total)
+	a.Equal(t, uint(1), unread)
+	a.Equal(t, uint32(3), uidNext)
+
+	// Mailbox stored by older version is counted first.
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return inbox.txGetBucket(tx).DeleteBucket(msgCountsBucket)
+	}))
+	total, unread, uidNext, err = inbox.GetStatus()
+	require.NoError(t, err)
+	a.Equal(t, uint(2), total)
+	a.Equal(t, uint(1), unread)
+	a.Equal(t, uint32(3), uidNext)
+}
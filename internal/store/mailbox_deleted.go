@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Messages flagged as \Deleted over IMAP stay in the mailbox until they are
+// expunged. The flag is not stored on API, it belongs only to the mailbox.
+
+// txGetDeletedIDsBucket returns the bucket of API IDs of messages flagged
+// as \Deleted in the mailbox.
+func (storeMailbox *Mailbox) txGetDeletedIDsBucket(tx *bolt.Tx) *bolt.Bucket {
+	return storeMailbox.txGetBucket(tx).Bucket(deletedIDsBucket)
+}
+
+// MarkMessagesDeleted flags messages in the mailbox as \Deleted.
+// The change is propagated to IMAP clients as a message update.
+func (storeMailbox *Mailbox) MarkMessagesDeleted(apiIDs []string) error {
+	log.WithFields(logrus.Fields{
+		"messages": apiIDs,
+		"label":    storeMailbox.labelID,
+		"mailbox":  storeMailbox.Name,
+	}).Trace("Marking messages as deleted")
+	return storeMailbox.updateDeletedFlags(apiIDs, true)
+}
+
+// MarkMessagesUndeleted removes \Deleted flag from messages in the mailbox.
+// The change is propagated to IMAP clients as a message update.
+func (storeMailbox *Mailbox) MarkMessagesUndeleted(apiIDs []string) error {
+	log.WithFields(logrus.Fields{
+		"messages": apiIDs,
+		"label":    storeMailbox.labelID,
+		"mailbox":  storeMailbox.Name,
+	}).Trace("Marking messages as undeleted")
+	return storeMailbox.updateDeletedFlags(apiIDs, false)
+}
+
+func (storeMailbox *Mailbox) updateDeletedFlags(apiIDs []string, deleted bool) error {
+	return storeMailbox.db().Update(func(tx *bolt.Tx) error {
+		apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+		imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+		deletedBucket := storeMailbox.txGetDeletedIDsBucket(tx)
+		for _, apiID := range apiIDs {
+			apiIDb := []byte(apiID)
+			uidb := apiBucket.Get(apiIDb)
+			if uidb == nil || (deletedBucket.Get(apiIDb) != nil) == deleted {
+				continue
+			}
+
+			var err error
+			if deleted {
+				err = deletedBucket.Put(apiIDb, []byte{})
+			} else {
+				err = deletedBucket.Delete(apiIDb)
+			}
+			if err != nil {
+				return errors.Wrap(err, "cannot update deleted flag")
+			}
+			if err := storeMailbox.txNextModSeq(tx, uidb); err != nil {
+				return err
+			}
+
+			msg, err := storeMailbox.store.txGetMessage(tx, apiID)
+			if err != nil {
+				return err
+			}
+			txApplyAnsweredFlags(tx, msg)
+			if seqNum, err := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb); err == nil {
+				storeMailbox.store.imapUpdateMessage(
+					storeMailbox.storeAddress.loginAddress(),
+					storeMailbox.labelName,
+					btoi(uidb),
+					seqNum,
+					msg,
+					deleted,
+				)
+			}
+		}
+		return nil
+	})
+}
+
+// IsDeleted returns whether the message is flagged as \Deleted in its mailbox.
+func (message *Message) IsDeleted() bool {
+	return message.storeMailbox.isDeleted(message.ID())
+}
+
+func (storeMailbox *Mailbox) isDeleted(apiID string) (deleted bool) {
+	_ = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		deleted = storeMailbox.txIsDeleted(tx, apiID)
+		return nil
+	})
+	return
+}
+
+func (storeMailbox *Mailbox) txIsDeleted(tx *bolt.Tx, apiID string) bool {
+	return storeMailbox.txGetDeletedIDsBucket(tx).Get([]byte(apiID)) != nil
+}
+
+// RemoveDeleted removes messages flagged as \Deleted from the mailbox.
+// With non-nil apiIDs only the listed messages are removed (UID EXPUNGE).
+// Messages are removed by the delete action of the mailbox, see DeleteMessages.
+func (storeMailbox *Mailbox) RemoveDeleted(apiIDs []string) error {
+	deletedIDs := []string{}
+	err := storeMailbox.db().View(func(tx *bolt.Tx) error {
+		b := storeMailbox.txGetDeletedIDsBucket(tx)
+		if apiIDs == nil {
+			return b.ForEach(func(apiIDb, _ []byte) error {
+				deletedIDs = append(deletedIDs, string(apiIDb))
+				return nil
+			})
+		}
+		for _, apiID := range apiIDs {
+			if b.Get([]byte(apiID)) != nil {
+				deletedIDs = append(deletedIDs, apiID)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(deletedIDs) == 0 {
+		return err
+	}
+	return storeMailbox.DeleteMessages(deletedIDs)
+}
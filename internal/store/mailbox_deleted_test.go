@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveDeletedMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, inbox.MarkMessagesDeleted([]string{"msg1", "msg2"}))
+	checkIsDeleted(t, inbox, "msg1", true)
+	checkIsDeleted(t, inbox, "msg3", false)
+	// The flag belongs only to the mailbox.
+	checkIsDeleted(t, allMail, "msg1", false)
+
+	// Only deleted messages of the set are removed.
+	m.api.EXPECT().UnlabelMessages([]string{"msg2"}, pmapi.InboxLabel)
+	require.NoError(t, inbox.RemoveDeleted([]string{"msg2", "msg3"}))
+
+	// The flag is forgotten once the message is removed from the mailbox.
+	require.NoError(t, m.store.deleteMessageEvent("msg2"))
+	a.False(t, inbox.isDeleted("msg2"))
+
+	require.NoError(t, inbox.MarkMessagesUndeleted([]string{"msg1"}))
+	checkIsDeleted(t, inbox, "msg1", false)
+	require.NoError(t, inbox.RemoveDeleted(nil))
+}
+
+func checkIsDeleted(t *testing.T, storeMailbox *Mailbox, apiID string, deleted bool) {
+	msg, err := storeMailbox.GetMessage(apiID)
+	require.NoError(t, err)
+	a.Equal(t, deleted, msg.IsDeleted(), "message %s in %s", apiID, storeMailbox.Name())
+}
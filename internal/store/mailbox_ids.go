@@ -23,8 +23,10 @@ import (
 	"net/mail"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	bolt "go.etcd.io/bbolt"
 )
@@ -261,3 +263,77 @@ func (storeMailbox *Mailbox) GetUIDByHeader(header *mail.Header) (foundUID uint3
 
 	return foundUID
 }
+
+// sentCopyTimeout is how long after sending the client can APPEND the copy
+// of sent message to Sent and still be matched by content.
+const sentCopyTimeout = 30 * time.Minute
+
+// GetUIDOfSentCopy returns UID of the message sent through the API which
+// is the same as msg APPENDed by the client to Sent, or zero if no match
+// found. The message is matched by Message-ID and, because some clients
+// generate a new one for the copy, also by sender, recipients and subject
+// of recently sent messages. Clients often APPEND the copy before the event
+// of the sent message arrives, so events are polled before giving up.
+func (storeMailbox *Mailbox) GetUIDOfSentCopy(msg *pmapi.Message) uint32 {
+	if foundUID := storeMailbox.findSentCopy(msg); foundUID != uint32(0) {
+		return foundUID
+	}
+	storeMailbox.pollNow()
+	return storeMailbox.findSentCopy(msg)
+}
+
+func (storeMailbox *Mailbox) findSentCopy(msg *pmapi.Message) (foundUID uint32) {
+	if foundUID = storeMailbox.GetUIDByHeader(&msg.Header); foundUID != uint32(0) {
+		return foundUID
+	}
+
+	since := time.Now().Add(-sentCopyTimeout).Unix()
+	_ = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		c := storeMailbox.txGetIMAPIDsBucket(tx).Cursor()
+		for imapID, apiID := c.Last(); imapID != nil; imapID, apiID = c.Prev() {
+			sent, err := storeMailbox.store.txGetMessage(tx, string(apiID))
+			if err != nil {
+				continue
+			}
+			if sent.Time < since {
+				return nil // Older messages were not sent just now.
+			}
+			if isSentCopy(sent, msg) {
+				foundUID = btoi(imapID)
+				return nil
+			}
+		}
+		return nil
+	})
+	return foundUID
+}
+
+// isSentCopy returns whether msg has the same subject, sender and recipients
+// as sent message. Bcc is not compared as clients do not keep it in the copy.
+func isSentCopy(sent, msg *pmapi.Message) bool {
+	if sent.Subject != msg.Subject || sent.Sender == nil || msg.Sender == nil {
+		return false
+	}
+	if !strings.EqualFold(pmapi.SanitizeEmail(sent.Sender.Address), pmapi.SanitizeEmail(msg.Sender.Address)) {
+		return false
+	}
+	return isSameAddressList(append(sent.ToList, sent.CCList...), append(msg.ToList, msg.CCList...))
+}
+
+func isSameAddressList(a, b []*mail.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	addresses := map[string]int{}
+	for _, addr := range a {
+		addresses[strings.ToLower(addr.Address)]++
+	}
+	for _, addr := range b {
+		address := strings.ToLower(addr.Address)
+		if addresses[address] == 0 {
+			return false
+		}
+		addresses[address]--
+	}
+	return true
+}
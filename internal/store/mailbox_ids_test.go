@@ -20,6 +20,7 @@ package store
 import (
 	"net/mail"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	a "github.com/stretchr/testify/assert"
@@ -145,3 +146,38 @@ func TestGetUIDByHeader(t *testing.T) { //nolint[funlen]
 		a.Equal(t, td.wantID, haveID, "testing header: %v", td.header)
 	}
 }
+
+func TestFindSentCopy(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	tstMsg := getTestMessage("msg1", "Sent long ago", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	tstMsg.Time = time.Now().Add(-2 * sentCopyTimeout).Unix()
+	require.Nil(t, m.store.createOrUpdateMessageEvent(tstMsg))
+
+	tstMsg = getTestMessage("msg2", "Sent just now", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	tstMsg.Time = time.Now().Unix()
+	tstMsg.ExternalID = "<sent@pm.me>"
+	tstMsg.CCList = []*mail.Address{{Address: "cc@pm.me"}}
+	require.Nil(t, m.store.createOrUpdateMessageEvent(tstMsg))
+
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.SentLabel]
+
+	// Sender and recipient of test messages is addrID1.
+	newCopy := func(subject string, ccList ...*mail.Address) *pmapi.Message {
+		msg := getTestMessage("", subject, addrID1, 0, nil)
+		msg.CCList = ccList
+		msg.Header = mail.Header{"Message-Id": []string{"<regenerated@client>"}}
+		return msg
+	}
+
+	copyWithSameID := newCopy("Different subject")
+	copyWithSameID.Header = mail.Header{"Message-Id": []string{"<sent@pm.me>"}}
+	a.Equal(t, uint32(2), storeMailbox.findSentCopy(copyWithSameID))
+
+	a.Equal(t, uint32(2), storeMailbox.findSentCopy(newCopy("Sent just now", &mail.Address{Address: "CC@pm.me"})))
+	a.Equal(t, uint32(0), storeMailbox.findSentCopy(newCopy("Sent just now")))
+	a.Equal(t, uint32(0), storeMailbox.findSentCopy(newCopy("Sent long ago")))
+}
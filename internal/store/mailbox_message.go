@@ -18,6 +18,8 @@
 package store
 
 import (
+	"bytes"
+
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -27,7 +29,14 @@ import (
 // GetMessage returns the `pmapi.Message` struct wrapped in `StoreMessage`
 // tied to this mailbox.
 func (storeMailbox *Mailbox) GetMessage(apiID string) (*Message, error) {
-	msg, err := storeMailbox.store.getMessageFromDB(apiID)
+	var msg *pmapi.Message
+	err := storeMailbox.db().View(func(tx *bolt.Tx) (err error) {
+		if msg, err = storeMailbox.store.txGetMessage(tx, apiID); err != nil {
+			return err
+		}
+		txApplyAnsweredFlags(tx, msg)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +81,7 @@ func (storeMailbox *Mailbox) ImportMessage(msg *pmapi.Message, body []byte, labe
 // LabelMessages adds the label by calling an API.
 // It has to be propagated to all the same messages in all mailboxes.
 // The propagation is processed by the event loop.
+// Messages moved from Spam to Inbox, Archive or a folder are reported as not spam.
 func (storeMailbox *Mailbox) LabelMessages(apiIDs []string) error {
 	log.WithFields(logrus.Fields{
 		"messages": apiIDs,
@@ -79,12 +89,24 @@ func (storeMailbox *Mailbox) LabelMessages(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Labeling messages")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().LabelMessages(apiIDs, storeMailbox.labelID)
+
+	var spamIDs []string
+	if storeMailbox.isNotSpamTarget() {
+		spamIDs = storeMailbox.filterSpamMessages(apiIDs)
+	}
+
+	if err := storeMailbox.api().LabelMessages(apiIDs, storeMailbox.labelID); err != nil {
+		return err
+	}
+
+	storeMailbox.reportNotSpam(spamIDs)
+	return nil
 }
 
 // UnlabelMessages removes the label by calling an API.
 // It has to be propagated to all the same messages in all mailboxes.
 // The propagation is processed by the event loop.
+// Messages removed from Spam are reported as not spam.
 func (storeMailbox *Mailbox) UnlabelMessages(apiIDs []string) error {
 	log.WithFields(logrus.Fields{
 		"messages": apiIDs,
@@ -92,7 +114,59 @@ func (storeMailbox *Mailbox) UnlabelMessages(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Unlabeling messages")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().UnlabelMessages(apiIDs, storeMailbox.labelID)
+
+	var spamIDs []string
+	if storeMailbox.labelID == pmapi.SpamLabel {
+		spamIDs = storeMailbox.filterSpamMessages(apiIDs)
+	}
+
+	if err := storeMailbox.api().UnlabelMessages(apiIDs, storeMailbox.labelID); err != nil {
+		return err
+	}
+
+	storeMailbox.reportNotSpam(spamIDs)
+	return nil
+}
+
+// isNotSpamTarget returns whether messages moved from Spam to this mailbox
+// are considered not spam. Spam filter learns about spam from messages
+// labeled as Spam the same way as when moved to Spam in the web app.
+func (storeMailbox *Mailbox) isNotSpamTarget() bool {
+	switch storeMailbox.labelID {
+	case pmapi.InboxLabel, pmapi.ArchiveLabel:
+		return true
+	default:
+		return storeMailbox.IsFolder()
+	}
+}
+
+// filterSpamMessages returns IDs of messages which are in Spam.
+func (storeMailbox *Mailbox) filterSpamMessages(apiIDs []string) []string {
+	spamIDs := []string{}
+	for _, apiID := range apiIDs {
+		msg, err := storeMailbox.store.getMessageFromDB(apiID)
+		if err != nil {
+			continue
+		}
+		for _, labelID := range msg.LabelIDs {
+			if labelID == pmapi.SpamLabel {
+				spamIDs = append(spamIDs, apiID)
+				break
+			}
+		}
+	}
+	return spamIDs
+}
+
+// reportNotSpam reports messages as not spam so the spam filter learns from
+// moving them out of Spam. The move itself is done even if this fails.
+func (storeMailbox *Mailbox) reportNotSpam(apiIDs []string) {
+	if len(apiIDs) == 0 {
+		return
+	}
+	if err := storeMailbox.api().MarkMessagesHam(apiIDs); err != nil {
+		storeMailbox.log.WithError(err).WithField("messages", apiIDs).Warn("Cannot report messages as not spam")
+	}
 }
 
 // MarkMessagesRead marks the message read by calling an API.
@@ -158,17 +232,34 @@ func (storeMailbox *Mailbox) MarkMessagesUnstarred(apiIDs []string) error {
 }
 
 // DeleteMessages deletes messages.
+// If the mailbox has delete action set, messages are moved to Trash or Archive
+// or deleted permanently. Otherwise:
 // If the mailbox is All Mail or All Sent, it does nothing.
 // If the mailbox is Trash or Spam and message is not in any other mailbox, messages is deleted.
 // In all other cases the message is only removed from the mailbox.
 func (storeMailbox *Mailbox) DeleteMessages(apiIDs []string) error {
+	action := storeMailbox.store.GetDeleteAction(storeMailbox.labelID)
 	log.WithFields(logrus.Fields{
 		"messages": apiIDs,
 		"label":    storeMailbox.labelID,
 		"mailbox":  storeMailbox.Name,
+		"action":   action,
 	}).Trace("Deleting messages")
 	defer storeMailbox.pollNow()
 
+	if action == DeleteActionPermanent {
+		// Only messages in Trash are deleted, others are moved to Trash.
+		if storeMailbox.labelID != pmapi.TrashLabel {
+			if err := storeMailbox.api().LabelMessages(apiIDs, pmapi.TrashLabel); err != nil {
+				return err
+			}
+		}
+		return storeMailbox.api().DeleteMessages(apiIDs)
+	}
+	if target := deleteActionTarget(action); target != "" && target != storeMailbox.labelID {
+		return storeMailbox.api().LabelMessages(apiIDs, target)
+	}
+
 	switch storeMailbox.labelID {
 	case pmapi.AllMailLabel, pmapi.AllSentLabel:
 		break
@@ -231,8 +322,13 @@ func (storeMailbox *Mailbox) txSkipAndRemoveFromMailbox(tx *bolt.Tx, msg *pmapi.
 
 	skipAndRemove = true
 
-	// If it's split mode and it shouldn't be under this address, it should be skipped and removed.
-	if mode == splitMode && storeMailbox.storeAddress.addressID != msg.AddressID {
+	// If it's split mode or namespace and it shouldn't be under this address, it should be skipped and removed.
+	if (mode == splitMode || storeMailbox.storeAddress.isNamespace()) && storeMailbox.storeAddress.addressID != msg.AddressID {
+		return
+	}
+
+	if storeMailbox.IsSearch() {
+		skipAndRemove = !storeMailbox.search.matches(msg)
 		return
 	}
 
@@ -252,11 +348,33 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 	// Buckets are not initialized right away because it's a heavy operation.
 	// The best option is to get the same bucket only once and only when needed.
 	var apiBucket, imapBucket *bolt.Bucket
+
+	window, err := txGetSyncWindow(tx, storeMailbox.labelID)
+	if err != nil {
+		return errors.Wrap(err, "cannot get sync window")
+	}
+	minTime, err := storeMailbox.txGetMinTime(tx, window)
+	if err != nil {
+		return errors.Wrap(err, "cannot get oldest message of sync window")
+	}
+
+	// Excluded mailbox gets new messages only when fetched on demand.
+	isExcluded := tx.Bucket(excludedBucket).Get([]byte(storeMailbox.labelID)) != nil &&
+		!storeMailbox.store.isFetchingOnDemand([]string{storeMailbox.labelID})
+
 	for _, msg := range msgs {
 		if storeMailbox.txSkipAndRemoveFromMailbox(tx, msg) {
 			continue
 		}
 
+		// Messages older than the window are only in All Mail.
+		if msg.Time < minTime {
+			if err := storeMailbox.txDeleteMessage(tx, msg.ID); err != nil {
+				return errors.Wrap(err, "cannot remove message outside of sync window")
+			}
+			continue
+		}
+
 		// Update message.
 		if apiBucket == nil {
 			apiBucket = storeMailbox.txGetAPIIDsBucket(tx)
@@ -275,50 +393,91 @@ func (storeMailbox *Mailbox) txCreateOrUpdateMessages(tx *bolt.Tx, msgs []*pmapi
 				if imapBucket == nil {
 					imapBucket = storeMailbox.txGetIMAPIDsBucket(tx)
 				}
+				if err := storeMailbox.txNextModSeq(tx, uidb); err != nil {
+					return err
+				}
+				if err := storeMailbox.txCountMessage(tx, msg, false); err != nil {
+					return errors.Wrap(err, "cannot update counts")
+				}
 				seqNum, seqErr := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
 				if seqErr == nil {
 					storeMailbox.store.imapUpdateMessage(
-						storeMailbox.storeAddress.address,
+						storeMailbox.storeAddress.loginAddress(),
 						storeMailbox.labelName,
 						btoi(uidb),
 						seqNum,
 						msg,
+						storeMailbox.txIsDeleted(tx, msg.ID),
 					)
 				}
 				continue
 			}
 		}
 
+		if isExcluded {
+			continue
+		}
+
 		// Create a new message.
 		if imapBucket == nil {
 			imapBucket = storeMailbox.txGetIMAPIDsBucket(tx)
 		}
-		uid, err := storeMailbox.txGetNextUID(imapBucket, true)
+		uid, err := storeMailbox.txTakeSavedUID(tx, imapBucket, msg.ID)
 		if err != nil {
-			return errors.Wrap(err, "cannot generate new UID")
+			return errors.Wrap(err, "cannot take saved UID")
+		}
+		if uid == 0 {
+			if uid, err = storeMailbox.txGetNextUID(imapBucket, true); err != nil {
+				return errors.Wrap(err, "cannot generate new UID")
+			}
 		}
 		uidb := itob(uid)
 
+		if err = storeMailbox.txCountMessage(tx, msg, true); err != nil {
+			return errors.Wrap(err, "cannot update counts")
+		}
 		if err = imapBucket.Put(uidb, []byte(msg.ID)); err != nil {
 			return errors.Wrap(err, "cannot add to IMAP bucket")
 		}
 		if err = apiBucket.Put([]byte(msg.ID), uidb); err != nil {
 			return errors.Wrap(err, "cannot add to API bucket")
 		}
+		if err = storeMailbox.txNextModSeq(tx, uidb); err != nil {
+			return err
+		}
 
 		seqNum, err := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
 		if err != nil {
 			return errors.Wrap(err, "cannot get sequence number from UID")
 		}
+		// The new message has the highest UID, so its sequence number is
+		// also the number of messages in the mailbox. Message with saved UID
+		// can be placed before others.
+		total := seqNum
+		if lastUIDb, _ := imapBucket.Cursor().Last(); !bytes.Equal(lastUIDb, uidb) {
+			if total, err = storeMailbox.txGetSequenceNumberOfUID(imapBucket, lastUIDb); err != nil {
+				return errors.Wrap(err, "cannot get number of messages")
+			}
+		}
+		storeMailbox.store.imapMailboxExists(
+			storeMailbox.storeAddress.loginAddress(),
+			storeMailbox.labelName,
+			total,
+		)
 		storeMailbox.store.imapUpdateMessage(
-			storeMailbox.storeAddress.address,
+			storeMailbox.storeAddress.loginAddress(),
 			storeMailbox.labelName,
 			uid,
 			seqNum,
 			msg,
+			false,
 		)
 	}
 
+	if err := storeMailbox.txTrimToWindow(tx, window); err != nil {
+		return errors.Wrap(err, "cannot trim mailbox to sync window")
+	}
+
 	return storeMailbox.txMailboxStatusUpdate(tx)
 }
 
@@ -339,6 +498,9 @@ func (storeMailbox *Mailbox) txDeleteMessage(tx *bolt.Tx, apiID string) error {
 		storeMailbox.log.WithField("apiID", apiID).WithError(seqNumErr).Warn("Cannot get seqNum of deleting message")
 	}
 
+	if err := storeMailbox.txUncountMessage(tx, apiID); err != nil {
+		return errors.Wrap(err, "cannot update counts")
+	}
 	if err := imapBucket.Delete(uidb); err != nil {
 		return errors.Wrap(err, "cannot delete from IMAP bucket")
 	}
@@ -347,9 +509,17 @@ func (storeMailbox *Mailbox) txDeleteMessage(tx *bolt.Tx, apiID string) error {
 		return errors.Wrap(err, "cannot delete from API bucket")
 	}
 
+	if err := storeMailbox.txGetDeletedIDsBucket(tx).Delete(apiIDb); err != nil {
+		return errors.Wrap(err, "cannot delete from deleted IDs bucket")
+	}
+
+	if err := storeMailbox.txExpungeModSeq(tx, uidb); err != nil {
+		return err
+	}
+
 	if seqNumErr == nil {
 		storeMailbox.store.imapDeleteMessage(
-			storeMailbox.storeAddress.address,
+			storeMailbox.storeAddress.loginAddress(),
 			storeMailbox.labelName,
 			seqNum,
 		)
@@ -366,7 +536,7 @@ func (storeMailbox *Mailbox) txMailboxStatusUpdate(tx *bolt.Tx) error {
 		return errors.Wrap(err, "cannot get counts for mailbox status update")
 	}
 	storeMailbox.store.imapMailboxStatus(
-		storeMailbox.storeAddress.address,
+		storeMailbox.storeAddress.loginAddress(),
 		storeMailbox.labelName,
 		total,
 		unread,
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelMessagesReportsNotSpam(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SpamLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	m.api.EXPECT().LabelMessages([]string{"msg1", "msg2"}, pmapi.InboxLabel)
+	m.api.EXPECT().MarkMessagesHam([]string{"msg1"})
+	require.NoError(t, inbox.LabelMessages([]string{"msg1", "msg2"}))
+}
+
+func TestLabelMessagesToTrashDoesNotReportNotSpam(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SpamLabel})
+
+	trash := m.store.addresses[addrID1].mailboxes[pmapi.TrashLabel]
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.TrashLabel)
+	require.NoError(t, trash.LabelMessages([]string{"msg1"}))
+}
+
+func TestUnlabelSpamReportsNotSpam(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.SpamLabel})
+
+	spam := m.store.addresses[addrID1].mailboxes[pmapi.SpamLabel]
+	m.api.EXPECT().UnlabelMessages([]string{"msg1"}, pmapi.SpamLabel)
+	m.api.EXPECT().MarkMessagesHam([]string{"msg1"})
+	require.NoError(t, spam.UnlabelMessages([]string{"msg1"}))
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Mod-sequences (RFC 7162) are increasing numbers per mailbox assigned to
+// every change of a message in the mailbox. Messages stored before
+// mod-sequences were introduced have none and are reported with the lowest
+// value, so clients fetch them at least once.
+const initialModSeq = uint64(1)
+
+func modSeqToBytes(modSeq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, modSeq)
+	return b
+}
+
+func bytesToModSeq(b []byte) uint64 {
+	if len(b) != 8 {
+		return initialModSeq
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// txGetModSeqsBucket returns the bucket mapping IMAP UID to mod-sequence.
+func (storeMailbox *Mailbox) txGetModSeqsBucket(tx *bolt.Tx) *bolt.Bucket {
+	return storeMailbox.txGetBucket(tx).Bucket(modSeqsBucket)
+}
+
+// txGetExpungedBucket returns the bucket mapping IMAP UID of removed message
+// to mod-sequence of the removal.
+func (storeMailbox *Mailbox) txGetExpungedBucket(tx *bolt.Tx) *bolt.Bucket {
+	return storeMailbox.txGetBucket(tx).Bucket(expungedBucket)
+}
+
+func txGetHighestModSeq(modSeqBucket *bolt.Bucket) uint64 {
+	if highest := modSeqBucket.Sequence(); highest > initialModSeq {
+		return highest
+	}
+	return initialModSeq
+}
+
+// txNextModSeq assigns new mod-sequence to the message with IMAP UID bytes `uidb`.
+func (storeMailbox *Mailbox) txNextModSeq(tx *bolt.Tx, uidb []byte) error {
+	uidb = itob(btoi(uidb)) // The key has to stay valid after other writes in transaction.
+	b := storeMailbox.txGetModSeqsBucket(tx)
+	modSeq, err := b.NextSequence()
+	if err != nil {
+		return errors.Wrap(err, "cannot generate new mod-sequence")
+	}
+	// The first change has to be higher than the one of not yet tracked messages.
+	if modSeq <= initialModSeq {
+		modSeq = initialModSeq + 1
+		if err := b.SetSequence(modSeq); err != nil {
+			return errors.Wrap(err, "cannot set mod-sequence")
+		}
+	}
+	return b.Put(uidb, modSeqToBytes(modSeq))
+}
+
+// txExpungeModSeq remembers removal of the message with IMAP UID bytes `uidb`
+// so clients can be told about it by QRESYNC.
+func (storeMailbox *Mailbox) txExpungeModSeq(tx *bolt.Tx, uidb []byte) error {
+	uidb = itob(btoi(uidb))
+	if err := storeMailbox.txNextModSeq(tx, uidb); err != nil {
+		return err
+	}
+	modSeqBucket := storeMailbox.txGetModSeqsBucket(tx)
+	modSeq := modSeqToBytes(bytesToModSeq(modSeqBucket.Get(uidb)))
+	if err := modSeqBucket.Delete(uidb); err != nil {
+		return errors.Wrap(err, "cannot delete mod-sequence")
+	}
+	return storeMailbox.txGetExpungedBucket(tx).Put(uidb, modSeq)
+}
+
+// GetHighestModSeq returns the highest mod-sequence of all changes in the mailbox.
+func (storeMailbox *Mailbox) GetHighestModSeq() (highest uint64, err error) {
+	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		highest = txGetHighestModSeq(storeMailbox.txGetModSeqsBucket(tx))
+		return nil
+	})
+	return
+}
+
+// GetModSeqs returns UIDs of all messages in the mailbox and their
+// mod-sequences. UIDs are in increasing order, i.e. the index in the slice
+// corresponds to the sequence number decreased by one.
+func (storeMailbox *Mailbox) GetModSeqs() (uids []uint32, modSeqs []uint64, err error) {
+	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		modSeqBucket := storeMailbox.txGetModSeqsBucket(tx)
+		c := storeMailbox.txGetIMAPIDsBucket(tx).Cursor()
+		for uidb, _ := c.First(); uidb != nil; uidb, _ = c.Next() {
+			uids = append(uids, btoi(uidb))
+			modSeqs = append(modSeqs, bytesToModSeq(modSeqBucket.Get(uidb)))
+		}
+		return nil
+	})
+	return
+}
+
+// GetModSeq returns mod-sequence of the message with the given IMAP UID.
+func (storeMailbox *Mailbox) GetModSeq(uid uint32) (modSeq uint64, err error) {
+	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		modSeq = bytesToModSeq(storeMailbox.txGetModSeqsBucket(tx).Get(itob(uid)))
+		return nil
+	})
+	return
+}
+
+// ChangeModSeqs assigns new mod-sequences to messages with the given IMAP
+// UIDs whose mod-sequence is not higher than unchangedSince and returns the
+// new values. The check and the change are done in one transaction before
+// flags are changed through the API, so a concurrent conditional STORE sees
+// the change before the event loop applies it (and assigns another one).
+// UIDs of removed messages and of messages changed since are not returned.
+func (storeMailbox *Mailbox) ChangeModSeqs(uids []uint32, unchangedSince uint64) (modSeqs map[uint32]uint64, err error) {
+	modSeqs = map[uint32]uint64{}
+	err = storeMailbox.db().Update(func(tx *bolt.Tx) error {
+		imapIDsBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+		modSeqBucket := storeMailbox.txGetModSeqsBucket(tx)
+		for _, uid := range uids {
+			uidb := itob(uid)
+			if imapIDsBucket.Get(uidb) == nil || bytesToModSeq(modSeqBucket.Get(uidb)) > unchangedSince {
+				continue
+			}
+			if err := storeMailbox.txNextModSeq(tx, uidb); err != nil {
+				return err
+			}
+			modSeqs[uid] = bytesToModSeq(modSeqBucket.Get(uidb))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return modSeqs, nil
+}
+
+// GetUIDsExpungedSince returns UIDs of messages removed from the mailbox
+// with mod-sequence higher than `modSeq`.
+func (storeMailbox *Mailbox) GetUIDsExpungedSince(modSeq uint64) (uids []uint32, err error) {
+	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		return storeMailbox.txGetExpungedBucket(tx).ForEach(func(uidb, modSeqb []byte) error {
+			if bytesToModSeq(modSeqb) > modSeq {
+				uids = append(uids, btoi(uidb))
+			}
+			return nil
+		})
+	})
+	return
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModSeqs(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	highest, err := storeMailbox.GetHighestModSeq()
+	require.Nil(t, err)
+	a.Equal(t, initialModSeq, highest)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	uids, modSeqs, err := storeMailbox.GetModSeqs()
+	require.Nil(t, err)
+	a.Equal(t, []uint32{1, 2, 3}, uids)
+	a.Equal(t, []uint64{2, 3, 4}, modSeqs)
+
+	// Update of message gets new mod-sequence.
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	modSeq, err := storeMailbox.GetModSeq(1)
+	require.Nil(t, err)
+	a.Equal(t, uint64(5), modSeq)
+
+	// Removal is remembered with its mod-sequence.
+	require.Nil(t, m.store.deleteMessageEvent("msg2"))
+	uids, modSeqs, err = storeMailbox.GetModSeqs()
+	require.Nil(t, err)
+	a.Equal(t, []uint32{1, 3}, uids)
+	a.Equal(t, []uint64{5, 4}, modSeqs)
+
+	expunged, err := storeMailbox.GetUIDsExpungedSince(5)
+	require.Nil(t, err)
+	a.Equal(t, []uint32{2}, expunged)
+	expunged, err = storeMailbox.GetUIDsExpungedSince(6)
+	require.Nil(t, err)
+	a.Empty(t, expunged)
+
+	highest, err = storeMailbox.GetHighestModSeq()
+	require.Nil(t, err)
+	a.Equal(t, uint64(6), highest)
+}
+
+func TestChangeModSeqs(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Only the first message was not changed since 2; UID 3 does not exist.
+	changed, err := storeMailbox.ChangeModSeqs([]uint32{1, 2, 3}, 2)
+	require.Nil(t, err)
+	a.Equal(t, map[uint32]uint64{1: 4}, changed)
+
+	// The second STORE with the same condition fails for both messages.
+	changed, err = storeMailbox.ChangeModSeqs([]uint32{1, 2}, 2)
+	require.Nil(t, err)
+	a.Empty(t, changed)
+
+	modSeq, err := storeMailbox.GetModSeq(1)
+	require.Nil(t, err)
+	a.Equal(t, uint64(4), modSeq)
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// onDemandFetchInterval is the minimal time between fetches of messages of
+// mailbox when clients open it.
+const onDemandFetchInterval = 5 * time.Minute
+
+// FetchOnDemand starts download of messages which are not synced from the
+// server in background so clients opening the mailbox see its content.
+// These are all messages of excluded mailbox or messages older than the
+// sync limit. Messages are listed from the newest and download stops at
+// the first page with messages all fetched already. It does nothing when
+// all messages are synced or the mailbox was fetched recently.
+func (storeMailbox *Mailbox) FetchOnDemand() {
+	store := storeMailbox.store
+	labelID := storeMailbox.labelID
+
+	if storeMailbox.IsVirtual() {
+		return
+	}
+
+	end := store.getSyncBegin()
+	if store.IsMailboxExcluded(labelID) {
+		end = 0
+	} else if end == 0 {
+		return
+	}
+
+	if !store.startOnDemandFetch(labelID) {
+		return
+	}
+
+	go func() {
+		defer store.panicHandler.HandlePanic()
+		defer store.finishOnDemandFetch(labelID)
+
+		if err := storeMailbox.fetchOnDemand(end); err != nil {
+			storeMailbox.log.WithError(err).Error("Cannot fetch messages on demand")
+		}
+	}()
+}
+
+// fetchOnDemand downloads messages of the mailbox older than end, or all
+// messages when end is zero.
+func (storeMailbox *Mailbox) fetchOnDemand(end int64) error {
+	desc := true
+	for page := 0; ; page++ {
+		messages, _, err := storeMailbox.store.api.ListMessages(&pmapi.MessagesFilter{
+			LabelID:  storeMailbox.labelID,
+			Sort:     pmapi.SortByTime,
+			Desc:     &desc,
+			PageSize: maxFilterPageSize,
+			Page:     page,
+			End:      end,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to list messages")
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		isFetched, err := storeMailbox.areAllMessagesFetched(messages)
+		if err != nil {
+			return err
+		}
+		if isFetched {
+			return nil
+		}
+
+		if err := storeMailbox.store.createOrUpdateMessagesEvent(messages); err != nil {
+			return errors.Wrap(err, "failed to create or update messages")
+		}
+
+		if len(messages) < maxFilterPageSize {
+			return nil
+		}
+	}
+}
+
+func (storeMailbox *Mailbox) areAllMessagesFetched(messages []*pmapi.Message) (isFetched bool, err error) {
+	err = storeMailbox.db().View(func(tx *bolt.Tx) error {
+		apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+		for _, msg := range messages {
+			if apiBucket.Get([]byte(msg.ID)) == nil {
+				return nil
+			}
+		}
+		isFetched = true
+		return nil
+	})
+	return
+}
+
+// filterNotSyncedMessages removes new messages which are not synced because
+// they are only in excluded mailboxes or older than the sync limit, unless
+// they are fetched on demand. It returns also IDs of saved messages which
+// were moved only to excluded mailboxes and should be deleted.
+func (store *Store) filterNotSyncedMessages(msgs []*pmapi.Message) (filtered []*pmapi.Message, toBeDeleted []string, err error) {
+	hasExcluded := store.hasExcludedMailboxes()
+	begin := store.getSyncBegin()
+	if !hasExcluded && begin == 0 {
+		return msgs, nil, nil
+	}
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		metaBucket := tx.Bucket(metadataBucket)
+		for _, msg := range msgs {
+			isSaved := metaBucket.Get([]byte(msg.ID)) != nil
+			switch {
+			case store.isFetchingOnDemand(msg.LabelIDs):
+			case hasExcluded && txIsOnlyInExcludedMailboxes(tx, msg):
+				if !store.txIsInExcludedMailbox(tx, msg) {
+					if isSaved {
+						toBeDeleted = append(toBeDeleted, msg.ID)
+					}
+					continue
+				}
+			case msg.Time < begin && !isSaved:
+				continue
+			}
+			filtered = append(filtered, msg)
+		}
+		return nil
+	})
+	return
+}
+
+func (store *Store) startOnDemandFetch(labelID string) bool {
+	store.onDemandFetchLock.Lock()
+	defer store.onDemandFetchLock.Unlock()
+
+	if store.onDemandFetches == nil {
+		store.onDemandFetches = map[string]time.Time{}
+		store.onDemandFetching = map[string]bool{}
+	}
+	if store.onDemandFetching[labelID] || time.Since(store.onDemandFetches[labelID]) < onDemandFetchInterval {
+		return false
+	}
+	store.onDemandFetches[labelID] = time.Now()
+	store.onDemandFetching[labelID] = true
+	return true
+}
+
+func (store *Store) finishOnDemandFetch(labelID string) {
+	store.onDemandFetchLock.Lock()
+	defer store.onDemandFetchLock.Unlock()
+
+	delete(store.onDemandFetching, labelID)
+}
+
+// isFetchingOnDemand returns whether messages of any of labels are being
+// fetched on demand right now.
+func (store *Store) isFetchingOnDemand(labelIDs []string) bool {
+	store.onDemandFetchLock.Lock()
+	defer store.onDemandFetchLock.Unlock()
+
+	for _, labelID := range labelIDs {
+		if store.onDemandFetching[labelID] {
+			return true
+		}
+	}
+	return false
+}
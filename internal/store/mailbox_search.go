@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/jaytaylor/html2text"
+	"github.com/pkg/errors"
+)
+
+// SearchAPIIDs returns API IDs of messages in the mailbox matching the
+// sender, recipient and subject by calling an API. Only criteria the API
+// searches on the server are sent, because bodies are encrypted there.
+// Empty criteria are not used.
+func (storeMailbox *Mailbox) SearchAPIIDs(from, to, subject string) ([]string, error) {
+	apiIDs := []string{}
+	desc := false
+	for page := 0; ; page++ {
+		filter := &pmapi.MessagesFilter{
+			LabelID:  storeMailbox.labelID,
+			From:     from,
+			To:       to,
+			Subject:  subject,
+			Sort:     "ID",
+			Desc:     &desc,
+			PageSize: maxFilterPageSize,
+			Page:     page,
+		}
+		messages, total, err := storeMailbox.api().ListMessages(filter)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to search messages")
+		}
+		for _, message := range messages {
+			apiIDs = append(apiIDs, message.ID)
+		}
+		if len(messages) == 0 || len(apiIDs) >= total {
+			return apiIDs, nil
+		}
+	}
+}
+
+// SearchBodies returns those apiIDs whose decrypted body contains the text,
+// or also the subject or addresses if bodyOnly is false. Text is matched
+// case-insensitively as a substring as IMAP SEARCH BODY and TEXT do.
+// Messages are downloaded, so apiIDs should be filtered by cheaper
+// criteria first.
+func (storeMailbox *Mailbox) SearchBodies(apiIDs []string, text string, bodyOnly bool) (matched []string, err error) {
+	text = strings.ToLower(text)
+	for _, apiID := range apiIDs {
+		msg, err := storeMailbox.store.fetchMessage(apiID)
+		if err == ErrNoSuchAPIID {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var body string
+		if err := msg.Decrypt(storeMailbox.api().KeyRingForAddressID(msg.AddressID)); err != nil {
+			storeMailbox.log.WithError(err).WithField("msgID", apiID).Warn("Cannot decrypt message to search")
+		} else {
+			body = getBodyText(msg)
+		}
+
+		if strings.Contains(strings.ToLower(body), text) ||
+			(!bodyOnly && strings.Contains(strings.ToLower(getHeaderText(msg)), text)) {
+			matched = append(matched, apiID)
+		}
+	}
+	return matched, nil
+}
+
+func getBodyText(msg *pmapi.Message) string {
+	if msg.MIMEType == pmapi.ContentTypeHTML {
+		if text, err := html2text.FromString(msg.Body); err == nil {
+			return text
+		}
+	}
+	return msg.Body
+}
+
+// getHeaderText returns text of the subject and addresses, the header
+// fields which can be searched by TEXT criterion.
+func getHeaderText(msg *pmapi.Message) string {
+	parts := []string{msg.Subject}
+	for _, list := range [][]*mail.Address{{msg.Sender}, msg.ToList, msg.CCList, msg.BCCList} {
+		for _, address := range list {
+			if address != nil {
+				parts = append(parts, address.Name, address.Address)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchAPIIDs(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	firstPage := []*pmapi.Message{}
+	for i := 0; i < maxFilterPageSize; i++ {
+		firstPage = append(firstPage, &pmapi.Message{ID: "first"})
+	}
+
+	gomock.InOrder(
+		m.api.EXPECT().ListMessages(gomock.Any()).DoAndReturn(func(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+			a.Equal(t, pmapi.InboxLabel, filter.LabelID)
+			a.Equal(t, "jane", filter.From)
+			a.Equal(t, "", filter.To)
+			a.Equal(t, "hello", filter.Subject)
+			a.Equal(t, "", filter.Keyword)
+			a.Equal(t, 0, filter.Page)
+			return firstPage, maxFilterPageSize + 1, nil
+		}),
+		m.api.EXPECT().ListMessages(gomock.Any()).DoAndReturn(func(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+			a.Equal(t, 1, filter.Page)
+			return []*pmapi.Message{{ID: "last"}}, maxFilterPageSize + 1, nil
+		}),
+	)
+
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	apiIDs, err := storeMailbox.SearchAPIIDs("jane", "", "hello")
+	require.NoError(t, err)
+	a.Len(t, apiIDs, maxFilterPageSize+1)
+	a.Equal(t, "last", apiIDs[maxFilterPageSize])
+
+	m.api.EXPECT().ListMessages(gomock.Any()).Return(nil, 0, errors.New("offline"))
+	_, err = storeMailbox.SearchAPIIDs("jane", "", "hello")
+	a.Error(t, err)
+}
+
+func TestSearchBodies(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	m.api.EXPECT().GetMessage("msg1").Return(&pmapi.Message{
+		ID:       "msg1",
+		Subject:  "Greeting",
+		MIMEType: pmapi.ContentTypeHTML,
+		Body:     "<p>Hello World</p>",
+	}, nil).Times(3)
+	m.api.EXPECT().GetMessage("msg2").Return(&pmapi.Message{
+		ID:       "msg2",
+		Subject:  "Hello",
+		MIMEType: pmapi.ContentTypePlainText,
+		Body:     "Nice weather",
+	}, nil).Times(3)
+	m.api.EXPECT().GetMessage("deleted").Return(nil, errors.New("Message does not exist")).Times(3)
+	m.api.EXPECT().KeyRingForAddressID(gomock.Any()).Return(nil).AnyTimes()
+
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	apiIDs := []string{"msg1", "msg2", "deleted"}
+
+	matched, err := storeMailbox.SearchBodies(apiIDs, "LO WOR", true)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg1"}, matched)
+
+	matched, err = storeMailbox.SearchBodies(apiIDs, "hello", true)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg1"}, matched)
+
+	matched, err = storeMailbox.SearchBodies(apiIDs, "hello", false)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg1", "msg2"}, matched)
+}
@@ -18,8 +18,10 @@
 package store
 
 import (
+	"encoding/json"
 	"net/mail"
 
+	backendMessage "github.com/ProtonMail/proton-bridge/pkg/message"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	bolt "go.etcd.io/bbolt"
 )
@@ -59,6 +61,15 @@ func (message *Message) SequenceNumber() (uint32, error) {
 	return message.storeMailbox.getSequenceNumber(message.ID())
 }
 
+// ModSeq returns mod-sequence of the last change of message in used mailbox.
+func (message *Message) ModSeq() (uint64, error) {
+	uid, err := message.UID()
+	if err != nil {
+		return 0, err
+	}
+	return message.storeMailbox.GetModSeq(uid)
+}
+
 // Message returns message struct from pmapi.
 func (message *Message) Message() *pmapi.Message {
 	return message.msg
@@ -106,3 +117,30 @@ func (message *Message) SetContentTypeAndHeader(mimeType string, header mail.Hea
 	}
 	return message.store.db.Update(txUpdate)
 }
+
+// GetBodyStructure returns the structure of built message stored by
+// SetBodyStructure or nil if the message was not built yet.
+func (message *Message) GetBodyStructure() (structure *backendMessage.BodyStructure, err error) {
+	err = message.store.db.View(func(tx *bolt.Tx) error {
+		structureb := tx.Bucket(structuresBucket).Get([]byte(message.msg.ID))
+		if structureb == nil {
+			return nil
+		}
+		structure = &backendMessage.BodyStructure{}
+		return json.Unmarshal(structureb, structure)
+	})
+	return
+}
+
+// SetBodyStructure stores the structure of built message so BODYSTRUCTURE
+// can be fetched without building the message again. This should not
+// trigger any IMAP update.
+func (message *Message) SetBodyStructure(structure *backendMessage.BodyStructure) error {
+	structureb, err := json.Marshal(structure)
+	if err != nil {
+		return err
+	}
+	return message.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(structuresBucket).Put([]byte(message.msg.ID), structureb)
+	})
+}
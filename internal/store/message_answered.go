@@ -0,0 +1,123 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	bolt "go.etcd.io/bbolt"
+)
+
+// answeredFlags are flags of message shown over IMAP as \Answered and
+// $Forwarded. API sets them only when the reply or forward is sent through
+// it, so flags set over IMAP are kept in the store on top of flags of API.
+const answeredFlags = pmapi.FlagReplied | pmapi.FlagRepliedAll | pmapi.FlagForwarded
+
+// MarkMessagesAnswered sets or clears the replied flag of messages.
+// The change is propagated to IMAP clients as a message update.
+func (store *Store) MarkMessagesAnswered(apiIDs []string, answered bool) error {
+	return store.updateAnsweredFlags(apiIDs, func(flags int64) int64 {
+		if !answered {
+			return flags &^ (pmapi.FlagReplied | pmapi.FlagRepliedAll)
+		}
+		if flags&(pmapi.FlagReplied|pmapi.FlagRepliedAll) == 0 {
+			flags |= pmapi.FlagReplied
+		}
+		return flags
+	})
+}
+
+// MarkMessagesForwarded sets or clears the forwarded flag of messages.
+// The change is propagated to IMAP clients as a message update.
+func (store *Store) MarkMessagesForwarded(apiIDs []string, forwarded bool) error {
+	return store.updateAnsweredFlags(apiIDs, func(flags int64) int64 {
+		if forwarded {
+			return flags | pmapi.FlagForwarded
+		}
+		return flags &^ pmapi.FlagForwarded
+	})
+}
+
+func (store *Store) updateAnsweredFlags(apiIDs []string, update func(flags int64) int64) error {
+	msgs := []*pmapi.Message{}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(answeredBucket)
+		for _, apiID := range apiIDs {
+			msg, err := store.txGetMessage(tx, apiID)
+			if err != nil {
+				return err
+			}
+			apiFlags := msg.Flags & answeredFlags
+			flags := update(txGetAnsweredFlags(b, msg)) & answeredFlags
+			if flags == apiFlags {
+				err = b.Delete([]byte(apiID))
+			} else {
+				err = b.Put([]byte(apiID), itob(uint32(flags)))
+			}
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, msg)
+		}
+		return nil
+	})
+	if err != nil || len(msgs) == 0 {
+		return err
+	}
+	return store.createOrUpdateMessagesEvent(msgs)
+}
+
+// txGetAnsweredFlags returns answered flags of the message set over IMAP
+// or flags of API when there is no change over IMAP.
+func txGetAnsweredFlags(b *bolt.Bucket, msg *pmapi.Message) int64 {
+	if flagsb := b.Get([]byte(msg.ID)); flagsb != nil {
+		return int64(btoi(flagsb))
+	}
+	return msg.Flags & answeredFlags
+}
+
+// txApplyAnsweredFlags changes flags of msg by flags set over IMAP.
+// The msg must not be stored as metadata after that.
+func txApplyAnsweredFlags(tx *bolt.Tx, msg *pmapi.Message) {
+	flags := txGetAnsweredFlags(tx.Bucket(answeredBucket), msg)
+	msg.Flags = msg.Flags&^answeredFlags | flags
+}
+
+// txResetAnsweredFlags forgets flags set over IMAP when API changes answered
+// flags of the message, e.g. when the message is replied in the web app.
+// It has to be called before the new metadata of msg are stored.
+func txResetAnsweredFlags(tx *bolt.Tx, msg *pmapi.Message) error {
+	b := tx.Bucket(answeredBucket)
+	if b.Get([]byte(msg.ID)) == nil {
+		return nil
+	}
+
+	msgb := tx.Bucket(metadataBucket).Get([]byte(msg.ID))
+	if msgb == nil {
+		return b.Delete([]byte(msg.ID))
+	}
+	stored := &struct{ Flags int64 }{}
+	if err := json.Unmarshal(msgb, stored); err != nil {
+		return err
+	}
+	if stored.Flags&answeredFlags != msg.Flags&answeredFlags {
+		return b.Delete([]byte(msg.ID))
+	}
+	return nil
+}
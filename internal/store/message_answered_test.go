@@ -0,0 +1,87 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func getInboxMessageFlags(t *testing.T, m *mocksForStore, apiID string) int64 {
+	msg, err := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].GetMessage(apiID)
+	require.NoError(t, err)
+	return msg.Message().Flags
+}
+
+func TestMarkMessagesAnsweredAndForwarded(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.MarkMessagesAnswered([]string{"msg1"}, true))
+	require.NoError(t, m.store.MarkMessagesForwarded([]string{"msg1"}, true))
+	require.Equal(t, int64(pmapi.FlagReplied|pmapi.FlagForwarded), getInboxMessageFlags(t, m, "msg1"))
+
+	require.NoError(t, m.store.MarkMessagesAnswered([]string{"msg1"}, false))
+	require.Equal(t, int64(pmapi.FlagForwarded), getInboxMessageFlags(t, m, "msg1"))
+
+	// Stored metadata keep flags of API.
+	msg, err := m.store.getMessageFromDB("msg1")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), msg.Flags)
+}
+
+func TestMarkMessagesAnsweredKeepsRepliedAll(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	msg := getTestMessage("msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.Flags = pmapi.FlagReceived | pmapi.FlagRepliedAll
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+
+	require.NoError(t, m.store.MarkMessagesAnswered([]string{"msg1"}, true))
+	require.Equal(t, int64(pmapi.FlagReceived|pmapi.FlagRepliedAll), getInboxMessageFlags(t, m, "msg1"))
+
+	require.NoError(t, m.store.MarkMessagesAnswered([]string{"msg1"}, false))
+	require.Equal(t, int64(pmapi.FlagReceived), getInboxMessageFlags(t, m, "msg1"))
+}
+
+func TestAnsweredFlagsAreResetByAPIChange(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.NoError(t, m.store.MarkMessagesForwarded([]string{"msg1"}, true))
+
+	// Event without change of answered flags keeps flags set over IMAP.
+	msg := getTestMessage("msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+	require.Equal(t, int64(pmapi.FlagForwarded), getInboxMessageFlags(t, m, "msg1"))
+
+	// Message replied in the web app uses flags of API.
+	msg = getTestMessage("msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg.Flags = pmapi.FlagReplied
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+	require.Equal(t, int64(pmapi.FlagReplied), getInboxMessageFlags(t, m, "msg1"))
+}
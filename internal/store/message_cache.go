@@ -0,0 +1,411 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// messageCache keeps built messages on disk so repeated FETCH and rebuild
+// of client's cache do not download and decrypt them again. Files are
+// encrypted by AES-GCM and named by keyed hash of message ID so neither
+// content nor IDs are readable without the key. The key is derived from
+// the secret by HKDF with random salt stored in the cache directory.
+//
+// When the size of cached messages exceeds maxSize, the least recently used
+// ones are removed. The time of the last use is the modification time of the
+// file so it is kept after restart.
+type messageCache struct {
+	hits   uint64 // Accessed atomically.
+	misses uint64 // Accessed atomically.
+
+	dir  string
+	key  []byte
+	aead cipher.AEAD
+
+	maxSize int64
+	size    int64
+	entries map[string]*messageCacheEntry // By file name.
+	lock    sync.Mutex
+}
+
+type messageCacheEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+const (
+	// messageCacheCheckFile contains keyed hash of its name to check the
+	// cache was written with the same key.
+	messageCacheCheckFile = "check"
+
+	// messageCacheSaltFile contains the random salt of key derivation.
+	messageCacheSaltFile = "salt"
+
+	// messageCacheKeyInfo binds the derived key to its use.
+	messageCacheKeyInfo = "proton-bridge message cache"
+
+	// messageCacheKeepRatio is the part of maxSize which is kept by eviction
+	// so it does not run on every save of full cache.
+	messageCacheKeepRatio = 0.9
+)
+
+func newMessageCache(dir string, secret []byte, maxSize int64) (*messageCache, error) {
+	key, err := deriveMessageCacheKey(dir, secret)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	mc := &messageCache{
+		dir:     dir,
+		key:     key,
+		aead:    aead,
+		maxSize: maxSize,
+		entries: map[string]*messageCacheEntry{},
+	}
+	if err := mc.checkKey(); err != nil {
+		return nil, err
+	}
+	if err := mc.loadEntries(); err != nil {
+		return nil, err
+	}
+	mc.evict()
+	return mc, nil
+}
+
+// deriveMessageCacheKey returns the key derived from the secret and the salt
+// of the cache in dir. The salt is created with the cache.
+func deriveMessageCacheKey(dir string, secret []byte) ([]byte, error) {
+	saltPath := filepath.Join(dir, messageCacheSaltFile)
+	salt, err := ioutil.ReadFile(saltPath) //nolint[gosec]
+	if err != nil || len(salt) != saltSize {
+		if salt, err = newSalt(); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(saltPath, salt, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	return deriveKey(secret, salt, messageCacheKeyInfo)
+}
+
+// checkKey removes all cached messages when the key changed, e.g. after
+// mailbox password was changed, because they cannot be read anymore.
+func (mc *messageCache) checkKey() error {
+	checkPath := filepath.Join(mc.dir, messageCacheCheckFile)
+	check := mc.name(messageCacheCheckFile)
+
+	if current, err := ioutil.ReadFile(checkPath); err == nil && string(current) == check { //nolint[gosec]
+		return nil
+	}
+	files, err := ioutil.ReadDir(mc.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Name() == messageCacheSaltFile {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(mc.dir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(checkPath, []byte(check), 0600)
+}
+
+// getMessageCachePath returns the directory of cached messages next to the
+// database file.
+func getMessageCachePath(storePath string) string {
+	return strings.TrimSuffix(storePath, filepath.Ext(storePath)) + ".cache"
+}
+
+// loadEntries reads sizes and times of the last use of cached messages.
+func (mc *messageCache) loadEntries() error {
+	files, err := ioutil.ReadDir(mc.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Name() == messageCacheCheckFile || file.Name() == messageCacheSaltFile {
+			continue
+		}
+		// Temporary file of interrupted save.
+		if filepath.Ext(file.Name()) != "" {
+			_ = os.Remove(filepath.Join(mc.dir, file.Name()))
+			continue
+		}
+		mc.entries[file.Name()] = &messageCacheEntry{size: file.Size(), lastUsed: file.ModTime()}
+		mc.size += file.Size()
+	}
+	return nil
+}
+
+func (mc *messageCache) name(apiID string) string {
+	mac := hmac.New(sha256.New, mc.key)
+	_, _ = mac.Write([]byte(apiID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (mc *messageCache) path(apiID string) string {
+	return filepath.Join(mc.dir, mc.name(apiID))
+}
+
+// used updates the time of the last use of cached message.
+func (mc *messageCache) used(name string) {
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(mc.dir, name), now, now)
+
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if entry, ok := mc.entries[name]; ok {
+		entry.lastUsed = now
+	}
+}
+
+func (mc *messageCache) added(name string, size int64) {
+	mc.lock.Lock()
+	if entry, ok := mc.entries[name]; ok {
+		mc.size -= entry.size
+	}
+	mc.entries[name] = &messageCacheEntry{size: size, lastUsed: time.Now()}
+	mc.size += size
+	mc.lock.Unlock()
+
+	mc.evict()
+}
+
+func (mc *messageCache) removed(name string) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if entry, ok := mc.entries[name]; ok {
+		mc.size -= entry.size
+		delete(mc.entries, name)
+	}
+}
+
+// evict removes the least recently used messages when the cache is over its
+// size. Metadata of messages are kept in the database.
+func (mc *messageCache) evict() {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if mc.size <= mc.maxSize {
+		return
+	}
+
+	names := make([]string, 0, len(mc.entries))
+	for name := range mc.entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return mc.entries[names[i]].lastUsed.Before(mc.entries[names[j]].lastUsed)
+	})
+
+	keepSize := int64(float64(mc.maxSize) * messageCacheKeepRatio)
+	for _, name := range names {
+		if mc.size <= keepSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(mc.dir, name)); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).Warn("Cannot evict cached message")
+			continue
+		}
+		mc.size -= mc.entries[name].size
+		delete(mc.entries, name)
+	}
+}
+
+// has returns whether the message is cached without reading it.
+func (mc *messageCache) has(apiID string) bool {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	_, ok := mc.entries[mc.name(apiID)]
+	return ok
+}
+
+// load returns the cached message or nil if it is not cached. Files which
+// cannot be decrypted, e.g. after the key changed, are removed.
+func (mc *messageCache) load(apiID string) ([]byte, error) {
+	name := mc.name(apiID)
+	data, err := ioutil.ReadFile(filepath.Join(mc.dir, name)) //nolint[gosec]
+	if os.IsNotExist(err) {
+		atomic.AddUint64(&mc.misses, 1)
+		mc.removed(name)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := mc.aead.NonceSize()
+	if len(data) < nonceSize {
+		_ = mc.remove(apiID)
+		return nil, errors.New("cached message is too short")
+	}
+	body, err := mc.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(apiID))
+	if err != nil {
+		_ = mc.remove(apiID)
+		return nil, errors.Wrap(err, "cannot decrypt cached message")
+	}
+	atomic.AddUint64(&mc.hits, 1)
+	mc.used(name)
+	return body, nil
+}
+
+// save encrypts the message to a temporary file which replaces the cached
+// one so readers never see partially written message.
+func (mc *messageCache) save(apiID string, body []byte) error {
+	nonce := make([]byte, mc.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := mc.aead.Seal(nonce, nonce, body, []byte(apiID))
+
+	// Message which does not fit is not cached at all.
+	if int64(len(data)) > mc.maxSize {
+		return nil
+	}
+
+	name := mc.name(apiID)
+	path := filepath.Join(mc.dir, name)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	mc.added(name, int64(len(data)))
+	return nil
+}
+
+// getStats returns numbers of loads which found and did not find the cached
+// message, and the number and size of cached messages.
+func (mc *messageCache) getStats() (hits, misses uint64, count int, size int64) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	return atomic.LoadUint64(&mc.hits), atomic.LoadUint64(&mc.misses), len(mc.entries), mc.size
+}
+
+func (mc *messageCache) remove(apiID string) error {
+	name := mc.name(apiID)
+	mc.removed(name)
+	if err := os.Remove(filepath.Join(mc.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// EnableMessageCache starts to keep built messages on disk encrypted by the
+// key derived from the secret. Messages are cached by IMAP when they are
+// built. When the size of cache exceeds maxSize bytes, the least recently
+// fetched ones are removed.
+func (store *Store) EnableMessageCache(secret []byte, maxSize int64) error {
+	mc, err := newMessageCache(getMessageCachePath(store.filePath), secret, maxSize)
+	if err != nil {
+		return err
+	}
+
+	store.messageCacheLock.Lock()
+	defer store.messageCacheLock.Unlock()
+
+	store.messageCache = mc
+	return nil
+}
+
+// RemoveMessageCache stops caching and removes all cached messages.
+func (store *Store) RemoveMessageCache() error {
+	store.messageCacheLock.Lock()
+	defer store.messageCacheLock.Unlock()
+
+	store.messageCache = nil
+	return os.RemoveAll(getMessageCachePath(store.filePath))
+}
+
+func (store *Store) getMessageCache() *messageCache {
+	store.messageCacheLock.RLock()
+	defer store.messageCacheLock.RUnlock()
+
+	return store.messageCache
+}
+
+// removeCachedMessage removes the message from disk cache if it is enabled.
+func (store *Store) removeCachedMessage(apiID string) {
+	if mc := store.getMessageCache(); mc != nil {
+		if err := mc.remove(apiID); err != nil {
+			store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot remove cached message")
+		}
+	}
+}
+
+// GetCachedBody returns the built message stored by SetCachedBody or nil if
+// it is not cached or the cache is not enabled.
+func (message *Message) GetCachedBody() ([]byte, error) {
+	mc := message.store.getMessageCache()
+	if mc == nil {
+		return nil, nil
+	}
+	return mc.load(message.msg.ID)
+}
+
+// SetCachedBody stores the built message on disk if the cache is enabled.
+// This should not trigger any IMAP update.
+func (message *Message) SetCachedBody(body []byte) error {
+	mc := message.store.getMessageCache()
+	if mc == nil {
+		return nil
+	}
+	return mc.save(message.msg.ID, body)
+}
+
+// HasCachedBody returns whether the built message is cached on disk.
+func (message *Message) HasCachedBody() bool {
+	mc := message.store.getMessageCache()
+	return mc != nil && mc.has(message.msg.ID)
+}
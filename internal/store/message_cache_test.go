@@ -0,0 +1,166 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageCache(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg, err := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].GetMessage("msg1")
+	require.NoError(t, err)
+	body := []byte("Subject: Test message 1\r\n\r\nsecret body")
+
+	// Nothing is cached until the cache is enabled.
+	require.NoError(t, msg.SetCachedBody(body))
+	cached, err := msg.GetCachedBody()
+	require.NoError(t, err)
+	a.Nil(t, cached)
+
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 1000))
+	a.False(t, msg.HasCachedBody())
+	require.NoError(t, msg.SetCachedBody(body))
+	a.True(t, msg.HasCachedBody())
+	cached, err = msg.GetCachedBody()
+	require.NoError(t, err)
+	a.Equal(t, body, cached)
+
+	// Neither the body nor the message ID is stored in plain text.
+	path := m.store.getMessageCache().path("msg1")
+	a.NotContains(t, path, "msg1")
+	data, err := ioutil.ReadFile(path) //nolint[gosec]
+	require.NoError(t, err)
+	a.NotContains(t, string(data), "secret body")
+
+	// Removed message is removed from the cache.
+	require.NoError(t, m.store.deleteMessageEvent("msg1"))
+	a.NoFileExists(t, path)
+}
+
+func TestMessageCacheKeyChanged(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg, err := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].GetMessage("msg1")
+	require.NoError(t, err)
+
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 1000))
+	require.NoError(t, msg.SetCachedBody([]byte("body")))
+
+	// Messages cached with the old key are removed.
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{2}, 32), 1000))
+	cached, err := msg.GetCachedBody()
+	require.NoError(t, err)
+	a.Nil(t, cached)
+	dir := getMessageCachePath(m.store.filePath)
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	a.ElementsMatch(t, []string{filepath.Join(dir, messageCacheCheckFile), filepath.Join(dir, messageCacheSaltFile)}, files)
+
+	// Corrupted file is removed.
+	require.NoError(t, ioutil.WriteFile(m.store.getMessageCache().path("msg1"), []byte("corrupted"), 0600))
+	_, err = msg.GetCachedBody()
+	require.Error(t, err)
+	cached, err = msg.GetCachedBody()
+	require.NoError(t, err)
+	a.Nil(t, cached)
+}
+
+func TestMessageCacheKeyDerivation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	secret := []byte("mailbox password")
+	mc1, err := newMessageCache(filepath.Join(dir, "cache1"), secret, 1000)
+	require.NoError(t, err)
+	mc2, err := newMessageCache(filepath.Join(dir, "cache2"), secret, 1000)
+	require.NoError(t, err)
+
+	// Caches with the same secret use different keys thanks to their salts.
+	a.NotEqual(t, mc1.key, mc2.key)
+	a.NotEqual(t, mc1.name("msg1"), mc2.name("msg1"))
+
+	// The salt is kept, so reopened cache reads cached messages.
+	require.NoError(t, mc1.save("msg1", []byte("body")))
+	mc1, err = newMessageCache(filepath.Join(dir, "cache1"), secret, 1000)
+	require.NoError(t, err)
+	body, err := mc1.load("msg1")
+	require.NoError(t, err)
+	a.Equal(t, []byte("body"), body)
+}
+
+func TestMessageCacheEviction(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	// Each encrypted message takes 128 bytes, the cache fits three of them.
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 400))
+	mc := m.store.getMessageCache()
+	body := bytes.Repeat([]byte{'a'}, 100)
+
+	require.NoError(t, mc.save("msg1", body))
+	require.NoError(t, mc.save("msg2", body))
+	require.NoError(t, mc.save("msg3", body))
+	_, err := mc.load("msg1")
+	require.NoError(t, err)
+
+	// The least recently used ones are removed down to 90 % of size.
+	require.NoError(t, mc.save("msg4", body))
+	checkCachedMessages(t, mc, []string{"msg1", "msg4"}, []string{"msg2", "msg3"})
+
+	// Too big message is not cached.
+	require.NoError(t, mc.save("msg5", bytes.Repeat([]byte{'a'}, 500)))
+	checkCachedMessages(t, mc, []string{"msg1", "msg4"}, []string{"msg5"})
+
+	// Smaller limit is applied to existing cache by the time of the last use.
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 200))
+	checkCachedMessages(t, m.store.getMessageCache(), []string{"msg4"}, []string{"msg1"})
+
+	require.NoError(t, m.store.RemoveMessageCache())
+	a.Nil(t, m.store.getMessageCache())
+	a.NoDirExists(t, getMessageCachePath(m.store.filePath))
+}
+
+func checkCachedMessages(t *testing.T, mc *messageCache, wantIDs, notWantIDs []string) {
+	for _, id := range wantIDs {
+		a.FileExists(t, mc.path(id), id)
+	}
+	for _, id := range notWantIDs {
+		a.NoFileExists(t, mc.path(id), id)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"strings"
+	"testing"
+
+	backendMessage "github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBodyStructure(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	msg, err := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].GetMessage("msg1")
+	require.NoError(t, err)
+
+	structure, err := msg.GetBodyStructure()
+	require.NoError(t, err)
+	require.Nil(t, structure)
+
+	built, err := backendMessage.NewBodyStructure(strings.NewReader("Content-Type: text/plain\r\n\r\nhello\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, msg.SetBodyStructure(built))
+
+	structure, err = msg.GetBodyStructure()
+	require.NoError(t, err)
+	require.Equal(t, built.Size(), structure.Size())
+
+	require.NoError(t, m.store.deleteMessageEvent("msg1"))
+	structure, err = msg.GetBodyStructure()
+	require.NoError(t, err)
+	require.Nil(t, structure)
+}
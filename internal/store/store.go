@@ -43,6 +43,14 @@ const (
 	UserFoldersMailboxName = "Folders"
 	// UserFoldersPrefix contains name with delimiter for IMAP
 	UserFoldersPrefix = UserFoldersMailboxName + PathDelimiter
+	// AddressNamespacesMailboxName for IMAP
+	AddressNamespacesMailboxName = "Addresses"
+	// AddressNamespacesPrefix contains name with delimiter for IMAP
+	AddressNamespacesPrefix = AddressNamespacesMailboxName + PathDelimiter
+	// SavedSearchesMailboxName for IMAP
+	SavedSearchesMailboxName = "Searches"
+	// SavedSearchesPrefix contains name with delimiter for IMAP
+	SavedSearchesPrefix = SavedSearchesMailboxName + PathDelimiter
 )
 
 var (
@@ -57,27 +65,97 @@ var (
 	//   * {index} -> {address, addressID}
 	// * address_mode
 	//   * mode -> string split or combined
+	//   * namespaces -> set when mailboxes of namespace addresses were filled
+	// * hidden_mailboxes
+	//   * {mailboxID} -> empty value when the mailbox is not listed over IMAP
+	// * delete_actions
+	//   * {mailboxID} -> string action of \Deleted flag (trash, archive or delete)
+	// * saved_searches
+	//   * {name} -> json query of mailbox listed under "Searches/"
+	// * excluded_mailboxes
+	//   * {mailboxID} -> empty value when messages of the mailbox are not synced
+	// * sync_limit
+	//   * months -> uint number of months of the newest messages which are synced (when missing, all are synced)
+	// * sync_windows
+	//   * {mailboxID} -> json window of the newest messages listed in mailbox
+	// * compaction
+	//   * last -> string unix time of the last compaction of the database
+	// * body_structures
+	//   * {messageID} -> json structure of built message
+	// * cached_attachments
+	//   * {attachmentID} -> string messageID of attachment kept in attachment cache
+	// * answered_flags
+	//   * {messageID} -> uint32 replied and forwarded flags set over IMAP (when missing, flags of API are used)
 	// * mailboxes_version
 	//     * version -> uint32 value
 	// * sync_state
 	//   * sync_state -> string timestamp when it was last synced (when missing, sync should be ongoing)
 	//   * ids_ranges -> json array of groups with start and end message ID (when missing, there is no ongoing sync)
-	//   * ids_to_be_deleted -> json array of message IDs to be deleted after sync (when missing, there is no ongoing sync)
+	//   * progress -> json number of all, synced messages and their size used to show progress of the sync
+	//   * ids_to_be_deleted -> json array of message IDs to be deleted after sync (old format, migrated to to_be_deleted)
+	//   * to_be_deleted (when missing, there is no ongoing sync)
+	//     * {messageID} -> empty value when message was not synced yet and will be deleted after sync
 	// * mailboxes
 	//   * {addressID+mailboxID}
 	//     * imap_ids
 	//       * {imapUID} -> string messageID
 	//     * api_ids
 	//       * {messageID} -> uint32 imapUID
-	metadataBucket    = []byte("metadata")          //nolint[gochecknoglobals]
-	countsBucket      = []byte("counts")            //nolint[gochecknoglobals]
-	addressInfoBucket = []byte("address_info")      //nolint[gochecknoglobals]
-	addressModeBucket = []byte("address_mode")      //nolint[gochecknoglobals]
-	syncStateBucket   = []byte("sync_state")        //nolint[gochecknoglobals]
-	mailboxesBucket   = []byte("mailboxes")         //nolint[gochecknoglobals]
-	imapIDsBucket     = []byte("imap_ids")          //nolint[gochecknoglobals]
-	apiIDsBucket      = []byte("api_ids")           //nolint[gochecknoglobals]
-	mboxVersionBucket = []byte("mailboxes_version") //nolint[gochecknoglobals]
+	//     * mod_seqs (sequence of bucket is the highest mod-sequence of mailbox)
+	//       * {imapUID} -> uint64 mod-sequence of the last change of message
+	//     * expunged
+	//       * {imapUID} -> uint64 mod-sequence when message was removed from mailbox
+	//     * deleted_ids
+	//       * {messageID} -> empty value when message is flagged as \Deleted and not expunged yet
+	//     * message_counts (when missing, counts were not computed yet)
+	//       * total -> uint32 number of messages in mailbox
+	//       * unread -> uint32 number of unread messages in mailbox
+	//       * unread_ids
+	//         * {messageID} -> empty value when message is unread
+	// * restored_uids (UIDs of the previous database not assigned yet, see store_uids.go)
+	//   * {addressID+mailboxID}
+	//     * api_ids (sequence of bucket is the highest UID of mailbox)
+	//       * {messageID} -> uint32 imapUID
+	//     * mod_seqs (sequence of bucket is the highest mod-sequence of mailbox)
+	// * fulltext
+	//   * salt -> random salt of the key derived from the mailbox password
+	//   * check -> keyed hash of "check" to detect change of the key
+	//   * tokens
+	//     * {hash of token of word}
+	//       * {messageID} -> empty value
+	//   * messages
+	//     * {messageID} -> version byte followed by hashes of all tokens of message
+	metadataBucket    = []byte("metadata")           //nolint[gochecknoglobals]
+	countsBucket      = []byte("counts")             //nolint[gochecknoglobals]
+	addressInfoBucket = []byte("address_info")       //nolint[gochecknoglobals]
+	addressModeBucket = []byte("address_mode")       //nolint[gochecknoglobals]
+	hiddenBucket      = []byte("hidden_mailboxes")   //nolint[gochecknoglobals]
+	deleteActsBucket  = []byte("delete_actions")     //nolint[gochecknoglobals]
+	searchesBucket    = []byte("saved_searches")     //nolint[gochecknoglobals]
+	syncWindowsBucket = []byte("sync_windows")       //nolint[gochecknoglobals]
+	windowsExtBucket  = []byte("sync_windows_ext")   //nolint[gochecknoglobals]
+	excludedBucket    = []byte("excluded_mailboxes") //nolint[gochecknoglobals]
+	syncLimitBucket   = []byte("sync_limit")         //nolint[gochecknoglobals]
+	compactionBucket  = []byte("compaction")         //nolint[gochecknoglobals]
+	answeredBucket    = []byte("answered_flags")     //nolint[gochecknoglobals]
+	structuresBucket  = []byte("body_structures")    //nolint[gochecknoglobals]
+	cachedAttsBucket  = []byte("cached_attachments") //nolint[gochecknoglobals]
+	syncStateBucket   = []byte("sync_state")         //nolint[gochecknoglobals]
+	toBeDeletedBucket = []byte("to_be_deleted")      //nolint[gochecknoglobals]
+	mailboxesBucket   = []byte("mailboxes")          //nolint[gochecknoglobals]
+	imapIDsBucket     = []byte("imap_ids")           //nolint[gochecknoglobals]
+	apiIDsBucket      = []byte("api_ids")            //nolint[gochecknoglobals]
+	modSeqsBucket     = []byte("mod_seqs")           //nolint[gochecknoglobals]
+	expungedBucket    = []byte("expunged")           //nolint[gochecknoglobals]
+	deletedIDsBucket  = []byte("deleted_ids")        //nolint[gochecknoglobals]
+	msgCountsBucket   = []byte("message_counts")     //nolint[gochecknoglobals]
+	unreadIDsBucket   = []byte("unread_ids")         //nolint[gochecknoglobals]
+	mboxVersionBucket = []byte("mailboxes_version")  //nolint[gochecknoglobals]
+	oldUIDsBucket     = []byte("restored_uids")      //nolint[gochecknoglobals]
+
+	fullTextBucket         = []byte("fulltext") //nolint[gochecknoglobals]
+	fullTextTokensBucket   = []byte("tokens")   //nolint[gochecknoglobals]
+	fullTextMessagesBucket = []byte("messages") //nolint[gochecknoglobals]
 
 	// ErrNoSuchAPIID when mailbox does not have API ID.
 	ErrNoSuchAPIID = errors.New("no such api id") //nolint[gochecknoglobals]
@@ -98,13 +176,34 @@ type Store struct {
 
 	cache       *Cache
 	filePath    string
-	db          *bolt.DB
+	uidsPath    string
+	db          *database
 	lock        *sync.RWMutex
 	addresses   map[string]*Address
 	imapUpdates chan interface{}
 
-	isSyncRunning bool
-	addressMode   addressMode
+	isSyncRunning   bool
+	isVerifyRunning bool
+	syncState       *syncState
+	addressMode     addressMode
+
+	onDemandFetches   map[string]time.Time // Last fetches of mailboxes on demand.
+	onDemandFetching  map[string]bool
+	onDemandFetchLock sync.Mutex
+
+	fullText     *fullTextIndex
+	fullTextLock sync.Mutex
+
+	messageCache     *messageCache
+	attachmentCache  *messageCache
+	messageCacheLock sync.RWMutex
+
+	usedSpace, maxSpace int64
+	spaceLock           sync.Mutex
+
+	keywords        map[string]string
+	keywordLabelIDs map[string]string
+	keywordsLock    sync.RWMutex
 }
 
 // New creates or opens a store for the given `user`.
@@ -114,6 +213,7 @@ func New(
 	api PMAPIProvider,
 	events listener.Listener,
 	path string,
+	uidsPath string,
 	cache *Cache,
 ) (store *Store, err error) {
 	if user == nil || api == nil || events == nil || cache == nil {
@@ -143,11 +243,18 @@ func New(
 		user:         user,
 		cache:        cache,
 		filePath:     path,
-		db:           bdb,
+		uidsPath:     uidsPath,
+		db:           newDatabase(bdb),
 		lock:         &sync.RWMutex{},
 		log:          l,
 	}
 
+	if firstInit {
+		if err := store.restoreUIDs(); err != nil {
+			l.WithError(err).Warn("Could not restore UIDs of previous database")
+		}
+	}
+
 	if err = store.init(firstInit); err != nil {
 		l.WithError(err).Error("Could not initialise store, attempting to close")
 		if storeCloseErr := store.Close(); storeCloseErr != nil {
@@ -157,6 +264,8 @@ func New(
 		return
 	}
 
+	store.compactIfDue()
+
 	if user.IsConnected() {
 		store.eventLoop = newEventLoop(cache, store, api, user, events)
 		go func() {
@@ -198,6 +307,50 @@ func openBoltDatabase(filePath string) (db *bolt.DB, err error) {
 			return
 		}
 
+		if _, err = tx.CreateBucketIfNotExists(hiddenBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(deleteActsBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(searchesBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(syncWindowsBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(windowsExtBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(excludedBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(syncLimitBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(compactionBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(answeredBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(structuresBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(cachedAttsBucket); err != nil {
+			return
+		}
+
 		if _, err = tx.CreateBucketIfNotExists(syncStateBucket); err != nil {
 			return
 		}
@@ -210,6 +363,23 @@ func openBoltDatabase(filePath string) (db *bolt.DB, err error) {
 			return
 		}
 
+		if _, err = tx.CreateBucketIfNotExists(oldUIDsBucket); err != nil {
+			return
+		}
+
+		var fullText *bolt.Bucket
+		if fullText, err = tx.CreateBucketIfNotExists(fullTextBucket); err != nil {
+			return
+		}
+
+		if _, err = fullText.CreateBucketIfNotExists(fullTextTokensBucket); err != nil {
+			return
+		}
+
+		if _, err = fullText.CreateBucketIfNotExists(fullTextMessagesBucket); err != nil {
+			return
+		}
+
 		return
 	}
 
@@ -258,6 +428,11 @@ func (store *Store) init(firstInit bool) (err error) {
 		return
 	}
 
+	if err = store.initNamespaces(); err != nil {
+		store.log.WithError(err).Error("Could not initialise namespaces of addresses")
+		return
+	}
+
 	return err
 }
 
@@ -292,7 +467,8 @@ func (store *Store) initCounts() (labels []*pmapi.Label, err error) {
 }
 
 // initAddresses creates address objects in the store for each necessary address.
-// In combined mode this means just one mailbox for all addresses but in split mode this means one mailbox per address.
+// In combined mode this means one mailbox for all addresses (and namespaces of secondary addresses) but in split
+// mode this means one mailbox per address.
 func (store *Store) initAddresses(labels []*pmapi.Label) (err error) {
 	store.addresses = make(map[string]*Address)
 
@@ -309,14 +485,41 @@ func (store *Store) initAddresses(labels []*pmapi.Label) (err error) {
 		return
 	}
 
-	// If in combined mode, we only need the user's primary address.
-	if store.addressMode == combinedMode {
-		addrInfo = addrInfo[:1]
-	}
+	return store.addAddresses(addrInfo, labels)
+}
 
-	for _, addr := range addrInfo {
-		if err = store.addAddress(addr.Address, addr.AddressID, labels); err != nil {
-			store.log.WithField("address", addr.Address).WithError(err).Error("Could not add address to store")
+// addAddresses adds addresses which are missing in the store. In combined
+// mode the user's primary address is the login address and other addresses
+// are its namespaces.
+func (store *Store) addAddresses(addrInfo []AddressInfo, labels []*pmapi.Label) (err error) {
+	var owner *Address
+	for i, addr := range addrInfo {
+		var namespaceOf *Address
+		if store.addressMode == combinedMode && i > 0 {
+			if owner == nil {
+				break
+			}
+			namespaceOf = owner
+		}
+
+		storeAddress, ok := store.addresses[addr.AddressID]
+		if !ok || storeAddress.owner != namespaceOf {
+			var addErr error
+			if namespaceOf != nil {
+				addErr = store.addNamespaceAddress(namespaceOf, addr.Address, addr.AddressID, labels)
+			} else {
+				addErr = store.addAddress(addr.Address, addr.AddressID, labels)
+			}
+			if addErr != nil {
+				store.log.WithField("address", addr.Address).WithError(addErr).Error("Could not add address to store")
+				err = addErr
+				continue
+			}
+			storeAddress = store.addresses[addr.AddressID]
+		}
+
+		if i == 0 {
+			owner = storeAddress
 		}
 	}
 
@@ -339,12 +542,24 @@ func (store *Store) addAddress(address, addressID string, labels []*pmapi.Label)
 	return
 }
 
+// addNamespaceAddress adds a new namespace address of the owner to the store.
+func (store *Store) addNamespaceAddress(owner *Address, address, addressID string, labels []*pmapi.Label) error {
+	addr, err := newNamespaceAddress(owner, address, addressID, labels)
+	if err != nil {
+		return errors.Wrap(err, "failed to create store namespace address object")
+	}
+
+	store.addresses[addressID] = addr
+
+	return nil
+}
+
 // Close stops the event loop and closes the database to free the file.
 func (store *Store) Close() error {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
-	return store.close()
+	return store.close(true)
 }
 
 // CloseEventLoop stops the eventloop (if it is present).
@@ -354,12 +569,36 @@ func (store *Store) CloseEventLoop() {
 	}
 }
 
-func (store *Store) close() error {
+// StartIdle makes the event loop poll events more often so updates reach
+// clients in IMAP IDLE quickly. Every call has to be followed by StopIdle.
+func (store *Store) StartIdle() {
+	if store.eventLoop != nil {
+		store.eventLoop.startIdle()
+	}
+}
+
+// StopIdle ends the faster polling started by StartIdle.
+func (store *Store) StopIdle() {
+	if store.eventLoop != nil {
+		store.eventLoop.stopIdle()
+	}
+}
+
+// close stops the event loop and closes the database. UIDs are saved only
+// when keepUIDs is set, a removed store does not leave them behind.
+func (store *Store) close(keepUIDs bool) error {
 	store.CloseEventLoop()
+	store.stopFullTextIndex()
+	if keepUIDs {
+		if err := store.saveUIDs(); err != nil {
+			store.log.WithError(err).Warn("Could not save UIDs")
+		}
+	}
 	return store.db.Close()
 }
 
-// Remove closes and removes the database file and clears the cache file.
+// Remove closes and removes the database file, saved UIDs and clears the
+// cache file.
 func (store *Store) Remove() (err error) {
 	store.lock.Lock()
 	defer store.lock.Unlock()
@@ -368,19 +607,19 @@ func (store *Store) Remove() (err error) {
 
 	var result *multierror.Error
 
-	if err = store.close(); err != nil {
+	if err = store.close(false); err != nil {
 		result = multierror.Append(result, errors.Wrap(err, "failed to close store"))
 	}
 
-	if err = RemoveStore(store.cache, store.filePath, store.user.ID()); err != nil {
+	if err = RemoveStore(store.cache, store.filePath, store.uidsPath, store.user.ID()); err != nil {
 		result = multierror.Append(result, errors.Wrap(err, "failed to remove store"))
 	}
 
 	return result.ErrorOrNil()
 }
 
-// RemoveStore removes the database file and clears the cache file.
-func RemoveStore(cache *Cache, path, userID string) error {
+// RemoveStore removes the database file, saved UIDs and clears the cache file.
+func RemoveStore(cache *Cache, path, uidsPath, userID string) error {
 	var result *multierror.Error
 
 	if err := cache.clearCacheUser(userID); err != nil {
@@ -392,5 +631,19 @@ func RemoveStore(cache *Cache, path, userID string) error {
 		result = multierror.Append(result, errors.Wrap(err, "failed to remove database file"))
 	}
 
+	if uidsPath != "" {
+		if err := os.RemoveAll(uidsPath); err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "failed to remove saved UIDs"))
+		}
+	}
+
+	if err := os.RemoveAll(getMessageCachePath(path)); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "failed to remove cached messages"))
+	}
+
+	if err := os.RemoveAll(getAttachmentCachePath(path)); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "failed to remove cached attachments"))
+	}
+
 	return result.ErrorOrNil()
 }
@@ -25,9 +25,10 @@ import (
 type addressMode string
 
 const (
-	splitMode    addressMode = "split"
-	combinedMode addressMode = "combined"
-	modeKey                  = "mode"
+	splitMode     addressMode = "split"
+	combinedMode  addressMode = "combined"
+	modeKey                   = "mode"
+	namespacesKey             = "namespaces"
 )
 
 // getAddressMode returns the current address mode (split or combined) of the store.
@@ -72,20 +73,26 @@ func (store *Store) UseCombinedMode(useCombined bool) (err error) {
 	return
 }
 
-// switchAddressMode sets the address mode to the given value and rebuilds the mailboxes.
+// switchAddressMode sets the address mode to the given value and projects
+// the synced messages to the mailboxes of the new mode.
 func (store *Store) switchAddressMode(mode addressMode) (err error) {
 	if store.addressMode == mode {
 		log.Debug("The store is using the correct address mode")
 		return
 	}
 
+	oldMode := store.addressMode
 	if err = store.setAddressMode(mode); err != nil {
 		log.WithError(err).Error("Could not set store address mode")
 		return
 	}
 
-	if err = store.RebuildMailboxes(); err != nil {
-		log.WithError(err).Error("Could not rebuild mailboxes after switching address mode")
+	if err = store.projectMailboxes(); err != nil {
+		log.WithError(err).Error("Could not project mailboxes after switching address mode")
+		// The addresses of the old mode were kept, so keep the mode too.
+		if revertErr := store.setAddressMode(oldMode); revertErr != nil {
+			log.WithError(revertErr).Error("Could not revert store address mode")
+		}
 		return
 	}
 
@@ -99,7 +106,11 @@ func (store *Store) setAddressMode(mode addressMode) (err error) {
 
 	tx := func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket(addressModeBucket)
-		return b.Put([]byte(modeKey), []byte(mode))
+		if err = b.Put([]byte(modeKey), []byte(mode)); err != nil {
+			return
+		}
+		// Mailboxes are built again for the new mode including namespaces.
+		return b.Put([]byte(namespacesKey), []byte{})
 	}
 
 	if err = store.db.Update(tx); err != nil {
@@ -110,3 +121,38 @@ func (store *Store) setAddressMode(mode addressMode) (err error) {
 
 	return
 }
+
+// initNamespaces fills mailboxes of namespace addresses in combined mode.
+// It is needed only once for stores synced before the secondary addresses
+// were namespaces, new messages are added by the event loop.
+func (store *Store) initNamespaces() error {
+	if store.addressMode != combinedMode {
+		return nil
+	}
+
+	isFilled := false
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		isFilled = tx.Bucket(addressModeBucket).Get([]byte(namespacesKey)) != nil
+		return nil
+	}); err != nil || isFilled {
+		return err
+	}
+
+	namespaces := map[string]*Address{}
+	for addressID, storeAddress := range store.addresses {
+		if storeAddress.isNamespace() {
+			namespaces[addressID] = storeAddress
+		}
+	}
+
+	if len(namespaces) != 0 {
+		store.log.WithField("namespaces", len(namespaces)).Info("Filling namespaces of addresses")
+		if err := store.fillMailboxes(namespaces); err != nil {
+			return err
+		}
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(addressModeBucket).Put([]byte(namespacesKey), []byte{})
+	})
+}
@@ -0,0 +1,383 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const lastCompactionKey = "last"
+
+var compactIntervalDays = int32(0) //nolint[gochecknoglobals]
+
+// SetCompactInterval sets after how many days the database is compacted when
+// the store is opened. Zero disables the scheduled compaction.
+func SetCompactInterval(days int) {
+	if days < 0 {
+		days = 0
+	}
+	atomic.StoreInt32(&compactIntervalDays, int32(days))
+}
+
+// CompactResult describes the outcome of the compaction.
+type CompactResult struct {
+	SizeBefore, SizeAfter   int64
+	PrunedEntries           int
+	PrunedCachedMessages    int
+	PrunedCachedAttachments int
+}
+
+// Compact removes data of messages which are not in the store anymore and
+// rewrites the database to a new file without free pages. The event loop
+// and indexing are paused and the integrity check cannot start meanwhile.
+// Other readers, e.g. IMAP clients, wait while the file is replaced.
+func (store *Store) Compact() (result CompactResult, err error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.isSyncRunning || store.isVerifyRunning {
+		return result, errors.New("sync is running")
+	}
+
+	store.CloseEventLoop()
+	ft := store.getFullTextIndex()
+	store.stopFullTextIndex()
+
+	result, err = store.compact()
+
+	if ft != nil {
+		store.startFullTextIndex(ft.key)
+	}
+	if store.eventLoop != nil {
+		go func() {
+			defer store.panicHandler.HandlePanic()
+			store.eventLoop.start()
+		}()
+	}
+	return result, err
+}
+
+// compactIfDue compacts the database when the scheduled interval passed
+// since the last compaction. It is called when the store is opened, before
+// the event loop starts and before the store is used by anything else, so
+// nothing has to be paused as in Compact.
+func (store *Store) compactIfDue() {
+	days := atomic.LoadInt32(&compactIntervalDays)
+	if days == 0 {
+		return
+	}
+	if last := store.getLastCompaction(); time.Since(last) < time.Duration(days)*24*time.Hour {
+		return
+	}
+	if _, err := store.compact(); err != nil {
+		store.log.WithError(err).Error("Scheduled compaction of store failed")
+	}
+}
+
+func (store *Store) compact() (result CompactResult, err error) {
+	path := store.db.Path()
+	if result.SizeBefore, err = getFileSize(path); err != nil {
+		return
+	}
+
+	if err = store.db.Update(func(tx *bolt.Tx) (err error) {
+		result.PrunedEntries, err = txPruneOrphans(tx)
+		return
+	}); err != nil {
+		return result, errors.Wrap(err, "cannot prune orphaned entries")
+	}
+	if result.PrunedCachedMessages, err = store.pruneMessageCache(); err != nil {
+		return result, errors.Wrap(err, "cannot prune message cache")
+	}
+	if result.PrunedCachedAttachments, err = store.pruneAttachmentCache(); err != nil {
+		return result, errors.Wrap(err, "cannot prune attachment cache")
+	}
+
+	// IMAP connections and other readers wait until the file is replaced.
+	if err = store.db.replace(copyDatabase); err != nil {
+		return result, errors.Wrap(err, "cannot compact database")
+	}
+
+	if err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(compactionBucket).Put([]byte(lastCompactionKey), []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	}); err != nil {
+		return
+	}
+
+	result.SizeAfter, err = getFileSize(path)
+
+	store.log.WithFields(logrus.Fields{
+		"sizeBefore":        result.SizeBefore,
+		"sizeAfter":         result.SizeAfter,
+		"prunedEntries":     result.PrunedEntries,
+		"prunedMessages":    result.PrunedCachedMessages,
+		"prunedAttachments": result.PrunedCachedAttachments,
+	}).Info("Store compacted")
+	return result, err
+}
+
+func (store *Store) getLastCompaction() (last time.Time) {
+	_ = store.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(compactionBucket).Get([]byte(lastCompactionKey))
+		if unix, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			last = time.Unix(unix, 0)
+		}
+		return nil
+	})
+	return
+}
+
+// txPruneOrphans removes data kept by message ID for messages which are not
+// in the metadata bucket anymore.
+func txPruneOrphans(tx *bolt.Tx) (pruned int, err error) {
+	metaBucket := tx.Bucket(metadataBucket)
+	isOrphan := func(apiID []byte) bool {
+		return metaBucket.Get(apiID) == nil
+	}
+
+	for _, bucketName := range [][]byte{answeredBucket, structuresBucket} {
+		orphans := getOrphanKeys(tx.Bucket(bucketName), isOrphan)
+		for _, apiID := range orphans {
+			if err = tx.Bucket(bucketName).Delete(apiID); err != nil {
+				return
+			}
+		}
+		pruned += len(orphans)
+	}
+
+	orphans := getOrphanKeys(tx.Bucket(fullTextBucket).Bucket(fullTextMessagesBucket), isOrphan)
+	for _, apiID := range orphans {
+		if err = txRemoveFullText(tx, string(apiID)); err != nil {
+			return
+		}
+	}
+	pruned += len(orphans)
+
+	return pruned, nil
+}
+
+// getOrphanKeys returns copies of keys so they can be deleted after.
+func getOrphanKeys(b *bolt.Bucket, isOrphan func([]byte) bool) (keys [][]byte) {
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if isOrphan(k) {
+			keys = append(keys, append([]byte{}, k...))
+		}
+	}
+	return
+}
+
+// pruneMessageCache removes cached messages which are not in the store.
+func (store *Store) pruneMessageCache() (pruned int, err error) {
+	mc := store.getMessageCache()
+	if mc == nil {
+		return 0, nil
+	}
+
+	known := map[string]bool{}
+	if err = store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataBucket).ForEach(func(apiID, _ []byte) error {
+			known[mc.name(string(apiID))] = true
+			return nil
+		})
+	}); err != nil {
+		return
+	}
+
+	return store.pruneCacheFiles(mc, known)
+}
+
+// pruneAttachmentCache removes cached attachments of messages which are not
+// in the store.
+func (store *Store) pruneAttachmentCache() (pruned int, err error) {
+	ac := store.getAttachmentCache()
+
+	known := map[string]bool{}
+	if err = store.db.Update(func(tx *bolt.Tx) error {
+		metaBucket := tx.Bucket(metadataBucket)
+		attsBucket := tx.Bucket(cachedAttsBucket)
+		orphans := getOrphanKeys(attsBucket, func(attachmentID []byte) bool {
+			return metaBucket.Get(attsBucket.Get(attachmentID)) == nil
+		})
+		for _, attachmentID := range orphans {
+			if err := attsBucket.Delete(attachmentID); err != nil {
+				return err
+			}
+		}
+		if ac == nil {
+			return nil
+		}
+		return attsBucket.ForEach(func(attachmentID, _ []byte) error {
+			known[ac.name(string(attachmentID))] = true
+			return nil
+		})
+	}); err != nil || ac == nil {
+		return
+	}
+
+	return store.pruneCacheFiles(ac, known)
+}
+
+// pruneCacheFiles removes files of the cache which are not known.
+func (store *Store) pruneCacheFiles(mc *messageCache, known map[string]bool) (pruned int, err error) {
+	files, err := ioutil.ReadDir(mc.dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		// Files with extension are messages being saved.
+		if known[file.Name()] || filepath.Ext(file.Name()) != "" {
+			continue
+		}
+		if file.Name() == messageCacheCheckFile || file.Name() == messageCacheSaltFile {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mc.dir, file.Name())); err != nil && !os.IsNotExist(err) {
+			store.log.WithError(err).Warn("Cannot remove orphaned cached file")
+			continue
+		}
+		mc.removed(file.Name())
+		pruned++
+	}
+	return pruned, nil
+}
+
+// compactTxMaxSize is the size of keys and values written in one transaction
+// of copyDatabase. Bolt keeps all changed pages in memory until commit, so the
+// copy is committed in parts to not need memory for the whole database.
+var compactTxMaxSize = int64(8 * 1024 * 1024) //nolint[gochecknoglobals]
+
+// copyDatabase writes all buckets of the database to a new file which has
+// no free pages.
+func copyDatabase(src *bolt.DB, dstPath string) error {
+	dst, err := bolt.Open(dstPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	// The file is synced once at the end; it is removed when the copy fails.
+	dst.NoSync = true
+
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return copyInBatches(srcTx, dst)
+	})
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// copyInBatches walks all buckets of the source transaction and writes them
+// to dst in transactions of at most compactTxMaxSize bytes. The buckets are
+// found again by their path in every new transaction.
+func copyInBatches(srcTx *bolt.Tx, dst *bolt.DB) error {
+	dstTx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dstTx.Rollback() }()
+
+	var size int64
+	err = walkBuckets(srcTx, func(path [][]byte, k, v []byte, seq uint64) error {
+		if size += int64(len(k) + len(v)); size > compactTxMaxSize {
+			if err := dstTx.Commit(); err != nil {
+				return err
+			}
+			if dstTx, err = dst.Begin(true); err != nil {
+				return err
+			}
+			size = int64(len(k) + len(v))
+		}
+
+		// Sequence is used, e.g., as the highest mod-sequence of mailbox.
+		if len(path) == 0 {
+			b, err := dstTx.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return b.SetSequence(seq)
+		}
+
+		parent := dstTx.Bucket(path[0])
+		for _, name := range path[1:] {
+			parent = parent.Bucket(name)
+		}
+		// Keys are inserted in order so pages can be filled completely.
+		parent.FillPercent = 1
+
+		if v == nil {
+			b, err := parent.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return b.SetSequence(seq)
+		}
+		return parent.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	return dstTx.Commit()
+}
+
+// walkBuckets calls fn for every bucket and key in the transaction. Path is
+// the list of names of parent buckets, nil value means the key is a bucket
+// with sequence seq.
+func walkBuckets(tx *bolt.Tx, fn func(path [][]byte, k, v []byte, seq uint64) error) error {
+	return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return walkBucket(b, nil, name, nil, b.Sequence(), fn)
+	})
+}
+
+func walkBucket(b *bolt.Bucket, path [][]byte, k, v []byte, seq uint64, fn func(path [][]byte, k, v []byte, seq uint64) error) error {
+	if err := fn(path, k, v, seq); err != nil {
+		return err
+	}
+	if v != nil {
+		return nil
+	}
+
+	// Path is copied so nested calls do not share the slice.
+	path = append(append([][]byte{}, path...), k)
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			child := b.Bucket(k)
+			return walkBucket(child, path, k, nil, child.Sequence(), fn)
+		}
+		return walkBucket(nil, path, k, v, 0, fn)
+	})
+}
+
+func getFileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCompact(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	stopEventLoop(t, m)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	highestModSeq, err := inbox.GetHighestModSeq()
+	require.NoError(t, err)
+
+	// Data of removed message left behind.
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 1000))
+	mc := m.store.getMessageCache()
+	require.NoError(t, mc.save("msg1", []byte("body 1")))
+	require.NoError(t, mc.save("msg3", []byte("body 3")))
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(answeredBucket).Put([]byte("msg3"), itob(1)); err != nil {
+			return err
+		}
+		return tx.Bucket(structuresBucket).Put([]byte("msg3"), []byte("{}"))
+	}))
+
+	a.True(t, m.store.getLastCompaction().IsZero())
+
+	result, err := m.store.Compact()
+	require.NoError(t, err)
+	a.Equal(t, 2, result.PrunedEntries)
+	a.Equal(t, 1, result.PrunedCachedMessages)
+	a.NotZero(t, result.SizeAfter)
+	a.False(t, m.store.getLastCompaction().IsZero())
+
+	// Everything else is kept.
+	checkSavedSearchMessages(t, inbox, []string{"msg1", "msg2"})
+	checkMailboxCounts(t, inbox, 2, 0)
+	newHighestModSeq, err := inbox.GetHighestModSeq()
+	require.NoError(t, err)
+	a.Equal(t, highestModSeq, newHighestModSeq)
+
+	body, err := mc.load("msg1")
+	require.NoError(t, err)
+	a.Equal(t, []byte("body 1"), body)
+	a.NoFileExists(t, mc.path("msg3"))
+	a.FileExists(t, filepath.Join(mc.dir, messageCacheSaltFile))
+
+	// Store is usable after compaction.
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkSavedSearchMessages(t, inbox, []string{"msg1", "msg2", "msg3"})
+}
+
+func TestCompactIfDue(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	stopEventLoop(t, m)
+
+	m.store.compactIfDue()
+	a.True(t, m.store.getLastCompaction().IsZero())
+
+	SetCompactInterval(7)
+	defer SetCompactInterval(0)
+
+	m.store.compactIfDue()
+	last := m.store.getLastCompaction()
+	a.False(t, last.IsZero())
+
+	// Not repeated before the interval passed.
+	setLastCompaction(t, m, time.Now().AddDate(0, 0, -6))
+	m.store.compactIfDue()
+	a.True(t, m.store.getLastCompaction().Before(time.Now().AddDate(0, 0, -5)))
+
+	setLastCompaction(t, m, time.Now().AddDate(0, 0, -8))
+	m.store.compactIfDue()
+	a.True(t, m.store.getLastCompaction().After(time.Now().Add(-time.Minute)))
+}
+
+func TestCompactWithConcurrentReaders(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	stopEventLoop(t, m)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	done := make(chan struct{})
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(readErr)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := inbox.GetHighestModSeq(); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		_, err := m.store.Compact()
+		require.NoError(t, err)
+	}
+	close(done)
+	a.NoError(t, <-readErr)
+	checkSavedSearchMessages(t, inbox, []string{"msg1"})
+}
+
+func TestCompactKeepsDatabaseWhenNewFileIsBroken(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	stopEventLoop(t, m)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	err := m.store.db.replace(func(_ *bolt.DB, dstPath string) error {
+		return ioutil.WriteFile(dstPath, []byte("not a database"), 0600)
+	})
+	a.Error(t, err)
+
+	checkSavedSearchMessages(t, inbox, []string{"msg1"})
+	a.NoFileExists(t, m.store.filePath+".compact")
+	a.NoFileExists(t, m.store.filePath+".backup")
+}
+
+func TestCopyDatabaseInBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compact")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	src, err := bolt.Open(filepath.Join(dir, "src.db"), 0600, nil)
+	require.NoError(t, err)
+	defer src.Close() //nolint[errcheck]
+
+	require.NoError(t, src.Update(func(tx *bolt.Tx) error {
+		for i := 0; i < 3; i++ {
+			b, err := tx.CreateBucket([]byte("bucket" + strconv.Itoa(i)))
+			if err != nil {
+				return err
+			}
+			if err := b.SetSequence(uint64(i + 10)); err != nil {
+				return err
+			}
+			child, err := b.CreateBucket([]byte("child"))
+			if err != nil {
+				return err
+			}
+			if err := child.SetSequence(uint64(i + 20)); err != nil {
+				return err
+			}
+			for j := 0; j < 10; j++ {
+				if err := b.Put([]byte("key"+strconv.Itoa(j)), []byte("value")); err != nil {
+					return err
+				}
+				if err := child.Put([]byte("key"+strconv.Itoa(j)), []byte("child value")); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}))
+
+	defer func(size int64) { compactTxMaxSize = size }(compactTxMaxSize)
+	compactTxMaxSize = 20
+
+	dstPath := filepath.Join(dir, "dst.db")
+	require.NoError(t, copyDatabase(src, dstPath))
+
+	dst, err := bolt.Open(dstPath, 0600, nil)
+	require.NoError(t, err)
+	defer dst.Close() //nolint[errcheck]
+
+	a.Equal(t, dumpDatabase(t, src), dumpDatabase(t, dst))
+}
+
+// dumpDatabase returns all keys, values and sequences of buckets by path.
+func dumpDatabase(t *testing.T, db *bolt.DB) map[string]string {
+	dump := map[string]string{}
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		return walkBuckets(tx, func(path [][]byte, k, v []byte, seq uint64) error {
+			key := string(bytes.Join(append(path, k), []byte("/")))
+			if v == nil {
+				dump[key] = "sequence " + strconv.FormatUint(seq, 10)
+			} else {
+				dump[key] = string(v)
+			}
+			return nil
+		})
+	}))
+	return dump
+}
+
+func setLastCompaction(t *testing.T, m *mocksForStore, last time.Time) {
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(compactionBucket).Put([]byte(lastCompactionKey), []byte(strconv.FormatInt(last.Unix(), 10)))
+	}))
+}
+
+// stopEventLoop waits for the first sync to finish and removes the event
+// loop so nothing uses the database while it is closed and the loop is not
+// started again after compaction, which could race with closing of store.
+func stopEventLoop(t *testing.T, m *mocksForStore) {
+	require.Eventually(t, func() bool {
+		m.store.lock.RLock()
+		defer m.store.lock.RUnlock()
+		return !m.store.isSyncRunning && m.store.isSyncFinished()
+	}, time.Second, 10*time.Millisecond)
+
+	m.store.CloseEventLoop()
+	m.store.eventLoop = nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeleteAction is what happens to messages flagged as \Deleted in mailbox.
+type DeleteAction string
+
+// Delete actions which can be set per mailbox.
+const (
+	// DeleteActionDefault removes messages from the mailbox; messages in
+	// Trash and Spam without other labels are deleted permanently.
+	DeleteActionDefault DeleteAction = ""
+	// DeleteActionTrash moves messages to Trash.
+	DeleteActionTrash DeleteAction = "trash"
+	// DeleteActionArchive moves messages to Archive.
+	DeleteActionArchive DeleteAction = "archive"
+	// DeleteActionPermanent deletes messages permanently from the server,
+	// as expected by POP-style clients removing mail from server.
+	DeleteActionPermanent DeleteAction = "delete"
+)
+
+// DeleteActions are all actions which can be set.
+var DeleteActions = []DeleteAction{DeleteActionDefault, DeleteActionTrash, DeleteActionArchive, DeleteActionPermanent} //nolint[gochecknoglobals]
+
+// GetDeleteAction returns what happens to messages flagged as \Deleted in
+// the mailbox with labelID.
+func (store *Store) GetDeleteAction(labelID string) (action DeleteAction) {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		action = DeleteAction(tx.Bucket(deleteActsBucket).Get([]byte(labelID)))
+		return nil
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read delete actions")
+	}
+	return
+}
+
+// SetDeleteAction sets what happens to messages flagged as \Deleted in the
+// mailbox with labelID.
+func (store *Store) SetDeleteAction(labelID string, action DeleteAction) error {
+	if !isDeleteAction(action) {
+		return errors.Errorf("unknown delete action %q", action)
+	}
+
+	store.log.WithField("labelID", labelID).WithField("action", action).Info("Setting delete action")
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deleteActsBucket)
+		if action == DeleteActionDefault {
+			return b.Delete([]byte(labelID))
+		}
+		return b.Put([]byte(labelID), []byte(action))
+	})
+}
+
+// GetMailboxLabelID returns label ID of the mailbox with IMAP name.
+func (store *Store) GetMailboxLabelID(name string) (string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	for _, address := range store.addresses {
+		for labelID, mailbox := range address.mailboxes {
+			if mailbox.Name() == name {
+				return labelID, nil
+			}
+		}
+	}
+	return "", errors.Errorf("mailbox %v does not exist", name)
+}
+
+func isDeleteAction(action DeleteAction) bool {
+	for _, knownAction := range DeleteActions {
+		if knownAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteActionTarget returns label ID of mailbox the messages are moved to
+// by the action, or empty string when they are not moved.
+func deleteActionTarget(action DeleteAction) string {
+	switch action {
+	case DeleteActionTrash:
+		return pmapi.TrashLabel
+	case DeleteActionArchive:
+		return pmapi.ArchiveLabel
+	default:
+		return ""
+	}
+}
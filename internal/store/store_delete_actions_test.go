@@ -0,0 +1,96 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDeleteAction(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	a.Equal(t, DeleteActionDefault, m.store.GetDeleteAction(pmapi.InboxLabel))
+
+	require.NoError(t, m.store.SetDeleteAction(pmapi.InboxLabel, DeleteActionPermanent))
+	a.Equal(t, DeleteActionPermanent, m.store.GetDeleteAction(pmapi.InboxLabel))
+	a.Equal(t, DeleteActionDefault, m.store.GetDeleteAction(pmapi.SentLabel))
+
+	require.NoError(t, m.store.SetDeleteAction(pmapi.InboxLabel, DeleteActionDefault))
+	a.Equal(t, DeleteActionDefault, m.store.GetDeleteAction(pmapi.InboxLabel))
+
+	require.Error(t, m.store.SetDeleteAction(pmapi.InboxLabel, DeleteAction("shred")))
+}
+
+func TestGetMailboxLabelID(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	labelID, err := m.store.GetMailboxLabelID("INBOX")
+	require.NoError(t, err)
+	a.Equal(t, pmapi.InboxLabel, labelID)
+
+	_, err = m.store.GetMailboxLabelID("Folders/missing")
+	require.Error(t, err)
+}
+
+func TestDeleteMessagesWithDeleteAction(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	storeMailbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+
+	require.NoError(t, m.store.SetDeleteAction(pmapi.InboxLabel, DeleteActionArchive))
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel)
+	require.NoError(t, storeMailbox.DeleteMessages([]string{"msg1"}))
+
+	require.NoError(t, m.store.SetDeleteAction(pmapi.InboxLabel, DeleteActionPermanent))
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.TrashLabel)
+	m.api.EXPECT().DeleteMessages([]string{"msg1"})
+	require.NoError(t, storeMailbox.DeleteMessages([]string{"msg1"}))
+
+	require.NoError(t, m.store.SetDeleteAction(pmapi.InboxLabel, DeleteActionDefault))
+	m.api.EXPECT().UnlabelMessages([]string{"msg1"}, pmapi.InboxLabel)
+	require.NoError(t, storeMailbox.DeleteMessages([]string{"msg1"}))
+}
+
+func TestCanDeleteMessagesInVirtualMailbox(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+
+	a.False(t, inbox.IsVirtual())
+	a.True(t, inbox.CanDeleteMessages())
+	a.True(t, allMail.IsVirtual())
+	a.False(t, allMail.CanDeleteMessages())
+
+	require.NoError(t, m.store.SetDeleteAction(pmapi.AllMailLabel, DeleteActionTrash))
+	a.True(t, allMail.CanDeleteMessages())
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// IsMailboxExcluded returns whether messages of the mailbox with labelID
+// are not synced.
+func (store *Store) IsMailboxExcluded(labelID string) (excluded bool) {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		excluded = tx.Bucket(excludedBucket).Get([]byte(labelID)) != nil
+		return nil
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read excluded mailboxes")
+	}
+	return
+}
+
+func (store *Store) hasExcludedMailboxes() (hasExcluded bool) {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(excludedBucket).Cursor().First()
+		hasExcluded = key != nil
+		return nil
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read excluded mailboxes")
+	}
+	return
+}
+
+// SetMailboxExcluded sets whether messages of the mailbox with labelID are
+// synced. Excluded mailbox is still listed over IMAP and its messages are
+// fetched from the server when a client opens it. Messages which are only
+// in excluded mailboxes are removed from the database. When the mailbox is
+// included again, the sync is started to get its messages.
+func (store *Store) SetMailboxExcluded(labelID string, excluded bool) error {
+	store.lock.Lock()
+
+	mailboxes := []*Mailbox{}
+	for _, a := range store.addresses {
+		if mailbox, ok := a.mailboxes[labelID]; ok {
+			mailboxes = append(mailboxes, mailbox)
+		}
+	}
+	if len(mailboxes) == 0 || mailboxes[0].IsVirtual() || labelID == pmapi.DraftLabel {
+		store.lock.Unlock()
+		return errors.Errorf("mailbox %v cannot be excluded from sync", labelID)
+	}
+
+	store.log.WithField("labelID", labelID).WithField("excluded", excluded).Info("Setting mailbox exclusion from sync")
+
+	toBeDeleted := []string{}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(excludedBucket)
+		if !excluded {
+			return b.Delete([]byte(labelID))
+		}
+		if err := b.Put([]byte(labelID), []byte{}); err != nil {
+			return err
+		}
+
+		for _, mailbox := range mailboxes {
+			ids, _, err := mailbox.txGetMessageTimes(tx)
+			if err != nil {
+				return err
+			}
+			for _, apiID := range ids {
+				if msg, err := store.txGetMessage(tx, apiID); err == nil && txIsOnlyInExcludedMailboxes(tx, msg) {
+					toBeDeleted = append(toBeDeleted, apiID)
+					continue
+				}
+				if err := mailbox.txDeleteMessage(tx, apiID); err != nil {
+					return err
+				}
+			}
+			if err := mailbox.txMailboxStatusUpdate(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	store.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !excluded {
+		store.triggerSync()
+		return nil
+	}
+	return store.deleteMessagesEvent(toBeDeleted)
+}
+
+// txIsOnlyInExcludedMailboxes returns whether all mailboxes of the message
+// except All Mail are excluded from sync.
+func txIsOnlyInExcludedMailboxes(tx *bolt.Tx, msg *pmapi.Message) bool {
+	b := tx.Bucket(excludedBucket)
+	hasMailbox := false
+	for _, labelID := range msg.LabelIDs {
+		if labelID == pmapi.AllMailLabel || skipThisLabel(labelID) {
+			continue
+		}
+		if b.Get([]byte(labelID)) == nil {
+			return false
+		}
+		hasMailbox = true
+	}
+	return hasMailbox
+}
+
+// txIsInExcludedMailbox returns whether the message was fetched on demand
+// to any of its excluded mailboxes.
+func (store *Store) txIsInExcludedMailbox(tx *bolt.Tx, msg *pmapi.Message) bool {
+	for _, a := range store.addresses {
+		for _, labelID := range msg.LabelIDs {
+			if labelID == pmapi.AllMailLabel || skipThisLabel(labelID) {
+				continue
+			}
+			if mailbox, ok := a.mailboxes[labelID]; ok && mailbox.txGetAPIIDsBucket(tx).Get([]byte(msg.ID)) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcludedMailbox(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.SetMailboxExcluded(pmapi.ArchiveLabel, true))
+	a.True(t, m.store.IsMailboxExcluded(pmapi.ArchiveLabel))
+
+	// Message only in excluded mailbox is removed completely.
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	archive := m.store.addresses[addrID1].mailboxes[pmapi.ArchiveLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+	checkSavedSearchMessages(t, inbox, []string{"msg1", "msg3"})
+	checkSavedSearchMessages(t, archive, nil)
+	checkSavedSearchMessages(t, allMail, []string{"msg1", "msg3"})
+	checkAllMessageIDs(t, m, []string{"msg1", "msg3"})
+
+	// New messages are not added to excluded mailbox.
+	insertMessage(t, m, "msg4", "Test message 4", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg5", "Test message 5", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel, pmapi.InboxLabel})
+	checkSavedSearchMessages(t, archive, nil)
+	checkAllMessageIDs(t, m, []string{"msg1", "msg3", "msg5"})
+
+	// Message moved only to excluded mailbox is removed.
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	checkSavedSearchMessages(t, inbox, []string{"msg3", "msg5"})
+	checkAllMessageIDs(t, m, []string{"msg3", "msg5"})
+}
+
+func TestExcludedMailboxFetchedOnDemand(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.NoError(t, m.store.SetMailboxExcluded(pmapi.ArchiveLabel, true))
+
+	m.api.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{
+		getTestMessage("msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel}),
+		getTestMessage("msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel}),
+	}, 2, nil)
+
+	archive := m.store.addresses[addrID1].mailboxes[pmapi.ArchiveLabel]
+	require.True(t, m.store.startOnDemandFetch(pmapi.ArchiveLabel))
+	require.NoError(t, archive.fetchOnDemand(0))
+	m.store.finishOnDemandFetch(pmapi.ArchiveLabel)
+
+	checkSavedSearchMessages(t, archive, []string{"msg2", "msg1"})
+	checkAllMessageIDs(t, m, []string{"msg1", "msg2"})
+
+	// Fetched messages are kept updated.
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	checkSavedSearchMessages(t, archive, []string{"msg2", "msg1"})
+
+	// Fetch is not repeated right away.
+	a.False(t, m.store.startOnDemandFetch(pmapi.ArchiveLabel))
+}
+
+func TestExcludedMailboxIsSynced(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.NoError(t, m.store.SetMailboxExcluded(pmapi.ArchiveLabel, true))
+
+	// Messages of excluded mailbox are missing also in All Mail.
+	isSynced, err := m.store.isSynced([]*pmapi.MessagesCount{
+		{LabelID: pmapi.AllMailLabel, Total: 3},
+		{LabelID: pmapi.InboxLabel, Total: 1},
+		{LabelID: pmapi.ArchiveLabel, Total: 2},
+	})
+	require.NoError(t, err)
+	a.True(t, isSynced)
+}
+
+func TestExcludedMailboxNotAllowed(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Error(t, m.store.SetMailboxExcluded(pmapi.AllMailLabel, true))
+	require.Error(t, m.store.SetMailboxExcluded(pmapi.DraftLabel, true))
+	require.Error(t, m.store.SetMailboxExcluded("unknown", true))
+}
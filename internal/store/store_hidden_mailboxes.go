@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// HideableMailboxes are IDs of system mailboxes which can be hidden from
+// IMAP LIST. All Mail contains copies of messages of all other mailboxes
+// so clients syncing everything download every message twice, the same
+// applies to Unread and Starred.
+var HideableMailboxes = []string{pmapi.AllMailLabel, pmapi.SpamLabel, pmapi.TrashLabel, VirtualUnreadLabel, VirtualStarredLabel} //nolint[gochecknoglobals]
+
+// IsMailboxHidden returns whether the mailbox with labelID is not listed
+// over IMAP.
+func (store *Store) IsMailboxHidden(labelID string) (hidden bool) {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		hidden = tx.Bucket(hiddenBucket).Get([]byte(labelID)) != nil
+		return nil
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read hidden mailboxes")
+	}
+	return
+}
+
+// SetMailboxHidden sets whether the mailbox with labelID is listed over
+// IMAP. The mailbox can still be selected by clients which know its name.
+func (store *Store) SetMailboxHidden(labelID string, hidden bool) error {
+	if !isHideableMailbox(labelID) {
+		return errors.Errorf("mailbox %v cannot be hidden", labelID)
+	}
+
+	store.log.WithField("labelID", labelID).WithField("hidden", hidden).Info("Setting mailbox visibility")
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(hiddenBucket)
+		if hidden {
+			return b.Put([]byte(labelID), []byte{})
+		}
+		return b.Delete([]byte(labelID))
+	})
+}
+
+func isHideableMailbox(labelID string) bool {
+	for _, hideableID := range HideableMailboxes {
+		if hideableID == labelID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMailboxHidden(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	a.False(t, m.store.IsMailboxHidden(pmapi.AllMailLabel))
+
+	require.NoError(t, m.store.SetMailboxHidden(pmapi.AllMailLabel, true))
+	a.True(t, m.store.IsMailboxHidden(pmapi.AllMailLabel))
+	a.False(t, m.store.IsMailboxHidden(pmapi.SpamLabel))
+
+	require.NoError(t, m.store.SetMailboxHidden(pmapi.AllMailLabel, false))
+	a.False(t, m.store.IsMailboxHidden(pmapi.AllMailLabel))
+}
+
+func TestSetMailboxHiddenNotHideable(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Error(t, m.store.SetMailboxHidden(pmapi.InboxLabel, true))
+	a.False(t, m.store.IsMailboxHidden(pmapi.InboxLabel))
+}
@@ -0,0 +1,358 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// triggerVerify starts the integrity check of the store in background.
+// It does nothing when the sync or the previous check is still running.
+func (store *Store) triggerVerify() {
+	go func() {
+		defer store.panicHandler.HandlePanic()
+
+		store.lock.Lock()
+		if store.isSyncRunning || store.isVerifyRunning {
+			store.lock.Unlock()
+			return
+		}
+		store.isVerifyRunning = true
+		store.lock.Unlock()
+
+		defer func() {
+			store.lock.Lock()
+			store.isVerifyRunning = false
+			store.lock.Unlock()
+		}()
+
+		if err := store.verifyIntegrity(); err != nil {
+			store.log.WithError(err).Warn("Store integrity check failed")
+		}
+	}()
+}
+
+// verifyIntegrity cross-checks local metadata with the server and repairs
+// drift in place, so wrong counts do not need a new sync to be fixed.
+// First, UIDs and numbers of messages of every mailbox are checked to match
+// the stored messages. Then mailboxes with counts different from counts on
+// API are compared message by message: missing and outdated messages are
+// updated and messages which are not on the server anymore are removed.
+// Nothing is checked before the sync is finished because it replaces all
+// data anyway.
+func (store *Store) verifyIntegrity() error {
+	if !store.isSyncFinished() {
+		return nil
+	}
+
+	store.log.Debug("Verifying store integrity")
+
+	if err := store.repairMailboxIndexes(); err != nil {
+		return errors.Wrap(err, "cannot repair mailbox indexes")
+	}
+
+	// Only part of messages is synced when the sync is limited by time.
+	if store.GetSyncMonths() != 0 {
+		return nil
+	}
+
+	countsOnAPI, err := store.api.CountMessages("")
+	if err != nil {
+		return errors.Wrap(err, "cannot get counts from server")
+	}
+	if err := store.createOrUpdateOnAPICounts(countsOnAPI); err != nil {
+		return errors.Wrap(err, "cannot update counts from server")
+	}
+
+	labelIDs, err := store.getLabelsWithDifferentCounts()
+	if err != nil {
+		return err
+	}
+
+	for _, labelID := range labelIDs {
+		store.log.WithField("label", labelID).Warn("Repairing messages of mailbox with wrong counts")
+		if err := store.repairLabelMessages(labelID); err != nil {
+			return errors.Wrapf(err, "cannot repair messages of label %q", labelID)
+		}
+	}
+
+	return nil
+}
+
+// repairMailboxIndexes removes UIDs which do not point to stored messages
+// or which are not mapped both ways and recounts mailboxes which do not
+// match their messages.
+func (store *Store) repairMailboxIndexes() error {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for _, address := range store.addresses {
+			for _, mailbox := range address.mailboxes {
+				// Messages of searches are matched again by every change.
+				if mailbox.IsSearch() {
+					continue
+				}
+				if err := mailbox.txRepairIndex(tx); err != nil {
+					return errors.Wrapf(err, "cannot repair mailbox %q", mailbox.labelName)
+				}
+				if err := mailbox.txRepairCounts(tx); err != nil {
+					return errors.Wrapf(err, "cannot recount mailbox %q", mailbox.labelName)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (storeMailbox *Mailbox) txRepairIndex(tx *bolt.Tx) error {
+	metaBucket := tx.Bucket(metadataBucket)
+	imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+	apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+
+	// Keys are copied because they must not be used after the bucket is changed.
+	brokenUIDs := [][]byte{}
+	c := imapBucket.Cursor()
+	for uidb, apiIDb := c.First(); uidb != nil; uidb, apiIDb = c.Next() {
+		if metaBucket.Get(apiIDb) == nil || !bytes.Equal(apiBucket.Get(apiIDb), uidb) {
+			brokenUIDs = append(brokenUIDs, append([]byte{}, uidb...))
+		}
+	}
+	brokenAPIIDs := [][]byte{}
+	c = apiBucket.Cursor()
+	for apiIDb, uidb := c.First(); apiIDb != nil; apiIDb, uidb = c.Next() {
+		if metaBucket.Get(apiIDb) == nil || !bytes.Equal(imapBucket.Get(uidb), apiIDb) {
+			brokenAPIIDs = append(brokenAPIIDs, append([]byte{}, apiIDb...))
+		}
+	}
+
+	if len(brokenUIDs) == 0 && len(brokenAPIIDs) == 0 {
+		return nil
+	}
+
+	storeMailbox.log.WithFields(logrus.Fields{
+		"uids":   len(brokenUIDs),
+		"apiIDs": len(brokenAPIIDs),
+	}).Warn("Removing broken UIDs from mailbox")
+
+	// Messages are removed from the end so sequence numbers of the rest
+	// are still valid for clients.
+	for i := len(brokenUIDs) - 1; i >= 0; i-- {
+		uidb := brokenUIDs[i]
+		seqNum, err := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
+		if err != nil {
+			return err
+		}
+		if err := imapBucket.Delete(uidb); err != nil {
+			return errors.Wrap(err, "cannot delete from IMAP bucket")
+		}
+		if err := storeMailbox.txExpungeModSeq(tx, uidb); err != nil {
+			return err
+		}
+		storeMailbox.store.imapDeleteMessage(
+			storeMailbox.storeAddress.loginAddress(),
+			storeMailbox.labelName,
+			seqNum,
+		)
+	}
+	for _, apiIDb := range brokenAPIIDs {
+		if err := apiBucket.Delete(apiIDb); err != nil {
+			return errors.Wrap(err, "cannot delete from API bucket")
+		}
+		if err := storeMailbox.txGetDeletedIDsBucket(tx).Delete(apiIDb); err != nil {
+			return errors.Wrap(err, "cannot delete from deleted IDs bucket")
+		}
+	}
+
+	return storeMailbox.txResetCounts(tx)
+}
+
+// txRepairCounts recounts the mailbox when the kept numbers do not match
+// its messages.
+func (storeMailbox *Mailbox) txRepairCounts(tx *bolt.Tx) error {
+	if storeMailbox.txGetCountsBucket(tx) == nil {
+		return nil
+	}
+	total, unread, err := storeMailbox.txGetCounts(tx)
+	if err != nil {
+		return err
+	}
+	realTotal, realUnread, err := storeMailbox.txCountMessages(tx, nil)
+	if err != nil {
+		return err
+	}
+	if total == realTotal && unread == realUnread {
+		return nil
+	}
+
+	storeMailbox.log.WithFields(logrus.Fields{
+		"total":      total,
+		"unread":     unread,
+		"realTotal":  realTotal,
+		"realUnread": realUnread,
+	}).Warn("Recounting mailbox")
+
+	return storeMailbox.txResetCounts(tx)
+}
+
+// txResetCounts counts messages of the mailbox again from scratch.
+func (storeMailbox *Mailbox) txResetCounts(tx *bolt.Tx) error {
+	b := storeMailbox.txGetBucket(tx)
+	if b.Bucket(msgCountsBucket) != nil {
+		if err := b.DeleteBucket(msgCountsBucket); err != nil {
+			return err
+		}
+	}
+	if _, err := storeMailbox.txInitCounts(tx); err != nil {
+		return err
+	}
+	return storeMailbox.txMailboxStatusUpdate(tx)
+}
+
+// getLabelsWithDifferentCounts returns IDs of labels whose local counts do
+// not match the counts on API.
+func (store *Store) getLabelsWithDifferentCounts() ([]string, error) {
+	allCounts, err := store.getOnAPICounts()
+	if err != nil {
+		return nil, err
+	}
+
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	hasExcluded := store.hasExcludedMailboxes()
+
+	labelIDs := []string{}
+	for _, counts := range allCounts {
+		if !store.isLabelFullySynced(counts.LabelID, hasExcluded) {
+			continue
+		}
+		total, unread, err := store.getLabelCounts(counts.LabelID)
+		if err != nil {
+			return nil, err
+		}
+		if total != counts.TotalOnAPI || unread != counts.UnreadOnAPI {
+			labelIDs = append(labelIDs, counts.LabelID)
+		}
+	}
+	return labelIDs, nil
+}
+
+// repairLabelMessages updates all messages of the label from the server.
+// Local messages not listed under the label are fetched by ID to update
+// their labels or to remove them when they do not exist anymore.
+func (store *Store) repairLabelMessages(labelID string) error {
+	onAPI := map[string]bool{}
+	for page := 0; ; page++ {
+		msgs, _, err := store.api.ListMessages(&pmapi.MessagesFilter{
+			LabelID:  labelID,
+			Page:     page,
+			PageSize: maxFilterPageSize,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot list messages")
+		}
+		for _, msg := range msgs {
+			onAPI[msg.ID] = true
+		}
+		if err := store.createOrUpdateMessagesEvent(msgs); err != nil {
+			return errors.Wrap(err, "cannot update messages")
+		}
+		if len(msgs) < maxFilterPageSize {
+			break
+		}
+	}
+
+	localIDs, err := store.getLabelAPIIDs(labelID)
+	if err != nil {
+		return err
+	}
+	notListed := []string{}
+	for _, apiID := range localIDs {
+		if !onAPI[apiID] {
+			notListed = append(notListed, apiID)
+		}
+	}
+
+	for len(notListed) > 0 {
+		chunk := notListed
+		if len(chunk) > maxFilterPageSize {
+			chunk = chunk[:maxFilterPageSize]
+		}
+		notListed = notListed[len(chunk):]
+
+		msgs, _, err := store.api.ListMessages(&pmapi.MessagesFilter{
+			ID:       chunk,
+			PageSize: maxFilterPageSize,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot list messages by ID")
+		}
+		found := map[string]bool{}
+		for _, msg := range msgs {
+			found[msg.ID] = true
+		}
+		if err := store.createOrUpdateMessagesEvent(msgs); err != nil {
+			return errors.Wrap(err, "cannot update messages")
+		}
+
+		deleted := []string{}
+		for _, apiID := range chunk {
+			if !found[apiID] {
+				deleted = append(deleted, apiID)
+			}
+		}
+		if len(deleted) > 0 {
+			store.log.WithField("messages", len(deleted)).Warn("Removing messages which are not on server")
+			if err := store.deleteMessagesEvent(deleted); err != nil {
+				return errors.Wrap(err, "cannot delete messages")
+			}
+		}
+	}
+
+	return nil
+}
+
+// getLabelAPIIDs returns IDs of all local messages of the label.
+func (store *Store) getLabelAPIIDs(labelID string) (apiIDs []string, err error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		for _, address := range store.addresses {
+			if address.isNamespace() {
+				continue
+			}
+			mailbox, err := address.getMailboxByID(labelID)
+			if err != nil {
+				return err
+			}
+			c := mailbox.txGetAPIIDsBucket(tx).Cursor()
+			for apiIDb, _ := c.First(); apiIDb != nil; apiIDb, _ = c.Next() {
+				apiIDs = append(apiIDs, string(apiIDb))
+			}
+		}
+		return nil
+	})
+	return
+}
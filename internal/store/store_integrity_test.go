@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRepairMailboxIndexes(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Break UID mapping of one message and counts of the other mailbox.
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		if err := inbox.txGetAPIIDsBucket(tx).Delete([]byte("msg1")); err != nil {
+			return err
+		}
+		return allMail.txGetCountsBucket(tx).Put(totalCountKey, itob(5))
+	}))
+
+	require.NoError(t, m.store.repairMailboxIndexes())
+
+	checkSavedSearchMessages(t, inbox, []string{"msg2"})
+	checkMailboxCounts(t, inbox, 1, 0)
+	checkSavedSearchMessages(t, allMail, []string{"msg1", "msg2"})
+	checkMailboxCounts(t, allMail, 2, 1)
+}
+
+func TestVerifyIntegrityRepairsMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	m.store.loadSyncState().setFinishTime()
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Server has msg1 unread, msg2 deleted and msg3 new.
+	msg1 := getTestMessage("msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg3 := getTestMessage("msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	m.api.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{
+		{LabelID: pmapi.AllMailLabel, Total: 2, Unread: 1},
+		{LabelID: pmapi.InboxLabel, Total: 2, Unread: 1},
+	}, nil)
+	m.api.EXPECT().ListMessages(gomock.Any()).DoAndReturn(func(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+		if filter.LabelID != "" {
+			return []*pmapi.Message{msg1, msg3}, 2, nil
+		}
+		a.Equal(t, []string{"msg2"}, filter.ID)
+		return nil, 0, nil
+	}).AnyTimes()
+
+	require.NoError(t, m.store.verifyIntegrity())
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	checkSavedSearchMessages(t, inbox, []string{"msg1", "msg3"})
+	checkMailboxCounts(t, inbox, 2, 1)
+	checkAllMessageIDs(t, m, []string{"msg1", "msg3"})
+}
+
+func TestVerifyIntegrityNotBeforeSync(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	m.store.loadSyncState().clearFinishTime()
+
+	// No API call is expected.
+	require.NoError(t, m.store.verifyIntegrity())
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Metrics are statistics of the store used for troubleshooting.
+type Metrics struct {
+	Mailboxes []MailboxMetrics
+
+	// CacheHits and CacheMisses count loads of message bodies from the disk
+	// cache since it was enabled. Both are zero when the cache is disabled.
+	CacheEnabled   bool
+	CacheHits      uint64
+	CacheMisses    uint64
+	CachedMessages int
+	CacheSize      int64
+
+	// LastPollTime is the time of the last successful poll of events and
+	// EventLag is the time since then. Both are zero before the first poll.
+	LastPollTime time.Time
+	EventLag     time.Duration
+
+	// LastSyncTime is zero when the sync was never finished.
+	LastSyncTime time.Time
+	IsSyncing    bool
+}
+
+// MailboxMetrics are numbers of messages in the mailbox.
+type MailboxMetrics struct {
+	Address string
+	Name    string
+	Total   uint
+	Unread  uint
+}
+
+// CacheHitRate returns the part of loads of message bodies which were found
+// in the disk cache, or zero when nothing was loaded yet.
+func (metrics Metrics) CacheHitRate() float64 {
+	loads := metrics.CacheHits + metrics.CacheMisses
+	if loads == 0 {
+		return 0
+	}
+	return float64(metrics.CacheHits) / float64(loads)
+}
+
+// GetMetrics returns the current statistics of the store.
+func (store *Store) GetMetrics() (Metrics, error) {
+	metrics := Metrics{}
+
+	mailboxes, err := store.getMailboxMetrics()
+	if err != nil {
+		return metrics, err
+	}
+	metrics.Mailboxes = mailboxes
+
+	if mc := store.getMessageCache(); mc != nil {
+		metrics.CacheEnabled = true
+		metrics.CacheHits, metrics.CacheMisses, metrics.CachedMessages, metrics.CacheSize = mc.getStats()
+	}
+
+	store.lock.RLock()
+	eventLoop, isSyncRunning, syncState := store.eventLoop, store.isSyncRunning, store.syncState
+	store.lock.RUnlock()
+
+	if eventLoop != nil {
+		metrics.LastPollTime = eventLoop.getLastPollTime()
+		if !metrics.LastPollTime.IsZero() {
+			metrics.EventLag = time.Since(metrics.LastPollTime)
+		}
+	}
+
+	if syncState == nil {
+		syncState = store.loadSyncState()
+	}
+	metrics.LastSyncTime = syncState.getFinishTime()
+	metrics.IsSyncing = isSyncRunning
+
+	return metrics, nil
+}
+
+// getMailboxMetrics returns counts of all mailboxes except searches sorted
+// by address and name.
+func (store *Store) getMailboxMetrics() ([]MailboxMetrics, error) {
+	store.lock.RLock()
+	mailboxes := []*Mailbox{}
+	for _, storeAddress := range store.addresses {
+		for _, mailbox := range storeAddress.mailboxes {
+			if !mailbox.IsSearch() {
+				mailboxes = append(mailboxes, mailbox)
+			}
+		}
+	}
+	store.lock.RUnlock()
+
+	metrics := make([]MailboxMetrics, 0, len(mailboxes))
+	for _, mailbox := range mailboxes {
+		total, unread, err := mailbox.GetCounts()
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, MailboxMetrics{
+			Address: mailbox.storeAddress.address,
+			Name:    mailbox.Name(),
+			Total:   total,
+			Unread:  unread,
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Address != metrics[j].Address {
+			return metrics[i].Address < metrics[j].Address
+		}
+		return metrics[i].Name < metrics[j].Name
+	})
+
+	return metrics, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMetrics(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	metrics, err := m.store.GetMetrics()
+	require.NoError(t, err)
+	a.Contains(t, metrics.Mailboxes, MailboxMetrics{Address: addr1, Name: "INBOX", Total: 2, Unread: 1})
+	a.False(t, metrics.CacheEnabled)
+	a.False(t, metrics.IsSyncing)
+	a.False(t, metrics.LastSyncTime.IsZero())
+
+	require.NoError(t, m.store.EnableMessageCache(bytes.Repeat([]byte{1}, 32), 1000))
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	msg1, err := inbox.GetMessage("msg1")
+	require.NoError(t, err)
+	require.NoError(t, msg1.SetCachedBody([]byte("body")))
+	for i := 0; i < 3; i++ {
+		_, err = msg1.GetCachedBody()
+		require.NoError(t, err)
+	}
+	msg2, err := inbox.GetMessage("msg2")
+	require.NoError(t, err)
+	_, err = msg2.GetCachedBody()
+	require.NoError(t, err)
+
+	metrics, err = m.store.GetMetrics()
+	require.NoError(t, err)
+	a.True(t, metrics.CacheEnabled)
+	a.Equal(t, uint64(3), metrics.CacheHits)
+	a.Equal(t, uint64(1), metrics.CacheMisses)
+	a.Equal(t, 0.75, metrics.CacheHitRate())
+	a.Equal(t, 1, metrics.CachedMessages)
+
+	require.Eventually(t, func() bool {
+		metrics, err = m.store.GetMetrics()
+		return err == nil && !metrics.LastPollTime.IsZero()
+	}, time.Second, 10*time.Millisecond)
+	a.True(t, metrics.EventLag < time.Minute)
+}
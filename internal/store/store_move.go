@@ -0,0 +1,126 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// MoveStore moves the closed database file at path together with cached
+// messages and attachments to newPath. Files are renamed when possible and
+// copied to other disks. The database is copied completely before the
+// original is removed, so a failed move keeps the store at path. Caches are
+// only removed when they cannot be moved because messages can be downloaded
+// again.
+func MoveStore(path, newPath string) error {
+	if _, err := os.Stat(newPath); err == nil {
+		return errors.Errorf("database %v already exists", newPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+		return errors.Wrap(err, "failed to create directory")
+	}
+
+	// Logged out user does not need to have any database.
+	if err := moveFile(path, newPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to move database file")
+	}
+
+	for _, paths := range [][2]string{
+		{getMessageCachePath(path), getMessageCachePath(newPath)},
+		{getAttachmentCachePath(path), getAttachmentCachePath(newPath)},
+	} {
+		if err := moveDir(paths[0], paths[1]); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).WithField("path", paths[0]).Warn("Cannot move cache, removing it")
+			_ = os.RemoveAll(paths[1])
+			_ = os.RemoveAll(paths[0])
+		}
+	}
+	return nil
+}
+
+func moveFile(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// Rename fails between disks; the copy gets the final name only when
+	// it is complete.
+	tmp := dst + ".tmp"
+	if err := copyFile(src, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func moveDir(src, dst string) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, file.Name()), filepath.Join(dst, file.Name())); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src) //nolint[gosec]
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint[errcheck]
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
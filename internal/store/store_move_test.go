@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-move-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "old", "mailbox-user.db")
+	newPath := filepath.Join(dir, "new", "mailbox-user.db")
+	require.NoError(t, os.MkdirAll(getMessageCachePath(path), 0700))
+	require.NoError(t, ioutil.WriteFile(path, []byte("database"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(getMessageCachePath(path), "message"), []byte("cached"), 0600))
+
+	require.NoError(t, MoveStore(path, newPath))
+
+	data, err := ioutil.ReadFile(newPath) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "database", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(getMessageCachePath(newPath), "message")) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "cached", string(data))
+	_, err = os.Stat(path)
+	a.True(t, os.IsNotExist(err))
+	_, err = os.Stat(getMessageCachePath(path))
+	a.True(t, os.IsNotExist(err))
+
+	// Existing database is not overwritten.
+	require.NoError(t, ioutil.WriteFile(path, []byte("other"), 0600))
+	require.Error(t, MoveStore(path, newPath))
+	data, err = ioutil.ReadFile(path) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "other", string(data))
+
+	// Store of logged out user does not need to exist.
+	require.NoError(t, MoveStore(filepath.Join(dir, "missing.db"), filepath.Join(dir, "new", "missing.db")))
+}
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-move-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	src := filepath.Join(dir, "src")
+	require.NoError(t, ioutil.WriteFile(src, []byte("data"), 0600))
+	require.NoError(t, copyFile(src, filepath.Join(dir, "dst")))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dst")) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "data", string(data))
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import "sync/atomic"
+
+const (
+	// PrefetchDefaultCount is the default number of the newest messages of
+	// every mailbox which are built in background after the sync.
+	PrefetchDefaultCount = 20
+	// PrefetchMaxCount limits the prefetch so it does not download whole
+	// mailboxes.
+	PrefetchMaxCount = 500
+)
+
+var prefetchCount = int32(PrefetchDefaultCount) //nolint[gochecknoglobals]
+
+// SetPrefetchCount sets how many of the newest messages of every mailbox are
+// built in background after the sync so the first fetch by client is served
+// from cache. Zero disables the prefetch, values over PrefetchMaxCount are
+// limited.
+func SetPrefetchCount(count int) {
+	if count < 0 {
+		count = 0
+	}
+	if count > PrefetchMaxCount {
+		count = PrefetchMaxCount
+	}
+	atomic.StoreInt32(&prefetchCount, int32(count))
+}
+
+// GetPrefetchCount returns the number of the newest messages of every mailbox
+// to prefetch.
+func GetPrefetchCount() int {
+	return int(atomic.LoadInt32(&prefetchCount))
+}
+
+// IsSyncFinished returns whether the sync of all messages finished and no
+// other sync is running.
+func (store *Store) IsSyncFinished() bool {
+	store.lock.RLock()
+	isSyncRunning, syncState := store.isSyncRunning, store.syncState
+	store.lock.RUnlock()
+
+	if isSyncRunning {
+		return false
+	}
+	if syncState == nil {
+		syncState = store.loadSyncState()
+	}
+	return syncState.isFinished()
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPrefetchCount(t *testing.T) {
+	defer SetPrefetchCount(PrefetchDefaultCount)
+
+	SetPrefetchCount(-1)
+	a.Equal(t, 0, GetPrefetchCount())
+
+	SetPrefetchCount(50)
+	a.Equal(t, 50, GetPrefetchCount())
+
+	SetPrefetchCount(PrefetchMaxCount + 1)
+	a.Equal(t, PrefetchMaxCount, GetPrefetchCount())
+}
+
+func TestIsSyncFinished(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	// The first sync saves its state only after the last page was listed.
+	require.Eventually(t, m.store.IsSyncFinished, time.Second, 10*time.Millisecond)
+
+	m.store.lock.Lock()
+	m.store.isSyncRunning = true
+	m.store.lock.Unlock()
+	a.False(t, m.store.IsSyncFinished())
+
+	m.store.lock.Lock()
+	m.store.isSyncRunning = false
+	m.store.lock.Unlock()
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// savedSearchLabelIDPrefix is the prefix of IDs of mailboxes of saved
+// searches. The IDs are never sent to API.
+const savedSearchLabelIDPrefix = "search:"
+
+// IDs of built-in virtual mailboxes listed next to system mailboxes.
+const (
+	VirtualUnreadLabel  = "virtual:unread"
+	VirtualStarredLabel = "virtual:starred"
+)
+
+// builtInSearches are queries of built-in virtual mailboxes by their IDs.
+var builtInSearches = map[string]SavedSearch{ //nolint[gochecknoglobals]
+	VirtualUnreadLabel:  {Name: "Unread", Unread: true},
+	VirtualStarredLabel: {Name: "Starred", LabelID: pmapi.StarredLabel},
+}
+
+// SavedSearch is the query of the virtual mailbox listed under "Searches/".
+// Message matches when it matches all set criteria, text is compared
+// case-insensitively.
+type SavedSearch struct {
+	Name    string
+	From    string `json:",omitempty"` // Part of sender address or name.
+	Subject string `json:",omitempty"` // Part of subject.
+	LabelID string `json:",omitempty"` // Folder or label of message.
+	Unread  bool   `json:",omitempty"` // Only unread messages.
+}
+
+func (search *SavedSearch) labelID() string {
+	return savedSearchLabelIDPrefix + search.Name
+}
+
+func (search *SavedSearch) getPMLabel(labelID string) *pmapi.Label {
+	return &pmapi.Label{
+		ID:   labelID,
+		Name: search.Name,
+	}
+}
+
+func (search *SavedSearch) validate() error {
+	if search.Name == "" || strings.Contains(search.Name, PathDelimiter) {
+		return errors.Errorf("invalid name %q of saved search", search.Name)
+	}
+	if search.From == "" && search.Subject == "" && search.LabelID == "" && !search.Unread {
+		return errors.New("saved search has no criteria")
+	}
+	return nil
+}
+
+func (search *SavedSearch) matches(msg *pmapi.Message) bool {
+	if search.From != "" {
+		if msg.Sender == nil {
+			return false
+		}
+		if !containsFold(msg.Sender.Address, search.From) && !containsFold(msg.Sender.Name, search.From) {
+			return false
+		}
+	}
+	if search.Subject != "" && !containsFold(msg.Subject, search.Subject) {
+		return false
+	}
+	if search.Unread && msg.Unread != 1 {
+		return false
+	}
+	if search.LabelID == "" {
+		return true
+	}
+	for _, labelID := range msg.LabelIDs {
+		if labelID == search.LabelID {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func isSavedSearchLabel(labelID string) bool {
+	return strings.HasPrefix(labelID, savedSearchLabelIDPrefix)
+}
+
+func isBuiltInSearchLabel(labelID string) bool {
+	_, ok := builtInSearches[labelID]
+	return ok
+}
+
+// ListSavedSearches returns all saved searches sorted by name.
+func (store *Store) ListSavedSearches() (searches []SavedSearch) {
+	err := store.db.View(func(tx *bolt.Tx) (err error) {
+		searches, err = txListSavedSearches(tx)
+		return
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read saved searches")
+	}
+	return
+}
+
+func txListSavedSearches(tx *bolt.Tx) ([]SavedSearch, error) {
+	searches := []SavedSearch{}
+	err := tx.Bucket(searchesBucket).ForEach(func(k, v []byte) error {
+		search := SavedSearch{}
+		if err := json.Unmarshal(v, &search); err != nil {
+			return err
+		}
+		searches = append(searches, search)
+		return nil
+	})
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].Name < searches[j].Name
+	})
+	return searches, err
+}
+
+// AddSavedSearch saves the search and creates its mailbox for each login
+// address. The mailbox is filled by messages already synced, further changes
+// are applied by the event loop as for other mailboxes.
+func (store *Store) AddSavedSearch(search SavedSearch) error {
+	if err := search.validate(); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.log.WithField("search", search.Name).Info("Adding saved search")
+
+	added := map[*Address]*Mailbox{}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(searchesBucket)
+		if b.Get([]byte(search.Name)) != nil {
+			return errors.Errorf("saved search %v already exists", search.Name)
+		}
+		value, err := json.Marshal(search)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(search.Name), value); err != nil {
+			return err
+		}
+
+		for _, a := range store.addresses {
+			if a.isNamespace() {
+				continue
+			}
+			mailbox, err := txNewSearchMailbox(tx, a, search.labelID(), search)
+			if err != nil {
+				return err
+			}
+			if err := store.txFillMailboxes(tx, []*Mailbox{mailbox}); err != nil {
+				return err
+			}
+			added[a] = mailbox
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for a, mailbox := range added {
+		a.mailboxes[mailbox.labelID] = mailbox
+		a.updateMailboxNames()
+	}
+	return nil
+}
+
+// txNewSearchMailbox creates the mailbox with labelID listing messages
+// matching the search.
+func txNewSearchMailbox(tx *bolt.Tx, storeAddress *Address, labelID string, search SavedSearch) (*Mailbox, error) {
+	mb, err := txNewMailbox(tx, storeAddress, search.getPMLabel(labelID))
+	if err != nil {
+		return nil, err
+	}
+	mb.search = &search
+	return mb, nil
+}
+
+// RemoveSavedSearch removes the search together with its mailboxes.
+func (store *Store) RemoveSavedSearch(name string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.log.WithField("search", name).Info("Removing saved search")
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(searchesBucket)
+		if b.Get([]byte(name)) == nil {
+			return errors.Errorf("saved search %v does not exist", name)
+		}
+		return b.Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+
+	labelID := (&SavedSearch{Name: name}).labelID()
+	for _, a := range store.addresses {
+		if _, ok := a.mailboxes[labelID]; !ok {
+			continue
+		}
+		if err := a.deleteMailboxEvent(labelID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
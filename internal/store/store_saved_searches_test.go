@@ -0,0 +1,133 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSavedSearchMailbox(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessage(t, m, "msg1", "Invoice 1", "alice@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "invoice 2", "bob@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg3", "Hello", "alice@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.AddSavedSearch(SavedSearch{Name: "Invoices", Subject: "INVOICE"}))
+	require.NoError(t, m.store.AddSavedSearch(SavedSearch{Name: "Alice", From: "alice", LabelID: pmapi.InboxLabel}))
+	a.Equal(t, []SavedSearch{
+		{Name: "Alice", From: "alice", LabelID: pmapi.InboxLabel},
+		{Name: "Invoices", Subject: "INVOICE"},
+	}, m.store.ListSavedSearches())
+
+	invoices, err := m.store.addresses[addrID1].GetMailbox("Searches/Invoices")
+	require.NoError(t, err)
+	a.True(t, invoices.IsReadOnly())
+	a.True(t, invoices.IsVirtual())
+	a.False(t, invoices.CanDeleteMessages())
+	checkSavedSearchMessages(t, invoices, []string{"msg1", "msg2"})
+
+	alice, err := m.store.addresses[addrID1].GetMailbox("Searches/Alice")
+	require.NoError(t, err)
+	checkSavedSearchMessages(t, alice, []string{"msg1", "msg3"})
+
+	// Mailboxes are updated by changes of messages.
+	insertMessage(t, m, "msg3", "Hello", "alice@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	insertMessage(t, m, "msg4", "Invoice 4", "carol@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkSavedSearchMessages(t, alice, []string{"msg1"})
+	checkSavedSearchMessages(t, invoices, []string{"msg1", "msg2", "msg4"})
+
+	// Namespaces do not list saved searches.
+	_, err = m.store.addresses[addrID1].GetMailbox(AddressNamespacesPrefix + addr2 + "/Searches/Invoices")
+	require.Error(t, err)
+
+	require.Error(t, invoices.Rename("Searches/Bills"))
+	require.Error(t, invoices.Delete())
+
+	require.NoError(t, m.store.RemoveSavedSearch("Invoices"))
+	_, err = m.store.addresses[addrID1].GetMailbox("Searches/Invoices")
+	require.Error(t, err)
+	a.Equal(t, []SavedSearch{{Name: "Alice", From: "alice", LabelID: pmapi.InboxLabel}}, m.store.ListSavedSearches())
+}
+
+func TestAddSavedSearchInvalid(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Error(t, m.store.AddSavedSearch(SavedSearch{Name: "Empty"}))
+	require.Error(t, m.store.AddSavedSearch(SavedSearch{Name: "Parent/Child", From: "alice"}))
+	require.NoError(t, m.store.AddSavedSearch(SavedSearch{Name: "Alice", From: "alice"}))
+	require.Error(t, m.store.AddSavedSearch(SavedSearch{Name: "Alice", From: "bob"}))
+	require.Error(t, m.store.RemoveSavedSearch("Bob"))
+}
+
+func TestBuiltInSearchMailboxes(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	storeAddress := m.store.addresses[addrID1]
+
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel, pmapi.StarredLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel, pmapi.StarredLabel})
+
+	unread, err := storeAddress.GetMailbox("Unread")
+	require.NoError(t, err)
+	a.True(t, unread.IsVirtual())
+	a.False(t, unread.IsReadOnly())
+	checkSavedSearchMessages(t, unread, []string{"msg1", "msg3"})
+	checkMailboxCounts(t, unread, 2, 2)
+
+	starred, err := storeAddress.GetMailbox("Starred")
+	require.NoError(t, err)
+	checkSavedSearchMessages(t, starred, []string{"msg2", "msg3"})
+
+	// Read and unstarred messages are removed.
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+	checkSavedSearchMessages(t, unread, []string{"msg1"})
+	checkSavedSearchMessages(t, starred, []string{"msg2"})
+
+	require.Error(t, unread.Delete())
+	require.Error(t, unread.Rename("Labels/Unread"))
+
+	// Mailboxes missing in already synced store are filled.
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(mailboxesBucket).DeleteBucket(unread.getBucketName()); err != nil {
+			return err
+		}
+		return storeAddress.txInitSearches(tx)
+	}))
+	checkSavedSearchMessages(t, storeAddress.mailboxes[VirtualUnreadLabel], []string{"msg1"})
+}
+
+func checkSavedSearchMessages(t *testing.T, storeMailbox *Mailbox, wantIDs []string) {
+	apiIDs, err := storeMailbox.GetAPIIDsFromUIDRange(1, 0)
+	require.NoError(t, err)
+	a.Equal(t, wantIDs, apiIDs)
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Entries of the snapshot archive. Cached messages and attachments are stored
+// under their directories with the same file names as in the cache.
+const (
+	snapshotUserIDEntry      = "user_id"
+	snapshotEventIDEntry     = "event_id"
+	snapshotDatabaseEntry    = "store.db"
+	snapshotMessagesDir      = "messages"
+	snapshotAttachmentsDir   = "attachments"
+	snapshotImportSuffix     = ".import"
+	maxSnapshotMetadataBytes = 1024
+)
+
+// ExportSnapshot writes the database together with cached messages and
+// attachments to w as a gzipped tar archive which can be imported on another
+// machine by ImportSnapshot. The last processed event is part of the snapshot,
+// so the imported store continues with events instead of a new sync.
+// Cached files are encrypted by the key derived from the mailbox password,
+// they are not readable without it.
+func (store *Store) ExportSnapshot(w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	userID := store.user.ID()
+	if err := writeSnapshotEntry(tw, snapshotUserIDEntry, []byte(userID)); err != nil {
+		return err
+	}
+
+	// Event ID is read before the database so that the snapshot is never
+	// behind it. Applying an event twice is harmless.
+	if err := writeSnapshotEntry(tw, snapshotEventIDEntry, []byte(store.cache.getEventID(userID))); err != nil {
+		return err
+	}
+
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: snapshotDatabaseEntry,
+			Mode: 0600,
+			Size: tx.Size(),
+		}); err != nil {
+			return err
+		}
+		_, err := tx.WriteTo(tw)
+		return err
+	}); err != nil {
+		return errors.Wrap(err, "failed to write database")
+	}
+
+	for _, cache := range []struct {
+		dir, entry string
+	}{
+		{getMessageCachePath(store.filePath), snapshotMessagesDir},
+		{getAttachmentCachePath(store.filePath), snapshotAttachmentsDir},
+	} {
+		if err := writeSnapshotDir(tw, cache.dir, cache.entry); err != nil {
+			return errors.Wrap(err, "failed to write cache")
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeSnapshotEntry(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0600,
+		Size: int64(len(data)),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeSnapshotDir(tw *tar.Writer, dir, entry string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != "" {
+			continue
+		}
+		if err := writeSnapshotFile(tw, filepath.Join(dir, file.Name()), entry+"/"+file.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSnapshotFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path) //nolint[gosec]
+	if os.IsNotExist(err) {
+		// Evicted from the cache in the meantime.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	// Cached files are replaced by rename, the opened one does not change.
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ImportSnapshot replaces the closed store of the user at path by the snapshot
+// from r created by ExportSnapshot. The snapshot has to belong to the same
+// user. The current store is kept when the snapshot cannot be read completely.
+func ImportSnapshot(r io.Reader, cache *Cache, path, userID string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read snapshot")
+	}
+	defer gr.Close() //nolint[errcheck]
+
+	dirs := map[string]string{
+		snapshotMessagesDir:    getMessageCachePath(path),
+		snapshotAttachmentsDir: getAttachmentCachePath(path),
+	}
+	tmpPaths := []string{path + snapshotImportSuffix}
+	for _, dir := range dirs {
+		tmpPaths = append(tmpPaths, dir+snapshotImportSuffix)
+	}
+	removeTmp := func() {
+		for _, tmpPath := range tmpPaths {
+			_ = os.RemoveAll(tmpPath)
+		}
+	}
+	removeTmp()
+
+	eventID, err := readSnapshot(tar.NewReader(gr), path, dirs, userID)
+	if err != nil {
+		removeTmp()
+		return err
+	}
+	if err := checkDatabase(path + snapshotImportSuffix); err != nil {
+		removeTmp()
+		return errors.Wrap(err, "snapshot database is not valid")
+	}
+
+	// The current database is kept until the imported one is in place.
+	backupPath := path + ".backup"
+	if err := os.Rename(path, backupPath); err != nil && !os.IsNotExist(err) {
+		removeTmp()
+		return errors.Wrap(err, "failed to back up database file")
+	}
+	if err := os.Rename(path+snapshotImportSuffix, path); err != nil {
+		_ = os.Rename(backupPath, path)
+		removeTmp()
+		return errors.Wrap(err, "failed to replace database file")
+	}
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("path", backupPath).Warn("Cannot remove database backup")
+	}
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.WithError(err).WithField("path", dir).Warn("Cannot remove cache")
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.Rename(dir+snapshotImportSuffix, dir); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).WithField("path", dir).Warn("Cannot import cache")
+		}
+	}
+	removeTmp()
+
+	return cache.setEventID(userID, eventID)
+}
+
+// readSnapshot extracts the snapshot next to the destination files and
+// returns the event ID of the snapshot.
+func readSnapshot(tr *tar.Reader, path string, dirs map[string]string, userID string) (eventID string, err error) {
+	var snapshotUserID string
+	var hasDatabase bool
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read snapshot")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// User is checked first to not extract whole snapshot of other one.
+		if snapshotUserID == "" && hdr.Name != snapshotUserIDEntry {
+			return "", errors.New("snapshot does not start with user ID")
+		}
+
+		switch hdr.Name {
+		case snapshotUserIDEntry:
+			if snapshotUserID, err = readSnapshotMetadata(tr); err != nil {
+				return "", err
+			}
+			if snapshotUserID != userID {
+				return "", errors.New("snapshot belongs to other account")
+			}
+		case snapshotEventIDEntry:
+			if eventID, err = readSnapshotMetadata(tr); err != nil {
+				return "", err
+			}
+		case snapshotDatabaseEntry:
+			if err := extractSnapshotFile(tr, path+snapshotImportSuffix); err != nil {
+				return "", errors.Wrap(err, "failed to extract database")
+			}
+			hasDatabase = true
+		default:
+			parts := strings.Split(hdr.Name, "/")
+			dir, ok := dirs[parts[0]]
+			if !ok || len(parts) != 2 || parts[1] == "" || parts[1] == "." || parts[1] == ".." {
+				log.WithField("entry", hdr.Name).Warn("Skipping unknown snapshot entry")
+				continue
+			}
+			if err := os.MkdirAll(dir+snapshotImportSuffix, 0700); err != nil {
+				return "", err
+			}
+			if err := extractSnapshotFile(tr, filepath.Join(dir+snapshotImportSuffix, parts[1])); err != nil {
+				return "", errors.Wrap(err, "failed to extract cache")
+			}
+		}
+	}
+
+	if !hasDatabase {
+		return "", errors.New("snapshot does not contain database")
+	}
+	return eventID, nil
+}
+
+func readSnapshotMetadata(r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSnapshotMetadataBytes))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read snapshot")
+	}
+	return string(data), nil
+}
+
+func extractSnapshotFile(r io.Reader, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil { //nolint[gosec] Size is limited by the snapshot file.
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSnapshotExportImport(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.NoError(t, m.store.EnableAttachmentCache(bytes.Repeat([]byte{1}, 32), 1000))
+	require.NoError(t, m.store.SetCachedAttachment("msg1", "att1", []byte("data")))
+	require.NoError(t, m.cache.setEventID("userID", "snapshotEventID"))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, m.store.ExportSnapshot(&snapshot))
+
+	// Import on the other machine with existing store.
+	dir, err := ioutil.TempDir("", "store-snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "mailbox-userID.db")
+	cache := NewCache(filepath.Join(dir, "cache.json"))
+	require.NoError(t, ioutil.WriteFile(path, []byte("database"), 0600))
+
+	require.Error(t, ImportSnapshot(bytes.NewReader(snapshot.Bytes()), cache, path, "otherUserID"))
+	data, err := ioutil.ReadFile(path) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "database", string(data))
+
+	require.Error(t, ImportSnapshot(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()/2]), cache, path, "userID"))
+	data, err = ioutil.ReadFile(path) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "database", string(data))
+
+	require.NoError(t, ImportSnapshot(bytes.NewReader(snapshot.Bytes()), cache, path, "userID"))
+	a.Equal(t, "snapshotEventID", cache.getEventID("userID"))
+	_, err = os.Stat(path + snapshotImportSuffix)
+	a.True(t, os.IsNotExist(err))
+
+	ac, err := newMessageCache(getAttachmentCachePath(path), bytes.Repeat([]byte{1}, 32), 1000)
+	require.NoError(t, err)
+	cached, err := ac.load("att1")
+	require.NoError(t, err)
+	a.Equal(t, []byte("data"), cached)
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	require.NoError(t, err)
+	defer db.Close() //nolint[errcheck]
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		a.NotNil(t, tx.Bucket(metadataBucket).Get([]byte("msg1")))
+		return nil
+	}))
+}
+
+func TestSnapshotImportInvalidDatabase(t *testing.T) {
+	var snapshot bytes.Buffer
+	gw := gzip.NewWriter(&snapshot)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, writeSnapshotEntry(tw, snapshotUserIDEntry, []byte("userID")))
+	require.NoError(t, writeSnapshotEntry(tw, snapshotDatabaseEntry, []byte("not a database")))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	dir, err := ioutil.TempDir("", "store-snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "mailbox-userID.db")
+	cache := NewCache(filepath.Join(dir, "cache.json"))
+	require.NoError(t, ioutil.WriteFile(path, []byte("database"), 0600))
+
+	require.Error(t, ImportSnapshot(bytes.NewReader(snapshot.Bytes()), cache, path, "userID"))
+	data, err := ioutil.ReadFile(path) //nolint[gosec]
+	require.NoError(t, err)
+	a.Equal(t, "database", string(data))
+	_, err = os.Stat(path + snapshotImportSuffix)
+	a.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const syncMonthsKey = "months"
+
+// GetSyncMonths returns the number of months of the newest messages which
+// are synced, zero when all messages are synced.
+func (store *Store) GetSyncMonths() (months uint) {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(syncLimitBucket).Get([]byte(syncMonthsKey))
+		if value == nil {
+			return nil
+		}
+		parsed, err := strconv.ParseUint(string(value), 10, 32)
+		months = uint(parsed)
+		return err
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read sync limit")
+	}
+	return
+}
+
+// SetSyncMonths limits the sync to messages of the last months, zero syncs
+// all messages. Older messages stay on the server and they are fetched to
+// mailbox when a client opens it. The sync is started again to download
+// or remove messages.
+func (store *Store) SetSyncMonths(months uint) error {
+	store.log.WithField("months", months).Info("Setting sync limit")
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(syncLimitBucket)
+		if months == 0 {
+			return b.Delete([]byte(syncMonthsKey))
+		}
+		return b.Put([]byte(syncMonthsKey), []byte(strconv.FormatUint(uint64(months), 10)))
+	})
+	if err != nil {
+		return err
+	}
+
+	store.triggerSync()
+	return nil
+}
+
+// getSyncBegin returns the time of the oldest synced message, zero when all
+// messages are synced.
+func (store *Store) getSyncBegin() int64 {
+	months := store.GetSyncMonths()
+	if months == 0 {
+		return 0
+	}
+	return time.Now().AddDate(0, -int(months), 0).Unix()
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSyncMonthsMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	a.Equal(t, uint(0), m.store.GetSyncMonths())
+
+	insertMessageDaysAgo(t, m, "msg1", 100, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg2", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	setSyncMonths(t, m, 2)
+	a.Equal(t, uint(2), m.store.GetSyncMonths())
+
+	// Old messages are not added but saved ones are kept updated.
+	insertMessageDaysAgo(t, m, "msg3", 3, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg4", 100, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg1", 100, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel})
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	archive := m.store.addresses[addrID1].mailboxes[pmapi.ArchiveLabel]
+	checkSavedSearchMessages(t, inbox, []string{"msg2", "msg3"})
+	checkSavedSearchMessages(t, archive, []string{"msg1"})
+	checkAllMessageIDs(t, m, []string{"msg1", "msg2", "msg3"})
+}
+
+func TestSyncMonthsFetchedOnDemand(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	setSyncMonths(t, m, 2)
+
+	begin := m.store.getSyncBegin()
+	m.api.EXPECT().ListMessages(gomock.Any()).DoAndReturn(func(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+		a.Equal(t, pmapi.InboxLabel, filter.LabelID)
+		a.Equal(t, begin, filter.End)
+		msg := getTestMessage("msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+		msg.Time = begin - 1
+		return []*pmapi.Message{msg}, 1, nil
+	})
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	require.True(t, m.store.startOnDemandFetch(pmapi.InboxLabel))
+	require.NoError(t, inbox.fetchOnDemand(begin))
+	m.store.finishOnDemandFetch(pmapi.InboxLabel)
+
+	checkSavedSearchMessages(t, inbox, []string{"msg1"})
+	checkAllMessageIDs(t, m, []string{"msg1"})
+}
+
+func TestSyncMonthsIsSynced(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessageDaysAgo(t, m, "msg1", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	setSyncMonths(t, m, 1)
+
+	// Older messages are counted on the server only.
+	isSynced, err := m.store.isSynced([]*pmapi.MessagesCount{
+		{LabelID: pmapi.AllMailLabel, Total: 3},
+		{LabelID: pmapi.InboxLabel, Total: 3},
+	})
+	require.NoError(t, err)
+	a.True(t, isSynced)
+}
+
+// setSyncMonths saves the limit directly to avoid starting the sync.
+func setSyncMonths(t *testing.T, m *mocksForStore, months uint) {
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncLimitBucket).Put([]byte(syncMonthsKey), []byte(strconv.FormatUint(uint64(months), 10)))
+	}))
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SyncWindow limits messages of mailbox listed over IMAP to the most recent
+// ones so clients do not download whole huge archives. Older messages are
+// still in All Mail and they are listed again when the window is widened.
+// Zero fields are not used, zero window lists all messages.
+type SyncWindow struct {
+	Messages uint `json:",omitempty"` // Number of the newest messages.
+	Days     uint `json:",omitempty"` // Maximal age of messages in days.
+}
+
+// IsZero returns whether the window lists all messages.
+func (window SyncWindow) IsZero() bool {
+	return window.Messages == 0 && window.Days == 0
+}
+
+// minTime returns the time of the oldest message in the window. Times of
+// messages listed in the mailbox are sorted from the newest.
+func (window SyncWindow) minTime(now time.Time, times []int64) (minTime int64) {
+	if window.Days != 0 {
+		minTime = now.AddDate(0, 0, -int(window.Days)).Unix()
+	}
+	if window.Messages != 0 && uint(len(times)) >= window.Messages {
+		if nth := times[window.Messages-1]; nth > minTime {
+			minTime = nth
+		}
+	}
+	return
+}
+
+// GetSyncWindow returns the window of the mailbox with labelID.
+func (store *Store) GetSyncWindow(labelID string) (window SyncWindow) {
+	err := store.db.View(func(tx *bolt.Tx) (err error) {
+		window, err = txGetSyncWindow(tx, labelID)
+		return
+	})
+	if err != nil {
+		store.log.WithError(err).Error("Could not read sync windows")
+	}
+	return
+}
+
+func txGetSyncWindow(tx *bolt.Tx, labelID string) (window SyncWindow, err error) {
+	if value := tx.Bucket(syncWindowsBucket).Get([]byte(labelID)); value != nil {
+		err = json.Unmarshal(value, &window)
+	}
+	return
+}
+
+// SetSyncWindow sets the window of the mailbox with labelID. Messages
+// outside of the window are removed from the mailbox and messages inside
+// of it are added from the synced metadata. All Mail is always complete.
+// Older messages added on demand are removed again.
+func (store *Store) SetSyncWindow(labelID string, window SyncWindow) error {
+	if labelID == pmapi.AllMailLabel {
+		return errors.New("All Mail always lists all messages")
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.log.WithField("labelID", labelID).WithField("window", window).Info("Setting sync window")
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(windowsExtBucket).Delete([]byte(labelID)); err != nil {
+			return err
+		}
+
+		b := tx.Bucket(syncWindowsBucket)
+		if window.IsZero() {
+			if err := b.Delete([]byte(labelID)); err != nil {
+				return err
+			}
+		} else {
+			value, err := json.Marshal(window)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(labelID), value); err != nil {
+				return err
+			}
+		}
+
+		return store.txFillLabelMailboxes(tx, labelID)
+	})
+}
+
+// ExtendSyncWindow adds messages of the mailbox which are older than its
+// window back to since (Unix time, zero for all messages) from the synced
+// metadata, so clients looking for older messages find them. The messages
+// stay in the mailbox until the window is set again.
+func (storeMailbox *Mailbox) ExtendSyncWindow(since int64) error {
+	store := storeMailbox.store
+	labelID := storeMailbox.labelID
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		window, err := txGetSyncWindow(tx, labelID)
+		if err != nil || window.IsZero() {
+			return err
+		}
+		minTime, err := storeMailbox.txGetMinTime(tx, window)
+		if err != nil || since >= minTime {
+			return err
+		}
+
+		store.log.WithField("labelID", labelID).WithField("since", since).Info("Extending sync window on demand")
+
+		if err := tx.Bucket(windowsExtBucket).Put([]byte(labelID), []byte(strconv.FormatInt(since, 10))); err != nil {
+			return err
+		}
+		return store.txFillLabelMailboxes(tx, labelID)
+	})
+}
+
+// txGetSyncWindowExt returns the time back to which the window of the
+// mailbox with labelID was extended on demand, if it was.
+func txGetSyncWindowExt(tx *bolt.Tx, labelID string) (since int64, ok bool, err error) {
+	value := tx.Bucket(windowsExtBucket).Get([]byte(labelID))
+	if value == nil {
+		return 0, false, nil
+	}
+	since, err = strconv.ParseInt(string(value), 10, 64)
+	return since, err == nil, err
+}
+
+// txFillLabelMailboxes adds messages from the metadata bucket to mailboxes
+// with labelID of all addresses.
+func (store *Store) txFillLabelMailboxes(tx *bolt.Tx, labelID string) error {
+	mailboxes := []*Mailbox{}
+	for _, a := range store.addresses {
+		if mailbox, ok := a.mailboxes[labelID]; ok {
+			mailboxes = append(mailboxes, mailbox)
+		}
+	}
+	return store.txFillMailboxes(tx, mailboxes)
+}
+
+// trimMailboxesToWindows removes messages which got older than windows of
+// their mailboxes.
+func (store *Store) trimMailboxesToWindows() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for _, a := range store.addresses {
+			for _, m := range a.mailboxes {
+				window, err := txGetSyncWindow(tx, m.labelID)
+				if err != nil {
+					return err
+				}
+				if err := m.txTrimToWindow(tx, window); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// txGetMinTime returns the time of the oldest message which can be added to
+// the mailbox, zero when there is no window.
+func (storeMailbox *Mailbox) txGetMinTime(tx *bolt.Tx, window SyncWindow) (int64, error) {
+	if window.IsZero() {
+		return 0, nil
+	}
+	_, times, err := storeMailbox.txGetMessageTimes(tx)
+	if err != nil {
+		return 0, err
+	}
+	minTime := window.minTime(time.Now(), times)
+	if since, ok, err := txGetSyncWindowExt(tx, storeMailbox.labelID); err != nil {
+		return 0, err
+	} else if ok && since < minTime {
+		minTime = since
+	}
+	return minTime, nil
+}
+
+// txTrimToWindow removes messages which are outside of the window and
+// were not added on demand.
+func (storeMailbox *Mailbox) txTrimToWindow(tx *bolt.Tx, window SyncWindow) error {
+	if window.IsZero() {
+		return nil
+	}
+	ids, times, err := storeMailbox.txGetMessageTimes(tx)
+	if err != nil {
+		return err
+	}
+	since, isExtended, err := txGetSyncWindowExt(tx, storeMailbox.labelID)
+	if err != nil {
+		return err
+	}
+	minTime := window.minTime(time.Now(), times)
+	for i, apiID := range ids {
+		if times[i] >= minTime && (window.Messages == 0 || uint(i) < window.Messages) {
+			continue
+		}
+		if isExtended && times[i] >= since {
+			continue
+		}
+		if err := storeMailbox.txDeleteMessage(tx, apiID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txGetMessageTimes returns IDs and times of messages in the mailbox sorted
+// from the newest.
+func (storeMailbox *Mailbox) txGetMessageTimes(tx *bolt.Tx) (ids []string, times []int64, err error) {
+	type messageTime struct {
+		id   string
+		time int64
+	}
+	messages := []messageTime{}
+	err = storeMailbox.txGetIMAPIDsBucket(tx).ForEach(func(uidb, apiIDb []byte) error {
+		msg, err := storeMailbox.store.txGetMessage(tx, string(apiIDb))
+		if err != nil {
+			return err
+		}
+		messages = append(messages, messageTime{id: msg.ID, time: msg.Time})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].time > messages[j].time
+	})
+	for _, m := range messages {
+		ids = append(ids, m.id)
+		times = append(times, m.time)
+	}
+	return ids, times, nil
+}
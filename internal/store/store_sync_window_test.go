@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSyncWindowMessages(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessageDaysAgo(t, m, "msg1", 3, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg2", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg3", 2, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.SetSyncWindow(pmapi.InboxLabel, SyncWindow{Messages: 2}))
+	a.Equal(t, SyncWindow{Messages: 2}, m.store.GetSyncWindow(pmapi.InboxLabel))
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	allMail := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel]
+	checkSavedSearchMessages(t, inbox, []string{"msg2", "msg3"})
+	checkSavedSearchMessages(t, allMail, []string{"msg1", "msg2", "msg3"})
+
+	// Newer message pushes the oldest one out, older message is not added.
+	insertMessageDaysAgo(t, m, "msg4", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg5", 5, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkSavedSearchMessages(t, inbox, []string{"msg2", "msg4"})
+	checkSavedSearchMessages(t, allMail, []string{"msg1", "msg2", "msg3", "msg4", "msg5"})
+
+	// Widening the window lists older messages again.
+	require.NoError(t, m.store.SetSyncWindow(pmapi.InboxLabel, SyncWindow{}))
+	a.Equal(t, SyncWindow{}, m.store.GetSyncWindow(pmapi.InboxLabel))
+	checkSavedSearchMessages(t, inbox, []string{"msg2", "msg4", "msg1", "msg3", "msg5"})
+}
+
+func TestSyncWindowDays(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessageDaysAgo(t, m, "msg1", 10, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg2", 3, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.SetSyncWindow(pmapi.InboxLabel, SyncWindow{Days: 7}))
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	checkSavedSearchMessages(t, inbox, []string{"msg2"})
+
+	insertMessageDaysAgo(t, m, "msg3", 8, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkSavedSearchMessages(t, inbox, []string{"msg2"})
+
+	// Messages age out of the window. The window is shortened directly in
+	// the database to simulate passing days.
+	insertMessageDaysAgo(t, m, "msg4", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncWindowsBucket).Put([]byte(pmapi.InboxLabel), []byte(`{"Days":2}`))
+	}))
+	require.NoError(t, m.store.trimMailboxesToWindows())
+	checkSavedSearchMessages(t, inbox, []string{"msg4"})
+}
+
+func TestSyncWindowExtendOnDemand(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessageDaysAgo(t, m, "msg1", 10, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg2", 5, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg3", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	require.NoError(t, m.store.SetSyncWindow(pmapi.InboxLabel, SyncWindow{Days: 2}))
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	checkSavedSearchMessages(t, inbox, []string{"msg3"})
+
+	// Searched older messages are added and kept by trimming and new messages.
+	require.NoError(t, inbox.ExtendSyncWindow(time.Now().AddDate(0, 0, -7).Unix()))
+	checkSavedSearchMessages(t, inbox, []string{"msg3", "msg2"})
+
+	require.NoError(t, m.store.trimMailboxesToWindows())
+	insertMessageDaysAgo(t, m, "msg4", 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkSavedSearchMessages(t, inbox, []string{"msg3", "msg2", "msg4"})
+
+	// Zero adds all messages.
+	require.NoError(t, inbox.ExtendSyncWindow(0))
+	checkSavedSearchMessages(t, inbox, []string{"msg3", "msg2", "msg4", "msg1"})
+
+	// Setting the window again removes messages added on demand.
+	require.NoError(t, m.store.SetSyncWindow(pmapi.InboxLabel, SyncWindow{Days: 2}))
+	checkSavedSearchMessages(t, inbox, []string{"msg3", "msg4"})
+}
+
+func TestSyncWindowAllMail(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	require.Error(t, m.store.SetSyncWindow(pmapi.AllMailLabel, SyncWindow{Messages: 10}))
+}
+
+func TestSyncWindowIsSynced(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	insertMessageDaysAgo(t, m, "msg1", 2, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessageDaysAgo(t, m, "msg2", 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	require.NoError(t, m.store.SetSyncWindow(pmapi.InboxLabel, SyncWindow{Messages: 1}))
+
+	// Counts of mailbox with window differ from API but no sync is needed.
+	isSynced, err := m.store.isSynced([]*pmapi.MessagesCount{
+		{LabelID: pmapi.AllMailLabel, Total: 2},
+		{LabelID: pmapi.InboxLabel, Total: 2},
+	})
+	require.NoError(t, err)
+	a.True(t, isSynced)
+}
+
+func insertMessageDaysAgo(t *testing.T, m *mocksForStore, id string, days int, labelIDs []string) {
+	msg := getTestMessage(id, "Test message", addrID1, 0, labelIDs)
+	msg.Time = time.Now().AddDate(0, 0, -days).Unix()
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg))
+}
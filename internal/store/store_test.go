@@ -67,6 +67,7 @@ func initMocks(tb testing.TB) (*mocksForStore, func()) {
 
 	// Called during clean-up.
 	mocks.panicHandler.EXPECT().HandlePanic().AnyTimes()
+	mocks.api.EXPECT().SetInitialSync(gomock.Any()).AnyTimes()
 
 	var err error
 	mocks.tmpDir, err = ioutil.TempDir("", "store-test")
@@ -120,6 +121,7 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 		mocks.api,
 		mocks.events,
 		filepath.Join(mocks.tmpDir, "mailbox-test.db"),
+		filepath.Join(mocks.tmpDir, "uids-test.db"),
 		mocks.cache,
 	)
 	require.NoError(mocks.tb, err)
@@ -0,0 +1,206 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// UIDs are saved to a file outside of the database when the store is
+// closed. The database can be removed (by clearing the cache, logout with
+// removing data or new cache version) and built again by sync. The new
+// database takes UIDVALIDITY and UIDs of the previous one, so clients keep
+// messages they downloaded before instead of downloading the whole account
+// again. Saved UIDs are kept in the database until the message is put into
+// the mailbox again; messages not known before get new UIDs higher than
+// all the saved ones.
+
+// saveUIDs writes UIDVALIDITY and UIDs of all mailboxes, including saved
+// UIDs not assigned yet, to the file at uidsPath.
+func (store *Store) saveUIDs() error {
+	if store.uidsPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(store.uidsPath), 0700); err != nil {
+		return err
+	}
+
+	tmpPath := store.uidsPath + ".tmp"
+	dst, err := bolt.Open(tmpPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	err = store.db.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			version, err := dstTx.CreateBucket(mboxVersionBucket)
+			if err != nil {
+				return err
+			}
+			if err := copyBucket(srcTx.Bucket(mboxVersionBucket), version); err != nil {
+				return err
+			}
+			uids, err := dstTx.CreateBucket(oldUIDsBucket)
+			if err != nil {
+				return err
+			}
+			if err := copyBucket(srcTx.Bucket(oldUIDsBucket), uids); err != nil {
+				return err
+			}
+			mailboxes := srcTx.Bucket(mailboxesBucket)
+			return mailboxes.ForEach(func(name, _ []byte) error {
+				if mailbox := mailboxes.Bucket(name); mailbox != nil {
+					return txSaveMailboxUIDs(mailbox, uids, name)
+				}
+				return nil
+			})
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, store.uidsPath)
+}
+
+func txSaveMailboxUIDs(mailbox, uids *bolt.Bucket, name []byte) error {
+	dst, err := uids.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	dstAPIIDs, err := dst.CreateBucketIfNotExists(apiIDsBucket)
+	if err != nil {
+		return err
+	}
+	dstModSeqs, err := dst.CreateBucketIfNotExists(modSeqsBucket)
+	if err != nil {
+		return err
+	}
+	if err := setHigherSequence(dstAPIIDs, mailbox.Bucket(imapIDsBucket).Sequence()); err != nil {
+		return err
+	}
+	if err := setHigherSequence(dstModSeqs, mailbox.Bucket(modSeqsBucket).Sequence()); err != nil {
+		return err
+	}
+	return mailbox.Bucket(apiIDsBucket).ForEach(dstAPIIDs.Put)
+}
+
+// restoreUIDs puts UIDVALIDITY and UIDs saved by the previous database into
+// the new one. It has to be called before mailboxes are created.
+func (store *Store) restoreUIDs() error {
+	if store.uidsPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(store.uidsPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	src, err := bolt.Open(store.uidsPath, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer src.Close() //nolint[errcheck]
+
+	store.log.Info("Restoring UIDs of previous database")
+
+	return src.View(func(srcTx *bolt.Tx) error {
+		version, uids := srcTx.Bucket(mboxVersionBucket), srcTx.Bucket(oldUIDsBucket)
+		if version == nil || uids == nil {
+			return errors.New("missing buckets")
+		}
+		return store.db.Update(func(dstTx *bolt.Tx) error {
+			if err := copyBucket(version, dstTx.Bucket(mboxVersionBucket)); err != nil {
+				return err
+			}
+			return copyBucket(uids, dstTx.Bucket(oldUIDsBucket))
+		})
+	})
+}
+
+// txRestoreSequences makes UIDs and mod-sequences of the new mailbox higher
+// than the saved ones.
+func txRestoreSequences(tx *bolt.Tx, mailbox *bolt.Bucket, bucketName []byte) error {
+	saved := tx.Bucket(oldUIDsBucket).Bucket(bucketName)
+	if saved == nil {
+		return nil
+	}
+	if err := setHigherSequence(mailbox.Bucket(imapIDsBucket), saved.Bucket(apiIDsBucket).Sequence()); err != nil {
+		return err
+	}
+	return setHigherSequence(mailbox.Bucket(modSeqsBucket), saved.Bucket(modSeqsBucket).Sequence())
+}
+
+// txTakeSavedUID returns the saved UID of the message and removes it, so
+// the message gets a new UID when removed and added to the mailbox again.
+// Zero is returned when there is no saved UID.
+func (storeMailbox *Mailbox) txTakeSavedUID(tx *bolt.Tx, imapBucket *bolt.Bucket, apiID string) (uint32, error) {
+	saved := tx.Bucket(oldUIDsBucket).Bucket(storeMailbox.getBucketName())
+	if saved == nil {
+		return 0, nil
+	}
+	apiIDs := saved.Bucket(apiIDsBucket)
+	uidb := apiIDs.Get([]byte(apiID))
+	if uidb == nil {
+		return 0, nil
+	}
+	uid := btoi(uidb)
+	if err := apiIDs.Delete([]byte(apiID)); err != nil {
+		return 0, err
+	}
+	// UID cannot be used twice.
+	if imapBucket.Get(itob(uid)) != nil {
+		return 0, nil
+	}
+	return uid, nil
+}
+
+func setHigherSequence(b *bolt.Bucket, seq uint64) error {
+	if b.Sequence() >= seq {
+		return nil
+	}
+	return b.SetSequence(seq)
+}
+
+// copyBucket copies all keys and nested buckets of src to dst.
+func copyBucket(src, dst *bolt.Bucket) error {
+	// Sequence is used, e.g., as the highest mod-sequence of mailbox.
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	// Keys are inserted in order so pages can be filled completely.
+	dst.FillPercent = 1
+
+	return src.ForEach(func(k, v []byte) error {
+		if srcChild := src.Bucket(k); srcChild != nil {
+			dstChild, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(srcChild, dstChild)
+		}
+		return dst.Put(k, v)
+	})
+}
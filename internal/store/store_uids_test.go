@@ -0,0 +1,96 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIDsRestoredAfterStoreRebuilt(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	require.NoError(t, m.store.increaseMailboxesVersion())
+	for _, id := range []string{"msg1", "msg2", "msg3"} {
+		insertMessage(t, m, id, "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	}
+	uidValidity := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel].UIDValidity()
+
+	rebuildStore(t, m)
+
+	inbox := m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	a.Equal(t, uidValidity, inbox.UIDValidity())
+
+	for _, id := range []string{"msg3", "msg4", "msg1"} {
+		insertMessage(t, m, id, "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	}
+	checkUID := func(apiID string, wantUID uint32) {
+		uid, err := inbox.getUID(apiID)
+		require.NoError(t, err)
+		a.Equal(t, wantUID, uid, apiID)
+	}
+	checkUID("msg1", 1)
+	checkUID("msg3", 3)
+	checkUID("msg4", 4)
+
+	// Saved UID is used only once.
+	require.NoError(t, m.store.createOrUpdateMessageEvent(getTestMessage("msg1", "Test message", addrID1, 0, []string{pmapi.AllMailLabel})))
+	insertMessage(t, m, "msg1", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkUID("msg1", 5)
+
+	// Not assigned saved UIDs are kept when the store is closed.
+	rebuildStore(t, m)
+
+	inbox = m.store.addresses[addrID1].mailboxes[pmapi.InboxLabel]
+	insertMessage(t, m, "msg2", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	checkUID("msg2", 2)
+}
+
+func TestUIDsRemovedWithStore(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// UIDs saved before, e.g. by previous close, are deleted with the store
+	// and removed store does not save them again.
+	require.NoError(t, m.store.saveUIDs())
+	a.FileExists(t, m.store.uidsPath)
+
+	removed := m.store
+	m.store = nil
+	require.NoError(t, removed.Remove())
+	a.NoFileExists(t, removed.uidsPath)
+	a.NoFileExists(t, removed.filePath)
+}
+
+// rebuildStore closes the store and opens a new one in place of removed
+// database, e.g. after the cache version changed.
+func rebuildStore(t *testing.T, m *mocksForStore) {
+	require.NoError(t, m.store.Close())
+	require.NoError(t, os.Remove(m.store.filePath))
+	m.store = nil
+	m.newStoreNoEvents(true)
+}
@@ -20,22 +20,50 @@ package store
 import (
 	"math"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 )
 
 const (
-	syncMinPagesPerWorker  = 10
-	syncMessagesMaxWorkers = 5
-	maxFilterPageSize      = 150
+	syncMinPagesPerWorker = 10
+	maxFilterPageSize     = 150
+
+	// SyncDefaultWorkers is the default number of workers fetching pages of
+	// messages in parallel during sync.
+	SyncDefaultWorkers = 5
+	// SyncMaxWorkers is the highest allowed number of workers, more would
+	// only make API rate limit the requests.
+	SyncMaxWorkers = 20
 )
 
+var syncMessagesMaxWorkers = int32(SyncDefaultWorkers) //nolint[gochecknoglobals]
+
+// SetSyncMaxWorkers sets how many workers fetch pages of messages in parallel
+// during sync. It is used by syncs started after the change, resumed sync
+// keeps its workers. Values out of range are limited to 1 and SyncMaxWorkers.
+func SetSyncMaxWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > SyncMaxWorkers {
+		workers = SyncMaxWorkers
+	}
+	atomic.StoreInt32(&syncMessagesMaxWorkers, int32(workers))
+}
+
+func getSyncMaxWorkers() int {
+	return int(atomic.LoadInt32(&syncMessagesMaxWorkers))
+}
+
 type storeSynchronizer interface {
 	getAllMessageIDs() ([]string, error)
 	createOrUpdateMessagesEvent([]*pmapi.Message) error
 	deleteMessagesEvent([]string) error
-	saveSyncState(finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string)
+	saveSyncState(finishTime int64, idRanges []*syncIDRange, progress syncProgress)
+	saveIDsToBeDeleted(idsToBeDeleted []string)
+	removeIDsToBeDeleted(ids []string)
 }
 
 type messageLister interface {
@@ -59,6 +87,8 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api message
 		syncState.save()
 	}
 
+	syncState.startProgress()
+
 	wg := &sync.WaitGroup{}
 
 	shouldStop := 0 // Using integer to have it atomic.
@@ -91,21 +121,23 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api message
 }
 
 func findIDRanges(labelID string, api messageLister, syncState *syncState) error {
-	_, count, err := getSplitIDAndCount(labelID, api, 0)
+	_, count, err := getSplitIDAndCount(labelID, api, 0, syncState.begin)
 	if err != nil {
 		return errors.Wrap(err, "failed to get first ID and count")
 	}
 	log.WithField("total", count).Debug("Finding ID ranges")
+	syncState.setTotal(count)
 	if count == 0 {
 		return nil
 	}
 
 	syncState.initIDRanges()
 
+	maxWorkers := getSyncMaxWorkers()
 	pages := int(math.Ceil(float64(count) / float64(maxFilterPageSize)))
 	workers := (pages / syncMinPagesPerWorker) + 1
-	if workers > syncMessagesMaxWorkers {
-		workers = syncMessagesMaxWorkers
+	if workers > maxWorkers {
+		workers = maxWorkers
 	}
 
 	if workers == 1 {
@@ -114,12 +146,12 @@ func findIDRanges(labelID string, api messageLister, syncState *syncState) error
 
 	step := int(math.Round(float64(pages) / float64(workers)))
 	// Increment steps in case there are more steps than max # of workers (due to rounding).
-	if (step*syncMessagesMaxWorkers)+1 < pages {
+	if (step*maxWorkers)+1 < pages {
 		step++
 	}
 
 	for page := step; page < pages; page += step {
-		splitID, _, err := getSplitIDAndCount(labelID, api, page)
+		splitID, _, err := getSplitIDAndCount(labelID, api, page, syncState.begin)
 		if err != nil {
 			return errors.Wrap(err, "failed to get IDs range")
 		}
@@ -135,7 +167,7 @@ func findIDRanges(labelID string, api messageLister, syncState *syncState) error
 	return nil
 }
 
-func getSplitIDAndCount(labelID string, api messageLister, page int) (string, int, error) {
+func getSplitIDAndCount(labelID string, api messageLister, page int, begin int64) (string, int, error) {
 	sort := "ID"
 	desc := false
 	filter := &pmapi.MessagesFilter{
@@ -145,6 +177,7 @@ func getSplitIDAndCount(labelID string, api messageLister, page int) (string, in
 		PageSize: maxFilterPageSize,
 		Page:     page,
 		Limit:    1,
+		Begin:    begin,
 	}
 	// If the page does not exist, an empty page instead of an error is returned.
 	messages, total, err := api.ListMessages(filter)
@@ -185,6 +218,9 @@ func syncBatch( //nolint[funlen]
 			// When message is completely removed, it still works as expected.
 			BeginID: idRange.StartID,
 			EndID:   idRange.StopID,
+
+			// Older messages are not synced when the sync is limited.
+			Begin: syncState.begin,
 		}
 
 		log.WithField("begin", filter.BeginID).WithField("end", filter.EndID).Debug("Fetching page")
@@ -198,14 +234,16 @@ func syncBatch( //nolint[funlen]
 			break
 		}
 
+		ids := []string{}
 		for _, m := range messages {
-			syncState.doNotDeleteMessageID(m.ID)
+			ids = append(ids, m.ID)
 		}
-		syncState.save()
+		syncState.doNotDeleteMessageIDs(ids)
 
 		if err := store.createOrUpdateMessagesEvent(messages); err != nil {
 			return errors.Wrap(err, "failed to create or update messages")
 		}
+		syncState.addProgress(messages)
 
 		pageLastMessageID := messages[len(messages)-1].ID
 		if !desc {
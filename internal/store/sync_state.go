@@ -21,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 )
 
@@ -46,6 +47,25 @@ type syncState struct {
 	// again. We do that because we don't want to remove everything on the
 	// beginning of the sync to keep client synced.
 	idsToBeDeletedMap map[string]bool
+
+	// progress is saved together with idRanges so an interrupted sync
+	// reports progress from where it left off.
+	progress syncProgress
+
+	// begin is the time of the oldest message to sync, zero to sync all.
+	begin int64
+
+	// startTime and doneAtStart are used to estimate the remaining time
+	// from the speed of the current run only.
+	startTime   time.Time
+	doneAtStart int
+}
+
+// syncProgress counts messages and their sizes synced so far.
+type syncProgress struct {
+	Total int
+	Done  int
+	Bytes int64
 }
 
 func newSyncState(store storeSynchronizer, finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string) *syncState {
@@ -74,7 +94,7 @@ func (s *syncState) save() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	s.store.saveSyncState(s.finishTime, s.idRanges, s.getIDsToBeDeleted())
+	s.store.saveSyncState(s.finishTime, s.idRanges, s.progress)
 }
 
 // isIncomplete returns whether the sync is in progress (no matter whether
@@ -94,6 +114,18 @@ func (s *syncState) isFinished() bool {
 	return s.finishTime != 0
 }
 
+// getFinishTime returns the time when the sync was finished for the last
+// time or zero time if it was never finished.
+func (s *syncState) getFinishTime() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.finishTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, s.finishTime)
+}
+
 // clearFinishTime sets finish time to zero.
 func (s *syncState) clearFinishTime() {
 	s.lock.Lock()
@@ -125,6 +157,62 @@ func (s *syncState) initIDRanges() {
 	}}
 }
 
+// setTotal resets the progress for the new full sync of total messages.
+func (s *syncState) setTotal(total int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.progress = syncProgress{Total: total}
+	s.doneAtStart = 0
+}
+
+// startProgress marks the beginning of the sync run used for the estimate
+// of the remaining time.
+func (s *syncState) startProgress() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.startTime = time.Now()
+	s.doneAtStart = s.progress.Done
+}
+
+// addProgress counts synced messages. It is not saved until the range
+// is moved by `setStartID` or `setStopID`.
+func (s *syncState) addProgress(messages []*pmapi.Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, message := range messages {
+		s.progress.Done++
+		s.progress.Bytes += message.Size
+	}
+}
+
+// getProgress returns the progress with the estimate of the remaining time
+// based on the speed since `startProgress`.
+func (s *syncState) getProgress(now time.Time) SyncProgress {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	progress := SyncProgress{
+		Total: s.progress.Total,
+		Done:  s.progress.Done,
+		Bytes: s.progress.Bytes,
+	}
+	// Boundary messages of each page are synced twice.
+	if progress.Done > progress.Total {
+		progress.Done = progress.Total
+	}
+
+	doneInRun := s.progress.Done - s.doneAtStart
+	if s.startTime.IsZero() || doneInRun <= 0 || progress.Done >= progress.Total {
+		return progress
+	}
+	elapsed := now.Sub(s.startTime)
+	progress.ETA = time.Duration(float64(elapsed) / float64(doneInRun) * float64(progress.Total-progress.Done))
+	return progress
+}
+
 // addIDRange sets `splitID` as stopID for last range and adds new one
 // starting with `splitID`.
 func (s *syncState) addIDRange(splitID string) {
@@ -156,18 +244,28 @@ func (s *syncState) loadMessageIDsToBeDeleted() error {
 	}
 
 	s.lock.Lock()
-	defer s.save()
 	defer s.lock.Unlock()
 
 	s.idsToBeDeletedMap = idsToBeDeletedMap
+	s.store.saveIDsToBeDeleted(ids)
 	return nil
 }
 
 func (s *syncState) doNotDeleteMessageID(id string) {
+	s.doNotDeleteMessageIDs([]string{id})
+}
+
+// doNotDeleteMessageIDs removes synced messages from being deleted. Only
+// the IDs are removed from the saved state so the checkpoint after every
+// page does not rewrite IDs of all messages.
+func (s *syncState) doNotDeleteMessageIDs(ids []string) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	delete(s.idsToBeDeletedMap, id)
+	for _, id := range ids {
+		delete(s.idsToBeDeletedMap, id)
+	}
+	s.store.removeIDsToBeDeleted(ids)
 }
 
 func (s *syncState) deleteMessagesToBeDeleted() error {
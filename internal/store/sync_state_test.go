@@ -20,7 +20,9 @@ package store
 import (
 	"sort"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -83,3 +85,34 @@ func TestSyncState_IDsToBeDeletedLoaded(t *testing.T) {
 	sort.Strings(idsToBeDeleted)
 	assert.Equal(t, generateIDs(4, 9), idsToBeDeleted)
 }
+
+func TestSyncState_Progress(t *testing.T) {
+	store := &mockStoreSynchronizer{}
+	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
+
+	syncState.setTotal(10)
+	syncState.progress.Done = 2 // Synced by previous run.
+	syncState.startProgress()
+	syncState.startTime = syncState.startTime.Add(-4 * time.Second)
+
+	syncState.addProgress([]*pmapi.Message{{Size: 100}, {Size: 200}, {Size: 300}, {Size: 400}})
+
+	progress := syncState.getProgress(syncState.startTime.Add(4 * time.Second))
+	assert.Equal(t, 6, progress.Done)
+	assert.Equal(t, 10, progress.Total)
+	assert.Equal(t, int64(1000), progress.Bytes)
+	assert.Equal(t, 4*time.Second, progress.ETA)
+}
+
+func TestSyncState_ProgressDoneNotOverTotal(t *testing.T) {
+	store := &mockStoreSynchronizer{}
+	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
+
+	syncState.setTotal(1)
+	syncState.startProgress()
+	syncState.addProgress([]*pmapi.Message{{ID: "1"}, {ID: "1"}})
+
+	progress := syncState.getProgress(time.Now())
+	assert.Equal(t, 1, progress.Done)
+	assert.Equal(t, time.Duration(0), progress.ETA)
+}
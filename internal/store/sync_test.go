@@ -104,7 +104,13 @@ func (m *mockStoreSynchronizer) deleteMessagesEvent([]string) error {
 	return nil
 }
 
-func (m *mockStoreSynchronizer) saveSyncState(finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string) {
+func (m *mockStoreSynchronizer) saveSyncState(finishTime int64, idRanges []*syncIDRange, progress syncProgress) {
+}
+
+func (m *mockStoreSynchronizer) saveIDsToBeDeleted(idsToBeDeleted []string) {
+}
+
+func (m *mockStoreSynchronizer) removeIDsToBeDeleted(ids []string) {
 }
 
 func newTestSyncState(store storeSynchronizer, splitIDs ...string) *syncState {
@@ -342,6 +348,29 @@ func TestFindIDRanges(t *testing.T) { //nolint[funlen]
 	}
 }
 
+func TestFindIDRanges_MaxWorkers(t *testing.T) {
+	defer SetSyncMaxWorkers(SyncDefaultWorkers)
+
+	api := &mockLister{
+		messageIDs: generateIDs(1, 150000),
+	}
+
+	for _, workers := range []int{1, 10, SyncMaxWorkers} {
+		SetSyncMaxWorkers(workers)
+		syncState := newTestSyncState(&mockStoreSynchronizer{})
+
+		require.Nil(t, findIDRanges(pmapi.AllMailLabel, api, syncState))
+		require.Equal(t, workers, len(syncState.idRanges))
+		assert.Equal(t, "", syncState.idRanges[0].StartID)
+		assert.Equal(t, "", syncState.idRanges[workers-1].StopID)
+	}
+
+	SetSyncMaxWorkers(100)
+	assert.Equal(t, SyncMaxWorkers, getSyncMaxWorkers())
+	SetSyncMaxWorkers(0)
+	assert.Equal(t, 1, getSyncMaxWorkers())
+}
+
 func TestFindIDRanges_FailedListing(t *testing.T) {
 	store := &mockStoreSynchronizer{}
 	api := &mockLister{
@@ -418,7 +447,7 @@ func TestGetSplitIDAndCount(t *testing.T) { //nolint[funlen]
 				messageIDs: tc.messageIDs,
 			}
 
-			id, total, err := getSplitIDAndCount(pmapi.AllMailLabel, api, tc.page)
+			id, total, err := getSplitIDAndCount(pmapi.AllMailLabel, api, tc.page, 0)
 
 			if tc.wantErr == "" {
 				require.Nil(t, err)
@@ -20,6 +20,7 @@ package store
 import (
 	"io"
 
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -33,16 +34,19 @@ type PMAPIProvider interface {
 	Addresses() pmapi.AddressList
 
 	GetEvent(eventID string) (*pmapi.Event, error)
+	SetInitialSync(isInitialSync bool)
 
 	CountMessages(addressID string) ([]*pmapi.MessagesCount, error)
 	ListMessages(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
 	GetMessage(apiID string) (*pmapi.Message, error)
+	KeyRingForAddressID(addressID string) *pmcrypto.KeyRing
 	Import([]*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error)
 	DeleteMessages(apiIDs []string) error
 	LabelMessages(apiIDs []string, labelID string) error
 	UnlabelMessages(apiIDs []string, labelID string) error
 	MarkMessagesRead(apiIDs []string) error
 	MarkMessagesUnread(apiIDs []string) error
+	MarkMessagesHam(apiIDs []string) error
 
 	CreateDraft(m *pmapi.Message, parent string, action int) (created *pmapi.Message, err error)
 	CreateAttachment(att *pmapi.Attachment, r io.Reader, sig io.Reader) (created *pmapi.Attachment, err error)
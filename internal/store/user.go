@@ -17,18 +17,35 @@
 
 package store
 
+import "github.com/ProtonMail/proton-bridge/pkg/pmapi"
+
 // UserID returns user ID.
 func (store *Store) UserID() string {
 	return store.user.ID()
 }
 
-// GetSpace returns used and total space in bytes.
+// GetSpace returns used and total space in bytes. Values from the last event
+// are preferred because the user cached by the API client is not updated
+// when messages are added or removed.
 func (store *Store) GetSpace() (usedSpace, maxSpace uint, err error) {
-	apiUser, err := store.api.CurrentUser()
-	if err != nil {
-		return 0, 0, err
+	store.spaceLock.Lock()
+	defer store.spaceLock.Unlock()
+
+	if store.maxSpace == 0 {
+		apiUser, err := store.api.CurrentUser()
+		if err != nil {
+			return 0, 0, err
+		}
+		store.usedSpace, store.maxSpace = apiUser.UsedSpace, apiUser.MaxSpace
 	}
-	return uint(apiUser.UsedSpace), uint(apiUser.MaxSpace), nil
+	return uint(store.usedSpace), uint(store.maxSpace), nil
+}
+
+func (store *Store) updateSpace(apiUser *pmapi.User) {
+	store.spaceLock.Lock()
+	defer store.spaceLock.Unlock()
+
+	store.usedSpace, store.maxSpace = apiUser.UsedSpace, apiUser.MaxSpace
 }
 
 // GetMaxUpload returns max size of attachment in bytes.
@@ -39,3 +56,26 @@ func (store *Store) GetMaxUpload() (uint, error) {
 	}
 	return uint(apiUser.MaxUpload), nil
 }
+
+// messageSizeOverhead is allowance for headers and body of the message on top of attachments.
+const messageSizeOverhead = 1024 * 1024
+
+// MessageSizeLimit returns the maximum size of the whole message for the API
+// upload limit `maxUpload`. Attachments are base64 encoded in the message which
+// makes them a third bigger. Zero means unknown limit.
+func MessageSizeLimit(maxUpload uint) int64 {
+	if maxUpload == 0 {
+		return 0
+	}
+	return int64(maxUpload)*4/3 + messageSizeOverhead
+}
+
+// GetMaxMessageSize returns max size of the whole message in bytes.
+// Zero means unknown limit.
+func (store *Store) GetMaxMessageSize() (int64, error) {
+	maxUpload, err := store.GetMaxUpload()
+	if err != nil {
+		return 0, err
+	}
+	return MessageSizeLimit(maxUpload), nil
+}
@@ -72,40 +72,105 @@ func (store *Store) RebuildMailboxes() (err error) {
 	return store.initMailboxesBucket()
 }
 
+// projectMailboxes creates address objects for the current address mode
+// and updates mailboxes of the primary address from the metadata bucket.
+// Mailboxes of other addresses are the same in both modes (in combined mode
+// they are namespaces), so the messages keep their UIDs and no new sync is
+// needed.
+func (store *Store) projectMailboxes() (err error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	addrInfo, err := store.GetAddressInfo()
+	if err != nil {
+		return errors.Wrap(err, "failed to get addresses and address IDs")
+	}
+
+	// We need at least one address to continue.
+	if len(addrInfo) < 1 {
+		return errors.New("no addresses to project mailboxes to")
+	}
+
+	// init builds the address objects in store.addresses. The old ones are
+	// kept until the new ones are built and filled so that a failure leaves
+	// the store as it was.
+	oldAddresses := store.addresses
+	defer func() {
+		if err != nil {
+			store.addresses = oldAddresses
+		}
+	}()
+
+	store.addresses = nil
+	if err := store.init(false); err != nil {
+		return errors.Wrap(err, "failed to init store")
+	}
+
+	primary, ok := store.addresses[addrInfo[0].AddressID]
+	if !ok {
+		return errors.New("primary address is not initialised")
+	}
+
+	log.WithField("user", store.UserID()).Trace("Projecting mailboxes of primary address")
+	return store.fillMailboxes(map[string]*Address{primary.addressID: primary})
+}
+
 // createOrDeleteAddressesEvent creates address objects in the store for each necessary address
 // and deletes any address objects that shouldn't be there.
 // It doesn't do anything to addresses that are rightfully there.
+// Mailboxes of new addresses are filled from the metadata bucket so that
+// re-enabled addresses list their messages again. It returns login addresses
+// whose list of mailboxes changed (because of added or removed namespace).
 // It should only be called from the event loop.
-func (store *Store) createOrDeleteAddressesEvent() (err error) {
+func (store *Store) createOrDeleteAddressesEvent() (changed []string, err error) {
 	labels, err := store.initCounts()
 	if err != nil {
-		return errors.Wrap(err, "failed to initialise label counts")
+		return nil, errors.Wrap(err, "failed to initialise label counts")
 	}
 
 	addrInfo, err := store.GetAddressInfo()
 	if err != nil {
-		return errors.Wrap(err, "failed to get addresses and address IDs")
+		return nil, errors.Wrap(err, "failed to get addresses and address IDs")
 	}
 
 	// We need at least one address to continue.
 	if len(addrInfo) < 1 {
-		return errors.New("no addresses to initialise")
+		return nil, errors.New("no addresses to initialise")
 	}
 
-	// If in combined mode, we only need the user's primary address.
-	if store.addressMode == combinedMode {
-		addrInfo = addrInfo[:1]
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	oldAddresses := map[string]*Address{}
+	for addressID, storeAddress := range store.addresses {
+		oldAddresses[addressID] = storeAddress
 	}
 
 	// Go through all addresses that *should* be there.
-	for _, addr := range addrInfo {
-		if _, ok := store.addresses[addr.AddressID]; ok {
+	if err = store.addAddresses(addrInfo, labels); err != nil {
+		return nil, errors.Wrap(err, "failed to add address to store")
+	}
+
+	changedLogins := map[string]bool{}
+	addedAddresses := map[string]*Address{}
+	for addressID, storeAddress := range store.addresses {
+		oldAddress, ok := oldAddresses[addressID]
+		if ok && oldAddress == storeAddress {
 			continue
 		}
+		if ok {
+			changedLogins[oldAddress.loginAddress()] = true
+		}
+		if storeAddress.isNamespace() {
+			changedLogins[storeAddress.loginAddress()] = true
+		}
+		addedAddresses[addressID] = storeAddress
+	}
 
-		// This address is missing so we create it.
-		if err = store.addAddress(addr.Address, addr.AddressID, labels); err != nil {
-			return errors.Wrap(err, "failed to add address to store")
+	if len(addedAddresses) != 0 {
+		store.log.WithField("addresses", len(addedAddresses)).Info("Filling mailboxes of new addresses")
+		if err = store.fillMailboxes(addedAddresses); err != nil {
+			return nil, errors.Wrap(err, "failed to fill mailboxes of new addresses")
 		}
 	}
 
@@ -125,9 +190,18 @@ func (store *Store) createOrDeleteAddressesEvent() (err error) {
 		}
 
 		delete(store.addresses, addr.addressID)
+		changedLogins[addr.loginAddress()] = true
+
+		if err = addr.deleteMailboxes(); err != nil {
+			return nil, errors.Wrap(err, "failed to delete mailboxes of removed address")
+		}
+	}
+
+	for address := range changedLogins {
+		changed = append(changed, address)
 	}
 
-	return err
+	return changed, nil
 }
 
 // truncateAddressInfoBucket removes the address info bucket.
@@ -177,6 +251,25 @@ func (store *Store) truncateMailboxesBucket() (err error) {
 				return
 			}
 
+			// Mod-sequences are bound to UIDs which are assigned again.
+			for _, bucketName := range [][]byte{modSeqsBucket, expungedBucket} {
+				if addr.Bucket(bucketName) != nil {
+					if err = addr.DeleteBucket(bucketName); err != nil {
+						return
+					}
+				}
+				if _, err = addr.CreateBucketIfNotExists(bucketName); err != nil {
+					return
+				}
+			}
+
+			// Numbers of messages are counted again with the first change.
+			if addr.Bucket(msgCountsBucket) != nil {
+				if err = addr.DeleteBucket(msgCountsBucket); err != nil {
+					return
+				}
+			}
+
 			return
 		})
 	}
@@ -186,47 +279,65 @@ func (store *Store) truncateMailboxesBucket() (err error) {
 
 // initMailboxesBucket recreates the mailboxes bucket from the metadata bucket.
 func (store *Store) initMailboxesBucket() error {
-	return store.db.Update(func(tx *bolt.Tx) error {
-		i := 0
-		msgs := []*pmapi.Message{}
+	return store.fillMailboxes(store.addresses)
+}
 
-		err := tx.Bucket(metadataBucket).ForEach(func(k, v []byte) error {
-			msg := &pmapi.Message{}
+// fillMailboxes adds messages from the metadata bucket to mailboxes of the
+// given addresses.
+func (store *Store) fillMailboxes(addresses map[string]*Address) error {
+	mailboxes := []*Mailbox{}
+	for _, a := range addresses {
+		for _, m := range a.mailboxes {
+			mailboxes = append(mailboxes, m)
+		}
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return store.txFillMailboxes(tx, mailboxes)
+	})
+}
 
-			if err := json.Unmarshal(v, msg); err != nil {
+// txFillMailboxes adds messages from the metadata bucket to the mailboxes.
+func (store *Store) txFillMailboxes(tx *bolt.Tx, mailboxes []*Mailbox) error {
+	createOrUpdateMessages := func(msgs []*pmapi.Message) error {
+		for _, m := range mailboxes {
+			if err := m.txCreateOrUpdateMessages(tx, msgs); err != nil {
 				return err
 			}
-			msgs = append(msgs, msg)
-
-			// Calling txCreateOrUpdateMessages does some overhead by iterating
-			// all mailboxes, accessing buckets and so on. It's better to do in
-			// batches instead of one by one (seconds vs hours for huge accounts).
-			// Average size of metadata is 1k bytes, sometimes up to 2k bytes.
-			// 10k messages will take about 20 MB of memory.
-			i++
-			if i%10000 == 0 {
-				store.log.WithField("i", i).Debug("Init mboxes heartbeat")
-
-				for _, a := range store.addresses {
-					if err := a.txCreateOrUpdateMessages(tx, msgs); err != nil {
-						return err
-					}
-				}
-				msgs = []*pmapi.Message{}
-			}
+		}
+		return nil
+	}
 
-			return nil
-		})
-		if err != nil {
+	i := 0
+	msgs := []*pmapi.Message{}
+
+	err := tx.Bucket(metadataBucket).ForEach(func(k, v []byte) error {
+		msg := &pmapi.Message{}
+
+		if err := json.Unmarshal(v, msg); err != nil {
 			return err
 		}
-
-		for _, a := range store.addresses {
-			if err := a.txCreateOrUpdateMessages(tx, msgs); err != nil {
+		msgs = append(msgs, msg)
+
+		// Calling txCreateOrUpdateMessages does some overhead by iterating
+		// all mailboxes, accessing buckets and so on. It's better to do in
+		// batches instead of one by one (seconds vs hours for huge accounts).
+		// Average size of metadata is 1k bytes, sometimes up to 2k bytes.
+		// 10k messages will take about 20 MB of memory.
+		i++
+		if i%10000 == 0 {
+			store.log.WithField("i", i).Debug("Init mboxes heartbeat")
+
+			if err := createOrUpdateMessages(msgs); err != nil {
 				return err
 			}
+			msgs = []*pmapi.Message{}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	return createOrUpdateMessages(msgs)
 }
@@ -44,8 +44,8 @@ func (store *Store) createMailbox(name string) error {
 		name = strings.TrimPrefix(name, UserLabelsPrefix)
 		exclusive = 0
 	case strings.HasPrefix(name, UserFoldersPrefix):
-		name = strings.TrimPrefix(name, UserFoldersPrefix)
-		exclusive = 1
+		_, err := store.createFolder(strings.TrimPrefix(name, UserFoldersPrefix), color)
+		return err
 	default:
 		// Ideally we would throw an error here, but then Outlook for
 		// macOS keeps trying to make an IMAP Drafts folder and popping
@@ -64,6 +64,53 @@ func (store *Store) createMailbox(name string) error {
 	return err
 }
 
+// createFolder creates the folder via the API including its missing parent
+// folders and returns its ID. The path is without the "Folders/" prefix.
+func (store *Store) createFolder(path, color string) (string, error) {
+	parentPath, name := splitFolderPath(path)
+	if name == "" {
+		return "", fmt.Errorf("invalid folder name %q", path)
+	}
+
+	parentID, err := store.getOrCreateFolder(parentPath)
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := store.api.CreateLabel(&pmapi.Label{
+		Name:      name,
+		ParentID:  parentID,
+		Color:     color,
+		Exclusive: 1,
+		Type:      pmapi.LabelTypeMailbox,
+	})
+	if err != nil {
+		return "", err
+	}
+	return folder.ID, nil
+}
+
+// getOrCreateFolder returns ID of the folder with the path. Missing folder
+// is created. Empty path is the root of folders with empty ID.
+func (store *Store) getOrCreateFolder(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if folder, err := store.getMailbox(UserFoldersPrefix + path); err == nil {
+		return folder.labelID, nil
+	}
+	return store.createFolder(path, store.leastUsedColor())
+}
+
+// splitFolderPath splits the path of folder to the path of its parent and its name.
+func splitFolderPath(path string) (parentPath, name string) {
+	i := strings.LastIndex(path, PathDelimiter)
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+len(PathDelimiter):]
+}
+
 // allAddressesHaveMailbox returns whether each address has a mailbox with the given labelID.
 func (store *Store) allAddressesHaveMailbox(labelID string) bool {
 	store.lock.RLock()
@@ -130,13 +177,14 @@ func (store *Store) leastUsedColor() string {
 
 // updateMailbox updates the mailbox via the API.
 // The store mailbox is updated later by processing an event.
-func (store *Store) updateMailbox(labelID, newName, color string) error {
+func (store *Store) updateMailbox(labelID, newName, parentID, color string) error {
 	defer store.eventLoop.pollNow()
 
 	_, err := store.api.UpdateLabel(&pmapi.Label{
-		ID:    labelID,
-		Name:  newName,
-		Color: color,
+		ID:       labelID,
+		Name:     newName,
+		ParentID: parentID,
+		Color:    color,
 	})
 	return err
 }
@@ -209,6 +257,7 @@ func (store *Store) createOrUpdateMailboxEvent(label *pmapi.Label) error {
 			return err
 		}
 	}
+	store.updateKeywordLabels()
 	return nil
 }
 
@@ -225,5 +274,6 @@ func (store *Store) deleteMailboxEvent(labelID string) error {
 			return err
 		}
 	}
+	store.updateKeywordLabels()
 	return nil
 }
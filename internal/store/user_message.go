@@ -25,17 +25,22 @@ import (
 	"net/mail"
 	"net/textproto"
 	"strings"
+	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/parallel"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
 )
 
+const createAttachmentsWorkers = 5 // In how many workers to upload attachments (for one draft).
+
 // CreateDraft creates draft with attachments.
 // If `attachedPublicKey` is passed, it's added to attachments.
 // Both draft and attachments are encrypted with passed `kr` key.
+// Attachments are uploaded concurrently and returned in the original order.
 func (store *Store) CreateDraft(
 	kr *pmcrypto.KeyRing,
 	message *pmapi.Message,
@@ -69,16 +74,35 @@ func (store *Store) CreateDraft(
 		attachments = append(attachments, publicKeyAttachment)
 	}
 
-	for idx, attachment := range attachments {
+	input := make([]interface{}, len(attachments))
+	for idx := range attachments {
+		input[idx] = idx
+	}
+
+	processCallback := func(value interface{}) (interface{}, error) {
+		idx := value.(int)
+		attachment := attachments[idx]
 		attachment.MessageID = draft.ID
 		attachmentBody, _ := ioutil.ReadAll(attachmentReaders[idx])
 
 		createdAttachment, err := store.createAttachment(kr, attachment, attachmentBody)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "failed to create attachment for draft")
+			return nil, errors.Wrap(err, "failed to create attachment for draft")
 		}
+		return createdAttachment, nil
+	}
+
+	collectCallback := func(idx int, value interface{}) error {
+		attachments[idx] = value.(*pmapi.Attachment)
+		return nil
+	}
 
-		attachments[idx] = createdAttachment
+	if err := parallel.RunParallel(createAttachmentsWorkers, input, processCallback, collectCallback); err != nil {
+		// Deleting the draft removes also attachments uploaded so far.
+		if deleteErr := store.api.DeleteMessages([]string{draft.ID}); deleteErr != nil {
+			store.log.WithError(deleteErr).Warn("Cannot delete draft with failed attachment")
+		}
+		return nil, nil, err
 	}
 
 	return draft, attachments, nil
@@ -120,6 +144,31 @@ func (store *Store) SendMessage(messageID string, req *pmapi.SendMessageReq) err
 	return err
 }
 
+// ImportMessage imports the already encrypted message `body` as unread to the
+// address with `addressID` and labels it with `labelIDs`.
+func (store *Store) ImportMessage(addressID string, body []byte, labelIDs []string) (string, error) {
+	defer store.eventLoop.pollNow()
+
+	res, err := store.api.Import([]*pmapi.ImportMsgReq{{
+		AddressID: addressID,
+		Body:      body,
+		Unread:    1,
+		Time:      time.Now().Unix(),
+		LabelIDs:  labelIDs,
+	}})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to import message")
+	}
+	if len(res) == 0 {
+		return "", errors.New("failed to import message: no response")
+	}
+	if res[0].Error != nil {
+		return "", errors.Wrap(res[0].Error, "failed to import message")
+	}
+
+	return res[0].MessageID, nil
+}
+
 // getAllMessageIDs returns all API IDs of messages in the local database.
 func (store *Store) getAllMessageIDs() (apiIDs []string, err error) {
 	err = store.db.View(func(tx *bolt.Tx) error {
@@ -193,8 +242,18 @@ func (store *Store) createOrUpdateMessageEvent(msg *pmapi.Message) error {
 func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { //nolint[funlen]
 	store.log.WithField("msgs", msgs).Trace("Creating or updating messages in the store")
 
+	msgs, toBeDeleted, err := store.filterNotSyncedMessages(msgs)
+	if err != nil {
+		return err
+	}
+	if len(toBeDeleted) > 0 {
+		if err := store.deleteMessagesEvent(toBeDeleted); err != nil {
+			return err
+		}
+	}
+
 	// Strip non meta first to reduce memory (no need to keep all old msg ID data during update).
-	err := store.db.View(func(tx *bolt.Tx) error {
+	err = store.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(metadataBucket)
 		for _, msg := range msgs {
 			clearNonMetadata(msg)
@@ -227,10 +286,15 @@ func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { /
 	err = store.db.Update(func(tx *bolt.Tx) error {
 		metaBucket := tx.Bucket(metadataBucket)
 		for _, msg := range msgs {
+			if err := txResetAnsweredFlags(tx, msg); err != nil {
+				return err
+			}
 			err := store.txPutMessage(metaBucket, msg)
 			if err != nil {
 				return err
 			}
+			// Updates of mailboxes show also flags set over IMAP.
+			txApplyAnsweredFlags(tx, msg)
 		}
 		return nil
 	})
@@ -252,6 +316,8 @@ func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { /
 		return err
 	}
 
+	store.notifyFullTextIndex()
+
 	return nil
 }
 
@@ -318,11 +384,25 @@ func (store *Store) deleteMessagesEvent(apiIDs []string) error {
 				return err
 			}
 
+			if err := tx.Bucket(answeredBucket).Delete([]byte(apiID)); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(structuresBucket).Delete([]byte(apiID)); err != nil {
+				return err
+			}
+
+			if err := txRemoveFullText(tx, apiID); err != nil {
+				return err
+			}
+
 			for _, a := range store.addresses {
 				if err := a.txDeleteMessage(tx, apiID); err != nil {
 					return err
 				}
 			}
+
+			store.removeCachedMessage(apiID)
 		}
 		return nil
 	})
@@ -18,10 +18,19 @@
 package store
 
 import (
+	"errors"
+	"io"
 	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
 	a "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -154,3 +163,85 @@ func checkAllMessageIDs(t *testing.T, m *mocksForStore, wantIDs []string) {
 	require.Nil(t, allErr)
 	require.Equal(t, wantIDs, allIds)
 }
+
+func TestCreateDraftKeepsAttachmentOrder(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	m.api.EXPECT().CreateDraft(gomock.Any(), "", pmapi.DraftActionForward).Return(&pmapi.Message{ID: "draftID"}, nil)
+	m.api.EXPECT().CreateAttachment(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(att *pmapi.Attachment, _, _ io.Reader) (*pmapi.Attachment, error) {
+			// Earlier attachments are uploaded slower so uploads finish in reversed order.
+			idx, err := strconv.Atoi(att.Name)
+			require.NoError(t, err)
+			time.Sleep(time.Duration(10-idx) * 5 * time.Millisecond)
+			return &pmapi.Attachment{ID: "att" + att.Name, MessageID: att.MessageID}, nil
+		}).Times(10)
+
+	message, readers := getTestDraft(10)
+	draft, attachments, err := m.store.CreateDraft(getTestKeyRing(t), message, readers, "", "", "")
+	require.NoError(t, err)
+	a.Equal(t, "draftID", draft.ID)
+	require.Len(t, attachments, 10)
+	for idx, att := range attachments {
+		a.Equal(t, "att"+strconv.Itoa(idx), att.ID)
+		a.Equal(t, "draftID", att.MessageID)
+	}
+}
+
+func TestCreateDraftFailedAttachment(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	var uploading int32
+	m.api.EXPECT().CreateDraft(gomock.Any(), "", pmapi.DraftActionForward).Return(&pmapi.Message{ID: "draftID"}, nil)
+	m.api.EXPECT().CreateAttachment(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(att *pmapi.Attachment, _, _ io.Reader) (*pmapi.Attachment, error) {
+			atomic.AddInt32(&uploading, 1)
+			defer atomic.AddInt32(&uploading, -1)
+
+			time.Sleep(5 * time.Millisecond)
+			if att.Name == "3" {
+				return nil, errors.New("upload failed")
+			}
+			return &pmapi.Attachment{ID: "att" + att.Name, MessageID: att.MessageID}, nil
+		}).AnyTimes()
+	// Attachments uploaded before the failure are removed with the draft.
+	m.api.EXPECT().DeleteMessages([]string{"draftID"}).Return(nil)
+
+	message, readers := getTestDraft(10)
+	draft, attachments, err := m.store.CreateDraft(getTestKeyRing(t), message, readers, "", "", "")
+	require.Error(t, err)
+	a.Nil(t, draft)
+	a.Nil(t, attachments)
+
+	// No upload continues after the draft failed.
+	a.Equal(t, int32(0), atomic.LoadInt32(&uploading))
+}
+
+func getTestDraft(attachmentCount int) (*pmapi.Message, []io.Reader) {
+	message := &pmapi.Message{Subject: "Draft", Body: "body"}
+	readers := []io.Reader{}
+	for idx := 0; idx < attachmentCount; idx++ {
+		message.Attachments = append(message.Attachments, &pmapi.Attachment{
+			Name:     strconv.Itoa(idx),
+			MIMEType: "application/octet-stream",
+			Header:   textproto.MIMEHeader{},
+		})
+		readers = append(readers, strings.NewReader("attachment "+strconv.Itoa(idx)))
+	}
+	return message, readers
+}
+
+func getTestKeyRing(t *testing.T) *pmcrypto.KeyRing {
+	key, err := pmcrypto.GetGopenPGP().GenerateKey("user", "pm.me", "passphrase", "x25519", 256)
+	require.NoError(t, err)
+	kr, err := pmcrypto.ReadArmoredKeyRing(strings.NewReader(key))
+	require.NoError(t, err)
+	require.NoError(t, kr.UnlockWithPassphrase("passphrase"))
+	return kr
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
@@ -30,7 +31,8 @@ import (
 
 const syncFinishTimeKey = "sync_state" // The original key was sync_state and we want to keep compatibility.
 const syncIDRangesKey = "id_ranges"
-const syncIDsToBeDeletedKey = "ids_to_be_deleted"
+const syncProgressKey = "progress"
+const syncIDsToBeDeletedKey = "ids_to_be_deleted" // Old format of IDs to be deleted, toBeDeletedBucket is used instead.
 
 // updateCountsFromServer will download and set the counts.
 func (store *Store) updateCountsFromServer() error {
@@ -54,6 +56,11 @@ func (store *Store) isSynced(countsOnAPI []*pmapi.MessagesCount) (bool, error) {
 		return false, err
 	}
 
+	// Only part of messages is synced when the sync is limited by time.
+	if store.GetSyncMonths() != 0 {
+		return true, nil
+	}
+
 	allCounts, err := store.getOnAPICounts()
 	if err != nil {
 		return false, err
@@ -62,31 +69,21 @@ func (store *Store) isSynced(countsOnAPI []*pmapi.MessagesCount) (bool, error) {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
+	hasExcluded := store.hasExcludedMailboxes()
+
 	countsAreOK := true
 	for _, counts := range allCounts {
-		total, unread := uint(0), uint(0)
-		for _, address := range store.addresses {
-			mbox, err := address.getMailboxByID(counts.LabelID)
-			if err != nil {
-				return false, errors.Wrapf(
-					err,
-					"cannot find mailbox for address %q",
-					address.addressID,
-				)
-			}
+		if !store.isLabelFullySynced(counts.LabelID, hasExcluded) {
+			continue
+		}
 
-			mboxTot, mboxUnread, err := mbox.GetCounts()
-			if err != nil {
-				errW := errors.Wrap(err, "cannot count messages")
-				store.log.
-					WithError(errW).
-					WithField("label", counts.LabelID).
-					WithField("address", address.addressID).
-					Error("IsSynced failed")
-				return false, err
-			}
-			total += mboxTot
-			unread += mboxUnread
+		total, unread, err := store.getLabelCounts(counts.LabelID)
+		if err != nil {
+			store.log.
+				WithError(err).
+				WithField("label", counts.LabelID).
+				Error("IsSynced failed")
+			return false, err
 		}
 
 		if total != counts.TotalOnAPI || unread != counts.UnreadOnAPI {
@@ -104,19 +101,63 @@ func (store *Store) isSynced(countsOnAPI []*pmapi.MessagesCount) (bool, error) {
 	return countsAreOK, nil
 }
 
+// isLabelFullySynced returns whether all messages of the label are supposed
+// to be in the store, i.e., whether local counts should match counts on API.
+func (store *Store) isLabelFullySynced(labelID string, hasExcluded bool) bool {
+	// Mailboxes limited by sync window do not list all messages.
+	if !store.GetSyncWindow(labelID).IsZero() {
+		return false
+	}
+	// Messages of excluded mailboxes are missing also in All Mail.
+	if hasExcluded && (labelID == pmapi.AllMailLabel || store.IsMailboxExcluded(labelID)) {
+		return false
+	}
+	return true
+}
+
+// getLabelCounts returns numbers of total and unread messages of the label
+// summed for all addresses. The store lock has to be held by caller.
+func (store *Store) getLabelCounts(labelID string) (total, unread uint, err error) {
+	for _, address := range store.addresses {
+		// Messages of namespaces are counted already by the login address.
+		if address.isNamespace() {
+			continue
+		}
+
+		mbox, err := address.getMailboxByID(labelID)
+		if err != nil {
+			return 0, 0, errors.Wrapf(
+				err,
+				"cannot find mailbox for address %q",
+				address.addressID,
+			)
+		}
+
+		mboxTot, mboxUnread, err := mbox.GetCounts()
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "cannot count messages")
+		}
+		total += mboxTot
+		unread += mboxUnread
+	}
+	return total, unread, nil
+}
+
 // triggerSync starts a sync of complete user by syncing All Mail mailbox.
 // All Mail mailbox contains all messages, so we download all meta data needed
 // to generate any address/mailbox IMAP UIDs.
 // Sync state can be in three states:
 //  * Nothing in database. For example when user logs in for the first time.
 //    `triggerSync` will start full sync.
-//  * Database has syncIDRangesKey and syncIDsToBeDeletedKey keys with data.
+//  * Database has syncIDRangesKey key and toBeDeletedBucket with data.
 //    Sync is in progress or was interrupted. In later case when, `triggerSync`
-//    will continue where it left off.
+//    will continue where it left off. Ranges are saved after every synced
+//    page so at most one page per worker is synced again.
 //  * Database has only syncStateKey with time when database was last synced.
 //    `triggerSync` will reset it and start full sync again.
 func (store *Store) triggerSync() {
 	syncState := store.loadSyncState()
+	syncState.begin = store.getSyncBegin()
 
 	// We first clear the last sync state in case this sync fails.
 	syncState.clearFinishTime()
@@ -134,6 +175,7 @@ func (store *Store) triggerSync() {
 			return
 		}
 		store.isSyncRunning = true
+		store.syncState = syncState
 		store.lock.Unlock()
 
 		defer func() {
@@ -142,6 +184,9 @@ func (store *Store) triggerSync() {
 			store.lock.Unlock()
 		}()
 
+		store.api.SetInitialSync(true)
+		defer store.api.SetInitialSync(false)
+
 		store.log.WithField("isIncomplete", syncState.isIncomplete()).Info("Store sync started")
 
 		err := syncAllMail(store.panicHandler, store, store.api, syncState)
@@ -159,12 +204,43 @@ func (store *Store) isSyncFinished() (isSynced bool) {
 	return store.loadSyncState().isFinished()
 }
 
+// SyncProgress describes the progress of the sync of the whole account.
+type SyncProgress struct {
+	IsRunning bool
+	Mailbox   string // IMAP name of the mailbox being synced.
+	Done      int
+	Total     int
+	Bytes     int64         // Size of synced messages on the server.
+	ETA       time.Duration // Zero when it cannot be estimated yet.
+}
+
+// GetSyncProgress returns progress of the ongoing sync. When no sync is
+// running, it returns progress saved in database by the last sync.
+func (store *Store) GetSyncProgress() SyncProgress {
+	store.lock.RLock()
+	isSyncRunning, syncState := store.isSyncRunning, store.syncState
+	store.lock.RUnlock()
+
+	if syncState == nil {
+		syncState = store.loadSyncState()
+	}
+
+	progress := syncState.getProgress(time.Now())
+	if isSyncRunning {
+		progress.IsRunning = true
+		progress.Mailbox = getSystemFolderName(pmapi.AllMailLabel)
+	}
+	return progress
+}
+
 // loadSyncState loads information about sync from database.
 // See `triggerSync` to learn more about possible states.
 func (store *Store) loadSyncState() *syncState {
 	finishTime := int64(0)
 	idRanges := []*syncIDRange{}
 	idsToBeDeleted := []string{}
+	progress := syncProgress{}
+	migrateIDsToBeDeleted := false
 
 	err := store.db.View(func(tx *bolt.Tx) (err error) {
 		b := tx.Bucket(syncStateBucket)
@@ -184,11 +260,26 @@ func (store *Store) loadSyncState() *syncState {
 			}
 		}
 
+		progressData := b.Get([]byte(syncProgressKey))
+		if progressData != nil {
+			if err := json.Unmarshal(progressData, &progress); err != nil {
+				store.log.WithError(err).Error("Failed to unmarshal sync progress")
+			}
+		}
+
 		idsToBeDeletedData := b.Get([]byte(syncIDsToBeDeletedKey))
 		if idsToBeDeletedData != nil {
 			if err := json.Unmarshal(idsToBeDeletedData, &idsToBeDeleted); err != nil {
 				store.log.WithError(err).Error("Failed to unmarshal sync IDs to be deleted")
 			}
+			migrateIDsToBeDeleted = true
+		}
+
+		if toBeDeleted := b.Bucket(toBeDeletedBucket); toBeDeleted != nil {
+			return toBeDeleted.ForEach(func(id, _ []byte) error {
+				idsToBeDeleted = append(idsToBeDeleted, string(id))
+				return nil
+			})
 		}
 
 		return
@@ -198,20 +289,25 @@ func (store *Store) loadSyncState() *syncState {
 		store.log.WithError(err).Error("Failed to load sync state")
 	}
 
-	return newSyncState(store, finishTime, idRanges, idsToBeDeleted)
+	if migrateIDsToBeDeleted {
+		store.saveIDsToBeDeleted(idsToBeDeleted)
+	}
+
+	syncState := newSyncState(store, finishTime, idRanges, idsToBeDeleted)
+	syncState.progress = progress
+	return syncState
 }
 
 // saveSyncState saves information about sync to database.
 // See `triggerSync` to learn more about possible states.
-func (store *Store) saveSyncState(finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string) {
+func (store *Store) saveSyncState(finishTime int64, idRanges []*syncIDRange, progress syncProgress) {
 	idRangesData, err := json.Marshal(idRanges)
 	if err != nil {
 		store.log.WithError(err).Error("Failed to marshall sync IDs ranges")
 	}
-
-	idsToBeDeletedData, err := json.Marshal(idsToBeDeleted)
+	progressData, err := json.Marshal(progress)
 	if err != nil {
-		store.log.WithError(err).Error("Failed to marshall sync IDs to be deleted")
+		store.log.WithError(err).Error("Failed to marshall sync progress")
 	}
 
 	err = store.db.Update(func(tx *bolt.Tx) (err error) {
@@ -224,17 +320,58 @@ func (store *Store) saveSyncState(finishTime int64, idRanges []*syncIDRange, ids
 			if err := b.Delete([]byte(syncIDRangesKey)); err != nil {
 				return err
 			}
-			if err := b.Delete([]byte(syncIDsToBeDeletedKey)); err != nil {
+			if err := b.Put([]byte(syncProgressKey), progressData); err != nil {
 				return err
 			}
-		} else {
-			if err := b.Delete([]byte(syncFinishTimeKey)); err != nil {
-				return err
-			}
-			if err := b.Put([]byte(syncIDRangesKey), idRangesData); err != nil {
+			return txDeleteIDsToBeDeleted(b)
+		}
+		if err := b.Delete([]byte(syncFinishTimeKey)); err != nil {
+			return err
+		}
+		if err := b.Put([]byte(syncProgressKey), progressData); err != nil {
+			return err
+		}
+		return b.Put([]byte(syncIDRangesKey), idRangesData)
+	})
+
+	if err != nil {
+		store.log.WithError(err).Error("Failed to set sync state")
+	}
+}
+
+// saveIDsToBeDeleted replaces IDs of messages to be deleted after sync.
+func (store *Store) saveIDsToBeDeleted(idsToBeDeleted []string) {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(syncStateBucket)
+		if err := txDeleteIDsToBeDeleted(b); err != nil {
+			return err
+		}
+		toBeDeleted, err := b.CreateBucket(toBeDeletedBucket)
+		if err != nil {
+			return err
+		}
+		for _, id := range idsToBeDeleted {
+			if err := toBeDeleted.Put([]byte(id), []byte{}); err != nil {
 				return err
 			}
-			if err := b.Put([]byte(syncIDsToBeDeletedKey), idsToBeDeletedData); err != nil {
+		}
+		return nil
+	})
+
+	if err != nil {
+		store.log.WithError(err).Error("Failed to set sync IDs to be deleted")
+	}
+}
+
+// removeIDsToBeDeleted removes IDs of synced messages from IDs to be deleted.
+func (store *Store) removeIDsToBeDeleted(ids []string) {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		toBeDeleted := tx.Bucket(syncStateBucket).Bucket(toBeDeletedBucket)
+		if toBeDeleted == nil {
+			return nil
+		}
+		for _, id := range ids {
+			if err := toBeDeleted.Delete([]byte(id)); err != nil {
 				return err
 			}
 		}
@@ -242,6 +379,16 @@ func (store *Store) saveSyncState(finishTime int64, idRanges []*syncIDRange, ids
 	})
 
 	if err != nil {
-		store.log.WithError(err).Error("Failed to set sync state")
+		store.log.WithError(err).Error("Failed to remove synced IDs from IDs to be deleted")
+	}
+}
+
+func txDeleteIDsToBeDeleted(b *bolt.Bucket) error {
+	if err := b.Delete([]byte(syncIDsToBeDeletedKey)); err != nil {
+		return err
+	}
+	if err := b.DeleteBucket(toBeDeletedBucket); err != nil && err != bolt.ErrBucketNotFound {
+		return err
 	}
+	return nil
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestLoadSaveSyncState(t *testing.T) {
@@ -49,10 +50,13 @@ func TestLoadSaveSyncState(t *testing.T) {
 	syncState.initIDRanges()
 	syncState.addIDRange("100")
 	syncState.addIDRange("200")
+	syncState.setTotal(2)
+	syncState.addProgress([]*pmapi.Message{{ID: "msg1", Size: 10}})
 	syncState.save()
 
 	syncState = m.store.loadSyncState()
 	checkSyncStateAfterLoad(t, syncState, false, true, []string{})
+	assert.Equal(t, syncProgress{Total: 2, Done: 1, Bytes: 10}, syncState.progress)
 
 	// Save IDs to be deleted and check everything is properly loaded.
 
@@ -61,6 +65,13 @@ func TestLoadSaveSyncState(t *testing.T) {
 	syncState = m.store.loadSyncState()
 	checkSyncStateAfterLoad(t, syncState, false, true, []string{"msg1", "msg2"})
 
+	// Synced messages are removed from IDs to be deleted.
+
+	syncState.doNotDeleteMessageIDs([]string{"msg1"})
+
+	syncState = m.store.loadSyncState()
+	checkSyncStateAfterLoad(t, syncState, false, true, []string{"msg2"})
+
 	// Set finish time and check everything is resetted to empty values.
 
 	syncState.setFinishTime()
@@ -69,6 +80,31 @@ func TestLoadSaveSyncState(t *testing.T) {
 	checkSyncStateAfterLoad(t, syncState, true, false, []string{})
 }
 
+func TestLoadSyncStateMigratesIDsToBeDeleted(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	syncState := m.store.loadSyncState()
+	syncState.clearFinishTime()
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncStateBucket).Put([]byte(syncIDsToBeDeletedKey), []byte(`["msg1","msg2"]`))
+	}))
+
+	syncState = m.store.loadSyncState()
+	checkSyncStateAfterLoad(t, syncState, false, false, []string{"msg1", "msg2"})
+
+	syncState.doNotDeleteMessageID("msg2")
+
+	syncState = m.store.loadSyncState()
+	checkSyncStateAfterLoad(t, syncState, false, false, []string{"msg1"})
+	require.NoError(t, m.store.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket(syncStateBucket).Get([]byte(syncIDsToBeDeletedKey)))
+		return nil
+	}))
+}
+
 func checkSyncStateAfterLoad(t *testing.T, syncState *syncState, wantIsFinished bool, wantIDRanges bool, wantIDsToBeDeleted []string) {
 	assert.Equal(t, wantIsFinished, syncState.isFinished())
 
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageSizeLimit(t *testing.T) {
+	assert.Equal(t, int64(0), MessageSizeLimit(0))
+	assert.Equal(t, int64(3000+messageSizeOverhead), MessageSizeLimit(2250))
+}
+
+func TestGetSpaceUpdatedByEvent(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	m.api.EXPECT().CurrentUser().Return(&pmapi.User{UsedSpace: 10, MaxSpace: 100}, nil)
+	usedSpace, maxSpace, err := m.store.GetSpace()
+	require.NoError(t, err)
+	assert.Equal(t, uint(10), usedSpace)
+	assert.Equal(t, uint(100), maxSpace)
+
+	require.NoError(t, m.store.eventLoop.processEvent(&pmapi.Event{
+		EventID: "event",
+		User:    pmapi.User{UsedSpace: 20, MaxSpace: 200},
+	}))
+	usedSpace, maxSpace, err = m.store.GetSpace()
+	require.NoError(t, err)
+	assert.Equal(t, uint(20), usedSpace)
+	assert.Equal(t, uint(200), maxSpace)
+}
@@ -130,7 +130,11 @@ func (c *Config) ClearOldData() error {
 			filePath != c.GetTLSKeyPath() &&
 			filePath != c.GetEventsPath() &&
 			filePath != c.GetIMAPCachePath() &&
+			filePath != c.GetSendRecorderPath() &&
+			filePath != c.GetOutboxPath() &&
+			filePath != c.GetSendJournalPath() &&
 			filePath != c.GetLockPath() &&
+			filePath != c.GetUIDsDir() &&
 			filePath != c.GetPreferencesPath())
 	})
 }
@@ -208,11 +212,41 @@ func (c *Config) GetTLSKeyPath() string {
 	return filepath.Join(c.appDirs.UserConfig(), "key.pem")
 }
 
+// GetIMAPSCertPath returns path to certificate supplied by the user for IMAPS.
+// The bridge certificate is used when the file does not exist.
+func (c *Config) GetIMAPSCertPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "imaps_cert.pem")
+}
+
+// GetIMAPSKeyPath returns path to private key supplied by the user for IMAPS.
+func (c *Config) GetIMAPSKeyPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "imaps_key.pem")
+}
+
+// GetIMAPTracePath returns path to a new file for a trace of IMAP connection.
+// It is in the log folder so it is attached to bug reports with other logs.
+func (c *Config) GetIMAPTracePath() string {
+	return filepath.Join(c.GetLogDir(), getLogFilename(c.GetLogPrefix()+"_imap_trace"))
+}
+
+// GetIMAPKeywordsPath returns path to file with mapping of IMAP keywords to labels.
+// It is a configuration file edited by the user so it is not in the cache.
+func (c *Config) GetIMAPKeywordsPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "imap_keywords.json")
+}
+
 // GetDBDir returns folder for db files.
 func (c *Config) GetDBDir() string {
 	return filepath.Join(c.appDirsVersion.UserCache())
 }
 
+// GetUIDsDir returns folder for UIDs saved by stores.
+// It is not part of the versioned cache and it is not removed with old data,
+// so clients do not need to download all messages again after the database is built again.
+func (c *Config) GetUIDsDir() string {
+	return filepath.Join(c.appDirs.UserCache(), "uids")
+}
+
 // GetEventsPath returns path to events file containing the last processed event IDs.
 func (c *Config) GetEventsPath() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), "events.json")
@@ -223,6 +257,23 @@ func (c *Config) GetIMAPCachePath() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), "user_info.json")
 }
 
+// GetSendRecorderPath returns path to file with hashes of recently sent messages.
+// It is not part of the versioned cache so it survives updates changing the cache version.
+func (c *Config) GetSendRecorderPath() string {
+	return filepath.Join(c.appDirs.UserCache(), "send_recorder.json")
+}
+
+// GetOutboxPath returns path to directory with messages waiting to be sent.
+// Like the send recorder, it is not part of the versioned cache.
+func (c *Config) GetOutboxPath() string {
+	return filepath.Join(c.appDirs.UserCache(), "outbox")
+}
+
+// GetSendJournalPath returns path to file with history of messages submitted over SMTP.
+func (c *Config) GetSendJournalPath() string {
+	return filepath.Join(c.appDirs.UserCache(), "send_journal.json")
+}
+
 // GetLockPath returns path to lock file to check if bridge is already running.
 func (c *Config) GetLockPath() string {
 	return filepath.Join(c.appDirsVersion.UserCache(), c.appName+".lock")
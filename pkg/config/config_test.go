@@ -121,6 +121,11 @@ func TestClearOldDataLinux(t *testing.T) {
 		"cache/c2/prefs.json",
 		"cache/c2/updates",
 		"cache/c2/user_info.json",
+		"cache/outbox",
+		"cache/outbox/a1b2.json",
+		"cache/send_recorder.json",
+		"cache/uids",
+		"cache/uids/uids-user.db",
 		"config",
 		"config/cert.pem",
 		"config/key.pem",
@@ -151,6 +156,11 @@ func TestClearOldDataWindows(t *testing.T) {
 		"cache/c2/prefs.json",
 		"cache/c2/updates",
 		"cache/c2/user_info.json",
+		"cache/outbox",
+		"cache/outbox/a1b2.json",
+		"cache/send_recorder.json",
+		"cache/uids",
+		"cache/uids/uids-user.db",
 		"cache/v1_10.log",
 		"cache/v1_11.log",
 		"cache/v2_12.log",
@@ -203,6 +213,12 @@ func createTestStructure(m mocks, baseDir, logsDir, configDir, cacheDir, version
 	require.NoError(m.t, ioutil.WriteFile(filepath.Join(configDir, "cert.pem"), []byte("Hello"), 0755))
 	require.NoError(m.t, ioutil.WriteFile(filepath.Join(configDir, "key.pem"), []byte("Hello"), 0755))
 
+	require.NoError(m.t, ioutil.WriteFile(filepath.Join(cacheDir, "send_recorder.json"), []byte("Hello"), 0755))
+	require.NoError(m.t, os.MkdirAll(filepath.Join(cacheDir, "outbox"), 0700))
+	require.NoError(m.t, ioutil.WriteFile(filepath.Join(cacheDir, "outbox", "a1b2.json"), []byte("Hello"), 0755))
+	require.NoError(m.t, os.MkdirAll(filepath.Join(cacheDir, "uids"), 0700))
+	require.NoError(m.t, ioutil.WriteFile(filepath.Join(cacheDir, "uids", "uids-user.db"), []byte("Hello"), 0755))
+
 	require.NoError(m.t, ioutil.WriteFile(filepath.Join(versionedOldCacheDir, "prefs.json"), []byte("Hello"), 0755))
 	require.NoError(m.t, ioutil.WriteFile(filepath.Join(versionedOldCacheDir, "events.json"), []byte("Hello"), 0755))
 	require.NoError(m.t, ioutil.WriteFile(filepath.Join(versionedOldCacheDir, "user_info.json"), []byte("Hello"), 0755))
@@ -157,6 +157,11 @@ func TestClearLogsLinux(t *testing.T) {
 		"cache/c2/prefs.json",
 		"cache/c2/updates",
 		"cache/c2/user_info.json",
+		"cache/outbox",
+		"cache/outbox/a1b2.json",
+		"cache/send_recorder.json",
+		"cache/uids",
+		"cache/uids/uids-user.db",
 		"config",
 		"config/cert.pem",
 		"config/key.pem",
@@ -193,6 +198,11 @@ func TestClearLogsWindows(t *testing.T) {
 		"cache/c2/updates",
 		"cache/c2/user_info.json",
 		"cache/other.log",
+		"cache/outbox",
+		"cache/outbox/a1b2.json",
+		"cache/send_recorder.json",
+		"cache/uids",
+		"cache/uids/uids-user.db",
 		"cache/v1_11.log",
 		"cache/v2_12.log",
 		"cache/v2_13.log",
@@ -102,6 +102,28 @@ func GetTLSConfig(cfg tlsConfiger) (tlsConfig *tls.Config, err error) {
 	return tlsConfig, err
 }
 
+// GetUserTLSConfig loads TLS config with certificate supplied by the user.
+// The fallback config is returned when there is no such certificate or it
+// cannot be loaded. The user has to renew the certificate, it is not generated.
+func GetUserTLSConfig(certPath, keyPath string, fallback *tls.Config) *tls.Config {
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		return fallback
+	}
+
+	tlsConfig, err := loadTLSConfig(certPath, keyPath)
+	if err == ErrTLSCertExpireSoon {
+		log.WithField("path", certPath).Warn("User certificate will expire soon")
+		return tlsConfig
+	}
+	if err != nil {
+		log.WithError(err).WithField("path", certPath).Error("Cannot load user certificate, using bridge certificate")
+		return fallback
+	}
+
+	log.WithField("path", certPath).Info("Using user certificate")
+	return tlsConfig
+}
+
 func loadTLSConfig(certPath, keyPath string) (tlsConfig *tls.Config, err error) {
 	c, err := tls.LoadX509KeyPair(certPath, keyPath)
 	if err != nil {
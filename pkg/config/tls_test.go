@@ -18,6 +18,8 @@
 package config
 
 import (
+	"crypto/tls"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -61,3 +63,27 @@ func TestTLSKeyRenewal(t *testing.T) {
 	now, notValidAfter = time.Now(), cert.Certificates[0].Leaf.NotAfter
 	require.False(t, now.After(notValidAfter), "new certificate expected to be valid at %v but have valid until %v", now, notValidAfter)
 }
+
+func TestGetUserTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "user-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	fallback := &tls.Config{}
+
+	// No user certificate.
+	require.Equal(t, fallback, GetUserTLSConfig(certPath, keyPath, fallback))
+
+	// Broken user certificate.
+	require.NoError(t, ioutil.WriteFile(certPath, []byte("not a certificate"), 0600))
+	require.Equal(t, fallback, GetUserTLSConfig(certPath, keyPath, fallback))
+
+	// Valid user certificate.
+	generated, err := generateTLSConfig(certPath, keyPath)
+	require.NoError(t, err)
+	userConfig := GetUserTLSConfig(certPath, keyPath, fallback)
+	require.NotEqual(t, fallback, userConfig)
+	require.Equal(t, generated.Certificates[0].Certificate, userConfig.Certificates[0].Certificate)
+}
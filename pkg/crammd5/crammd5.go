@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package crammd5 implements the server side of SASL CRAM-MD5 mechanism (RFC 2195).
+package crammd5
+
+import (
+	"crypto/hmac"
+	"crypto/md5" //nolint[gosec]
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+)
+
+// Mechanism is the name of CRAM-MD5 SASL mechanism.
+const Mechanism = "CRAM-MD5"
+
+var (
+	// ErrIncorrectDigest is returned when the digest does not match the secret.
+	ErrIncorrectDigest = errors.New("incorrect CRAM-MD5 digest") //nolint[gochecknoglobals]
+
+	errInvalidResponse = errors.New("invalid CRAM-MD5 response") //nolint[gochecknoglobals]
+)
+
+// Authenticator checks that `digest` is the digest of `challenge` computed
+// with the secret of `username`.
+type Authenticator func(username, challenge, digest string) error
+
+// Digest returns hex encoded keyed MD5 of `challenge` with `secret` as key.
+func Digest(secret, challenge string) string {
+	mac := hmac.New(md5.New, []byte(secret))
+	_, _ = mac.Write([]byte(challenge))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check compares `digest` with the one computed from `secret` in constant time.
+func Check(secret, challenge, digest string) error {
+	expected := Digest(secret, challenge)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(digest))) != 1 {
+		return ErrIncorrectDigest
+	}
+	return nil
+}
+
+type server struct {
+	domain        string
+	authenticate  Authenticator
+	challenge     string
+	challengeSent bool
+}
+
+// NewServer returns SASL server sending a unique challenge in `domain`.
+func NewServer(domain string, authenticator Authenticator) sasl.Server {
+	return &server{domain: domain, authenticate: authenticator}
+}
+
+func (s *server) Next(response []byte) (challenge []byte, done bool, err error) {
+	if !s.challengeSent {
+		// CRAM-MD5 has no initial response.
+		if len(response) != 0 {
+			return nil, false, sasl.ErrUnexpectedClientResponse
+		}
+		if s.challenge, err = newChallenge(s.domain); err != nil {
+			return nil, false, err
+		}
+		s.challengeSent = true
+		return []byte(s.challenge), false, nil
+	}
+
+	sep := strings.LastIndexByte(string(response), ' ')
+	if sep <= 0 {
+		return nil, false, errInvalidResponse
+	}
+	username, digest := string(response[:sep]), string(response[sep+1:])
+	if err := s.authenticate(username, s.challenge, digest); err != nil {
+		return nil, false, err
+	}
+	return nil, true, nil
+}
+
+// newChallenge returns challenge in form of message ID as recommended by RFC.
+func newChallenge(domain string) (string, error) {
+	random, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%d.%d@%s>", random, time.Now().Unix(), domain), nil
+}
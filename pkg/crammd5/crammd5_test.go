@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package crammd5
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigest(t *testing.T) {
+	// Example from RFC 2195.
+	assert.Equal(t, "b913a602c7eda7a495b4e6e7334d3890", Digest("tanstaaftanstaaf", "<1896.697170952@postoffice.reston.mci.net>"))
+
+	assert.NoError(t, Check("tanstaaftanstaaf", "<1896.697170952@postoffice.reston.mci.net>", "B913A602C7EDA7A495B4E6E7334D3890"))
+	assert.Equal(t, ErrIncorrectDigest, Check("wrong", "<1896.697170952@postoffice.reston.mci.net>", "b913a602c7eda7a495b4e6e7334d3890"))
+}
+
+func TestServer(t *testing.T) {
+	var gotUsername string
+	s := NewServer("127.0.0.1", func(username, challenge, digest string) error {
+		gotUsername = username
+		return Check("secret", challenge, digest)
+	})
+
+	challenge, done, err := s.Next(nil)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.True(t, strings.HasPrefix(string(challenge), "<"))
+	assert.True(t, strings.HasSuffix(string(challenge), "@127.0.0.1>"))
+
+	_, done, err = s.Next([]byte("user@pm.me " + Digest("secret", string(challenge))))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "user@pm.me", gotUsername)
+}
+
+func TestServerInvalidResponse(t *testing.T) {
+	s := NewServer("127.0.0.1", func(username, challenge, digest string) error {
+		return Check("secret", challenge, digest)
+	})
+
+	_, _, err := s.Next([]byte("initial response"))
+	assert.Error(t, err)
+
+	_, _, err = s.Next(nil)
+	require.NoError(t, err)
+	_, _, err = s.Next([]byte("nodigest"))
+	assert.Error(t, err)
+
+	s = NewServer("127.0.0.1", func(username, challenge, digest string) error {
+		return Check("secret", challenge, digest)
+	})
+	_, _, err = s.Next(nil)
+	require.NoError(t, err)
+	_, _, err = s.Next([]byte("user@pm.me 0123456789abcdef0123456789abcdef"))
+	assert.Equal(t, ErrIncorrectDigest, err)
+}
@@ -27,6 +27,7 @@ var (
 	AppleMailJunkFlag      = imap.CanonicalFlag("$Junk")
 	ThunderbirdJunkFlag    = imap.CanonicalFlag("Junk")
 	ThunderbirdNonJunkFlag = imap.CanonicalFlag("NonJunk")
+	ForwardedFlag          = imap.CanonicalFlag("$Forwarded")
 )
 
 func GetFlags(m *pmapi.Message) (flags []string) {
@@ -39,6 +40,9 @@ func GetFlags(m *pmapi.Message) (flags []string) {
 	if m.Has(pmapi.FlagReplied) || m.Has(pmapi.FlagRepliedAll) {
 		flags = append(flags, imap.AnsweredFlag)
 	}
+	if m.Has(pmapi.FlagForwarded) {
+		flags = append(flags, ForwardedFlag)
+	}
 
 	hasSpam := false
 
@@ -76,6 +80,8 @@ func ParseFlags(m *pmapi.Message, flags []string) {
 			m.LabelIDs = append(m.LabelIDs, pmapi.StarredLabel)
 		case imap.AnsweredFlag:
 			m.Flags |= pmapi.FlagReplied
+		case ForwardedFlag:
+			m.Flags |= pmapi.FlagForwarded
 		case AppleMailJunkFlag, ThunderbirdJunkFlag:
 			m.LabelIDs = append(m.LabelIDs, pmapi.SpamLabel)
 		}
@@ -207,9 +207,17 @@ func decodePart(partReader io.Reader, header textproto.MIMEHeader) (decodedPart
 	return
 }
 
+// isForwardedMessage returns whether the part is a message forwarded as attachment.
+// Such parts must be passed through unchanged (RFC 2046 forbids re-encoding them
+// and any change would break signatures of the nested message).
+func isForwardedMessage(header textproto.MIMEHeader) bool {
+	mediaType, _, _ := pmmime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "message/rfc822"
+}
+
 func (sd SevenBitFilter) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSibling bool, isFirst, isLast bool) error {
 	cte := strings.ToLower(header.Get("Content-Transfer-Encoding"))
-	if isFirst && pmmime.IsLeaf(header) && cte != "quoted-printable" && cte != "base64" && cte != "7bit" {
+	if isFirst && pmmime.IsLeaf(header) && !isForwardedMessage(header) && cte != "quoted-printable" && cte != "base64" && cte != "7bit" {
 		decodedPart := decodePart(partReader, header)
 
 		filteredHeader := textproto.MIMEHeader{}
@@ -261,6 +269,19 @@ func randomBoundary() string {
 	return fmt.Sprintf("%x", buf[:])
 }
 
+// htmlToPlainText converts encoded HTML part to plain text.
+func htmlToPlainText(partData []byte, header textproto.MIMEHeader) (string, error) {
+	decoded, err := ioutil.ReadAll(decodePart(bytes.NewReader(partData), header))
+	if err != nil {
+		return "", err
+	}
+	_, params, _ := pmmime.ParseMediaType(header.Get("Content-Type"))
+	if decoded, err = pmmime.DecodeCharset(decoded, params); err != nil {
+		return "", err
+	}
+	return html2text.FromString(string(decoded))
+}
+
 func (hoc HTMLOnlyConvertor) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSiblings bool, isFirst, isLast bool) error {
 	mediaType, _, err := pmmime.ParseMediaType(header.Get("Content-Type"))
 	if isFirst && err == nil && mediaType == "text/html" && !hasPlainSiblings {
@@ -278,16 +299,17 @@ func (hoc HTMLOnlyConvertor) Accept(partReader io.Reader, header textproto.MIMEH
 
 		htmlChildHeaders := make(textproto.MIMEHeader)
 		htmlChildHeaders.Set("Content-Transfer-Encoding", childCte)
-		htmlChildHeaders.Set("Content-Type", "text/html")
+		htmlChildHeaders.Set("Content-Type", header.Get("Content-Type"))
 		htmlReader := bytes.NewReader(partData)
 		_ = hoc.target.Accept(htmlReader, htmlChildHeaders, false, true, false)
 
 		_ = hoc.target.Accept(partReader, multiPartHeaders, hasPlainSiblings, false, false)
 
+		// The text is converted from decoded HTML, therefore it is always UTF-8
+		// and its transfer encoding is left on the 7bit filter.
 		plainChildHeaders := make(textproto.MIMEHeader)
-		plainChildHeaders.Set("Content-Transfer-Encoding", childCte)
-		plainChildHeaders.Set("Content-Type", "text/plain")
-		unHtmlized, err := html2text.FromReader(bytes.NewReader(partData))
+		plainChildHeaders.Set("Content-Type", "text/plain; charset=utf-8")
+		unHtmlized, err := htmlToPlainText(partData, header)
 		if err != nil {
 			unHtmlized = string(partData)
 		}
@@ -18,7 +18,9 @@
 package message
 
 import (
+	"io/ioutil"
 	"net/mail"
+	"strings"
 	"testing"
 )
 
@@ -105,3 +107,76 @@ func TestRFC822AddressFormat(t *testing.T) { //nolint[funlen]
 		}
 	}
 }
+
+func TestParse_forwardedMessageUnchanged(t *testing.T) {
+	nested := "From: Alice <alice@example.com>\r\n" +
+		"Subject: Signed =?utf-8?q?n=C3=A1zev?=\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"P\xc5\x99\xc3\xadloha   \r\n" +
+		"trailing spaces and 8bit text must survive.\r\n"
+
+	raw := "From: Bob <bob@example.com>\r\n" +
+		"To: Carol <carol@example.com>\r\n" +
+		"Subject: Fwd: Signed\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached.\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Disposition: attachment\r\n" +
+		"\r\n" +
+		nested +
+		"\r\n--outer--\r\n"
+
+	m, mimeBody, _, atts, err := Parse(strings.NewReader(raw), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(mimeBody, nested) {
+		t.Errorf("forwarded message was modified in MIME body:\n%v", mimeBody)
+	}
+
+	if len(m.Attachments) != 1 || len(atts) != 1 {
+		t.Fatalf("expected one attachment, got %v", len(m.Attachments))
+	}
+	if m.Attachments[0].MIMEType != "message/rfc822" {
+		t.Errorf("unexpected attachment type %v", m.Attachments[0].MIMEType)
+	}
+	b, err := ioutil.ReadAll(atts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != nested {
+		t.Errorf("forwarded message attachment was modified:\n%q", b)
+	}
+}
+
+func TestParse_htmlOnlyPlainAlternative(t *testing.T) {
+	raw := "From: Bob <bob@example.com>\r\n" +
+		"To: Carol <carol@example.com>\r\n" +
+		"Subject: HTML only\r\n" +
+		"Content-Type: text/html; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PGI+SGVsbG8gd29ybGQ8L2I+IOk=\r\n" // <b>Hello world</b> é
+
+	_, mimeBody, plainContents, _, err := Parse(strings.NewReader(raw), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(mimeBody, "Content-Type: text/html; charset=iso-8859-1") {
+		t.Errorf("charset of HTML part was lost:\n%v", mimeBody)
+	}
+	if !strings.Contains(mimeBody, "Content-Type: text/plain; charset=utf-8") {
+		t.Errorf("plain text alternative is missing:\n%v", mimeBody)
+	}
+	if want := "*Hello world* é"; plainContents != want {
+		t.Errorf("unexpected plain text alternative %q, want %q", plainContents, want)
+	}
+}
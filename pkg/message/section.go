@@ -20,6 +20,7 @@ package message
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -157,6 +158,47 @@ func NewBodyStructure(reader io.Reader) (structure *BodyStructure, err error) {
 	return
 }
 
+// storedSectionInfo is sectionInfo without the reader used while parsing.
+type storedSectionInfo struct {
+	Header                    textproto.MIMEHeader
+	Start, BSize, Size, Lines int
+}
+
+// MarshalJSON encodes the structure so it can be stored and used later
+// without parsing the message again.
+func (bs *BodyStructure) MarshalJSON() ([]byte, error) {
+	stored := map[string]storedSectionInfo{}
+	for path, info := range *bs {
+		stored[path] = storedSectionInfo{
+			Header: info.header,
+			Start:  info.start,
+			BSize:  info.bsize,
+			Size:   info.size,
+			Lines:  info.lines,
+		}
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalJSON decodes the structure encoded by MarshalJSON.
+func (bs *BodyStructure) UnmarshalJSON(b []byte) error {
+	stored := map[string]storedSectionInfo{}
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return err
+	}
+	*bs = BodyStructure{}
+	for path, info := range stored {
+		(*bs)[path] = &sectionInfo{
+			header: info.Header,
+			start:  info.Start,
+			bsize:  info.BSize,
+			size:   info.Size,
+			lines:  info.Lines,
+		}
+	}
+	return nil
+}
+
 func (bs *BodyStructure) Parse(r io.Reader) error {
 	return bs.parseAllChildSections(r, []int{}, 0)
 }
@@ -296,46 +338,24 @@ func (bs *BodyStructure) getInfo(sectionPath []int) (sectionInfo *sectionInfo, e
 	return
 }
 
-func (bs *BodyStructure) GetSection(wholeMail io.ReadSeeker, sectionPath []int) (section []byte, err error) {
+// GetSectionReader returns the reader of the whole section which reads
+// the section from wholeMail only when it is read itself.
+func (bs *BodyStructure) GetSectionReader(wholeMail io.ReaderAt, sectionPath []int) (*io.SectionReader, error) {
 	info, err := bs.getInfo(sectionPath)
 	if err != nil {
-		return
-	}
-	if _, err = wholeMail.Seek(int64(info.start), io.SeekStart); err != nil {
-		return
+		return nil, err
 	}
-	section = make([]byte, info.size)
-	_, err = wholeMail.Read(section)
-	return
+	return io.NewSectionReader(wholeMail, int64(info.start), int64(info.size)), nil
 }
 
-func (bs *BodyStructure) GetSectionContent(wholeMail io.ReadSeeker, sectionPath []int) (section []byte, err error) {
+// GetSectionContentReader returns the reader of the section content without
+// header which reads the content from wholeMail only when it is read itself.
+func (bs *BodyStructure) GetSectionContentReader(wholeMail io.ReaderAt, sectionPath []int) (*io.SectionReader, error) {
 	info, err := bs.getInfo(sectionPath)
 	if err != nil {
-		return
-	}
-	if _, err = wholeMail.Seek(int64(info.start+info.size-info.bsize), io.SeekStart); err != nil {
-		return
+		return nil, err
 	}
-	section = make([]byte, info.bsize)
-	_, err = wholeMail.Read(section)
-	return
-
-	/* This is slow:
-	sectionBuf, err := bs.GetSection(wholeMail, sectionPath)
-	if err != nil {
-		return
-	}
-
-	tp := textproto.NewReader(bufio.NewReader(buf))
-	if _, err = tp.ReadMIMEHeader(); err != nil {
-		return err
-	}
-
-	sectionBuf = &bytes.Buffer{}
-	_, err = io.Copy(sectionBuf, tp.R)
-	return
-	*/
+	return io.NewSectionReader(wholeMail, int64(info.start+info.size-info.bsize), int64(info.bsize)), nil
 }
 
 func (bs *BodyStructure) GetSectionHeader(sectionPath []int) (header textproto.MIMEHeader, err error) {
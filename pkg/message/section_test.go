@@ -18,7 +18,9 @@
 package message
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -79,7 +81,9 @@ func TestGetSection(t *testing.T) {
 		mailReader := strings.NewReader(sampleMail)
 		info, err := bs.getInfo(try.path)
 		require.NoError(t, err)
-		section, err := bs.GetSection(mailReader, try.path)
+		sectionReader, err := bs.GetSectionReader(mailReader, try.path)
+		require.NoError(t, err)
+		section, err := ioutil.ReadAll(sectionReader)
 		require.NoError(t, err)
 
 		debug("section %v: %d %d\n___\n%s\n‾‾‾\n", try.path, info.start, info.size, string(section))
@@ -91,7 +95,9 @@ func TestGetSection(t *testing.T) {
 		mailReader := strings.NewReader(sampleMail)
 		info, err := bs.getInfo(try.path)
 		require.NoError(t, err)
-		section, err := bs.GetSectionContent(mailReader, try.path)
+		sectionReader, err := bs.GetSectionContentReader(mailReader, try.path)
+		require.NoError(t, err)
+		section, err := ioutil.ReadAll(sectionReader)
 		require.NoError(t, err)
 
 		debug("content %v: %d %d\n___\n%s\n‾‾‾\n", try.path, info.start+info.size-info.bsize, info.bsize, string(section))
@@ -100,6 +106,46 @@ func TestGetSection(t *testing.T) {
 	}
 }
 
+func TestBodyStructureJSON(t *testing.T) {
+	mail := "Content-Type: multipart/mixed; boundary=\"BOUNDARY\"\r\n" +
+		"\r\n" +
+		"--BOUNDARY\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"hello\r\n" +
+		"--BOUNDARY\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"d29ybGQ=\r\n" +
+		"--BOUNDARY--\r\n"
+
+	bs, err := NewBodyStructure(strings.NewReader(mail))
+	require.NoError(t, err)
+
+	b, err := json.Marshal(bs)
+	require.NoError(t, err)
+
+	stored := &BodyStructure{}
+	require.NoError(t, json.Unmarshal(b, stored))
+
+	want, err := bs.IMAPBodyStructure([]int{})
+	require.NoError(t, err)
+	have, err := stored.IMAPBodyStructure([]int{})
+	require.NoError(t, err)
+	require.Equal(t, want, have)
+	require.Equal(t, bs.Size(), stored.Size())
+
+	wantSection, err := bs.GetSectionContentReader(strings.NewReader(mail), []int{2})
+	require.NoError(t, err)
+	section, err := stored.GetSectionContentReader(strings.NewReader(mail), []int{2})
+	require.NoError(t, err)
+	require.Equal(t, wantSection.Size(), section.Size())
+	b, err = ioutil.ReadAll(section)
+	require.NoError(t, err)
+	require.Equal(t, "d29ybGQ=\r\n", string(b))
+}
+
 /* Structure example:
 HEADER     ([RFC-2822] header of the message)
 TEXT       ([RFC-2822] text body of the message) MULTIPART/MIXED
@@ -59,11 +59,24 @@ func RunParallel( //nolint[funlen]
 	orderedCollectLock := &sync.Mutex{}
 	orderedCollect := make(map[int]interface{})
 
+	// The error is set by workers or the collector and read by all of them.
+	resultErrorLock := &sync.Mutex{}
+	setError := func(err error) {
+		resultErrorLock.Lock()
+		defer resultErrorLock.Unlock()
+		resultError = err
+	}
+	hasError := func() bool {
+		resultErrorLock.Lock()
+		defer resultErrorLock.Unlock()
+		return resultError != nil
+	}
+
 	// Feed input channel used by workers with input data with index for ordering.
 	go func() {
 		defer close(inputChan)
 		for idx, item := range input {
-			if resultError != nil {
+			if hasError() {
 				break
 			}
 			inputChan <- &parallelJob{idx, item}
@@ -77,7 +90,7 @@ func RunParallel( //nolint[funlen]
 			defer wgProcess.Done()
 			for item := range inputChan {
 				if output, err := process(item.value); err != nil {
-					resultError = err
+					setError(err)
 					break
 				} else {
 					outputChan <- &parallelJob{item.idx, output}
@@ -103,14 +116,14 @@ func RunParallel( //nolint[funlen]
 		defer wgCollect.Done()
 		idx := 0
 		for {
-			if idx >= inputLen || resultError != nil {
+			if idx >= inputLen || hasError() {
 				break
 			}
 			orderedCollectLock.Lock()
 			value, ok := orderedCollect[idx]
 			if ok {
 				if err := collect(idx, value); err != nil {
-					resultError = err
+					setError(err)
 				}
 				delete(orderedCollect, idx)
 				idx++
@@ -51,6 +51,12 @@ const (
 	PremiumAddress
 )
 
+// Address CatchAll values.
+const (
+	NotCatchAllAddress = iota
+	CatchAllAddress
+)
+
 // Address Send values.
 const (
 	NoSendAddress = iota
@@ -72,6 +78,7 @@ type Address struct {
 	Signature   string
 	MemberID    string `json:",omitempty"`
 	MemberName  string `json:",omitempty"`
+	CatchAll    int    `json:",omitempty"`
 
 	HasKeys int
 	Keys    PMKeys
@@ -130,6 +137,23 @@ func (l AddressList) ByEmail(email string) *Address {
 	return nil
 }
 
+// ByCatchAllDomain gets the catch-all address of the custom domain of `email`.
+// Any address of the domain can be sent from the catch-all address.
+// Returns nil if no address is found.
+func (l AddressList) ByCatchAllDomain(email string) *Address {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil
+	}
+	domain := email[at:]
+	for _, addr := range l {
+		if addr.CatchAll == CatchAllAddress && strings.HasSuffix(strings.ToLower(addr.Email), strings.ToLower(domain)) {
+			return addr
+		}
+	}
+	return nil
+}
+
 func SanitizeEmail(email string) string {
 	splitAt := strings.Split(email, "@")
 	if len(splitAt) != 2 {
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter limits the number of bytes per second transferred by all
+// clients using it. Zero rate means no limit.
+type BandwidthLimiter struct {
+	lock     sync.Mutex
+	rate     int64
+	tokens   int64
+	lastTime time.Time
+}
+
+// BandwidthLimits holds limiters of downloaded and uploaded bytes.
+type BandwidthLimits struct {
+	Download, Upload *BandwidthLimiter
+}
+
+// InitialSyncBandwidth limits clients while the sync of all messages is
+// running, EventsBandwidth limits them the rest of the time.
+var (
+	InitialSyncBandwidth = BandwidthLimits{Download: &BandwidthLimiter{}, Upload: &BandwidthLimiter{}} //nolint[gochecknoglobals]
+	EventsBandwidth      = BandwidthLimits{Download: &BandwidthLimiter{}, Upload: &BandwidthLimiter{}} //nolint[gochecknoglobals]
+)
+
+// SetRate sets the limit in bytes per second. Zero or negative rate
+// removes the limit.
+func (l *BandwidthLimiter) SetRate(rate int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if rate < 0 {
+		rate = 0
+	}
+	l.rate = rate
+	l.tokens = rate
+	l.lastTime = time.Now()
+}
+
+// Rate returns the limit in bytes per second, zero when not limited.
+func (l *BandwidthLimiter) Rate() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.rate
+}
+
+// take consumes n bytes from the bucket which is refilled by rate every
+// second up to one second of transfer, and returns how long to wait
+// before the bytes can be transferred.
+func (l *BandwidthLimiter) take(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.rate == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	l.tokens += int64(now.Sub(l.lastTime).Seconds() * float64(l.rate))
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.lastTime = now
+
+	l.tokens -= int64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(float64(-l.tokens) / float64(l.rate) * float64(time.Second))
+}
+
+// limitReader returns reader which does not read faster than the limit.
+func (l *BandwidthLimiter) limitReader(r io.ReadCloser) io.ReadCloser {
+	return &limitedReader{ReadCloser: r, limiter: l}
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	limiter *BandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// Reading at most a second of transfer keeps the speed smooth.
+	if rate := r.limiter.Rate(); rate > 0 && int64(len(p)) > rate {
+		p = p[:rate]
+	}
+	n, err := r.ReadCloser.Read(p)
+	time.Sleep(r.limiter.take(n))
+	return n, err
+}
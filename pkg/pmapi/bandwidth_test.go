@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthLimiter_Unlimited(t *testing.T) {
+	l := &BandwidthLimiter{}
+	require.Equal(t, time.Duration(0), l.take(1<<30))
+}
+
+func TestBandwidthLimiter_LimitReader(t *testing.T) {
+	l := &BandwidthLimiter{}
+	l.SetRate(1000)
+
+	r := l.limitReader(ioutil.NopCloser(bytes.NewReader(make([]byte, 1500))))
+
+	start := time.Now()
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Len(t, data, 1500)
+	// First second of transfer is available at once, the rest waits.
+	require.True(t, time.Since(start) >= 400*time.Millisecond, "Waited time: %v", time.Since(start))
+}
+
+func TestClient_InitialSyncBandwidth(t *testing.T) {
+	c := newTestClient()
+	require.True(t, c.bandwidthLimits().Download == EventsBandwidth.Download)
+
+	c.SetInitialSync(true)
+	require.True(t, c.bandwidthLimits().Download == InitialSyncBandwidth.Download)
+
+	c.SetInitialSync(false)
+	require.True(t, c.bandwidthLimits().Download == EventsBandwidth.Download)
+}
@@ -31,6 +31,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
@@ -141,6 +142,14 @@ type Client struct {
 	user         *User
 	addresses    AddressList
 	kr           *pmcrypto.KeyRing
+
+	// rateLimitedUntil is the time until which all requests wait after
+	// the API rate limited one of them, so parallel requests do not keep
+	// hitting the limit.
+	rateLimitedUntil time.Time
+	rateLimitLock    sync.Mutex
+
+	isInitialSync int32 // Using integer to have it atomic.
 }
 
 // NewClient creates a new API client.
@@ -218,6 +227,44 @@ func (c *Client) Do(req *http.Request, retryUnauthorized bool) (res *http.Respon
 	return c.doBuffered(req, bodyBuffer, retryUnauthorized)
 }
 
+// setRateLimited makes all requests wait for the duration.
+func (c *Client) setRateLimited(wait time.Duration) {
+	c.rateLimitLock.Lock()
+	defer c.rateLimitLock.Unlock()
+
+	if until := time.Now().Add(wait); until.After(c.rateLimitedUntil) {
+		c.rateLimitedUntil = until
+	}
+}
+
+// waitForRateLimit blocks until the rate limit set by setRateLimited passes.
+func (c *Client) waitForRateLimit() {
+	c.rateLimitLock.Lock()
+	wait := time.Until(c.rateLimitedUntil)
+	c.rateLimitLock.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// SetInitialSync switches the client between InitialSyncBandwidth limits
+// used during the sync of all messages and EventsBandwidth limits.
+func (c *Client) SetInitialSync(isInitialSync bool) {
+	var value int32
+	if isInitialSync {
+		value = 1
+	}
+	atomic.StoreInt32(&c.isInitialSync, value)
+}
+
+func (c *Client) bandwidthLimits() BandwidthLimits {
+	if atomic.LoadInt32(&c.isInitialSync) == 1 {
+		return InitialSyncBandwidth
+	}
+	return EventsBandwidth
+}
+
 // If needed it retries using req and buffered body.
 func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthorized bool) (res *http.Response, err error) { // nolint[funlen]
 	isAuthReq := strings.Contains(req.URL.Path, "/auth")
@@ -233,6 +280,13 @@ func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		req.Header.Set("Authorization", "Bearer "+c.accessToken)
 	}
 
+	c.waitForRateLimit()
+
+	limits := c.bandwidthLimits()
+	if req.Body != nil {
+		req.Body = limits.Upload.limitReader(req.Body)
+	}
+
 	c.log.Debugln("Requesting ", req.Method, req.URL.RequestURI())
 	if logrus.GetLevel() == logrus.TraceLevel {
 		head := ""
@@ -291,12 +345,14 @@ func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		}
 
 		c.log.Warningf("Retrying %s after %ds induced by http code %d", req.URL.Path, retryAfter, res.StatusCode)
-		time.Sleep(time.Duration(retryAfter) * time.Second)
+		c.setRateLimited(time.Duration(retryAfter) * time.Second)
 		_, _ = io.Copy(ioutil.Discard, res.Body)
 		_ = res.Body.Close()
 		return c.doBuffered(req, bodyBuffer, false)
 	}
 
+	res.Body = limits.Download.limitReader(res.Body)
+
 	return res, err
 }
 
@@ -113,6 +113,21 @@ func TestClient_DoRetryAfter(t *testing.T) {
 	require.True(t, isInRange, "Waited time: %v", waitedTime)
 }
 
+func TestClient_RateLimitAllRequests(t *testing.T) {
+	c := newTestClient()
+
+	c.setRateLimited(500 * time.Millisecond)
+	c.setRateLimited(100 * time.Millisecond) // Shorter limit does not shorten the wait.
+
+	start := time.Now()
+	c.waitForRateLimit()
+	require.True(t, time.Since(start) >= 400*time.Millisecond, "Waited time: %v", time.Since(start))
+
+	start = time.Now()
+	c.waitForRateLimit()
+	require.True(t, time.Since(start) < 100*time.Millisecond, "Waited time: %v", time.Since(start))
+}
+
 type slowTransport struct {
 	transport      http.RoundTripper
 	firstBodySleep time.Duration
@@ -99,6 +99,10 @@ func (c *Client) GetPublicKeysForEmail(email string) (keys []PublicKey, internal
 		return
 	}
 
+	if err = res.Err(); err != nil {
+		return
+	}
+
 	internal = res.RecipientType == RecipientInternal
 
 	for _, key := range res.Keys {
@@ -80,6 +80,7 @@ const (
 type Label struct {
 	ID        string
 	Name      string
+	ParentID  string // Parent folder, empty for labels and top-level folders.
 	Color     string
 	Order     int `json:",omitempty"`
 	Display   int // Not used for now, leave it empty.
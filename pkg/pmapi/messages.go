@@ -720,6 +720,13 @@ func (c *Client) UndeleteMessages(ids []string) error {
 	return c.doMessagesAction("undelete", ids)
 }
 
+// MarkMessagesHam reports the given message IDs as not spam so the spam
+// filter learns from it. Messages are reported as spam by labeling them
+// with SpamLabel.
+func (c *Client) MarkMessagesHam(ids []string) error {
+	return c.doMessagesAction("mark/ham", ids)
+}
+
 type LabelMessagesReq struct {
 	LabelID string
 	IDs     []string
@@ -51,6 +51,7 @@ func (res Res) Err() error {
 
 	return &Error{
 		Code:         res.Code,
+		Status:       res.StatusCode,
 		ErrorMessage: res.ResError.Error,
 	}
 }
@@ -63,6 +64,8 @@ type ResError struct {
 type Error struct {
 	// The error code.
 	Code int
+	// The HTTP status code of the response, zero if not known.
+	Status int
 	// The error message.
 	ErrorMessage string `json:"Error"`
 }
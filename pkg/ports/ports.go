@@ -46,6 +46,28 @@ func isOccupied(port string) bool {
 	return false
 }
 
+// IsLocalHost checks if the bind address is reachable only from this machine.
+func IsLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ClientHost returns the host which clients on this machine use to connect
+// to the listener on the bind address. The unspecified address (listening
+// on all interfaces) is reachable through the localHost.
+func ClientHost(bindAddress, localHost string) string {
+	if bindAddress == "" {
+		return localHost
+	}
+	if ip := net.ParseIP(bindAddress); ip != nil && ip.IsUnspecified() {
+		return localHost
+	}
+	return bindAddress
+}
+
 // FindFreePortFrom finds first empty port, starting with `startPort`.
 func FindFreePortFrom(startPort int) int {
 	loopedOnce := false
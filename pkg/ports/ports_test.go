@@ -54,3 +54,20 @@ func TestFindFreePortFromNextOne(t *testing.T) {
 
 	_ = dummyserver.Close()
 }
+
+func TestIsLocalHost(t *testing.T) {
+	require.True(t, IsLocalHost("127.0.0.1"))
+	require.True(t, IsLocalHost("::1"))
+	require.True(t, IsLocalHost("localhost"))
+	require.False(t, IsLocalHost("0.0.0.0"))
+	require.False(t, IsLocalHost("192.168.1.2"))
+	require.False(t, IsLocalHost(""))
+}
+
+func TestClientHost(t *testing.T) {
+	require.Equal(t, "127.0.0.1", ClientHost("127.0.0.1", "127.0.0.1"))
+	require.Equal(t, "127.0.0.1", ClientHost("0.0.0.0", "127.0.0.1"))
+	require.Equal(t, "127.0.0.1", ClientHost("::", "127.0.0.1"))
+	require.Equal(t, "127.0.0.1", ClientHost("", "127.0.0.1"))
+	require.Equal(t, "192.168.1.2", ClientHost("192.168.1.2", "127.0.0.1"))
+}
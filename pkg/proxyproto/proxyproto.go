@@ -0,0 +1,313 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package proxyproto implements the receiving side of HAProxy PROXY protocol
+// version 1 and 2, so servers behind a TCP proxy see the real client address.
+// See https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// headerTimeout limits how long a connection can take to send the header.
+	headerTimeout = 10 * time.Second
+
+	// v1MaxLength is the longest allowed v1 header including CRLF.
+	v1MaxLength = 107
+
+	v2CommandLocal = 0x0
+	v2CommandProxy = 0x1
+	v2FamilyInet   = 0x1
+	v2FamilyInet6  = 0x2
+	v2ProtocolTCP  = 0x1
+)
+
+var (
+	log = logrus.WithField("pkg", "proxyproto") //nolint[gochecknoglobals]
+
+	v1Signature = []byte("PROXY ")                                                               //nolint[gochecknoglobals]
+	v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A} //nolint[gochecknoglobals]
+
+	// ErrNoHeader is returned when the connection does not start with a PROXY header.
+	ErrNoHeader = errors.New("missing PROXY protocol header") //nolint[gochecknoglobals]
+
+	errInvalidHeader = errors.New("invalid PROXY protocol header") //nolint[gochecknoglobals]
+)
+
+// Listener accepts only connections starting with a PROXY header. Headers are
+// read in separate goroutines so one slow connection does not block others.
+type Listener struct {
+	net.Listener
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+}
+
+// NewListener returns the listener reading PROXY headers of connections accepted by `l`.
+func NewListener(l net.Listener) *Listener {
+	return &Listener{
+		Listener: l,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept returns the next connection with successfully read PROXY header.
+func (l *Listener) Accept() (net.Conn, error) {
+	l.startOnce.Do(func() { go l.acceptLoop() })
+
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+// Close closes the underlying listener.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() { //nolint[staticcheck]
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			l.errs <- err
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+func (l *Listener) handshake(conn net.Conn) {
+	proxyConn, err := newConn(conn)
+	if err != nil {
+		log.WithError(err).WithField("remote", conn.RemoteAddr()).Warn("Closing connection without valid PROXY header")
+		_ = conn.Close()
+		return
+	}
+
+	select {
+	case l.conns <- proxyConn:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// Conn is the connection with addresses taken from the PROXY header.
+type Conn struct {
+	net.Conn
+
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func newConn(conn net.Conn) (*Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(headerTimeout)); err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	src, dst, err := ReadHeader(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	c.remoteAddr, c.localAddr = src, dst
+
+	log.WithField("proxy", conn.RemoteAddr()).WithField("client", c.RemoteAddr()).Debug("PROXY header received")
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read reads data after the PROXY header.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address sent by the proxy.
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to at the proxy.
+func (c *Conn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ReadHeader reads PROXY header of version 1 or 2 and returns source and
+// destination addresses. Both addresses are nil for connections which do not
+// carry client addresses, i.e. v1 UNKNOWN and v2 LOCAL (health checks).
+func ReadHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	signature, err := r.Peek(len(v1Signature))
+	if err != nil {
+		return nil, nil, ErrNoHeader
+	}
+	if bytes.Equal(signature, v1Signature) {
+		return readV1Header(r)
+	}
+
+	signature, err = r.Peek(len(v2Signature))
+	if err != nil || !bytes.Equal(signature, v2Signature) {
+		return nil, nil, ErrNoHeader
+	}
+	return readV2Header(r)
+}
+
+// readV1Header reads human-readable header, e.g.
+// `PROXY TCP4 192.0.2.1 192.0.2.2 56324 993\r\n`.
+func readV1Header(r *bufio.Reader) (src, dst net.Addr, err error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, errInvalidHeader
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errInvalidHeader
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, errInvalidHeader
+	}
+
+	srcAddr, err := parseV1Address(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dstAddr, err := parseV1Address(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return srcAddr, dstAddr, nil
+}
+
+func parseV1Address(protocol, ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil || (protocol == "TCP4") != (addr.IP.To4() != nil) {
+		return nil, errInvalidHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errInvalidHeader
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+// readV2Header reads binary header: signature, version and command,
+// address family and protocol, length and addresses followed by optional TLVs.
+func readV2Header(r *bufio.Reader) (src, dst net.Addr, err error) {
+	header := make([]byte, len(v2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, errInvalidHeader
+	}
+	versionCommand, familyProtocol := header[12], header[13]
+	length := binary.BigEndian.Uint16(header[14:])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, errInvalidHeader
+	}
+
+	if versionCommand>>4 != 2 {
+		return nil, nil, fmt.Errorf("unsupported PROXY protocol version %d", versionCommand>>4)
+	}
+	switch versionCommand & 0xF {
+	case v2CommandLocal:
+		return nil, nil, nil
+	case v2CommandProxy:
+	default:
+		return nil, nil, errInvalidHeader
+	}
+
+	// Only TCP over IPv4 or IPv6 carries an address we can use.
+	if familyProtocol&0xF != v2ProtocolTCP {
+		return nil, nil, nil
+	}
+
+	var ipLength int
+	switch familyProtocol >> 4 {
+	case v2FamilyInet:
+		ipLength = net.IPv4len
+	case v2FamilyInet6:
+		ipLength = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLength+4 {
+		return nil, nil, errInvalidHeader
+	}
+
+	srcAddr := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLength]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLength:])),
+	}
+	dstAddr := &net.TCPAddr{
+		IP:   net.IP(payload[ipLength : 2*ipLength]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLength+2:])),
+	}
+	return srcAddr, dstAddr, nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHeaderV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 192.0.2.2 56324 993\r\nA001 LOGIN"))
+	src, dst, err := ReadHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1:56324", src.String())
+	assert.Equal(t, "192.0.2.2:993", dst.String())
+
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "A001 LOGIN", string(rest))
+
+	src, dst, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 56324 993\r\n")))
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", src.String())
+	assert.Equal(t, "[2001:db8::2]:993", dst.String())
+
+	src, dst, err = ReadHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+	require.NoError(t, err)
+	assert.Nil(t, src)
+	assert.Nil(t, dst)
+}
+
+func TestReadHeaderV1Invalid(t *testing.T) {
+	for _, header := range []string{
+		"A001 LOGIN user pass\r\n",
+		"PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n",
+		"PROXY TCP4 2001:db8::1 192.0.2.2 56324 993\r\n",
+		"PROXY TCP4 192.0.2.1 192.0.2.2 56324 99999\r\n",
+		"PROXY UDP4 192.0.2.1 192.0.2.2 56324 993\r\n",
+		"PROXY TCP4 192.0.2.1 192.0.2.2 56324 993",
+		"PROXY " + strings.Repeat("x", v1MaxLength) + "\r\n",
+	} {
+		_, _, err := ReadHeader(bufio.NewReader(strings.NewReader(header)))
+		assert.Error(t, err, header)
+	}
+}
+
+func newV2Header(command, familyProtocol byte, payload []byte) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, familyProtocol, byte(len(payload)>>8), byte(len(payload)))
+	return append(header, payload...)
+}
+
+func TestReadHeaderV2(t *testing.T) {
+	payload := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xDC, 0x04, 0x03, 0xE1}
+	// TLV after addresses is skipped.
+	payload = append(payload, 0x01, 0x00, 0x02, 'h', '2')
+	r := bufio.NewReader(bytes.NewReader(append(newV2Header(v2CommandProxy, 0x11, payload), []byte("EHLO")...)))
+
+	src, dst, err := ReadHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1:56324", src.String())
+	assert.Equal(t, "192.0.2.2:993", dst.String())
+
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "EHLO", string(rest))
+
+	ipv6 := append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...)
+	ipv6 = append(ipv6, 0xDC, 0x04, 0x03, 0xE1)
+	src, _, err = ReadHeader(bufio.NewReader(bytes.NewReader(newV2Header(v2CommandProxy, 0x21, ipv6))))
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", src.String())
+
+	src, dst, err = ReadHeader(bufio.NewReader(bytes.NewReader(newV2Header(v2CommandLocal, 0x00, nil))))
+	require.NoError(t, err)
+	assert.Nil(t, src)
+	assert.Nil(t, dst)
+}
+
+func TestReadHeaderV2Invalid(t *testing.T) {
+	for name, header := range map[string][]byte{
+		"short addresses": newV2Header(v2CommandProxy, 0x11, []byte{192, 0, 2, 1}),
+		"unknown command": newV2Header(0x5, 0x11, make([]byte, 12)),
+		"short payload":   newV2Header(v2CommandProxy, 0x11, make([]byte, 12))[:20],
+		"bad version":     append(append([]byte{}, v2Signature...), 0x11, 0x11, 0, 0),
+	} {
+		_, _, err := ReadHeader(bufio.NewReader(bytes.NewReader(header)))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestListener(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := NewListener(tcpListener)
+	defer l.Close() //nolint[errcheck]
+
+	// Connection without header is closed and does not block the next one.
+	invalid, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer invalid.Close() //nolint[errcheck]
+	_, _ = invalid.Write([]byte("EHLO client\r\n"))
+
+	valid, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer valid.Close() //nolint[errcheck]
+	_, _ = valid.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 25\r\nEHLO client\r\n"))
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close() //nolint[errcheck]
+
+	assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "EHLO client\r\n", line)
+
+	_, err = invalid.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package wkd implements lookup of OpenPGP keys in Web Key Directory.
+// See https://datatracker.ietf.org/doc/draft-koch-openpgp-webkey-service/.
+package wkd
+
+import (
+	"crypto/sha1" //nolint[gosec]
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	lookupTimeout = 10 * time.Second
+
+	// maxKeySize limits the size of the downloaded key.
+	maxKeySize = 1024 * 1024
+
+	zBase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+)
+
+var (
+	// ErrNotFound is returned when there is no key for the address.
+	ErrNotFound = errors.New("key not found in WKD") //nolint[gochecknoglobals]
+
+	errInvalidAddress = errors.New("invalid email address") //nolint[gochecknoglobals]
+)
+
+// NewClient returns HTTP client with timeout suitable for lookups at send time.
+func NewClient() *http.Client {
+	return &http.Client{Timeout: lookupTimeout}
+}
+
+// GetURLs returns URLs of the key for `email` using the advanced
+// and the direct method, in the order they should be tried.
+func GetURLs(email string) (advanced, direct string, err error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", "", errInvalidAddress
+	}
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	hash := sha1.Sum([]byte(strings.ToLower(local))) //nolint[gosec]
+	hu := encodeZBase32(hash[:])
+	query := "?l=" + url.QueryEscape(local)
+
+	advanced = fmt.Sprintf("https://openpgpkey.%s/.well-known/openpgpkey/%s/hu/%s%s", domain, domain, hu, query)
+	direct = fmt.Sprintf("https://%s/.well-known/openpgpkey/hu/%s%s", domain, hu, query)
+	return advanced, direct, nil
+}
+
+// Lookup returns binary OpenPGP keys published for `email`. The advanced
+// method is tried first and the direct one only if it fails.
+func Lookup(client *http.Client, email string) ([]byte, error) {
+	advanced, direct, err := GetURLs(email)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := get(client, advanced)
+	if err == nil {
+		return key, nil
+	}
+
+	return get(client, direct)
+}
+
+func get(client *http.Client, keyURL string) ([]byte, error) {
+	res, err := client.Get(keyURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close() //nolint[errcheck]
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected WKD response status %v", res.Status)
+	}
+
+	key, err := ioutil.ReadAll(io.LimitReader(res.Body, maxKeySize))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+// encodeZBase32 encodes `data` using z-base-32 as required for WKD hashes.
+func encodeZBase32(data []byte) string {
+	var sb strings.Builder
+	var buffer, bits uint
+	for _, b := range data {
+		buffer = buffer<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			sb.WriteByte(zBase32Alphabet[(buffer>>bits)&31])
+		}
+	}
+	if bits > 0 {
+		sb.WriteByte(zBase32Alphabet[(buffer<<(5-bits))&31])
+	}
+	return sb.String()
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package wkd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetURLs(t *testing.T) {
+	// Example from the specification.
+	advanced, direct, err := GetURLs("Joe.Doe@Example.ORG")
+	require.NoError(t, err)
+	assert.Equal(t, "https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe", advanced)
+	assert.Equal(t, "https://example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe", direct)
+
+	for _, email := range []string{"", "joe", "@example.org", "joe@"} {
+		_, _, err := GetURLs(email)
+		assert.Error(t, err, email)
+	}
+}
+
+type rewriteTransport struct {
+	target string
+	paths  []string
+}
+
+func (rt *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.paths = append(rt.paths, req.URL.Host+req.URL.Path)
+	req.URL.Scheme = "http"
+	req.URL.Host = rt.target
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestLookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q" {
+			_, _ = w.Write([]byte("key"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	transport := &rewriteTransport{target: server.Listener.Addr().String()}
+	client := &http.Client{Transport: transport}
+
+	key, err := Lookup(client, "joe.doe@example.org")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key"), key)
+	assert.Equal(t, []string{
+		"openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q",
+		"example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q",
+	}, transport.paths)
+
+	_, err = Lookup(client, "jane@example.org")
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -28,6 +28,8 @@ import (
 
 func APIChecksFeatureContext(s *godog.Suite) {
 	s.Step(`^API endpoint "([^"]*)" is called with:$`, apiIsCalledWith)
+	s.Step(`^API endpoint "([^"]*)" is called$`, apiIsCalled)
+	s.Step(`^API endpoint "([^"]*)" is not called$`, apiIsNotCalled)
 	s.Step(`^message is sent with API call:$`, messageIsSentWithAPICall)
 }
 
@@ -42,6 +44,22 @@ func apiIsCalledWith(endpoint string, data *gherkin.DocString) error {
 	return nil
 }
 
+func apiIsCalled(endpoint string) error {
+	split := strings.Split(endpoint, " ")
+	if len(ctx.GetPMAPIController().GetCalls(split[0], split[1])) == 0 {
+		return fmt.Errorf("%s was not called", endpoint)
+	}
+	return nil
+}
+
+func apiIsNotCalled(endpoint string) error {
+	split := strings.Split(endpoint, " ")
+	if calls := ctx.GetPMAPIController().GetCalls(split[0], split[1]); len(calls) != 0 {
+		return fmt.Errorf("%s was called %d times", endpoint, len(calls))
+	}
+	return nil
+}
+
 func messageIsSentWithAPICall(data *gherkin.DocString) error {
 	endpoint := "POST /messages"
 	if err := apiIsCalledWith(endpoint, data); err != nil {
@@ -21,6 +21,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	"github.com/cucumber/godog"
 	a "github.com/stretchr/testify/assert"
 )
@@ -33,6 +34,9 @@ func BridgeSetupFeatureContext(s *godog.Suite) {
 	s.Step(`^there is database file for "([^"]*)"$`, thereIsDatabaseFileForUser)
 	s.Step(`^there is no database file for "([^"]*)"$`, thereIsNoDatabaseFileForUser)
 	s.Step(`^there is "([^"]*)" in "([^"]*)" address mode$`, thereIsUserWithAddressMode)
+	s.Step(`^there is "([^"]*)" with hidden mailbox "([^"]*)"$`, thereIsUserWithHiddenMailbox)
+	s.Step(`^there is "([^"]*)" with delete action "([^"]*)" in mailbox "([^"]*)"$`, thereIsUserWithDeleteActionInMailbox)
+	s.Step(`^there is "([^"]*)" with saved search "([^"]*)" of messages with subject "([^"]*)"$`, thereIsUserWithSavedSearchOfSubject)
 }
 
 func thereIsNoInternetConnection() error {
@@ -137,3 +141,52 @@ func thereIsUserWithAddressMode(bddUserID, wantAddressMode string) error {
 	ctx.EventuallySyncIsFinishedForUsername(bridgeUser.Username())
 	return nil
 }
+
+func thereIsUserWithHiddenMailbox(bddUserID, mailboxName string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	bridgeUser, err := ctx.GetUser(account.Username())
+	if err != nil {
+		return internalError(err, "getting user %s", account.Username())
+	}
+	mailbox, err := ctx.GetStoreMailbox(account.Username(), account.AddressID(), mailboxName)
+	if err != nil {
+		return internalError(err, "getting mailbox %s", mailboxName)
+	}
+	if err := bridgeUser.SetMailboxHidden(mailbox.LabelID(), true); err != nil {
+		return internalError(err, "hiding mailbox %s", mailboxName)
+	}
+	return nil
+}
+
+func thereIsUserWithDeleteActionInMailbox(bddUserID, action, mailboxName string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	bridgeUser, err := ctx.GetUser(account.Username())
+	if err != nil {
+		return internalError(err, "getting user %s", account.Username())
+	}
+	if err := bridgeUser.SetDeleteAction(mailboxName, store.DeleteAction(action)); err != nil {
+		return internalError(err, "setting delete action of %s", mailboxName)
+	}
+	return nil
+}
+
+func thereIsUserWithSavedSearchOfSubject(bddUserID, name, subject string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	bridgeUser, err := ctx.GetUser(account.Username())
+	if err != nil {
+		return internalError(err, "getting user %s", account.Username())
+	}
+	if err := bridgeUser.AddSavedSearch(name, "", subject, ""); err != nil {
+		return internalError(err, "adding saved search %s", name)
+	}
+	return nil
+}
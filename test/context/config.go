@@ -59,6 +59,9 @@ func (c *fakeConfig) GetAPIConfig() *pmapi.ClientConfig {
 func (c *fakeConfig) GetDBDir() string {
 	return c.dir
 }
+func (c *fakeConfig) GetUIDsDir() string {
+	return c.dir
+}
 func (c *fakeConfig) GetLogDir() string {
 	return c.dir
 }
@@ -80,6 +83,18 @@ func (c *fakeConfig) GetEventsPath() string {
 func (c *fakeConfig) GetIMAPCachePath() string {
 	return filepath.Join(c.dir, "user_info.json")
 }
+func (c *fakeConfig) GetIMAPKeywordsPath() string {
+	return filepath.Join(os.Getenv("TEST_DATA"), "imap_keywords.json")
+}
+func (c *fakeConfig) GetSendRecorderPath() string {
+	return filepath.Join(c.dir, "send_recorder.json")
+}
+func (c *fakeConfig) GetOutboxPath() string {
+	return filepath.Join(c.dir, "outbox")
+}
+func (c *fakeConfig) GetSendJournalPath() string {
+	return filepath.Join(c.dir, "send_journal.json")
+}
 func (c *fakeConfig) GetDefaultAPIPort() int {
 	return 21042
 }
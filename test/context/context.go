@@ -57,6 +57,10 @@ type TestContext struct {
 	smtpClients       map[string]*mocks.SMTPClient
 	smtpLastResponses map[string]*mocks.SMTPResponse
 
+	// LMTP related variables (clients share maps with SMTP ones).
+	lmtpAddr   string
+	lmtpServer server
+
 	// These are the cleanup steps executed when Cleanup() is called.
 	cleanupSteps []*Cleaner
 
@@ -19,6 +19,7 @@ package context
 
 import (
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
@@ -59,8 +60,8 @@ func (ctx *TestContext) withSMTPServer() {
 	port := pref.GetInt(preferences.SMTPPortKey)
 	useSSL := pref.GetBool(preferences.SMTPSSLKey)
 
-	backend := smtp.NewSMTPBackend(ph, ctx.listener, pref, ctx.bridge)
-	server := smtp.NewSMTPServer(true, port, useSSL, tls, backend, ctx.listener)
+	backend := smtp.NewSMTPBackend(ph, ctx.listener, ctx.cfg, pref, ctx.bridge)
+	server := smtp.NewSMTPServer(true, bridge.Host, port, useSSL, false, false, tls, backend, ctx.listener)
 
 	go server.ListenAndServe()
 	require.NoError(ctx.t, waitForPort(port, 5*time.Second))
@@ -70,6 +71,45 @@ func (ctx *TestContext) withSMTPServer() {
 	ctx.addCleanup(ctx.smtpServer.Close, "Closing SMTP server")
 }
 
+// GetLMTPClient gets the lmtp client by name; if it doesn't exist yet it creates it.
+func (ctx *TestContext) GetLMTPClient(handle string) *mocks.SMTPClient {
+	if client, ok := ctx.smtpClients[handle]; ok {
+		return client
+	}
+	return ctx.newLMTPClient(handle)
+}
+
+func (ctx *TestContext) newLMTPClient(handle string) *mocks.SMTPClient {
+	ctx.withLMTPServer()
+
+	client := mocks.NewSMTPClient(ctx.t, handle, ctx.lmtpAddr)
+	ctx.smtpClients[handle] = client
+	ctx.addCleanup(client.Close, "Closing LMTP client")
+	return client
+}
+
+// withLMTPServer enables the lmtp server and connects it to the bridge instance.
+func (ctx *TestContext) withLMTPServer() {
+	if ctx.lmtpServer != nil {
+		return
+	}
+
+	ph := newPanicHandler(ctx.t)
+	pref := preferences.New(ctx.cfg)
+	port := 21300 + rand.Intn(100)
+	pref.SetInt(preferences.LMTPPortKey, port)
+
+	backend := smtp.NewSMTPBackend(ph, ctx.listener, ctx.cfg, pref, ctx.bridge)
+	server := smtp.NewLMTPServer(true, port, backend, ctx.listener)
+
+	go server.ListenAndServe()
+	require.NoError(ctx.t, waitForPort(port, 5*time.Second))
+
+	ctx.lmtpServer = server
+	ctx.lmtpAddr = fmt.Sprintf("%v:%v", bridge.Host, port)
+	ctx.addCleanup(ctx.lmtpServer.Close, "Closing LMTP server")
+}
+
 // SetSMTPLastResponse sets the last SMTP response that was received.
 func (ctx *TestContext) SetSMTPLastResponse(handle string, resp *mocks.SMTPResponse) {
 	ctx.smtpLastResponses[handle] = resp
@@ -44,7 +44,7 @@ func (api *FakePMAPI) CreateLabel(label *pmapi.Label) (*pmapi.Label, error) {
 		return nil, err
 	}
 	for _, existingLabel := range api.labels {
-		if existingLabel.Name == label.Name {
+		if existingLabel.Name == label.Name && existingLabel.ParentID == label.ParentID {
 			return nil, fmt.Errorf("folder or label %s already exists", label.Name)
 		}
 	}
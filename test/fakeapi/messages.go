@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"fmt"
 	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -41,11 +42,12 @@ func (api *FakePMAPI) GetMessage(apiID string) (*pmapi.Message, error) {
 	return nil, fmt.Errorf("message %s not found", apiID)
 }
 
+// SetInitialSync does nothing, fake API does not limit bandwidth.
+func (api *FakePMAPI) SetInitialSync(isInitialSync bool) {}
+
 // ListMessages does not implement following filters:
 //  * Sort (it sorts by ID only), but Desc works
 //  * Keyword
-//  * To
-//  * Subject
 //  * ID
 //  * Attachments
 //  * AutoWildcard
@@ -118,7 +120,13 @@ func isMessageMatchingFilter(filter *pmapi.MessagesFilter, message *pmapi.Messag
 	if filter.AddressID != "" && filter.AddressID != message.AddressID {
 		return false
 	}
-	if filter.From != "" && filter.From != message.Sender.Address {
+	if filter.From != "" && !isAddressMatching(filter.From, message.Sender) {
+		return false
+	}
+	if filter.To != "" && !isAddressMatching(filter.To, message.ToList...) {
+		return false
+	}
+	if filter.Subject != "" && !containsFold(message.Subject, filter.Subject) {
 		return false
 	}
 	if filter.LabelID != "" && !hasItem(message.LabelIDs, filter.LabelID) {
@@ -142,6 +150,19 @@ func isMessageMatchingFilter(filter *pmapi.MessagesFilter, message *pmapi.Messag
 	return true
 }
 
+func isAddressMatching(query string, addresses ...*mail.Address) bool {
+	for _, address := range addresses {
+		if address != nil && (containsFold(address.Address, query) || containsFold(address.Name, query)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
 func copyFilteredMessage(message *pmapi.Message) *pmapi.Message {
 	filteredMessage := &pmapi.Message{}
 	*filteredMessage = *message
@@ -183,6 +204,7 @@ func (api *FakePMAPI) SendMessage(messageID string, sendMessageRequest *pmapi.Se
 		return nil, nil, errors.Wrap(err, "draft does not exist")
 	}
 	message.Time = time.Now().Unix()
+	message.Type = pmapi.MessageTypeSent
 	message.LabelIDs = append(message.LabelIDs, pmapi.SentLabel)
 	api.addEventMessage(pmapi.EventUpdate, message)
 	return message, nil, nil
@@ -349,6 +371,14 @@ func (api *FakePMAPI) MarkMessagesUnread(apiIDs []string) error {
 	return nil
 }
 
+func (api *FakePMAPI) MarkMessagesHam(apiIDs []string) error {
+	return api.updateMessages(PUT, "/messages/mark/ham", &pmapi.MessagesActionReq{
+		IDs: apiIDs,
+	}, apiIDs, func(message *pmapi.Message) error {
+		return errWasNotUpdated
+	})
+}
+
 func (api *FakePMAPI) updateMessages(method method, path string, request interface{}, apiIDs []string, updateCallback func(*pmapi.Message) error) error { //nolint[unparam]
 	if err := api.checkAndRecordCall(method, path, request); err != nil {
 		return err
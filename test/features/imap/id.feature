@@ -0,0 +1,33 @@
+Feature: IMAP ID with client workarounds
+  Background:
+    Given there is connected user "user"
+
+  Scenario: ID returns server identification
+    Given there is IMAP client logged in as "user"
+    When IMAP client sends ID with name "Thunderbird"
+    Then IMAP response contains "ID \(.*ProtonMail.*\)"
+
+  Scenario: Outlook names of special folders after authentication
+    Given there is IMAP client logged in as "user"
+    When IMAP client sends ID with name "Microsoft Outlook"
+    Then IMAP response is "OK"
+    When IMAP client selects "Sent Items"
+    Then IMAP response is "OK"
+    When IMAP client creates mailbox "Deleted Items"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Deleted Items"
+
+  Scenario: Outlook names of special folders before authentication
+    When IMAP client sends ID with name "Microsoft Outlook"
+    And IMAP response is "OK"
+    And IMAP client authenticates "user"
+    Then IMAP response is "OK"
+    When IMAP client selects "Junk Email"
+    Then IMAP response is "OK"
+
+  Scenario: Other clients do not have Outlook names of special folders
+    Given there is IMAP client logged in as "user"
+    When IMAP client sends ID with name "Thunderbird"
+    Then IMAP response is "OK"
+    When IMAP client selects "Sent Items"
+    Then IMAP response is "IMAP error: NO mailbox Sent Items does not exist"
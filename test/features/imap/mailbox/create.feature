@@ -9,6 +9,21 @@ Feature: IMAP create mailbox
     And "user" has mailbox "Folders/mbox"
     And "user" does not have mailbox "Labels/mbox"
 
+  Scenario: Create nested folder
+    When IMAP client creates mailbox "Folders/parent/mbox"
+    Then IMAP response is "OK"
+    And "user" has mailbox "Folders/parent"
+    And "user" has mailbox "Folders/parent/mbox"
+    And "user" does not have mailbox "Folders/mbox"
+
+  Scenario: Create folders with the same name in different parents
+    When IMAP client creates mailbox "Folders/one/mbox"
+    Then IMAP response is "OK"
+    When IMAP client creates mailbox "Folders/two/mbox"
+    Then IMAP response is "OK"
+    And "user" has mailbox "Folders/one/mbox"
+    And "user" has mailbox "Folders/two/mbox"
+
   Scenario: Create label
     When IMAP client creates mailbox "Labels/mbox"
     Then IMAP response is "OK"
@@ -0,0 +1,16 @@
+Feature: IMAP hidden mailboxes
+  Background:
+    Given there is connected user "user"
+    And there is "user" with hidden mailbox "All Mail"
+    And there is IMAP client logged in as "user"
+
+  Scenario: List mailboxes without hidden mailbox
+    When IMAP client lists mailboxes
+    Then IMAP response contains "INBOX"
+    And IMAP response contains "Spam"
+    And IMAP response contains "Trash"
+    And IMAP response does not contain "All Mail"
+
+  Scenario: Select hidden mailbox
+    When IMAP client selects "All Mail"
+    Then IMAP response is "OK"
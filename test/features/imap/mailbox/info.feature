@@ -13,3 +13,13 @@ Feature: IMAP get mailbox info
     And IMAP response contains "UNSEEN 1"
     And IMAP response contains "UIDNEXT 3"
     And IMAP response contains "UIDVALIDITY"
+
+  Scenario: Examined mailbox is read-only
+    When IMAP client gets info of "INBOX"
+    Then IMAP response is "OK"
+    When IMAP client marks message "1" as read
+    Then IMAP response is "IMAP error: NO Mailbox opened in read-only mode"
+    And mailbox "INBOX" for "user" has messages
+      | from              | subject | read  |
+      | john.doe@mail.com | foo     | false |
+      | jane.doe@mail.com | bar     | true  |
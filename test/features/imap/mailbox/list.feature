@@ -14,3 +14,45 @@ Feature: IMAP list mailboxes
     Then IMAP response contains "All Mail"
     Then IMAP response contains "Folders/mbox1"
     Then IMAP response contains "Labels/mbox2"
+
+  Scenario: List mailboxes with special-use attributes
+    When IMAP client lists mailboxes
+    Then IMAP response contains "LIST \(.*\\Sent.*\) ./. .Sent."
+    Then IMAP response contains "LIST \(.*\\Drafts.*\) ./. .Drafts."
+    Then IMAP response contains "LIST \(.*\\Trash.*\) ./. .Trash."
+    Then IMAP response contains "LIST \(.*\\Junk.*\) ./. .Spam."
+    Then IMAP response contains "LIST \(.*\\Archive.*\) ./. .Archive."
+
+  Scenario: List mailboxes with XLIST
+    When IMAP client lists mailboxes with XLIST
+    Then IMAP response contains "XLIST \(.*\\Inbox.*\) ./. .INBOX."
+    Then IMAP response contains "XLIST \(.*\\Spam.*\) ./. .Spam."
+    Then IMAP response contains "XLIST \(.*\\AllMail.*\) ./. .All Mail."
+    Then IMAP response contains "XLIST \(.*\) ./. .Folders/mbox1."
+
+  Scenario: List mailboxes with status
+    Given there are messages in mailbox "Folders/mbox1" for "user"
+      | from              | to         | subject | body  | read  |
+      | john.doe@mail.com | user@pm.me | foo     | hello | false |
+      | jane.doe@mail.com | name@pm.me | bar     | world | true  |
+    When IMAP client lists mailboxes returning "STATUS (MESSAGES UNSEEN)"
+    Then IMAP response contains "LIST \(.*\) ./. .Folders/mbox1."
+    And IMAP response contains "STATUS Folders/mbox1 \((MESSAGES 2 UNSEEN 1|UNSEEN 1 MESSAGES 2)\)"
+    And IMAP response contains "STATUS INBOX \((MESSAGES 0 UNSEEN 0|UNSEEN 0 MESSAGES 0)\)"
+
+  Scenario: List mailboxes with children
+    When IMAP client lists mailboxes returning "CHILDREN"
+    Then IMAP response contains "LIST \(\\Noselect \\HasChildren\) ./. .Folders."
+    And IMAP response contains "LIST \(\\HasNoChildren\) ./. .Folders/mbox1."
+    And IMAP response contains "LIST \(\\Noinferiors\) ./. .INBOX."
+
+  Scenario: List nested folders
+    When IMAP client creates mailbox "Folders/mbox1/child"
+    Then IMAP response is "OK"
+    When IMAP client lists mailboxes returning "CHILDREN"
+    Then IMAP response contains "LIST \(\\HasChildren\) ./. .Folders/mbox1."
+    And IMAP response contains "LIST \(\\HasNoChildren\) ./. .Folders/mbox1/child."
+
+  Scenario: List subscribed special-use mailboxes
+    When IMAP client lists mailboxes selecting "SUBSCRIBED SPECIAL-USE" returning ""
+    Then IMAP response contains "LIST \(.*\\Sent.*\\Subscribed\) ./. .Sent."
@@ -0,0 +1,19 @@
+Feature: IMAP get quota
+  Background:
+    Given there is connected user "user"
+    And there is IMAP client logged in as "user"
+
+  Scenario: Get quota root of mailbox
+    When IMAP client gets quota root of "INBOX"
+    Then IMAP response is "OK"
+    And IMAP response contains "QUOTAROOT .INBOX. .."
+    And IMAP response contains "QUOTA .. \(STORAGE \d+ \d+\)"
+
+  Scenario: Get quota
+    When IMAP client gets quota ""
+    Then IMAP response is "OK"
+    And IMAP response contains "QUOTA .. \(STORAGE \d+ \d+\)"
+
+  Scenario: Get unknown quota
+    When IMAP client gets quota "other"
+    Then IMAP response is "IMAP error: NO no such quota root"
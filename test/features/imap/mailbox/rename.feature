@@ -10,6 +10,45 @@ Feature: IMAP mailbox rename
     And "user" does not have mailbox "Folders/mbox"
     And "user" has mailbox "Folders/mbox2"
 
+  Scenario: Rename folder with subfolders
+    Given there is "user" with mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client creates mailbox "Folders/mbox/child"
+    Then IMAP response is "OK"
+    When IMAP client renames mailbox "Folders/mbox" to "Folders/mbox2"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Folders/mbox/child"
+    And "user" has mailbox "Folders/mbox2"
+    And "user" has mailbox "Folders/mbox2/child"
+
+  Scenario: Move folder to other folder
+    Given there is "user" with mailbox "Folders/mbox"
+    And there is "user" with mailbox "Folders/other"
+    And there is IMAP client logged in as "user"
+    When IMAP client creates mailbox "Folders/mbox/child"
+    Then IMAP response is "OK"
+    When IMAP client renames mailbox "Folders/mbox" to "Folders/other/mbox"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Folders/mbox"
+    And "user" has mailbox "Folders/other/mbox"
+    And "user" has mailbox "Folders/other/mbox/child"
+
+  Scenario: Move subfolder to top level
+    Given there is "user" with mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client creates mailbox "Folders/mbox/child"
+    Then IMAP response is "OK"
+    When IMAP client renames mailbox "Folders/mbox/child" to "Folders/child"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Folders/mbox/child"
+    And "user" has mailbox "Folders/child"
+
+  Scenario: Moving folder to its subfolder is not possible
+    Given there is "user" with mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client renames mailbox "Folders/mbox" to "Folders/mbox/child"
+    Then IMAP response is "IMAP error: NO cannot move folder to its subfolder"
+
   Scenario: Rename label
     Given there is "user" with mailbox "Labels/mbox"
     And there is IMAP client logged in as "user"
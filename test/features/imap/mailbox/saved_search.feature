@@ -0,0 +1,32 @@
+Feature: IMAP saved search mailboxes
+  Background:
+    Given there is connected user "user"
+    And there are messages in mailbox "INBOX" for "user"
+      | from              | to         | subject   | body  | read  | starred |
+      | john.doe@mail.com | user@pm.me | Invoice 1 | hello | false | false   |
+      | jane.doe@mail.com | name@pm.me | bar       | world | true  | true    |
+    And there are messages in mailbox "Archive" for "user"
+      | from              | to         | subject   | body  | read  | starred |
+      | john.doe@mail.com | user@pm.me | invoice 2 | hello | true  | false   |
+    And there is "user" with saved search "Invoices" of messages with subject "invoice"
+    And there is IMAP client logged in as "user"
+
+  Scenario: List saved search mailboxes
+    When IMAP client lists mailboxes
+    Then IMAP response contains "Searches/Invoices"
+    And IMAP response contains "LIST \(\\Noselect.*\) ./. .Searches."
+
+  Scenario: Saved search mailbox is read-only
+    When IMAP client selects "Searches/Invoices"
+    Then IMAP response contains "2 EXISTS"
+    When IMAP client marks message "1" as read
+    Then IMAP response is "IMAP error: NO Mailbox opened in read-only mode"
+
+  Scenario: Copy message to saved search mailbox is not possible
+    Given there is IMAP client selected in "INBOX"
+    When IMAP client copies messages "2" to "Searches/Invoices"
+    Then IMAP response is "IMAP error: NO \[CANNOT\] Messages cannot be added to or removed from virtual mailbox"
+
+  Scenario: Delete saved search mailbox is not possible
+    When IMAP client deletes mailbox "Searches/Invoices"
+    Then IMAP response is "IMAP error: NO saved searches are removed in settings"
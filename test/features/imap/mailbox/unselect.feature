@@ -0,0 +1,17 @@
+Feature: IMAP unselect mailbox
+  Background:
+    Given there is connected user "user"
+    And there are 2 messages in mailbox "INBOX" for "user"
+    And there is IMAP client logged in as "user"
+
+  Scenario: Unselect selected mailbox
+    Given there is IMAP client selected in "INBOX"
+    When IMAP client unselects
+    Then IMAP response is "OK"
+    And mailbox "INBOX" for "user" has 2 messages
+    When IMAP client fetches "1:*"
+    Then IMAP response is "IMAP error: NO No mailbox selected"
+
+  Scenario: Unselect without selected mailbox
+    When IMAP client unselects
+    Then IMAP response is "IMAP error: NO No mailbox selected"
@@ -0,0 +1,37 @@
+Feature: IMAP virtual Unread and Starred mailboxes
+  Background:
+    Given there is connected user "user"
+    And there are messages in mailbox "INBOX" for "user"
+      | from              | to         | subject | body  | read  | starred |
+      | john.doe@mail.com | user@pm.me | foo     | hello | false | false   |
+      | jane.doe@mail.com | name@pm.me | bar     | world | true  | true    |
+      | jane.doe@mail.com | name@pm.me | baz     | world | false | true    |
+
+  Scenario: List virtual mailboxes
+    Given there is IMAP client logged in as "user"
+    When IMAP client lists mailboxes
+    Then IMAP response contains "Unread"
+    And IMAP response contains "\\Flagged.*Starred"
+
+  Scenario: Select Unread
+    Given there is IMAP client logged in as "user"
+    When IMAP client selects "Unread"
+    Then IMAP response contains "2 EXISTS"
+
+  Scenario: Select Starred
+    Given there is IMAP client logged in as "user"
+    When IMAP client selects "Starred"
+    Then IMAP response contains "2 EXISTS"
+
+  Scenario: Copy message to Starred is not possible
+    Given there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+    When IMAP client copies messages "1" to "Starred"
+    Then IMAP response is "IMAP error: NO \[CANNOT\] Messages cannot be added to or removed from virtual mailbox"
+
+  Scenario: Hide virtual mailbox
+    Given there is "user" with hidden mailbox "Unread"
+    And there is IMAP client logged in as "user"
+    When IMAP client lists mailboxes
+    Then IMAP response contains "Starred"
+    And IMAP response does not contain "Unread"
@@ -0,0 +1,35 @@
+Feature: IMAP answered and forwarded flags
+  Background:
+    Given there is connected user "user"
+    And there are messages in mailbox "INBOX" for "user"
+      | from              | to         | subject | body  |
+      | john.doe@mail.com | user@pm.me | foo     | hello |
+      | jane.doe@mail.com | name@pm.me | bar     | world |
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+
+  Scenario: Answered and forwarded are permanent flags
+    When IMAP client selects "INBOX"
+    Then IMAP response contains "PERMANENTFLAGS \(.*\\Answered.*\$forwarded.*\)"
+
+  Scenario: Mark message as answered
+    When IMAP client adds flags "\Answered" to message "1"
+    Then IMAP response is "OK"
+    When IMAP client fetches flags of "1"
+    Then IMAP response contains "FLAGS \(.*\\Answered.*\)"
+    When IMAP client searches for "ANSWERED"
+    Then IMAP response contains "SEARCH 1\s*$"
+
+  Scenario: Mark message as forwarded
+    When IMAP client adds flags "$Forwarded" to message "2"
+    Then IMAP response is "OK"
+    When IMAP client fetches flags of "2"
+    Then IMAP response contains "FLAGS \(.*\$forwarded.*\)"
+
+  Scenario: Unmark message as answered
+    Given IMAP client adds flags "\Answered" to message "1:*"
+    And IMAP response is "OK"
+    When IMAP client removes flags "\Answered" from message "2"
+    Then IMAP response is "OK"
+    When IMAP client searches for "UNANSWERED"
+    Then IMAP response contains "SEARCH 2\s*$"
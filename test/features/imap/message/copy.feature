@@ -13,6 +13,7 @@ Feature: IMAP copy messages
   Scenario: Copy message to label
     When IMAP client copies messages "2" to "Labels/label"
     Then IMAP response is "OK"
+    And IMAP response result contains "OK \[COPYUID \d+ 2 1\] COPY successful"
     And mailbox "INBOX" for "user" has 2 messages
     And mailbox "Labels/label" for "user" has messages
       | from              | to         | subject |
@@ -7,6 +7,7 @@ Feature: IMAP create messages
     Given there is IMAP client selected in "INBOX"
     When IMAP client creates message "foo" from "john.doe@email.com" to address "primary" of "userMoreAddresses" with body "hello world" in "INBOX"
     Then IMAP response is "OK"
+    And IMAP response result contains "OK \[APPENDUID \d+ \d+\] APPEND successful"
     And mailbox "INBOX" for "userMoreAddresses" has messages
       | from               | to        | subject | read |
       | john.doe@email.com | [primary] | foo     | true |
@@ -14,6 +15,7 @@ Feature: IMAP create messages
   Scenario: Creates draft
     When IMAP client creates message "foo" from address "primary" of "userMoreAddresses" to "john.doe@email.com" with body "hello world" in "Drafts"
     Then IMAP response is "OK"
+    And IMAP response result contains "OK \[APPENDUID \d+ \d+\] APPEND successful"
     And mailbox "Drafts" for "userMoreAddresses" has messages
       | from      | to                 | subject | read |
       | [primary] | john.doe@email.com | foo     | true |
@@ -57,3 +59,31 @@ Feature: IMAP create messages
       | from              | to                    | subject | read |
       | notuser@gmail.com | alsonotuser@gmail.com | foo     | true |
     And mailbox "INBOX" for "userMoreAddresses" has no messages
+
+  Scenario: Creates message by CATENATE
+    Given there is IMAP client selected in "INBOX"
+    When IMAP client creates message "foo" from "john.doe@email.com" to "userMoreAddresses@pm.me" with body "hello world" catenated in "INBOX"
+    Then IMAP response is "OK"
+    And IMAP response result contains "OK \[APPENDUID \d+ \d+\] APPEND successful"
+    And mailbox "INBOX" for "userMoreAddresses" has messages
+      | from               | subject | read |
+      | john.doe@email.com | foo     | false |
+
+  Scenario: Creates message by CATENATE with URL of missing message
+    Given there is IMAP client selected in "INBOX"
+    When IMAP client creates message "foo" from "john.doe@email.com" to "userMoreAddresses@pm.me" with URL "/INBOX/;UID=42/;SECTION=1" and body "hello world" catenated in "INBOX"
+    Then IMAP response is "NO \[BADURL /INBOX/;UID=42/;SECTION=1\]"
+
+  Scenario: Copy of sent message is merged with the message sent through API
+    Given there are messages in mailbox "Sent" for "userMoreAddresses"
+      | from      | to                 | subject | body        |
+      | [primary] | john.doe@email.com | foo     | hello world |
+    And there is IMAP client selected in "Sent"
+    When IMAP client creates message "foo" from address "primary" of "userMoreAddresses" to "john.doe@email.com" with body "hello world" in "Sent"
+    Then IMAP response is "OK"
+    And IMAP response result contains "OK \[APPENDUID \d+ 1\] APPEND successful"
+    And mailbox "Sent" for "userMoreAddresses" has 1 message
+
+  Scenario: Creates message in All Mail is not possible
+    When IMAP client creates message "foo" from "john.doe@email.com" to address "primary" of "userMoreAddresses" with body "hello world" in "All Mail"
+    Then IMAP response is "IMAP error: NO \[CANNOT\] Messages cannot be added to or removed from virtual mailbox"
@@ -12,6 +12,8 @@ Feature: IMAP delete messages
     And there is IMAP client selected in "<mailbox>"
     When IMAP client deletes messages "1"
     Then IMAP response is "OK"
+    When IMAP client expunges
+    Then IMAP response is "OK"
     And mailbox "<mailbox>" for "user" has 9 messages
 
     Examples:
@@ -30,6 +32,8 @@ Feature: IMAP delete messages
     And there is IMAP client selected in "<mailbox>"
     When IMAP client deletes messages "1:*"
     Then IMAP response is "OK"
+    When IMAP client expunges
+    Then IMAP response is "OK"
     And mailbox "<mailbox>" for "user" has 0 messages
 
     Examples:
@@ -39,3 +43,81 @@ Feature: IMAP delete messages
       | Labels/label |
       | Drafts       |
       | Trash        |
+
+  @ignore-live
+  Scenario Outline: Delete message with delete action moving it
+    Given there are 10 messages in mailbox "Folders/mbox" for "user"
+    And there is "user" with delete action "<action>" in mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "Folders/mbox"
+    When IMAP client deletes messages "1"
+    Then IMAP response is "OK"
+    When IMAP client expunges
+    Then IMAP response is "OK"
+    And mailbox "Folders/mbox" for "user" has 9 messages
+    And mailbox "<target>" for "user" has 1 messages
+
+    Examples:
+      | action  | target  |
+      | trash   | Trash   |
+      | archive | Archive |
+
+  @ignore-live
+  Scenario: Delete message permanently with delete action
+    Given there are 10 messages in mailbox "Folders/mbox" for "user"
+    And there is "user" with delete action "delete" in mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "Folders/mbox"
+    When IMAP client deletes messages "1"
+    Then IMAP response is "OK"
+    When IMAP client expunges
+    Then IMAP response is "OK"
+    And mailbox "Folders/mbox" for "user" has 9 messages
+    And mailbox "Trash" for "user" has 0 messages
+
+  Scenario: Deleted message is removed by expunge
+    Given there are 10 messages in mailbox "INBOX" for "user"
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+    When IMAP client deletes messages "1"
+    Then IMAP response is "OK"
+    And mailbox "INBOX" for "user" has 10 messages
+    When IMAP client fetches flags of "1"
+    Then IMAP response contains "\\Deleted"
+    When IMAP client removes flags "\Deleted" from message "1"
+    Then IMAP response is "OK"
+    When IMAP client expunges
+    Then IMAP response is "OK"
+    And mailbox "INBOX" for "user" has 10 messages
+
+  Scenario: Expunge by UID removes only listed deleted messages
+    Given there are 10 messages in mailbox "INBOX" for "user"
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+    When IMAP client deletes messages "1:2"
+    Then IMAP response is "OK"
+    When IMAP client expunges by UID "2:3"
+    Then IMAP response is "OK"
+    And mailbox "INBOX" for "user" has 9 messages
+    When IMAP client expunges
+    Then IMAP response is "OK"
+    And mailbox "INBOX" for "user" has 8 messages
+
+  Scenario: Delete message from All Mail is not possible
+    Given there are 10 messages in mailbox "INBOX" for "user"
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "All Mail"
+    When IMAP client deletes messages "1"
+    Then IMAP response is "IMAP error: NO \[CANNOT\] Messages cannot be added to or removed from virtual mailbox"
+    And mailbox "INBOX" for "user" has 10 messages
+
+  Scenario: Delete message from All Mail with delete action
+    Given there are 10 messages in mailbox "INBOX" for "user"
+    And there is "user" with delete action "trash" in mailbox "All Mail"
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "All Mail"
+    When IMAP client deletes messages "1"
+    Then IMAP response is "OK"
+    When IMAP client expunges
+    Then IMAP response is "OK"
+    And mailbox "Trash" for "user" has 1 messages
@@ -49,3 +49,18 @@ Feature: IMAP fetch messages
     When IMAP client fetches by UID "11:*"
     Then IMAP response is "OK"
     And IMAP response has 1 message
+
+  Scenario: Fetch Gmail labels and message ID
+    Given there is "user" with mailbox "Labels/label"
+    And there are messages in mailboxes "INBOX,Folders/mbox,Labels/label" for "user"
+      | from              | to         | subject | body  | read  | starred |
+      | john.doe@mail.com | user@pm.me | foo     | hello | false | true    |
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+    When IMAP client fetches items "(X-GM-LABELS X-GM-MSGID)" of "1"
+    Then IMAP response is "OK"
+    And IMAP response contains "X-GM-LABELS \(.*\\Inbox.*\)"
+    And IMAP response contains "X-GM-LABELS \(.*\\Starred.*\)"
+    And IMAP response contains "X-GM-LABELS \(.*Folders/mbox.*\)"
+    And IMAP response contains "X-GM-LABELS \(.*Labels/label.*\)"
+    And IMAP response contains "X-GM-MSGID \d+"
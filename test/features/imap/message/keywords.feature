@@ -0,0 +1,37 @@
+Feature: IMAP keywords mapped to labels
+  Background:
+    Given there is connected user "user"
+    And there are messages in mailbox "INBOX" for "user"
+      | from              | to         | subject | body  |
+      | john.doe@mail.com | user@pm.me | foo     | hello |
+      | jane.doe@mail.com | name@pm.me | bar     | world |
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+
+  Scenario: Mapped keyword is permanent flag
+    When IMAP client selects "INBOX"
+    Then IMAP response contains "PERMANENTFLAGS \(.*\$Work.*\)"
+
+  Scenario: Add mapped keyword
+    When IMAP client adds flags "$Work" to message "1"
+    Then IMAP response is "OK"
+    And "user" has mailbox "Labels/Work"
+    And mailbox "Labels/Work" for "user" has 1 message
+    When IMAP client fetches flags of "1"
+    Then IMAP response contains "FLAGS \(.*\$Work.*\)"
+    When IMAP client searches for "KEYWORD $work"
+    Then IMAP response contains "SEARCH 1\s*$"
+
+  Scenario: Remove mapped keyword
+    Given IMAP client adds flags "$Work" to message "1:*"
+    And IMAP response is "OK"
+    When IMAP client removes flags "$Work" from message "2"
+    Then IMAP response is "OK"
+    And mailbox "Labels/Work" for "user" has 1 message
+    When IMAP client searches for "UNKEYWORD $Work"
+    Then IMAP response contains "SEARCH 2\s*$"
+
+  Scenario: Unknown keyword is not stored
+    When IMAP client adds flags "$Other" to message "1"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Labels/$Other"
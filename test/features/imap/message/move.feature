@@ -9,9 +9,8 @@ Feature: IMAP move messages
     And there is IMAP client logged in as "user"
     And there is IMAP client selected in "INBOX"
 
-  @ignore
   Scenario: Move message
-    When IMAP client moves messages "1" to "Folders/mbox"
+    When IMAP client moves messages "2" to "Folders/mbox"
     Then IMAP response is "OK"
     And mailbox "INBOX" for "user" has messages
       | from              | to         | subject |
@@ -20,7 +19,16 @@ Feature: IMAP move messages
       | from              | to         | subject |
       | john.doe@mail.com | user@pm.me | foo     |
 
-  @ignore
+  Scenario: Move message reports new UID
+    When IMAP client moves messages "2" to "Folders/mbox"
+    Then IMAP response contains "OK \[COPYUID \d+ 2 \d+\] MOVE successful"
+    And mailbox "INBOX" for "user" has messages
+      | from              | to         | subject |
+      | jane.doe@mail.com | name@pm.me | bar     |
+    And mailbox "Folders/mbox" for "user" has messages
+      | from              | to         | subject |
+      | john.doe@mail.com | user@pm.me | foo     |
+
   Scenario: Move all messages
     When IMAP client moves messages "1:*" to "Folders/mbox"
     Then IMAP response is "OK"
@@ -30,9 +38,8 @@ Feature: IMAP move messages
       | john.doe@mail.com | user@pm.me | foo     |
       | jane.doe@mail.com | name@pm.me | bar     |
 
-  @ignore
   Scenario: Move message to All Mail
-    When IMAP client moves messages "1" to "All Mail"
+    When IMAP client moves messages "2" to "All Mail"
     Then IMAP response is "OK"
     And mailbox "INBOX" for "user" has messages
       | from              | to         | subject |
@@ -41,9 +48,9 @@ Feature: IMAP move messages
       | from              | to         | subject |
       | john.doe@mail.com | user@pm.me | foo     |
 
-  @ignore
   Scenario: Move message from All Mail is not possible
-    When IMAP client moves messages "1" to "Folders/mbox"
+    Given there is IMAP client selected in "All Mail"
+    When IMAP client moves messages "2" to "Folders/mbox"
     Then IMAP response is "OK"
     And mailbox "All Mail" for "user" has messages
       | from              | to         | subject |
@@ -52,3 +59,21 @@ Feature: IMAP move messages
     And mailbox "Folders/mbox" for "user" has messages
       | from              | to         | subject |
       | john.doe@mail.com | user@pm.me | foo     |
+
+  Scenario: Move message from Spam reports it as not spam
+    Given there are messages in mailbox "Spam" for "user"
+      | from             | to         | subject | body |
+      | spammer@mail.com | user@pm.me | offer   | buy  |
+    And there is IMAP client selected in "Spam"
+    When IMAP client moves messages "1" to "INBOX"
+    Then IMAP response is "OK"
+    And API endpoint "PUT /messages/mark/ham" is called
+
+  Scenario: Move message from Spam to Trash does not report it
+    Given there are messages in mailbox "Spam" for "user"
+      | from             | to         | subject | body |
+      | spammer@mail.com | user@pm.me | offer   | buy  |
+    And there is IMAP client selected in "Spam"
+    When IMAP client moves messages "1" to "Trash"
+    Then IMAP response is "OK"
+    And API endpoint "PUT /messages/mark/ham" is not called
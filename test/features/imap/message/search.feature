@@ -17,6 +17,41 @@ Feature: IMAP search messages
     When IMAP client searches for "TEXT world"
     Then IMAP response is "OK"
     And IMAP response has 1 message
+    And IMAP response contains "SEARCH 1\s*$"
+
+  Scenario: Search by body
+    When IMAP client searches for "BODY hello"
+    Then IMAP response is "OK"
+    And IMAP response has 1 message
+    And IMAP response contains "SEARCH 2\s*$"
+
+  Scenario: Search by part of body
+    When IMAP client searches for "BODY ELL"
+    Then IMAP response is "OK"
+    And IMAP response has 1 message
+    And IMAP response contains "SEARCH 2\s*$"
+
+  Scenario: Search by text matching subject
+    When IMAP client searches for "TEXT bar"
+    Then IMAP response is "OK"
+    And IMAP response has 1 message
+    And IMAP response contains "SEARCH 1\s*$"
+
+  Scenario: Search by body and from
+    When IMAP client searches for "BODY orl FROM jane"
+    Then IMAP response is "OK"
+    And IMAP response has 1 message
+    And IMAP response contains "SEARCH 1\s*$"
+
+  Scenario: Search by text not matching any message
+    When IMAP client searches for "TEXT nothing"
+    Then IMAP response is "OK"
+    And IMAP response contains "^\* SEARCH\s*$"
+
+  Scenario: Search by text and subject
+    When IMAP client searches for "TEXT world SUBJECT foo"
+    Then IMAP response is "OK"
+    And IMAP response contains "^\* SEARCH\s*$"
 
   Scenario: Search by from
     When IMAP client searches for "FROM jane.doe@email.com"
@@ -27,3 +62,26 @@ Feature: IMAP search messages
     When IMAP client searches for "TO user@pm.me"
     Then IMAP response is "OK"
     And IMAP response has 1 message
+
+  Scenario: Extended search
+    When IMAP client searches for "RETURN (MIN MAX COUNT) ALL"
+    Then IMAP response is "OK"
+    And IMAP response contains "ESEARCH MIN 1 MAX 2 COUNT 2"
+
+  Scenario: Fetch saved search result
+    When IMAP client searches for "RETURN (SAVE) SUBJECT foo"
+    Then IMAP response is "OK"
+    When IMAP client fetches "$"
+    Then IMAP response is "OK"
+    And IMAP response has 1 message
+    And IMAP response contains "\* 2 FETCH"
+
+  Scenario: Search in saved search result
+    When IMAP client searches for "RETURN (SAVE) SUBJECT foo"
+    Then IMAP response is "OK"
+    When IMAP client searches for "RETURN (ALL) $ TO user@pm.me"
+    Then IMAP response is "OK"
+    And IMAP response contains "ESEARCH ALL 2"
+    When IMAP client searches for "RETURN (COUNT) $ TO name@pm.me"
+    Then IMAP response is "OK"
+    And IMAP response contains "ESEARCH COUNT 0"
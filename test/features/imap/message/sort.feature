@@ -0,0 +1,38 @@
+Feature: IMAP sort and thread messages
+  Background:
+    Given there is connected user "user"
+    Given there are messages in mailbox "INBOX" for "user"
+      | from              | to         | subject | body  |
+      | john.doe@mail.com | user@pm.me | Re: foo | hello |
+      | jane.doe@mail.com | name@pm.me | bar     | world |
+      | jack.doe@mail.com | user@pm.me | foo     | hello |
+    And there is IMAP client logged in as "user"
+    And there is IMAP client selected in "INBOX"
+
+  Scenario: Sort by subject
+    When IMAP client sorts by "SUBJECT"
+    Then IMAP response is "OK"
+    And IMAP response contains "SORT 2 1 3"
+
+  Scenario: Sort by reversed from
+    When IMAP client sorts by "REVERSE FROM"
+    Then IMAP response is "OK"
+    And IMAP response contains "SORT 3 2 1"
+
+  Scenario: Sort by unsupported key
+    When IMAP client sorts by "UNKNOWN"
+    Then IMAP response is "IMAP error: BAD unsupported sort key UNKNOWN"
+
+  Scenario: Thread by ordered subject
+    When IMAP client threads by "ORDEREDSUBJECT"
+    Then IMAP response is "OK"
+    And IMAP response contains "THREAD "
+    And IMAP response contains "\(2\)"
+    And IMAP response contains "\(1 3\)"
+
+  Scenario: Thread by references
+    When IMAP client threads by "REFERENCES"
+    Then IMAP response is "OK"
+    And IMAP response contains "THREAD "
+    And IMAP response contains "\(2\)"
+    And IMAP response contains "\(1 3\)"
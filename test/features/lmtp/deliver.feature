@@ -0,0 +1,32 @@
+Feature: LMTP delivery
+  Background:
+    Given there is connected user "user"
+
+  Scenario: Message is imported into Inbox
+    When LMTP client delivers message
+      """
+      From: sender@external.test
+      To: user@pm.me
+      Subject: Delivered locally
+
+      hello
+
+      """
+    Then SMTP response to "lmtp" is "OK"
+    And mailbox "INBOX" for "user" has 1 messages
+    And mailbox "INBOX" for "user" has messages
+      | from                 | to         | subject           |
+      | sender@external.test | user@pm.me | Delivered locally |
+
+  Scenario: Unknown recipient is rejected
+    When LMTP client delivers message
+      """
+      From: sender@external.test
+      To: Nobody <nobody@pm.me>
+      Subject: Delivered locally
+
+      hello
+
+      """
+    Then SMTP response to "lmtp" is "SMTP error: 550 5.1.1 No such user here"
+    And mailbox "INBOX" for "user" has no messages
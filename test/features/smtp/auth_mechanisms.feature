@@ -0,0 +1,19 @@
+Feature: SMTP auth mechanisms
+  Background:
+    Given there is connected user "user"
+
+  Scenario: Authenticates using CRAM-MD5
+    When SMTP client authenticates "user" using CRAM-MD5
+    Then SMTP response is "OK"
+
+  Scenario: Authenticates using CRAM-MD5 with bad password
+    When SMTP client authenticates "user" using CRAM-MD5 with bad password
+    Then SMTP response is "SMTP error: 454 4.7.0 backend/credentials: incorrect password"
+
+  Scenario: Authenticates using OAUTHBEARER
+    When SMTP client authenticates "user" using OAUTHBEARER
+    Then SMTP response is "OK"
+
+  Scenario: Authenticates using OAUTHBEARER with bad password
+    When SMTP client authenticates "user" using OAUTHBEARER with bad password
+    Then SMTP response is "SMTP error: 454 4.7.0 OAUTHBEARER authentication error"
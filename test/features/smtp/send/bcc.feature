@@ -67,3 +67,34 @@ Feature: SMTP with bcc
         }
       }
       """
+
+  Scenario: Send message to undisclosed recipients
+    When SMTP client sends message with bcc "bridgetest@protonmail.com"
+      """
+      Subject: hello
+      From: Bridge Test <bridgetest@pm.test>
+      To: undisclosed-recipients:;
+      Bcc: bridgetest@protonmail.com
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to | subject |
+      | now  | [userAddress] |    | hello   |
+    And message is sent with API call:
+      """
+      {
+        "Message": {
+          "Subject": "hello",
+          "ToList": [],
+          "CCList": [],
+          "BCCList": [
+            {
+              "Address": "bridgetest@protonmail.com"
+            }
+          ]
+        }
+      }
+      """
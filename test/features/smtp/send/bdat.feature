@@ -0,0 +1,57 @@
+Feature: SMTP sending using BDAT
+  Background:
+    Given there is connected user "user"
+    And there is SMTP client logged in as "user"
+
+  Scenario: Message sent in one chunk
+    When SMTP client sends message using BDAT in chunks of 1000 bytes
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: BDAT in one chunk
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject           |
+      | now  | [userAddress] | bridgetest@protonmail.com | BDAT in one chunk |
+
+  Scenario: Message sent in more chunks
+    When SMTP client sends message using BDAT in chunks of 10 bytes
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: BDAT in more chunks
+
+      hello
+      world
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject             |
+      | now  | [userAddress] | bridgetest@protonmail.com | BDAT in more chunks |
+
+  Scenario: Message sent using BDAT and DATA in one connection
+    When SMTP client sends message using BDAT in chunks of 10 bytes
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: BDAT first
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: DATA second
+
+      world
+
+      """
+    Then SMTP response is "OK"
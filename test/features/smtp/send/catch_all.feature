@@ -0,0 +1,65 @@
+Feature: SMTP sending from catch-all custom domain
+  Background:
+    Given there is connected user "userCatchAll"
+    And there is SMTP client logged in as "userCatchAll"
+
+  Scenario: Any address of the domain in the From header
+    When SMTP client sends message
+      """
+      From: Shop <shop@custom.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Sent as shop
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And message is sent with API call:
+      """
+      {
+        "Message": {
+          "Subject": "Sent as shop",
+          "Sender": {
+            "Name": "Shop",
+            "Address": "shop@custom.test"
+          },
+          "AddressID": "catchall"
+        }
+      }
+      """
+
+  Scenario: Any address of the domain in MAIL FROM
+    When SMTP client sends message with MAIL FROM "shop@custom.test"
+      """
+      From: Shop <shop@custom.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Sent as shop
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And message is sent with API call:
+      """
+      {
+        "Message": {
+          "Subject": "Sent as shop",
+          "Sender": {
+            "Name": "Shop",
+            "Address": "shop@custom.test"
+          }
+        }
+      }
+      """
+
+  Scenario: Address of other domain is rejected
+    When SMTP client sends message with MAIL FROM "shop@other.test"
+      """
+      From: Shop <shop@other.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Sent as shop
+
+      hello
+
+      """
+    Then SMTP response is "SMTP error: 554 5.0.0 Error: transaction failed: backend: invalid email address: not owned by user"
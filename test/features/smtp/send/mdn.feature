@@ -0,0 +1,63 @@
+Feature: SMTP sending with message disposition notifications
+  Background:
+    Given there is connected user "user"
+    And there is SMTP client logged in as "user"
+
+  Scenario: Message requesting read receipt
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Read receipt requested
+      Disposition-Notification-To: Bridge Test <bridgetest@pm.test>
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And message is sent with API call:
+      """
+      {
+        "Message": {
+          "Subject": "Read receipt requested",
+          "Flags": 65536,
+          "ToList": [
+            {
+              "Address": "bridgetest@protonmail.com",
+              "Name": "Internal Bridge"
+            }
+          ],
+          "CCList": [],
+          "BCCList": [],
+          "MIMEType": "text/plain"
+        }
+      }
+      """
+
+  Scenario: Read receipt
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Read: hello
+      MIME-Version: 1.0
+      Content-Type: multipart/report; report-type=disposition-notification; boundary="XX"
+
+      --XX
+      Content-Type: text/plain; charset=utf-8
+
+      The message was displayed.
+      --XX
+      Content-Type: message/disposition-notification
+
+      Final-Recipient: rfc822;bridgetest@pm.test
+      Original-Message-ID: <hello@pm.test>
+      Disposition: manual-action/MDN-sent-manually; displayed
+
+      --XX--
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject     |
+      | now  | [userAddress] | bridgetest@protonmail.com | Read: hello |
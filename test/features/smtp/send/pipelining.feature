@@ -0,0 +1,45 @@
+Feature: SMTP sending using pipelining
+  Background:
+    Given there is connected user "user"
+    And there is SMTP client logged in as "user"
+
+  Scenario: Message sent with pipelined envelope
+    When SMTP client sends message using pipelining with bcc "bridgetest2@protonmail.com"
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Pipelined
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject   |
+      | now  | [userAddress] | bridgetest@protonmail.com | Pipelined |
+
+  Scenario: More messages sent with pipelining in one connection
+    When SMTP client sends message using pipelining
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Pipelined first
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    When SMTP client sends message using pipelining
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Pipelined second
+
+      world
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject          |
+      | now  | [userAddress] | bridgetest@protonmail.com | Pipelined first  |
+      | now  | [userAddress] | bridgetest@protonmail.com | Pipelined second |
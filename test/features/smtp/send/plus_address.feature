@@ -0,0 +1,28 @@
+Feature: SMTP sending with plus-addressing
+  Background:
+    Given there is connected user "user"
+    And there is SMTP client logged in as "user"
+
+  Scenario: Tagged From header is preserved
+    When SMTP client sends message
+      """
+      From: Bridge Test <user+tag@pm.me>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Tagged sender
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And message is sent with API call:
+      """
+      {
+        "Message": {
+          "Subject": "Tagged sender",
+          "Sender": {
+            "Name": "Bridge Test",
+            "Address": "user+tag@pm.me"
+          }
+        }
+      }
+      """
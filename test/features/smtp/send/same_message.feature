@@ -27,6 +27,7 @@ Feature: SMTP sending the same message twice
     And mailbox "Sent" for "user" has messages
       | time | from          | to                        | subject |
       | now  | [userAddress] | bridgetest@protonmail.com | Hello   |
+    And mailbox "Sent" for "user" has 1 message
 
   Scenario: Slight change means different message and is sent twice
     When SMTP client sends message
@@ -43,3 +44,49 @@ Feature: SMTP sending the same message twice
       | time | from          | to                        | subject |
       | now  | [userAddress] | bridgetest@protonmail.com | Hello   |
       | now  | [userAddress] | bridgetest@protonmail.com | Hello.  |
+
+  Scenario: Message with the same Message-ID is not sent twice
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Report
+      Message-ID: <report-1@pm.test>
+
+      Status at 10:00
+
+      """
+    Then SMTP response is "OK"
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Report
+      Message-ID: <report-1@pm.test>
+
+      Status at 10:01
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject |
+      | now  | [userAddress] | bridgetest@protonmail.com | Hello   |
+      | now  | [userAddress] | bridgetest@protonmail.com | Report  |
+    And mailbox "Sent" for "user" has 2 messages
+
+  Scenario: The same content with different Message-ID is sent twice
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Hello
+      Message-ID: <hello-2@pm.test>
+
+      World
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject |
+      | now  | [userAddress] | bridgetest@protonmail.com | Hello   |
+    And mailbox "Sent" for "user" has 2 messages
@@ -0,0 +1,47 @@
+Feature: SMTP sending of scheduled messages
+  Background:
+    Given there is connected user "user"
+    And there is SMTP client logged in as "user"
+
+  Scenario: Message scheduled in the future is not sent yet
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Scheduled
+      X-Pm-Scheduled-Send: 4102444800
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has no messages
+
+  Scenario: Message scheduled in the past is sent immediately
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Scheduled
+      X-Pm-Scheduled-Send: Sun, 13 Sep 2020 12:26:40 +0000
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject   |
+      | now  | [userAddress] | bridgetest@protonmail.com | Scheduled |
+
+  Scenario: Message with invalid scheduled time
+    When SMTP client sends message
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: Scheduled
+      X-Pm-Scheduled-Send: tomorrow
+
+      hello
+
+      """
+    Then SMTP response is "SMTP error: 554 5.6.0 invalid X-Pm-Scheduled-Send header"
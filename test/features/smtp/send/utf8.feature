@@ -0,0 +1,52 @@
+Feature: SMTP sending with internationalized addresses and 8-bit bodies
+  Background:
+    Given there is connected user "user"
+    And there is SMTP client logged in as "user"
+
+  Scenario: Message with 8-bit body
+    When SMTP client sends message with MAIL parameters "BODY=8BITMIME"
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Internal Bridge <bridgetest@protonmail.com>
+      Subject: 8-bit body
+      Content-Type: text/plain; charset=utf-8
+      Content-Transfer-Encoding: 8bit
+
+      Příliš žluťoučký kůň úpěl ďábelské ódy
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                        | subject    |
+      | now  | [userAddress] | bridgetest@protonmail.com | 8-bit body |
+
+  Scenario: Message to internationalized address
+    When SMTP client sends message with MAIL parameters "SMTPUTF8 BODY=8BITMIME"
+      """
+      From: Bridge Test <bridgetest@pm.test>
+      To: Jiří Bridge <jiří@protonmail.com>
+      Subject: Ahoj Jiří
+
+      hello
+
+      """
+    Then SMTP response is "OK"
+    And mailbox "Sent" for "user" has messages
+      | time | from          | to                  | subject   |
+      | now  | [userAddress] | jiří@protonmail.com | Ahoj Jiří |
+    And message is sent with API call:
+      """
+      {
+        "Message": {
+          "Subject": "Ahoj Jiří",
+          "ToList": [
+            {
+              "Address": "jiří@protonmail.com",
+              "Name": "Jiří Bridge"
+            }
+          ],
+          "CCList": [],
+          "BCCList": []
+        }
+      }
+      """
@@ -29,6 +29,7 @@ func IMAPActionsAuthFeatureContext(s *godog.Suite) {
 	s.Step(`^IMAP client authenticates "([^"]*)" with bad password$`, imapClientAuthenticatesWithBadPassword)
 	s.Step(`^IMAP client authenticates with username "([^"]*)" and password "([^"]*)"$`, imapClientAuthenticatesWithUsernameAndPassword)
 	s.Step(`^IMAP client logs out$`, imapClientLogsOut)
+	s.Step(`^IMAP client sends ID with name "([^"]*)"$`, imapClientSendsIDWithName)
 }
 
 func imapClientAuthenticates(bddUserID string) error {
@@ -75,6 +76,12 @@ func imapClientAuthenticatesWithUsernameAndPassword(username, password string) e
 	return nil
 }
 
+func imapClientSendsIDWithName(name string) error {
+	res := ctx.GetIMAPClient("imap").ID(name)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientLogsOut() error {
 	res := ctx.GetIMAPClient("imap").Logout()
 	ctx.SetIMAPLastResponse("imap", res)
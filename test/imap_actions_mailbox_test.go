@@ -26,9 +26,15 @@ func IMAPActionsMailboxFeatureContext(s *godog.Suite) {
 	s.Step(`^IMAP client renames mailbox "([^"]*)" to "([^"]*)"$`, imapClientRenamesMailboxTo)
 	s.Step(`^IMAP client deletes mailbox "([^"]*)"$`, imapClientDeletesMailbox)
 	s.Step(`^IMAP client lists mailboxes$`, imapClientListsMailboxes)
+	s.Step(`^IMAP client lists mailboxes with XLIST$`, imapClientListsMailboxesWithXList)
+	s.Step(`^IMAP client lists mailboxes returning "([^"]*)"$`, imapClientListsMailboxesReturning)
+	s.Step(`^IMAP client lists mailboxes selecting "([^"]*)" returning "([^"]*)"$`, imapClientListsMailboxesSelectingReturning)
 	s.Step(`^IMAP client selects "([^"]*)"$`, imapClientSelects)
+	s.Step(`^IMAP client unselects$`, imapClientUnselects)
 	s.Step(`^IMAP client gets info of "([^"]*)"$`, imapClientGetsInfoOf)
 	s.Step(`^IMAP client gets status of "([^"]*)"$`, imapClientGetsStatusOf)
+	s.Step(`^IMAP client gets quota root of "([^"]*)"$`, imapClientGetsQuotaRootOf)
+	s.Step(`^IMAP client gets quota "([^"]*)"$`, imapClientGetsQuota)
 }
 
 func imapClientCreatesMailbox(mailboxName string) error {
@@ -55,12 +61,34 @@ func imapClientListsMailboxes() error {
 	return nil
 }
 
+func imapClientListsMailboxesReturning(returnOptions string) error {
+	return imapClientListsMailboxesSelectingReturning("", returnOptions)
+}
+
+func imapClientListsMailboxesSelectingReturning(selectionOptions, returnOptions string) error {
+	res := ctx.GetIMAPClient("imap").ListMailboxesExtended(selectionOptions, returnOptions)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
+func imapClientListsMailboxesWithXList() error {
+	res := ctx.GetIMAPClient("imap").XListMailboxes()
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientSelects(mailboxName string) error {
 	res := ctx.GetIMAPClient("imap").Select(mailboxName)
 	ctx.SetIMAPLastResponse("imap", res)
 	return nil
 }
 
+func imapClientUnselects() error {
+	res := ctx.GetIMAPClient("imap").Unselect()
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientGetsInfoOf(mailboxName string) error {
 	res := ctx.GetIMAPClient("imap").GetMailboxInfo(mailboxName)
 	ctx.SetIMAPLastResponse("imap", res)
@@ -72,3 +100,15 @@ func imapClientGetsStatusOf(mailboxName string) error {
 	ctx.SetIMAPLastResponse("imap", res)
 	return nil
 }
+
+func imapClientGetsQuotaRootOf(mailboxName string) error {
+	res := ctx.GetIMAPClient("imap").GetQuotaRoot(mailboxName)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
+func imapClientGetsQuota(quotaRoot string) error {
+	res := ctx.GetIMAPClient("imap").GetQuota(quotaRoot)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
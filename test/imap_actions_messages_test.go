@@ -24,13 +24,21 @@ import (
 func IMAPActionsMessagesFeatureContext(s *godog.Suite) {
 	s.Step(`^IMAP client fetches "([^"]*)"$`, imapClientFetches)
 	s.Step(`^IMAP client fetches by UID "([^"]*)"$`, imapClientFetchesByUID)
+	s.Step(`^IMAP client fetches flags of "([^"]*)"$`, imapClientFetchesFlagsOf)
+	s.Step(`^IMAP client fetches items "([^"]*)" of "([^"]*)"$`, imapClientFetchesItemsOf)
 	s.Step(`^IMAP client searches for "([^"]*)"$`, imapClientSearchesFor)
+	s.Step(`^IMAP client sorts by "([^"]*)"$`, imapClientSortsBy)
+	s.Step(`^IMAP client threads by "([^"]*)"$`, imapClientThreadsBy)
 	s.Step(`^IMAP client deletes messages "([^"]*)"$`, imapClientDeletesMessages)
 	s.Step(`^IMAP client "([^"]*)" deletes messages "([^"]*)"$`, imapClientNamedDeletesMessages)
+	s.Step(`^IMAP client expunges$`, imapClientExpunges)
+	s.Step(`^IMAP client expunges by UID "([^"]*)"$`, imapClientExpungesByUID)
 	s.Step(`^IMAP client copies messages "([^"]*)" to "([^"]*)"$`, imapClientCopiesMessagesTo)
 	s.Step(`^IMAP client moves messages "([^"]*)" to "([^"]*)"$`, imapClientMovesMessagesTo)
 	s.Step(`^IMAP client creates message "([^"]*)" from "([^"]*)" to "([^"]*)" with body "([^"]*)" in "([^"]*)"$`, imapClientCreatesMessageFromToWithBody)
 	s.Step(`^IMAP client creates message "([^"]*)" from "([^"]*)" to address "([^"]*)" of "([^"]*)" with body "([^"]*)" in "([^"]*)"$`, imapClientCreatesMessageFromToAddressOfUserWithBody)
+	s.Step(`^IMAP client creates message "([^"]*)" from "([^"]*)" to "([^"]*)" with body "([^"]*)" catenated in "([^"]*)"$`, imapClientCreatesCatenatedMessageFromToWithBody)
+	s.Step(`^IMAP client creates message "([^"]*)" from "([^"]*)" to "([^"]*)" with URL "([^"]*)" and body "([^"]*)" catenated in "([^"]*)"$`, imapClientCreatesCatenatedMessageFromToWithURLAndBody)
 	s.Step(`^IMAP client creates message "([^"]*)" from address "([^"]*)" of "([^"]*)" to "([^"]*)" with body "([^"]*)" in "([^"]*)"$`, imapClientCreatesMessageFromAddressOfUserToWithBody)
 	s.Step(`^IMAP client marks message "([^"]*)" as read$`, imapClientMarksMessageAsRead)
 	s.Step(`^IMAP client "([^"]*)" marks message "([^"]*)" as read$`, imapClientNamedMarksMessageAsRead)
@@ -40,6 +48,8 @@ func IMAPActionsMessagesFeatureContext(s *godog.Suite) {
 	s.Step(`^IMAP client "([^"]*)" marks message "([^"]*)" as starred$`, imapClientNamedMarksMessageAsStarred)
 	s.Step(`^IMAP client marks message "([^"]*)" as unstarred$`, imapClientMarksMessageAsUnstarred)
 	s.Step(`^IMAP client "([^"]*)" marks message "([^"]*)" as unstarred$`, imapClientNamedMarksMessageAsUnstarred)
+	s.Step(`^IMAP client adds flags "([^"]*)" to message "([^"]*)"$`, imapClientAddsFlagsToMessage)
+	s.Step(`^IMAP client removes flags "([^"]*)" from message "([^"]*)"$`, imapClientRemovesFlagsFromMessage)
 	s.Step(`^IMAP client starts IDLE-ing$`, imapClientStartsIDLEing)
 	s.Step(`^IMAP client "([^"]*)" starts IDLE-ing$`, imapClientNamedStartsIDLEing)
 }
@@ -56,12 +66,36 @@ func imapClientFetchesByUID(fetchRange string) error {
 	return nil
 }
 
+func imapClientFetchesFlagsOf(fetchRange string) error {
+	res := ctx.GetIMAPClient("imap").Fetch(fetchRange, "FLAGS")
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
+func imapClientFetchesItemsOf(items, fetchRange string) error {
+	res := ctx.GetIMAPClient("imap").Fetch(fetchRange, items)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientSearchesFor(query string) error {
 	res := ctx.GetIMAPClient("imap").Search(query)
 	ctx.SetIMAPLastResponse("imap", res)
 	return nil
 }
 
+func imapClientSortsBy(criteria string) error {
+	res := ctx.GetIMAPClient("imap").Sort(criteria)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
+func imapClientThreadsBy(algorithm string) error {
+	res := ctx.GetIMAPClient("imap").Thread(algorithm)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientDeletesMessages(messageRange string) error {
 	return imapClientNamedDeletesMessages("imap", messageRange)
 }
@@ -72,6 +106,18 @@ func imapClientNamedDeletesMessages(imapClient, messageRange string) error {
 	return nil
 }
 
+func imapClientExpunges() error {
+	res := ctx.GetIMAPClient("imap").Expunge()
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
+func imapClientExpungesByUID(uids string) error {
+	res := ctx.GetIMAPClient("imap").ExpungeByUID(uids)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientCopiesMessagesTo(messageRange, newMailboxName string) error {
 	res := ctx.GetIMAPClient("imap").Copy(messageRange, newMailboxName)
 	ctx.SetIMAPLastResponse("imap", res)
@@ -90,6 +136,16 @@ func imapClientCreatesMessageFromToWithBody(subject, from, to, body, mailboxName
 	return nil
 }
 
+func imapClientCreatesCatenatedMessageFromToWithBody(subject, from, to, body, mailboxName string) error {
+	return imapClientCreatesCatenatedMessageFromToWithURLAndBody(subject, from, to, "", body, mailboxName)
+}
+
+func imapClientCreatesCatenatedMessageFromToWithURLAndBody(subject, from, to, url, body, mailboxName string) error {
+	res := ctx.GetIMAPClient("imap").AppendCatenate(mailboxName, subject, from, to, url, body)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientCreatesMessageFromToAddressOfUserWithBody(subject, from, bddAddressID, bddUserID, body, mailboxName string) error {
 	account := ctx.GetTestAccountWithAddress(bddUserID, bddAddressID)
 	if account == nil {
@@ -147,6 +203,18 @@ func imapClientNamedMarksMessageAsUnstarred(imapClient, messageRange string) err
 	return nil
 }
 
+func imapClientAddsFlagsToMessage(flags, messageRange string) error {
+	res := ctx.GetIMAPClient("imap").AddFlags(messageRange, flags)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
+func imapClientRemovesFlagsFromMessage(flags, messageRange string) error {
+	res := ctx.GetIMAPClient("imap").RemoveFlags(messageRange, flags)
+	ctx.SetIMAPLastResponse("imap", res)
+	return nil
+}
+
 func imapClientStartsIDLEing() error {
 	return imapClientNamedStartsIDLEing("imap")
 }
@@ -30,6 +30,8 @@ func IMAPChecksFeatureContext(s *godog.Suite) {
 	s.Step(`^IMAP response to "([^"]*)" is "([^"]*)"$`, imapResponseNamedIs)
 	s.Step(`^IMAP response contains "([^"]*)"$`, imapResponseContains)
 	s.Step(`^IMAP response to "([^"]*)" contains "([^"]*)"$`, imapResponseNamedContains)
+	s.Step(`^IMAP response does not contain "([^"]*)"$`, imapResponseDoesNotContain)
+	s.Step(`^IMAP response result contains "([^"]*)"$`, imapResponseResultContains)
 	s.Step(`^IMAP response has (\d+) message(?:s)?$`, imapResponseHasNumberOfMessages)
 	s.Step(`^IMAP response to "([^"]*)" has (\d+) message(?:s)?$`, imapResponseNamedHasNumberOfMessages)
 	s.Step(`^IMAP client receives update marking message "([^"]*)" as read within (\d+) seconds$`, imapClientReceivesUpdateMarkingMessagesAsReadWithin)
@@ -63,6 +65,18 @@ func imapResponseNamedContains(clientID, expectedResponse string) error {
 	return ctx.GetTestingError()
 }
 
+func imapResponseDoesNotContain(unwantedResponse string) error {
+	res := ctx.GetIMAPLastResponse("imap")
+	res.AssertNotSections(unwantedResponse)
+	return ctx.GetTestingError()
+}
+
+func imapResponseResultContains(expectedResult string) error {
+	res := ctx.GetIMAPLastResponse("imap")
+	res.AssertResult(expectedResult)
+	return ctx.GetTestingError()
+}
+
 func imapResponseHasNumberOfMessages(expectedCount int) error {
 	return imapResponseNamedHasNumberOfMessages("imap", expectedCount)
 }
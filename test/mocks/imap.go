@@ -84,6 +84,10 @@ func (c *IMAPClient) Login(account, password string) *IMAPResponse {
 	return c.SendCommand(fmt.Sprintf("LOGIN %s %s", account, password))
 }
 
+func (c *IMAPClient) ID(name string) *IMAPResponse {
+	return c.SendCommand(fmt.Sprintf("ID (\"name\" \"%s\")", name))
+}
+
 func (c *IMAPClient) Logout() *IMAPResponse {
 	return c.SendCommand("LOGOUT")
 }
@@ -94,10 +98,30 @@ func (c *IMAPClient) ListMailboxes() *IMAPResponse {
 	return c.SendCommand("LIST \"\" *")
 }
 
+func (c *IMAPClient) ListMailboxesExtended(selectionOptions, returnOptions string) *IMAPResponse {
+	cmd := "LIST "
+	if selectionOptions != "" {
+		cmd += fmt.Sprintf("(%s) ", selectionOptions)
+	}
+	cmd += "\"\" *"
+	if returnOptions != "" {
+		cmd += fmt.Sprintf(" RETURN (%s)", returnOptions)
+	}
+	return c.SendCommand(cmd)
+}
+
+func (c *IMAPClient) XListMailboxes() *IMAPResponse {
+	return c.SendCommand("XLIST \"\" *")
+}
+
 func (c *IMAPClient) Select(mailboxName string) *IMAPResponse {
 	return c.SendCommand(fmt.Sprintf("SELECT \"%s\"", mailboxName)) //nolint[gosec]
 }
 
+func (c *IMAPClient) Unselect() *IMAPResponse {
+	return c.SendCommand("UNSELECT")
+}
+
 func (c *IMAPClient) CreateMailbox(mailboxName string) *IMAPResponse {
 	return c.SendCommand(fmt.Sprintf("CREATE \"%s\"", mailboxName))
 }
@@ -118,6 +142,14 @@ func (c *IMAPClient) GetMailboxStatus(mailboxName string) *IMAPResponse {
 	return c.SendCommand(fmt.Sprintf("STATUS \"%s\" (MESSAGES UNSEEN UIDNEXT UIDVALIDITY)", mailboxName))
 }
 
+func (c *IMAPClient) GetQuotaRoot(mailboxName string) *IMAPResponse {
+	return c.SendCommand(fmt.Sprintf("GETQUOTAROOT \"%s\"", mailboxName))
+}
+
+func (c *IMAPClient) GetQuota(quotaRoot string) *IMAPResponse {
+	return c.SendCommand(fmt.Sprintf("GETQUOTA \"%s\"", quotaRoot))
+}
+
 // Messages
 
 func (c *IMAPClient) FetchAllFlags() *IMAPResponse {
@@ -160,6 +192,14 @@ func (c *IMAPClient) Search(query string) *IMAPResponse {
 	return c.SendCommand(fmt.Sprintf("SEARCH %s", query))
 }
 
+func (c *IMAPClient) Sort(criteria string) *IMAPResponse {
+	return c.SendCommand(fmt.Sprintf("SORT (%s) UTF-8 ALL", criteria))
+}
+
+func (c *IMAPClient) Thread(algorithm string) *IMAPResponse {
+	return c.SendCommand(fmt.Sprintf("THREAD %s UTF-8 ALL", algorithm))
+}
+
 // Message
 
 func (c *IMAPClient) Append(mailboxName, subject, from, to, body string) *IMAPResponse {
@@ -174,10 +214,37 @@ func (c *IMAPClient) Append(mailboxName, subject, from, to, body string) *IMAPRe
 	return c.SendCommand(cmd)
 }
 
+// AppendCatenate appends message using CATENATE with header and body sent
+// as separate TEXT parts and data referenced by url between them, if set.
+func (c *IMAPClient) AppendCatenate(mailboxName, subject, from, to, url, body string) *IMAPResponse {
+	header := fmt.Sprintf("Subject: %s\r\n", subject)
+	header += fmt.Sprintf("From: %s\r\n", from)
+	header += fmt.Sprintf("To: %s\r\n", to)
+	header += "\r\n"
+	body += "\r\n"
+
+	parts := fmt.Sprintf("TEXT {%d}\r\n%s", len(header), header)
+	if url != "" {
+		parts += fmt.Sprintf(" URL \"%s\"", url)
+	}
+	parts += fmt.Sprintf(" TEXT {%d}\r\n%s", len(body), body)
+
+	cmd := fmt.Sprintf("APPEND \"%s\" CATENATE (%s)", mailboxName, parts)
+	return c.SendCommand(cmd)
+}
+
 func (c *IMAPClient) Delete(ids string) *IMAPResponse {
 	return c.AddFlags(ids, "\\Deleted")
 }
 
+func (c *IMAPClient) Expunge() *IMAPResponse {
+	return c.SendCommand("EXPUNGE")
+}
+
+func (c *IMAPClient) ExpungeByUID(ids string) *IMAPResponse {
+	return c.SendCommand(fmt.Sprintf("UID EXPUNGE %s", ids))
+}
+
 func (c *IMAPClient) Copy(ids, newMailboxName string) *IMAPResponse {
 	return c.SendCommand(fmt.Sprintf("COPY %s \"%s\"", ids, newMailboxName))
 }
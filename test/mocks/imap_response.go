@@ -150,6 +150,13 @@ func (ir *IMAPResponse) AssertSectionsInOrder(wantRegexps ...string) *IMAPRespon
 	return ir
 }
 
+// AssertResult checks the tagged line finishing the response against regular expression.
+func (ir *IMAPResponse) AssertResult(wantRegexp string) *IMAPResponse {
+	ir.wait()
+	a.Regexp(ir.t, wantRegexp, ir.result, "Result does not match given regex")
+	return ir
+}
+
 // AssertSections is similar to AssertSectionsInOrder but is not strict to the order.
 // It means it just tries to find all "regexps" in the response.
 func (ir *IMAPResponse) AssertSections(wantRegexps ...string) *IMAPResponse {
@@ -160,6 +167,16 @@ func (ir *IMAPResponse) AssertSections(wantRegexps ...string) *IMAPResponse {
 	return ir
 }
 
+// AssertNotSections is the opposite of AssertSections: none of "regexps"
+// can be found in the response.
+func (ir *IMAPResponse) AssertNotSections(unwantedRegexps ...string) *IMAPResponse {
+	ir.wait()
+	for _, unwantedRegexp := range unwantedRegexps {
+		a.Error(ir.t, ir.hasSectionRegexp(unwantedRegexp), "regexp %v found", unwantedRegexp)
+	}
+	return ir
+}
+
 // WaitForSections is the same as AssertSections but waits for `timeout` before giving up.
 func (ir *IMAPResponse) WaitForSections(timeout time.Duration, wantRegexps ...string) {
 	a.Eventually(ir.t, func() bool {
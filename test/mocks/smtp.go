@@ -29,6 +29,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/pkg/crammd5"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -118,6 +119,35 @@ func (c *SMTPClient) Login(account, password string) *SMTPResponse {
 	)
 }
 
+// LoginCRAMMD5 authenticates by CRAM-MD5 digest of the challenge sent by server.
+func (c *SMTPClient) LoginCRAMMD5(account, password string) *SMTPResponse {
+	c.address = account
+	res := c.SendCommands("HELO ATEIST.TEST", "AUTH CRAM-MD5")
+	if res.err != nil {
+		return res
+	}
+	challenge, err := decodeBase64(strings.TrimSpace(strings.TrimPrefix(res.result, "334 ")))
+	if err != nil {
+		res.err = errors.Wrap(err, "invalid CRAM-MD5 challenge")
+		return res
+	}
+	return c.SendCommands(base64(account + " " + crammd5.Digest(password, challenge)))
+}
+
+// LoginOAuthBearer authenticates by OAUTHBEARER with password as a token.
+func (c *SMTPClient) LoginOAuthBearer(account, password string) *SMTPResponse {
+	c.address = account
+	res := c.SendCommands(
+		"HELO ATEIST.TEST",
+		"AUTH OAUTHBEARER "+base64("n,a="+account+",\x01auth=Bearer "+password+"\x01\x01"),
+	)
+	// Server sends error details as a challenge which has to be answered by dummy response.
+	if res.err == nil && strings.HasPrefix(res.result, "334") {
+		return c.SendCommands(base64("\x01"))
+	}
+	return res
+}
+
 func (c *SMTPClient) Logout() *SMTPResponse {
 	return c.SendCommands("QUIT")
 }
@@ -135,18 +165,197 @@ func (c *SMTPClient) EML(fileName, bcc string) *SMTPResponse {
 }
 
 func (c *SMTPClient) SendMail(r io.Reader, bcc string) *SMTPResponse {
-	var message, from string
-	var tos []string
+	from, tos, message := parseMail(r, c.address, bcc)
+
+	commands := getEnvelopeCommands(from, tos)
+	commands = append(commands, "DATA", message+"\r\n.") // Message ending.
+	return c.SendCommands(commands...)
+}
+
+// SendMailFrom sends the message with MAIL FROM address `from` instead of
+// the address used for authentication.
+func (c *SMTPClient) SendMailFrom(r io.Reader, from string) *SMTPResponse {
+	_, tos, message := parseMail(r, from, "")
+
+	commands := getEnvelopeCommands(from, tos)
+	commands = append(commands, "DATA", message+"\r\n.") // Message ending.
+	return c.SendCommands(commands...)
+}
+
+// SendMailWithParams sends the message with MAIL command parameters `params`,
+// e.g. "SMTPUTF8 BODY=8BITMIME".
+func (c *SMTPClient) SendMailWithParams(r io.Reader, params string) *SMTPResponse {
+	from, tos, message := parseMail(r, c.address, "")
+
+	commands := getEnvelopeCommands(from, tos)
+	commands[0] += " " + params
+	commands = append(commands, "DATA", message+"\r\n.") // Message ending.
+	return c.SendCommands(commands...)
+}
+
+// SendMailWithBDAT sends the message using BDAT command (RFC 3030) in chunks of `chunkSize` bytes.
+func (c *SMTPClient) SendMailWithBDAT(r io.Reader, bcc string, chunkSize int) *SMTPResponse {
+	from, tos, message := parseMail(r, c.address, bcc)
+
+	smtpResponse := c.SendCommands(getEnvelopeCommands(from, tos)...)
+	if smtpResponse.err != nil {
+		return smtpResponse
+	}
+
+	for len(message) > 0 {
+		size := chunkSize
+		last := ""
+		if size >= len(message) {
+			size = len(message)
+			last = " LAST"
+		}
+		smtpResponse = c.sendChunk(fmt.Sprintf("BDAT %d%s", size, last), message[:size])
+		if smtpResponse.err != nil {
+			return smtpResponse
+		}
+		message = message[size:]
+	}
+	return smtpResponse
+}
+
+// SendMailPipelined sends the envelope and DATA command in one group without
+// waiting for responses (RFC 2920) and then the message itself.
+func (c *SMTPClient) SendMailPipelined(r io.Reader, bcc string) *SMTPResponse {
+	from, tos, message := parseMail(r, c.address, bcc)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	smtpResponse := &SMTPResponse{t: c.t}
+
+	commands := append(getEnvelopeCommands(from, tos), "DATA")
+	for _, command := range commands {
+		c.debug.printReq(command)
+	}
+	fmt.Fprintf(c.conn, "%s\r\n", strings.Join(commands, "\r\n"))
+
+	// All responses have to be read even when some command failed.
+	for range commands {
+		message, err := c.response.ReadString('\n')
+		if err != nil {
+			smtpResponse.err = fmt.Errorf("read response failed: %v", err)
+			return smtpResponse
+		}
+		if smtpResponse.err == nil && (strings.HasPrefix(message, "4") || strings.HasPrefix(message, "5")) {
+			c.debug.printErr(message)
+			smtpResponse.err = errors.Wrap(errors.New(strings.Trim(message, "\r\n")), "SMTP error")
+			continue
+		}
+		c.debug.printRes(message)
+	}
+	if smtpResponse.err != nil {
+		return smtpResponse
+	}
+
+	c.debug.printReq(message)
+	fmt.Fprintf(c.conn, "%s\r\n.\r\n", message)
+
+	message, err := c.response.ReadString('\n')
+	if err != nil {
+		smtpResponse.err = fmt.Errorf("read response failed: %v", err)
+		return smtpResponse
+	}
+	if strings.HasPrefix(message, "4") || strings.HasPrefix(message, "5") {
+		c.debug.printErr(message)
+		smtpResponse.err = errors.Wrap(errors.New(strings.Trim(message, "\r\n")), "SMTP error")
+		return smtpResponse
+	}
+
+	c.debug.printRes(message)
+	smtpResponse.result = message
+	return smtpResponse
+}
+
+// SendMailLMTP delivers the message over LMTP (RFC 2033) to recipients from
+// To and CC headers. LMTP replies after DATA with status of each recipient;
+// the first error of any recipient is returned.
+func (c *SMTPClient) SendMailLMTP(r io.Reader) *SMTPResponse {
+	from, tos, message := parseMail(r, "", "")
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	smtpResponse := &SMTPResponse{t: c.t}
+
+	commands := append([]string{"LHLO ateist.test"}, getEnvelopeCommands(from, tos)...)
+	commands = append(commands, "DATA", message+"\r\n.")
+	for i, command := range commands {
+		c.debug.printReq(command)
+		fmt.Fprintf(c.conn, "%s\r\n", command)
+
+		replies := 1
+		if i == len(commands)-1 {
+			replies = len(tos)
+		}
+		for ; replies > 0; replies-- {
+			if err := c.readReply(); err != nil {
+				smtpResponse.err = err
+				return smtpResponse
+			}
+		}
+	}
+	return smtpResponse
+}
+
+// readReply reads the whole reply including all lines of multiline one.
+func (c *SMTPClient) readReply() error {
+	for {
+		message, err := c.response.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read response failed: %v", err)
+		}
+		if strings.HasPrefix(message, "4") || strings.HasPrefix(message, "5") {
+			c.debug.printErr(message)
+			return errors.Wrap(errors.New(strings.Trim(message, "\r\n")), "SMTP error")
+		}
+		c.debug.printRes(message)
+		if len(message) < 4 || message[3] != '-' {
+			return nil
+		}
+	}
+}
+
+func (c *SMTPClient) sendChunk(command, chunk string) *SMTPResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	smtpResponse := &SMTPResponse{t: c.t}
+
+	c.debug.printReq(command)
+	fmt.Fprintf(c.conn, "%s\r\n%s", command, chunk)
+
+	message, err := c.response.ReadString('\n')
+	if err != nil {
+		smtpResponse.err = fmt.Errorf("read response failed: %v", err)
+		return smtpResponse
+	}
+	if strings.HasPrefix(message, "4") || strings.HasPrefix(message, "5") {
+		c.debug.printErr(message)
+		smtpResponse.err = errors.Wrap(errors.New(strings.Trim(message, "\r\n")), "SMTP error")
+		return smtpResponse
+	}
+
+	c.debug.printRes(message)
+	smtpResponse.result = message
+	return smtpResponse
+}
+
+func parseMail(r io.Reader, address, bcc string) (from string, tos []string, message string) {
 	if bcc != "" {
 		tos = append(tos, bcc)
 	}
 
+	from = address
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := string(bytes.Trim(scanner.Bytes(), "\r\n")) // Make sure no line ending is there.
 		message += line + "\r\n"
 
-		from = c.address
 		if from == "" && strings.HasPrefix(line, "From: ") {
 			if addr, err := mail.ParseAddress(line[6:]); err == nil {
 				from = addr.Address
@@ -171,12 +380,15 @@ func (c *SMTPClient) SendMail(r io.Reader, bcc string) *SMTPResponse {
 		panic(fmt.Errorf("smtp eml no to"))
 	}
 
+	return from, tos, message
+}
+
+func getEnvelopeCommands(from string, tos []string) []string {
 	commands := []string{
 		fmt.Sprintf("MAIL FROM:<%s>", from),
 	}
 	for _, to := range tos {
 		commands = append(commands, fmt.Sprintf("RCPT TO:<%s>", to))
 	}
-	commands = append(commands, "DATA", message+"\r\n.") // Message ending.
-	return c.SendCommands(commands...)
+	return commands
 }
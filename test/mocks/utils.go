@@ -24,3 +24,8 @@ import (
 func base64(data string) (encoded string) {
 	return b64.StdEncoding.EncodeToString([]byte(data))
 }
+
+func decodeBase64(encoded string) (data string, err error) {
+	decoded, err := b64.StdEncoding.DecodeString(encoded)
+	return string(decoded), err
+}
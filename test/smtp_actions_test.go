@@ -30,6 +30,10 @@ func SMTPActionsAuthFeatureContext(s *godog.Suite) {
 	s.Step(`^SMTP client authenticates "([^"]*)" with address "([^"]*)"$`, smtpClientAuthenticatesWithAddress)
 	s.Step(`^SMTP client "([^"]*)" authenticates "([^"]*)" with address "([^"]*)"$`, smtpClientNamedAuthenticatesWithAddress)
 	s.Step(`^SMTP client authenticates "([^"]*)" with bad password$`, smtpClientAuthenticatesWithBadPassword)
+	s.Step(`^SMTP client authenticates "([^"]*)" using CRAM-MD5$`, smtpClientAuthenticatesUsingCRAMMD5)
+	s.Step(`^SMTP client authenticates "([^"]*)" using CRAM-MD5 with bad password$`, smtpClientAuthenticatesUsingCRAMMD5WithBadPassword)
+	s.Step(`^SMTP client authenticates "([^"]*)" using OAUTHBEARER$`, smtpClientAuthenticatesUsingOAuthBearer)
+	s.Step(`^SMTP client authenticates "([^"]*)" using OAUTHBEARER with bad password$`, smtpClientAuthenticatesUsingOAuthBearerWithBadPassword)
 	s.Step(`^SMTP client authenticates with username "([^"]*)" and password "([^"]*)"$`, smtpClientAuthenticatesWithUsernameAndPassword)
 	s.Step(`^SMTP client logs out$`, smtpClientLogsOut)
 	s.Step(`^SMTP client sends message$`, smtpClientSendsMessage)
@@ -37,6 +41,12 @@ func SMTPActionsAuthFeatureContext(s *godog.Suite) {
 	s.Step(`^SMTP client "([^"]*)" sends message$`, smtpClientNamedSendsMessage)
 	s.Step(`^SMTP client sends message with bcc "([^"]*)"$`, smtpClientSendsMessageWithBCC)
 	s.Step(`^SMTP client "([^"]*)" sends message with bcc "([^"]*)"$`, smtpClientNamedSendsMessageWithBCC)
+	s.Step(`^SMTP client sends message using BDAT in chunks of (\d+) bytes$`, smtpClientSendsMessageUsingBDAT)
+	s.Step(`^SMTP client sends message with MAIL parameters "([^"]*)"$`, smtpClientSendsMessageWithParams)
+	s.Step(`^SMTP client sends message with MAIL FROM "([^"]*)"$`, smtpClientSendsMessageWithMailFrom)
+	s.Step(`^SMTP client sends message using pipelining$`, smtpClientSendsMessageUsingPipelining)
+	s.Step(`^SMTP client sends message using pipelining with bcc "([^"]*)"$`, smtpClientSendsMessageUsingPipeliningWithBCC)
+	s.Step(`^LMTP client delivers message$`, lmtpClientDeliversMessage)
 }
 
 func smtpClientAuthenticates(bddUserID string) error {
@@ -77,6 +87,46 @@ func smtpClientAuthenticatesWithBadPassword(bddUserID string) error {
 	return nil
 }
 
+func smtpClientAuthenticatesUsingCRAMMD5(bddUserID string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	res := ctx.GetSMTPClient("smtp").LoginCRAMMD5(account.Address(), account.BridgePassword())
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func smtpClientAuthenticatesUsingCRAMMD5WithBadPassword(bddUserID string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	res := ctx.GetSMTPClient("smtp").LoginCRAMMD5(account.Address(), "you shall not pass!")
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func smtpClientAuthenticatesUsingOAuthBearer(bddUserID string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	res := ctx.GetSMTPClient("smtp").LoginOAuthBearer(account.Address(), account.BridgePassword())
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func smtpClientAuthenticatesUsingOAuthBearerWithBadPassword(bddUserID string) error {
+	account := ctx.GetTestAccount(bddUserID)
+	if account == nil {
+		return godog.ErrPending
+	}
+	res := ctx.GetSMTPClient("smtp").LoginOAuthBearer(account.Address(), "you shall not pass!")
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
 func smtpClientAuthenticatesWithUsernameAndPassword(bddUserID, password string) error {
 	res := ctx.GetSMTPClient("smtp").Login(bddUserID, password)
 	ctx.SetSMTPLastResponse("smtp", res)
@@ -112,3 +162,37 @@ func smtpClientNamedSendsMessageWithBCC(clientID, bcc string, message *gherkin.D
 	ctx.SetSMTPLastResponse(clientID, res)
 	return nil
 }
+
+func smtpClientSendsMessageUsingBDAT(chunkSize int, message *gherkin.DocString) error {
+	res := ctx.GetSMTPClient("smtp").SendMailWithBDAT(strings.NewReader(message.Content), "", chunkSize)
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func smtpClientSendsMessageWithParams(params string, message *gherkin.DocString) error {
+	res := ctx.GetSMTPClient("smtp").SendMailWithParams(strings.NewReader(message.Content), params)
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func smtpClientSendsMessageWithMailFrom(from string, message *gherkin.DocString) error {
+	res := ctx.GetSMTPClient("smtp").SendMailFrom(strings.NewReader(message.Content), from)
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func smtpClientSendsMessageUsingPipelining(message *gherkin.DocString) error {
+	return smtpClientSendsMessageUsingPipeliningWithBCC("", message)
+}
+
+func smtpClientSendsMessageUsingPipeliningWithBCC(bcc string, message *gherkin.DocString) error {
+	res := ctx.GetSMTPClient("smtp").SendMailPipelined(strings.NewReader(message.Content), bcc)
+	ctx.SetSMTPLastResponse("smtp", res)
+	return nil
+}
+
+func lmtpClientDeliversMessage(message *gherkin.DocString) error {
+	res := ctx.GetLMTPClient("lmtp").SendMailLMTP(strings.NewReader(message.Content))
+	ctx.SetSMTPLastResponse("lmtp", res)
+	return nil
+}